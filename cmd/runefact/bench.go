@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/spf13/cobra"
+	"github.com/vgalaktionov/runefact/internal/build"
+)
+
+var (
+	flagBenchRuns      int
+	flagBenchSave      string
+	flagBenchCompare   string
+	flagBenchThreshold float64
+)
+
+var benchCmd = &cobra.Command{
+	Use:   "bench",
+	Short: "Time the build to catch performance regressions",
+	Long: `Bench builds the whole project several times, each into a fresh temporary
+directory, and prints the fastest and median time of every build phase
+and the memory a build allocates. The project's own output is not touched.
+
+--save writes the results as JSON. --compare checks them against a saved
+baseline and fails when a median is more than --threshold percent slower,
+or a build allocates that much more; phases under a millisecond are too
+noisy to compare.
+
+Examples:
+  runefact bench --runs 10
+  runefact bench --save bench.json
+  runefact bench --compare bench.json --threshold 15`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root, cfg, err := loadProjectConfig()
+		if err != nil {
+			return err
+		}
+
+		report, err := build.Bench(flagBenchRuns, cfg, root)
+		if err != nil {
+			return err
+		}
+		if !flagQuiet {
+			writeBenchReport(cmd.OutOrStdout(), report)
+		}
+
+		if flagBenchSave != "" {
+			if err := build.SaveBenchReport(flagBenchSave, report); err != nil {
+				return err
+			}
+		}
+		if flagBenchCompare != "" {
+			base, err := build.LoadBenchReport(flagBenchCompare)
+			if err != nil {
+				return err
+			}
+			regressions := build.CompareBench(base, report, flagBenchThreshold)
+			for _, r := range regressions {
+				fmt.Fprintf(cmd.ErrOrStderr(), "regression: %s\n", r)
+			}
+			if len(regressions) > 0 {
+				return fmt.Errorf("%d regression(s) over %.0f%%", len(regressions), flagBenchThreshold)
+			}
+		}
+		return nil
+	},
+}
+
+func writeBenchReport(w io.Writer, r *build.BenchReport) {
+	fmt.Fprintf(w, "%d run(s)\n", r.Runs)
+	fmt.Fprintf(w, "  %-12s %10s %10s\n", "phase", "min", "median")
+	for _, p := range slices.Concat(r.Phases, []build.PhaseStats{r.Total}) {
+		fmt.Fprintf(w, "  %-12s %10s %10s\n", p.Name, build.FormatDuration(p.Min), build.FormatDuration(p.Median))
+	}
+	fmt.Fprintf(w, "allocated per build: %s in %d objects\n", build.FormatBytes(float64(r.AllocBytes)), r.Allocs)
+}
+
+func init() {
+	benchCmd.Flags().IntVar(&flagBenchRuns, "runs", 5, "number of builds to time")
+	benchCmd.Flags().StringVar(&flagBenchSave, "save", "", "write the results to this JSON file")
+	benchCmd.Flags().StringVar(&flagBenchCompare, "compare", "", "compare against a baseline saved with --save")
+	benchCmd.Flags().Float64Var(&flagBenchThreshold, "threshold", 10, "percent slowdown --compare tolerates")
+}
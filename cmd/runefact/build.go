@@ -2,8 +2,12 @@ package main
 
 import (
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 
 	"github.com/vgalaktionov/runefact/internal/build"
 	"github.com/vgalaktionov/runefact/internal/config"
@@ -15,6 +19,16 @@ var (
 	flagMaps    bool
 	flagAudio   bool
 	flagNoCache bool
+	flagScope   string
+	flagStrict  bool
+
+	flagIncludeTags []string
+	flagExcludeTags []string
+
+	// flagSet holds --set overrides of runefact.toml, for build and validate.
+	flagSet []string
+
+	flagPackKey string
 )
 
 var buildCmd = &cobra.Command{
@@ -23,18 +37,41 @@ var buildCmd = &cobra.Command{
 	Long: `Build compiles .palette, .sprite, .map, .inst, .sfx, and .track files
 into PNG sprite sheets, JSON tilemaps, WAV audio, and a Go manifest package.
 
+Exit codes: 0 on success, 1 if runefact itself failed (bad flags, config or
+I/O), 2 if the assets have errors, 3 if there were warnings and --strict
+was given. With --strict the artifacts are still written.
+
 Examples:
   runefact build                    # build everything
   runefact build --sprites          # build only sprites
-  runefact build player.sprite      # build specific file`,
-	RunE: runBuild,
+  runefact build --scope audio      # build only sfx and tracks
+  runefact build player.sprite      # build specific file
+  runefact build default.palette    # build every sprite using a palette
+  runefact build --include-tags demo --exclude-tags full
+  runefact build --strict           # fail on warnings too
+  runefact build --set project.output=dist/assets --set defaults.sample_rate=48000
+  RUNEFACT_PACK_KEY=... runefact build --set project.pack=true  # release build into assets.rfpack
+
+Config values can be overridden without editing runefact.toml, by
+RUNEFACT_<SECTION>_<KEY> environment variables such as
+RUNEFACT_PROJECT_OUTPUT, and by --set flags. Flags beat the environment,
+which beats runefact.toml, which beats the defaults.`,
+	ValidArgsFunction: completeRuneFiles(false),
+	RunE:              runBuild,
 }
 
 func init() {
 	buildCmd.Flags().BoolVar(&flagSprites, "sprites", false, "build only sprites")
 	buildCmd.Flags().BoolVar(&flagMaps, "maps", false, "build only maps")
 	buildCmd.Flags().BoolVar(&flagAudio, "audio", false, "build only audio")
+	buildCmd.Flags().StringVar(&flagScope, "scope", string(build.ScopeAll), "build only one kind of asset: all, sprites, maps or audio")
+	buildCmd.Flags().BoolVar(&flagStrict, "strict", false, "fail with exit code 3 if there are warnings")
 	buildCmd.Flags().BoolVar(&flagNoCache, "no-cache", false, "force full rebuild, ignore cache")
+	buildCmd.Flags().StringSliceVar(&flagIncludeTags, "include-tags", nil, "only build tagged assets with one of these tags (untagged assets always build)")
+	buildCmd.Flags().StringSliceVar(&flagExcludeTags, "exclude-tags", nil, "skip assets with any of these tags")
+	buildCmd.Flags().StringArrayVar(&flagSet, "set", nil, "override a runefact.toml value as section.key=value (repeatable)")
+	buildCmd.Flags().StringVar(&flagPackKey, "pack-key", "", "key for project.pack_cipher (default $"+build.PackKeyEnv+")")
+	buildCmd.RegisterFlagCompletionFunc("scope", cobra.FixedCompletions(scopeCompletions(), cobra.ShellCompDirectiveNoFileComp))
 }
 
 func runBuild(cmd *cobra.Command, args []string) error {
@@ -43,7 +80,10 @@ func runBuild(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	scope := build.ScopeAll
+	scope := build.Scope(flagScope)
+	if !slices.Contains(build.Scopes, scope) {
+		return fmt.Errorf("unknown scope %q (want all, sprites, maps or audio)", flagScope)
+	}
 	if flagSprites {
 		scope = build.ScopeSprites
 	} else if flagMaps {
@@ -53,37 +93,150 @@ func runBuild(cmd *cobra.Command, args []string) error {
 	}
 
 	opts := build.Options{
-		Scope: scope,
-		Files: args,
+		Scope:       scope,
+		Files:       args,
+		IncludeTags: flagIncludeTags,
+		ExcludeTags: flagExcludeTags,
+		PackKey:     flagPackKey,
 	}
 
 	result := build.Build(opts, cfg, root)
 
-	for _, w := range result.Warnings {
-		if !flagQuiet {
-			fmt.Fprintf(os.Stderr, "warning: %s\n", w)
-		}
-	}
+	logPulled(result)
+	logWarnings(result)
 
 	if len(result.Errors) > 0 {
 		for _, e := range result.Errors {
-			fmt.Fprintf(os.Stderr, "error: %v\n", e)
+			slog.Error(e.Error())
+		}
+		// Failing to write the output is runefact's problem, not the
+		// assets'.
+		if result.HasIOErrors() {
+			return fmt.Errorf("build failed with %d error(s), writing output failed", len(result.Errors))
 		}
-		return fmt.Errorf("build failed with %d error(s)", len(result.Errors))
+		return assetErrorf("build failed with %d error(s)", len(result.Errors))
 	}
 
 	if !flagQuiet {
 		fmt.Printf("Built %d artifact(s)\n", len(result.Artifacts))
+		writeSizeReport(os.Stdout, result.Sizes)
 		if flagVerbose {
 			for _, a := range result.Artifacts {
 				fmt.Printf("  %s\n", a)
 			}
+			if len(result.Skipped) > 0 {
+				fmt.Printf("Skipped %d file(s) by tag:\n", len(result.Skipped))
+				for _, f := range result.Skipped {
+					fmt.Printf("  %s\n", f)
+				}
+			}
 		}
 	}
 
+	if flagStrict && len(result.Warnings) > 0 {
+		return warningErrorf("build finished with %d warning(s) (--strict)", len(result.Warnings))
+	}
 	return nil
 }
 
+// logPulled lists the files a build or validation of named files took in
+// besides them.
+func logPulled(r *build.Result) {
+	if len(r.Pulled) == 0 {
+		return
+	}
+	names := make([]string, len(r.Pulled))
+	for i, f := range r.Pulled {
+		names[i] = filepath.Base(f)
+	}
+	slog.Info(fmt.Sprintf("pulled in %d dependent or required file(s): %s", len(names), strings.Join(names, ", ")))
+}
+
+// warningLinesPerFile caps how many distinct warnings are shown for each
+// file, unless --verbose is given.
+const warningLinesPerFile = 10
+
+// logWarnings logs a build's warnings, one record per file with identical
+// warnings merged. --verbose lists every message, and every cell of those
+// that sum up map cells.
+func logWarnings(r *build.Result) {
+	limit := warningLinesPerFile
+	if flagVerbose {
+		limit = 0
+	}
+	for _, g := range r.WarningSummary() {
+		slog.Warn(formatWarningGroup(g, limit, flagVerbose))
+	}
+}
+
+// formatWarningGroup renders one file's warnings. A lone warning is one
+// line, "file: message". Otherwise a header with the count is followed by
+// an indented line per distinct message, suffixed with how many times it
+// occurred, and at most limit of them when limit is positive. With cells,
+// a message about several map cells is followed by all of them.
+func formatWarningGroup(g build.WarningGroup, limit int, cells bool) string {
+	var b strings.Builder
+	if g.Total == 1 {
+		if g.File != "" {
+			b.WriteString(g.File + ": ")
+		}
+		b.WriteString(g.Warnings[0].Message)
+		if cells {
+			writeCells(&b, g.Warnings[0].Cells)
+		}
+		return b.String()
+	}
+	if g.File != "" {
+		b.WriteString(g.File + ": ")
+	}
+	fmt.Fprintf(&b, "%d warnings", g.Total)
+	shown := g.Warnings
+	if limit > 0 && len(shown) > limit {
+		shown = shown[:limit]
+	}
+	for _, w := range shown {
+		b.WriteString("\n  " + w.Message)
+		if w.Count > 1 {
+			fmt.Fprintf(&b, " ×%d", w.Count)
+		}
+		if cells {
+			writeCells(&b, w.Cells)
+		}
+	}
+	if n := len(g.Warnings) - len(shown); n > 0 {
+		fmt.Fprintf(&b, "\n  ... and %d more (use --verbose for all)", n)
+	}
+	return b.String()
+}
+
+// writeCells appends an indented line of row,col pairs when there is more
+// than one cell; a single cell is already in the message.
+func writeCells(b *strings.Builder, cells [][2]int) {
+	if len(cells) < 2 {
+		return
+	}
+	b.WriteString("\n    cells:")
+	for _, c := range cells {
+		fmt.Fprintf(b, " %d,%d", c[0], c[1])
+	}
+}
+
+// writeSizeReport prints the output size and each budget's usage.
+func writeSizeReport(w io.Writer, r *build.SizeReport) {
+	if r == nil {
+		return
+	}
+	fmt.Fprintf(w, "Output: %s\n", build.FormatBytes(float64(r.TotalBytes)))
+	for _, b := range r.Budgets {
+		status := "ok"
+		if !b.OK {
+			status = "OVER"
+		}
+		fmt.Fprintf(w, "  %-12s %10s of %10s  %s\n", b.Name,
+			build.FormatBytes(float64(b.SizeBytes)), build.FormatBytes(float64(b.LimitBytes)), status)
+	}
+}
+
 func loadProjectConfig() (string, *config.ProjectConfig, error) {
 	var root string
 	var err error
@@ -97,8 +250,18 @@ func loadProjectConfig() (string, *config.ProjectConfig, error) {
 		}
 	}
 
+	// Flags come after the environment so they win.
+	overrides, err := config.EnvOverrides(os.Environ())
+	if err != nil {
+		return "", nil, err
+	}
+	sets, err := config.ParseSetFlags(flagSet)
+	if err != nil {
+		return "", nil, err
+	}
+
 	cfgPath := config.GetConfigPath(root)
-	cfg, err := config.LoadConfig(cfgPath)
+	cfg, err := config.LoadConfig(cfgPath, append(overrides, sets...)...)
 	if err != nil {
 		return "", nil, err
 	}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/vgalaktionov/runefact/internal/build"
+)
+
+func TestFormatWarningGroup(t *testing.T) {
+	lone := build.WarningGroup{File: "assets/sfx/zap.sfx", Total: 1, Warnings: []build.WarningCount{{Message: "peak clipped", Count: 1}}}
+	if got := formatWarningGroup(lone, 10, false); got != "assets/sfx/zap.sfx: peak clipped" {
+		t.Errorf("lone warning = %q", got)
+	}
+
+	g := build.WarningGroup{File: "assets/maps/level.map", Total: 40}
+	g.Warnings = append(g.Warnings, build.WarningCount{Message: "unknown key", Count: 37})
+	for i := range 3 {
+		g.Warnings = append(g.Warnings, build.WarningCount{Message: fmt.Sprintf("other %d", i), Count: 1})
+	}
+	want := "assets/maps/level.map: 40 warnings\n  unknown key ×37\n  other 0\n  ... and 2 more (use --verbose for all)"
+	if got := formatWarningGroup(g, 2, false); got != want {
+		t.Errorf("capped group =\n%s\nwant\n%s", got, want)
+	}
+	if got := formatWarningGroup(g, 0, false); strings.Count(got, "\n") != 4 || strings.Contains(got, "more") {
+		t.Errorf("unlimited group =\n%s\nwant all 4 messages", got)
+	}
+
+	region := build.WarningGroup{File: "assets/maps/level.map", Total: 1, Warnings: []build.WarningCount{
+		{Message: `layer "main": unknown tileset key "x" in 2 cells: row 1, cols 1-2`, Count: 1, Cells: [][2]int{{1, 1}, {1, 2}}},
+	}}
+	if got := formatWarningGroup(region, 0, true); !strings.HasSuffix(got, "cols 1-2\n    cells: 1,1 1,2") {
+		t.Errorf("verbose region warning =\n%s\nwant its cells listed", got)
+	}
+	if got := formatWarningGroup(region, 10, false); strings.Contains(got, "\n") {
+		t.Errorf("region warning without --verbose =\n%s\nwant no cell list", got)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/vgalaktionov/runefact/internal/build"
+)
+
+// completeRuneFiles returns a completion function for commands that take
+// rune files. It offers the project's files with the given extensions, or
+// every rune file when none are given, by bare name as the commands accept
+// them; once a path is being typed it offers paths instead. Files already
+// on the command line aren't offered again, and single-file commands stop
+// completing after their first argument.
+func completeRuneFiles(single bool, exts ...string) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if single && len(args) > 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		root, _, err := loadProjectConfig()
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return runeFileCompletions(root, args, toComplete, exts...), cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// runeFileCompletions lists the completions for toComplete among the
+// project's rune files.
+func runeFileCompletions(root string, args []string, toComplete string, exts ...string) []string {
+	asPath := strings.ContainsRune(toComplete, '/') || strings.ContainsRune(toComplete, filepath.Separator)
+	wd, _ := os.Getwd()
+
+	var out []string
+	for _, f := range build.AssetFiles(root, exts...) {
+		name := filepath.Base(f)
+		if asPath {
+			rel, err := filepath.Rel(wd, f)
+			if err != nil {
+				continue
+			}
+			name = filepath.ToSlash(rel)
+		}
+		if strings.HasPrefix(name, toComplete) && !slices.Contains(args, name) {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// scopeCompletions are the values of build --scope, with descriptions.
+func scopeCompletions() []string {
+	desc := map[build.Scope]string{
+		build.ScopeAll:     "everything",
+		build.ScopeSprites: "sprite sheets",
+		build.ScopeMaps:    "tilemaps",
+		build.ScopeAudio:   "sfx and tracks",
+	}
+	out := make([]string, len(build.Scopes))
+	for i, s := range build.Scopes {
+		out[i] = string(s) + "\t" + desc[s]
+	}
+	return out
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/vgalaktionov/runefact/internal/format"
+	"github.com/vgalaktionov/runefact/internal/scaffold"
+)
+
+// chdirScaffold writes the default template into a temp dir, with some
+// files that aren't rune files next to the assets, and changes into it.
+func chdirScaffold(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	files, err := scaffold.Files(scaffold.Default, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files = append(files,
+		scaffold.File{Path: "assets/sprites/notes.txt", Content: "todo"},
+		scaffold.File{Path: "build/assets/sprites/player.png"},
+	)
+	for _, f := range files {
+		path := filepath.Join(dir, filepath.FromSlash(f.Path))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(f.Content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	origDir, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(origDir) })
+	flagConfig = ""
+	return dir
+}
+
+func TestCompleteRuneFiles(t *testing.T) {
+	chdirScaffold(t)
+
+	got, directive := completeRuneFiles(false)(buildCmd, nil, "")
+	want := []string{
+		"default.palette", "player.sprite", "tiles.sprite", "level1.map",
+		"bass.inst", "lead.inst", "coin.sfx", "jump.sfx", "demo.track",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("build completions = %v, want %v", got, want)
+	}
+	if directive != cobra.ShellCompDirectiveNoFileComp {
+		t.Errorf("directive = %v, want NoFileComp", directive)
+	}
+
+	// Files already given aren't offered again.
+	got, _ = completeRuneFiles(false)(buildCmd, []string{"player.sprite"}, "")
+	if slices.Contains(got, "player.sprite") {
+		t.Errorf("completions repeat an argument: %v", got)
+	}
+
+	got, _ = completeRuneFiles(true, ".sprite", ".map", ".sfx", ".track")(previewCmd, nil, "")
+	for _, f := range got {
+		if strings.HasSuffix(f, ".palette") || strings.HasSuffix(f, ".inst") {
+			t.Errorf("preview completions include %s", f)
+		}
+	}
+
+	got, _ = completeRuneFiles(true, ".sprite")(previewCmd, nil, "t")
+	if !slices.Equal(got, []string{"tiles.sprite"}) {
+		t.Errorf("prefix completions = %v, want [tiles.sprite]", got)
+	}
+
+	got, _ = completeRuneFiles(true)(previewCmd, []string{"tiles.sprite"}, "")
+	if len(got) != 0 {
+		t.Errorf("single-file command completed a second argument: %v", got)
+	}
+
+	got, _ = completeRuneFiles(false, ".sprite")(buildCmd, nil, "assets/sprites/")
+	if !slices.Equal(got, []string{"assets/sprites/player.sprite", "assets/sprites/tiles.sprite"}) {
+		t.Errorf("path completions = %v", got)
+	}
+}
+
+// Completing through the hidden __complete command, as the shell scripts
+// do, lists only rune files.
+func TestComplete_BuildArgs(t *testing.T) {
+	chdirScaffold(t)
+
+	var out bytes.Buffer
+	rootCmd.SetOut(&out)
+	rootCmd.SetArgs([]string{cobra.ShellCompNoDescRequestCmd, "build", ""})
+	defer rootCmd.SetArgs(nil)
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if strings.HasPrefix(line, ":") {
+			continue // the directive
+		}
+		if _, ok := format.Dirs[filepath.Ext(line)]; !ok {
+			t.Errorf("completion %q is not a rune file", line)
+		}
+	}
+	if !strings.Contains(out.String(), "player.sprite\n") {
+		t.Errorf("completions missing player.sprite:\n%s", out.String())
+	}
+}
+
+func TestComplete_Scope(t *testing.T) {
+	var out bytes.Buffer
+	rootCmd.SetOut(&out)
+	rootCmd.SetArgs([]string{cobra.ShellCompNoDescRequestCmd, "build", "--scope", ""})
+	defer rootCmd.SetArgs(nil)
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	for _, scope := range []string{"all", "sprites", "maps", "audio"} {
+		if !strings.Contains(out.String(), scope+"\n") {
+			t.Errorf("scope completions missing %s:\n%s", scope, out.String())
+		}
+	}
+}
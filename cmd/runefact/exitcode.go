@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Exit codes. CI scripts rely on these, so they must not change.
+const (
+	exitOK       = 0 // success
+	exitInternal = 1 // runefact itself failed: bad flags, config, I/O
+	exitAssets   = 2 // the assets have validation or build errors
+	exitWarnings = 3 // the assets have warnings and --strict was given
+)
+
+// exitError is an error that ends the process with a specific exit code.
+// Errors that aren't one exit with exitInternal.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
+// assetErrorf reports errors in the assets being built or validated.
+func assetErrorf(format string, args ...any) error {
+	return &exitError{code: exitAssets, err: fmt.Errorf(format, args...)}
+}
+
+// warningErrorf reports warnings that fail the command under --strict.
+func warningErrorf(format string, args ...any) error {
+	return &exitError{code: exitWarnings, err: fmt.Errorf(format, args...)}
+}
+
+// exitCode returns the process exit code for an error returned by Execute.
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	var ee *exitError
+	if errors.As(err, &ee) {
+		return ee.code
+	}
+	return exitInternal
+}
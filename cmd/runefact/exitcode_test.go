@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/vgalaktionov/runefact/internal/scaffold"
+)
+
+// chdirProject writes the minimal template into a temp dir, with extra
+// appended to runefact.toml and the given asset files, and changes into it.
+func chdirProject(t *testing.T, extra string, assets map[string]string) {
+	t.Helper()
+	dir := t.TempDir()
+	files, err := scaffold.Files("minimal", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files[0].Content += extra
+	for path, content := range assets {
+		files = append(files, scaffold.File{Path: path, Content: content})
+	}
+	for _, f := range files {
+		path := filepath.Join(dir, filepath.FromSlash(f.Path))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(f.Content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	origDir, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(origDir) })
+	flagConfig = ""
+}
+
+// runCLI runs runefact with args and returns the exit code main would use
+// and what was logged.
+func runCLI(t *testing.T, args ...string) (int, string) {
+	t.Helper()
+	var stderr bytes.Buffer
+	rootCmd.SetArgs(args)
+	rootCmd.SetOut(io.Discard)
+	rootCmd.SetErr(&stderr)
+	logger := slog.Default()
+	t.Cleanup(func() {
+		rootCmd.SetArgs(nil)
+		rootCmd.SetOut(nil)
+		rootCmd.SetErr(nil)
+		slog.SetDefault(logger)
+		flagQuiet = false
+		flagVerbose = false
+		flagLogLevel = ""
+		flagLogFormat = "plain"
+		flagStrict = false
+		flagValidateStrict = false
+		flagScope = "all"
+		flagSet = nil
+		flagPackKey = ""
+		flagFmtCheck = false
+	})
+	code := exitCode(rootCmd.Execute())
+	return code, stderr.String()
+}
+
+const brokenSprite = `palette = "default"
+
+[sprite.broken]
+pixels = """
+zz
+"""
+`
+
+func TestExitCodes(t *testing.T) {
+	tests := []struct {
+		name   string
+		extra  string
+		assets map[string]string
+		args   []string
+		want   int
+	}{
+		{"build ok", "", nil, []string{"build", "-q"}, exitOK},
+		{"validate ok", "", nil, []string{"validate", "-q"}, exitOK},
+		{"build errors", "", map[string]string{"assets/sprites/broken.sprite": brokenSprite}, []string{"build", "-q"}, exitAssets},
+		{"validate errors", "", map[string]string{"assets/sprites/broken.sprite": brokenSprite}, []string{"validate", "-q"}, exitAssets},
+		{"build warnings", "\n[lint]\nmax_sheet_size = 4\n", nil, []string{"build", "-q"}, exitOK},
+		{"build warnings strict", "\n[lint]\nmax_sheet_size = 4\n", nil, []string{"build", "-q", "--strict"}, exitWarnings},
+		{"validate warnings strict", "\n[lint]\nmax_sheet_size = 4\n", nil, []string{"validate", "-q", "--strict"}, exitWarnings},
+		{"errors beat strict", "\n[lint]\nmax_sheet_size = 4\n", map[string]string{"assets/sprites/broken.sprite": brokenSprite}, []string{"build", "-q", "--strict"}, exitAssets},
+		{"bad flag value", "", nil, []string{"build", "--scope", "fonts"}, exitInternal},
+		{"unknown flag", "", nil, []string{"validate", "--fast"}, exitInternal},
+		{"set", "", nil, []string{"validate", "-q", "--strict", "--set", "lint.max_sheet_size=4"}, exitWarnings},
+		{"set invalid value", "", nil, []string{"build", "-q", "--set", "defaults.bit_depth=12"}, exitInternal},
+		{"set unknown key", "", nil, []string{"validate", "-q", "--set", "lint.max_sheet=4"}, exitInternal},
+		{"fmt check drift", "", map[string]string{"assets/sprites/loose.sprite": "palette=\"default\"\n"}, []string{"fmt", "-q", "--check"}, exitAssets},
+		{"fmt unparsable", "", map[string]string{"assets/sprites/broken.sprite": "palette = [\n"}, []string{"fmt", "-q"}, exitAssets},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chdirProject(t, tt.extra, tt.assets)
+			if got, _ := runCLI(t, tt.args...); got != tt.want {
+				t.Errorf("runefact %v exited with %d, want %d", tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExitCodes_ReadOnlyOutput(t *testing.T) {
+	if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+		t.Skip("directory permissions don't stop writes here")
+	}
+	chdirProject(t, "", nil)
+	out := filepath.Join("build", "assets")
+	if err := os.MkdirAll(out, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(out, 0555); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(out, 0755) })
+
+	if got, _ := runCLI(t, "build", "-q"); got != exitInternal {
+		t.Errorf("build into a read-only directory exited with %d, want %d", got, exitInternal)
+	}
+}
+
+// RUNEFACT_ variables override runefact.toml, and --set overrides them.
+func TestExitCodes_EnvOverrides(t *testing.T) {
+	chdirProject(t, "", nil)
+	t.Setenv("RUNEFACT_LINT_MAX_SHEET_SIZE", "4")
+	if got, _ := runCLI(t, "validate", "-q", "--strict"); got != exitWarnings {
+		t.Errorf("with the environment's max_sheet_size exited with %d, want %d", got, exitWarnings)
+	}
+	if got, _ := runCLI(t, "validate", "-q", "--strict", "--set", "lint.max_sheet_size=0"); got != exitOK {
+		t.Errorf("with --set over the environment exited with %d, want %d", got, exitOK)
+	}
+
+	t.Setenv("RUNEFACT_LINT_MAX_SHEET_SIZE", "big")
+	if got, _ := runCLI(t, "validate", "-q"); got != exitInternal {
+		t.Errorf("with an invalid environment value exited with %d, want %d", got, exitInternal)
+	}
+}
+
+func TestExitCodes_NoProject(t *testing.T) {
+	origDir, _ := os.Getwd()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(origDir)
+	flagConfig = ""
+
+	for _, cmd := range []string{"build", "validate"} {
+		if got, _ := runCLI(t, cmd, "-q"); got != exitInternal {
+			t.Errorf("runefact %s outside a project exited with %d, want %d", cmd, got, exitInternal)
+		}
+	}
+}
+
+// Warnings go through the logger, so --log-level, --log-format and -q
+// decide whether and how they are written.
+func TestLogFlags(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want []string // substrings of the log; none means it must be empty
+	}{
+		{"plain", []string{"validate"}, []string{"warning: "}},
+		{"quiet", []string{"validate", "-q"}, nil},
+		{"level", []string{"validate", "--log-level", "error"}, nil},
+		{"level beats quiet", []string{"validate", "-q", "--log-level", "warn"}, []string{"warning: "}},
+		{"json", []string{"validate", "--log-format", "json"}, []string{`"level":"WARN"`, `"time":`}},
+		{"text", []string{"validate", "--log-format", "text"}, []string{"level=WARN", "time="}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chdirProject(t, "\n[lint]\nmax_sheet_size = 4\n", nil)
+			code, log := runCLI(t, tt.args...)
+			if code != exitOK {
+				t.Fatalf("exit code %d, log:\n%s", code, log)
+			}
+			if len(tt.want) == 0 && log != "" {
+				t.Errorf("expected no log output, got:\n%s", log)
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(log, w) {
+					t.Errorf("log missing %q:\n%s", w, log)
+				}
+			}
+		})
+	}
+
+	chdirProject(t, "", nil)
+	if code, _ := runCLI(t, "validate", "--log-level", "loud"); code != exitInternal {
+		t.Errorf("unknown log level exited with %d, want %d", code, exitInternal)
+	}
+	if code, _ := runCLI(t, "validate", "--log-format", "xml"); code != exitInternal {
+		t.Errorf("unknown log format exited with %d, want %d", code, exitInternal)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/vgalaktionov/runefact/internal/export"
+	"github.com/vgalaktionov/runefact/internal/palette"
+	"github.com/vgalaktionov/runefact/internal/sprite"
+)
+
+var (
+	flagExportSprite string
+	flagExportOutput string
+	flagExportScale  int
+	flagExportFrame  int
+	flagExportSVGOut string
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export sprites in alternative formats",
+}
+
+var exportFramesCmd = &cobra.Command{
+	Use:   "frames <file>",
+	Short: "Write each frame of a sprite as its own PNG",
+	Long: `Export frames writes idle_0.png, idle_1.png, ... for one sprite instead of
+packing them into a sheet.
+
+Examples:
+  runefact export frames player.sprite --sprite idle -o out/
+  runefact export frames player.sprite --sprite idle -o out/ --scale 4`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeRuneFiles(true, ".sprite"),
+	RunE:              runExportFrames,
+}
+
+var exportSVGCmd = &cobra.Command{
+	Use:   "svg <file>",
+	Short: "Write one frame of a sprite as an SVG",
+	Long: `Export svg writes a resolution-independent SVG of one sprite frame, with
+one rect per horizontal run of same-colored pixels.
+
+Examples:
+  runefact export svg player.sprite --sprite heart -o heart.svg
+  runefact export svg player.sprite --sprite idle --frame 1 -o idle.svg`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeRuneFiles(true, ".sprite"),
+	RunE:              runExportSVG,
+}
+
+func init() {
+	exportFramesCmd.Flags().StringVar(&flagExportSprite, "sprite", "", "sprite to export (required)")
+	exportFramesCmd.Flags().StringVarP(&flagExportOutput, "output", "o", ".", "output directory")
+	exportFramesCmd.Flags().IntVar(&flagExportScale, "scale", 1, "integer upscale factor")
+	exportFramesCmd.MarkFlagRequired("sprite")
+
+	exportSVGCmd.Flags().StringVar(&flagExportSprite, "sprite", "", "sprite to export (required)")
+	exportSVGCmd.Flags().StringVarP(&flagExportSVGOut, "output", "o", "", "output file (default: <sprite>.svg)")
+	exportSVGCmd.Flags().IntVar(&flagExportFrame, "frame", 0, "frame to export")
+	exportSVGCmd.Flags().IntVar(&flagExportScale, "scale", 1, "display size multiplier")
+	exportSVGCmd.MarkFlagRequired("sprite")
+
+	exportCmd.AddCommand(exportFramesCmd)
+	exportCmd.AddCommand(exportSVGCmd)
+}
+
+func runExportFrames(cmd *cobra.Command, args []string) error {
+	root, cfg, err := loadProjectConfig()
+	if err != nil {
+		return err
+	}
+
+	s, err := loadResolvedSprite(root, args[0], flagExportSprite)
+	if err != nil {
+		return err
+	}
+
+	paths, err := export.WriteFrames(s, flagExportOutput, flagExportScale, cfg.Project.ColorKey())
+	if err != nil {
+		return err
+	}
+
+	if !flagQuiet {
+		fmt.Printf("Exported %d frame(s)\n", len(paths))
+		if flagVerbose {
+			for _, p := range paths {
+				fmt.Printf("  %s\n", p)
+			}
+		}
+	}
+	return nil
+}
+
+func runExportSVG(cmd *cobra.Command, args []string) error {
+	root, _, err := loadProjectConfig()
+	if err != nil {
+		return err
+	}
+
+	s, err := loadResolvedSprite(root, args[0], flagExportSprite)
+	if err != nil {
+		return err
+	}
+
+	data, err := export.SVG(s, flagExportFrame, flagExportScale)
+	if err != nil {
+		return err
+	}
+
+	out := flagExportSVGOut
+	if out == "" {
+		out = s.Name + ".svg"
+	}
+	if err := os.WriteFile(out, data, 0644); err != nil {
+		return fmt.Errorf("writing SVG: %w", err)
+	}
+
+	if !flagQuiet {
+		fmt.Printf("Exported %s\n", out)
+	}
+	return nil
+}
+
+// loadResolvedSprite parses a sprite file, resolves it against its palette
+// and returns the named sprite.
+func loadResolvedSprite(root, file, name string) (sprite.ResolvedSprite, error) {
+	resolved, path, err := loadResolvedSprites(root, file)
+	if err != nil {
+		return sprite.ResolvedSprite{}, err
+	}
+
+	names := make([]string, 0, len(resolved))
+	for _, s := range resolved {
+		if s.Name == name {
+			return s, nil
+		}
+		names = append(names, s.Name)
+	}
+	sort.Strings(names)
+	return sprite.ResolvedSprite{}, fmt.Errorf("unknown sprite %q in %s; available: %s", name, filepath.Base(path), strings.Join(names, ", "))
+}
+
+// loadResolvedSprites parses a sprite file and resolves it against its
+// palette. It also returns the path the file was found at.
+func loadResolvedSprites(root, file string) ([]sprite.ResolvedSprite, string, error) {
+	path := file
+	if _, err := os.Stat(path); err != nil && !filepath.IsAbs(path) {
+		path = filepath.Join(root, "assets", "sprites", file)
+	}
+
+	sf, err := sprite.LoadSpriteFile(path)
+	if err != nil {
+		return nil, path, err
+	}
+
+	pal := &palette.Palette{Colors: map[string]palette.Color{}}
+	if sf.PaletteRef != "" {
+		pal, err = palette.ResolvePalette(sf.PaletteRef, []string{filepath.Join(root, "assets", "palettes")})
+		if err != nil {
+			return nil, path, err
+		}
+	}
+
+	resolved, err := sf.ResolveWith(pal, sprite.DirPartLoader(filepath.Join(root, "assets")), sprite.DirPaletteLoader(filepath.Join(root, "assets")))
+	if err != nil {
+		return nil, path, fmt.Errorf("%s: %w", path, err)
+	}
+	return resolved, path, nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/vgalaktionov/runefact/internal/atomicfile"
+	"github.com/vgalaktionov/runefact/internal/format"
+)
+
+var flagFmtCheck bool
+
+var fmtCmd = &cobra.Command{
+	Use:   "fmt [files...]",
+	Short: "Rewrite rune files in canonical form",
+	Long: `Fmt rewrites rune files in a canonical layout: consistent spacing and key
+order, sorted palette colors, unindented pixel grids and aligned track
+pattern columns. Comments are kept. Without arguments it formats every rune
+file under assets/.
+
+With --check nothing is written; the files that need formatting are listed
+and the exit code is 2 if there are any, as it is for files that don't
+parse.
+
+Examples:
+  runefact fmt                        # format everything
+  runefact fmt player.sprite          # format one file
+  runefact fmt --check                # for CI`,
+	ValidArgsFunction: completeRuneFiles(false),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root, _, err := loadProjectConfig()
+		if err != nil {
+			return err
+		}
+
+		files, err := fmtFiles(root, args)
+		if err != nil {
+			return err
+		}
+
+		var unformatted, unparsable, failed int
+		for _, f := range files {
+			data, err := os.ReadFile(f)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				failed++
+				continue
+			}
+			out, err := format.Source(data, filepath.Ext(f))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %s: %v\n", f, err)
+				unparsable++
+				continue
+			}
+			if bytes.Equal(data, out) {
+				continue
+			}
+			unformatted++
+			if flagFmtCheck {
+				fmt.Fprintln(cmd.OutOrStdout(), relPath(root, f))
+				continue
+			}
+			info, err := os.Stat(f)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				failed++
+				continue
+			}
+			if err := atomicfile.WriteFile(f, out, info.Mode().Perm()); err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				failed++
+				continue
+			}
+			if !flagQuiet {
+				fmt.Fprintf(cmd.OutOrStdout(), "formatted %s\n", relPath(root, f))
+			}
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("%d file(s) could not be formatted", failed)
+		}
+		if unparsable > 0 {
+			return assetErrorf("%d file(s) could not be parsed", unparsable)
+		}
+		if flagFmtCheck && unformatted > 0 {
+			return assetErrorf("%d file(s) need formatting", unformatted)
+		}
+		return nil
+	},
+}
+
+func init() {
+	fmtCmd.Flags().BoolVar(&flagFmtCheck, "check", false, "list unformatted files and fail instead of rewriting them")
+}
+
+// fmtFiles returns the files named in args, looking bare names up in their
+// assets directory, or every rune file under assets/ if args is empty.
+func fmtFiles(root string, args []string) ([]string, error) {
+	assetsDir := filepath.Join(root, "assets")
+	if len(args) == 0 {
+		var files []string
+		err := filepath.WalkDir(assetsDir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if _, ok := format.Dirs[filepath.Ext(path)]; ok && !d.IsDir() {
+				files = append(files, path)
+			}
+			return nil
+		})
+		sort.Strings(files)
+		return files, err
+	}
+
+	files := make([]string, len(args))
+	for i, arg := range args {
+		dir, ok := format.Dirs[filepath.Ext(arg)]
+		if !ok {
+			return nil, fmt.Errorf("%s: not a rune file", arg)
+		}
+		files[i] = arg
+		if _, err := os.Stat(arg); err != nil && !filepath.IsAbs(arg) {
+			files[i] = filepath.Join(assetsDir, dir, arg)
+		}
+	}
+	return files, nil
+}
+
+// relPath returns path relative to the project root when possible.
+func relPath(root, path string) string {
+	if rel, err := filepath.Rel(root, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return path
+}
@@ -1,36 +1,76 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"slices"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/vgalaktionov/runefact/internal/config"
+	"github.com/vgalaktionov/runefact/internal/scaffold"
 )
 
 var (
-	flagInitName  string
-	flagInitForce bool
+	flagInitName     string
+	flagInitForce    bool
+	flagInitTemplate string
+	flagInitGit      bool
+	flagInitNoMCP    bool
 )
 
 var initCmd = &cobra.Command{
 	Use:   "init",
 	Short: "Initialize a new Runefact project",
 	Long: `Init scaffolds a new Runefact project with directory structure,
-default runefact.toml, and demo asset files.
+runefact.toml, and the starter assets of a template. It also writes the
+MCP config for Claude Code unless --no-mcp is given.
 
+--git writes a .gitignore for the build output and caches, merging into
+an existing one, and runs git init when git is installed and the
+directory isn't already in a repository.
+
+Templates:
+` + templateHelp() + `
 Examples:
-  runefact init                     # create project in current directory
-  runefact init --name my-game      # set project name`,
+  runefact init                       # create project in current directory
+  runefact init --name my-game        # set project name
+  runefact init --template topdown    # start from the top-down RPG template
+  runefact init --git --no-mcp        # git repo, no Claude config`,
 	RunE: runInit,
 }
 
 func init() {
 	initCmd.Flags().StringVar(&flagInitName, "name", "my-game", "project name")
 	initCmd.Flags().BoolVar(&flagInitForce, "force", false, "overwrite existing files")
+	initCmd.Flags().StringVar(&flagInitTemplate, "template", scaffold.Default,
+		"starter assets: "+strings.Join(scaffold.Names(), ", "))
+	initCmd.RegisterFlagCompletionFunc("template", cobra.FixedCompletions(templateCompletions(), cobra.ShellCompDirectiveNoFileComp))
+	initCmd.Flags().BoolVar(&flagInitGit, "git", false, "write a .gitignore and run git init")
+	initCmd.Flags().BoolVar(&flagInitNoMCP, "no-mcp", false, "skip the MCP and Claude Code config files")
+}
+
+// templateCompletions are the values of --template, with descriptions.
+func templateCompletions() []string {
+	out := make([]string, len(scaffold.Templates))
+	for i, t := range scaffold.Templates {
+		out[i] = t.Name + "\t" + t.Description
+	}
+	return out
+}
+
+// templateHelp lists the init templates, one per line.
+func templateHelp() string {
+	var b strings.Builder
+	for _, t := range scaffold.Templates {
+		fmt.Fprintf(&b, "  %-12s %s\n", t.Name, t.Description)
+	}
+	return b.String()
 }
 
 func runInit(cmd *cobra.Command, args []string) error {
@@ -46,14 +86,14 @@ func runInit(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	dirs := []string{
-		"assets/palettes",
-		"assets/sprites",
-		"assets/maps",
-		"assets/instruments",
-		"assets/sfx",
-		"assets/tracks",
-		".claude",
+	files, err := scaffold.Files(flagInitTemplate, flagInitName)
+	if err != nil {
+		return err
+	}
+
+	dirs := slices.Clone(scaffold.Dirs)
+	if !flagInitNoMCP {
+		dirs = append(dirs, ".claude")
 	}
 	for _, d := range dirs {
 		if err := os.MkdirAll(filepath.Join(wd, d), 0755); err != nil {
@@ -61,24 +101,39 @@ func runInit(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	files := scaffoldFiles(flagInitName)
 	for _, f := range files {
-		path := filepath.Join(wd, f.path)
-		if err := os.WriteFile(path, []byte(f.content), 0644); err != nil {
-			return fmt.Errorf("writing %s: %w", f.path, err)
+		path := filepath.Join(wd, filepath.FromSlash(f.Path))
+		if err := os.WriteFile(path, []byte(f.Content), 0644); err != nil {
+			return fmt.Errorf("writing %s: %w", f.Path, err)
 		}
 	}
 
-	// Set up MCP config (merges into existing files).
-	mcpFiles := setupMCPConfig(wd)
+	// Set up MCP config and .gitignore (both merge into existing files).
+	var extra []string
+	if !flagInitNoMCP {
+		extra = append(extra, setupMCPConfig(wd)...)
+	}
+	if flagInitGit {
+		cfg, err := config.ParseConfig([]byte(files[0].Content))
+		if err != nil {
+			return err
+		}
+		extra = append(extra, setupGitignore(wd, cfg.Project.Output)...)
+		created, err := gitInit(wd)
+		if err != nil {
+			slog.Warn(err.Error())
+		} else if created {
+			extra = append(extra, ".git/")
+		}
+	}
 
 	if !flagQuiet {
 		fmt.Printf("Initialized Runefact project %q\n", flagInitName)
 		fmt.Println("Created:")
 		for _, f := range files {
-			fmt.Printf("  %s\n", f.path)
+			fmt.Printf("  %s\n", f.Path)
 		}
-		for _, f := range mcpFiles {
+		for _, f := range extra {
 			fmt.Printf("  %s\n", f)
 		}
 		fmt.Println("\nRun 'runefact build' to compile assets.")
@@ -87,552 +142,6 @@ func runInit(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-type scaffoldFile struct {
-	path    string
-	content string
-}
-
-func scaffoldFiles(name string) []scaffoldFile {
-	return []scaffoldFile{
-		{
-			path: "runefact.toml",
-			content: fmt.Sprintf(`[project]
-name = %q
-output = "build/assets"
-package = "assets"
-
-[defaults]
-sprite_size = 16
-sample_rate = 44100
-bit_depth = 16
-
-[preview]
-window_width = 1200
-window_height = 900
-background = "#1a1a2e"
-pixel_scale = 4
-audio_volume = 0.5
-`, name),
-		},
-		{
-			path: "assets/palettes/default.palette",
-			content: `name = "default"
-
-[colors]
-_ = "transparent"
-k = "#000000"
-w = "#ffffff"
-r = "#ff004d"
-b = "#29adff"
-g = "#00e436"
-d = "#1d2b53"
-s = "#ffccaa"
-h = "#ab5236"
-y = "#ffec27"
-o = "#ffa300"
-p = "#7e2553"
-l = "#83769c"
-c = "#008751"
-e = "#5f574f"
-f = "#c2c3c7"
-`,
-		},
-		{
-			path: "assets/sprites/player.sprite",
-			content: `palette = "default"
-grid = 32
-
-palette_extend = { "n" = "#1a1a2e", "t" = "#e8d4b8" }
-
-[sprite.idle]
-framerate = 3
-
-[[sprite.idle.frame]]
-pixels = """
-________________________________
-_____________hhhhh______________
-___________hhhhhhhhh____________
-__________hhhhhhhhhh____________
-__________hhhhhhhhhh____________
-__________dddddddddd____________
-_________dddddddddddd___________
-_________dddwkddwkddd___________
-_________dddkkddkkddd___________
-_________ddttttttttdd___________
-_________dddttttttddd___________
-__________dtttsttttd____________
-__________ddttttttdd____________
-___________dddddddd_____________
-___________bbbbbbbbb____________
-__________bbbblbbbbbb___________
-_________bbbbbbbbbbbbb__________
-________sbbbbbbbbbbbbbs_________
-________s_bbbbbbbbbbb_s_________
-__________bbbbbbbbbbb___________
-___________bbb___bbb____________
-___________bbb___bbb____________
-___________bbb___bbb____________
-__________nnnn___nnnn___________
-__________nnnn___nnnn___________
-________________________________
-________________________________
-________________________________
-________________________________
-________________________________
-________________________________
-________________________________
-"""
-
-[[sprite.idle.frame]]
-pixels = """
-________________________________
-_____________hhhhh______________
-___________hhhhhhhhh____________
-__________hhhhhhhhhh____________
-__________hhhhhhhhhh____________
-__________dddddddddd____________
-_________dddddddddddd___________
-_________dddwkddwkddd___________
-_________dddkkddkkddd___________
-_________ddttttttttdd___________
-_________dddttttttddd___________
-__________dtttsttttd____________
-__________ddttttttdd____________
-___________dddddddd_____________
-___________bbbbbbbbb____________
-__________bbbblbbbbbb___________
-_________bbbbbbbbbbbbb__________
-________sbbbbbbbbbbbbbs_________
-________s_bbbbbbbbbbb_s_________
-__________bbbbbbbbbbb___________
-___________bbb___bbb____________
-___________bbb___bbb____________
-__________nbbb___bbbn___________
-__________nnnn___nnnn___________
-___________nn_____nn____________
-________________________________
-________________________________
-________________________________
-________________________________
-________________________________
-________________________________
-________________________________
-"""
-
-[sprite.coin]
-grid = 16
-framerate = 6
-
-[[sprite.coin.frame]]
-pixels = """
-_____yyyy_______
-___yyooooyyy____
-__yooyyyyyooy___
-__yoyyyyyyyyoy__
-__yoyyyy_yyyoy__
-__yoyyyyyyyyoy__
-__yoyyyyyyyyoy__
-__yoyyyyyyyyoy__
-___yooooooooy___
-____yyyyyyyy____
-________________
-________________
-________________
-________________
-________________
-________________
-"""
-
-[[sprite.coin.frame]]
-pixels = """
-______yy________
-_____yooy_______
-____yoyyoy______
-____yoy_oy______
-____yoyyoy______
-____yoyyoy______
-____yoyyoy______
-_____yooy_______
-______yy________
-________________
-________________
-________________
-________________
-________________
-________________
-________________
-"""
-
-[[sprite.coin.frame]]
-pixels = """
-_______y________
-______yoy_______
-______yoy_______
-______yoy_______
-______yoy_______
-______yoy_______
-______yoy_______
-_______y________
-________________
-________________
-________________
-________________
-________________
-________________
-________________
-________________
-"""
-
-[[sprite.coin.frame]]
-pixels = """
-______yy________
-_____yooy_______
-____yoyyoy______
-____yoy_oy______
-____yoyyoy______
-____yoyyoy______
-____yoyyoy______
-_____yooy_______
-______yy________
-________________
-________________
-________________
-________________
-________________
-________________
-________________
-"""
-
-[sprite.heart]
-grid = 16
-pixels = """
-________________
-___rr____rr_____
-__rrrr__rrrr____
-_rrrrrrrrrrrr___
-_rrrrrrrrrrrr___
-_rrrrrrrrrrrr___
-__rrrrrrrrrr____
-___rrrrrrrr_____
-____rrrrrr______
-_____rrrr_______
-______rr________
-________________
-________________
-________________
-________________
-________________
-"""
-`,
-		},
-		{
-			path: "assets/sprites/tiles.sprite",
-			content: `palette = "default"
-grid = 16
-
-[sprite.grass]
-pixels = """
-ccggccggccggccgg
-ggccggccggccggcc
-ccgcgcgcgcgcgccc
-gcccccggccccccgc
-ccchccccchccccch
-hchhhhhchhhhhchh
-hhhhhhhhhhhhhhhh
-hhehhhhhehhhhehh
-hhhhhhhhhhhhhhhh
-hhehhhhhhhehhhhh
-hhhhhhhhhhhhhhhh
-hhhhhhehhhhhhhhh
-hhehhhhhhhhhhehh
-hhhhhhhhhhhhhhhh
-hhhhhhehhhhhhhhh
-hhhhhhhhhhhhhhhh
-"""
-
-[sprite.dirt]
-pixels = """
-hhhhhhhhhhhhhhhh
-hhehhhhhehhhhehh
-hhhhhhhhhhhhhhhh
-hhhhhhehhhhhhhhh
-hhehhhhhhhehhhhh
-hhhhhhhhhhhhhhhh
-hhhhhhehhhhhhhhh
-hhhhhhhhhhhhhhhh
-hhehhhhhehhhhehh
-hhhhhhhhhhhhhhhh
-hhhhhhehhhhhhhhh
-hhehhhhhhhehhhhh
-hhhhhhhhhhhhhhhh
-hhhhhhehhhhhhhhh
-hhhhhhhhhhhhhhhh
-hhehhhhhehhhhehh
-"""
-
-[sprite.stone]
-pixels = """
-eeffffffeeffffff
-flllllfeflllllfe
-flllflfefllflffe
-flllllfeflllllfe
-eeffffffeeffffff
-feflllleefellllf
-fefllfleefelfllf
-feflllleefellllf
-eeffffffeeffffff
-flllllfeflllllfe
-flllflfefllflffe
-flllllfeflllllfe
-eeffffffeeffffff
-feflllleefellllf
-fefllfleefelfllf
-feflllleefellllf
-"""
-
-[sprite.sky]
-pixels = """
-bbbbbbbbbbbbbbbb
-bbbbbbbbbbbbbbbb
-bbbbbbbbbbbbbbbb
-bbbbbbbbbbbbbbbb
-bbbbbbbbbbbbbbbb
-bbbbbbbbbbbbbbbb
-bbbbbbbbbbbbbbbb
-bbbbbbbbbbbbbbbb
-bbbbbbbbbbbbbbbb
-bbbbbbbbbbbbbbbb
-bbbbbbbbbbbbbbbb
-bbbbbbbbbbbbbbbb
-bbbbbbbbbbbbbbbb
-bbbbbbbbbbbbbbbb
-bbbbbbbbbbbbbbbb
-bbbbbbbbbbbbbbbb
-"""
-`,
-		},
-		{
-			path: "assets/maps/level1.map",
-			content: `tile_size = 16
-
-[tileset]
-_ = ""
-g = "tiles:grass"
-d = "tiles:dirt"
-s = "tiles:stone"
-b = "tiles:sky"
-
-[layer.background]
-scroll_x = 0.5
-pixels = """
-bbbbbbbbbbbbbbbb
-bbbbbbbbbbbbbbbb
-bbbbbbbbbbbbbbbb
-bbbbbbbbbbbbbbbb
-bbbbbbbbbbbbbbbb
-bbbbbbbbbbbbbbbb
-bbbbbbbbbbbbbbbb
-bbbbbbbbbbbbbbbb
-bbbbbbbbbbbbbbbb
-bbbbbbbbbbbbbbbb
-"""
-
-[layer.main]
-pixels = """
-________________
-________________
-________________
-________________
-_______sss______
-________________
-__gg_______gg___
-__dd_______dd___
-gggggggggggggggg
-dddddddddddddddd
-"""
-
-[layer.entities]
-
-[[layer.entities.entity]]
-type = "spawn"
-x = 2
-y = 7
-[layer.entities.entity.properties]
-sprite = "player:idle"
-
-[[layer.entities.entity]]
-type = "coin"
-x = 4
-y = 5
-[layer.entities.entity.properties]
-sprite = "player:coin"
-
-[[layer.entities.entity]]
-type = "coin"
-x = 8
-y = 3
-[layer.entities.entity.properties]
-sprite = "player:coin"
-
-[[layer.entities.entity]]
-type = "coin"
-x = 11
-y = 5
-[layer.entities.entity.properties]
-sprite = "player:coin"
-
-[[layer.entities.entity]]
-type = "enemy"
-x = 13
-y = 7
-[layer.entities.entity.properties]
-sprite = "player:heart"
-`,
-		},
-		{
-			path: "assets/instruments/lead.inst",
-			content: `name = "lead"
-
-[oscillator]
-waveform = "square"
-duty_cycle = 0.5
-
-[envelope]
-attack = 0.01
-decay = 0.1
-sustain = 0.6
-release = 0.2
-
-[filter]
-type = "lowpass"
-cutoff = 2000
-resonance = 0.2
-`,
-		},
-		{
-			path: "assets/instruments/bass.inst",
-			content: `name = "bass"
-
-[oscillator]
-waveform = "triangle"
-
-[envelope]
-attack = 0.005
-decay = 0.15
-sustain = 0.5
-release = 0.1
-`,
-		},
-		{
-			path: "assets/sfx/jump.sfx",
-			content: `duration = 0.2
-volume = 0.7
-
-[[voice]]
-waveform = "square"
-duty_cycle = 0.5
-
-[voice.envelope]
-attack = 0.0
-decay = 0.08
-sustain = 0.2
-release = 0.12
-
-[voice.pitch]
-start = 220
-end = 660
-curve = "exponential"
-`,
-		},
-		{
-			path: "assets/sfx/coin.sfx",
-			content: `duration = 0.12
-volume = 0.6
-
-[[voice]]
-waveform = "square"
-duty_cycle = 0.25
-
-[voice.envelope]
-attack = 0.0
-decay = 0.03
-sustain = 0.4
-release = 0.09
-
-[voice.pitch]
-start = 880
-end = 1320
-curve = "linear"
-`,
-		},
-		{
-			path: "assets/tracks/demo.track",
-			content: `tempo = 140
-ticks_per_beat = 4
-loop = true
-loop_start = 0
-
-[[channel]]
-name = "melody"
-instrument = "lead"
-volume = 0.7
-
-[[channel]]
-name = "bass"
-instrument = "bass"
-volume = 0.6
-
-[pattern.intro]
-ticks = 16
-data = """
-melody  | bass
-C4      | C2
----     | ---
-E4      | ---
----     | ---
-G4      | G2
----     | ---
-E4      | ---
----     | ---
-A4      | A2
----     | ---
-G4      | ---
----     | ---
-E4      | E2
----     | ---
-D4      | ---
----     | ---
-"""
-
-[pattern.verse]
-ticks = 16
-data = """
-melody  | bass
-E4      | A2
----     | ---
-D4      | ---
----     | ---
-C4      | F2
----     | ---
-D4      | ---
----     | ---
-E4      | G2
----     | ---
-E4      | ---
----     | ---
-E4      | C2
----     | ---
-^^^     | ---
-...     | ^^^
-"""
-
-[song]
-sequence = ["intro", "verse", "intro", "verse"]
-`,
-		},
-	}
-}
-
 // setupMCPConfig merges runefact MCP server config into .mcp.json and
 // .claude/settings.local.json without clobbering existing entries.
 // Returns the list of files that were written.
@@ -725,3 +234,77 @@ func setupMCPConfig(wd string) []string {
 
 	return written
 }
+
+// gitignoreEntries are the files a build leaves in the project besides its
+// output: the build record, the incremental cache and the temp files of
+// an interrupted write.
+var gitignoreEntries = []string{
+	"/.runefact/",
+	"/.runefact-cache.json",
+	".*.runefact-tmp-*",
+}
+
+// setupGitignore adds the output directory and gitignoreEntries to
+// .gitignore, keeping what is already there. An output directory outside
+// the project is left out. Returns the list of files that were written.
+func setupGitignore(wd, output string) []string {
+	entries := slices.Clone(gitignoreEntries)
+	if out := filepath.ToSlash(filepath.Clean(output)); output != "" && !filepath.IsAbs(output) &&
+		out != "." && out != ".." && !strings.HasPrefix(out, "../") {
+		entries = append([]string{"/" + out + "/"}, entries...)
+	}
+
+	path := filepath.Join(wd, ".gitignore")
+	existing, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil
+	}
+	// "build", "/build" and "build/" all cover a build directory.
+	have := map[string]bool{}
+	for _, line := range strings.Split(string(existing), "\n") {
+		have[strings.Trim(strings.TrimSpace(line), "/")] = true
+	}
+	var missing []string
+	for _, e := range entries {
+		if !have[strings.Trim(e, "/")] {
+			missing = append(missing, e)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	var b bytes.Buffer
+	b.Write(existing)
+	if len(existing) > 0 {
+		if !bytes.HasSuffix(existing, []byte("\n")) {
+			b.WriteByte('\n')
+		}
+		b.WriteByte('\n')
+	}
+	b.WriteString("# Runefact build output and caches\n")
+	for _, e := range missing {
+		b.WriteString(e + "\n")
+	}
+	if err := os.WriteFile(path, b.Bytes(), 0644); err != nil {
+		return nil
+	}
+	return []string{".gitignore"}
+}
+
+// gitInit runs git init in wd and reports whether it created a repository.
+// A directory already inside a work tree is left alone, and a missing git
+// is an error for the caller to warn about.
+func gitInit(wd string) (bool, error) {
+	git, err := exec.LookPath("git")
+	if err != nil {
+		return false, fmt.Errorf("git not found, skipping git init")
+	}
+	if exec.Command(git, "-C", wd, "rev-parse", "--is-inside-work-tree").Run() == nil {
+		return false, nil
+	}
+	if out, err := exec.Command(git, "init", "-q", wd).CombinedOutput(); err != nil {
+		return false, fmt.Errorf("git init: %v: %s", err, bytes.TrimSpace(out))
+	}
+	return true, nil
+}
@@ -3,51 +3,13 @@ package main
 import (
 	"encoding/json"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"slices"
+	"strings"
 	"testing"
 )
 
-func TestScaffoldFiles(t *testing.T) {
-	files := scaffoldFiles("test-game")
-	if len(files) == 0 {
-		t.Fatal("scaffoldFiles returned no files")
-	}
-
-	// Check runefact.toml is first and contains project name.
-	if files[0].path != "runefact.toml" {
-		t.Errorf("first file = %q, want runefact.toml", files[0].path)
-	}
-	if got := files[0].content; len(got) == 0 {
-		t.Error("runefact.toml is empty")
-	}
-
-	// Verify all expected paths are present.
-	want := map[string]bool{
-		"runefact.toml":                   false,
-		"assets/palettes/default.palette": false,
-		"assets/sprites/player.sprite":    false,
-		"assets/sprites/tiles.sprite":     false,
-		"assets/maps/level1.map":          false,
-		"assets/instruments/lead.inst":    false,
-		"assets/instruments/bass.inst":    false,
-		"assets/sfx/jump.sfx":             false,
-		"assets/sfx/coin.sfx":             false,
-		"assets/tracks/demo.track":        false,
-	}
-	for _, f := range files {
-		if _, ok := want[f.path]; !ok {
-			t.Errorf("unexpected file: %s", f.path)
-		}
-		want[f.path] = true
-	}
-	for path, found := range want {
-		if !found {
-			t.Errorf("missing file: %s", path)
-		}
-	}
-}
-
 func TestRunInit_CreatesFiles(t *testing.T) {
 	dir := t.TempDir()
 	origDir, _ := os.Getwd()
@@ -58,6 +20,7 @@ func TestRunInit_CreatesFiles(t *testing.T) {
 
 	flagInitName = "test-project"
 	flagInitForce = false
+	flagInitTemplate = "platformer"
 	flagQuiet = true
 
 	if err := runInit(nil, nil); err != nil {
@@ -79,7 +42,7 @@ func TestRunInit_CreatesFiles(t *testing.T) {
 		".mcp.json",
 		".claude/settings.local.json",
 	} {
-		// MCP config files are created by setupMCPConfig, not scaffoldFiles.
+		// MCP config files are created by setupMCPConfig, not the template.
 		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
 			t.Errorf("expected file %s to exist: %v", name, err)
 		}
@@ -104,6 +67,112 @@ func TestRunInit_CreatesFiles(t *testing.T) {
 	}
 }
 
+func TestRunInit_Template(t *testing.T) {
+	dir := t.TempDir()
+	origDir, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(origDir)
+
+	flagInitName = "test-project"
+	flagInitForce = false
+	flagInitTemplate = "minimal"
+	flagQuiet = true
+
+	if err := runInit(nil, nil); err != nil {
+		t.Fatalf("runInit: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "assets/sprites/hero.sprite")); err != nil {
+		t.Errorf("minimal template sprite missing: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "assets/sprites/player.sprite")); err == nil {
+		t.Error("minimal template wrote the platformer sprites")
+	}
+	// Every template gets the full directory layout.
+	if _, err := os.Stat(filepath.Join(dir, "assets/tracks")); err != nil {
+		t.Errorf("tracks dir missing: %v", err)
+	}
+}
+
+func TestRunInit_UnknownTemplate(t *testing.T) {
+	dir := t.TempDir()
+	origDir, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(origDir)
+
+	flagInitForce = false
+	flagInitTemplate = "shmup"
+	defer func() { flagInitTemplate = "platformer" }()
+
+	if err := runInit(nil, nil); err == nil {
+		t.Fatal("expected error for an unknown template")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "runefact.toml")); err == nil {
+		t.Error("runefact.toml written despite the unknown template")
+	}
+}
+
+func TestRunInit_NoMCP(t *testing.T) {
+	dir := t.TempDir()
+	origDir, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(origDir)
+
+	flagInitName = "test-project"
+	flagInitForce = false
+	flagInitTemplate = "none"
+	flagInitNoMCP = true
+	flagQuiet = true
+	defer func() { flagInitTemplate, flagInitNoMCP = "platformer", false }()
+
+	if err := runInit(nil, nil); err != nil {
+		t.Fatalf("runInit: %v", err)
+	}
+	for _, name := range []string{".mcp.json", ".claude"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			t.Errorf("%s written despite --no-mcp", name)
+		}
+	}
+}
+
+func TestRunInit_Git(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	origDir, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(origDir)
+
+	flagInitName = "test-project"
+	flagInitForce = false
+	flagInitTemplate = "none"
+	flagInitGit = true
+	flagQuiet = true
+	defer func() { flagInitTemplate, flagInitGit = "platformer", false }()
+
+	if err := runInit(nil, nil); err != nil {
+		t.Fatalf("runInit: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+		t.Errorf("git init did not run: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "/build/assets/\n") {
+		t.Errorf(".gitignore does not cover the output dir:\n%s", data)
+	}
+}
+
 func TestRunInit_ErrorsWithoutForce(t *testing.T) {
 	dir := t.TempDir()
 	origDir, _ := os.Getwd()
@@ -139,6 +208,7 @@ func TestRunInit_ForceOverwrites(t *testing.T) {
 
 	flagInitName = "overwrite-test"
 	flagInitForce = true
+	flagInitTemplate = "platformer"
 	flagQuiet = true
 
 	if err := runInit(nil, nil); err != nil {
@@ -260,3 +330,42 @@ func TestSetupMCPConfig_SkipsExistingRunefact(t *testing.T) {
 		t.Errorf("runefact command was clobbered: got %q, want %q", cmd, "custom-path")
 	}
 }
+
+func TestSetupGitignore_MergesExisting(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".gitignore")
+	if err := os.WriteFile(path, []byte("*.log\n/.runefact\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if written := setupGitignore(dir, "build/assets"); len(written) != 1 {
+		t.Fatalf("written = %v, want .gitignore", written)
+	}
+	data, _ := os.ReadFile(path)
+	got := string(data)
+	if !strings.HasPrefix(got, "*.log\n/.runefact\n") {
+		t.Errorf("existing entries were clobbered:\n%s", got)
+	}
+	for _, want := range []string{"/build/assets/", "/.runefact-cache.json", ".*.runefact-tmp-*"} {
+		if !strings.Contains(got, want+"\n") {
+			t.Errorf(".gitignore missing %s:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "/.runefact/") {
+		t.Errorf("/.runefact was already ignored but added again:\n%s", got)
+	}
+
+	// A second run has nothing to add.
+	if written := setupGitignore(dir, "build/assets"); len(written) != 0 {
+		t.Errorf("second run wrote %v", written)
+	}
+}
+
+func TestSetupGitignore_OutputOutsideProject(t *testing.T) {
+	dir := t.TempDir()
+	setupGitignore(dir, "../shared/assets")
+	data, _ := os.ReadFile(filepath.Join(dir, ".gitignore"))
+	if strings.Contains(string(data), "shared") {
+		t.Errorf("output outside the project was ignored:\n%s", data)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/spf13/cobra"
+	"github.com/vgalaktionov/runefact/internal/inspect"
+	"github.com/vgalaktionov/runefact/internal/instrument"
+)
+
+var (
+	flagInspectJSON    bool
+	flagInspectPattern string
+)
+
+var inspectCmd = &cobra.Command{
+	Use:   "inspect <file>",
+	Short: "Summarize a rune file",
+	Long: `Inspect prints what a rune file defines without building it: sprites with
+their sizes and frames, map layers, sfx voices, or a track's tempo, patterns
+and estimated length. With --json it prints the same JSON as the MCP
+inspect tools. --pattern renders one pattern of a track on its own and
+reports its length and peak level.
+
+Examples:
+  runefact inspect player.sprite
+  runefact inspect level1.map --json
+  runefact inspect assets/tracks/theme.track
+  runefact inspect theme.track --pattern verse`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeRuneFiles(true, slices.Collect(maps.Keys(inspect.Dirs))...),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root, cfg, err := loadProjectConfig()
+		if err != nil {
+			return err
+		}
+
+		file := args[0]
+		path := file
+		if _, err := os.Stat(path); err != nil && !filepath.IsAbs(path) {
+			if dir, ok := inspect.Dirs[filepath.Ext(file)]; ok {
+				path = filepath.Join(root, "assets", dir, file)
+			}
+		}
+
+		var r inspect.Report
+		if flagInspectPattern != "" {
+			if filepath.Ext(file) != ".track" {
+				return fmt.Errorf("--pattern only applies to .track files")
+			}
+			instruments := instrument.LoadDir(filepath.Join(root, "assets", "instruments"))
+			r, err = inspect.Pattern(cmd.Context(), path, file, flagInspectPattern, instruments, cfg.Defaults.SampleRate)
+		} else {
+			r, err = inspect.File(path, file)
+		}
+		if err != nil {
+			return err
+		}
+
+		if flagInspectJSON {
+			enc := json.NewEncoder(cmd.OutOrStdout())
+			enc.SetIndent("", "  ")
+			return enc.Encode(r)
+		}
+		r.WriteText(cmd.OutOrStdout())
+		return nil
+	},
+}
+
+func init() {
+	inspectCmd.Flags().BoolVar(&flagInspectJSON, "json", false, "print JSON instead of a summary")
+	inspectCmd.Flags().StringVar(&flagInspectPattern, "pattern", "", "render one pattern of a .track alone and report on it")
+}
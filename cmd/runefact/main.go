@@ -11,6 +11,6 @@ var version = "dev"
 func main() {
 	if err := Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitCode(err))
 	}
 }
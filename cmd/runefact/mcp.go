@@ -5,6 +5,8 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var flagMCPReadOnly bool
+
 var mcpCmd = &cobra.Command{
 	Use:   "mcp",
 	Short: "Start MCP server for AI agent integration",
@@ -16,6 +18,10 @@ and other MCP-capable AI agents.`,
 		if err != nil {
 			return err
 		}
-		return mcpserver.StartMCPServer(root, cfg)
+		return mcpserver.StartMCPServer(root, cfg, flagMCPReadOnly)
 	},
 }
+
+func init() {
+	mcpCmd.Flags().BoolVar(&flagMCPReadOnly, "read-only", false, "disable tools that write files (build, new_asset)")
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/vgalaktionov/runefact/internal/scaffold"
+)
+
+var (
+	flagNewGrid     int
+	flagNewPalette  string
+	flagNewChannels int
+	flagNewDuration float64
+)
+
+var newCmd = &cobra.Command{
+	Use:   "new <type> <name>",
+	Short: "Create an asset file from a template",
+	Long: `New writes a minimal, valid asset file into its directory under assets/,
+ready to edit. It never overwrites an existing file. The MCP tool
+runefact_new_asset writes the same templates.
+
+Types: ` + strings.Join(scaffold.AssetTypes, ", ") + `
+
+--grid sets a sprite's size and a map's tile size, and defaults to
+defaults.sprite_size. A track's channels play the first instrument of
+the project, or "lead" if it has none.
+
+Examples:
+  runefact new sprite hero --grid 8   # assets/sprites/hero.sprite
+  runefact new track theme --channels 3
+  runefact new sfx blip --duration 0.5`,
+	Args:              cobra.ExactArgs(2),
+	ValidArgsFunction: completeNewArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root, cfg, err := loadProjectConfig()
+		if err != nil {
+			return err
+		}
+
+		typ := args[0]
+		kind, ok := scaffold.AssetKinds[typ]
+		if !ok {
+			return fmt.Errorf("unknown asset type %q; use one of %s", typ, strings.Join(scaffold.AssetTypes, ", "))
+		}
+		name := strings.TrimSuffix(args[1], kind.Ext)
+
+		params := scaffold.AssetParams{
+			Grid:     flagNewGrid,
+			Palette:  flagNewPalette,
+			Channels: flagNewChannels,
+			Duration: flagNewDuration,
+		}
+		if !cmd.Flags().Changed("grid") {
+			params.Grid = cfg.Defaults.SpriteSize
+		}
+		if err := scaffold.CheckAsset(name, params); err != nil {
+			return err
+		}
+		if typ == "track" {
+			params.Instrument = scaffold.FirstInstrument(filepath.Join(root, "assets", "instruments"))
+		}
+
+		path := filepath.Join(root, "assets", kind.Dir, name+kind.Ext)
+		err = scaffold.WriteAsset(path, scaffold.Asset(typ, name, params))
+		if errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("%s already exists; refusing to overwrite", relPath(root, path))
+		}
+		if err != nil {
+			return err
+		}
+		if !flagQuiet {
+			fmt.Fprintf(cmd.OutOrStdout(), "created %s\n", relPath(root, path))
+		}
+		return nil
+	},
+}
+
+func init() {
+	newCmd.Flags().IntVar(&flagNewGrid, "grid", 0, "sprite size or map tile size in pixels (default: defaults.sprite_size)")
+	newCmd.Flags().StringVar(&flagNewPalette, "palette", "default", "palette a new sprite uses")
+	newCmd.Flags().IntVar(&flagNewChannels, "channels", 1, "channels of a new track")
+	newCmd.Flags().Float64Var(&flagNewDuration, "duration", 0.2, "length of a new sfx in seconds")
+}
+
+// completeNewArgs offers the asset types for the first argument of new;
+// the name is the user's to choose.
+func completeNewArgs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return scaffold.AssetTypes, cobra.ShellCompDirectiveNoFileComp
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	chdirProject(t, "", nil)
+	for _, args := range [][]string{
+		{"new", "-q", "palette", "extra"},
+		{"new", "-q", "map", "cave"},
+		{"new", "-q", "instrument", "synth"},
+		{"new", "-q", "sfx", "zap", "--duration", "0.5"},
+		{"new", "-q", "track", "theme.track", "--channels", "3"},
+		{"new", "-q", "sprite", "knight", "--grid", "8"},
+	} {
+		if got, logged := runCLI(t, args...); got != exitOK {
+			t.Fatalf("runefact %v exited with %d: %s", args, got, logged)
+		}
+	}
+	track, err := os.ReadFile("assets/tracks/theme.track")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(track), `instrument = "synth"`); n != 3 {
+		t.Errorf("track has %d channels playing synth, want 3:\n%s", n, track)
+	}
+	if got, logged := runCLI(t, "validate", "-q"); got != exitOK {
+		t.Errorf("project invalid after creating assets: %s", logged)
+	}
+
+	// The template's hero sprite is left alone.
+	before, _ := os.ReadFile("assets/sprites/hero.sprite")
+	for _, args := range [][]string{
+		{"new", "-q", "sprite", "hero"},
+		{"new", "-q", "sprite", "../escape"},
+		{"new", "-q", "font", "pixel"},
+	} {
+		if got, _ := runCLI(t, args...); got != exitInternal {
+			t.Errorf("runefact %v exited with %d, want %d", args, got, exitInternal)
+		}
+	}
+	if after, _ := os.ReadFile("assets/sprites/hero.sprite"); string(after) != string(before) {
+		t.Error("new overwrote an existing file")
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/vgalaktionov/runefact/internal/build"
+)
+
+var (
+	flagRecolorFrom   string
+	flagRecolorKey    string
+	flagRecolorTo     string
+	flagRecolorDryRun bool
+	flagDedupeDryRun  bool
+)
+
+var paletteCmd = &cobra.Command{
+	Use:   "palette",
+	Short: "Palette tools",
+}
+
+var paletteRecolorCmd = &cobra.Command{
+	Use:   "recolor",
+	Short: "Replace a color across the whole project",
+	Long: `Recolor replaces a color in every .palette file and every sprite's
+palette_extend table. With --from, every value equal to that color is
+replaced, however it is written (#fff matches #ffffff). With --key, the
+key's value is replaced in every palette that defines it.
+
+Every affected sprite is checked against the new colors before anything
+is written. If one would break, nothing is written. Each modified file is
+printed; --dry-run prints them without writing.
+
+Examples:
+  runefact palette recolor --from "#7e2553" --to "#6a1f46"
+  runefact palette recolor --key p --to "#6a1f46" --dry-run`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root, _, err := loadProjectConfig()
+		if err != nil {
+			return err
+		}
+
+		changes, err := build.PlanRecolor(root, build.RecolorOptions{
+			From: flagRecolorFrom,
+			Key:  flagRecolorKey,
+			To:   flagRecolorTo,
+		})
+		if err != nil {
+			return err
+		}
+		if len(changes) == 0 {
+			return fmt.Errorf("no matching colors found")
+		}
+
+		for _, c := range changes {
+			fmt.Fprintf(cmd.OutOrStdout(), "%s: %d color(s)\n", relPath(root, c.Path), c.Count)
+		}
+		if flagRecolorDryRun {
+			return nil
+		}
+		return build.WriteChanges(changes)
+	},
+}
+
+var paletteDedupeCmd = &cobra.Command{
+	Use:   "dedupe",
+	Short: "Merge palette keys that have the same color",
+	Long: `Dedupe finds keys with the same color in each .palette file, and in
+each sprite file's palette_extend together with its palette. Of each group
+it keeps "_", else the key drawn with the most pixels, else the shortest.
+Pixel grids drawn with the other keys switch to it, and the other keys are
+removed.
+
+Every sprite is rendered before and after. If one would look different or
+break, nothing is written. Each group and modified file is printed;
+--dry-run prints them without writing.
+
+Examples:
+  runefact palette dedupe --dry-run
+  runefact palette dedupe`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root, _, err := loadProjectConfig()
+		if err != nil {
+			return err
+		}
+
+		groups, changes, err := build.PlanDedupe(root)
+		if err != nil {
+			return err
+		}
+		if len(groups) == 0 {
+			fmt.Fprintln(cmd.OutOrStdout(), "no duplicate colors")
+			return nil
+		}
+
+		out := cmd.OutOrStdout()
+		for _, g := range groups {
+			fmt.Fprintf(out, "%s: %s\n", relPath(root, g.File), g)
+		}
+		for _, c := range changes {
+			fmt.Fprintf(out, "%s: %d change(s)\n", relPath(root, c.Path), c.Count)
+		}
+		if flagDedupeDryRun {
+			return nil
+		}
+		return build.WriteChanges(changes)
+	},
+}
+
+func init() {
+	paletteRecolorCmd.Flags().StringVar(&flagRecolorFrom, "from", "", "color to replace wherever it appears")
+	paletteRecolorCmd.Flags().StringVar(&flagRecolorKey, "key", "", "palette key whose color to replace")
+	paletteRecolorCmd.Flags().StringVar(&flagRecolorTo, "to", "", "new color")
+	paletteRecolorCmd.Flags().BoolVar(&flagRecolorDryRun, "dry-run", false, "list the files that would change without writing them")
+	paletteRecolorCmd.MarkFlagRequired("to")
+	paletteRecolorCmd.MarkFlagsMutuallyExclusive("from", "key")
+	paletteCmd.AddCommand(paletteRecolorCmd)
+
+	paletteDedupeCmd.Flags().BoolVar(&flagDedupeDryRun, "dry-run", false, "list the duplicates and the files that would change without writing them")
+	paletteCmd.AddCommand(paletteDedupeCmd)
+}
@@ -4,11 +4,21 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 
+	"github.com/vgalaktionov/runefact/internal/palette"
 	"github.com/vgalaktionov/runefact/internal/preview"
+	"github.com/vgalaktionov/runefact/internal/sprite"
 	"github.com/spf13/cobra"
 )
 
+var (
+	flagPreviewSprite string
+	flagPreviewFrame  int
+	flagPreviewPaused bool
+)
+
 var previewCmd = &cobra.Command{
 	Use:   "preview [file]",
 	Short: "Open live-reloading asset previewer",
@@ -18,7 +28,9 @@ Examples:
   runefact preview player.sprite    # preview sprite file
   runefact preview world.map        # preview map file
   runefact preview laser.sfx        # preview sound effect
-  runefact preview bgm.track        # preview music track`,
+  runefact preview bgm.track        # preview music track
+  runefact preview player.sprite --sprite coin --frame 2 --paused`,
+	ValidArgsFunction: completeRuneFiles(true, ".sprite", ".map", ".sfx", ".track"),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		root, cfg, err := loadProjectConfig()
 		if err != nil {
@@ -62,14 +74,91 @@ Examples:
 			}
 		}
 
+		if err := checkSpriteSelection(fullPath, flagPreviewSprite, flagPreviewFrame, flagPreviewPaused); err != nil {
+			return err
+		}
+
 		assetsDir := filepath.Join(root, "assets")
-		p := preview.NewPreviewer(
-			fullPath,
-			assetsDir,
-			cfg.Preview.WindowWidth,
-			cfg.Preview.WindowHeight,
-			cfg.Defaults.SampleRate,
-		)
+		background, err := previewBackground(cfg.Preview.Background, cfg.AssetsDirs(root))
+		if err != nil {
+			return fmt.Errorf("[preview] background: %w", err)
+		}
+		p := preview.NewPreviewer(fullPath, assetsDir, preview.Options{
+			WindowWidth:  cfg.Preview.WindowWidth,
+			WindowHeight: cfg.Preview.WindowHeight,
+			SampleRate:   cfg.Defaults.SampleRate,
+			PixelScale:   cfg.Preview.PixelScale,
+			ColorKey:     cfg.Project.ColorKey(),
+			Background:   background,
+		})
+		p.SetRestartOnReload(cfg.Preview.RestartOnReload)
+		p.SetAllowOversizedTiles(cfg.Lint.AllowOversizedTiles)
+		keys, err := preview.NewKeymap(cfg.Preview.Keys)
+		if err != nil {
+			return err
+		}
+		p.SetKeymap(keys)
+		if flagPreviewSprite != "" {
+			p.SetStartSprite(flagPreviewSprite, flagPreviewFrame, flagPreviewPaused)
+		}
 		return p.Run()
 	},
 }
+
+func init() {
+	previewCmd.Flags().StringVar(&flagPreviewSprite, "sprite", "", "open the isolated view of this sprite")
+	previewCmd.Flags().IntVar(&flagPreviewFrame, "frame", 0, "start on this frame (requires --sprite)")
+	previewCmd.Flags().BoolVar(&flagPreviewPaused, "paused", false, "start with animation paused (requires --sprite)")
+}
+
+// checkSpriteSelection verifies --sprite, --frame and --paused against the
+// sprite file. If the file doesn't parse, the check is skipped and the
+// previewer shows the error instead.
+func checkSpriteSelection(path, name string, frame int, paused bool) error {
+	if name == "" {
+		if frame != 0 {
+			return fmt.Errorf("--frame requires --sprite")
+		}
+		if paused {
+			return fmt.Errorf("--paused requires --sprite")
+		}
+		return nil
+	}
+	if filepath.Ext(path) != ".sprite" {
+		return fmt.Errorf("--sprite only applies to .sprite files")
+	}
+
+	sf, err := sprite.LoadSpriteFile(path)
+	if err != nil {
+		return nil
+	}
+
+	names := make([]string, 0, len(sf.Sprites))
+	for _, s := range sf.Sprites {
+		if s.Name == name {
+			if frame < 0 || frame >= len(s.Frames) {
+				return fmt.Errorf("sprite %q has %d frame(s); --frame must be 0-%d", name, len(s.Frames), len(s.Frames)-1)
+			}
+			return nil
+		}
+		names = append(names, s.Name)
+	}
+	sort.Strings(names)
+	return fmt.Errorf("unknown sprite %q in %s; available: %s", name, filepath.Base(path), strings.Join(names, ", "))
+}
+
+// previewBackground resolves [preview] background, a hex color or a name
+// from the project's palettes, tried in file name order. Palettes that
+// don't parse are skipped; validate reports them.
+func previewBackground(name string, assetsDirs []string) (palette.Color, error) {
+	var palettes []*palette.Palette
+	for _, dir := range assetsDirs {
+		files, _ := filepath.Glob(filepath.Join(dir, "palettes", "*.palette"))
+		for _, f := range files {
+			if pal, err := palette.LoadPalette(f); err == nil {
+				palettes = append(palettes, pal)
+			}
+		}
+	}
+	return palette.LookupAny(name, palettes)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckSpriteSelection(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "player.sprite")
+	content := `palette = "default"
+grid = 1
+
+[sprite.idle]
+pixels = "_"
+
+[sprite.coin]
+framerate = 4
+
+[[sprite.coin.frame]]
+pixels = "_"
+
+[[sprite.coin.frame]]
+pixels = "_"
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		sprite  string
+		frame   int
+		paused  bool
+		wantErr string
+	}{
+		{"no selection", "", 0, false, ""},
+		{"frame without sprite", "", 1, false, "--frame requires --sprite"},
+		{"paused without sprite", "", 0, true, "--paused requires --sprite"},
+		{"known sprite", "coin", 1, true, ""},
+		{"frame out of range", "coin", 2, false, "has 2 frame(s)"},
+		{"unknown sprite lists names", "hero", 0, false, "available: coin, idle"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkSpriteSelection(path, tt.sprite, tt.frame, tt.paused)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/vgalaktionov/runefact/internal/atomicfile"
+	"github.com/vgalaktionov/runefact/internal/export"
+	"github.com/vgalaktionov/runefact/internal/sprite"
+	"github.com/vgalaktionov/runefact/internal/tilemap"
+)
+
+var (
+	flagRenderOutput  string
+	flagRenderScale   int
+	flagRenderRegion  string
+	flagRenderLayer   string
+	flagRenderSprite  string
+	flagRenderAnimate bool
+	flagRenderSeconds float64
+	flagRenderFPS     int
+)
+
+// Captures are held in memory until they are encoded, so their size is
+// capped; ones longer than longCapture seconds get a warning.
+const (
+	maxCaptureFPS    = 60
+	maxCapturePixels = 64 << 20
+	longCapture      = 10
+)
+
+var renderCmd = &cobra.Command{
+	Use:   "render <file>",
+	Short: "Render a map or sprite to an image without opening a window",
+	Long: `Render draws a map the way the MCP preview does, or the sprites of a sprite
+file side by side, and writes a PNG. --region draws part of a map, given in
+tiles as x,y,w,h, and --layer draws one layer alone in its place on the
+map, with the rest left transparent.
+
+--animate records --seconds of animation at --fps instead: sprites play
+their frames, and maps their animated tiles and entity sprites, stepped
+the way the previewer steps them. The capture is an APNG, or a GIF if the
+output file ends in .gif.
+
+Examples:
+  runefact render level1.map -o level1.png
+  runefact render level1.map --layer main -o main.png
+  runefact render level1.map --region 0,0,40,22 --scale 4
+  runefact render player.sprite --animate --seconds 3 --fps 30 -o out.apng
+  runefact render level1.map --animate --seconds 5 -o devlog.gif`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeRuneFiles(true, ".map", ".sprite"),
+	RunE:              runRender,
+}
+
+func init() {
+	renderCmd.Flags().StringVarP(&flagRenderOutput, "output", "o", "", "output file (default: the file's name, plus _<layer>, with .png or .apng)")
+	renderCmd.Flags().IntVar(&flagRenderScale, "scale", 1, "integer upscale factor")
+	renderCmd.Flags().StringVar(&flagRenderRegion, "region", "", "part of the map to draw, in tiles, as x,y,w,h")
+	renderCmd.Flags().StringVar(&flagRenderLayer, "layer", "", "draw only this map layer")
+	renderCmd.Flags().StringVar(&flagRenderSprite, "sprite", "", "draw only this sprite of a sprite file")
+	renderCmd.Flags().BoolVar(&flagRenderAnimate, "animate", false, "record the animation to an APNG or GIF")
+	renderCmd.Flags().Float64Var(&flagRenderSeconds, "seconds", 2, "length of an --animate capture")
+	renderCmd.Flags().IntVar(&flagRenderFPS, "fps", 30, fmt.Sprintf("frames per second of an --animate capture (max %d)", maxCaptureFPS))
+}
+
+func runRender(cmd *cobra.Command, args []string) error {
+	root, cfg, err := loadProjectConfig()
+	if err != nil {
+		return err
+	}
+	if flagRenderScale < 1 {
+		return fmt.Errorf("--scale must be at least 1, got %d", flagRenderScale)
+	}
+
+	// draw draws frame n of a capture at --fps; a still image is frame 0.
+	var draw func(n int) (*image.RGBA, error)
+	file := args[0]
+	name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	switch filepath.Ext(file) {
+	case ".map":
+		if flagRenderSprite != "" {
+			return fmt.Errorf("--sprite only applies to .sprite files")
+		}
+		if draw, err = mapDrawer(root, cfg.AssetsDirs(root), file); err != nil {
+			return err
+		}
+		if flagRenderLayer != "" {
+			name += "_" + flagRenderLayer
+		}
+	case ".sprite":
+		if flagRenderRegion != "" || flagRenderLayer != "" {
+			return fmt.Errorf("--region and --layer only apply to .map files")
+		}
+		if draw, err = spriteDrawer(root, file); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("render takes a .map or .sprite file, got %s", file)
+	}
+
+	frames := 1
+	if flagRenderAnimate {
+		if frames, err = captureFrames(); err != nil {
+			return err
+		}
+	}
+	var images []*image.RGBA
+	for n := range frames {
+		img, err := draw(n)
+		if err != nil {
+			return err
+		}
+		if flagRenderScale > 1 {
+			img = sprite.ScaleImage(img, flagRenderScale)
+		}
+		if b := img.Bounds(); n == 0 && frames*b.Dx()*b.Dy() > maxCapturePixels {
+			return fmt.Errorf("%d frames of %dx%d pixels is over the limit of %d pixels in all; lower --seconds, --fps or --scale, or pass --region",
+				frames, b.Dx(), b.Dy(), maxCapturePixels)
+		}
+		images = append(images, img)
+	}
+
+	out := flagRenderOutput
+	if flagRenderAnimate {
+		if out == "" {
+			out = name + ".apng"
+		}
+		encode := export.WriteAPNG
+		if strings.EqualFold(filepath.Ext(out), ".gif") {
+			encode = export.WriteGIF
+		}
+		if err := atomicfile.Write(out, 0644, func(w io.Writer) error { return encode(w, images, flagRenderFPS) }); err != nil {
+			return fmt.Errorf("writing %s: %w", out, err)
+		}
+	} else {
+		if out == "" {
+			out = name + ".png"
+		}
+		if err := sprite.WritePNG(images[0], out); err != nil {
+			return err
+		}
+	}
+
+	if !flagQuiet {
+		b := images[0].Bounds()
+		if flagRenderAnimate {
+			fmt.Printf("Rendered %s (%dx%d, %d frames)\n", out, b.Dx(), b.Dy(), len(images))
+		} else {
+			fmt.Printf("Rendered %s (%dx%d)\n", out, b.Dx(), b.Dy())
+		}
+	}
+	return nil
+}
+
+// captureFrames checks --seconds and --fps and returns how many frames
+// the capture has.
+func captureFrames() (int, error) {
+	if flagRenderFPS < 1 || flagRenderFPS > maxCaptureFPS {
+		return 0, fmt.Errorf("--fps must be between 1 and %d, got %d", maxCaptureFPS, flagRenderFPS)
+	}
+	if !(flagRenderSeconds > 0) || math.IsInf(flagRenderSeconds, 0) {
+		return 0, fmt.Errorf("--seconds must be positive, got %g", flagRenderSeconds)
+	}
+	frames := int(math.Ceil(flagRenderSeconds * float64(flagRenderFPS)))
+	if flagRenderSeconds > longCapture {
+		slog.Warn(fmt.Sprintf("recording %gs of animation, %d frames; long captures make large files", flagRenderSeconds, frames))
+	}
+	return frames, nil
+}
+
+// mapDrawer loads a map for runRender, applying --region and --layer.
+func mapDrawer(root string, assetsDirs []string, file string) (func(n int) (*image.RGBA, error), error) {
+	path := file
+	if _, err := os.Stat(path); err != nil && !filepath.IsAbs(path) {
+		path = filepath.Join(root, "assets", "maps", file)
+	}
+	mf, _, err := tilemap.LoadMapFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	w, h := mf.Size()
+	if w == 0 || h == 0 {
+		return nil, fmt.Errorf("%s has no tile data", file)
+	}
+	region := image.Rect(0, 0, w, h)
+	if flagRenderRegion != "" {
+		if region, err = parseRenderRegion(flagRenderRegion, w, h); err != nil {
+			return nil, err
+		}
+	}
+	if flagRenderLayer != "" {
+		if mf, err = mf.OnlyLayer(flagRenderLayer); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+
+	// Sprites are resolved once and shared by every frame.
+	load := sprite.DirPartLoader(assetsDirs...)
+	resolved := map[string]*sprite.ResolvedSprite{}
+	sprites := func(ref string) *sprite.ResolvedSprite {
+		if rs, ok := resolved[ref]; ok {
+			return rs
+		}
+		spriteFile, name, _ := strings.Cut(ref, ":")
+		rs, _ := load(spriteFile, name)
+		resolved[ref] = rs
+		return rs
+	}
+	return func(n int) (*image.RGBA, error) {
+		return mf.Render(sprites, tilemap.RenderOptions{Region: region, Frame: n, FrameRate: flagRenderFPS}), nil
+	}, nil
+}
+
+// spriteDrawer loads the sprites of a sprite file for runRender, or only
+// the one --sprite names.
+func spriteDrawer(root, file string) (func(n int) (*image.RGBA, error), error) {
+	var sprites []sprite.ResolvedSprite
+	if flagRenderSprite != "" {
+		s, err := loadResolvedSprite(root, file, flagRenderSprite)
+		if err != nil {
+			return nil, err
+		}
+		sprites = []sprite.ResolvedSprite{s}
+	} else {
+		var err error
+		if sprites, _, err = loadResolvedSprites(root, file); err != nil {
+			return nil, err
+		}
+	}
+	if len(sprites) == 0 {
+		return nil, fmt.Errorf("%s has no sprites", file)
+	}
+	return func(n int) (*image.RGBA, error) {
+		return export.SpritesAt(sprites, n, flagRenderFPS)
+	}, nil
+}
+
+// parseRenderRegion parses an x,y,w,h region in tiles and crops it to a
+// w x h map.
+func parseRenderRegion(s string, mapW, mapH int) (image.Rectangle, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return image.Rectangle{}, fmt.Errorf("--region must be x,y,w,h, got %q", s)
+	}
+	var n [4]int
+	for i, p := range parts {
+		v, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil {
+			return image.Rectangle{}, fmt.Errorf("--region must be x,y,w,h in whole tiles, got %q", s)
+		}
+		n[i] = v
+	}
+	x, y, w, h := n[0], n[1], n[2], n[3]
+	if x < 0 || y < 0 || w < 1 || h < 1 {
+		return image.Rectangle{}, fmt.Errorf("--region %q: x and y must not be negative and w and h must be positive", s)
+	}
+	if x >= mapW || y >= mapH {
+		return image.Rectangle{}, fmt.Errorf("--region at %d,%d is outside the %dx%d map", x, y, mapW, mapH)
+	}
+	return image.Rect(x, y, x+w, y+h).Intersect(image.Rect(0, 0, mapW, mapH)), nil
+}
@@ -2,35 +2,76 @@ package main
 
 import (
 	"github.com/spf13/cobra"
+	"github.com/vgalaktionov/runefact/internal/logging"
 )
 
 var (
-	flagConfig  string
-	flagVerbose bool
-	flagQuiet   bool
+	flagConfig    string
+	flagVerbose   bool
+	flagQuiet     bool
+	flagLogLevel  string
+	flagLogFormat string
 )
 
 var rootCmd = &cobra.Command{
 	Use:   "runefact",
 	Short: "Runes become artifacts",
 	Long:  "Runefact compiles text-based asset definitions into game-ready artifacts for ebitengine.",
+
+	PersistentPreRunE: setupLogging,
 }
 
 func init() {
 	rootCmd.PersistentFlags().StringVar(&flagConfig, "config", "", "path to runefact.toml (default: auto-detect)")
 	rootCmd.PersistentFlags().BoolVarP(&flagVerbose, "verbose", "v", false, "verbose output")
 	rootCmd.PersistentFlags().BoolVarP(&flagQuiet, "quiet", "q", false, "suppress non-error output")
+	rootCmd.PersistentFlags().StringVar(&flagLogLevel, "log-level", "", "lowest level logged: debug, info, warn or error (default info, debug with -v, error with -q)")
+	rootCmd.PersistentFlags().StringVar(&flagLogFormat, "log-format", "plain", "log format: plain, text (with timestamps) or json")
+	rootCmd.RegisterFlagCompletionFunc("log-level", cobra.FixedCompletions(logging.Levels, cobra.ShellCompDirectiveNoFileComp))
+	rootCmd.RegisterFlagCompletionFunc("log-format", cobra.FixedCompletions(logging.Formats, cobra.ShellCompDirectiveNoFileComp))
 
 	rootCmd.AddCommand(buildCmd)
 	rootCmd.AddCommand(validateCmd)
 	rootCmd.AddCommand(previewCmd)
 	rootCmd.AddCommand(watchCmd)
 	rootCmd.AddCommand(initCmd)
+	rootCmd.AddCommand(newCmd)
 	rootCmd.AddCommand(mcpCmd)
+	rootCmd.AddCommand(exportCmd)
+	rootCmd.AddCommand(inspectCmd)
+	rootCmd.AddCommand(renderCmd)
+	rootCmd.AddCommand(fmtCmd)
+	rootCmd.AddCommand(upgradeCmd)
+	rootCmd.AddCommand(paletteCmd)
+	rootCmd.AddCommand(benchCmd)
 	rootCmd.AddCommand(docsCmd)
 	rootCmd.AddCommand(versionCmd)
 }
 
+// setupLogging installs the logger for --log-level and --log-format on
+// stderr. Without --log-level, -v and -q pick the level, and the MCP server
+// only logs warnings and errors.
+func setupLogging(cmd *cobra.Command, args []string) error {
+	level := flagLogLevel
+	if level == "" {
+		switch {
+		case flagQuiet:
+			level = "error"
+		case flagVerbose:
+			level = "debug"
+		case cmd == mcpCmd:
+			level = "warn"
+		default:
+			level = "info"
+		}
+	}
+	l, err := logging.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	return logging.Setup(cmd.ErrOrStderr(), l, flagLogFormat)
+}
+
 // Execute runs the root command.
 func Execute() error {
 	return rootCmd.Execute()
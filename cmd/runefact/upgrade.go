@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/vgalaktionov/runefact/internal/atomicfile"
+	"github.com/vgalaktionov/runefact/internal/migrate"
+)
+
+var flagUpgradeDryRun bool
+
+var upgradeCmd = &cobra.Command{
+	Use:   "upgrade [files...]",
+	Short: "Migrate rune files to the current format version",
+	Long: `Upgrade rewrites rune files written for an older version of their format
+to the current one, and lists every change it makes. A file's version is
+its top-level format_version; files without one are version 1. Without
+arguments it upgrades every rune file under assets/.
+
+Comments and layout are kept, and a formatted file stays formatted. A file
+with a format_version newer than this runefact supports is an error rather
+than being downgraded.
+
+With --dry-run nothing is written; the changes are only listed.
+
+Examples:
+  runefact upgrade                    # upgrade everything
+  runefact upgrade level1.map         # upgrade one file
+  runefact upgrade --dry-run          # see what would change`,
+	ValidArgsFunction: completeRuneFiles(false),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root, _, err := loadProjectConfig()
+		if err != nil {
+			return err
+		}
+
+		files, err := fmtFiles(root, args)
+		if err != nil {
+			return err
+		}
+
+		verb := "upgraded"
+		if flagUpgradeDryRun {
+			verb = "would upgrade"
+		}
+		var upgraded, failed int
+		for _, f := range files {
+			data, err := os.ReadFile(f)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				failed++
+				continue
+			}
+			r, err := migrate.Upgrade(data, f)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				failed++
+				continue
+			}
+			if r.From == r.To {
+				continue
+			}
+			if !flagUpgradeDryRun {
+				info, err := os.Stat(f)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "error: %v\n", err)
+					failed++
+					continue
+				}
+				if err := atomicfile.WriteFile(f, r.Data, info.Mode().Perm()); err != nil {
+					fmt.Fprintf(os.Stderr, "error: %v\n", err)
+					failed++
+					continue
+				}
+			}
+			upgraded++
+			if !flagQuiet {
+				fmt.Fprintf(cmd.OutOrStdout(), "%s %s (v%d -> v%d)\n", verb, relPath(root, f), r.From, r.To)
+				for _, c := range r.Changes {
+					fmt.Fprintf(cmd.OutOrStdout(), "  %s\n", c)
+				}
+			}
+		}
+
+		if !flagQuiet {
+			if upgraded == 0 && failed == 0 {
+				fmt.Fprintln(cmd.OutOrStdout(), "All files are at the current format version.")
+			} else if upgraded > 0 {
+				fmt.Fprintf(cmd.OutOrStdout(), "%s %d file(s)\n", verb, upgraded)
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d file(s) could not be upgraded", failed)
+		}
+		return nil
+	},
+}
+
+func init() {
+	upgradeCmd.Flags().BoolVar(&flagUpgradeDryRun, "dry-run", false, "list the changes without writing them")
+}
@@ -2,21 +2,37 @@ package main
 
 import (
 	"fmt"
-	"os"
+	"log/slog"
 
 	"github.com/vgalaktionov/runefact/internal/build"
 	"github.com/spf13/cobra"
 )
 
+var (
+	flagValidateStrict      bool
+	flagValidatePalettes    bool
+	flagValidateInstruments bool
+	flagValidateAll         bool
+)
+
 var validateCmd = &cobra.Command{
 	Use:   "validate [files...]",
 	Short: "Check rune files for errors without building",
 	Long: `Validate parses rune files and reports errors without producing output artifacts.
-Returns exit code 0 if all files are valid, 1 if errors are found.
+Files that validated cleanly last time are skipped while neither they, the
+files they depend on nor runefact.toml have changed; --all checks them too.
+Exits with 0 if all files are valid, 2 if errors are found, 3 if there are
+warnings and --strict was given, and 1 if runefact itself failed.
 
 Examples:
   runefact validate                 # validate everything
-  runefact validate player.sprite   # validate specific file`,
+  runefact validate player.sprite   # validate specific file and its palette
+  runefact validate --palettes      # validate only palettes
+  runefact validate --instruments   # validate only instruments
+  runefact validate --strict        # fail on warnings too
+  runefact validate --all           # ignore the cache, validate everything
+  runefact validate --set lint.max_sheet_size=1024`,
+	ValidArgsFunction: completeRuneFiles(false),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		root, cfg, err := loadProjectConfig()
 		if err != nil {
@@ -24,23 +40,36 @@ Examples:
 		}
 
 		opts := build.Options{
-			Scope: build.ScopeAll,
-			Files: args,
+			Scope:       build.ScopeAll,
+			Files:       args,
+			ChangedOnly: !flagValidateAll,
+		}
+		if flagValidatePalettes {
+			opts.Scope = build.ScopePalettes
+		} else if flagValidateInstruments {
+			opts.Scope = build.ScopeInstruments
 		}
 
 		result := build.Validate(opts, cfg, root)
 
-		for _, w := range result.Warnings {
-			if !flagQuiet {
-				fmt.Fprintf(os.Stderr, "warning: %s\n", w)
-			}
+		logPulled(result)
+		if opts.ChangedOnly {
+			slog.Info(fmt.Sprintf("validated %d changed file(s), skipped %d cached", len(result.Validated), len(result.Cached)))
+		}
+		logWarnings(result)
+
+		for _, h := range result.Hints {
+			slog.Info("hint: " + h)
 		}
 
 		if len(result.Errors) > 0 {
 			for _, e := range result.Errors {
-				fmt.Fprintf(os.Stderr, "error: %v\n", e)
+				slog.Error(e.Error())
 			}
-			return fmt.Errorf("validation failed with %d error(s)", len(result.Errors))
+			return assetErrorf("validation failed with %d error(s)", len(result.Errors))
+		}
+		if flagValidateStrict && len(result.Warnings) > 0 {
+			return warningErrorf("validation finished with %d warning(s) (--strict)", len(result.Warnings))
 		}
 
 		if !flagQuiet {
@@ -49,3 +78,12 @@ Examples:
 		return nil
 	},
 }
+
+func init() {
+	validateCmd.Flags().BoolVar(&flagValidateStrict, "strict", false, "fail with exit code 3 if there are warnings")
+	validateCmd.Flags().BoolVar(&flagValidatePalettes, "palettes", false, "validate only palettes")
+	validateCmd.Flags().BoolVar(&flagValidateInstruments, "instruments", false, "validate only instruments")
+	validateCmd.MarkFlagsMutuallyExclusive("palettes", "instruments")
+	validateCmd.Flags().BoolVar(&flagValidateAll, "all", false, "validate every file, even unchanged ones that passed last time")
+	validateCmd.Flags().StringArrayVar(&flagSet, "set", nil, "override a runefact.toml value as section.key=value (repeatable)")
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"log/slog"
 	"os"
 	"os/signal"
 	"path/filepath"
@@ -9,6 +10,7 @@ import (
 	"time"
 
 	"github.com/vgalaktionov/runefact/internal/build"
+	"github.com/vgalaktionov/runefact/internal/instrument"
 	"github.com/vgalaktionov/runefact/internal/watcher"
 	"github.com/spf13/cobra"
 )
@@ -33,31 +35,35 @@ Runs until interrupted with Ctrl+C.`,
 		if !flagQuiet {
 			fmt.Println("Running initial build...")
 		}
-		result := build.Build(build.Options{}, cfg, root)
-		if len(result.Errors) > 0 {
-			for _, e := range result.Errors {
-				fmt.Fprintf(os.Stderr, "error: %v\n", e)
-			}
-		} else if !flagQuiet {
-			fmt.Printf("Built %d artifact(s)\n", len(result.Artifacts))
-		}
+		logWatchBuild(build.Build(build.Options{}, cfg, root), "Built")
 
-		w, err := watcher.New(100*time.Millisecond, func(changed []string) error {
-			r := build.Build(build.Options{}, cfg, root)
-			for _, e := range r.Errors {
-				fmt.Fprintf(os.Stderr, "error: %v\n", e)
-			}
-			if len(r.Errors) == 0 && !flagQuiet {
-				fmt.Printf("Rebuilt %d artifact(s)\n", len(r.Artifacts))
-			}
+		// The config already rejects an output directory among the assets;
+		// ignoring it as well keeps artifacts from ever looping into a
+		// rebuild.
+		ignoreOutput := watcher.WithIgnoreDirs(filepath.Join(root, cfg.Project.Output))
+
+		var w *watcher.Watcher
+		w, err = watcher.New(100*time.Millisecond, func(changed []string) error {
+			logWatchBuild(build.Build(build.Options{}, cfg, root), "Rebuilt")
+			watchSamples(w.Dependencies(), cfg.AssetsDirs(root))
 			return nil
-		})
+		}, watcher.WithIgnorePatterns(cfg.Watch.Ignore), ignoreOutput)
 		if err != nil {
 			return fmt.Errorf("creating watcher: %w", err)
 		}
+		watchSamples(w.Dependencies(), cfg.AssetsDirs(root))
 
-		if err := w.WatchDir(assetsDir); err != nil {
-			return fmt.Errorf("watching %s: %w", assetsDir, err)
+		// Included projects are watched too; one with no assets directory
+		// is reported by the build instead.
+		for i, dir := range cfg.AssetsDirs(root) {
+			if i > 0 {
+				if _, err := os.Stat(dir); err != nil {
+					continue
+				}
+			}
+			if err := w.WatchDir(dir); err != nil {
+				return fmt.Errorf("watching %s: %w", dir, err)
+			}
 		}
 
 		if !flagQuiet {
@@ -77,3 +83,35 @@ Runs until interrupted with Ctrl+C.`,
 		return w.Stop()
 	},
 }
+
+// watchSamples registers the sample of every instrument, so editing a WAV
+// rebuilds like editing the instrument. Instruments that don't parse are
+// skipped; the build reports them.
+func watchSamples(deps *watcher.DependencyTracker, assetsDirs []string) {
+	for _, dir := range assetsDirs {
+		files, _ := filepath.Glob(filepath.Join(dir, "instruments", "*.inst"))
+		for _, f := range files {
+			data, err := os.ReadFile(f)
+			if err != nil {
+				continue
+			}
+			inst, err := instrument.ParseInstrument(data, f)
+			if err != nil || inst.Sample == nil {
+				continue
+			}
+			deps.RegisterSampleDep(instrument.SamplePath(f, inst.Sample.File), f)
+		}
+	}
+}
+
+// logWatchBuild logs a build's warnings and errors, or how many artifacts
+// it wrote if it succeeded.
+func logWatchBuild(r *build.Result, verb string) {
+	logWarnings(r)
+	for _, e := range r.Errors {
+		slog.Error(e.Error())
+	}
+	if len(r.Errors) == 0 {
+		slog.Info(fmt.Sprintf("%s %d artifact(s)", verb, len(r.Artifacts)))
+	}
+}
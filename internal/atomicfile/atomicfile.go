@@ -0,0 +1,190 @@
+// Package atomicfile writes files so that a reader, or the next build,
+// sees either the old content or the new, never a file cut short by a
+// crash, a full disk or Ctrl-C.
+//
+// Data goes to a temporary file in the destination's directory, which is
+// synced and then renamed over the destination. A rename within one
+// directory is atomic on every platform runefact supports.
+package atomicfile
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// tempMarker is part of every temporary file name, so that files left
+// behind by a killed process can be found and removed by CleanTemp.
+const tempMarker = ".runefact-tmp-"
+
+// rename is os.Rename, replaced in tests to make renames fail.
+var rename = os.Rename
+
+// Write creates or replaces path with what write writes, creating missing
+// directories. If write or anything after it fails, the temporary file is
+// removed and path is left as it was.
+func Write(path string, perm fs.FileMode, write func(io.Writer) error) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("creating output directory: %w", err)
+	}
+	tmp, err := writeTemp(path, perm, write)
+	if err != nil {
+		return err
+	}
+	if err := rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return syncDir(dir)
+}
+
+// writeTemp writes a synced temporary file next to path and returns its
+// name. Nothing is left behind if it fails.
+func writeTemp(path string, perm fs.FileMode, write func(io.Writer) error) (tmp string, err error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+tempMarker+"*")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	if err := write(f); err != nil {
+		return "", err
+	}
+	if err := f.Chmod(perm); err != nil {
+		return "", err
+	}
+	if err := f.Sync(); err != nil {
+		return "", err
+	}
+	return f.Name(), f.Close()
+}
+
+// WriteFile is Write for data already in memory, like os.WriteFile.
+func WriteFile(path string, data []byte, perm fs.FileMode) error {
+	return Write(path, perm, writeData(data))
+}
+
+func writeData(data []byte) func(io.Writer) error {
+	return func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	}
+}
+
+// File is new content for an existing file, for WriteFiles.
+type File struct {
+	Path string
+	Data []byte
+}
+
+// WriteFiles replaces existing files all together or not at all, keeping
+// their permissions. Every file is written to a temporary file first; only
+// when all of them are written are they renamed over the originals. If a
+// rename fails, the files already replaced get their old content back.
+func WriteFiles(files []File) error {
+	type staged struct {
+		path, tmp string
+		old       []byte
+		perm      fs.FileMode
+	}
+	var done []staged
+	removeTemps := func(from int) {
+		for _, s := range done[from:] {
+			os.Remove(s.tmp)
+		}
+	}
+	for _, f := range files {
+		info, err := os.Stat(f.Path)
+		if err != nil {
+			removeTemps(0)
+			return err
+		}
+		old, err := os.ReadFile(f.Path)
+		if err != nil {
+			removeTemps(0)
+			return err
+		}
+		tmp, err := writeTemp(f.Path, info.Mode().Perm(), writeData(f.Data))
+		if err != nil {
+			removeTemps(0)
+			return err
+		}
+		done = append(done, staged{path: f.Path, tmp: tmp, old: old, perm: info.Mode().Perm()})
+	}
+
+	for i, s := range done {
+		if err := rename(s.tmp, s.path); err != nil {
+			removeTemps(i)
+			var lost []string
+			for _, r := range done[:i] {
+				if WriteFile(r.path, r.old, r.perm) != nil {
+					lost = append(lost, r.path)
+				}
+			}
+			if len(lost) > 0 {
+				return fmt.Errorf("replacing %s: %w; could not restore %s", s.path, err, strings.Join(lost, ", "))
+			}
+			return fmt.Errorf("replacing %s: %w", s.path, err)
+		}
+	}
+	for _, s := range done {
+		if err := syncDir(filepath.Dir(s.path)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncDir flushes a rename to disk, so the new name survives a power
+// loss. Windows can't open a directory for syncing and doesn't need to.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// IsTemp reports whether name is a temporary file made by Write.
+func IsTemp(name string) bool {
+	return strings.HasPrefix(filepath.Base(name), ".") && strings.Contains(filepath.Base(name), tempMarker)
+}
+
+// CleanTemp removes temporary files under dir left by a process that was
+// killed mid-write, and returns their paths. A missing dir is not an
+// error.
+func CleanTemp(dir string) ([]string, error) {
+	var removed []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir && errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() || !IsTemp(path) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		removed = append(removed, path)
+		return nil
+	})
+	return removed, err
+}
@@ -0,0 +1,160 @@
+package atomicfile
+
+import (
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// failingWriter passes n bytes through and then fails.
+type failingWriter struct {
+	w io.Writer
+	n int
+}
+
+var errInjected = errors.New("injected write error")
+
+func (f *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > f.n {
+		n, _ := f.w.Write(p[:f.n])
+		f.n = 0
+		return n, errInjected
+	}
+	f.n -= len(p)
+	return f.w.Write(p)
+}
+
+func TestWrite_FailedPNGEncodeLeavesNoFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "sprites", "player.png")
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+
+	err := Write(path, 0644, func(w io.Writer) error {
+		return png.Encode(&failingWriter{w: w, n: 100}, img)
+	})
+	if !errors.Is(err, errInjected) {
+		t.Fatalf("err = %v, want the injected error", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("destination exists after a failed write: %v", err)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	for _, e := range entries {
+		t.Errorf("left behind %s", e.Name())
+	}
+}
+
+func TestWrite_FailureKeepsOldContent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.go")
+	if err := WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := Write(path, 0644, func(w io.Writer) error {
+		w.Write([]byte("ne"))
+		return errInjected
+	})
+	if !errors.Is(err, errInjected) {
+		t.Fatalf("err = %v, want the injected error", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "old" {
+		t.Errorf("content = %q, %v; want old", data, err)
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a", "b.json")
+	if err := WriteFile(path, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 2 {
+		t.Errorf("size = %d, want 2", info.Size())
+	}
+	if perm := info.Mode().Perm(); perm != 0644 {
+		t.Errorf("perm = %o, want 644", perm)
+	}
+}
+
+func TestCleanTemp(t *testing.T) {
+	dir := t.TempDir()
+	keep := filepath.Join(dir, "audio", "jump.wav")
+	stale := filepath.Join(dir, "audio", ".jump.wav"+tempMarker+"123")
+	for _, p := range []string{keep, stale} {
+		os.MkdirAll(filepath.Dir(p), 0755)
+		os.WriteFile(p, []byte("x"), 0644)
+	}
+
+	removed, err := CleanTemp(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 || removed[0] != stale {
+		t.Errorf("removed = %v, want [%s]", removed, stale)
+	}
+	if _, err := os.Stat(keep); err != nil {
+		t.Errorf("artifact removed: %v", err)
+	}
+
+	if _, err := CleanTemp(filepath.Join(dir, "missing")); err != nil {
+		t.Errorf("missing dir: %v", err)
+	}
+}
+
+func TestWriteFiles_RenameFailureRestores(t *testing.T) {
+	dir := t.TempDir()
+	var files []File
+	for _, name := range []string{"a.palette", "b.sprite", "c.sprite"} {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte("old "+name), 0600)
+		files = append(files, File{Path: path, Data: []byte("new " + name)})
+	}
+
+	// The third rename fails, after two files were already replaced.
+	renames := 0
+	rename = func(from, to string) error {
+		if renames++; renames == 3 {
+			return errInjected
+		}
+		return os.Rename(from, to)
+	}
+	t.Cleanup(func() { rename = os.Rename })
+
+	if err := WriteFiles(files); !errors.Is(err, errInjected) {
+		t.Fatalf("err = %v, want the injected error", err)
+	}
+	for _, f := range files {
+		got, _ := os.ReadFile(f.Path)
+		if want := "old " + filepath.Base(f.Path); string(got) != want {
+			t.Errorf("%s = %q, want %q restored", filepath.Base(f.Path), got, want)
+		}
+		if info, _ := os.Stat(f.Path); info.Mode().Perm() != 0600 {
+			t.Errorf("%s perm = %o, want 600 kept", filepath.Base(f.Path), info.Mode().Perm())
+		}
+	}
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if IsTemp(e.Name()) {
+			t.Errorf("left behind %s", e.Name())
+		}
+	}
+
+	rename = os.Rename
+	if err := WriteFiles(files); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(files[2].Path); string(got) != "new c.sprite" {
+		t.Errorf("c.sprite = %q after a successful write", got)
+	}
+	if err := WriteFiles([]File{{Path: filepath.Join(dir, "missing"), Data: nil}}); err == nil {
+		t.Error("missing file: expected an error")
+	}
+}
@@ -1,7 +1,14 @@
 package audio
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
 	"math"
+	"runtime"
+	"slices"
+	"strings"
 	"testing"
 )
 
@@ -125,6 +132,60 @@ func TestADSR_Release(t *testing.T) {
 	}
 }
 
+func TestADSR_ReleaseCurve(t *testing.T) {
+	linear := ADSR{Sustain: 0.8, Release: 0.1}
+	exp := ADSR{Sustain: 0.8, Release: 0.1, ReleaseCurve: CurveExponential}
+	mid := linear.Level(0.55, 0.5)
+	if v := exp.Level(0.55, 0.5); v <= 0 || v >= mid {
+		t.Errorf("exponential mid-release = %f, want between 0 and linear %f", v, mid)
+	}
+	if v := exp.Level(0.61, 0.5); v != 0 {
+		t.Errorf("post-release = %f, want 0", v)
+	}
+}
+
+func TestADSR_AttackCurve(t *testing.T) {
+	for curve, below := range map[CurveType]bool{CurveExponential: true, CurveLogarithmic: false} {
+		env := ADSR{Attack: 0.1, Sustain: 1, AttackCurve: curve}
+		v := env.Level(0.05, 1)
+		if v <= 0 || v >= 1 || (v < 0.5) != below {
+			t.Errorf("%s mid-attack = %f, want below 0.5: %v", curve, v, below)
+		}
+	}
+}
+
+func TestADSR_CurvesContinuous(t *testing.T) {
+	const eps = 1e-9
+	for _, curve := range []CurveType{"", CurveLinear, CurveExponential, CurveLogarithmic} {
+		env := ADSR{Attack: 0.1, Decay: 0.1, Sustain: 0.5, Release: 0.2, AttackCurve: curve, ReleaseCurve: curve}
+		for _, tt := range []struct {
+			name          string
+			at, noteOnDur float64
+		}{
+			{"start of attack", 0, 1},
+			{"attack into decay", 0.1, 1},
+			{"sustain into release", 1, 1},
+			{"release during attack", 0.05, 0.05},
+			{"end of release", 1.2, 1},
+		} {
+			before, after := env.Level(tt.at-eps, tt.noteOnDur), env.Level(tt.at+eps, tt.noteOnDur)
+			if math.Abs(before-after) > 1e-6 {
+				t.Errorf("%q curve, %s: level jumps from %f to %f", curve, tt.name, before, after)
+			}
+		}
+	}
+}
+
+func TestADSR_Validate(t *testing.T) {
+	if err := (ADSR{AttackCurve: CurveExponential, ReleaseCurve: CurveLogarithmic}).Validate(); err != nil {
+		t.Error(err)
+	}
+	err := ADSR{ReleaseCurve: "expo"}.Validate()
+	if err == nil || !strings.Contains(err.Error(), `release_curve "expo" must be`) {
+		t.Errorf("err = %v, want a release_curve error", err)
+	}
+}
+
 func TestInterpolate_Linear(t *testing.T) {
 	v := Interpolate(100, 200, 0.5, CurveLinear)
 	if math.Abs(v-150) > 1e-10 {
@@ -161,13 +222,211 @@ func TestMIDIToFreq(t *testing.T) {
 	}
 }
 
+func TestParseNote(t *testing.T) {
+	for note, want := range map[string]int{"C4": 60, "A4": 69, "F#2": 42, "C0": 12, "B9": 131} {
+		got, err := ParseNote(note)
+		if err != nil || got != want {
+			t.Errorf("ParseNote(%q) = %d, %v; want %d", note, got, err, want)
+		}
+		if name := NoteName(want); name != note {
+			t.Errorf("NoteName(%d) = %q, want %q", want, name, note)
+		}
+	}
+	for _, note := range []string{"", "C", "4", "Db4", "c4", "C10", "C-1", "C4 "} {
+		if _, err := ParseNote(note); err == nil {
+			t.Errorf("ParseNote(%q): expected an error", note)
+		}
+	}
+}
+
+func TestDrum(t *testing.T) {
+	const rate = 44100
+	c4 := MIDIToFreq(60)
+	render := func(d Drum, freq float64) []float64 {
+		samples, err := RenderVoice(context.Background(), &Voice{Drum: &d, Frequency: freq}, 0.5, rate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return samples
+	}
+	peak := func(samples []float64) float64 {
+		p := 0.0
+		for _, s := range samples {
+			p = max(p, math.Abs(s))
+		}
+		return p
+	}
+
+	for _, kind := range []string{DrumKick, DrumSnare, DrumHat} {
+		d := Drum{Kind: kind, Decay: DefaultDrumDecay(kind), Snap: 0.5}
+		samples := render(d, c4)
+		if again := render(d, c4); !slices.Equal(samples, again) {
+			t.Errorf("%s: two renders differ", kind)
+		}
+		if p := peak(samples); p < 0.3 || p > 1 {
+			t.Errorf("%s: peak = %.2f, want 0.3-1", kind, p)
+		}
+		// 40 dB down by the decay time, and silent well after it.
+		end := int(d.Decay * rate)
+		if p := peak(samples[end : end+100]); p > 0.02 {
+			t.Errorf("%s: peak after %gs = %.3f, want under 0.02", kind, d.Decay, p)
+		}
+		if !IsDrum(kind) {
+			t.Errorf("IsDrum(%q) = false", kind)
+		}
+	}
+
+	kick := Drum{Kind: DrumKick, Decay: 0.35, Snap: 0}
+	if slices.Equal(render(kick, c4), render(Drum{Kind: DrumKick, Decay: 0.35, Tune: 5}, c4)) {
+		t.Error("tune should change the kick")
+	}
+	if slices.Equal(render(kick, c4), render(kick, MIDIToFreq(62))) {
+		t.Error("the note should change the kick")
+	}
+	if IsDrum("sine") {
+		t.Error("sine is not a drum")
+	}
+}
+
+func TestReadWAV(t *testing.T) {
+	in := []float64{0, 0.5, -0.5, 1, -1}
+	for _, bits := range []int{8, 16, 24} {
+		var buf bytes.Buffer
+		if err := encodeWAV(&buf, in, 22050, bits); err != nil {
+			t.Fatal(err)
+		}
+		s, err := ReadWAV(&buf)
+		if err != nil {
+			t.Fatalf("%d bits: %v", bits, err)
+		}
+		if s.Rate != 22050 || len(s.Frames) != len(in) {
+			t.Fatalf("%d bits: rate %d, %d frames", bits, s.Rate, len(s.Frames))
+		}
+		for i, f := range s.Frames {
+			if math.Abs(f-in[i]) > 0.01 {
+				t.Errorf("%d bits: frame %d = %v, want %v", bits, i, f, in[i])
+			}
+		}
+	}
+
+	var stereo bytes.Buffer
+	encodeWAV(&stereo, in, 22050, 16)
+	data := stereo.Bytes()
+	data[22] = 2 // channels
+	if _, err := ReadWAV(bytes.NewReader(data)); err == nil || !strings.Contains(err.Error(), "must be mono") {
+		t.Errorf("stereo: err = %v", err)
+	}
+	if _, err := ReadWAV(strings.NewReader("RIFF")); err == nil {
+		t.Error("a truncated header should be an error")
+	}
+
+	// A data chunk claiming 4 GiB in a file cut short after two frames.
+	var short bytes.Buffer
+	encodeWAV(&short, in, 22050, 16)
+	data = short.Bytes()
+	at := bytes.Index(data, []byte("data"))
+	binary.LittleEndian.PutUint32(data[at+4:], 0xfffffffe)
+	data = data[:at+8+4]
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	s, err := ReadWAV(bytes.NewReader(data))
+	runtime.ReadMemStats(&after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Frames) != 2 {
+		t.Errorf("oversized header: %d frames, want the 2 in the file", len(s.Frames))
+	}
+	if grew := after.TotalAlloc - before.TotalAlloc; grew > 1<<20 {
+		t.Errorf("oversized header: allocated %d bytes reading a %d-byte file", grew, len(data))
+	}
+}
+
+func TestSamplePlayer_Pitch(t *testing.T) {
+	// One second of A4.
+	const rate = 44100
+	frames := make([]float64, rate)
+	for i := range frames {
+		frames[i] = math.Sin(2 * math.Pi * 440 * float64(i) / rate)
+	}
+	p := &SamplePlayer{Sample: &Sample{Frames: frames, Rate: rate}, Root: 440}
+
+	// Time the rising zero crossings over a quarter second.
+	pitch := func(freq float64) float64 {
+		var first, last float64
+		crossings := 0
+		prev := p.At(0, freq)
+		for i := 1; i < rate/4; i++ {
+			cur := p.At(float64(i)/rate, freq)
+			if prev < 0 && cur >= 0 {
+				at := (float64(i) - cur/(cur-prev)) / rate
+				if crossings == 0 {
+					first = at
+				}
+				last = at
+				crossings++
+			}
+			prev = cur
+		}
+		return float64(crossings-1) / (last - first)
+	}
+	for _, freq := range []float64{220, 440, 659.26, 880} {
+		if got := pitch(freq); math.Abs(got-freq)/freq > 0.001 {
+			t.Errorf("played at %g Hz, measured %g Hz", freq, got)
+		}
+	}
+
+	// Without a loop it stops at the end; with one it keeps going.
+	if v := p.At(1.5, 440); v != 0 {
+		t.Errorf("past the end = %v, want silence", v)
+	}
+	p.LoopStart, p.LoopEnd = rate/2, rate
+	at := 1.5 + 0.25/440 // a quarter cycle in, the peak
+	if v := p.At(at, 440); math.Abs(v-1) > 0.01 {
+		t.Errorf("looped peak = %v, want 1", v)
+	}
+}
+
+// Vibrato changes the playback speed of a sample, never its direction: a
+// rising ramp must keep rising.
+func TestRenderVoice_SampleVibrato(t *testing.T) {
+	const rate = 8000
+	frames := make([]float64, 8*rate)
+	for i := range frames {
+		frames[i] = float64(i) / float64(len(frames))
+	}
+	v := &Voice{
+		Frequency: 440,
+		Env:       ADSR{Sustain: 1},
+		Sample:    &SamplePlayer{Sample: &Sample{Frames: frames, Rate: rate}, Root: 440},
+	}
+	v.Vibrato.Depth = 2
+	v.Vibrato.Rate = 6
+	samples, err := RenderVoice(context.Background(), v, 3.5, rate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 2; i < len(samples); i++ {
+		if samples[i] < samples[i-1] {
+			t.Fatalf("sample %d = %v after %v: playback ran backwards", i, samples[i], samples[i-1])
+		}
+	}
+	// Vibrato averages out, so 3.5 s in it has read about 3.5 s.
+	if got := samples[len(samples)-1] * 8; math.Abs(got-3.5) > 0.05 {
+		t.Errorf("read %.3f s of the recording in 3.5 s", got)
+	}
+}
+
 func TestRenderVoice_ProducesSamples(t *testing.T) {
 	v := &Voice{
 		Osc:       SineOsc{},
 		Env:       ADSR{Attack: 0.01, Decay: 0.01, Sustain: 0.8, Release: 0.05},
 		Frequency: 440,
 	}
-	samples := RenderVoice(v, 0.1, 44100)
+	samples, err := RenderVoice(context.Background(), v, 0.1, 44100)
+	if err != nil {
+		t.Fatal(err)
+	}
 	if len(samples) != 4410 {
 		t.Errorf("got %d samples, want 4410", len(samples))
 	}
@@ -188,12 +447,84 @@ func TestRenderVoice_PitchSweep(t *testing.T) {
 		PitchEnd:   400,
 		PitchCurve: CurveLinear,
 	}
-	samples := RenderVoice(v, 0.1, 44100)
+	samples, err := RenderVoice(context.Background(), v, 0.1, 44100)
+	if err != nil {
+		t.Fatal(err)
+	}
 	if len(samples) == 0 {
 		t.Fatal("no samples rendered")
 	}
 }
 
+func TestRenderVoice_Canceled(t *testing.T) {
+	v := &Voice{Osc: SineOsc{}, Env: ADSR{Sustain: 1}, Frequency: 440}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	samples, err := RenderVoice(ctx, v, 60, 44100)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if samples != nil {
+		t.Errorf("got %d samples, want none", len(samples))
+	}
+}
+
+func TestVoiceRenderer_MatchesRenderVoice(t *testing.T) {
+	v := &Voice{
+		Osc:        SawtoothOsc{},
+		Env:        ADSR{Sustain: 1, Release: 0.02},
+		PitchStart: 300,
+		PitchEnd:   900,
+		PitchCurve: CurveExponential,
+	}
+	want, err := RenderVoice(context.Background(), v, 0.05, 44100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewVoiceRenderer(v, 0.05, 44100)
+	if r.Len() != len(want) {
+		t.Fatalf("Len() = %d, want %d", r.Len(), len(want))
+	}
+	for i, w := range want {
+		if got := r.Next(); got != w {
+			t.Fatalf("sample %d = %v, want %v", i, got, w)
+		}
+	}
+}
+
+func TestVoiceRenderer_HardSync(t *testing.T) {
+	const sampleRate = 44100
+	flat := ADSR{Sustain: 1}
+	master := NewVoiceRenderer(&Voice{Osc: SineOsc{}, Env: flat, Frequency: 110}, 0.1, sampleRate)
+	slave := NewVoiceRenderer(&Voice{Osc: SineOsc{}, Env: flat, Frequency: 250}, 0.1, sampleRate)
+
+	m := make([]float64, master.Len())
+	s := make([]float64, slave.Len())
+	for i := range m {
+		m[i] = master.Next()
+		s[i] = slave.Next()
+		slave.SyncTo(master)
+	}
+
+	// Wherever the master crosses zero going up, it has started a cycle,
+	// and the slave must start one with it: at zero and rising. Unsynced, a
+	// 250 Hz sine would be elsewhere in its cycle at most of these.
+	step := math.Sin(2 * math.Pi * 250 / sampleRate)
+	crossings := 0
+	for i := 1; i+1 < len(m); i++ {
+		if m[i-1] >= 0 || m[i] < 0 {
+			continue
+		}
+		crossings++
+		if s[i] < 0 || s[i] > step || s[i+1] <= s[i] {
+			t.Errorf("master crosses zero at sample %d, slave = %.3f, %.3f, want a rising zero", i, s[i], s[i+1])
+		}
+	}
+	if crossings != 10 {
+		t.Errorf("got %d master cycles, want 10", crossings)
+	}
+}
+
 func TestBiquadFilter_Lowpass(t *testing.T) {
 	f := NewBiquadFilter(FilterLowpass, 1000, 0.3, 44100)
 	// Process some samples — just check it doesn't panic or produce NaN.
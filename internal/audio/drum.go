@@ -0,0 +1,92 @@
+package audio
+
+import "math"
+
+// Drum waveforms. Unlike the oscillators, a drum is a whole one-shot sound:
+// its pitch and level move over time from the moment it is struck.
+const (
+	DrumKick  = "kick"
+	DrumSnare = "snare"
+	DrumHat   = "hat"
+)
+
+// IsDrum reports whether waveform names a drum.
+func IsDrum(waveform string) bool {
+	return waveform == DrumKick || waveform == DrumSnare || waveform == DrumHat
+}
+
+// DefaultDrumDecay returns the decay of a drum kind when none is given.
+func DefaultDrumDecay(kind string) float64 {
+	switch kind {
+	case DrumKick:
+		return 0.35
+	case DrumSnare:
+		return 0.18
+	default:
+		return 0.06
+	}
+}
+
+// Drum synthesizes a kick, snare or hat:
+//
+//   - kick: a sine swept down from 180 Hz to 50 Hz, with a noise click
+//   - snare: a 185 Hz tone decaying twice as fast as a noise burst
+//   - hat: high-passed noise
+//
+// The noise is a hash of the sample index, so a drum renders the same
+// every time.
+type Drum struct {
+	Kind string
+	// Tune shifts the pitch in semitones. A hat has no pitch; tuning it
+	// down darkens its noise.
+	Tune float64
+	// Decay is how many seconds the drum takes to fall by 40 dB.
+	Decay float64
+	// Snap, from 0 to 1, is the kick's click, the snare's noise against
+	// its tone, and the hat's brightness.
+	Snap float64
+}
+
+// Sample returns the drum's sample t seconds after it was struck at freq.
+// C4 plays the drum at its own pitch; other notes shift it.
+func (d Drum) Sample(t, freq float64, sampleRate int) float64 {
+	if t < 0 || d.Decay <= 0 {
+		return 0
+	}
+	ratio := math.Pow(2, d.Tune/12) * freq / MIDIToFreq(60)
+	i := int(math.Round(t * float64(sampleRate)))
+	level := math.Exp(-4.6 * t / d.Decay) // 40 dB down at Decay
+
+	switch d.Kind {
+	case DrumKick:
+		// An exponential sweep, integrated so the phase is continuous.
+		const sweep = 0.03 // seconds
+		start, end := 180*ratio, 50*ratio
+		phase := end*t + (start-end)*sweep*(1-math.Exp(-t/sweep))
+		body := math.Sin(2*math.Pi*phase) * level
+		click := drumNoise(i) * math.Exp(-t/0.002)
+		return (1-d.Snap/2)*body + d.Snap/2*click
+	case DrumSnare:
+		tone := math.Sin(2*math.Pi*185*ratio*t) * math.Exp(-9.2*t/d.Decay)
+		return (1-d.Snap)*tone + d.Snap*drumNoise(i)*level
+	case DrumHat:
+		// Holding each noise value for a few samples lowers its pitch.
+		j := i
+		if ratio < 1 {
+			j = int(float64(i) * ratio)
+		}
+		bright := (drumNoise(j) - drumNoise(j-1)) / 2
+		return ((1-d.Snap)*drumNoise(j) + d.Snap*bright) * level
+	}
+	return 0
+}
+
+// drumNoise returns white noise in [-1, 1) for sample i, the same for the
+// same i.
+func drumNoise(i int) float64 {
+	x := uint64(i) + 0x9e3779b97f4a7c15
+	x = (x ^ x>>30) * 0xbf58476d1ce4e5b9
+	x = (x ^ x>>27) * 0x94d049bb133111eb
+	x ^= x >> 31
+	return float64(x>>11)/(1<<52) - 1
+}
@@ -1,11 +1,52 @@
 package audio
 
+import "fmt"
+
 // ADSR represents an Attack-Decay-Sustain-Release envelope.
 type ADSR struct {
 	Attack  float64 // seconds
 	Decay   float64 // seconds
 	Sustain float64 // level 0.0-1.0
 	Release float64 // seconds
+
+	// AttackCurve and ReleaseCurve shape the attack and release ramps.
+	// Empty means linear.
+	AttackCurve  CurveType
+	ReleaseCurve CurveType
+}
+
+// envelopeFloor is the level, -60 dB, that curved envelope segments run
+// from or to in place of silence: an exponential never reaches zero.
+const envelopeFloor = 0.001
+
+// Validate checks that the envelope's curves are known curve types.
+func (e ADSR) Validate() error {
+	for _, c := range []struct {
+		field string
+		curve CurveType
+	}{{"attack_curve", e.AttackCurve}, {"release_curve", e.ReleaseCurve}} {
+		switch c.curve {
+		case "", CurveLinear, CurveExponential, CurveLogarithmic:
+		default:
+			return fmt.Errorf("%s %q must be %q, %q or %q", c.field, c.curve, CurveLinear, CurveExponential, CurveLogarithmic)
+		}
+	}
+	return nil
+}
+
+// curved reports whether c bends a ramp, rather than leaving it linear.
+func curved(c CurveType) bool {
+	return c == CurveExponential || c == CurveLogarithmic
+}
+
+// segment moves between two envelope levels along curve as t goes from 0
+// to 1. An exponential runs between the levels raised by envelopeFloor, so
+// it can start or end at silence.
+func segment(from, to, t float64, curve CurveType) float64 {
+	if curve == CurveExponential {
+		return Interpolate(from+envelopeFloor, to+envelopeFloor, t, curve) - envelopeFloor
+	}
+	return Interpolate(from, to, t, curve)
 }
 
 // Level returns the envelope amplitude at the given time.
@@ -19,10 +60,7 @@ func (e ADSR) Level(time, noteOnDuration float64) float64 {
 		// Note-on phase: attack -> decay -> sustain.
 		if time < e.Attack {
 			// Attack: ramp 0 -> 1.
-			if e.Attack == 0 {
-				return 1
-			}
-			return time / e.Attack
+			return e.attackLevel(time)
 		}
 		time -= e.Attack
 
@@ -45,16 +83,27 @@ func (e ADSR) Level(time, noteOnDuration float64) float64 {
 	}
 	// Calculate the level at the moment of release.
 	releaseLevel := e.levelAtRelease(noteOnDuration)
+	if curved(e.ReleaseCurve) {
+		return segment(releaseLevel, 0, releaseTime/e.Release, e.ReleaseCurve)
+	}
 	return releaseLevel * (1 - releaseTime/e.Release)
 }
 
+// attackLevel returns the level time seconds into the attack.
+func (e ADSR) attackLevel(time float64) float64 {
+	if e.Attack == 0 {
+		return 1
+	}
+	if curved(e.AttackCurve) {
+		return segment(0, 1, time/e.Attack, e.AttackCurve)
+	}
+	return time / e.Attack
+}
+
 // levelAtRelease returns the envelope level at the moment the note is released.
 func (e ADSR) levelAtRelease(noteOnDuration float64) float64 {
 	if noteOnDuration < e.Attack {
-		if e.Attack == 0 {
-			return 1
-		}
-		return noteOnDuration / e.Attack
+		return e.attackLevel(noteOnDuration)
 	}
 	t := noteOnDuration - e.Attack
 	if t < e.Decay {
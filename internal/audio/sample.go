@@ -0,0 +1,187 @@
+package audio
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// Sample is a mono recording read from a WAV file.
+type Sample struct {
+	Frames []float64 // from -1 to 1
+	Rate   int       // frames per second
+	// Sum identifies the file's contents, so a render cache notices an
+	// edited recording.
+	Sum [sha256.Size]byte
+}
+
+// LoadSample reads a WAV file as a Sample.
+func LoadSample(path string) (*Sample, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s, err := ReadWAV(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	s.Sum = sha256.Sum256(data)
+	return s, nil
+}
+
+// ReadWAV reads a mono PCM WAV file with 8, 16 or 24 bits per sample, the
+// formats WriteWAV writes. Chunks other than fmt and data are skipped.
+func ReadWAV(r io.Reader) (*Sample, error) {
+	var riff struct {
+		ID   [4]byte
+		Size uint32
+		Wave [4]byte
+	}
+	if err := binary.Read(r, binary.LittleEndian, &riff); err != nil || string(riff.ID[:]) != "RIFF" || string(riff.Wave[:]) != "WAVE" {
+		return nil, errors.New("not a WAV file")
+	}
+
+	var format struct {
+		Format     uint16
+		Channels   uint16
+		Rate       uint32
+		ByteRate   uint32
+		BlockAlign uint16
+		Bits       uint16
+	}
+	haveFormat := false
+	for {
+		var chunk struct {
+			ID   [4]byte
+			Size uint32
+		}
+		if err := binary.Read(r, binary.LittleEndian, &chunk); err != nil {
+			return nil, errors.New("WAV file has no data chunk")
+		}
+		switch string(chunk.ID[:]) {
+		case "fmt ":
+			if chunk.Size < 16 {
+				return nil, errors.New("WAV fmt chunk is too short")
+			}
+			if err := binary.Read(r, binary.LittleEndian, &format); err != nil {
+				return nil, fmt.Errorf("reading WAV format: %w", err)
+			}
+			if _, err := io.CopyN(io.Discard, r, int64(chunk.Size-16+chunk.Size%2)); err != nil {
+				return nil, fmt.Errorf("reading WAV format: %w", err)
+			}
+			switch {
+			case format.Format != 1:
+				return nil, fmt.Errorf("WAV format %d is not supported, only PCM", format.Format)
+			case format.Channels != 1:
+				return nil, fmt.Errorf("WAV has %d channels, samples must be mono", format.Channels)
+			case format.Bits != 8 && format.Bits != 16 && format.Bits != 24:
+				return nil, fmt.Errorf("WAV has %d bits per sample, want 8, 16 or 24", format.Bits)
+			case format.Rate == 0:
+				return nil, errors.New("WAV sample rate is 0")
+			}
+			haveFormat = true
+		case "data":
+			if !haveFormat {
+				return nil, errors.New("WAV data comes before its format")
+			}
+			// The size comes from the file, so it only limits the read:
+			// a corrupt header can't make us allocate gigabytes up front,
+			// and a file cut short keeps the frames it has.
+			data, err := io.ReadAll(io.LimitReader(r, int64(chunk.Size)))
+			if err != nil {
+				return nil, fmt.Errorf("reading WAV data: %w", err)
+			}
+			return &Sample{Frames: decodePCM(data, int(format.Bits)), Rate: int(format.Rate)}, nil
+		default:
+			if _, err := io.CopyN(io.Discard, r, int64(chunk.Size+chunk.Size%2)); err != nil {
+				return nil, errors.New("WAV file has no data chunk")
+			}
+		}
+	}
+}
+
+// decodePCM converts little-endian PCM frames to floats from -1 to 1.
+func decodePCM(data []byte, bits int) []float64 {
+	size := bits / 8
+	frames := make([]float64, len(data)/size)
+	for i := range frames {
+		b := data[i*size:]
+		switch bits {
+		case 8:
+			frames[i] = float64(b[0])/127.5 - 1 // unsigned
+		case 16:
+			frames[i] = float64(int16(binary.LittleEndian.Uint16(b))) / math.MaxInt16
+		case 24:
+			v := int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24) >> 8
+			frames[i] = float64(v) / 8388607
+		}
+	}
+	return frames
+}
+
+// SamplePlayer plays a Sample at any pitch by resampling it.
+type SamplePlayer struct {
+	Sample *Sample
+	// Root is the frequency the recording sounds at played at its own
+	// rate.
+	Root float64
+	// LoopStart and LoopEnd are the frames the recording repeats between
+	// once it reaches LoopEnd; no loop if LoopEnd is 0.
+	LoopStart, LoopEnd int
+}
+
+// At returns the sample t seconds into playing the recording at a
+// constant freq. A pitch that changes as it plays needs its read position
+// accumulated with Step and read with AtFrame.
+func (p *SamplePlayer) At(t, freq float64) float64 {
+	if t < 0 {
+		return 0
+	}
+	return p.AtFrame(t * p.Step(freq, 1))
+}
+
+// Step returns how many frames of the recording one output sample at
+// sampleRate moves on when playing at freq.
+func (p *SamplePlayer) Step(freq float64, sampleRate int) float64 {
+	if p.Root <= 0 || sampleRate <= 0 {
+		return 0
+	}
+	return float64(p.Sample.Rate) * freq / p.Root / float64(sampleRate)
+}
+
+// AtFrame returns the recording at read position pos, in frames from its
+// start, wrapped into the loop once past LoopEnd. A player without a
+// root note is silent.
+func (p *SamplePlayer) AtFrame(pos float64) float64 {
+	if pos < 0 || p.Root <= 0 {
+		return 0
+	}
+	if p.LoopEnd > p.LoopStart && pos >= float64(p.LoopEnd) {
+		span := float64(p.LoopEnd - p.LoopStart)
+		pos = float64(p.LoopStart) + math.Mod(pos-float64(p.LoopStart), span)
+	}
+	return p.Sample.at(pos)
+}
+
+// at interpolates the recording at a fractional frame with a Catmull-Rom
+// spline through the four frames around it, silent past either end.
+func (s *Sample) at(pos float64) float64 {
+	i := int(math.Floor(pos))
+	if i < 0 || i >= len(s.Frames) {
+		return 0
+	}
+	frame := func(j int) float64 {
+		if j < 0 || j >= len(s.Frames) {
+			return 0
+		}
+		return s.Frames[j]
+	}
+	x := pos - float64(i)
+	y0, y1, y2, y3 := frame(i-1), frame(i), frame(i+1), frame(i+2)
+	return y1 + 0.5*x*(y2-y0+x*(2*y0-5*y1+4*y2-y3+x*(3*(y1-y2)+y3-y0)))
+}
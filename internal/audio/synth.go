@@ -1,6 +1,13 @@
 package audio
 
-import "math"
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
 
 // CurveType defines pitch/filter sweep interpolation.
 type CurveType string
@@ -24,6 +31,10 @@ type Voice struct {
 		Rate  float64 // Hz
 	}
 	Filter *BiquadFilter
+	// Drum, if set, replaces the oscillator and envelope.
+	Drum *Drum
+	// Sample, if set, replaces the oscillator with a recording.
+	Sample *SamplePlayer
 }
 
 // Interpolate returns a value between start and end based on t [0,1] and curve type.
@@ -50,58 +61,156 @@ func Interpolate(start, end, t float64, curve CurveType) float64 {
 	}
 }
 
-// RenderVoice generates audio samples for a voice at the given duration and sample rate.
-func RenderVoice(v *Voice, duration float64, sampleRate int) []float64 {
-	numSamples := int(duration * float64(sampleRate))
-	samples := make([]float64, numSamples)
+// CheckInterval is how many samples a render produces between checks of its
+// context: often enough to stop within a few milliseconds of cancellation,
+// rarely enough to cost nothing per sample.
+const CheckInterval = 4096
+
+// RenderVoice generates audio samples for a voice at the given duration and
+// sample rate. If ctx is canceled first, it returns no samples and the
+// context's error.
+func RenderVoice(ctx context.Context, v *Voice, duration float64, sampleRate int) ([]float64, error) {
+	r := NewVoiceRenderer(v, duration, sampleRate)
+	samples := make([]float64, r.Len())
+	for i := range samples {
+		if i%CheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		samples[i] = r.Next()
+	}
+	return samples, nil
+}
 
-	noteOnDur := duration
+// VoiceRenderer renders a voice one sample at a time and keeps its
+// oscillator phase, so several voices can be stepped together and one can
+// hard-sync to another.
+type VoiceRenderer struct {
+	v          *Voice
+	duration   float64
+	noteOnDur  float64
+	pitchStart float64
+	pitchEnd   float64
+	sampleRate int
+
+	i       int
+	phase   float64 // oscillator phase in [0, 1)
+	readPos float64 // read position in a sample's frames
+	freq    float64 // frequency of the last sample
+	wrapped bool    // whether the last step completed a cycle
+}
+
+// NewVoiceRenderer prepares v to be rendered for duration seconds.
+func NewVoiceRenderer(v *Voice, duration float64, sampleRate int) *VoiceRenderer {
+	r := &VoiceRenderer{
+		v:          v,
+		duration:   duration,
+		noteOnDur:  duration,
+		pitchStart: v.PitchStart,
+		pitchEnd:   v.PitchEnd,
+		sampleRate: sampleRate,
+	}
 	if v.Env.Release > 0 && v.Env.Release < duration {
-		noteOnDur = duration - v.Env.Release
+		r.noteOnDur = duration - v.Env.Release
 	}
-
-	pitchStart := v.PitchStart
-	if pitchStart == 0 {
-		pitchStart = v.Frequency
+	if r.pitchStart == 0 {
+		r.pitchStart = v.Frequency
 	}
-	pitchEnd := v.PitchEnd
-	if pitchEnd == 0 {
-		pitchEnd = v.Frequency
+	if r.pitchEnd == 0 {
+		r.pitchEnd = v.Frequency
 	}
+	return r
+}
 
-	var phase float64
-	for i := 0; i < numSamples; i++ {
-		t := float64(i) / float64(sampleRate)
-		progress := t / duration
+// Len returns the number of samples the voice renders.
+func (r *VoiceRenderer) Len() int {
+	return int(r.duration * float64(r.sampleRate))
+}
 
-		// Calculate current frequency with pitch sweep.
-		freq := Interpolate(pitchStart, pitchEnd, progress, v.PitchCurve)
+// Next returns the next sample and advances the oscillator phase.
+func (r *VoiceRenderer) Next() float64 {
+	v := r.v
+	t := float64(r.i) / float64(r.sampleRate)
+	progress := t / r.duration
+	r.i++
 
-		// Apply vibrato.
-		if v.Vibrato.Depth > 0 && v.Vibrato.Rate > 0 {
-			vibrato := math.Sin(2*math.Pi*v.Vibrato.Rate*t) * v.Vibrato.Depth
-			freq *= math.Pow(2, vibrato/12)
-		}
+	// Calculate current frequency with pitch sweep.
+	freq := Interpolate(r.pitchStart, r.pitchEnd, progress, v.PitchCurve)
 
-		// Generate sample.
-		sample := v.Osc.Sample(phase)
+	// Apply vibrato.
+	if v.Vibrato.Depth > 0 && v.Vibrato.Rate > 0 {
+		vibrato := math.Sin(2*math.Pi*v.Vibrato.Rate*t) * v.Vibrato.Depth
+		freq *= math.Pow(2, vibrato/12)
+	}
 
-		// Apply filter.
-		if v.Filter != nil {
-			sample = v.Filter.Process(sample)
-		}
+	// Generate sample.
+	var sample float64
+	switch {
+	case v.Drum != nil:
+		sample = v.Drum.Sample(t, freq, r.sampleRate)
+	case v.Sample != nil:
+		// The position is accumulated like the phase, so a sweep or
+		// vibrato changes the speed, never where playback has got to.
+		sample = v.Sample.AtFrame(r.readPos)
+		r.readPos += v.Sample.Step(freq, r.sampleRate)
+	default:
+		sample = v.Osc.Sample(r.phase)
+	}
+
+	// Apply filter.
+	if v.Filter != nil {
+		sample = v.Filter.Process(sample)
+	}
+
+	// Apply envelope; a drum has its own.
+	if v.Drum == nil {
+		sample *= v.Env.Level(t, r.noteOnDur)
+	}
+
+	// Accumulate phase.
+	r.freq = freq
+	r.phase += freq / float64(r.sampleRate)
+	r.wrapped = r.phase >= 1
+	r.phase -= math.Floor(r.phase) // keep in [0, 1)
 
-		// Apply envelope.
-		sample *= v.Env.Level(t, noteOnDur)
+	return sample
+}
+
+// SyncTo hard-syncs r to master: if master's last step completed a cycle,
+// r's phase restarts with it. The phase master has run past the start of
+// its new cycle is carried over at r's frequency, so the reset lands
+// between samples where it should.
+func (r *VoiceRenderer) SyncTo(master *VoiceRenderer) {
+	if !master.wrapped || master.freq <= 0 {
+		return
+	}
+	r.phase = master.phase * r.freq / master.freq
+	r.phase -= math.Floor(r.phase)
+}
 
-		samples[i] = sample
+// noteNames are the names of the notes of an octave, from C.
+var noteNames = [12]string{"C", "C#", "D", "D#", "E", "F", "F#", "G", "G#", "A", "A#", "B"}
 
-		// Accumulate phase.
-		phase += freq / float64(sampleRate)
-		phase -= math.Floor(phase) // keep in [0, 1)
+// ParseNote converts a note written as in a track pattern, like C4 or F#2,
+// to its MIDI number. Octaves run from 0 to 9.
+func ParseNote(note string) (int, error) {
+	name, digits := note, ""
+	if i := strings.IndexAny(note, "0123456789-"); i > 0 {
+		name, digits = note[:i], note[i:]
+	}
+	s := slices.Index(noteNames[:], name)
+	octave, err := strconv.Atoi(digits)
+	if s < 0 || err != nil || octave < 0 || octave > 9 {
+		return 0, fmt.Errorf("invalid note %q, want a name and octave like C4 or F#2", note)
 	}
+	return (octave+1)*12 + s, nil
+}
 
-	return samples
+// NoteName returns the name and octave of a MIDI note number, like C4 for
+// 60.
+func NoteName(midi int) string {
+	return noteNames[(midi%12+12)%12] + strconv.Itoa(midi/12-1)
 }
 
 // MIDIToFreq converts a MIDI note number to frequency in Hz.
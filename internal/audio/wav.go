@@ -1,25 +1,30 @@
 package audio
 
 import (
+	"bufio"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"math"
-	"os"
-	"path/filepath"
+
+	"github.com/vgalaktionov/runefact/internal/atomicfile"
 )
 
-// WriteWAV writes float64 samples as a PCM WAV file.
+// WriteWAV writes float64 samples as a PCM WAV file. The file is replaced
+// atomically, so an interrupted write leaves the old file, if any.
 func WriteWAV(path string, samples []float64, sampleRate, bitDepth int) error {
-	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
-		return fmt.Errorf("creating output directory: %w", err)
-	}
-
-	f, err := os.Create(path)
+	err := atomicfile.Write(path, 0644, func(w io.Writer) error {
+		return encodeWAV(w, samples, sampleRate, bitDepth)
+	})
 	if err != nil {
-		return fmt.Errorf("creating WAV file: %w", err)
+		return fmt.Errorf("writing WAV file: %w", err)
 	}
-	defer f.Close()
+	return nil
+}
 
+// encodeWAV writes samples to w as a PCM WAV file.
+func encodeWAV(w io.Writer, samples []float64, sampleRate, bitDepth int) error {
+	f := bufio.NewWriter(w)
 	channels := 1
 	bytesPerSample := bitDepth / 8
 	dataSize := len(samples) * bytesPerSample
@@ -68,5 +73,5 @@ func WriteWAV(path string, samples []float64, sampleRate, bitDepth int) error {
 		}
 	}
 
-	return nil
+	return f.Flush()
 }
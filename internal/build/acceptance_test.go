@@ -4,12 +4,15 @@ import (
 	"encoding/json"
 	"image"
 	_ "image/png"
+	"math"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/vgalaktionov/runefact/internal/config"
+	"github.com/vgalaktionov/runefact/internal/manifest"
+	"github.com/vgalaktionov/runefact/internal/scaffold"
 )
 
 // TestAcceptance_InitAndBuild verifies that `runefact init` output builds
@@ -100,6 +103,55 @@ func TestAcceptance_SpriteSheetDimensions(t *testing.T) {
 	}
 }
 
+// The sheet layout options change the sheet's size and the coordinates the
+// manifest gives for each sprite.
+func TestAcceptance_SheetLayout(t *testing.T) {
+	tests := []struct {
+		layout string
+		pot    bool
+		w, h   int
+		coin   string
+	}{
+		{"rows", false, 64, 64, `"player:coin": {SpriteSheetPlayer, 0, 32, 16, 16,`},
+		{"grid", false, 128, 96, `"player:coin": {SpriteSheetPlayer, 0, 32, 32, 32,`},
+		{"grid", true, 128, 128, `"player:coin": {SpriteSheetPlayer, 0, 32, 32, 32,`},
+		{"packed", true, 64, 64, `"player:coin": {SpriteSheetPlayer, 0, 32, 16, 16,`},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		writeScaffoldProject(t, dir, "test")
+		cfg, err := config.LoadConfig(filepath.Join(dir, "runefact.toml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.Project.SheetLayout, cfg.Project.POT = tt.layout, tt.pot
+
+		result := Build(Options{Scope: ScopeSprites}, cfg, dir)
+		if len(result.Errors) > 0 {
+			t.Fatalf("%s: %v", tt.layout, result.Errors)
+		}
+		f, err := os.Open(filepath.Join(dir, "build/assets/sprites/player.png"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		imgCfg, _, err := image.DecodeConfig(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if imgCfg.Width != tt.w || imgCfg.Height != tt.h {
+			t.Errorf("%s pot=%v: sheet is %dx%d, want %dx%d", tt.layout, tt.pot, imgCfg.Width, imgCfg.Height, tt.w, tt.h)
+		}
+		manifest, err := os.ReadFile(result.ManifestPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(manifest), tt.coin) {
+			t.Errorf("%s pot=%v: manifest lacks %s", tt.layout, tt.pot, tt.coin)
+		}
+	}
+}
+
 // TestAcceptance_MapJSONStructure verifies JSON output is valid and has layers.
 func TestAcceptance_MapJSONStructure(t *testing.T) {
 	dir := t.TempDir()
@@ -169,6 +221,59 @@ func TestAcceptance_AudioWAVHeaders(t *testing.T) {
 	}
 }
 
+// TestAcceptance_AudioNameCollision verifies that an sfx and a track with
+// the same name are an error unless audio_subdirs separates their WAVs.
+func TestAcceptance_AudioNameCollision(t *testing.T) {
+	dir := t.TempDir()
+	writeScaffoldProject(t, dir, "test")
+	demo, err := os.ReadFile(filepath.Join(dir, "assets/tracks/demo.track"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "assets/tracks/jump.track"), demo, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := config.LoadConfig(filepath.Join(dir, "runefact.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := Build(Options{Scope: ScopeAudio}, cfg, dir)
+	if len(result.Errors) != 1 {
+		t.Fatalf("errors = %v, want one collision", result.Errors)
+	}
+	msg := result.Errors[0].Error()
+	for _, want := range []string{"jump.sfx", "jump.track", "audio/jump.wav"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("error %q does not mention %s", msg, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "build/assets/audio/jump.wav")); err == nil {
+		t.Error("audio/jump.wav was written despite the collision")
+	}
+
+	cfg.Project.AudioSubdirs = true
+	result = Build(Options{Scope: ScopeAudio}, cfg, dir)
+	if len(result.Errors) > 0 {
+		t.Fatalf("errors with audio_subdirs: %v", result.Errors)
+	}
+	for _, f := range []string{"audio/sfx/jump.wav", "audio/music/jump.wav", "audio/sfx/coin.wav", "audio/music/demo.wav"} {
+		if _, err := os.Stat(filepath.Join(dir, "build/assets", f)); err != nil {
+			t.Errorf("missing %s: %v", f, err)
+		}
+	}
+	data, err := os.ReadFile(result.ManifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`SFXJump = "audio/sfx/jump.wav"`, `TrackJump = "audio/music/jump.wav"`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("manifest missing %s", want)
+		}
+	}
+}
+
 // TestAcceptance_ManifestContent verifies manifest.go is valid Go.
 func TestAcceptance_ManifestContent(t *testing.T) {
 	dir := t.TempDir()
@@ -201,6 +306,83 @@ func TestAcceptance_ManifestContent(t *testing.T) {
 	}
 }
 
+// TestAcceptance_ManifestJSON verifies manifest.json is written when enabled
+// and mirrors the Go manifest.
+func TestAcceptance_ManifestJSON(t *testing.T) {
+	dir := t.TempDir()
+	writeScaffoldProject(t, dir, "test")
+
+	cfg, err := config.LoadConfig(filepath.Join(dir, "runefact.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Project.ManifestJSON = true
+
+	result := Build(Options{}, cfg, dir)
+	if len(result.Errors) > 0 {
+		for _, e := range result.Errors {
+			t.Errorf("error: %v", e)
+		}
+		t.Fatal("build failed")
+	}
+
+	path := filepath.Join(dir, "build", "assets", "manifest.json")
+	found := false
+	for _, a := range result.Artifacts {
+		if a == path {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("manifest.json not in artifacts: %v", result.Artifacts)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading manifest.json: %v", err)
+	}
+	var jm manifest.JSONManifest
+	if err := json.Unmarshal(data, &jm); err != nil {
+		t.Fatalf("parsing manifest.json: %v", err)
+	}
+
+	sheets := map[string]bool{}
+	for _, s := range jm.Sheets {
+		sheets[s.Name] = true
+		if _, err := os.Stat(filepath.Join(dir, "build", "assets", s.Path)); err != nil {
+			t.Errorf("sheet %s: path %q not relative to output: %v", s.Name, s.Path, err)
+		}
+	}
+	for _, name := range []string{"player", "tiles"} {
+		if !sheets[name] {
+			t.Errorf("missing sheet %q", name)
+		}
+	}
+	if len(jm.Maps) != 1 || jm.Maps[0].Name != "level1" {
+		t.Errorf("maps = %+v, want level1", jm.Maps)
+	}
+	kinds := map[string]string{}
+	for _, a := range jm.Audio {
+		kinds[a.Name] = a.Kind
+
+		// The duration is worked out without rendering but must match the
+		// WAV: 44 header bytes, then mono samples.
+		info, err := os.Stat(filepath.Join(dir, "build", "assets", a.Path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		wavSeconds := float64(info.Size()-44) / float64(cfg.Defaults.BitDepth/8) / float64(cfg.Defaults.SampleRate)
+		if a.DurationSeconds <= 0 || math.Abs(a.DurationSeconds-wavSeconds) > 0.01 {
+			t.Errorf("audio %q duration_seconds = %v, WAV is %vs", a.Name, a.DurationSeconds, wavSeconds)
+		}
+	}
+	for name, kind := range map[string]string{"jump": "sfx", "coin": "sfx", "demo": "track"} {
+		if kinds[name] != kind {
+			t.Errorf("audio %q kind = %q, want %q", name, kinds[name], kind)
+		}
+	}
+}
+
 // TestAcceptance_ValidateInitProject verifies validation passes for init output.
 func TestAcceptance_ValidateInitProject(t *testing.T) {
 	dir := t.TempDir()
@@ -221,533 +403,54 @@ func TestAcceptance_ValidateInitProject(t *testing.T) {
 	}
 }
 
+// TestAcceptance_Templates verifies every init template builds without
+// errors or warnings.
+func TestAcceptance_Templates(t *testing.T) {
+	for _, tmpl := range scaffold.Names() {
+		t.Run(tmpl, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTemplateProject(t, dir, tmpl, "test")
+
+			cfg, err := config.LoadConfig(filepath.Join(dir, "runefact.toml"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			result := Build(Options{}, cfg, dir)
+			for _, e := range result.Errors {
+				t.Errorf("build error: %v", e)
+			}
+			for _, w := range result.Warnings {
+				t.Errorf("build warning: %s", w)
+			}
+			if result.ManifestPath == "" {
+				t.Error("manifest path not set")
+			}
+		})
+	}
+}
+
 // writeScaffoldProject writes the same files as `runefact init`.
 func writeScaffoldProject(t *testing.T, dir, name string) {
 	t.Helper()
+	writeTemplateProject(t, dir, scaffold.Default, name)
+}
 
-	dirs := []string{
-		"assets/palettes", "assets/sprites", "assets/maps",
-		"assets/instruments", "assets/sfx", "assets/tracks",
-	}
-	for _, d := range dirs {
+// writeTemplateProject writes the files of an init template.
+func writeTemplateProject(t *testing.T, dir, tmpl, name string) {
+	t.Helper()
+
+	for _, d := range scaffold.Dirs {
 		if err := os.MkdirAll(filepath.Join(dir, d), 0755); err != nil {
 			t.Fatal(err)
 		}
 	}
-
-	files := map[string]string{
-		"runefact.toml": `[project]
-name = "` + name + `"
-output = "build/assets"
-package = "assets"
-
-[defaults]
-sprite_size = 16
-sample_rate = 44100
-bit_depth = 16
-
-[preview]
-window_width = 1200
-window_height = 900
-background = "#1a1a2e"
-pixel_scale = 4
-audio_volume = 0.5
-`,
-		"assets/palettes/default.palette": `name = "default"
-
-[colors]
-_ = "transparent"
-k = "#000000"
-w = "#ffffff"
-r = "#ff004d"
-b = "#29adff"
-g = "#00e436"
-d = "#1d2b53"
-s = "#ffccaa"
-h = "#ab5236"
-y = "#ffec27"
-o = "#ffa300"
-p = "#7e2553"
-l = "#83769c"
-c = "#008751"
-e = "#5f574f"
-f = "#c2c3c7"
-`,
-		"assets/sprites/player.sprite": `palette = "default"
-grid = 32
-
-palette_extend = { "n" = "#1a1a2e", "t" = "#e8d4b8" }
-
-[sprite.idle]
-framerate = 3
-
-[[sprite.idle.frame]]
-pixels = """
-________________________________
-_____________hhhhh______________
-___________hhhhhhhhh____________
-__________hhhhhhhhhh____________
-__________hhhhhhhhhh____________
-__________dddddddddd____________
-_________dddddddddddd___________
-_________dddwkddwkddd___________
-_________dddkkddkkddd___________
-_________ddttttttttdd___________
-_________dddttttttddd___________
-__________dtttsttttd____________
-__________ddttttttdd____________
-___________dddddddd_____________
-___________bbbbbbbbb____________
-__________bbbblbbbbbb___________
-_________bbbbbbbbbbbbb__________
-________sbbbbbbbbbbbbbs_________
-________s_bbbbbbbbbbb_s_________
-__________bbbbbbbbbbb___________
-___________bbb___bbb____________
-___________bbb___bbb____________
-___________bbb___bbb____________
-__________nnnn___nnnn___________
-__________nnnn___nnnn___________
-________________________________
-________________________________
-________________________________
-________________________________
-________________________________
-________________________________
-________________________________
-"""
-
-[[sprite.idle.frame]]
-pixels = """
-________________________________
-_____________hhhhh______________
-___________hhhhhhhhh____________
-__________hhhhhhhhhh____________
-__________hhhhhhhhhh____________
-__________dddddddddd____________
-_________dddddddddddd___________
-_________dddwkddwkddd___________
-_________dddkkddkkddd___________
-_________ddttttttttdd___________
-_________dddttttttddd___________
-__________dtttsttttd____________
-__________ddttttttdd____________
-___________dddddddd_____________
-___________bbbbbbbbb____________
-__________bbbblbbbbbb___________
-_________bbbbbbbbbbbbb__________
-________sbbbbbbbbbbbbbs_________
-________s_bbbbbbbbbbb_s_________
-__________bbbbbbbbbbb___________
-___________bbb___bbb____________
-___________bbb___bbb____________
-__________nbbb___bbbn___________
-__________nnnn___nnnn___________
-___________nn_____nn____________
-________________________________
-________________________________
-________________________________
-________________________________
-________________________________
-________________________________
-________________________________
-"""
-
-[sprite.coin]
-grid = 16
-framerate = 6
-
-[[sprite.coin.frame]]
-pixels = """
-_____yyyy_______
-___yyooooyyy____
-__yooyyyyyooy___
-__yoyyyyyyyyoy__
-__yoyyyy_yyyoy__
-__yoyyyyyyyyoy__
-__yoyyyyyyyyoy__
-__yoyyyyyyyyoy__
-___yooooooooy___
-____yyyyyyyy____
-________________
-________________
-________________
-________________
-________________
-________________
-"""
-
-[[sprite.coin.frame]]
-pixels = """
-______yy________
-_____yooy_______
-____yoyyoy______
-____yoy_oy______
-____yoyyoy______
-____yoyyoy______
-____yoyyoy______
-_____yooy_______
-______yy________
-________________
-________________
-________________
-________________
-________________
-________________
-________________
-"""
-
-[[sprite.coin.frame]]
-pixels = """
-_______y________
-______yoy_______
-______yoy_______
-______yoy_______
-______yoy_______
-______yoy_______
-______yoy_______
-_______y________
-________________
-________________
-________________
-________________
-________________
-________________
-________________
-________________
-"""
-
-[[sprite.coin.frame]]
-pixels = """
-______yy________
-_____yooy_______
-____yoyyoy______
-____yoy_oy______
-____yoyyoy______
-____yoyyoy______
-____yoyyoy______
-_____yooy_______
-______yy________
-________________
-________________
-________________
-________________
-________________
-________________
-________________
-"""
-
-[sprite.heart]
-grid = 16
-pixels = """
-________________
-___rr____rr_____
-__rrrr__rrrr____
-_rrrrrrrrrrrr___
-_rrrrrrrrrrrr___
-_rrrrrrrrrrrr___
-__rrrrrrrrrr____
-___rrrrrrrr_____
-____rrrrrr______
-_____rrrr_______
-______rr________
-________________
-________________
-________________
-________________
-________________
-"""
-`,
-		"assets/sprites/tiles.sprite": `palette = "default"
-grid = 16
-
-[sprite.grass]
-pixels = """
-ccggccggccggccgg
-ggccggccggccggcc
-ccgcgcgcgcgcgccc
-gcccccggccccccgc
-ccchccccchccccch
-hchhhhhchhhhhchh
-hhhhhhhhhhhhhhhh
-hhehhhhhehhhhehh
-hhhhhhhhhhhhhhhh
-hhehhhhhhhehhhhh
-hhhhhhhhhhhhhhhh
-hhhhhhehhhhhhhhh
-hhehhhhhhhhhhehh
-hhhhhhhhhhhhhhhh
-hhhhhhehhhhhhhhh
-hhhhhhhhhhhhhhhh
-"""
-
-[sprite.dirt]
-pixels = """
-hhhhhhhhhhhhhhhh
-hhehhhhhehhhhehh
-hhhhhhhhhhhhhhhh
-hhhhhhehhhhhhhhh
-hhehhhhhhhehhhhh
-hhhhhhhhhhhhhhhh
-hhhhhhehhhhhhhhh
-hhhhhhhhhhhhhhhh
-hhehhhhhehhhhehh
-hhhhhhhhhhhhhhhh
-hhhhhhehhhhhhhhh
-hhehhhhhhhehhhhh
-hhhhhhhhhhhhhhhh
-hhhhhhehhhhhhhhh
-hhhhhhhhhhhhhhhh
-hhehhhhhehhhhehh
-"""
-
-[sprite.stone]
-pixels = """
-eeffffffeeffffff
-flllllfeflllllfe
-flllflfefllflffe
-flllllfeflllllfe
-eeffffffeeffffff
-feflllleefellllf
-fefllfleefelfllf
-feflllleefellllf
-eeffffffeeffffff
-flllllfeflllllfe
-flllflfefllflffe
-flllllfeflllllfe
-eeffffffeeffffff
-feflllleefellllf
-fefllfleefelfllf
-feflllleefellllf
-"""
-
-[sprite.sky]
-pixels = """
-bbbbbbbbbbbbbbbb
-bbbbbbbbbbbbbbbb
-bbbbbbbbbbbbbbbb
-bbbbbbbbbbbbbbbb
-bbbbbbbbbbbbbbbb
-bbbbbbbbbbbbbbbb
-bbbbbbbbbbbbbbbb
-bbbbbbbbbbbbbbbb
-bbbbbbbbbbbbbbbb
-bbbbbbbbbbbbbbbb
-bbbbbbbbbbbbbbbb
-bbbbbbbbbbbbbbbb
-bbbbbbbbbbbbbbbb
-bbbbbbbbbbbbbbbb
-bbbbbbbbbbbbbbbb
-bbbbbbbbbbbbbbbb
-"""
-`,
-		"assets/maps/level1.map": `tile_size = 16
-
-[tileset]
-_ = ""
-g = "tiles:grass"
-d = "tiles:dirt"
-s = "tiles:stone"
-b = "tiles:sky"
-
-[layer.background]
-scroll_x = 0.5
-pixels = """
-bbbbbbbbbbbbbbbb
-bbbbbbbbbbbbbbbb
-bbbbbbbbbbbbbbbb
-bbbbbbbbbbbbbbbb
-bbbbbbbbbbbbbbbb
-bbbbbbbbbbbbbbbb
-bbbbbbbbbbbbbbbb
-bbbbbbbbbbbbbbbb
-bbbbbbbbbbbbbbbb
-bbbbbbbbbbbbbbbb
-"""
-
-[layer.main]
-pixels = """
-________________
-________________
-________________
-________________
-_______sss______
-________________
-__gg_______gg___
-__dd_______dd___
-gggggggggggggggg
-dddddddddddddddd
-"""
-
-[layer.entities]
-
-[[layer.entities.entity]]
-type = "spawn"
-x = 2
-y = 7
-[layer.entities.entity.properties]
-sprite = "player:idle"
-
-[[layer.entities.entity]]
-type = "coin"
-x = 4
-y = 5
-[layer.entities.entity.properties]
-sprite = "player:coin"
-
-[[layer.entities.entity]]
-type = "coin"
-x = 8
-y = 3
-[layer.entities.entity.properties]
-sprite = "player:coin"
-
-[[layer.entities.entity]]
-type = "coin"
-x = 11
-y = 5
-[layer.entities.entity.properties]
-sprite = "player:coin"
-
-[[layer.entities.entity]]
-type = "enemy"
-x = 13
-y = 7
-[layer.entities.entity.properties]
-sprite = "player:heart"
-`,
-		"assets/instruments/lead.inst": `name = "lead"
-
-[oscillator]
-waveform = "square"
-duty_cycle = 0.5
-
-[envelope]
-attack = 0.01
-decay = 0.1
-sustain = 0.6
-release = 0.2
-
-[filter]
-type = "lowpass"
-cutoff = 2000
-resonance = 0.2
-`,
-		"assets/instruments/bass.inst": `name = "bass"
-
-[oscillator]
-waveform = "triangle"
-
-[envelope]
-attack = 0.005
-decay = 0.15
-sustain = 0.5
-release = 0.1
-`,
-		"assets/sfx/jump.sfx": `duration = 0.2
-volume = 0.7
-
-[[voice]]
-waveform = "square"
-duty_cycle = 0.5
-
-[voice.envelope]
-attack = 0.0
-decay = 0.08
-sustain = 0.2
-release = 0.12
-
-[voice.pitch]
-start = 220
-end = 660
-curve = "exponential"
-`,
-		"assets/sfx/coin.sfx": `duration = 0.12
-volume = 0.6
-
-[[voice]]
-waveform = "square"
-duty_cycle = 0.25
-
-[voice.envelope]
-attack = 0.0
-decay = 0.03
-sustain = 0.4
-release = 0.09
-
-[voice.pitch]
-start = 880
-end = 1320
-curve = "linear"
-`,
-		"assets/tracks/demo.track": `tempo = 140
-ticks_per_beat = 4
-loop = true
-loop_start = 0
-
-[[channel]]
-name = "melody"
-instrument = "lead"
-volume = 0.7
-
-[[channel]]
-name = "bass"
-instrument = "bass"
-volume = 0.6
-
-[pattern.intro]
-ticks = 16
-data = """
-melody  | bass
-C4      | C2
----     | ---
-E4      | ---
----     | ---
-G4      | G2
----     | ---
-E4      | ---
----     | ---
-A4      | A2
----     | ---
-G4      | ---
----     | ---
-E4      | E2
----     | ---
-D4      | ---
----     | ---
-"""
-
-[pattern.verse]
-ticks = 16
-data = """
-melody  | bass
-E4      | A2
----     | ---
-D4      | ---
----     | ---
-C4      | F2
----     | ---
-D4      | ---
----     | ---
-E4      | G2
----     | ---
-E4      | ---
----     | ---
-E4      | C2
----     | ---
-^^^     | ---
-...     | ^^^
-"""
-
-[song]
-sequence = ["intro", "verse", "intro", "verse"]
-`,
-	}
-
-	for path, content := range files {
-		fullPath := filepath.Join(dir, path)
-		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
-			t.Fatalf("writing %s: %v", path, err)
+	files, err := scaffold.Files(tmpl, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		if err := os.WriteFile(filepath.Join(dir, f.Path), []byte(f.Content), 0644); err != nil {
+			t.Fatalf("writing %s: %v", f.Path, err)
 		}
 	}
 }
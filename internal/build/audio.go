@@ -0,0 +1,137 @@
+package build
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/vgalaktionov/runefact/internal/instrument"
+	"github.com/vgalaktionov/runefact/internal/manifest"
+	"github.com/vgalaktionov/runefact/internal/track"
+)
+
+// audioRelPath returns where an .sfx or .track file's WAV is written,
+// relative to the output directory: audio/<name>.wav, or under audio/sfx
+// and audio/music with [project] audio_subdirs.
+func audioRelPath(file string, subdirs bool) string {
+	ext := filepath.Ext(file)
+	name := strings.TrimSuffix(filepath.Base(file), ext) + ".wav"
+	switch {
+	case !subdirs:
+		return filepath.Join("audio", name)
+	case ext == ".track":
+		return filepath.Join("audio", "music", name)
+	default:
+		return filepath.Join("audio", "sfx", name)
+	}
+}
+
+// audioOutput is a WAV an .sfx or .track file is written to.
+type audioOutput struct {
+	Rel     string // relative to the output directory
+	Const   string // the manifest constant
+	Pattern string // the track pattern rendered alone; empty for the whole file
+}
+
+// audioOutputs returns the WAVs file is written to: the sound or song,
+// and a track's export_patterns, which are written like .sfx files. tr is
+// the parsed track of a .track file, or nil to load it; a track that
+// doesn't load gives just its song, as the build reports it anyway.
+func audioOutputs(file string, tr *track.Track, subdirs bool) []audioOutput {
+	base := filepath.Base(file)
+	song := audioOutput{Rel: audioRelPath(file, subdirs), Const: manifest.AudioConst(base)}
+	if filepath.Ext(file) != ".track" {
+		return []audioOutput{song}
+	}
+	if tr == nil {
+		var err error
+		if tr, err = track.LoadTrack(file); err != nil {
+			return []audioOutput{song}
+		}
+	}
+	var outs []audioOutput
+	if tr.ExportFull {
+		outs = append(outs, song)
+	}
+	for _, p := range tr.ExportPatterns {
+		sfxName := manifest.PatternAudioName(base, p) + ".sfx"
+		outs = append(outs, audioOutput{Rel: audioRelPath(sfxName, subdirs), Const: manifest.AudioConst(sfxName), Pattern: p})
+	}
+	return outs
+}
+
+// reportAudioCollisions reports sfx and tracks that would write the same
+// WAV, such as jump.sfx and jump.track, or jingles.track exporting its
+// pattern victory next to jingles_victory.sfx, and returns the files involved so
+// the build can skip them rather than let one overwrite the other. A
+// partial build checks its files against every other, so rebuilding
+// jump.track alone can't clobber jump.sfx's output either, but collisions
+// between two files it doesn't touch are left for a full build. Files from
+// included projects are checked too, as their WAVs go to the same place.
+func (r *Result) reportAudioCollisions(assetsDirs []string, subdirs bool, filter []string) map[string]bool {
+	type owner struct {
+		file    string
+		pattern string
+	}
+	owners := map[string]owner{}
+	collided := map[string]bool{}
+	sfxFiles, _ := searchFiles(assetsDirs, "sfx", ".sfx", nil)
+	trackFiles, _ := searchFiles(assetsDirs, "tracks", ".track", nil)
+	files := slices.Concat(sfxFiles, trackFiles)
+	for _, f := range files {
+		for _, out := range audioOutputs(f, nil, subdirs) {
+			o, ok := owners[out.Rel]
+			if !ok {
+				owners[out.Rel] = owner{f, out.Pattern}
+				continue
+			}
+			prev := o.file
+			if len(filter) > 0 && !matchesFilter(f, filepath.Base(f), filter) && !matchesFilter(prev, filepath.Base(prev), filter) {
+				continue
+			}
+			// Subdirectories separate an .sfx from a .track, but a pattern
+			// export goes with the sound effects.
+			fix := "rename one"
+			if !subdirs && out.Pattern == "" && o.pattern == "" && filepath.Ext(f) != filepath.Ext(prev) {
+				fix += " or set [project] audio_subdirs = true"
+			}
+			r.addError(f, fmt.Errorf("%s: would write %s, as does %s; %s",
+				f, filepath.ToSlash(out.Rel), prev, fix))
+			collided[prev] = true
+			collided[f] = true
+		}
+	}
+	return collided
+}
+
+// loadInstruments loads every instrument in the assets directories, the
+// first of each name winning as in a build. Files that fail to parse are
+// skipped; validation reports them.
+func loadInstruments(assetsDirs []string) map[string]*instrument.Instrument {
+	instruments := map[string]*instrument.Instrument{}
+	for _, dir := range assetsDirs {
+		for name, inst := range instrument.LoadDir(filepath.Join(dir, "instruments")) {
+			if _, ok := instruments[name]; !ok {
+				instruments[name] = inst
+			}
+		}
+	}
+	return instruments
+}
+
+// reportNoteRanges warns about notes a track plays outside the range its
+// instruments declare.
+func (r *Result) reportNoteRanges(file string, tr *track.Track, instruments map[string]*instrument.Instrument) {
+	for _, w := range tr.CheckRanges(instruments) {
+		r.addWarning(file, fmt.Sprintf("%s: %s", filepath.Base(file), w))
+	}
+}
+
+// reportLoopSeam warns if a looping track's render, samples, clicks where
+// it wraps back to the loop start.
+func (r *Result) reportLoopSeam(file string, tr *track.Track, samples []float64, sampleRate int) {
+	if w := tr.CheckLoopSeam(samples, sampleRate); w != "" {
+		r.addWarning(file, fmt.Sprintf("%s: %s", filepath.Base(file), w))
+	}
+}
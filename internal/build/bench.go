@@ -0,0 +1,170 @@
+package build
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"slices"
+	"time"
+
+	"github.com/vgalaktionov/runefact/internal/config"
+)
+
+// BenchReport summarizes repeated full builds of a project. Durations are
+// in nanoseconds in JSON, so a saved report can be compared against later.
+type BenchReport struct {
+	Runs   int          `json:"runs"`
+	Phases []PhaseStats `json:"phases"`
+	Total  PhaseStats   `json:"total"`
+
+	// AllocBytes and Allocs are the median heap bytes and objects
+	// allocated by one build.
+	AllocBytes uint64 `json:"alloc_bytes"`
+	Allocs     uint64 `json:"allocs"`
+}
+
+// PhaseStats are the fastest and median times of a build phase.
+type PhaseStats struct {
+	Name   string        `json:"name"`
+	Min    time.Duration `json:"min_ns"`
+	Median time.Duration `json:"median_ns"`
+}
+
+// Bench builds the project runs times and reports the timing of each
+// phase. Every run writes to a fresh temporary directory, so nothing is
+// reused between runs and the project's own output and build record are
+// left alone. A build error stops the benchmark.
+func Bench(runs int, cfg *config.ProjectConfig, projectRoot string) (*BenchReport, error) {
+	if runs < 1 {
+		return nil, fmt.Errorf("runs must be at least 1")
+	}
+
+	var phases [][]PhaseTime
+	var totals []time.Duration
+	var bytes, objects []uint64
+	for range runs {
+		out, err := os.MkdirTemp("", "runefact-bench-")
+		if err != nil {
+			return nil, err
+		}
+
+		runtime.GC()
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		start := time.Now()
+		result := Build(Options{OutputDir: out, NoRecord: true}, cfg, projectRoot)
+		total := time.Since(start)
+		runtime.ReadMemStats(&after)
+		os.RemoveAll(out)
+
+		if len(result.Errors) > 0 {
+			return nil, fmt.Errorf("build failed, fix it before benchmarking:\n%w", errors.Join(result.Errors...))
+		}
+		phases = append(phases, result.Phases)
+		totals = append(totals, total)
+		bytes = append(bytes, after.TotalAlloc-before.TotalAlloc)
+		objects = append(objects, after.Mallocs-before.Mallocs)
+	}
+
+	report := &BenchReport{
+		Runs:       runs,
+		Total:      stats("total", totals),
+		AllocBytes: median(bytes),
+		Allocs:     median(objects),
+	}
+	for i, p := range phases[0] {
+		times := make([]time.Duration, runs)
+		for r := range phases {
+			times[r] = phases[r][i].Duration
+		}
+		report.Phases = append(report.Phases, stats(p.Name, times))
+	}
+	return report, nil
+}
+
+func stats(name string, times []time.Duration) PhaseStats {
+	return PhaseStats{Name: name, Min: slices.Min(times), Median: median(times)}
+}
+
+// median returns the middle value, or the lower of the two middle values
+// for an even count.
+func median[T time.Duration | uint64](vs []T) T {
+	sorted := slices.Clone(vs)
+	slices.Sort(sorted)
+	return sorted[(len(sorted)-1)/2]
+}
+
+// benchFloor is the smallest baseline median CompareBench checks. Shorter
+// phases vary more from run to run than they could regress.
+const benchFloor = time.Millisecond
+
+// CompareBench returns a line for every median in report that is more than
+// threshold percent above the same median in base: the phases, the total
+// and the allocated bytes. Phases whose baseline median is under a
+// millisecond are skipped as noise.
+func CompareBench(base, report *BenchReport, threshold float64) []string {
+	var regressions []string
+	check := func(name string, was, now float64, format func(float64) string) {
+		if was <= 0 {
+			return
+		}
+		if pct := (now - was) / was * 100; pct > threshold {
+			regressions = append(regressions, fmt.Sprintf("%s: %s -> %s (+%.0f%%)", name, format(was), format(now), pct))
+		}
+	}
+	duration := func(v float64) string { return FormatDuration(time.Duration(v)) }
+
+	for _, p := range slices.Concat(report.Phases, []PhaseStats{report.Total}) {
+		was := base.Total
+		if p.Name != "total" {
+			i := slices.IndexFunc(base.Phases, func(b PhaseStats) bool { return b.Name == p.Name })
+			if i < 0 {
+				continue
+			}
+			was = base.Phases[i]
+		}
+		if was.Median < benchFloor {
+			continue
+		}
+		check(p.Name, float64(was.Median), float64(p.Median), duration)
+	}
+	check("allocated", float64(base.AllocBytes), float64(report.AllocBytes), FormatBytes)
+	return regressions
+}
+
+// LoadBenchReport reads a report saved with SaveBenchReport.
+func LoadBenchReport(path string) (*BenchReport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var r BenchReport
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &r, nil
+}
+
+// SaveBenchReport writes r as indented JSON.
+func SaveBenchReport(path string, r *BenchReport) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// FormatDuration prints d in milliseconds with two decimals.
+func FormatDuration(d time.Duration) string {
+	return fmt.Sprintf("%.2fms", float64(d)/float64(time.Millisecond))
+}
+
+// FormatBytes prints n bytes in KiB or MiB.
+func FormatBytes(n float64) string {
+	if n >= 1<<20 {
+		return fmt.Sprintf("%.1f MiB", n/(1<<20))
+	}
+	return fmt.Sprintf("%.1f KiB", n/(1<<10))
+}
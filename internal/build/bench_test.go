@@ -0,0 +1,95 @@
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBench(t *testing.T) {
+	dir, cfg := setupDemoProject(t)
+
+	report, err := Bench(3, cfg, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, p := range report.Phases {
+		names = append(names, p.Name)
+		if p.Min > p.Median {
+			t.Errorf("%s: min %v above median %v", p.Name, p.Min, p.Median)
+		}
+	}
+	if want := []string{"palettes", "sprites", "maps", "instruments", "audio", "manifest"}; !slices.Equal(names, want) {
+		t.Errorf("phases = %q, want %q", names, want)
+	}
+	if report.Runs != 3 || report.Total.Median <= 0 || report.AllocBytes == 0 {
+		t.Errorf("report = %+v, want 3 runs with times and allocations", report)
+	}
+
+	// The project's output and build record are left alone.
+	for _, f := range []string{"build", ".runefact/last_build.json"} {
+		if _, err := os.Stat(filepath.Join(dir, f)); err == nil {
+			t.Errorf("bench wrote %s", f)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "bench.json")
+	if err := SaveBenchReport(path, report); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadBenchReport(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Total != report.Total || !slices.Equal(loaded.Phases, report.Phases) {
+		t.Errorf("loaded %+v, want %+v", loaded, report)
+	}
+}
+
+func TestBench_BuildError(t *testing.T) {
+	dir, cfg := setupDemoProject(t)
+	os.WriteFile(filepath.Join(dir, "assets/sprites/demo.sprite"), []byte("grid = \n"), 0644)
+
+	if _, err := Bench(1, cfg, dir); err == nil || !strings.Contains(err.Error(), "build failed") {
+		t.Errorf("err = %v, want a build failure", err)
+	}
+}
+
+func TestCompareBench(t *testing.T) {
+	ms := time.Millisecond
+	base := &BenchReport{
+		Phases: []PhaseStats{
+			{Name: "sprites", Median: 10 * ms},
+			{Name: "maps", Median: 100 * time.Microsecond},
+			{Name: "audio", Median: 20 * ms},
+		},
+		Total:      PhaseStats{Name: "total", Median: 40 * ms},
+		AllocBytes: 1 << 20,
+	}
+	report := &BenchReport{
+		Phases: []PhaseStats{
+			{Name: "sprites", Median: 13 * ms},             // +30%
+			{Name: "maps", Median: 300 * time.Microsecond}, // under the floor
+			{Name: "audio", Median: 21 * ms},               // +5%
+			{Name: "new", Median: 50 * ms},                 // not in the baseline
+		},
+		Total:      PhaseStats{Name: "total", Median: 44 * ms}, // +10%
+		AllocBytes: 2 << 20,
+	}
+
+	got := CompareBench(base, report, 10)
+	want := []string{
+		"sprites: 10.00ms -> 13.00ms (+30%)",
+		"allocated: 1.0 MiB -> 2.0 MiB (+100%)",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("regressions = %q, want %q", got, want)
+	}
+	if got := CompareBench(base, report, 200); len(got) != 0 {
+		t.Errorf("threshold 200%%: got %q, want none", got)
+	}
+}
@@ -0,0 +1,157 @@
+package build
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/vgalaktionov/runefact/internal/atomicfile"
+	"github.com/vgalaktionov/runefact/internal/config"
+)
+
+// SizeReport is the size of the output directory after a build and how it
+// compares with the [budgets] limits. It is part of the build record and
+// the MCP build response, so CI can track it over time.
+type SizeReport struct {
+	TotalBytes int64          `json:"total_bytes"`
+	Budgets    []BudgetResult `json:"budgets,omitempty"`
+}
+
+// BudgetResult is one [budgets] limit checked against the output.
+type BudgetResult struct {
+	Name       string `json:"name"` // config key, such as "audio_total"
+	LimitBytes int64  `json:"limit_bytes"`
+	// SizeBytes is the total for a total budget, or the largest file for a
+	// per-file one.
+	SizeBytes int64 `json:"size_bytes"`
+	OK        bool  `json:"ok"`
+	// Files lists the files over a per-file budget, or the largest files
+	// counted toward a total budget that is exceeded.
+	Files []FileSize `json:"files,omitempty"`
+}
+
+// FileSize is an output file, relative to the output directory, and its
+// size.
+type FileSize struct {
+	Path  string `json:"path"`
+	Bytes int64  `json:"bytes"`
+}
+
+// largestShown is how many of the largest files an exceeded total budget
+// names.
+const largestShown = 3
+
+// budgetScope reports which output files count toward a budget, and
+// whether the budget applies to each file or to their total.
+func budgetScope(name, rel string) (counts, perFile bool) {
+	switch name {
+	case "sprite_sheet":
+		return strings.HasPrefix(rel, "sprites/") && !strings.HasPrefix(rel, "sprites/frames/") && path.Ext(rel) == ".png", true
+	case "sprite_total":
+		return strings.HasPrefix(rel, "sprites/"), false
+	case "map":
+		return strings.HasPrefix(rel, "maps/") && path.Ext(rel) == ".json", true
+	case "audio_file":
+		return strings.HasPrefix(rel, "audio/") && path.Ext(rel) == ".wav", true
+	case "audio_total":
+		return strings.HasPrefix(rel, "audio/"), false
+	default: // total
+		return true, false
+	}
+}
+
+// checkBudgets measures the output directory and checks it against the
+// [budgets] limits. Going over is a warning, or an error with lint.strict.
+// The whole directory is measured, not only what this build wrote, since
+// that is what ships.
+func (r *Result) checkBudgets(outputDir string, cfg *config.ProjectConfig) {
+	files := outputFiles(outputDir)
+	report := &SizeReport{}
+	for _, f := range files {
+		report.TotalBytes += f.Bytes
+	}
+
+	for _, b := range cfg.Budgets.List() {
+		res := BudgetResult{Name: b.Name, LimitBytes: b.Limit, OK: true}
+		_, perFile := budgetScope(b.Name, "")
+		var counted []FileSize
+		for _, f := range files {
+			if ok, _ := budgetScope(b.Name, f.Path); !ok {
+				continue
+			}
+			counted = append(counted, f)
+			if perFile {
+				res.SizeBytes = max(res.SizeBytes, f.Bytes)
+				if f.Bytes > b.Limit {
+					res.Files = append(res.Files, f)
+				}
+			} else {
+				res.SizeBytes += f.Bytes
+			}
+		}
+
+		switch {
+		case perFile:
+			res.OK = len(res.Files) == 0
+			for _, f := range res.Files {
+				r.reportBudget(filepath.Join(outputDir, filepath.FromSlash(f.Path)), cfg.Lint.Strict,
+					fmt.Sprintf("budgets.%s: %s is %s, over the %s budget",
+						b.Name, f.Path, FormatBytes(float64(f.Bytes)), FormatBytes(float64(b.Limit))))
+			}
+		case res.SizeBytes > b.Limit:
+			res.OK = false
+			res.Files = largest(counted, largestShown)
+			names := make([]string, len(res.Files))
+			for i, f := range res.Files {
+				names[i] = fmt.Sprintf("%s (%s)", f.Path, FormatBytes(float64(f.Bytes)))
+			}
+			r.reportBudget("", cfg.Lint.Strict,
+				fmt.Sprintf("budgets.%s: output is %s, over the %s budget; largest: %s",
+					b.Name, FormatBytes(float64(res.SizeBytes)), FormatBytes(float64(b.Limit)), strings.Join(names, ", ")))
+		}
+		report.Budgets = append(report.Budgets, res)
+	}
+	r.Sizes = report
+}
+
+func (r *Result) reportBudget(file string, strict bool, msg string) {
+	if strict {
+		r.addError(file, errors.New(msg))
+	} else {
+		r.addWarning(file, msg)
+	}
+}
+
+// outputFiles lists the files under dir with their sizes, paths relative
+// to dir with forward slashes, sorted by path.
+func outputFiles(dir string) []FileSize {
+	var files []FileSize
+	filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || atomicfile.IsTemp(p) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return nil
+		}
+		files = append(files, FileSize{Path: filepath.ToSlash(rel), Bytes: info.Size()})
+		return nil
+	})
+	return files
+}
+
+// largest returns the n largest files, largest first.
+func largest(files []FileSize, n int) []FileSize {
+	sorted := slices.Clone(files)
+	slices.SortStableFunc(sorted, func(a, b FileSize) int { return cmp.Compare(b.Bytes, a.Bytes) })
+	return sorted[:min(n, len(sorted))]
+}
@@ -0,0 +1,62 @@
+package build
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuild_Budgets(t *testing.T) {
+	dir, cfg := setupDemoProject(t)
+	cfg.Budgets.AudioFile = "1KB" // blip.wav is 0.05s of 16-bit audio, about 4 KiB
+	cfg.Budgets.AudioTotal = "1KB"
+	cfg.Budgets.Total = "1GB"
+
+	result := Build(Options{}, cfg, dir)
+	if len(result.Errors) > 0 {
+		t.Fatalf("build errors: %v", result.Errors)
+	}
+	if result.Sizes == nil || result.Sizes.TotalBytes == 0 {
+		t.Fatalf("sizes = %+v, want the output measured", result.Sizes)
+	}
+
+	got := map[string]BudgetResult{}
+	for _, b := range result.Sizes.Budgets {
+		got[b.Name] = b
+	}
+	if b := got["audio_file"]; b.OK || len(b.Files) != 2 || b.Files[0].Path != "audio/blip.wav" {
+		t.Errorf("audio_file = %+v, want blip.wav and demo.wav over", b)
+	}
+	if b := got["audio_total"]; b.OK || b.SizeBytes <= b.LimitBytes {
+		t.Errorf("audio_total = %+v, want over", b)
+	}
+	if b := got["total"]; !b.OK || b.SizeBytes != result.Sizes.TotalBytes {
+		t.Errorf("total = %+v, want ok at %d bytes", b, result.Sizes.TotalBytes)
+	}
+
+	all := strings.Join(result.Warnings, "\n")
+	for _, want := range []string{
+		"budgets.audio_file: audio/blip.wav is",
+		"budgets.audio_total: output is",
+		"largest: audio/",
+	} {
+		if !strings.Contains(all, want) {
+			t.Errorf("missing warning %q in:\n%s", want, all)
+		}
+	}
+
+	rec := LoadBuildRecord(dir)
+	if rec == nil || rec.Output == nil || len(rec.Output.Budgets) != 3 {
+		t.Errorf("build record output = %+v, want the budget evaluation", rec)
+	}
+}
+
+func TestBuild_BudgetsStrict(t *testing.T) {
+	dir, cfg := setupDemoProject(t)
+	cfg.Budgets.SpriteSheet = "10B"
+	cfg.Lint.Strict = true
+
+	result := Build(Options{Scope: ScopeSprites}, cfg, dir)
+	if len(result.Errors) != 1 || !strings.Contains(result.Errors[0].Error(), "budgets.sprite_sheet: sprites/demo.png is") {
+		t.Errorf("errors = %v, want sprites/demo.png over budget", result.Errors)
+	}
+}
@@ -1,15 +1,23 @@
 package build
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
+	"github.com/vgalaktionov/runefact/internal/atomicfile"
 	"github.com/vgalaktionov/runefact/internal/audio"
 	"github.com/vgalaktionov/runefact/internal/config"
+	"github.com/vgalaktionov/runefact/internal/diagnostic"
+	"github.com/vgalaktionov/runefact/internal/export"
 	"github.com/vgalaktionov/runefact/internal/instrument"
 	"github.com/vgalaktionov/runefact/internal/manifest"
+	"github.com/vgalaktionov/runefact/internal/pack"
 	"github.com/vgalaktionov/runefact/internal/palette"
 	"github.com/vgalaktionov/runefact/internal/sfx"
 	"github.com/vgalaktionov/runefact/internal/sprite"
@@ -25,13 +33,48 @@ const (
 	ScopeSprites Scope = "sprites"
 	ScopeMaps    Scope = "maps"
 	ScopeAudio   Scope = "audio"
+
+	// ScopePalettes and ScopeInstruments only validate; they have no
+	// artifacts to build.
+	ScopePalettes    Scope = "palettes"
+	ScopeInstruments Scope = "instruments"
 )
 
+// Scopes lists every scope, broadest first.
+var Scopes = []Scope{ScopeAll, ScopeSprites, ScopeMaps, ScopeAudio}
+
+// ValidateScopes lists the scopes Validate takes: Scopes and the
+// validation-only ones.
+var ValidateScopes = append(slices.Clip(Scopes), ScopePalettes, ScopeInstruments)
+
 // Options controls what gets built.
 type Options struct {
-	Scope     Scope
-	Files     []string // specific files to build (empty = all)
+	Scope Scope
+	// Files are specific files to build (empty = all). They are widened
+	// to the sprites and tracks that use a named palette or instrument,
+	// and to the palettes and instruments the named files need.
+	Files     []string
 	OutputDir string
+
+	// IncludeTags and ExcludeTags select tagged asset files; untagged
+	// files always build.
+	IncludeTags []string
+	ExcludeTags []string
+
+	// ChangedOnly makes Validate skip files that validated without errors
+	// or warnings last time and haven't changed since, nor have the files
+	// they depend on or the config.
+	ChangedOnly bool
+
+	// NoRecord leaves .runefact alone, for builds that aren't the
+	// project's real build, such as benchmark runs, and for callers that
+	// must not write: Build skips last_build.json, and a ChangedOnly
+	// Validate reads its cache without updating it.
+	NoRecord bool
+
+	// PackKey enciphers the pack when the project sets project.pack and a
+	// project.pack_cipher. Empty reads RUNEFACT_PACK_KEY.
+	PackKey string
 }
 
 // Result contains the output of a build.
@@ -39,12 +82,79 @@ type Result struct {
 	Artifacts    []string
 	Errors       []error
 	Warnings     []string
+	Hints        []string
 	ManifestPath string
+
+	// Skipped lists source files left out by tag filters.
+	Skipped []string
+
+	// Pulled lists the source files a filtered build or validation added
+	// to Options.Files as dependents or dependencies of the named files.
+	Pulled []string
+
+	// Validated and Cached list the files a ChangedOnly validation
+	// checked and skipped. Palettes are always read, since sprites need
+	// them, but only changed ones count as validated.
+	Validated []string
+	Cached    []string
+
+	// Diagnostics holds every error and warning with its source file.
+	Diagnostics []diagnostic.Diagnostic
+
+	// Phases holds how long each build phase took, in build order.
+	Phases []PhaseTime
+
+	// Sizes is the size of the output directory after the build and the
+	// [budgets] checks; nil for validation and canceled builds.
+	Sizes *SizeReport
+
+	root string
+}
+
+// IOError is an error in Result.Errors that came from the file system,
+// such as a read-only output directory or a full disk, rather than from
+// the assets.
+type IOError struct {
+	Err error
+}
+
+func (e *IOError) Error() string { return e.Err.Error() }
+func (e *IOError) Unwrap() error { return e.Err }
+
+// HasIOErrors reports whether any error in r.Errors is an IOError.
+func (r *Result) HasIOErrors() bool {
+	for _, err := range r.Errors {
+		var ioErr *IOError
+		if errors.As(err, &ioErr) {
+			return true
+		}
+	}
+	return false
+}
+
+// PhaseTime is how long one build phase took. Phases left out by the
+// scope are still listed, with the little time they took to skip.
+type PhaseTime struct {
+	Name     string
+	Duration time.Duration
 }
 
 // Build compiles rune files into game-ready artifacts.
 func Build(opts Options, cfg *config.ProjectConfig, projectRoot string) *Result {
-	result := &Result{}
+	return BuildContext(context.Background(), opts, cfg, projectRoot)
+}
+
+// BuildContext is Build with a context that can stop audio rendering. A
+// canceled build returns as soon as the render in progress notices, with
+// the context's error and without a manifest or build record.
+func BuildContext(ctx context.Context, opts Options, cfg *config.ProjectConfig, projectRoot string) *Result {
+	result := &Result{root: projectRoot}
+	clock := time.Now()
+	endPhase := func(name string) {
+		now := time.Now()
+		result.Phases = append(result.Phases, PhaseTime{Name: name, Duration: now.Sub(clock)})
+		clock = now
+	}
 
 	if opts.OutputDir == "" {
 		opts.OutputDir = filepath.Join(projectRoot, cfg.Project.Output)
@@ -53,267 +163,452 @@ func Build(opts Options, cfg *config.ProjectConfig, projectRoot string) *Result
 		opts.Scope = ScopeAll
 	}
 
-	assetsDir := filepath.Join(projectRoot, "assets")
+	// Artifacts are replaced by rename, so a build killed mid-write leaves
+	// whole files and, at worst, a temporary file to clean up.
+	if removed, _ := atomicfile.CleanTemp(opts.OutputDir); len(removed) > 0 {
+		result.addWarning("", fmt.Sprintf("removed %d partial file(s) left by an interrupted build", len(removed)))
+	}
+
+	assetsDirs := cfg.AssetsDirs(projectRoot)
+	result.checkIncludes(assetsDirs)
+	if len(opts.Files) > 0 {
+		opts.Files, result.Pulled = closure(assetsDirs, opts.Files)
+	}
 	md := &manifest.ManifestData{Package: cfg.Project.Package}
+	colorKey := cfg.Project.ColorKey()
+	sheetOpts := sheetOptions(cfg)
+	if colorKey != nil {
+		md.TransparentColor = fmt.Sprintf("#%02x%02x%02x", colorKey.R, colorKey.G, colorKey.B)
+	}
 
 	// Phase 1: Parse all palettes.
 	palettes := map[string]*palette.Palette{}
-	if paletteDir := filepath.Join(assetsDir, "palettes"); dirExists(paletteDir) {
-		files := discoverFiles(paletteDir, ".palette", opts.Files)
-		for _, f := range files {
-			p, err := palette.LoadPalette(f)
-			if err != nil {
-				result.Errors = append(result.Errors, err)
-				continue
-			}
+	paletteFiles := map[string]string{}
+	for _, f := range result.filterTags(result.discover(assetsDirs, "palettes", ".palette", opts.Files), opts) {
+		p, err := palette.LoadPalette(f)
+		if err != nil {
+			result.addError(f, err)
+			continue
+		}
+		if !result.shadowedName(paletteFiles, p.Name, f) {
 			palettes[p.Name] = p
 		}
 	}
 
+	endPhase("palettes")
+
 	// Phase 2: Parse and render sprites.
 	if opts.Scope == ScopeAll || opts.Scope == ScopeSprites {
-		if spriteDir := filepath.Join(assetsDir, "sprites"); dirExists(spriteDir) {
-			files := discoverFiles(spriteDir, ".sprite", opts.Files)
-			for _, f := range files {
-				sf, err := sprite.LoadSpriteFile(f)
-				if err != nil {
-					result.Errors = append(result.Errors, err)
-					continue
-				}
+		for _, f := range result.filterTags(result.discover(assetsDirs, "sprites", ".sprite", opts.Files), opts) {
+			sf, err := sprite.LoadSpriteFile(f)
+			if err != nil {
+				result.addError(f, err)
+				continue
+			}
+			sf.MaxFromDepth = cfg.Lint.MaxFromDepth
 
-				pal, ok := palettes[sf.PaletteRef]
-				if !ok && sf.PaletteRef != "" {
-					result.Errors = append(result.Errors, fmt.Errorf("%s: palette %q not found", f, sf.PaletteRef))
+			pal, ok := palettes[sf.PaletteRef]
+			if !ok && sf.PaletteRef != "" {
+				result.addError(f, fmt.Errorf("%s: palette %q not found", f, sf.PaletteRef))
+				continue
+			}
+			if pal == nil {
+				pal = &palette.Palette{Colors: map[string]palette.Color{}}
+			}
+
+			resolved, err := sf.ResolveWith(pal, sprite.DirPartLoader(assetsDirs...), paletteLoader(palettes, assetsDirs...))
+			if err != nil {
+				result.addError(f, err)
+				continue
+			}
+
+			if result.reportSheetSize(f, resolved, sheetOpts, cfg.Lint.MaxSheetSize, cfg.Lint.Strict) {
+				continue
+			}
+			if result.reportSpriteLimits(f, resolved, sheetOpts, cfg.Lint) {
+				continue
+			}
+			if result.reportColorKey(f, resolved, colorKey) {
+				continue
+			}
+
+			img, meta, err := sprite.RenderSheet(resolved, colorKey, sheetOpts)
+			if err != nil {
+				result.addError(f, err)
+				continue
+			}
+
+			baseName := strings.TrimSuffix(filepath.Base(f), ".sprite")
+			relPath := filepath.Join("sprites", baseName+".png")
+			outPath := filepath.Join(opts.OutputDir, relPath)
+
+			if err := sprite.WritePNG(img, outPath); err != nil {
+				result.addIOError(f, err)
+				continue
+			}
+
+			result.Artifacts = append(result.Artifacts, outPath)
+			md.AddSpriteSheet(filepath.Base(f), relPath, meta)
+
+			for _, scale := range cfg.Project.Scales {
+				if scale == 1 {
 					continue
 				}
-				if pal == nil {
-					pal = &palette.Palette{Colors: map[string]palette.Color{}}
+				scaledRel := filepath.Join("sprites", fmt.Sprintf("%s@%dx.png", baseName, scale))
+				scaledPath := filepath.Join(opts.OutputDir, scaledRel)
+				if err := sprite.WritePNG(sprite.ScaleImage(img, scale), scaledPath); err != nil {
+					result.addIOError(f, err)
+					continue
 				}
+				result.Artifacts = append(result.Artifacts, scaledPath)
+				md.AddSheetScale(filepath.Base(f), scaledRel, scale)
+			}
 
-				resolved, err := sf.Resolve(pal)
-				if err != nil {
-					result.Errors = append(result.Errors, err)
+			for _, s := range resolved {
+				if !s.ExportFrames {
 					continue
 				}
-
-				img, meta, err := sprite.RenderSpriteSheet(resolved)
+				framesRel := filepath.Join("sprites", "frames", baseName)
+				paths, err := export.WriteFrames(s, filepath.Join(opts.OutputDir, framesRel), 1, colorKey)
 				if err != nil {
-					result.Errors = append(result.Errors, err)
+					result.addIOError(f, err)
 					continue
 				}
-
-				baseName := strings.TrimSuffix(filepath.Base(f), ".sprite")
-				relPath := filepath.Join("sprites", baseName+".png")
-				outPath := filepath.Join(opts.OutputDir, relPath)
-
-				if err := sprite.WritePNG(img, outPath); err != nil {
-					result.Errors = append(result.Errors, err)
-					continue
+				relPaths := make([]string, len(paths))
+				for i, p := range paths {
+					relPaths[i] = filepath.Join(framesRel, filepath.Base(p))
 				}
-
-				result.Artifacts = append(result.Artifacts, outPath)
-				md.AddSpriteSheet(filepath.Base(f), relPath, meta)
+				result.Artifacts = append(result.Artifacts, paths...)
+				md.AddSpriteFrames(filepath.Base(f), s.Name, relPaths)
 			}
 		}
 	}
 
+	endPhase("sprites")
+
 	// Phase 3: Parse and render maps.
 	if opts.Scope == ScopeAll || opts.Scope == ScopeMaps {
-		if mapDir := filepath.Join(assetsDir, "maps"); dirExists(mapDir) {
-			files := discoverFiles(mapDir, ".map", opts.Files)
-			for _, f := range files {
-				mf, warnings, err := tilemap.LoadMapFile(f)
-				if err != nil {
-					result.Errors = append(result.Errors, err)
-					continue
-				}
-				for _, w := range warnings {
-					result.Warnings = append(result.Warnings, w.Message)
-				}
-
-				j := mf.ToJSON()
-				baseName := strings.TrimSuffix(filepath.Base(f), ".map")
-				relPath := filepath.Join("maps", baseName+".json")
-				outPath := filepath.Join(opts.OutputDir, relPath)
+		for _, f := range result.filterTags(result.discover(assetsDirs, "maps", ".map", opts.Files), opts) {
+			mf, warnings, err := tilemap.LoadMapFile(f)
+			if err != nil {
+				result.addError(f, err)
+				continue
+			}
+			for _, w := range warnings {
+				result.addCellWarning(f, w.Message, w.Cells)
+			}
 
-				if err := tilemap.WriteJSON(j, outPath); err != nil {
-					result.Errors = append(result.Errors, err)
-					continue
+			sprites := newSpriteLookup(palettes, assetsDirs)
+			if result.reportTileSizes(f, mf, sprites, cfg.Lint) {
+				continue
+			}
+			result.resolveTileAnimations(f, mf, sprites)
+			j := mf.ToJSON()
+			baseName := strings.TrimSuffix(filepath.Base(f), ".map")
+			relPath := filepath.Join("maps", baseName+".json")
+			outPath := filepath.Join(opts.OutputDir, relPath)
+
+			if prev, err := tilemap.LoadJSON(outPath); err == nil {
+				for _, msg := range mf.TileIDChanges(prev) {
+					result.addWarning(f, fmt.Sprintf("%s: %s", f, msg))
 				}
-
-				result.Artifacts = append(result.Artifacts, outPath)
-				md.AddMap(filepath.Base(f), relPath)
 			}
+			if err := tilemap.WriteJSON(j, outPath); err != nil {
+				result.addIOError(f, err)
+				continue
+			}
+
+			result.Artifacts = append(result.Artifacts, outPath)
+			md.AddMap(filepath.Base(f), relPath)
+			md.AddMapTiles(filepath.Base(f), mapTiles(mf, j))
 		}
 	}
 
+	endPhase("maps")
+
 	// Phase 4: Parse instruments (needed by audio).
 	instruments := map[string]*instrument.Instrument{}
-	if instDir := filepath.Join(assetsDir, "instruments"); dirExists(instDir) {
-		files := discoverFiles(instDir, ".inst", opts.Files)
-		for _, f := range files {
-			inst, err := instrument.LoadInstrument(f)
-			if err != nil {
-				result.Errors = append(result.Errors, err)
-				continue
-			}
+	instFiles := map[string]string{}
+	for _, f := range result.filterTags(result.discover(assetsDirs, "instruments", ".inst", opts.Files), opts) {
+		inst, err := instrument.LoadInstrument(f)
+		if err != nil {
+			result.addError(f, err)
+			continue
+		}
+		if !result.shadowedName(instFiles, inst.Name, f) {
 			instruments[inst.Name] = inst
 		}
 	}
 
+	endPhase("instruments")
+
 	// Phase 5: Render SFX and tracks.
 	if opts.Scope == ScopeAll || opts.Scope == ScopeAudio {
-		if sfxDir := filepath.Join(assetsDir, "sfx"); dirExists(sfxDir) {
-			files := discoverFiles(sfxDir, ".sfx", opts.Files)
-			for _, f := range files {
-				s, err := sfx.LoadSFX(f)
-				if err != nil {
-					result.Errors = append(result.Errors, err)
-					continue
-				}
+		collided := result.reportAudioCollisions(assetsDirs, cfg.Project.AudioSubdirs, opts.Files)
 
-				samples, audioWarnings := s.Render(cfg.Defaults.SampleRate)
-				for _, w := range audioWarnings {
-					result.Warnings = append(result.Warnings, w.Message)
-				}
+		for _, f := range result.filterTags(result.discover(assetsDirs, "sfx", ".sfx", opts.Files), opts) {
+			if collided[f] {
+				continue
+			}
+			s, err := sfx.LoadSFX(f)
+			if err != nil {
+				result.addError(f, err)
+				continue
+			}
 
-				baseName := strings.TrimSuffix(filepath.Base(f), ".sfx")
-				relPath := filepath.Join("audio", baseName+".wav")
-				outPath := filepath.Join(opts.OutputDir, relPath)
+			samples, audioWarnings, err := s.Render(ctx, cfg.Defaults.SampleRate)
+			if err != nil {
+				result.addError(f, fmt.Errorf("%s: %w", f, err))
+				return result
+			}
+			for _, w := range audioWarnings {
+				result.addWarning(f, w.Message)
+			}
 
-				if err := audio.WriteWAV(outPath, samples, cfg.Defaults.SampleRate, cfg.Defaults.BitDepth); err != nil {
-					result.Errors = append(result.Errors, err)
-					continue
-				}
+			relPath := audioRelPath(f, cfg.Project.AudioSubdirs)
+			outPath := filepath.Join(opts.OutputDir, relPath)
 
-				result.Artifacts = append(result.Artifacts, outPath)
-				md.AddAudio(filepath.Base(f), relPath)
+			if err := audio.WriteWAV(outPath, samples, cfg.Defaults.SampleRate, cfg.Defaults.BitDepth); err != nil {
+				result.addIOError(f, err)
+				continue
 			}
+
+			result.Artifacts = append(result.Artifacts, outPath)
+			md.AddAudio(filepath.Base(f), relPath, s.Duration)
 		}
 
-		if trackDir := filepath.Join(assetsDir, "tracks"); dirExists(trackDir) {
-			files := discoverFiles(trackDir, ".track", opts.Files)
-			for _, f := range files {
-				tr, err := track.LoadTrack(f)
-				if err != nil {
-					result.Errors = append(result.Errors, err)
-					continue
+		for _, f := range result.filterTags(result.discover(assetsDirs, "tracks", ".track", opts.Files), opts) {
+			if collided[f] {
+				continue
+			}
+			tr, err := track.LoadTrack(f)
+			if err != nil {
+				result.addError(f, err)
+				continue
+			}
+			for _, w := range tr.Warnings {
+				result.addWarning(f, w)
+			}
+			result.reportNoteRanges(f, tr, instruments)
+
+			// The song, then each pattern in export_patterns on its own.
+			for _, out := range audioOutputs(f, tr, cfg.Project.AudioSubdirs) {
+				var samples []float64
+				if out.Pattern == "" {
+					samples, err = tr.Render(ctx, instruments, cfg.Defaults.SampleRate)
+					if err == nil {
+						result.reportLoopSeam(f, tr, samples, cfg.Defaults.SampleRate)
+					}
+				} else {
+					samples, err = tr.RenderPattern(ctx, out.Pattern, instruments, cfg.Defaults.SampleRate)
+				}
+				if err != nil && ctx.Err() != nil {
+					result.addError(f, fmt.Errorf("%s: %w", f, err))
+					return result
 				}
-
-				samples, err := tr.Render(instruments, cfg.Defaults.SampleRate)
 				if err != nil {
-					result.Errors = append(result.Errors, err)
-					continue
+					result.addError(f, err)
+					break
 				}
 
-				baseName := strings.TrimSuffix(filepath.Base(f), ".track")
-				relPath := filepath.Join("audio", baseName+".wav")
-				outPath := filepath.Join(opts.OutputDir, relPath)
+				outPath := filepath.Join(opts.OutputDir, out.Rel)
 
 				if err := audio.WriteWAV(outPath, samples, cfg.Defaults.SampleRate, cfg.Defaults.BitDepth); err != nil {
-					result.Errors = append(result.Errors, err)
-					continue
+					result.addIOError(f, err)
+					break
 				}
 
 				result.Artifacts = append(result.Artifacts, outPath)
-				md.AddAudio(filepath.Base(f), relPath)
+				if out.Pattern == "" {
+					md.AddAudio(filepath.Base(f), out.Rel, tr.Duration())
+				} else {
+					md.AddPatternAudio(filepath.Base(f), out.Pattern, out.Rel, tr.PatternDuration(out.Pattern))
+				}
 			}
 		}
 	}
 
+	endPhase("audio")
+
 	// Phase 6: Generate manifest.
-	manifestPath := filepath.Join(opts.OutputDir, "manifest.go")
-	if err := manifest.Generate(md, manifestPath); err != nil {
-		result.Errors = append(result.Errors, err)
-	} else {
-		result.ManifestPath = manifestPath
-		result.Artifacts = append(result.Artifacts, manifestPath)
+	packed := result.packs(&opts, cfg)
+	if packed {
+		md.Pack = pack.FileName
+	}
+	result.writeManifests(md, opts.OutputDir, cfg.Project.ManifestJSON)
+
+	endPhase("manifest")
+
+	result.checkBudgets(opts.OutputDir, cfg)
+
+	// Budgets apply to the artifacts, so they are checked before the
+	// artifacts go into the pack. If they don't go in, the manifest is
+	// written again without the pack, so the game loads the files that
+	// are there.
+	if packed && (len(result.Errors) > 0 || !result.packArtifacts(opts.OutputDir, cfg, opts.PackKey)) {
+		md.Pack = ""
+		result.writeManifests(md, opts.OutputDir, cfg.Project.ManifestJSON)
+	}
+
+	// Record the outcome for status reporting; failure to do so is not a build error.
+	if !opts.NoRecord {
+		_ = SaveBuildRecord(projectRoot, result)
 	}
 
 	return result
 }
 
+// writeManifests writes manifest.go, and manifest.json if the project
+// asks for it, adding them to the artifacts the first time.
+func (r *Result) writeManifests(md *manifest.ManifestData, outputDir string, withJSON bool) {
+	manifestPath := filepath.Join(outputDir, "manifest.go")
+	if err := manifest.Generate(md, manifestPath); err != nil {
+		r.addIOError("", err)
+	} else if r.ManifestPath == "" {
+		r.ManifestPath = manifestPath
+		r.Artifacts = append(r.Artifacts, manifestPath)
+	}
+	if withJSON {
+		jsonPath := filepath.Join(outputDir, "manifest.json")
+		if err := manifest.GenerateJSON(md, jsonPath); err != nil {
+			r.addIOError("", err)
+		} else if !slices.Contains(r.Artifacts, jsonPath) {
+			r.Artifacts = append(r.Artifacts, jsonPath)
+		}
+	}
+}
+
 // Validate runs parsing without rendering — checks files for errors.
 func Validate(opts Options, cfg *config.ProjectConfig, projectRoot string) *Result {
-	result := &Result{}
-	assetsDir := filepath.Join(projectRoot, "assets")
+	result := &Result{root: projectRoot}
+	assetsDirs := cfg.AssetsDirs(projectRoot)
+	result.checkIncludes(assetsDirs)
+	if len(opts.Files) > 0 {
+		opts.Files, result.Pulled = closure(assetsDirs, opts.Files)
+	}
+	var vc *validateCache
+	if opts.ChangedOnly {
+		vc = newValidateCache(projectRoot, assetsDirs, cfg)
+	}
 
 	// Parse palettes.
 	palettes := map[string]*palette.Palette{}
-	if paletteDir := filepath.Join(assetsDir, "palettes"); dirExists(paletteDir) {
-		for _, f := range discoverFiles(paletteDir, ".palette", opts.Files) {
+	paletteFiles := map[string]string{}
+	if opts.Scope != ScopeInstruments {
+		files := result.discover(assetsDirs, "palettes", ".palette", opts.Files)
+		// Unchanged palettes parse as cleanly as last time, but the
+		// sprites need them all.
+		vc.changed(result, files)
+		for _, f := range files {
 			p, err := palette.LoadPalette(f)
 			if err != nil {
-				result.Errors = append(result.Errors, err)
-			} else {
+				result.addError(f, err)
+			} else if !result.shadowedName(paletteFiles, p.Name, f) {
 				palettes[p.Name] = p
 			}
 		}
 	}
+	if vc != nil {
+		// Sprites name palettes by the name they declare.
+		vc.paletteFiles = paletteFiles
+	}
 
 	// Validate sprites.
 	if opts.Scope == "" || opts.Scope == ScopeAll || opts.Scope == ScopeSprites {
-		if spriteDir := filepath.Join(assetsDir, "sprites"); dirExists(spriteDir) {
-			for _, f := range discoverFiles(spriteDir, ".sprite", opts.Files) {
-				sf, err := sprite.LoadSpriteFile(f)
-				if err != nil {
-					result.Errors = append(result.Errors, err)
-					continue
-				}
-				pal := palettes[sf.PaletteRef]
-				if pal == nil {
-					pal = &palette.Palette{Colors: map[string]palette.Color{}}
-				}
-				if _, err := sf.Resolve(pal); err != nil {
-					result.Errors = append(result.Errors, err)
-				}
+		for _, f := range vc.changed(result, result.discover(assetsDirs, "sprites", ".sprite", opts.Files)) {
+			sf, err := sprite.LoadSpriteFile(f)
+			if err != nil {
+				result.addError(f, err)
+				continue
+			}
+			sf.MaxFromDepth = cfg.Lint.MaxFromDepth
+			pal := palettes[sf.PaletteRef]
+			if pal == nil {
+				pal = &palette.Palette{Colors: map[string]palette.Color{}}
 			}
+			resolved, err := sf.ResolveWith(pal, sprite.DirPartLoader(assetsDirs...), paletteLoader(palettes, assetsDirs...))
+			if err != nil {
+				result.addError(f, err)
+				continue
+			}
+			result.reportSheetSize(f, resolved, sheetOptions(cfg), cfg.Lint.MaxSheetSize, cfg.Lint.Strict)
+			result.reportSpriteLimits(f, resolved, sheetOptions(cfg), cfg.Lint)
+			result.reportColorKey(f, resolved, cfg.Project.ColorKey())
+			result.reportFrames(f, resolved)
 		}
 	}
 
 	// Validate maps.
 	if opts.Scope == "" || opts.Scope == ScopeAll || opts.Scope == ScopeMaps {
-		if mapDir := filepath.Join(assetsDir, "maps"); dirExists(mapDir) {
-			for _, f := range discoverFiles(mapDir, ".map", opts.Files) {
-				_, warnings, err := tilemap.LoadMapFile(f)
-				if err != nil {
-					result.Errors = append(result.Errors, err)
-				}
-				for _, w := range warnings {
-					result.Warnings = append(result.Warnings, w.Message)
-				}
+		for _, f := range vc.changed(result, result.discover(assetsDirs, "maps", ".map", opts.Files)) {
+			mf, warnings, err := tilemap.LoadMapFile(f)
+			if err != nil {
+				result.addError(f, err)
+				continue
+			}
+			for _, w := range warnings {
+				result.addCellWarning(f, w.Message, w.Cells)
 			}
+			result.reportTileSizes(f, mf, newSpriteLookup(palettes, assetsDirs), cfg.Lint)
 		}
 	}
 
 	// Validate instruments.
-	if instDir := filepath.Join(assetsDir, "instruments"); dirExists(instDir) {
-		for _, f := range discoverFiles(instDir, ".inst", opts.Files) {
+	if opts.Scope != ScopePalettes {
+		for _, f := range vc.changed(result, result.discover(assetsDirs, "instruments", ".inst", opts.Files)) {
 			if _, err := instrument.LoadInstrument(f); err != nil {
-				result.Errors = append(result.Errors, err)
+				result.addError(f, err)
 			}
 		}
 	}
 
 	// Validate SFX.
 	if opts.Scope == "" || opts.Scope == ScopeAll || opts.Scope == ScopeAudio {
-		if sfxDir := filepath.Join(assetsDir, "sfx"); dirExists(sfxDir) {
-			for _, f := range discoverFiles(sfxDir, ".sfx", opts.Files) {
-				if _, err := sfx.LoadSFX(f); err != nil {
-					result.Errors = append(result.Errors, err)
-				}
+		result.reportAudioCollisions(assetsDirs, cfg.Project.AudioSubdirs, opts.Files)
+
+		for _, f := range vc.changed(result, result.discover(assetsDirs, "sfx", ".sfx", opts.Files)) {
+			if _, err := sfx.LoadSFX(f); err != nil {
+				result.addError(f, err)
 			}
 		}
 
-		if trackDir := filepath.Join(assetsDir, "tracks"); dirExists(trackDir) {
-			for _, f := range discoverFiles(trackDir, ".track", opts.Files) {
-				if _, err := track.LoadTrack(f); err != nil {
-					result.Errors = append(result.Errors, err)
+		var instruments map[string]*instrument.Instrument
+		for _, f := range vc.changed(result, result.discover(assetsDirs, "tracks", ".track", opts.Files)) {
+			tr, err := track.LoadTrack(f)
+			if err != nil {
+				result.addError(f, err)
+				continue
+			}
+			for _, w := range tr.Warnings {
+				result.addWarning(f, w)
+			}
+			if instruments == nil {
+				instruments = loadInstruments(assetsDirs)
+			}
+			result.reportNoteRanges(f, tr, instruments)
+
+			// Only a render shows whether the loop seam clicks.
+			if tr.Loop {
+				if samples, err := tr.Render(context.Background(), instruments, cfg.Defaults.SampleRate); err == nil {
+					result.reportLoopSeam(f, tr, samples, cfg.Defaults.SampleRate)
 				}
 			}
 		}
 	}
 
+	// Unused-asset and duplicate-color hints need the whole project, so
+	// skip them for partial runs.
+	if len(opts.Files) == 0 && (opts.Scope == "" || opts.Scope == ScopeAll) {
+		result.reportUnused(cfg, projectRoot)
+		result.reportDuplicateColors(projectRoot)
+	}
+
+	// The cache only saves time; failing to write it is not a validation
+	// error.
+	if !opts.NoRecord {
+		_ = vc.save(result)
+	}
+
 	return result
 }
 
@@ -337,10 +632,6 @@ func discoverFiles(dir, ext string, filter []string) []string {
 		if len(filter) > 0 && !matchesFilter(fullPath, e.Name(), filter) {
 			continue
 		}
-		// Validate UTF-8 encoding early.
-		if err := checkUTF8(fullPath); err != nil {
-			continue // skip non-UTF-8 files silently; parsers will report errors
-		}
 		files = append(files, fullPath)
 	}
 	return files
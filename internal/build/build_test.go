@@ -1,11 +1,24 @@
 package build
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/vgalaktionov/runefact/internal/config"
+	"github.com/vgalaktionov/runefact/internal/diagnostic"
+	"github.com/vgalaktionov/runefact/internal/tilemap"
 )
 
 // setupDemoProject creates a minimal project for testing.
@@ -79,7 +92,7 @@ release = 0.01
 `), 0644)
 
 	// SFX.
-	os.WriteFile(filepath.Join(dir, "assets/sfx/demo.sfx"), []byte(`duration = 0.05
+	os.WriteFile(filepath.Join(dir, "assets/sfx/blip.sfx"), []byte(`duration = 0.05
 volume = 0.5
 [[voice]]
 waveform = "sine"
@@ -133,7 +146,8 @@ func TestBuild_FullProject(t *testing.T) {
 	expectedFiles := []string{
 		"build/assets/sprites/demo.png",
 		"build/assets/maps/demo.json",
-		"build/assets/audio/demo.wav", // sfx
+		"build/assets/audio/blip.wav",
+		"build/assets/audio/demo.wav",
 		"build/assets/manifest.go",
 	}
 	for _, f := range expectedFiles {
@@ -148,6 +162,70 @@ func TestBuild_FullProject(t *testing.T) {
 	}
 }
 
+func TestBuildContext_Canceled(t *testing.T) {
+	dir, cfg := setupDemoProject(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result := BuildContext(ctx, Options{}, cfg, dir)
+
+	if len(result.Errors) != 1 || !errors.Is(result.Errors[0], context.Canceled) {
+		t.Fatalf("errors = %v, want one context.Canceled", result.Errors)
+	}
+	// Sprites and maps were built before the audio phase; the WAV and
+	// manifest were not written.
+	if _, err := os.Stat(filepath.Join(dir, "build/assets/sprites/demo.png")); err != nil {
+		t.Errorf("expected sprite PNG: %v", err)
+	}
+	for _, f := range []string{"build/assets/audio/blip.wav", "build/assets/manifest.go"} {
+		if _, err := os.Stat(filepath.Join(dir, f)); err == nil {
+			t.Errorf("%s written by a canceled build", f)
+		}
+	}
+	if result.ManifestPath != "" {
+		t.Errorf("ManifestPath = %q, want none", result.ManifestPath)
+	}
+}
+
+func TestBuild_CleansPartialFiles(t *testing.T) {
+	dir, cfg := setupDemoProject(t)
+	// What a build killed mid-write leaves: a temporary file next to where
+	// the artifact would go.
+	partial := filepath.Join(dir, "build/assets/sprites/.demo.png.runefact-tmp-42")
+	os.MkdirAll(filepath.Dir(partial), 0755)
+	os.WriteFile(partial, []byte("\x89PNG"), 0644)
+
+	result := Build(Options{Scope: ScopeSprites}, cfg, dir)
+	if len(result.Errors) > 0 {
+		t.Fatalf("build errors: %v", result.Errors)
+	}
+	if _, err := os.Stat(partial); err == nil {
+		t.Error("partial file was not removed")
+	}
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "interrupted build") {
+		t.Errorf("warnings = %v, want one about the interrupted build", result.Warnings)
+	}
+}
+
+func TestBuild_IOErrors(t *testing.T) {
+	dir, cfg := setupDemoProject(t)
+	// A file where the sprites directory should be: every sheet fails to
+	// write, whoever runs the test.
+	os.MkdirAll(filepath.Join(dir, "build/assets"), 0755)
+	os.WriteFile(filepath.Join(dir, "build/assets/sprites"), nil, 0644)
+
+	result := Build(Options{Scope: ScopeSprites}, cfg, dir)
+	if len(result.Errors) == 0 || !result.HasIOErrors() {
+		t.Fatalf("errors = %v, want an IOError", result.Errors)
+	}
+
+	os.WriteFile(filepath.Join(dir, "assets/sprites/demo.sprite"), []byte("grid = \"big\""), 0644)
+	result = Build(Options{Scope: ScopeSprites}, cfg, dir)
+	if len(result.Errors) == 0 || result.HasIOErrors() {
+		t.Errorf("errors = %v, want an asset error only", result.Errors)
+	}
+}
+
 func TestBuild_SpritesOnly(t *testing.T) {
 	dir, cfg := setupDemoProject(t)
 
@@ -185,6 +263,88 @@ func TestBuild_MapsOnly(t *testing.T) {
 	}
 }
 
+func TestBuild_FileClosure(t *testing.T) {
+	dir, cfg := setupDemoProject(t)
+	out := filepath.Join(dir, "build/assets")
+
+	for _, tc := range []struct {
+		file     string
+		pulled   []string
+		artifact string
+	}{
+		{"default.palette", []string{"demo.sprite"}, "sprites/demo.png"},
+		{"demo.sprite", []string{"default.palette"}, "sprites/demo.png"},
+		{"demo.inst", []string{"demo.track"}, "audio/demo.wav"},
+		{"demo.track", []string{"demo.inst"}, "audio/demo.wav"},
+	} {
+		os.RemoveAll(out)
+		result := Build(Options{Files: []string{tc.file}}, cfg, dir)
+		if len(result.Errors) > 0 {
+			t.Errorf("%s: errors = %v", tc.file, result.Errors)
+		}
+		var pulled []string
+		for _, f := range result.Pulled {
+			pulled = append(pulled, filepath.Base(f))
+		}
+		if !slices.Equal(pulled, tc.pulled) {
+			t.Errorf("%s: pulled = %q, want %q", tc.file, pulled, tc.pulled)
+		}
+		if _, err := os.Stat(filepath.Join(out, tc.artifact)); err != nil {
+			t.Errorf("%s: want %s built", tc.file, tc.artifact)
+		}
+	}
+}
+
+// Sprites and tracks refer to palettes and instruments by the name they
+// declare, which needn't be their file name.
+// useDeclaredNames moves the demo palette to colors.palette, declaring
+// name = "forest" for the sprite to use, and the demo instrument to
+// synth.inst, so no reference matches a file name.
+func useDeclaredNames(dir string) {
+	assets := filepath.Join(dir, "assets")
+	pal, _ := os.ReadFile(filepath.Join(assets, "palettes/default.palette"))
+	os.Remove(filepath.Join(assets, "palettes/default.palette"))
+	os.WriteFile(filepath.Join(assets, "palettes/colors.palette"), bytes.Replace(pal, []byte(`"default"`), []byte(`"forest"`), 1), 0644)
+	spr, _ := os.ReadFile(filepath.Join(assets, "sprites/demo.sprite"))
+	os.WriteFile(filepath.Join(assets, "sprites/demo.sprite"), bytes.Replace(spr, []byte(`"default"`), []byte(`"forest"`), 1), 0644)
+	os.Rename(filepath.Join(assets, "instruments/demo.inst"), filepath.Join(assets, "instruments/synth.inst"))
+}
+
+func TestBuild_FileClosure_DeclaredNames(t *testing.T) {
+	dir, cfg := setupDemoProject(t)
+	useDeclaredNames(dir)
+
+	for file, want := range map[string]string{
+		"demo.sprite": "colors.palette",
+		"demo.track":  "synth.inst",
+	} {
+		result := Build(Options{Files: []string{file}}, cfg, dir)
+		if len(result.Errors) > 0 {
+			t.Errorf("%s: errors = %v", file, result.Errors)
+		}
+		if len(result.Pulled) != 1 || filepath.Base(result.Pulled[0]) != want {
+			t.Errorf("%s: pulled = %q, want %s", file, result.Pulled, want)
+		}
+	}
+}
+
+func TestValidate_PaletteAndInstrumentScopes(t *testing.T) {
+	dir, cfg := setupDemoProject(t)
+	os.WriteFile(filepath.Join(dir, "assets/palettes/broken.palette"), []byte("name = "), 0644)
+	os.WriteFile(filepath.Join(dir, "assets/instruments/broken.inst"), []byte("name = "), 0644)
+	os.WriteFile(filepath.Join(dir, "assets/sprites/broken.sprite"), []byte("grid = "), 0644)
+
+	for scope, want := range map[Scope]string{
+		ScopePalettes:    "broken.palette",
+		ScopeInstruments: "broken.inst",
+	} {
+		result := Validate(Options{Scope: scope}, cfg, dir)
+		if len(result.Errors) != 1 || !strings.Contains(result.Errors[0].Error(), want) {
+			t.Errorf("%s: errors = %v, want one for %s", scope, result.Errors, want)
+		}
+	}
+}
+
 func TestValidate_Valid(t *testing.T) {
 	dir, cfg := setupDemoProject(t)
 
@@ -198,6 +358,122 @@ func TestValidate_Valid(t *testing.T) {
 	}
 }
 
+func TestValidate_ChangedOnly(t *testing.T) {
+	dir, cfg := setupDemoProject(t)
+	opts := Options{ChangedOnly: true}
+	bases := func(files []string) []string {
+		var out []string
+		for _, f := range files {
+			out = append(out, filepath.Base(f))
+		}
+		slices.Sort(out)
+		return out
+	}
+	all := []string{"blip.sfx", "default.palette", "demo.inst", "demo.map", "demo.sprite", "demo.track"}
+
+	if r := Validate(opts, cfg, dir); !slices.Equal(bases(r.Validated), all) || len(r.Cached) != 0 {
+		t.Fatalf("first run validated %q, cached %q", bases(r.Validated), bases(r.Cached))
+	}
+	if r := Validate(opts, cfg, dir); len(r.Validated) != 0 || !slices.Equal(bases(r.Cached), all) {
+		t.Fatalf("second run validated %q, cached %q", bases(r.Validated), bases(r.Cached))
+	}
+
+	// A palette edit re-validates the sprite drawn with it and the map
+	// that uses the sprite, though neither file changed.
+	pal := filepath.Join(dir, "assets/palettes/default.palette")
+	data, _ := os.ReadFile(pal)
+	os.WriteFile(pal, bytes.Replace(data, []byte("#ff0000"), []byte("#ee0000"), 1), 0644)
+	want := []string{"default.palette", "demo.map", "demo.sprite"}
+	if r := Validate(opts, cfg, dir); !slices.Equal(bases(r.Validated), want) {
+		t.Errorf("after a palette edit validated %q, want %q", bases(r.Validated), want)
+	}
+
+	// A file with errors stays out of the cache until it's fixed.
+	os.WriteFile(filepath.Join(dir, "assets/sfx/blip.sfx"), []byte("duration = "), 0644)
+	for range 2 {
+		if r := Validate(opts, cfg, dir); len(r.Errors) != 1 || !slices.Equal(bases(r.Validated), []string{"blip.sfx"}) {
+			t.Errorf("broken sfx: validated %q, errors %v", bases(r.Validated), r.Errors)
+		}
+	}
+	if r := Validate(Options{}, cfg, dir); len(r.Cached) != 0 {
+		t.Errorf("a full validation cached %q", bases(r.Cached))
+	}
+}
+
+// Removing a key from a palette re-validates the sprites using it, though
+// they name it by its declared name, not its file name.
+func TestValidate_ChangedOnly_DeclaredNames(t *testing.T) {
+	dir, cfg := setupDemoProject(t)
+	useDeclaredNames(dir)
+	opts := Options{ChangedOnly: true}
+	if r := Validate(opts, cfg, dir); len(r.Errors) > 0 {
+		t.Fatalf("errors = %v", r.Errors)
+	}
+
+	pal := filepath.Join(dir, "assets/palettes/colors.palette")
+	data, _ := os.ReadFile(pal)
+	os.WriteFile(pal, bytes.Replace(data, []byte("r = \"#ff0000\"\n"), nil, 1), 0644)
+	full := Validate(Options{}, cfg, dir)
+	if len(full.Errors) == 0 {
+		t.Fatal("full validation found no error after removing the key")
+	}
+	if r := Validate(opts, cfg, dir); len(r.Errors) != len(full.Errors) {
+		t.Errorf("changed-only errors = %v, want %v", r.Errors, full.Errors)
+	}
+
+	// A renamed instrument file is still the dependency of its track.
+	inst := filepath.Join(dir, "assets/instruments/synth.inst")
+	data, _ = os.ReadFile(inst)
+	os.WriteFile(inst, append(data, "\n# edited\n"...), 0644)
+	if r := Validate(opts, cfg, dir); !slices.ContainsFunc(r.Validated, func(f string) bool { return filepath.Base(f) == "demo.track" }) {
+		t.Errorf("after an instrument edit validated %q, want demo.track", r.Validated)
+	}
+}
+
+func TestValidate_NoteRange(t *testing.T) {
+	dir, cfg := setupDemoProject(t)
+	os.WriteFile(filepath.Join(dir, "assets/instruments/demo.inst"), []byte(`name = "demo"
+range = { low = "C1", high = "C3" }
+[envelope]
+sustain = 1
+`), 0644)
+
+	want := `demo.track: pattern "p" row 1: channel "m" plays C4, outside the range C1-C3 of instrument "demo"`
+	for _, opts := range []Options{{}, {Files: []string{"demo.track"}}} {
+		result := Validate(opts, cfg, dir)
+		if len(result.Warnings) != 1 || result.Warnings[0] != want {
+			t.Errorf("%+v: warnings = %q, want %q", opts, result.Warnings, want)
+		}
+	}
+	if result := Build(Options{}, cfg, dir); !slices.Contains(result.Warnings, want) {
+		t.Errorf("build warnings = %q, want %q", result.Warnings, want)
+	}
+}
+
+func TestValidate_LoopSeam(t *testing.T) {
+	dir, cfg := setupDemoProject(t)
+	path := filepath.Join(dir, "assets/tracks/demo.track")
+	data, _ := os.ReadFile(path)
+	os.WriteFile(path, append([]byte("loop = true\n"), data...), 0644)
+
+	seamWarning := func(warnings []string) bool {
+		return slices.ContainsFunc(warnings, func(w string) bool {
+			return strings.HasPrefix(w, "demo.track: the loop seam jumps by ")
+		})
+	}
+	if result := Validate(Options{}, cfg, dir); !seamWarning(result.Warnings) {
+		t.Errorf("validate warnings = %q, want a loop seam warning", result.Warnings)
+	}
+	if result := Build(Options{Scope: ScopeAudio}, cfg, dir); !seamWarning(result.Warnings) {
+		t.Errorf("build warnings = %q, want a loop seam warning", result.Warnings)
+	}
+
+	os.WriteFile(path, append([]byte("loop = true\nloop_crossfade = 0.05\n"), data...), 0644)
+	if result := Validate(Options{}, cfg, dir); seamWarning(result.Warnings) {
+		t.Errorf("validate warnings = %q, want none with loop_crossfade", result.Warnings)
+	}
+}
+
 func TestValidate_InvalidSprite(t *testing.T) {
 	dir, cfg := setupDemoProject(t)
 
@@ -218,6 +494,116 @@ de
 	}
 }
 
+func TestBuild_SpritePalette(t *testing.T) {
+	dir, cfg := setupDemoProject(t)
+	os.WriteFile(filepath.Join(dir, "assets/palettes/boss.palette"), []byte(`name = "boss"
+[colors]
+r = "#800080"
+`), 0644)
+	os.WriteFile(filepath.Join(dir, "assets/sprites/demo.sprite"), []byte(`palette = "default"
+grid = 2
+
+[sprite.dot]
+pixels = """
+r_
+_r
+"""
+
+[sprite.boss]
+palette = "boss"
+pixels = """
+r_
+_r
+"""
+`), 0644)
+
+	result := Build(Options{Scope: ScopeSprites}, cfg, dir)
+	if len(result.Errors) > 0 {
+		t.Fatalf("build errors: %v", result.Errors)
+	}
+
+	// Sprites stack in file order: dot on top, boss below.
+	sheet := decodePNG(t, filepath.Join(dir, "build/assets/sprites/demo.png"))
+	for _, tt := range []struct {
+		y    int
+		want color.NRGBA
+	}{
+		{0, color.NRGBA{R: 255, A: 255}},
+		{2, color.NRGBA{R: 128, B: 128, A: 255}},
+	} {
+		if got := color.NRGBAModel.Convert(sheet.At(0, tt.y)); got != tt.want {
+			t.Errorf("pixel (0,%d) = %v, want %v", tt.y, got, tt.want)
+		}
+	}
+}
+
+func TestBuild_TransparentColor(t *testing.T) {
+	dir, cfg := setupDemoProject(t)
+	cfg.Project.TransparentColor = "#ff00ff"
+	os.WriteFile(filepath.Join(dir, "assets/sprites/demo.sprite"), []byte(`palette = "default"
+grid = 2
+
+[sprite.dot]
+pixels = """
+r_
+_r
+"""
+`), 0644)
+
+	result := Build(Options{Scope: ScopeSprites}, cfg, dir)
+	if len(result.Errors) > 0 {
+		t.Fatalf("build errors: %v", result.Errors)
+	}
+
+	sheet := decodePNG(t, filepath.Join(dir, "build/assets/sprites/demo.png"))
+	want := color.NRGBA{R: 255, B: 255, A: 255}
+	if got := color.NRGBAModel.Convert(sheet.At(1, 0)); got != want {
+		t.Errorf("transparent pixel = %v, want %v", got, want)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "build/assets/manifest.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `const TransparentColor = "#ff00ff"`) {
+		t.Errorf("manifest missing TransparentColor:\n%s", data)
+	}
+}
+
+func TestBuild_TransparentColorCollision(t *testing.T) {
+	dir, cfg := setupDemoProject(t)
+	cfg.Project.TransparentColor = "#ff0000"
+
+	result := Build(Options{Scope: ScopeSprites}, cfg, dir)
+
+	if len(result.Errors) != 1 || !strings.Contains(result.Errors[0].Error(), "transparent_color") {
+		t.Fatalf("errors = %v, want one transparent_color collision", result.Errors)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "build/assets/sprites/demo.png")); err == nil {
+		t.Error("sheet was written despite the collision")
+	}
+}
+
+func TestValidate_SpritePaletteNotFound(t *testing.T) {
+	dir, cfg := setupDemoProject(t)
+	os.WriteFile(filepath.Join(dir, "assets/sprites/demo.sprite"), []byte(`palette = "default"
+grid = 2
+
+[sprite.boss]
+palette = "bos"
+pixels = """
+r_
+_r
+"""
+`), 0644)
+
+	result := Validate(Options{}, cfg, dir)
+
+	if len(result.Errors) != 1 || !strings.Contains(result.Errors[0].Error(), `sprite "boss": palette "bos" not found`) {
+		t.Fatalf("errors = %v, want sprite \"boss\": palette \"bos\" not found", result.Errors)
+	}
+}
+
 func TestValidate_NoOutputCreated(t *testing.T) {
 	dir, cfg := setupDemoProject(t)
 
@@ -228,3 +614,509 @@ func TestValidate_NoOutputCreated(t *testing.T) {
 		t.Error("validate should not create build directory")
 	}
 }
+
+func TestValidate_Diagnostics(t *testing.T) {
+	dir, cfg := setupDemoProject(t)
+
+	bad := filepath.Join(dir, "assets", "sprites", "bad.sprite")
+	if err := os.WriteFile(bad, []byte("grid = \n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result := Validate(Options{}, cfg, dir)
+
+	errs := result.DiagnosticsBySeverity(diagnostic.Error)
+	if len(errs) != 1 {
+		t.Fatalf("got %d error diagnostics, want 1: %v", len(errs), result.Errors)
+	}
+	d := errs[0]
+	if d.File != "assets/sprites/bad.sprite" {
+		t.Errorf("file = %q, want assets/sprites/bad.sprite", d.File)
+	}
+	if d.Line != 1 {
+		t.Errorf("line = %d, want 1", d.Line)
+	}
+	if strings.HasPrefix(d.Message, bad) {
+		t.Errorf("message should not repeat the file path: %q", d.Message)
+	}
+}
+
+func TestResult_WarningSummary(t *testing.T) {
+	r := &Result{root: "/proj"}
+	level := "/proj/assets/maps/level.map"
+	r.addWarning(level, level+": tile 1,1 is odd")
+	r.addWarning("/proj/assets/sfx/zap.sfx", "peak clipped")
+	r.addWarning(level, level+": tile 1,1 is odd")
+	r.addWarning(level, "layer is empty")
+	r.addWarning(level, level+": tile 1,1 is odd")
+	r.addError(level, errors.New("not a warning"))
+	r.addWarning("", "removed 2 partial file(s)")
+
+	got := r.WarningSummary()
+	want := []WarningGroup{
+		{File: "assets/maps/level.map", Total: 4, Warnings: []WarningCount{{Message: "tile 1,1 is odd", Count: 3}, {Message: "layer is empty", Count: 1}}},
+		{File: "assets/sfx/zap.sfx", Total: 1, Warnings: []WarningCount{{Message: "peak clipped", Count: 1}}},
+		{File: "", Total: 1, Warnings: []WarningCount{{Message: "removed 2 partial file(s)", Count: 1}}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("summary = %+v\nwant %+v", got, want)
+	}
+	if len(r.Warnings) != 6 {
+		t.Errorf("Warnings has %d entries, want all 6 kept", len(r.Warnings))
+	}
+}
+
+func TestValidate_InvalidUTF8(t *testing.T) {
+	dir, cfg := setupDemoProject(t)
+
+	bad := filepath.Join(dir, "assets", "sprites", "latin1.sprite")
+	if err := os.WriteFile(bad, []byte("palette = \"default\"\n# caf\xe9\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result := Validate(Options{}, cfg, dir)
+
+	if len(result.Errors) != 1 {
+		t.Fatalf("got %d errors, want 1: %v", len(result.Errors), result.Errors)
+	}
+	if msg := result.Errors[0].Error(); !strings.Contains(msg, "latin1.sprite") || !strings.Contains(msg, "byte 25") {
+		t.Errorf("error = %q, want the file and byte offset", msg)
+	}
+}
+
+func TestBuild_WindowsLineEndings(t *testing.T) {
+	dir, cfg := setupDemoProject(t)
+
+	for _, rel := range []string{"assets/palettes/default.palette", "assets/sprites/demo.sprite"} {
+		path := filepath.Join(dir, rel)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append([]byte("\ufeff"), strings.ReplaceAll(string(data), "\n", "\r\n")...)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result := Build(Options{Scope: ScopeSprites}, cfg, dir)
+
+	for _, e := range result.Errors {
+		t.Errorf("error: %v", e)
+	}
+}
+
+func TestBuild_AnimatedTiles(t *testing.T) {
+	dir, cfg := setupDemoProject(t)
+
+	os.WriteFile(filepath.Join(dir, "assets/sprites/water.sprite"), []byte(`palette = "default"
+grid = 2
+
+[sprite.wave]
+framerate = 6
+[[sprite.wave.frame]]
+pixels = """
+bb
+b_
+"""
+[[sprite.wave.frame]]
+pixels = """
+b_
+bb
+"""
+[[sprite.wave.frame]]
+pixels = """
+_b
+bb
+"""
+`), 0644)
+	os.WriteFile(filepath.Join(dir, "assets/maps/demo.map"), []byte(`tile_size = 2
+[tileset]
+D = { sprite = "demo:dot", animate = true }
+W = { sprite = "water:wave", animate = true, tags = ["liquid"] }
+_ = ""
+[layer.main]
+pixels = """
+DW
+WD
+"""
+`), 0644)
+
+	// Maps only: the sprite phase doesn't run, so the map phase resolves
+	// the sprites itself.
+	result := Build(Options{Scope: ScopeMaps}, cfg, dir)
+	if len(result.Errors) > 0 {
+		t.Fatalf("build errors: %v", result.Errors)
+	}
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "single frame") {
+		t.Errorf("warnings = %v, want one about the single-frame dot", result.Warnings)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "build/assets/maps/demo.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var j tilemap.JSONTilemap
+	if err := json.Unmarshal(data, &j); err != nil {
+		t.Fatal(err)
+	}
+	if w := j.Tileset["W"]; w.Frames != 3 || w.FPS != 6 {
+		t.Errorf("W = %+v, want 3 frames at 6 fps", w)
+	}
+	if d := j.Tileset["D"]; d.Frames != 1 {
+		t.Errorf("D = %+v, want 1 frame", d)
+	}
+}
+
+func TestBuild_TileIDChanges(t *testing.T) {
+	dir, cfg := setupDemoProject(t)
+	writeMap := func(tileset string) {
+		t.Helper()
+		data := "tile_size = 2\n[tileset]\n" + tileset + "\n[layer.main]\npixels = \"\"\"\nD\n\"\"\"\n"
+		if err := os.WriteFile(filepath.Join(dir, "assets/maps/demo.map"), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeMap(`D = "demo:dot"`)
+	if result := Build(Options{Scope: ScopeMaps}, cfg, dir); len(result.Errors) > 0 || len(result.Warnings) > 0 {
+		t.Fatalf("first build: errors %v, warnings %v", result.Errors, result.Warnings)
+	}
+
+	// Pinning D lets a key that sorts before it be added without a shift.
+	writeMap("D = { sprite = \"demo:dot\", id = 1 }\nA = \"demo:dot\"")
+	if result := Build(Options{Scope: ScopeMaps}, cfg, dir); len(result.Warnings) > 0 {
+		t.Errorf("pinned rebuild warned: %v", result.Warnings)
+	}
+
+	// Unpinned, D moves behind A and A takes D's index.
+	writeMap("D = \"demo:dot\"\nA = \"demo:dot\"")
+	result := Build(Options{Scope: ScopeMaps}, cfg, dir)
+	if len(result.Warnings) != 2 ||
+		!strings.Contains(result.Warnings[0], `"A": index changes from 2 to 1`) ||
+		!strings.Contains(result.Warnings[1], `"D": index changes from 1 to 2; add id = 1`) {
+		t.Errorf("warnings = %v, want A and D swapping", result.Warnings)
+	}
+}
+
+func TestBuild_ExportFrames(t *testing.T) {
+	dir, cfg := setupDemoProject(t)
+
+	os.WriteFile(filepath.Join(dir, "assets/sprites/demo.sprite"), []byte(`palette = "default"
+grid = 2
+
+[sprite.dot]
+pixels = """
+r_
+_r
+"""
+
+[sprite.blink]
+frames = true
+[[sprite.blink.frame]]
+pixels = """
+gg
+gg
+"""
+[[sprite.blink.frame]]
+pixels = """
+bb
+bb
+"""
+`), 0644)
+
+	result := Build(Options{Scope: ScopeSprites}, cfg, dir)
+	if len(result.Errors) > 0 {
+		t.Fatalf("build errors: %v", result.Errors)
+	}
+
+	for _, f := range []string{
+		"build/assets/sprites/demo.png",
+		"build/assets/sprites/frames/demo/blink_0.png",
+		"build/assets/sprites/frames/demo/blink_1.png",
+	} {
+		if _, err := os.Stat(filepath.Join(dir, f)); err != nil {
+			t.Errorf("expected artifact %s: %v", f, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "build/assets/sprites/frames/demo/dot_0.png")); err == nil {
+		t.Error("dot did not request frames and should not be exported")
+	}
+
+	manifest, err := os.ReadFile(filepath.Join(dir, "build/assets/manifest.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(manifest), `"demo:blink": {`) {
+		t.Errorf("manifest missing frames entry:\n%s", manifest)
+	}
+}
+
+func TestBuild_ExportPatterns(t *testing.T) {
+	dir, cfg := setupDemoProject(t)
+	cfg.Project.ManifestJSON = true
+	os.WriteFile(filepath.Join(dir, "assets/tracks/jingles.track"), []byte(`tempo = 120
+[[channel]]
+name = "m"
+instrument = "demo"
+[pattern.win]
+data = """
+m
+C4
+E4
+G4
+"""
+[song]
+export_patterns = ["win"]
+export_full = false
+`), 0644)
+
+	result := Build(Options{Scope: ScopeAudio}, cfg, dir)
+	if len(result.Errors) > 0 {
+		t.Fatalf("build errors: %v", result.Errors)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "build/assets/audio/jingles_win.wav")); err != nil {
+		t.Errorf("missing the exported pattern: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "build/assets/audio/jingles.wav")); err == nil {
+		t.Error("export_full = false should not write the song")
+	}
+	data, err := os.ReadFile(result.ManifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`SFXJinglesWin = "audio/jingles_win.wav"`, `SFXJinglesWin: {0.375}`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("manifest missing %s", want)
+		}
+	}
+	if strings.Contains(string(data), "TrackJingles") {
+		t.Error("manifest lists the song export_full = false leaves out")
+	}
+	jsonData, err := os.ReadFile(filepath.Join(dir, "build/assets/manifest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(jsonData), `"name": "jingles_win",
+      "kind": "sfx"`) {
+		t.Errorf("manifest.json should list jingles_win as sfx:\n%s", jsonData)
+	}
+
+	// An exported pattern writes where a sound effect of its name would.
+	os.WriteFile(filepath.Join(dir, "assets/sfx/jingles_win.sfx"), []byte("duration = 0.1\n[[voice]]\nwaveform = \"sine\"\n"), 0644)
+	result = Build(Options{Scope: ScopeAudio}, cfg, dir)
+	if len(result.Errors) != 1 || !strings.Contains(result.Errors[0].Error(), "would write audio/jingles_win.wav") {
+		t.Errorf("errors = %v, want a collision", result.Errors)
+	}
+}
+
+func TestBuild_FormatVersion(t *testing.T) {
+	dir, cfg := setupDemoProject(t)
+
+	os.WriteFile(filepath.Join(dir, "assets/sprites/old.sprite"), []byte(`format_version = 1
+palette = "default"
+
+[sprite.dot]
+pixels = """
+r
+"""
+`), 0644)
+	os.WriteFile(filepath.Join(dir, "assets/sprites/future.sprite"), []byte(`format_version = 7
+palette = "default"
+
+[sprite.dot]
+pixels = """
+r
+"""
+`), 0644)
+
+	result := Build(Options{Scope: ScopeSprites}, cfg, dir)
+	if len(result.Errors) != 1 || !strings.Contains(result.Errors[0].Error(), "format_version 7 is newer") {
+		t.Fatalf("errors = %v, want one for future.sprite", result.Errors)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "build/assets/sprites/old.png")); err != nil {
+		t.Errorf("old.sprite was not built: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "build/assets/sprites/future.png")); err == nil {
+		t.Error("future.sprite was built")
+	}
+}
+
+func TestBuild_GridFromPixels(t *testing.T) {
+	dir, cfg := setupDemoProject(t)
+
+	os.WriteFile(filepath.Join(dir, "assets/sprites/demo.sprite"), []byte(`palette = "default"
+
+[sprite.bar]
+pixels = """
+rrr
+"""
+`), 0644)
+
+	result := Build(Options{Scope: ScopeSprites}, cfg, dir)
+	if len(result.Errors) > 0 {
+		t.Fatalf("build errors: %v", result.Errors)
+	}
+
+	sheet := decodePNG(t, filepath.Join(dir, "build/assets/sprites/demo.png"))
+	if b := sheet.Bounds(); b.Dx() != 3 || b.Dy() != 1 {
+		t.Errorf("sheet = %dx%d, want 3x1", b.Dx(), b.Dy())
+	}
+	manifest, err := os.ReadFile(filepath.Join(dir, "build/assets/manifest.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(manifest), `"demo:bar": {SpriteSheetDemo, 0, 0, 3, 1,`) {
+		t.Errorf("manifest missing a 3x1 bar entry:\n%s", manifest)
+	}
+}
+
+func TestBuild_Scales(t *testing.T) {
+	dir, cfg := setupDemoProject(t)
+	cfg.Project.Scales = []int{1, 2, 4}
+
+	result := Build(Options{Scope: ScopeSprites}, cfg, dir)
+	if len(result.Errors) > 0 {
+		t.Fatalf("build errors: %v", result.Errors)
+	}
+
+	base := decodePNG(t, filepath.Join(dir, "build/assets/sprites/demo.png"))
+	for _, scale := range []int{2, 4} {
+		scaled := decodePNG(t, filepath.Join(dir, "build/assets/sprites", fmt.Sprintf("demo@%dx.png", scale)))
+		bb, sb := base.Bounds(), scaled.Bounds()
+		if sb.Dx() != bb.Dx()*scale || sb.Dy() != bb.Dy()*scale {
+			t.Fatalf("@%dx size = %dx%d, want %dx%d", scale, sb.Dx(), sb.Dy(), bb.Dx()*scale, bb.Dy()*scale)
+		}
+		for y := 0; y < sb.Dy(); y++ {
+			for x := 0; x < sb.Dx(); x++ {
+				if scaled.At(x, y) != base.At(x/scale, y/scale) {
+					t.Fatalf("@%dx pixel (%d,%d) does not match base (%d,%d)", scale, x, y, x/scale, y/scale)
+				}
+			}
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "build/assets/sprites/demo@1x.png")); err == nil {
+		t.Error("scale 1 should not produce a separate file")
+	}
+
+	manifest, err := os.ReadFile(filepath.Join(dir, "build/assets/manifest.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `SpriteSheetDemo: {{"sprites/demo@2x.png", 2}, {"sprites/demo@4x.png", 4}},`
+	if !strings.Contains(string(manifest), want) {
+		t.Errorf("manifest missing %s:\n%s", want, manifest)
+	}
+}
+
+func decodePNG(t *testing.T, path string) image.Image {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+func TestBuild_ComposedSprite(t *testing.T) {
+	dir, cfg := setupDemoProject(t)
+
+	os.WriteFile(filepath.Join(dir, "assets/sprites/demo.sprite"), []byte(`palette = "default"
+grid = 2
+
+[sprite.dot]
+pixels = """
+r_
+_r
+"""
+
+[sprite.body]
+pixels = """
+kk
+kk
+"""
+
+[sprite.hero]
+compose = ["body", "dot"]
+`), 0644)
+
+	result := Build(Options{Scope: ScopeSprites}, cfg, dir)
+	if len(result.Errors) > 0 {
+		t.Fatalf("build errors: %v", result.Errors)
+	}
+
+	manifest, err := os.ReadFile(filepath.Join(dir, "build/assets/manifest.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(manifest), `"demo:hero"`) {
+		t.Error("manifest missing composed sprite demo:hero")
+	}
+	if strings.Contains(string(manifest), `"demo:body"`) || strings.Contains(string(manifest), `"demo:dot"`) {
+		t.Error("part-only sprites should not be in the manifest")
+	}
+}
+
+func TestBuild_FromSprite(t *testing.T) {
+	dir, cfg := setupDemoProject(t)
+
+	os.WriteFile(filepath.Join(dir, "assets/sprites/demo.sprite"), []byte(`palette = "default"
+
+[sprite.walk_right]
+grid = "3x2"
+pixels = """
+rk_
+_rk
+--
+kr_
+r_k
+"""
+
+[sprite.walk_left]
+from = "walk_right"
+flip_x = true
+
+[sprite.walk_up]
+from = "walk_left"
+rotate = 270
+`), 0644)
+
+	result := Build(Options{Scope: ScopeSprites}, cfg, dir)
+	if len(result.Errors) > 0 {
+		t.Fatalf("build errors: %v", result.Errors)
+	}
+	manifest, err := os.ReadFile(filepath.Join(dir, "build/assets/manifest.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"demo:walk_right", "demo:walk_left", "demo:walk_up"} {
+		if !strings.Contains(string(manifest), `"`+name+`"`) {
+			t.Errorf("manifest missing %s", name)
+		}
+	}
+
+	// Rows are in file order: walk_right at y 0-1, walk_left at y 2-3, and
+	// each 3x2 frame of walk_left is its source's mirrored left to right.
+	sheet := decodePNG(t, filepath.Join(dir, "build/assets/sprites/demo.png"))
+	for f := range 2 {
+		for y := range 2 {
+			for x := range 3 {
+				src := sheet.At(f*3+x, y)
+				if got := sheet.At(f*3+2-x, 2+y); got != src {
+					t.Errorf("walk_left frame %d pixel %d,%d = %v, want %v", f, 2-x, y, got, src)
+				}
+			}
+		}
+	}
+
+	cfg.Lint.MaxFromDepth = 1
+	result = Build(Options{Scope: ScopeSprites}, cfg, dir)
+	if len(result.Errors) == 0 || !strings.Contains(result.Errors[0].Error(), "more than the limit of 1") {
+		t.Errorf("errors = %v, want walk_up over the from depth limit", result.Errors)
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+
+	"github.com/vgalaktionov/runefact/internal/atomicfile"
 )
 
 const cacheFileName = ".runefact-cache.json"
@@ -18,9 +20,13 @@ type BuildCache struct {
 
 // LoadCache reads the build cache from the project root.
 func LoadCache(projectRoot string) *BuildCache {
+	return loadCache(filepath.Join(projectRoot, cacheFileName))
+}
+
+func loadCache(path string) *BuildCache {
 	c := &BuildCache{
 		Hashes: make(map[string]string),
-		path:   filepath.Join(projectRoot, cacheFileName),
+		path:   path,
 	}
 
 	data, err := os.ReadFile(c.path)
@@ -34,21 +40,32 @@ func LoadCache(projectRoot string) *BuildCache {
 	return c
 }
 
-// NeedsRebuild returns true if the file has changed since last build.
+// NeedsRebuild returns true if the file has changed since it was last
+// recorded.
 func (c *BuildCache) NeedsRebuild(file string) bool {
-	content, err := os.ReadFile(file)
+	hash, err := hashFile(file)
+	return err != nil || c.Hashes[file] != hash
+}
+
+// Record stores the file's current hash. Call it only once the file's
+// artifacts are in place, so an interrupted build doesn't mark a source
+// as built when its output is missing.
+func (c *BuildCache) Record(file string) error {
+	hash, err := hashFile(file)
 	if err != nil {
-		return true
+		return err
 	}
+	c.Hashes[file] = hash
+	return nil
+}
 
-	hash := sha256.Sum256(content)
-	hashStr := hex.EncodeToString(hash[:])
-
-	if c.Hashes[file] == hashStr {
-		return false
+func hashFile(file string) (string, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
 	}
-	c.Hashes[file] = hashStr
-	return true
+	hash := sha256.Sum256(content)
+	return hex.EncodeToString(hash[:]), nil
 }
 
 // Save persists the cache to disk.
@@ -57,7 +74,7 @@ func (c *BuildCache) Save() error {
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(c.path, data, 0644)
+	return atomicfile.WriteFile(c.path, data, 0644)
 }
 
 // InvalidateDependents marks all files with the given palette dependency as needing rebuild.
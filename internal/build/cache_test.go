@@ -18,7 +18,16 @@ func TestBuildCache_NeedsRebuild(t *testing.T) {
 		t.Error("first check should need rebuild")
 	}
 
-	// Second check: same content, no rebuild.
+	// Not recorded yet, say because the build was interrupted: still needs
+	// rebuild.
+	if !cache.NeedsRebuild(file) {
+		t.Error("unrecorded file should still need rebuild")
+	}
+
+	// Recorded after a successful build: same content, no rebuild.
+	if err := cache.Record(file); err != nil {
+		t.Fatal(err)
+	}
 	if cache.NeedsRebuild(file) {
 		t.Error("unchanged file should not need rebuild")
 	}
@@ -37,7 +46,7 @@ func TestBuildCache_Persistence(t *testing.T) {
 
 	// Populate cache and save.
 	cache1 := LoadCache(dir)
-	cache1.NeedsRebuild(file)
+	cache1.Record(file)
 	if err := cache1.Save(); err != nil {
 		t.Fatalf("saving cache: %v", err)
 	}
@@ -0,0 +1,102 @@
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/vgalaktionov/runefact/internal/instrument"
+	"github.com/vgalaktionov/runefact/internal/palette"
+	"github.com/vgalaktionov/runefact/internal/sprite"
+	"github.com/vgalaktionov/runefact/internal/track"
+)
+
+// closure expands the files of a filtered build to what they need and
+// what needs them: the sprites that use a named palette and the tracks
+// that play a named instrument, then the palettes of every sprite and the
+// instruments of every track in the result. It returns the filter with
+// those files added, and the added files. Files that don't parse are left
+// for the build to report.
+func closure(assetsDirs []string, files []string) (expanded, pulled []string) {
+	expanded = slices.Clone(files)
+	add := func(f string) {
+		if !matchesFilter(f, filepath.Base(f), expanded) {
+			expanded = append(expanded, f)
+			pulled = append(pulled, f)
+		}
+	}
+	// addNamed adds the palette or instrument a sprite or track refers to
+	// by name, if it exists. owners maps declared names to files.
+	addNamed := func(owners map[string]string, subdir, name, ext string) {
+		if p := namedFile(owners, assetsDirs, subdir, name, ext); exists(p) {
+			add(p)
+		}
+	}
+	find := func(subdir, ext string, filter []string) []string {
+		found, _ := searchFiles(assetsDirs, subdir, ext, filter)
+		return found
+	}
+
+	palettes := map[string]bool{}
+	for _, f := range find("palettes", ".palette", files) {
+		palettes[strings.TrimSuffix(filepath.Base(f), ".palette")] = true
+		if p, err := palette.LoadPalette(f); err == nil && p.Name != "" {
+			palettes[p.Name] = true
+		}
+	}
+	if len(palettes) > 0 {
+		for _, f := range find("sprites", ".sprite", nil) {
+			sf, err := sprite.LoadSpriteFile(f)
+			if err == nil && slices.ContainsFunc(sf.PaletteRefs(), func(name string) bool { return palettes[name] }) {
+				add(f)
+			}
+		}
+	}
+
+	instruments := map[string]bool{}
+	for _, f := range find("instruments", ".inst", files) {
+		instruments[strings.TrimSuffix(filepath.Base(f), ".inst")] = true
+		if inst, err := instrument.LoadInstrument(f); err == nil && inst.Name != "" {
+			instruments[inst.Name] = true
+		}
+	}
+	if len(instruments) > 0 {
+		for _, f := range find("tracks", ".track", nil) {
+			tr, err := track.LoadTrack(f)
+			if err == nil && slices.ContainsFunc(tr.Channels, func(ch track.Channel) bool { return instruments[ch.Instrument] }) {
+				add(f)
+			}
+		}
+	}
+
+	// The dependencies of everything selected so far, found by the names
+	// they declare, the way sprites and tracks resolve them.
+	var paletteFiles, instrumentFiles map[string]string
+	for _, f := range find("sprites", ".sprite", expanded) {
+		if sf, err := sprite.LoadSpriteFile(f); err == nil {
+			if paletteFiles == nil {
+				paletteFiles = namedFiles(assetsDirs, "palettes", ".palette")
+			}
+			for _, name := range sf.PaletteRefs() {
+				addNamed(paletteFiles, "palettes", name, ".palette")
+			}
+		}
+	}
+	for _, f := range find("tracks", ".track", expanded) {
+		if tr, err := track.LoadTrack(f); err == nil {
+			if instrumentFiles == nil {
+				instrumentFiles = namedFiles(assetsDirs, "instruments", ".inst")
+			}
+			for _, ch := range tr.Channels {
+				addNamed(instrumentFiles, "instruments", ch.Instrument, ".inst")
+			}
+		}
+	}
+	return expanded, pulled
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
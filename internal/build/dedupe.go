@@ -0,0 +1,380 @@
+package build
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/vgalaktionov/runefact/internal/palette"
+	"github.com/vgalaktionov/runefact/internal/sprite"
+)
+
+// DuplicateColors is a group of palette keys with the same color, which
+// spend key space on one color and let art drift between the keys.
+type DuplicateColors struct {
+	// File is the .palette file, or the .sprite file whose palette_extend
+	// repeats a color of its palette or of itself.
+	File  string
+	Color string // "#rrggbb", or "#rrggbbaa" if not opaque
+	// Keys are the keys with the color, the suggested one first. The
+	// others are defined in File; for a palette_extend group the first
+	// may be a palette key.
+	Keys []string
+	// Pixels counts the pixels drawn with each key in the project's
+	// sprites.
+	Pixels map[string]int
+}
+
+func (d DuplicateColors) String() string {
+	uses := make([]string, len(d.Keys))
+	for i, k := range d.Keys {
+		uses[i] = fmt.Sprintf("%s: %d px", k, d.Pixels[k])
+	}
+	quoted := make([]string, len(d.Keys))
+	for i, k := range d.Keys {
+		quoted[i] = fmt.Sprintf("%q", k)
+	}
+	return fmt.Sprintf("keys %s are all %s (%s); keep %q", strings.Join(quoted, ", "), d.Color, strings.Join(uses, ", "), d.Keys[0])
+}
+
+// dedupeProject is what finding and fixing duplicate colors read: the
+// project's own palettes and sprites, by file.
+type dedupeProject struct {
+	assetsDir    string
+	paletteFiles []string
+	spriteFiles  []string
+	palettes     map[string]*palette.Palette // by name
+	paletteFile  map[string]string           // palette name to file
+	sprites      map[string]*sprite.SpriteFile
+}
+
+func loadDedupeProject(projectRoot string) *dedupeProject {
+	assetsDir := filepath.Join(projectRoot, "assets")
+	p := &dedupeProject{
+		assetsDir:    assetsDir,
+		paletteFiles: discoverFiles(filepath.Join(assetsDir, "palettes"), ".palette", nil),
+		spriteFiles:  discoverFiles(filepath.Join(assetsDir, "sprites"), ".sprite", nil),
+		palettes:     map[string]*palette.Palette{},
+		paletteFile:  map[string]string{},
+		sprites:      map[string]*sprite.SpriteFile{},
+	}
+	for _, f := range p.paletteFiles {
+		if pal, err := palette.LoadPalette(f); err == nil {
+			p.palettes[pal.Name] = pal
+			p.paletteFile[pal.Name] = f
+		}
+	}
+	for _, f := range p.spriteFiles {
+		if sf, err := sprite.LoadSpriteFile(f); err == nil {
+			p.sprites[f] = sf
+		}
+	}
+	return p
+}
+
+// FindDuplicateColors lists the groups of keys with the same color in the
+// project's palettes, and in each sprite file's palette_extend together
+// with its palette. Files that fail to parse are skipped; validation
+// reports them.
+func FindDuplicateColors(projectRoot string) []DuplicateColors {
+	return loadDedupeProject(projectRoot).duplicates()
+}
+
+func (p *dedupeProject) duplicates() []DuplicateColors {
+	// Count the pixels drawn with each key, under the palette it comes
+	// from or under the file whose palette_extend defines it.
+	palettePixels := map[string]map[string]int{}
+	extendPixels := map[string]map[string]int{}
+	for _, f := range p.spriteFiles {
+		sf := p.sprites[f]
+		if sf == nil {
+			continue
+		}
+		extendPixels[f] = map[string]int{}
+		for _, s := range sf.Sprites {
+			pal := cmp.Or(s.Palette, sf.PaletteRef)
+			if palettePixels[pal] == nil {
+				palettePixels[pal] = map[string]int{}
+			}
+			for _, fr := range s.Frames {
+				for _, row := range fr.Pixels {
+					for _, key := range row {
+						if _, ok := sf.PaletteExtend[key]; ok {
+							extendPixels[f][key]++
+						} else {
+							palettePixels[pal][key]++
+						}
+					}
+				}
+			}
+		}
+	}
+
+	var groups []DuplicateColors
+	canonical := map[string]map[palette.Color]string{} // palette name, color: kept key
+	for _, f := range p.paletteFiles {
+		var pal *palette.Palette
+		for _, candidate := range p.palettes {
+			if p.paletteFile[candidate.Name] == f {
+				pal = candidate
+			}
+		}
+		if pal == nil {
+			continue
+		}
+		canonical[pal.Name] = map[palette.Color]string{}
+		for c, keys := range groupByColor(pal.Colors) {
+			slices.SortFunc(keys, byUse(palettePixels[pal.Name]))
+			canonical[pal.Name][c] = keys[0]
+			if len(keys) > 1 {
+				groups = append(groups, DuplicateColors{File: f, Color: hexColor(c), Keys: keys, Pixels: pick(palettePixels[pal.Name], keys)})
+			}
+		}
+	}
+
+	for _, f := range p.spriteFiles {
+		sf := p.sprites[f]
+		if sf == nil || len(sf.PaletteExtend) == 0 {
+			continue
+		}
+		extend := map[string]palette.Color{}
+		for k, hex := range sf.PaletteExtend {
+			if c, err := palette.ParseHexColor(hex); err == nil {
+				extend[k] = c
+			}
+		}
+		// A palette key is kept over extend keys, since other files
+		// use it, but only if every sprite of the file draws with that
+		// palette.
+		var base map[palette.Color]string
+		if pal := p.palettes[sf.PaletteRef]; pal != nil && !slices.ContainsFunc(sf.Sprites, func(s sprite.Sprite) bool {
+			return s.Palette != "" && s.Palette != sf.PaletteRef
+		}) {
+			base = canonical[pal.Name]
+		}
+		for c, keys := range groupByColor(extend) {
+			slices.SortFunc(keys, byUse(extendPixels[f]))
+			pixels := pick(extendPixels[f], keys)
+			kept, ok := base[c]
+			if _, shadowed := sf.PaletteExtend[kept]; ok && !shadowed {
+				keys = append([]string{kept}, keys...)
+				pixels[kept] = palettePixels[sf.PaletteRef][kept]
+			}
+			if len(keys) > 1 {
+				groups = append(groups, DuplicateColors{File: f, Color: hexColor(c), Keys: keys, Pixels: pixels})
+			}
+		}
+	}
+
+	slices.SortFunc(groups, func(a, b DuplicateColors) int {
+		return cmp.Or(cmp.Compare(a.File, b.File), cmp.Compare(a.Keys[0], b.Keys[0]))
+	})
+	return groups
+}
+
+// groupByColor returns the keys of colors by their color.
+func groupByColor(colors map[string]palette.Color) map[palette.Color][]string {
+	groups := map[palette.Color][]string{}
+	for k, c := range colors {
+		groups[c] = append(groups[c], k)
+	}
+	return groups
+}
+
+// byUse orders keys by which to keep: "_", which is always transparent,
+// then the most used, then the shortest, leaving more key space, then by
+// name.
+func byUse(pixels map[string]int) func(a, b string) int {
+	return func(a, b string) int {
+		return cmp.Or(
+			boolOrder(a == "_", b == "_"),
+			cmp.Compare(pixels[b], pixels[a]),
+			cmp.Compare(len(a), len(b)),
+			cmp.Compare(a, b),
+		)
+	}
+}
+
+func boolOrder(a, b bool) int {
+	switch {
+	case a && !b:
+		return -1
+	case b && !a:
+		return 1
+	}
+	return 0
+}
+
+func pick(counts map[string]int, keys []string) map[string]int {
+	out := make(map[string]int, len(keys))
+	for _, k := range keys {
+		out[k] = counts[k]
+	}
+	return out
+}
+
+func hexColor(c palette.Color) string {
+	if c.A == 255 {
+		return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+	}
+	return fmt.Sprintf("#%02x%02x%02x%02x", c.R, c.G, c.B, c.A)
+}
+
+// reportDuplicateColors adds a hint for each group of keys with the same
+// color.
+func (r *Result) reportDuplicateColors(projectRoot string) {
+	for _, d := range FindDuplicateColors(projectRoot) {
+		r.addHint(d.File, fmt.Sprintf("%s: %s, or run runefact palette dedupe", d.File, d))
+	}
+}
+
+// PlanDedupe computes the rewrites that merge each group of duplicate
+// colors into its first key: pixel grids drawn with the other keys switch
+// to it, and the other keys are removed from their palette or
+// palette_extend. Every sprite is rendered before and after; if any would
+// look different or break, the error lists them and no changes are
+// returned.
+func PlanDedupe(projectRoot string) ([]DuplicateColors, []FileChange, error) {
+	p := loadDedupeProject(projectRoot)
+	groups := p.duplicates()
+	if len(groups) == 0 {
+		return nil, nil, nil
+	}
+
+	// Keys to replace in pixel grids, by palette name and by sprite file,
+	// and keys to remove, by file.
+	paletteRenames := map[string]map[string]string{}
+	extendRenames := map[string]map[string]string{}
+	removed := map[string]map[string]bool{}
+	for _, g := range groups {
+		renames := extendRenames
+		owner := g.File
+		if filepath.Ext(g.File) == ".palette" {
+			renames = paletteRenames
+			owner = p.paletteName(g.File)
+		}
+		if renames[owner] == nil {
+			renames[owner] = map[string]string{}
+		}
+		if removed[g.File] == nil {
+			removed[g.File] = map[string]bool{}
+		}
+		for _, k := range g.Keys[1:] {
+			renames[owner][k] = g.Keys[0]
+			removed[g.File][k] = true
+		}
+	}
+
+	var changes []FileChange
+	contents := map[string][]byte{}
+	updated := map[string][]byte{}
+	for _, f := range p.paletteFiles {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, nil, err
+		}
+		contents[f], updated[f] = data, data
+		out, n := palette.RemoveColorsSource(data, ".palette", func(key string) bool { return removed[f][key] })
+		// Aliases of a removed key name the kept one instead.
+		out, aliases := palette.RetargetAliasesSource(out, paletteRenames[p.paletteName(f)])
+		if n+aliases > 0 {
+			changes = append(changes, FileChange{Path: f, Count: n + aliases, Data: out})
+			updated[f] = out
+		}
+	}
+	for _, f := range p.spriteFiles {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, nil, err
+		}
+		contents[f], updated[f] = data, data
+		sf := p.sprites[f]
+		if sf == nil {
+			continue
+		}
+		out, pixels := sprite.RekeySource(data, func(name string) map[string]string {
+			pal := sf.PaletteRef
+			if i := slices.IndexFunc(sf.Sprites, func(s sprite.Sprite) bool { return s.Name == name }); i >= 0 {
+				pal = cmp.Or(sf.Sprites[i].Palette, pal)
+			}
+			keys := map[string]string{}
+			for from, to := range paletteRenames[pal] {
+				if _, ok := sf.PaletteExtend[from]; !ok {
+					keys[from] = to
+				}
+			}
+			maps.Copy(keys, extendRenames[f])
+			return keys
+		})
+		out, keys := palette.RemoveColorsSource(out, ".sprite", func(key string) bool { return removed[f][key] })
+		if pixels+keys > 0 {
+			changes = append(changes, FileChange{Path: f, Count: pixels + keys, Data: out})
+			updated[f] = out
+		}
+	}
+
+	before := p.renderAll(contents)
+	after := p.renderAll(updated)
+	var errs []error
+	for _, f := range p.spriteFiles {
+		switch {
+		case after[f].err != nil && before[f].err == nil:
+			errs = append(errs, after[f].err)
+		case before[f].err == nil && !reflect.DeepEqual(before[f].sprites, after[f].sprites):
+			errs = append(errs, fmt.Errorf("%s: sprites would change color", f))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, nil, fmt.Errorf("dedupe would change %d file(s), nothing was written:\n%w", len(errs), errors.Join(errs...))
+	}
+	return groups, changes, nil
+}
+
+func (p *dedupeProject) paletteName(file string) string {
+	for name, f := range p.paletteFile {
+		if f == file {
+			return name
+		}
+	}
+	return ""
+}
+
+type rendered struct {
+	sprites []sprite.ResolvedSprite
+	err     error
+}
+
+// renderAll parses the palettes and sprites in contents and resolves every
+// sprite file.
+func (p *dedupeProject) renderAll(contents map[string][]byte) map[string]rendered {
+	palettes := map[string]*palette.Palette{}
+	for _, f := range p.paletteFiles {
+		if pal, err := palette.ParsePalette(contents[f], f); err == nil {
+			palettes[pal.Name] = pal
+		}
+	}
+	out := map[string]rendered{}
+	for _, f := range p.spriteFiles {
+		sf, err := sprite.ParseSpriteFile(contents[f], f)
+		if err != nil {
+			out[f] = rendered{err: err}
+			continue
+		}
+		pal := palettes[sf.PaletteRef]
+		if pal == nil {
+			pal = &palette.Palette{Colors: map[string]palette.Color{}}
+		}
+		resolved, err := sf.ResolveWith(pal, sprite.DirPartLoader(p.assetsDir), paletteLoader(palettes, p.assetsDir))
+		if err != nil {
+			err = fmt.Errorf("%s: %w", f, err)
+		}
+		out[f] = rendered{sprites: resolved, err: err}
+	}
+	return out
+}
@@ -0,0 +1,116 @@
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPlanDedupe(t *testing.T) {
+	dir, cfg := setupDemoProject(t)
+	cfg.Keep.Sprites = []string{"demo:mix"}
+	palPath := filepath.Join(dir, "assets/palettes/default.palette")
+	os.WriteFile(palPath, []byte(`name = "default"
+[colors]
+_ = "transparent"
+r = "#ff0000"
+red = "#FF0000"
+g = "#00ff00"
+b = "#0000ff"
+k = "#000000"
+[aliases]
+crimson = "red"
+`), 0644)
+	spritePath := filepath.Join(dir, "assets/sprites/demo.sprite")
+	os.WriteFile(spritePath, []byte(`palette = "default"
+grid = 2
+palette_extend = { x = "#00ff00", y = "#123456", z = "#123456", yy = "#123456" }
+
+[sprite.dot]
+pixels = """
+r_
+_[red]
+"""
+
+[sprite.mix]
+pixels = """
+xy
+zy
+"""
+`), 0644)
+
+	result := Validate(Options{}, cfg, dir)
+	all := strings.Join(result.Hints, "\n")
+	for _, want := range []string{
+		`default.palette: keys "r", "red" are all #ff0000 (r: 1 px, red: 1 px); keep "r"`,
+		`demo.sprite: keys "g", "x" are all #00ff00 (g: 0 px, x: 1 px); keep "g"`,
+		`demo.sprite: keys "y", "z", "yy" are all #123456 (y: 2 px, z: 1 px, yy: 0 px); keep "y"`,
+	} {
+		if !strings.Contains(all, want) {
+			t.Errorf("missing hint %q in:\n%s", want, all)
+		}
+	}
+	if partial := Validate(Options{Files: []string{"demo.sprite"}}, cfg, dir); len(partial.Hints) != 0 {
+		t.Errorf("partial validate should not report duplicate colors: %v", partial.Hints)
+	}
+
+	groups, changes, err := PlanDedupe(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 3 {
+		t.Errorf("groups = %+v, want 3", groups)
+	}
+	if len(changes) != 2 || changes[0].Path != palPath || changes[1].Path != spritePath {
+		t.Fatalf("changes = %+v, want the palette and demo.sprite", changes)
+	}
+	if data, _ := os.ReadFile(palPath); !strings.Contains(string(data), "red") {
+		t.Error("planning should not write")
+	}
+	if err := WriteChanges(changes); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(palPath); strings.Contains(string(data), "red =") || !strings.Contains(string(data), `crimson = "r"`) {
+		t.Errorf("red not removed, or its alias not moved to r:\n%s", data)
+	}
+	data, _ := os.ReadFile(spritePath)
+	for _, want := range []string{`palette_extend = { y = "#123456" }`, "r_\n_r\n", "gy\nyy\n"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("demo.sprite has no %q:\n%s", want, data)
+		}
+	}
+	if result := Validate(Options{}, cfg, dir); len(result.Errors) > 0 || len(result.Hints) != 0 {
+		t.Errorf("after dedupe: errors = %v, hints = %v", result.Errors, result.Hints)
+	}
+}
+
+func TestPlanDedupe_WouldChangeColors(t *testing.T) {
+	dir, _ := setupDemoProject(t)
+	os.WriteFile(filepath.Join(dir, "assets/palettes/default.palette"), []byte(`name = "default"
+[colors]
+r = "#ff0000"
+red = "#ff0000"
+`), 0644)
+	// r is kept, being used more, but demo.sprite's palette_extend
+	// shadows it with another color.
+	os.WriteFile(filepath.Join(dir, "assets/sprites/demo.sprite"), []byte(`palette = "default"
+grid = 1
+palette_extend = { r = "#00ff00" }
+[sprite.dot]
+pixels = "[red]"
+`), 0644)
+	os.WriteFile(filepath.Join(dir, "assets/sprites/more.sprite"), []byte(`palette = "default"
+grid = 2
+[sprite.dots]
+pixels = """
+rr
+rr
+"""
+`), 0644)
+
+	_, changes, err := PlanDedupe(dir)
+	if err == nil || !strings.Contains(err.Error(), "nothing was written") {
+		t.Errorf("changes = %+v, err = %v; want an error", changes, err)
+	}
+}
@@ -0,0 +1,126 @@
+package build
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+
+	toml "github.com/pelletier/go-toml/v2"
+
+	"github.com/vgalaktionov/runefact/internal/diagnostic"
+)
+
+// addError records err for the given source file. The plain error is kept
+// in Errors; a located copy is appended to Diagnostics.
+func (r *Result) addError(file string, err error) {
+	r.Errors = append(r.Errors, err)
+	r.Diagnostics = append(r.Diagnostics, r.locate(file, diagnostic.Error, err.Error(), err))
+}
+
+// addIOError records err, a failure to read or write a file, as an
+// IOError, so callers can tell it from an error in the assets.
+func (r *Result) addIOError(file string, err error) {
+	r.addError(file, &IOError{Err: err})
+}
+
+// addWarning records a warning message for the given source file.
+func (r *Result) addWarning(file, msg string) {
+	r.Warnings = append(r.Warnings, msg)
+	r.Diagnostics = append(r.Diagnostics, r.locate(file, diagnostic.Warning, msg, nil))
+}
+
+// addCellWarning is addWarning for a warning about map cells, which keeps
+// every cell on the diagnostic.
+func (r *Result) addCellWarning(file, msg string, cells [][2]int) {
+	r.addWarning(file, msg)
+	r.Diagnostics[len(r.Diagnostics)-1].Cells = cells
+}
+
+// locate builds a Diagnostic with a project-relative file path. The
+// "<file>: " prefix parsers put on messages is stripped, TOML decode errors
+// contribute their line and column, and LineErrors their line.
+func (r *Result) locate(file string, sev diagnostic.Severity, msg string, err error) diagnostic.Diagnostic {
+	d := diagnostic.Diagnostic{Severity: sev, Message: msg}
+	if file == "" {
+		return d
+	}
+
+	d.File = file
+	if r.root != "" {
+		if rel, relErr := filepath.Rel(r.root, file); relErr == nil && !strings.HasPrefix(rel, "..") {
+			d.File = filepath.ToSlash(rel)
+		}
+	}
+	for _, prefix := range []string{file + ": ", filepath.Base(file) + ": "} {
+		if strings.HasPrefix(d.Message, prefix) {
+			d.Message = strings.TrimPrefix(d.Message, prefix)
+			break
+		}
+	}
+
+	var de *toml.DecodeError
+	var le *diagnostic.LineError
+	switch {
+	case err == nil:
+	case errors.As(err, &de):
+		d.Line, d.Column = de.Position()
+	case errors.As(err, &le):
+		d.Line = le.Line
+	}
+	return d
+}
+
+// DiagnosticsBySeverity returns the diagnostics with the given severity.
+func (r *Result) DiagnosticsBySeverity(sev diagnostic.Severity) []diagnostic.Diagnostic {
+	var out []diagnostic.Diagnostic
+	for _, d := range r.Diagnostics {
+		if d.Severity == sev {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// WarningGroup is the warnings about one source file, with identical
+// messages merged, in the order they were first reported.
+type WarningGroup struct {
+	File     string         `json:"file"` // project-relative; "" for the build as a whole
+	Total    int            `json:"total"`
+	Warnings []WarningCount `json:"warnings"`
+}
+
+// WarningCount is a warning message and how many times it was reported.
+// Cells are those of the message's first diagnostic, for the CLI's
+// verbose listing; MCP clients read them from the full diagnostics.
+type WarningCount struct {
+	Message string   `json:"message"`
+	Count   int      `json:"count"`
+	Cells   [][2]int `json:"-"`
+}
+
+// WarningSummary groups the warning diagnostics by file, in the order the
+// files first reported one. It is for presentation; Warnings and
+// Diagnostics keep every occurrence.
+func (r *Result) WarningSummary() []WarningGroup {
+	var groups []WarningGroup
+	byFile := make(map[string]int)
+	byMessage := make(map[[2]string]int)
+	for _, d := range r.DiagnosticsBySeverity(diagnostic.Warning) {
+		gi, ok := byFile[d.File]
+		if !ok {
+			gi = len(groups)
+			byFile[d.File] = gi
+			groups = append(groups, WarningGroup{File: d.File})
+		}
+		g := &groups[gi]
+		g.Total++
+		key := [2]string{d.File, d.Message}
+		if wi, ok := byMessage[key]; ok {
+			g.Warnings[wi].Count++
+			continue
+		}
+		byMessage[key] = len(g.Warnings)
+		g.Warnings = append(g.Warnings, WarningCount{Message: d.Message, Count: 1, Cells: d.Cells})
+	}
+	return groups
+}
@@ -0,0 +1,121 @@
+package build
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+
+	"github.com/vgalaktionov/runefact/internal/instrument"
+	"github.com/vgalaktionov/runefact/internal/palette"
+	"github.com/vgalaktionov/runefact/internal/sprite"
+)
+
+// assetDirs maps each rune file extension to its directory under assets/,
+// in the order a build reads them.
+var assetDirs = []struct{ ext, dir string }{
+	{".palette", "palettes"},
+	{".sprite", "sprites"},
+	{".map", "maps"},
+	{".inst", "instruments"},
+	{".sfx", "sfx"},
+	{".track", "tracks"},
+}
+
+// AssetFiles lists the project's rune files with the given extensions, or
+// all of them when none are given, found the same way a build finds them.
+func AssetFiles(projectRoot string, exts ...string) []string {
+	var files []string
+	for _, d := range assetDirs {
+		if len(exts) > 0 && !slices.Contains(exts, d.ext) {
+			continue
+		}
+		files = append(files, discoverFiles(filepath.Join(projectRoot, "assets", d.dir), d.ext, nil)...)
+	}
+	return files
+}
+
+// shadow is a file left out of discovery because a file of the same name
+// was found in an earlier assets directory.
+type shadow struct{ file, by string }
+
+// searchFiles is discoverFiles over subdir of each assets directory in
+// order, keeping the first file of each name and returning the others as
+// shadowed.
+func searchFiles(assetsDirs []string, subdir, ext string, filter []string) ([]string, []shadow) {
+	var files []string
+	var shadowed []shadow
+	seen := map[string]string{}
+	for _, dir := range assetsDirs {
+		for _, f := range discoverFiles(filepath.Join(dir, subdir), ext, filter) {
+			if by, ok := seen[filepath.Base(f)]; ok {
+				shadowed = append(shadowed, shadow{file: f, by: by})
+				continue
+			}
+			seen[filepath.Base(f)] = f
+			files = append(files, f)
+		}
+	}
+	return files, shadowed
+}
+
+// shadowedName reports whether name, read from file, already belongs to a
+// palette or instrument from an earlier assets directory, and warns if so.
+// Names are what sprites and tracks refer to, so a local palette named
+// "forest" shadows an included one even if their file names differ. owners
+// maps each name to the file it came from.
+func (r *Result) shadowedName(owners map[string]string, name, file string) bool {
+	if prev, ok := owners[name]; ok && filepath.Dir(prev) != filepath.Dir(file) {
+		r.addWarning(prev, fmt.Sprintf("%s: shadows %q from %s, an included project", prev, name, file))
+		return true
+	}
+	owners[name] = file
+	return false
+}
+
+// namedFiles maps the name each palette or instrument under subdir
+// declares to its file, the way a build resolves them: an earlier assets
+// directory keeps its names. Files that don't parse are left out.
+func namedFiles(assetsDirs []string, subdir, ext string) map[string]string {
+	files, _ := searchFiles(assetsDirs, subdir, ext, nil)
+	owners := map[string]string{}
+	for _, f := range files {
+		var name string
+		switch ext {
+		case ".palette":
+			p, err := palette.LoadPalette(f)
+			if err != nil {
+				continue
+			}
+			name = p.Name
+		case ".inst":
+			inst, err := instrument.LoadInstrument(f)
+			if err != nil {
+				continue
+			}
+			name = inst.Name
+		}
+		if prev, ok := owners[name]; !ok || filepath.Dir(prev) == filepath.Dir(f) {
+			owners[name] = f
+		}
+	}
+	return owners
+}
+
+// namedFile returns the file of the palette or instrument a sprite or
+// track calls name: the one that declares it in owners, or else the file
+// called name+ext as FindFile finds it, where the loaders fall back to.
+func namedFile(owners map[string]string, assetsDirs []string, subdir, name, ext string) string {
+	if f, ok := owners[name]; ok {
+		return f
+	}
+	return sprite.FindFile(subdirs(assetsDirs, subdir), name+ext)
+}
+
+// checkIncludes reports included projects that have no assets directory.
+func (r *Result) checkIncludes(assetsDirs []string) {
+	for _, dir := range assetsDirs[1:] {
+		if !dirExists(dir) {
+			r.addError("", fmt.Errorf("include %s: no assets directory at %s", filepath.Dir(dir), dir))
+		}
+	}
+}
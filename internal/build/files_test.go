@@ -0,0 +1,96 @@
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vgalaktionov/runefact/internal/config"
+)
+
+func TestAssetFiles(t *testing.T) {
+	dir, _ := setupDemoProject(t)
+	// Stray files in the asset dirs aren't rune files.
+	os.WriteFile(filepath.Join(dir, "assets/sprites/notes.txt"), []byte("todo"), 0644)
+	os.WriteFile(filepath.Join(dir, "assets/sprites/.demo.sprite.swp"), []byte{}, 0644)
+
+	var names []string
+	for _, f := range AssetFiles(dir) {
+		names = append(names, filepath.Base(f))
+	}
+	want := []string{"default.palette", "demo.sprite", "demo.map", "demo.inst", "blip.sfx", "demo.track"}
+	if len(names) != len(want) {
+		t.Fatalf("AssetFiles = %v, want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Errorf("AssetFiles = %v, want %v", names, want)
+			break
+		}
+	}
+
+	sprites := AssetFiles(dir, ".sprite")
+	if len(sprites) != 1 || filepath.Base(sprites[0]) != "demo.sprite" {
+		t.Errorf("AssetFiles(.sprite) = %v", sprites)
+	}
+}
+
+func TestBuild_Include(t *testing.T) {
+	dir, cfg := setupDemoProject(t)
+	pack := filepath.Join(t.TempDir(), "forest")
+	for _, d := range []string{"assets/palettes", "assets/sprites"} {
+		os.MkdirAll(filepath.Join(pack, d), 0755)
+	}
+	os.WriteFile(filepath.Join(pack, "assets/palettes/forest.palette"), []byte(`name = "forest"
+[colors]
+g = "#228822"
+`), 0644)
+	os.WriteFile(filepath.Join(pack, "assets/sprites/tree.sprite"), []byte(`palette = "forest"
+grid = 1
+
+[sprite.tree]
+pixels = "g"
+`), 0644)
+	// Shadowed by the project's own demo.sprite.
+	os.WriteFile(filepath.Join(pack, "assets/sprites/demo.sprite"), []byte(`palette = "forest"
+grid = 1
+
+[sprite.bush]
+pixels = "g"
+`), 0644)
+	// A local sprite can use an included palette.
+	os.WriteFile(filepath.Join(dir, "assets/sprites/hero.sprite"), []byte(`palette = "forest"
+grid = 1
+
+[sprite.hero]
+pixels = "g"
+`), 0644)
+	cfg.Include = []config.IncludeEntry{{Path: pack}}
+
+	result := Build(Options{Scope: ScopeSprites}, cfg, dir)
+	if len(result.Errors) > 0 {
+		t.Fatalf("build errors: %v", result.Errors)
+	}
+	for _, name := range []string{"tree.png", "hero.png", "demo.png"} {
+		if _, err := os.Stat(filepath.Join(dir, "build/assets/sprites", name)); err != nil {
+			t.Errorf("%s not built in the project's output: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(pack, "build")); err == nil {
+		t.Error("build wrote into the included project")
+	}
+	var shadowed bool
+	for _, w := range result.Warnings {
+		shadowed = shadowed || strings.Contains(w, "shadows") && strings.Contains(w, "demo.sprite")
+	}
+	if !shadowed {
+		t.Errorf("warnings = %v, want demo.sprite shadowing the included one", result.Warnings)
+	}
+
+	cfg.Include = []config.IncludeEntry{{Path: filepath.Join(pack, "missing")}}
+	result = Validate(Options{}, cfg, dir)
+	if len(result.Errors) == 0 || !strings.Contains(result.Errors[0].Error(), "no assets directory") {
+		t.Errorf("errors = %v, want a missing include", result.Errors)
+	}
+}
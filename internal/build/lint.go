@@ -0,0 +1,211 @@
+package build
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/vgalaktionov/runefact/internal/config"
+	"github.com/vgalaktionov/runefact/internal/palette"
+	"github.com/vgalaktionov/runefact/internal/sprite"
+)
+
+// sheetOptions returns the sprite sheet layout set in [project].
+func sheetOptions(cfg *config.ProjectConfig) sprite.SheetOptions {
+	return sprite.SheetOptions{Layout: sprite.Layout(cfg.Project.SheetLayout), POT: cfg.Project.POT}
+}
+
+// checkSheetSize reports whether the sheet RenderSheet would produce for
+// sprites exceeds limit pixels in either dimension. The message names the
+// computed size and the first sprite, in file order, that pushed it over.
+// A limit of 0 disables the check.
+func checkSheetSize(sprites []sprite.ResolvedSprite, opts sprite.SheetOptions, limit int) (string, bool) {
+	if limit <= 0 {
+		return "", false
+	}
+
+	w, h, err := sprite.SheetSize(sprites, opts)
+	if err != nil || (w <= limit && h <= limit) {
+		return "", false
+	}
+	return fmt.Sprintf("sprite sheet is %dx%d, exceeding lint.max_sheet_size %d (sprite %q pushed it over)",
+		w, h, limit, sheetCulprit(sprites, opts, limit).Name), true
+}
+
+// sheetCulprit returns the first sprite, in file order, whose sheet grows
+// past limit pixels in either dimension.
+func sheetCulprit(sprites []sprite.ResolvedSprite, opts sprite.SheetOptions, limit int) sprite.ResolvedSprite {
+	for i := range sprites {
+		if pw, ph, _ := sprite.SheetSize(sprites[:i+1], opts); pw > limit || ph > limit {
+			return sprites[i]
+		}
+	}
+	return sprites[len(sprites)-1]
+}
+
+// checkSpriteLimits returns the sprites with more frames than
+// lint.max_frames_per_sprite, and the sheet if it is larger than
+// lint.max_sheet_dimension. A sheet already held to a max_sheet_size no
+// larger than that is left to checkSheetSize. A limit of -1 turns its
+// check off.
+func checkSpriteLimits(sprites []sprite.ResolvedSprite, opts sprite.SheetOptions, lint config.LintSection) []string {
+	var msgs []string
+	if limit := lint.MaxFramesPerSprite; limit > 0 {
+		for _, s := range sprites {
+			if len(s.Frames) > limit {
+				msgs = append(msgs, fmt.Sprintf("sprite %q has %d frames, more than lint.max_frames_per_sprite %d; split the animation or raise the limit",
+					s.Name, len(s.Frames), limit))
+			}
+		}
+	}
+
+	limit := lint.MaxSheetDimension
+	if limit <= 0 || len(sprites) == 0 || (lint.MaxSheetSize > 0 && lint.MaxSheetSize <= limit) {
+		return msgs
+	}
+	w, h, err := sprite.SheetSize(sprites, opts)
+	if err != nil || (w <= limit && h <= limit) {
+		return msgs
+	}
+	s := sheetCulprit(sprites, opts, limit)
+	return append(msgs, fmt.Sprintf("sprite sheet is %dx%d, more than lint.max_sheet_dimension %d that many engines can load (sprite %q, %d frame(s) of %dx%d, pushed it over)",
+		w, h, limit, s.Name, len(s.Frames), s.Grid.W, s.Grid.H))
+}
+
+// reportSheetSize records an oversized sheet as an error in strict mode and
+// as a warning otherwise. It returns true if an error was recorded.
+func (r *Result) reportSheetSize(file string, sprites []sprite.ResolvedSprite, opts sprite.SheetOptions, limit int, strict bool) bool {
+	msg, over := checkSheetSize(sprites, opts, limit)
+	if !over {
+		return false
+	}
+	if strict {
+		r.addError(file, fmt.Errorf("%s: %s", file, msg))
+		return true
+	}
+	r.addWarning(file, fmt.Sprintf("%s: %s", file, msg))
+	return false
+}
+
+// reportSpriteLimits records checkSpriteLimits findings as errors in strict
+// mode and as warnings otherwise. It returns true if an error was recorded.
+func (r *Result) reportSpriteLimits(file string, sprites []sprite.ResolvedSprite, opts sprite.SheetOptions, lint config.LintSection) bool {
+	msgs := checkSpriteLimits(sprites, opts, lint)
+	for _, msg := range msgs {
+		if lint.Strict {
+			r.addError(file, fmt.Errorf("%s: %s", file, msg))
+		} else {
+			r.addWarning(file, fmt.Sprintf("%s: %s", file, msg))
+		}
+	}
+	return lint.Strict && len(msgs) > 0
+}
+
+// checkFrames returns hints for likely animation mistakes: a frame with no
+// visible pixels, or an animated sprite whose frames are all identical,
+// usually a copy-pasted frame that was never edited. Frames are numbered
+// from 1, as in parse errors.
+func checkFrames(s sprite.ResolvedSprite) []string {
+	var empty []string
+	for i, f := range s.Frames {
+		if frameEmpty(f) {
+			empty = append(empty, strconv.Itoa(i+1))
+		}
+	}
+
+	var hints []string
+	switch {
+	case len(s.Frames) == 1 && len(empty) == 1:
+		hints = append(hints, fmt.Sprintf("sprite %q is fully transparent", s.Name))
+	case len(empty) == 1:
+		hints = append(hints, fmt.Sprintf("sprite %q: frame %s is fully transparent", s.Name, empty[0]))
+	case len(empty) > 1:
+		hints = append(hints, fmt.Sprintf("sprite %q: frames %s are fully transparent", s.Name, strings.Join(empty, ", ")))
+	}
+	if len(s.Frames) > 1 && len(empty) < len(s.Frames) && framesIdentical(s.Frames) {
+		hints = append(hints, fmt.Sprintf("sprite %q: all %d frames are identical", s.Name, len(s.Frames)))
+	}
+	return hints
+}
+
+func frameEmpty(f sprite.ResolvedFrame) bool {
+	for _, row := range f.Pixels {
+		for _, c := range row {
+			if c.A != 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func framesIdentical(frames []sprite.ResolvedFrame) bool {
+	for _, f := range frames[1:] {
+		for y, row := range f.Pixels {
+			if !slices.Equal(row, frames[0].Pixels[y]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// reportFrames adds checkFrames hints for every sprite in a file. They stay
+// hints: placeholder frames are sometimes intentional.
+func (r *Result) reportFrames(file string, sprites []sprite.ResolvedSprite) {
+	for _, s := range sprites {
+		for _, h := range checkFrames(s) {
+			r.addHint(file, fmt.Sprintf("%s: %s", file, h))
+		}
+	}
+}
+
+// checkColorKey checks sprites against the project's transparent_color. A
+// visible pixel in the key color would turn transparent in the game, so it
+// is an error. Partly transparent pixels are drawn opaque, which is worth a
+// warning. Each sprite is reported at most once for each.
+func checkColorKey(sprites []sprite.ResolvedSprite, key palette.Color) (errs, warnings []string) {
+	for _, s := range sprites {
+		collides, partial := false, false
+		for _, f := range s.Frames {
+			for _, row := range f.Pixels {
+				for _, c := range row {
+					if c.A == 0 {
+						continue
+					}
+					if c.R == key.R && c.G == key.G && c.B == key.B {
+						collides = true
+					}
+					if c.A < 255 {
+						partial = true
+					}
+				}
+			}
+		}
+		if collides {
+			errs = append(errs, fmt.Sprintf("sprite %q uses #%02x%02x%02x, the project's transparent_color, so those pixels would turn transparent",
+				s.Name, key.R, key.G, key.B))
+		}
+		if partial {
+			warnings = append(warnings, fmt.Sprintf("sprite %q has partly transparent pixels, drawn opaque because transparent_color is set", s.Name))
+		}
+	}
+	return errs, warnings
+}
+
+// reportColorKey records checkColorKey's findings for a file. It returns
+// true if an error was recorded. A nil key disables the check.
+func (r *Result) reportColorKey(file string, sprites []sprite.ResolvedSprite, key *palette.Color) bool {
+	if key == nil {
+		return false
+	}
+	errs, warnings := checkColorKey(sprites, *key)
+	for _, msg := range errs {
+		r.addError(file, fmt.Errorf("%s: %s", file, msg))
+	}
+	for _, msg := range warnings {
+		r.addWarning(file, fmt.Sprintf("%s: %s", file, msg))
+	}
+	return len(errs) > 0
+}
@@ -0,0 +1,245 @@
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/vgalaktionov/runefact/internal/config"
+	"github.com/vgalaktionov/runefact/internal/palette"
+	"github.com/vgalaktionov/runefact/internal/sprite"
+)
+
+func TestCheckSheetSize(t *testing.T) {
+	sprites := []sprite.ResolvedSprite{
+		{Name: "small", Grid: sprite.Grid{W: 8, H: 8}, Frames: make([]sprite.ResolvedFrame, 2)},
+		{Name: "wide", Grid: sprite.Grid{W: 8, H: 8}, Frames: make([]sprite.ResolvedFrame, 5)},
+		{Name: "tall", Grid: sprite.Grid{W: 8, H: 32}, Frames: make([]sprite.ResolvedFrame, 1)},
+	}
+
+	if _, over := checkSheetSize(sprites, sprite.SheetOptions{}, 0); over {
+		t.Error("limit 0 should disable the check")
+	}
+	if _, over := checkSheetSize(sprites, sprite.SheetOptions{}, 48); over {
+		t.Error("40x48 sheet should fit in 48")
+	}
+
+	msg, over := checkSheetSize(sprites, sprite.SheetOptions{}, 32)
+	if !over {
+		t.Fatal("40x48 sheet should exceed 32")
+	}
+	if !strings.Contains(msg, "40x48") || !strings.Contains(msg, `"wide"`) {
+		t.Errorf("message = %q, want size 40x48 and culprit wide", msg)
+	}
+
+	msg, _ = checkSheetSize(sprites, sprite.SheetOptions{}, 40)
+	if !strings.Contains(msg, `"tall"`) {
+		t.Errorf("message = %q, want culprit tall", msg)
+	}
+
+	// The check measures the sheet in the project's layout, padding
+	// included.
+	msg, over = checkSheetSize(sprites, sprite.SheetOptions{Layout: sprite.LayoutRows, POT: true}, 48)
+	if !over || !strings.Contains(msg, "64x64") {
+		t.Errorf("message = %q, want a 64x64 power-of-two sheet", msg)
+	}
+}
+
+func TestCheckSpriteLimits(t *testing.T) {
+	// A 1x1 sprite with 200 frames lays out as one 200px row.
+	strip := sprite.ResolvedSprite{Name: "strip", Grid: sprite.Grid{W: 1, H: 1}, Frames: make([]sprite.ResolvedFrame, 200)}
+	dot := sprite.ResolvedSprite{Name: "dot", Grid: sprite.Grid{W: 1, H: 1}, Frames: make([]sprite.ResolvedFrame, 1)}
+	sprites := []sprite.ResolvedSprite{dot, strip}
+
+	msgs := checkSpriteLimits(sprites, sprite.SheetOptions{}, config.LintSection{MaxFramesPerSprite: 64, MaxSheetDimension: 128})
+	if len(msgs) != 2 {
+		t.Fatalf("messages = %q, want a frame count and a sheet size warning", msgs)
+	}
+	if want := `sprite "strip" has 200 frames, more than lint.max_frames_per_sprite 64`; !strings.Contains(msgs[0], want) {
+		t.Errorf("message = %q, want %q", msgs[0], want)
+	}
+	if want := `sprite sheet is 200x2, more than lint.max_sheet_dimension 128`; !strings.Contains(msgs[1], want) || !strings.Contains(msgs[1], `sprite "strip", 200 frame(s) of 1x1`) {
+		t.Errorf("message = %q, want %q naming strip", msgs[1], want)
+	}
+
+	if msgs := checkSpriteLimits(sprites, sprite.SheetOptions{}, config.LintSection{MaxFramesPerSprite: 200, MaxSheetDimension: 200}); len(msgs) != 0 {
+		t.Errorf("limits at the counts: messages = %q, want none", msgs)
+	}
+	if msgs := checkSpriteLimits(sprites, sprite.SheetOptions{}, config.LintSection{}); len(msgs) != 0 {
+		t.Errorf("limits of 0: messages = %q, want the checks off", msgs)
+	}
+	// A stricter max_sheet_size already reports the sheet.
+	if msgs := checkSpriteLimits(sprites, sprite.SheetOptions{}, config.LintSection{MaxSheetDimension: 128, MaxSheetSize: 100}); len(msgs) != 0 {
+		t.Errorf("with max_sheet_size: messages = %q, want the sheet left to it", msgs)
+	}
+}
+
+func TestBuild_MaxFramesPerSprite(t *testing.T) {
+	dir, cfg := setupDemoProject(t)
+	cfg.Lint.MaxFramesPerSprite = 3
+	os.WriteFile(filepath.Join(dir, "assets/sprites/long.sprite"), []byte(`palette = "default"
+grid = 1
+[sprite.walk]
+pixels = """
+g
+--
+k
+--
+g
+--
+k
+"""
+`), 0644)
+
+	result := Build(Options{Scope: ScopeSprites}, cfg, dir)
+	if len(result.Errors) > 0 {
+		t.Fatalf("non-strict lint should not error: %v", result.Errors)
+	}
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], `sprite "walk" has 4 frames`) {
+		t.Errorf("warnings = %v, want one frame count warning", result.Warnings)
+	}
+
+	cfg.Lint.Strict = true
+	os.RemoveAll(filepath.Join(dir, "build"))
+	result = Build(Options{Scope: ScopeSprites}, cfg, dir)
+	if len(result.Errors) != 1 {
+		t.Fatalf("errors = %v, want one frame count error", result.Errors)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "build/assets/sprites/long.png")); err == nil {
+		t.Error("a sheet over the frame limit should not be written in strict mode")
+	}
+}
+
+func TestBuild_MaxSheetSize(t *testing.T) {
+	dir, cfg := setupDemoProject(t)
+	cfg.Lint.MaxSheetSize = 1
+
+	result := Build(Options{Scope: ScopeSprites}, cfg, dir)
+	if len(result.Errors) > 0 {
+		t.Fatalf("non-strict lint should not error: %v", result.Errors)
+	}
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "2x2") {
+		t.Errorf("warnings = %v, want one sheet size warning", result.Warnings)
+	}
+
+	cfg.Lint.Strict = true
+	os.RemoveAll(filepath.Join(dir, "build"))
+	result = Build(Options{Scope: ScopeSprites}, cfg, dir)
+	if len(result.Errors) != 1 {
+		t.Fatalf("errors = %v, want one sheet size error", result.Errors)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "build/assets/sprites/demo.png")); err == nil {
+		t.Error("oversized sheet should not be written in strict mode")
+	}
+}
+
+func TestBuild_TileSizeMismatch(t *testing.T) {
+	dir, cfg := setupDemoProject(t)
+
+	// A 4x4 sprite on the demo map's 2x2 tiles.
+	os.WriteFile(filepath.Join(dir, "assets/sprites/big.sprite"), []byte(`palette = "default"
+grid = 4
+[sprite.tree]
+pixels = """
+gggg
+gggg
+_kk_
+_kk_
+"""
+`), 0644)
+	os.WriteFile(filepath.Join(dir, "assets/maps/demo.map"), []byte(`tile_size = 2
+[tileset]
+D = "demo:dot"
+T = "big:tree"
+_ = ""
+[layer.main]
+pixels = """
+DT
+_D
+"""
+`), 0644)
+
+	result := Build(Options{Scope: ScopeMaps}, cfg, dir)
+	if len(result.Errors) > 0 {
+		t.Fatalf("non-strict lint should not error: %v", result.Errors)
+	}
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], `tileset "T": sprite big:tree is 4x4 but tile_size is 2`) {
+		t.Errorf("warnings = %v, want one tile size warning", result.Warnings)
+	}
+
+	cfg.Lint.AllowOversizedTiles = true
+	result = Build(Options{Scope: ScopeMaps}, cfg, dir)
+	if len(result.Warnings) != 0 {
+		t.Errorf("exact multiple should be allowed: %v", result.Warnings)
+	}
+
+	cfg.Lint.AllowOversizedTiles = false
+	cfg.Lint.Strict = true
+	os.RemoveAll(filepath.Join(dir, "build"))
+	result = Build(Options{Scope: ScopeMaps}, cfg, dir)
+	if len(result.Errors) != 1 {
+		t.Fatalf("errors = %v, want one tile size error", result.Errors)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "build/assets/maps/demo.json")); err == nil {
+		t.Error("mismatched map should not be written in strict mode")
+	}
+}
+
+func TestCheckFrames(t *testing.T) {
+	red := palette.Color{R: 255, A: 255}
+	none := palette.Color{}
+	frame := func(c palette.Color) sprite.ResolvedFrame {
+		return sprite.ResolvedFrame{Pixels: [][]palette.Color{{c, none}}}
+	}
+
+	tests := []struct {
+		name   string
+		frames []sprite.ResolvedFrame
+		want   []string
+	}{
+		{"static", []sprite.ResolvedFrame{frame(red)}, nil},
+		{"animated", []sprite.ResolvedFrame{frame(red), frame(none), frame(red)}, []string{`sprite "s": frame 2 is fully transparent`}},
+		{"identical", []sprite.ResolvedFrame{frame(red), frame(red), frame(red)}, []string{`sprite "s": all 3 frames are identical`}},
+		{"empty static", []sprite.ResolvedFrame{frame(none)}, []string{`sprite "s" is fully transparent`}},
+		{"all empty", []sprite.ResolvedFrame{frame(none), frame(none)}, []string{`sprite "s": frames 1, 2 are fully transparent`}},
+	}
+	for _, tt := range tests {
+		got := checkFrames(sprite.ResolvedSprite{Name: "s", Frames: tt.frames})
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: hints = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidate_FrameHints(t *testing.T) {
+	dir, cfg := setupDemoProject(t)
+	os.WriteFile(filepath.Join(dir, "assets/sprites/anim.sprite"), []byte(`palette = "default"
+grid = 2
+[sprite.blink]
+framerate = 4
+[[sprite.blink.frame]]
+pixels = """
+rr
+rr
+"""
+[[sprite.blink.frame]]
+pixels = """
+rr
+rr
+"""
+`), 0644)
+
+	result := Validate(Options{Scope: ScopeSprites}, cfg, dir)
+	if len(result.Errors) > 0 || len(result.Warnings) > 0 {
+		t.Fatalf("frame checks should only hint: %v %v", result.Errors, result.Warnings)
+	}
+	found := false
+	for _, h := range result.Hints {
+		found = found || strings.Contains(h, `anim.sprite: sprite "blink": all 2 frames are identical`)
+	}
+	if !found {
+		t.Errorf("hints = %v, want identical frames hint", result.Hints)
+	}
+}
@@ -0,0 +1,178 @@
+package build
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/vgalaktionov/runefact/internal/config"
+	"github.com/vgalaktionov/runefact/internal/manifest"
+	"github.com/vgalaktionov/runefact/internal/palette"
+	"github.com/vgalaktionov/runefact/internal/sprite"
+	"github.com/vgalaktionov/runefact/internal/tilemap"
+)
+
+// spriteLookup resolves "file:sprite" references for the map phase. The
+// sprite phase may not have run for this build scope, so sprite files are
+// loaded and resolved again, once per file.
+type spriteLookup struct {
+	palettes   map[string]*palette.Palette
+	assetsDirs []string
+	files      map[string][]sprite.ResolvedSprite
+	errs       map[string]error
+}
+
+func newSpriteLookup(palettes map[string]*palette.Palette, assetsDirs []string) *spriteLookup {
+	return &spriteLookup{
+		palettes:   palettes,
+		assetsDirs: assetsDirs,
+		files:      map[string][]sprite.ResolvedSprite{},
+		errs:       map[string]error{},
+	}
+}
+
+// get returns the resolved sprite for ref.
+func (l *spriteLookup) get(ref string) (sprite.ResolvedSprite, error) {
+	file, name, ok := strings.Cut(ref, ":")
+	if !ok {
+		return sprite.ResolvedSprite{}, fmt.Errorf("expected a \"file:sprite\" reference, got %q", ref)
+	}
+	if _, done := l.files[file]; !done && l.errs[file] == nil {
+		path := sprite.FindFile(subdirs(l.assetsDirs, "sprites"), file+".sprite")
+		resolved, err := resolveSpriteFile(path, l.palettes, l.assetsDirs)
+		if err != nil {
+			l.errs[file] = err
+		} else {
+			l.files[file] = resolved
+		}
+	}
+	if err := l.errs[file]; err != nil {
+		return sprite.ResolvedSprite{}, err
+	}
+	resolved := l.files[file]
+	idx := slices.IndexFunc(resolved, func(s sprite.ResolvedSprite) bool { return s.Name == name })
+	if idx < 0 {
+		return sprite.ResolvedSprite{}, fmt.Errorf("sprite %q not found in %s.sprite", name, file)
+	}
+	return resolved[idx], nil
+}
+
+// resolveSpriteFile loads a sprite file and resolves it against its palette.
+// Palettes not among those already parsed are read from the palettes
+// directories.
+func resolveSpriteFile(path string, palettes map[string]*palette.Palette, assetsDirs []string) ([]sprite.ResolvedSprite, error) {
+	sf, err := sprite.LoadSpriteFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pal := palettes[sf.PaletteRef]
+	if pal == nil && sf.PaletteRef != "" {
+		if pal, err = palette.ResolvePalette(sf.PaletteRef, subdirs(assetsDirs, "palettes")); err != nil {
+			return nil, fmt.Errorf("palette %q not found", sf.PaletteRef)
+		}
+	}
+	if pal == nil {
+		pal = &palette.Palette{Colors: map[string]palette.Color{}}
+	}
+	return sf.ResolveWith(pal, sprite.DirPartLoader(assetsDirs...), paletteLoader(palettes, assetsDirs...))
+}
+
+// paletteLoader finds the palettes sprites override their file's palette
+// with among those already parsed, reading any others from the palettes
+// directories.
+func paletteLoader(palettes map[string]*palette.Palette, assetsDirs ...string) sprite.PaletteLoader {
+	fromDir := sprite.DirPaletteLoader(assetsDirs...)
+	return func(name string) (*palette.Palette, error) {
+		if pal, ok := palettes[name]; ok {
+			return pal, nil
+		}
+		return fromDir(name)
+	}
+}
+
+// subdirs returns subdir of each assets directory.
+func subdirs(assetsDirs []string, subdir string) []string {
+	out := make([]string, len(assetsDirs))
+	for i, d := range assetsDirs {
+		out[i] = filepath.Join(d, subdir)
+	}
+	return out
+}
+
+// resolveTileAnimations looks up the frame count and FPS of every animated
+// tile's sprite.
+func (r *Result) resolveTileAnimations(f string, mf *tilemap.MapFile, sprites *spriteLookup) {
+	keys := mf.AnimatedKeys()
+	if len(keys) == 0 {
+		return
+	}
+	mf.Animations = map[string]tilemap.TileAnimation{}
+	for _, key := range keys {
+		ref := mf.Tileset[key]
+		s, err := sprites.get(ref)
+		if err != nil {
+			r.addError(f, fmt.Errorf("%s: tileset %q: %w", f, key, err))
+			continue
+		}
+		if len(s.Frames) < 2 {
+			r.addWarning(f, fmt.Sprintf("%s: tileset %q: animate is set but %s has a single frame", f, key, ref))
+		}
+		mf.Animations[key] = tilemap.TileAnimation{Frames: len(s.Frames), FPS: s.Framerate}
+	}
+}
+
+// reportTileSizes checks every tileset sprite against the map's tile_size.
+// Mismatches are errors in strict mode and warnings otherwise. References
+// that don't resolve are skipped; other checks report them. It returns
+// true if an error was recorded.
+func (r *Result) reportTileSizes(f string, mf *tilemap.MapFile, sprites *spriteLookup, lint config.LintSection) bool {
+	keys := make([]string, 0, len(mf.Tileset))
+	for k := range mf.Tileset {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	failed := false
+	for _, key := range keys {
+		ref := mf.Tileset[key]
+		if ref == "" {
+			continue
+		}
+		s, err := sprites.get(ref)
+		if err != nil {
+			continue
+		}
+		msg, bad := mf.CheckTileSize(key, s.Grid.W, s.Grid.H, lint.AllowOversizedTiles)
+		if !bad {
+			continue
+		}
+		if lint.Strict {
+			r.addError(f, fmt.Errorf("%s: %s", f, msg))
+			failed = true
+		} else {
+			r.addWarning(f, fmt.Sprintf("%s: %s", f, msg))
+		}
+	}
+	return failed
+}
+
+// mapTiles lists the properties of a map's table-form tileset entries by
+// the tile index used in the map JSON.
+func mapTiles(mf *tilemap.MapFile, j *tilemap.JSONTilemap) []manifest.TileEntry {
+	var tiles []manifest.TileEntry
+	for key, tp := range mf.TileProps {
+		ref, ok := j.Tileset[key]
+		if !ok || (!tp.Solid && len(tp.Tags) == 0) {
+			continue // empty tile, or animation only
+		}
+		tiles = append(tiles, manifest.TileEntry{
+			Index: ref.Index,
+			Solid: ref.Properties.Solid,
+			Tags:  ref.Properties.Tags,
+		})
+	}
+	sort.Slice(tiles, func(a, b int) bool { return tiles[a].Index < tiles[b].Index })
+	return tiles
+}
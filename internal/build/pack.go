@@ -0,0 +1,86 @@
+package build
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/vgalaktionov/runefact/internal/config"
+	"github.com/vgalaktionov/runefact/internal/manifest"
+	"github.com/vgalaktionov/runefact/internal/pack"
+)
+
+// PackKeyEnv is the environment variable the pack key is read from when
+// Options.PackKey is empty, so watch and MCP builds can pack too.
+const PackKeyEnv = "RUNEFACT_PACK_KEY"
+
+// packs reports whether a build with opts writes a pack, and fills in
+// the key from the environment if opts has none. A pack holds
+// every asset, so only a full build that succeeded writes one; any other
+// build leaves its artifacts as files, with a warning if the project packs.
+func (r *Result) packs(opts *Options, cfg *config.ProjectConfig) bool {
+	if !cfg.Project.Pack {
+		return false
+	}
+	if opts.Scope != ScopeAll || len(opts.Files) > 0 || len(opts.IncludeTags) > 0 || len(opts.ExcludeTags) > 0 {
+		r.addWarning("", fmt.Sprintf("project.pack: a partial build writes separate files, run a full build to update %s", pack.FileName))
+		return false
+	}
+	if opts.PackKey == "" {
+		opts.PackKey = os.Getenv(PackKeyEnv)
+	}
+	if cfg.Project.PackCipher != string(pack.CipherNone) && opts.PackKey == "" {
+		r.addError("", fmt.Errorf("project.pack_cipher is %s but no key was given: pass --pack-key or set %s", cfg.Project.PackCipher, PackKeyEnv))
+		return false
+	}
+	return len(r.Errors) == 0
+}
+
+// packArtifacts moves every artifact but the manifests into the pack, so
+// the output directory holds the pack and the code to read it. It reports
+// whether it did; on failure every artifact is left where it was.
+func (r *Result) packArtifacts(outputDir string, cfg *config.ProjectConfig, key string) bool {
+	var entries []pack.Entry
+	var packed, kept []string
+	for _, a := range r.Artifacts {
+		if base := filepath.Base(a); filepath.Dir(a) == outputDir && (base == "manifest.go" || base == "manifest.json") {
+			kept = append(kept, a)
+			continue
+		}
+		rel, err := filepath.Rel(outputDir, a)
+		if err != nil {
+			r.addIOError(a, err)
+			return false
+		}
+		data, err := os.ReadFile(a)
+		if err != nil {
+			r.addIOError(a, err)
+			return false
+		}
+		entries = append(entries, pack.Entry{Name: manifest.SlashPath(rel), Data: data})
+		packed = append(packed, a)
+	}
+
+	c := pack.Cipher(cfg.Project.PackCipher)
+	var k []byte
+	if c != pack.CipherNone {
+		k = []byte(key)
+	}
+	packPath := filepath.Join(outputDir, pack.FileName)
+	if err := pack.Write(packPath, entries, c, k); err != nil {
+		r.addIOError("", fmt.Errorf("writing %s: %w", pack.FileName, err))
+		return false
+	}
+	for _, a := range packed {
+		os.Remove(a)
+		// Leave no empty sprites/, maps/ or audio/ behind; Remove fails
+		// on a directory that isn't empty.
+		for dir := filepath.Dir(a); dir != outputDir; dir = filepath.Dir(dir) {
+			if os.Remove(dir) != nil {
+				break
+			}
+		}
+	}
+	r.Artifacts = append(kept, packPath)
+	return true
+}
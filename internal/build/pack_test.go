@@ -0,0 +1,100 @@
+package build
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/vgalaktionov/runefact/internal/pack"
+)
+
+func TestBuild_Pack(t *testing.T) {
+	t.Setenv(PackKeyEnv, "")
+	dir, cfg := setupDemoProject(t)
+	cfg.Project.Pack = true
+	cfg.Project.PackCipher = "aes-ctr"
+	out := filepath.Join(dir, "build/assets")
+
+	result := Build(Options{PackKey: "s3cret"}, cfg, dir)
+	if len(result.Errors) > 0 {
+		t.Fatalf("build errors: %v", result.Errors)
+	}
+	entries, _ := os.ReadDir(out)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if want := []string{pack.FileName, "manifest.go"}; !slices.Equal(names, want) {
+		t.Errorf("output = %v, want %v", names, want)
+	}
+	if want := []string{filepath.Join(out, "manifest.go"), filepath.Join(out, pack.FileName)}; !slices.Equal(result.Artifacts, want) {
+		t.Errorf("artifacts = %v, want %v", result.Artifacts, want)
+	}
+	manifestSrc, _ := os.ReadFile(filepath.Join(out, "manifest.go"))
+	if !strings.Contains(string(manifestSrc), "func OpenPack(") {
+		t.Error("manifest has no pack loader")
+	}
+
+	p, err := pack.Open(filepath.Join(out, pack.FileName), []byte("s3cret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	for _, name := range []string{"sprites/demo.png", "maps/demo.json", "audio/blip.wav", "audio/demo.wav"} {
+		if !slices.Contains(p.Names(), name) {
+			t.Errorf("pack has %v, want %s", p.Names(), name)
+		}
+	}
+	png, err := p.ReadFile("sprites/demo.png")
+	if err != nil || !bytes.HasPrefix(png, []byte("\x89PNG")) {
+		t.Errorf("sprites/demo.png = %.8q, %v; want a PNG", png, err)
+	}
+
+	// A partial build can't write the whole pack.
+	result = Build(Options{Scope: ScopeSprites, PackKey: "s3cret"}, cfg, dir)
+	if _, err := os.Stat(filepath.Join(out, "sprites/demo.png")); err != nil {
+		t.Errorf("partial build didn't write separate files: %v", err)
+	}
+	if len(result.Warnings) == 0 || !strings.Contains(result.Warnings[0], "partial build") {
+		t.Errorf("warnings = %v, want a partial build warning", result.Warnings)
+	}
+
+	result = Build(Options{}, cfg, dir)
+	if len(result.Errors) == 0 || !strings.Contains(result.Errors[0].Error(), "no key was given") {
+		t.Errorf("errors = %v, want a missing key", result.Errors)
+	}
+	t.Setenv(PackKeyEnv, "s3cret")
+	if result = Build(Options{}, cfg, dir); len(result.Errors) > 0 {
+		t.Errorf("build with the key in %s: %v", PackKeyEnv, result.Errors)
+	}
+}
+
+// When the pack can't be written, the assets stay separate files and the
+// manifest must load them as files.
+func TestBuild_PackWriteFails(t *testing.T) {
+	dir, cfg := setupDemoProject(t)
+	cfg.Project.Pack = true
+	out := filepath.Join(dir, "build/assets")
+	// A directory that isn't empty can't be renamed over.
+	if err := os.MkdirAll(filepath.Join(out, pack.FileName, "x"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	result := Build(Options{}, cfg, dir)
+	if !result.HasIOErrors() {
+		t.Fatalf("errors = %v, want an I/O error writing the pack", result.Errors)
+	}
+	if _, err := os.Stat(filepath.Join(out, "sprites/demo.png")); err != nil {
+		t.Errorf("assets weren't left as files: %v", err)
+	}
+	manifestSrc, _ := os.ReadFile(filepath.Join(out, "manifest.go"))
+	if strings.Contains(string(manifestSrc), "PackFile") {
+		t.Error("manifest declares a pack that wasn't written")
+	}
+	if n := strings.Count(strings.Join(result.Artifacts, "\n"), "manifest.go"); n != 1 {
+		t.Errorf("artifacts = %v, want manifest.go once", result.Artifacts)
+	}
+}
@@ -0,0 +1,159 @@
+package build
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/vgalaktionov/runefact/internal/atomicfile"
+	"github.com/vgalaktionov/runefact/internal/palette"
+	"github.com/vgalaktionov/runefact/internal/sprite"
+)
+
+// RecolorOptions selects the colors a recolor replaces: every palette or
+// palette_extend value equal to From, or the value of Key in every palette
+// that defines it. Exactly one of From and Key is set.
+type RecolorOptions struct {
+	From string
+	Key  string
+	To   string
+}
+
+// FileChange is a planned rewrite of one file.
+type FileChange struct {
+	Path  string
+	Count int // colors replaced
+	Data  []byte
+}
+
+// PlanRecolor computes the rewrites for a project-wide recolor without
+// writing anything. Every sprite whose file or palette changes is parsed
+// and resolved against the new contents; if any of them breaks, the error
+// lists them all and no changes are returned.
+func PlanRecolor(projectRoot string, opts RecolorOptions) ([]FileChange, error) {
+	if (opts.From == "") == (opts.Key == "") {
+		return nil, fmt.Errorf("set exactly one of --from and --key")
+	}
+	if _, err := palette.ParseHexColor(opts.To); err != nil {
+		return nil, fmt.Errorf("--to: %w", err)
+	}
+	replace := func(key, value string) bool { return key == opts.Key }
+	if opts.From != "" {
+		from, err := palette.ParseHexColor(opts.From)
+		if err != nil {
+			return nil, fmt.Errorf("--from: %w", err)
+		}
+		replace = func(key, value string) bool {
+			c, err := palette.ParseHexColor(value)
+			return err == nil && c == from
+		}
+	}
+
+	assetsDir := filepath.Join(projectRoot, "assets")
+	paletteFiles := discoverFiles(filepath.Join(assetsDir, "palettes"), ".palette", nil)
+	spriteFiles := discoverFiles(filepath.Join(assetsDir, "sprites"), ".sprite", nil)
+
+	var changes []FileChange
+	contents := map[string][]byte{}
+	rewrite := func(f, ext string, replace func(key, value string) bool) error {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return err
+		}
+		contents[f] = data
+		out, n := palette.RecolorSource(data, ext, replace, opts.To)
+		if n > 0 {
+			changes = append(changes, FileChange{Path: f, Count: n, Data: out})
+		}
+		return nil
+	}
+	for _, f := range paletteFiles {
+		if err := rewrite(f, ".palette", replace); err != nil {
+			return nil, err
+		}
+	}
+	for _, f := range spriteFiles {
+		// A key names a palette color; palette_extend entries are the
+		// sprite's own colors and are left alone.
+		spriteReplace := replace
+		if opts.Key != "" {
+			spriteReplace = func(string, string) bool { return false }
+		}
+		if err := rewrite(f, ".sprite", spriteReplace); err != nil {
+			return nil, err
+		}
+	}
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	changed := map[string]bool{}
+	updated := maps.Clone(contents)
+	for _, c := range changes {
+		changed[c.Path] = true
+		updated[c.Path] = c.Data
+	}
+	before := resolveAll(assetsDir, paletteFiles, spriteFiles, contents, changed)
+	after := resolveAll(assetsDir, paletteFiles, spriteFiles, updated, changed)
+
+	// Only report what the recolor breaks, not what was already broken.
+	var errs []error
+	for _, f := range slices.Concat(paletteFiles, spriteFiles) {
+		if after[f] != nil && before[f] == nil {
+			errs = append(errs, after[f])
+		}
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("recolor would break %d file(s), nothing was written:\n%w", len(errs), errors.Join(errs...))
+	}
+	return changes, nil
+}
+
+// resolveAll parses the palettes and sprites in contents and resolves every
+// sprite whose file or palette is in changed, returning the error for each
+// file that fails.
+func resolveAll(assetsDir string, paletteFiles, spriteFiles []string, contents map[string][]byte, changed map[string]bool) map[string]error {
+	errs := map[string]error{}
+	palettes := map[string]*palette.Palette{}
+	changedPalettes := map[string]bool{}
+	for _, f := range paletteFiles {
+		p, err := palette.ParsePalette(contents[f], f)
+		if err != nil {
+			errs[f] = err
+			continue
+		}
+		palettes[p.Name] = p
+		changedPalettes[p.Name] = changed[f]
+	}
+	for _, f := range spriteFiles {
+		sf, err := sprite.ParseSpriteFile(contents[f], f)
+		if err != nil {
+			errs[f] = err
+			continue
+		}
+		usesChanged := slices.ContainsFunc(sf.PaletteRefs(), func(name string) bool { return changedPalettes[name] })
+		if !changed[f] && !usesChanged {
+			continue
+		}
+		pal := palettes[sf.PaletteRef]
+		if pal == nil {
+			pal = &palette.Palette{Colors: map[string]palette.Color{}}
+		}
+		if _, err := sf.ResolveWith(pal, sprite.DirPartLoader(assetsDir), paletteLoader(palettes, assetsDir)); err != nil {
+			errs[f] = fmt.Errorf("%s: %w", f, err)
+		}
+	}
+	return errs
+}
+
+// WriteChanges writes every change or none; see atomicfile.WriteFiles.
+func WriteChanges(changes []FileChange) error {
+	files := make([]atomicfile.File, len(changes))
+	for i, c := range changes {
+		files[i] = atomicfile.File{Path: c.Path, Data: c.Data}
+	}
+	return atomicfile.WriteFiles(files)
+}
@@ -0,0 +1,69 @@
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPlanRecolor(t *testing.T) {
+	dir, _ := setupDemoProject(t)
+	extPath := filepath.Join(dir, "assets/sprites/ext.sprite")
+	os.WriteFile(extPath, []byte(`palette = "default"
+grid = 1
+palette_extend = { x = "#F00" }
+[sprite.a]
+pixels = "x"
+`), 0644)
+	// Already broken; it must not block the recolor.
+	os.WriteFile(filepath.Join(dir, "assets/sprites/broken.sprite"), []byte(`palette = "default"
+grid = 1
+[sprite.a]
+pixels = "?"
+`), 0644)
+	palPath := filepath.Join(dir, "assets/palettes/default.palette")
+
+	changes, err := PlanRecolor(dir, RecolorOptions{From: "#ff0000", To: "#aa0000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 || changes[0].Path != palPath || changes[1].Path != extPath {
+		t.Fatalf("changes = %+v, want the palette and ext.sprite", changes)
+	}
+	if data, _ := os.ReadFile(palPath); strings.Contains(string(data), "#aa0000") {
+		t.Error("planning should not write")
+	}
+
+	if err := WriteChanges(changes); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{palPath, extPath} {
+		if data, _ := os.ReadFile(f); !strings.Contains(string(data), `"#aa0000"`) {
+			t.Errorf("%s not recolored:\n%s", f, data)
+		}
+		if _, err := os.Stat(f + ".runefact-tmp"); err == nil {
+			t.Errorf("%s: temporary file left behind", f)
+		}
+	}
+
+	// A key only retargets palettes.
+	changes, err = PlanRecolor(dir, RecolorOptions{Key: "x", To: "#00ff00"})
+	if err != nil || len(changes) != 0 {
+		t.Errorf("key x is only in palette_extend: changes = %+v, err = %v", changes, err)
+	}
+	changes, err = PlanRecolor(dir, RecolorOptions{Key: "r", To: "#00ff00"})
+	if err != nil || len(changes) != 1 || changes[0].Path != palPath {
+		t.Errorf("changes = %+v, err = %v, want the palette", changes, err)
+	}
+
+	for _, opts := range []RecolorOptions{
+		{From: "#ff0000", Key: "r", To: "#000"},
+		{To: "#000"},
+		{Key: "r", To: "red"},
+	} {
+		if _, err := PlanRecolor(dir, opts); err == nil {
+			t.Errorf("%+v: expected an error", opts)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package build
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/vgalaktionov/runefact/internal/atomicfile"
+	"github.com/vgalaktionov/runefact/internal/config"
+	"github.com/vgalaktionov/runefact/internal/pack"
+	"github.com/vgalaktionov/runefact/internal/sprite"
+	"github.com/vgalaktionov/runefact/internal/tilemap"
+)
+
+const lastBuildFile = ".runefact/last_build.json"
+
+// BuildRecord summarizes the most recent build so that tools which did not
+// run it (the MCP server, editors) can report on it.
+type BuildRecord struct {
+	Time      time.Time `json:"time"`
+	Success   bool      `json:"success"`
+	Artifacts int       `json:"artifacts"`
+	Errors    int       `json:"errors"`
+	Warnings  int       `json:"warnings"`
+
+	// Output is the output size and budget checks, if the build got that far.
+	Output *SizeReport `json:"output,omitempty"`
+}
+
+// SaveBuildRecord writes a summary of result to .runefact/last_build.json.
+func SaveBuildRecord(projectRoot string, result *Result) error {
+	rec := BuildRecord{
+		Time:      time.Now().UTC(),
+		Success:   len(result.Errors) == 0,
+		Artifacts: len(result.Artifacts),
+		Errors:    len(result.Errors),
+		Warnings:  len(result.Warnings),
+		Output:    result.Sizes,
+	}
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(filepath.Join(projectRoot, lastBuildFile), data, 0644)
+}
+
+// LoadBuildRecord reads the last build summary, or returns nil if there is none.
+func LoadBuildRecord(projectRoot string) *BuildRecord {
+	data, err := os.ReadFile(filepath.Join(projectRoot, lastBuildFile))
+	if err != nil {
+		return nil
+	}
+	var rec BuildRecord
+	if json.Unmarshal(data, &rec) != nil {
+		return nil
+	}
+	return &rec
+}
+
+// StaleAssets returns the source files whose artifact is missing or older
+// than the source or one of its dependencies (a sprite's palette, the
+// sprites of a map's animated tiles, any instrument for tracks). In a
+// project that packs, every artifact is the pack. Names are base file
+// names, sorted.
+func StaleAssets(cfg *config.ProjectConfig, projectRoot string) []string {
+	assetsDirs := cfg.AssetsDirs(projectRoot)
+	outputDir := filepath.Join(projectRoot, cfg.Project.Output)
+
+	var stale []string
+	isStale := func(src, artifact string, deps ...string) bool {
+		if cfg.Project.Pack {
+			artifact = filepath.Join(outputDir, pack.FileName)
+		}
+		art, err := os.Stat(artifact)
+		if err != nil || newerThan(src, art.ModTime()) {
+			return true
+		}
+		for _, d := range deps {
+			if newerThan(d, art.ModTime()) {
+				return true
+			}
+		}
+		return false
+	}
+	check := func(src, artifact string, deps ...string) {
+		if isStale(src, artifact, deps...) {
+			stale = append(stale, filepath.Base(src))
+		}
+	}
+
+	files := func(subdir, ext string) []string {
+		found, _ := searchFiles(assetsDirs, subdir, ext, nil)
+		return found
+	}
+
+	for _, f := range files("sprites", ".sprite") {
+		var deps []string
+		if sf, err := sprite.LoadSpriteFile(f); err == nil {
+			for _, name := range sf.PaletteRefs() {
+				deps = append(deps, sprite.FindFile(subdirs(assetsDirs, "palettes"), name+".palette"))
+			}
+		}
+		check(f, artifactPath(outputDir, f, ".sprite", "sprites", ".png"), deps...)
+	}
+	for _, f := range files("maps", ".map") {
+		var deps []string
+		if mf, _, err := tilemap.LoadMapFile(f); err == nil {
+			for _, key := range mf.AnimatedKeys() {
+				file, _, _ := strings.Cut(mf.Tileset[key], ":")
+				deps = append(deps, sprite.FindFile(subdirs(assetsDirs, "sprites"), file+".sprite"))
+			}
+		}
+		check(f, artifactPath(outputDir, f, ".map", "maps", ".json"), deps...)
+	}
+	for _, f := range files("sfx", ".sfx") {
+		check(f, filepath.Join(outputDir, audioRelPath(f, cfg.Project.AudioSubdirs)))
+	}
+	instruments := files("instruments", ".inst")
+	for _, f := range files("tracks", ".track") {
+		// A track is stale if any of the WAVs it writes is.
+		for _, out := range audioOutputs(f, nil, cfg.Project.AudioSubdirs) {
+			if isStale(f, filepath.Join(outputDir, out.Rel), instruments...) {
+				stale = append(stale, filepath.Base(f))
+				break
+			}
+		}
+	}
+
+	slices.Sort(stale)
+	return stale
+}
+
+func artifactPath(outputDir, src, srcExt, subdir, outExt string) string {
+	base := strings.TrimSuffix(filepath.Base(src), srcExt)
+	return filepath.Join(outputDir, subdir, base+outExt)
+}
+
+func newerThan(path string, t time.Time) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.ModTime().After(t)
+}
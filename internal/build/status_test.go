@@ -0,0 +1,69 @@
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestStaleAssets(t *testing.T) {
+	dir, cfg := setupDemoProject(t)
+
+	// Nothing built yet: everything is stale.
+	stale := StaleAssets(cfg, dir)
+	want := []string{"blip.sfx", "demo.map", "demo.sprite", "demo.track"}
+	if !slices.Equal(stale, want) {
+		t.Fatalf("before build: stale = %v, want %v", stale, want)
+	}
+
+	result := Build(Options{}, cfg, dir)
+	if len(result.Errors) > 0 {
+		t.Fatalf("build errors: %v", result.Errors)
+	}
+	if stale := StaleAssets(cfg, dir); len(stale) != 0 {
+		t.Fatalf("after build: stale = %v, want none", stale)
+	}
+
+	// Touching the palette makes the sprite that uses it stale.
+	future := time.Now().Add(time.Hour)
+	pal := filepath.Join(dir, "assets/palettes/default.palette")
+	if err := os.Chtimes(pal, future, future); err != nil {
+		t.Fatal(err)
+	}
+	// Touching an instrument makes tracks stale.
+	inst := filepath.Join(dir, "assets/instruments/demo.inst")
+	if err := os.Chtimes(inst, future, future); err != nil {
+		t.Fatal(err)
+	}
+
+	stale = StaleAssets(cfg, dir)
+	want = []string{"demo.sprite", "demo.track"}
+	if !slices.Equal(stale, want) {
+		t.Errorf("after touching deps: stale = %v, want %v", stale, want)
+	}
+}
+
+func TestBuildRecord(t *testing.T) {
+	dir, cfg := setupDemoProject(t)
+
+	if rec := LoadBuildRecord(dir); rec != nil {
+		t.Fatalf("expected no record before first build, got %+v", rec)
+	}
+
+	result := Build(Options{}, cfg, dir)
+	rec := LoadBuildRecord(dir)
+	if rec == nil {
+		t.Fatal("build did not write a record")
+	}
+	if !rec.Success || rec.Errors != 0 {
+		t.Errorf("record = %+v, want success with 0 errors", rec)
+	}
+	if rec.Artifacts != len(result.Artifacts) {
+		t.Errorf("artifacts = %d, want %d", rec.Artifacts, len(result.Artifacts))
+	}
+	if time.Since(rec.Time) > time.Minute {
+		t.Errorf("record time %v is not recent", rec.Time)
+	}
+}
@@ -0,0 +1,66 @@
+package build
+
+import (
+	"os"
+	"slices"
+
+	toml "github.com/pelletier/go-toml/v2"
+
+	"github.com/vgalaktionov/runefact/internal/tomlsrc"
+)
+
+// fileTags reads the top-level tags array of an asset file. Files that
+// can't be read or parsed report no tags and are left to the parser.
+func fileTags(path string) []string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var header struct {
+		Tags []string `toml:"tags"`
+	}
+	if toml.Unmarshal(tomlsrc.Normalize(data), &header) != nil {
+		return nil
+	}
+	return header.Tags
+}
+
+// tagsSelected applies the include/exclude filters. Untagged files are
+// always selected; a tagged file is dropped if it has any excluded tag, or
+// if include tags are given and it has none of them.
+func tagsSelected(tags, include, exclude []string) bool {
+	if len(tags) == 0 {
+		return true
+	}
+	for _, t := range tags {
+		if slices.Contains(exclude, t) {
+			return false
+		}
+	}
+	if len(include) == 0 {
+		return true
+	}
+	for _, t := range tags {
+		if slices.Contains(include, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterTags drops files deselected by the tag filters in opts and records
+// them in Skipped.
+func (r *Result) filterTags(files []string, opts Options) []string {
+	if len(opts.IncludeTags) == 0 && len(opts.ExcludeTags) == 0 {
+		return files
+	}
+	kept := files[:0:0]
+	for _, f := range files {
+		if tagsSelected(fileTags(f), opts.IncludeTags, opts.ExcludeTags) {
+			kept = append(kept, f)
+		} else {
+			r.Skipped = append(r.Skipped, f)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,72 @@
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTagsSelected(t *testing.T) {
+	tests := []struct {
+		tags, include, exclude []string
+		want                   bool
+	}{
+		{nil, []string{"demo"}, []string{"full"}, true},
+		{[]string{"full", "music"}, nil, []string{"full"}, false},
+		{[]string{"demo"}, []string{"demo"}, []string{"full"}, true},
+		{[]string{"music"}, []string{"demo"}, nil, false},
+		{[]string{"demo", "full"}, []string{"demo"}, []string{"full"}, false},
+		{[]string{"music"}, nil, nil, true},
+	}
+	for _, tt := range tests {
+		if got := tagsSelected(tt.tags, tt.include, tt.exclude); got != tt.want {
+			t.Errorf("tagsSelected(%v, %v, %v) = %v, want %v", tt.tags, tt.include, tt.exclude, got, tt.want)
+		}
+	}
+}
+
+func TestBuild_TagFilters(t *testing.T) {
+	dir, cfg := setupDemoProject(t)
+
+	// Tag the track as full-game music.
+	trackPath := filepath.Join(dir, "assets/tracks/demo.track")
+	data, err := os.ReadFile(trackPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(trackPath, append([]byte(`tags = ["full", "music"]`+"\n"), data...), 0644)
+	// A second sfx only for the demo build.
+	os.WriteFile(filepath.Join(dir, "assets/sfx/promo.sfx"), []byte(`tags = ["demo"]
+duration = 0.05
+[[voice]]
+waveform = "square"
+[voice.envelope]
+sustain = 0.5
+[voice.pitch]
+start = 440
+`), 0644)
+
+	result := Build(Options{ExcludeTags: []string{"full"}}, cfg, dir)
+	if len(result.Errors) > 0 {
+		t.Fatalf("build errors: %v", result.Errors)
+	}
+	if len(result.Skipped) != 1 || filepath.Base(result.Skipped[0]) != "demo.track" {
+		t.Errorf("skipped = %v, want [demo.track]", result.Skipped)
+	}
+	manifest, err := os.ReadFile(filepath.Join(dir, "build/assets/manifest.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(manifest), "TrackDemo") {
+		t.Error("excluded track should not be in the manifest")
+	}
+	if !strings.Contains(string(manifest), "SFXPromo") || !strings.Contains(string(manifest), "SpriteSheetDemo") {
+		t.Error("untagged and non-excluded assets should still build")
+	}
+
+	result = Build(Options{IncludeTags: []string{"music"}}, cfg, dir)
+	if len(result.Skipped) != 1 || filepath.Base(result.Skipped[0]) != "promo.sfx" {
+		t.Errorf("skipped = %v, want [promo.sfx]", result.Skipped)
+	}
+}
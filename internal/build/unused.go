@@ -0,0 +1,175 @@
+package build
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/vgalaktionov/runefact/internal/config"
+	"github.com/vgalaktionov/runefact/internal/diagnostic"
+	"github.com/vgalaktionov/runefact/internal/instrument"
+	"github.com/vgalaktionov/runefact/internal/sprite"
+	"github.com/vgalaktionov/runefact/internal/tilemap"
+	"github.com/vgalaktionov/runefact/internal/track"
+)
+
+// addHint records an informational message for the given source file.
+func (r *Result) addHint(file, msg string) {
+	r.Hints = append(r.Hints, msg)
+	r.Diagnostics = append(r.Diagnostics, r.locate(file, diagnostic.Hint, msg, nil))
+}
+
+// reportUnused adds hints for assets nothing refers to: tileset keys absent
+// from every layer of their map, sprites no map uses, instruments no track
+// uses, and sfx/tracks whose manifest constant or path appears in no Go
+// source file. Files that fail to parse are skipped; they are reported
+// elsewhere. Entries matching [keep] patterns are never reported.
+func (r *Result) reportUnused(cfg *config.ProjectConfig, projectRoot string) {
+	assetsDir := filepath.Join(projectRoot, "assets")
+
+	// Maps: unused tileset keys, and collect sprite references.
+	mapFiles := discoverFiles(filepath.Join(assetsDir, "maps"), ".map", nil)
+	spriteRefs := map[string]bool{}
+	for _, f := range mapFiles {
+		mf, _, err := tilemap.LoadMapFile(f)
+		if err != nil {
+			continue
+		}
+		for _, key := range mf.UnusedTilesetKeys() {
+			if len(key) > 1 {
+				continue // the parser already warns that it needs brackets
+			}
+			r.addHint(f, fmt.Sprintf("%s: tileset key %q (%s) is not used in any layer", f, key, mf.Tileset[key]))
+		}
+		for _, ref := range mf.SpriteRefs() {
+			spriteRefs[ref] = true
+		}
+	}
+
+	// Sprites: only meaningful once the project has maps to refer to them.
+	// Compose parts and from sources count as used.
+	if len(mapFiles) > 0 {
+		var files []string
+		spriteFiles := map[string]*sprite.SpriteFile{}
+		for _, f := range discoverFiles(filepath.Join(assetsDir, "sprites"), ".sprite", nil) {
+			sf, err := sprite.LoadSpriteFile(f)
+			if err != nil {
+				continue
+			}
+			files = append(files, f)
+			spriteFiles[f] = sf
+			base := strings.TrimSuffix(filepath.Base(f), ".sprite")
+			for _, s := range sf.Sprites {
+				refs := s.Compose
+				if s.From != "" {
+					refs = append(slices.Clip(refs), s.From)
+				}
+				for _, ref := range refs {
+					if !strings.Contains(ref, ":") {
+						ref = base + ":" + ref
+					}
+					spriteRefs[ref] = true
+				}
+			}
+		}
+		for _, f := range files {
+			sf := spriteFiles[f]
+			base := strings.TrimSuffix(filepath.Base(f), ".sprite")
+			for _, s := range sf.Sprites {
+				ref := base + ":" + s.Name
+				if !spriteRefs[ref] && !keepMatch(cfg.Keep.Sprites, ref) {
+					r.addHint(f, fmt.Sprintf("%s: sprite %q is not referenced by any map (add %q to [keep] sprites if game code uses it)", f, s.Name, ref))
+				}
+			}
+		}
+	}
+
+	// Instruments: referenced by track channels.
+	trackFiles := discoverFiles(filepath.Join(assetsDir, "tracks"), ".track", nil)
+	used := map[string]bool{}
+	for _, f := range trackFiles {
+		tr, err := track.LoadTrack(f)
+		if err != nil {
+			continue
+		}
+		for _, ch := range tr.Channels {
+			used[ch.Instrument] = true
+		}
+	}
+	for _, f := range discoverFiles(filepath.Join(assetsDir, "instruments"), ".inst", nil) {
+		inst, err := instrument.LoadInstrument(f)
+		if err != nil {
+			continue
+		}
+		if !used[inst.Name] && !keepMatch(cfg.Keep.Instruments, filepath.Base(f)) {
+			r.addHint(f, fmt.Sprintf("%s: instrument %q is not used by any track", f, inst.Name))
+		}
+	}
+
+	// SFX and tracks: best effort, by searching game code for the manifest
+	// constant or the artifact path.
+	src := goSources(projectRoot, filepath.Join(projectRoot, cfg.Project.Output))
+	if src == "" {
+		return
+	}
+	audioFiles := append(discoverFiles(filepath.Join(assetsDir, "sfx"), ".sfx", nil), trackFiles...)
+	for _, f := range audioFiles {
+		name := filepath.Base(f)
+		if keepMatch(cfg.Keep.Audio, name) {
+			continue
+		}
+		// A track is used if the game uses its song or any exported
+		// pattern.
+		outs := audioOutputs(f, nil, cfg.Project.AudioSubdirs)
+		var looked []string
+		used := false
+		for _, out := range outs {
+			wav := filepath.ToSlash(out.Rel)
+			used = used || strings.Contains(src, out.Const) || strings.Contains(src, wav)
+			looked = append(looked, fmt.Sprintf("%s or %q", out.Const, wav))
+		}
+		if !used {
+			r.addHint(f, fmt.Sprintf("%s: %s is not referenced by any Go source (looked for %s)", f, name, strings.Join(looked, ", ")))
+		}
+	}
+}
+
+// keepMatch reports whether name matches any of the [keep] glob patterns.
+func keepMatch(patterns []string, name string) bool {
+	for _, pat := range patterns {
+		if ok, _ := path.Match(pat, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// goSources returns the concatenated contents of the project's .go files,
+// skipping hidden and vendor directories and the build output.
+func goSources(root, outputDir string) string {
+	var b strings.Builder
+	_ = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if p != root && (strings.HasPrefix(name, ".") || name == "vendor" || name == "node_modules" || p == outputDir) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasSuffix(p, ".go") {
+			if data, err := os.ReadFile(p); err == nil {
+				b.Write(data)
+				b.WriteByte('\n')
+			}
+		}
+		return nil
+	})
+	return b.String()
+}
@@ -0,0 +1,91 @@
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vgalaktionov/runefact/internal/diagnostic"
+)
+
+func TestValidate_UnusedHints(t *testing.T) {
+	dir, cfg := setupDemoProject(t)
+
+	// Map with a tileset key that no layer uses.
+	os.WriteFile(filepath.Join(dir, "assets/maps/demo.map"), []byte(`tile_size = 1
+[tileset]
+D = "demo:dot"
+S = "demo:stone"
+_ = ""
+[layer.main]
+pixels = """
+D_
+_D
+"""
+`), 0644)
+	// Sprites: stone is only in the unused tileset entry, ghost nowhere.
+	os.WriteFile(filepath.Join(dir, "assets/sprites/demo.sprite"), []byte(`palette = "default"
+grid = 1
+[sprite.dot]
+pixels = "r"
+[sprite.stone]
+pixels = "k"
+[sprite.ghost]
+pixels = "g"
+[sprite.logo]
+pixels = "b"
+`), 0644)
+	cfg.Keep.Sprites = []string{"demo:logo"}
+	// An instrument no track uses.
+	os.WriteFile(filepath.Join(dir, "assets/instruments/spare.inst"), []byte(`name = "spare"
+[oscillator]
+waveform = "square"
+`), 0644)
+	// Game code that only plays the track.
+	os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nvar _ = assets.TrackDemo\n"), 0644)
+
+	result := Validate(Options{}, cfg, dir)
+	if len(result.Errors) > 0 {
+		t.Fatalf("unexpected errors: %v", result.Errors)
+	}
+
+	hints := result.DiagnosticsBySeverity(diagnostic.Hint)
+	var msgs []string
+	for _, h := range hints {
+		msgs = append(msgs, h.File+": "+h.Message)
+	}
+	all := strings.Join(msgs, "\n")
+
+	for _, want := range []string{
+		`assets/maps/demo.map: tileset key "S" (demo:stone) is not used in any layer`,
+		`assets/sprites/demo.sprite: sprite "ghost" is not referenced by any map`,
+		`assets/instruments/spare.inst: instrument "spare" is not used by any track`,
+		`assets/sfx/blip.sfx: blip.sfx is not referenced by any Go source`,
+	} {
+		if !strings.Contains(all, want) {
+			t.Errorf("missing hint %q in:\n%s", want, all)
+		}
+	}
+	for _, unwanted := range []string{`"stone" is not referenced`, `"logo"`, `"dot"`, `"demo" is not used`, "demo.track"} {
+		if strings.Contains(all, unwanted) {
+			t.Errorf("unexpected hint containing %q in:\n%s", unwanted, all)
+		}
+	}
+	if len(hints) != len(result.Hints) || len(result.Warnings) != 0 {
+		t.Errorf("hints should not be warnings: hints=%d/%d warnings=%v", len(hints), len(result.Hints), result.Warnings)
+	}
+}
+
+func TestValidate_UnusedSkippedForFileFilter(t *testing.T) {
+	dir, cfg := setupDemoProject(t)
+	os.WriteFile(filepath.Join(dir, "assets/instruments/spare.inst"), []byte(`name = "spare"
+[oscillator]
+waveform = "square"
+`), 0644)
+
+	result := Validate(Options{Files: []string{"demo.sprite"}}, cfg, dir)
+	if len(result.Hints) != 0 {
+		t.Errorf("partial validate should not report unused assets: %v", result.Hints)
+	}
+}
@@ -0,0 +1,190 @@
+package build
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/vgalaktionov/runefact/internal/config"
+	"github.com/vgalaktionov/runefact/internal/diagnostic"
+	"github.com/vgalaktionov/runefact/internal/instrument"
+	"github.com/vgalaktionov/runefact/internal/sprite"
+	"github.com/vgalaktionov/runefact/internal/tilemap"
+	"github.com/vgalaktionov/runefact/internal/track"
+)
+
+const validateCacheFile = ".runefact/validate_cache.json"
+
+// LoadValidateCache reads the hashes of the files that last validated
+// without errors or warnings. Each hash covers the file, every file its
+// validation reads, and the project config.
+func LoadValidateCache(projectRoot string) *BuildCache {
+	return loadCache(filepath.Join(projectRoot, validateCacheFile))
+}
+
+// validateCache skips files a changed-only validation has already
+// validated cleanly, and afterwards records the ones that now are.
+type validateCache struct {
+	cache      *BuildCache
+	assetsDirs []string
+	cfgSum     string
+	// keys holds the hash of each file validated this run.
+	keys map[string]string
+	// paletteFiles maps the names of the palettes parsed this run to
+	// their files; instrumentFiles does the same for instruments, found
+	// when first needed.
+	paletteFiles    map[string]string
+	instrumentFiles map[string]string
+}
+
+func newValidateCache(projectRoot string, assetsDirs []string, cfg *config.ProjectConfig) *validateCache {
+	data, _ := json.Marshal(cfg)
+	sum := sha256.Sum256(data)
+	return &validateCache{
+		cache:      LoadValidateCache(projectRoot),
+		assetsDirs: assetsDirs,
+		cfgSum:     hex.EncodeToString(sum[:]),
+		keys:       map[string]string{},
+	}
+}
+
+// changed drops the files whose hash matches the cache, recording them in
+// r.Cached and the rest in r.Validated. A nil cache keeps every file.
+func (vc *validateCache) changed(r *Result, files []string) []string {
+	if vc == nil {
+		return files
+	}
+	kept := files[:0:0]
+	for _, f := range files {
+		key := vc.key(f)
+		if vc.cache.Hashes[f] == key {
+			r.Cached = append(r.Cached, f)
+			continue
+		}
+		vc.keys[f] = key
+		r.Validated = append(r.Validated, f)
+		kept = append(kept, f)
+	}
+	return kept
+}
+
+// save records the files validated this run that got no error or warning
+// and forgets the others.
+func (vc *validateCache) save(r *Result) error {
+	if vc == nil {
+		return nil
+	}
+	dirty := map[string]bool{}
+	for _, d := range r.Diagnostics {
+		if d.Severity != diagnostic.Hint {
+			dirty[d.File] = true
+		}
+	}
+	for f, key := range vc.keys {
+		if dirty[r.locate(f, diagnostic.Error, "", nil).File] {
+			delete(vc.cache.Hashes, f)
+		} else {
+			vc.cache.Hashes[f] = key
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(vc.cache.path), 0755); err != nil {
+		return err
+	}
+	return vc.cache.Save()
+}
+
+// key hashes file together with the config and every file its validation
+// reads, so a palette edit re-validates the sprites drawn with it.
+func (vc *validateCache) key(file string) string {
+	h := sha256.New()
+	h.Write([]byte(vc.cfgSum))
+	for _, f := range append([]string{file}, vc.deps(file)...) {
+		sum, err := hashFile(f)
+		if err != nil {
+			sum = "missing"
+		}
+		h.Write([]byte(f + "\x00" + sum + "\x00"))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// deps lists the files a file's validation reads, directly or through
+// another dependency, sorted. Files that don't parse have none; their
+// error keeps them out of the cache anyway.
+func (vc *validateCache) deps(file string) []string {
+	seen := map[string]bool{file: true}
+	var out []string
+	var walk func(f string)
+	walk = func(f string) {
+		for _, d := range vc.directDeps(f) {
+			if !seen[d] {
+				seen[d] = true
+				out = append(out, d)
+				walk(d)
+			}
+		}
+	}
+	walk(file)
+	slices.Sort(out)
+	return out
+}
+
+// directDeps lists the files a file refers to: a sprite's palettes and
+// the sprite files it composes from, a map's sprite files, a track's
+// instruments and an instrument's sample.
+func (vc *validateCache) directDeps(file string) []string {
+	find := func(subdir, name string) string {
+		return sprite.FindFile(subdirs(vc.assetsDirs, subdir), name)
+	}
+	var deps []string
+	switch filepath.Ext(file) {
+	case ".sprite":
+		sf, err := sprite.LoadSpriteFile(file)
+		if err != nil {
+			return nil
+		}
+		for _, name := range sf.PaletteRefs() {
+			deps = append(deps, namedFile(vc.paletteFiles, vc.assetsDirs, "palettes", name, ".palette"))
+		}
+		for _, s := range sf.Sprites {
+			for _, ref := range append(slices.Clip(s.Compose), s.From) {
+				if other, _, ok := strings.Cut(ref, ":"); ok {
+					deps = append(deps, find("sprites", other+".sprite"))
+				}
+			}
+		}
+	case ".map":
+		mf, _, err := tilemap.LoadMapFile(file)
+		if err != nil {
+			return nil
+		}
+		for _, ref := range mf.SpriteRefs() {
+			other, _, _ := strings.Cut(ref, ":")
+			deps = append(deps, find("sprites", other+".sprite"))
+		}
+	case ".track":
+		tr, err := track.LoadTrack(file)
+		if err != nil {
+			return nil
+		}
+		if vc.instrumentFiles == nil {
+			vc.instrumentFiles = namedFiles(vc.assetsDirs, "instruments", ".inst")
+		}
+		for _, ch := range tr.Channels {
+			deps = append(deps, namedFile(vc.instrumentFiles, vc.assetsDirs, "instruments", ch.Instrument, ".inst"))
+		}
+	case ".inst":
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil
+		}
+		if inst, err := instrument.ParseInstrument(data, filepath.Base(file)); err == nil && inst.Sample != nil {
+			deps = append(deps, instrument.SamplePath(file, inst.Sample.File))
+		}
+	}
+	return deps
+}
@@ -12,8 +12,46 @@ func checkUTF8(path string) error {
 	if err != nil {
 		return err
 	}
-	if !utf8.Valid(data) {
-		return fmt.Errorf("%s: file is not valid UTF-8, please re-encode", path)
+	if off := invalidUTF8Offset(data); off >= 0 {
+		return fmt.Errorf("%s: invalid UTF-8 at byte %d, please re-encode the file as UTF-8", path, off)
 	}
 	return nil
 }
+
+// invalidUTF8Offset returns the offset of the first byte that is not part
+// of a valid UTF-8 sequence, or -1 if data is valid.
+func invalidUTF8Offset(data []byte) int {
+	for i := 0; i < len(data); {
+		r, size := utf8.DecodeRune(data[i:])
+		if r == utf8.RuneError && size == 1 {
+			return i
+		}
+		i += size
+	}
+	return -1
+}
+
+// discover lists the asset files in subdir of every assets directory like
+// searchFiles. It warns about each file that is shadowed by one of the same
+// name in an earlier directory, and reports every file that isn't valid
+// UTF-8 or has a format_version this runefact can't read as an error and
+// leaves it out.
+func (r *Result) discover(assetsDirs []string, subdir, ext string, filter []string) []string {
+	files, shadowed := searchFiles(assetsDirs, subdir, ext, filter)
+	for _, s := range shadowed {
+		r.addWarning(s.by, fmt.Sprintf("%s: shadows %s from an included project", s.by, s.file))
+	}
+	valid := files[:0]
+	for _, f := range files {
+		if err := checkUTF8(f); err != nil {
+			r.addError(f, err)
+			continue
+		}
+		if err := checkFormatVersion(f); err != nil {
+			r.addError(f, err)
+			continue
+		}
+		valid = append(valid, f)
+	}
+	return valid
+}
@@ -0,0 +1,30 @@
+package build
+
+import (
+	"errors"
+	"os"
+
+	toml "github.com/pelletier/go-toml/v2"
+
+	"github.com/vgalaktionov/runefact/internal/migrate"
+)
+
+// checkFormatVersion reports a file whose format_version isn't valid or is
+// newer than this runefact understands. Older files still parse, and
+// runefact upgrade brings them up to date. Files that can't be read or
+// aren't valid TOML are left to the parser.
+func checkFormatVersion(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	v, err := migrate.Version(data, path)
+	var decodeErr *toml.DecodeError
+	if errors.As(err, &decodeErr) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return migrate.Supported(v, path)
+}
@@ -3,9 +3,17 @@ package config
 import (
 	"errors"
 	"fmt"
+	"math"
 	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
 
 	toml "github.com/pelletier/go-toml/v2"
+
+	"github.com/vgalaktionov/runefact/internal/palette"
+	"github.com/vgalaktionov/runefact/internal/tomlsrc"
 )
 
 // ProjectConfig represents the runefact.toml project configuration.
@@ -13,6 +21,11 @@ type ProjectConfig struct {
 	Project  ProjectSection  `toml:"project"`
 	Defaults DefaultsSection `toml:"defaults"`
 	Preview  PreviewSection  `toml:"preview"`
+	Watch    WatchSection    `toml:"watch"`
+	Lint     LintSection     `toml:"lint"`
+	Keep     KeepSection     `toml:"keep"`
+	Budgets  BudgetsSection  `toml:"budgets"`
+	Include  []IncludeEntry  `toml:"include"`
 }
 
 // ProjectSection contains project-level settings.
@@ -20,6 +33,112 @@ type ProjectSection struct {
 	Name    string `toml:"name"`
 	Output  string `toml:"output"`
 	Package string `toml:"package"`
+	// Scales lists integer factors for extra upscaled sprite sheets
+	// (player@2x.png, ...). The 1x sheet is always written.
+	Scales []int `toml:"scales"`
+	// ManifestJSON also writes manifest.json next to manifest.go, for
+	// engines other than ebitengine.
+	ManifestJSON bool `toml:"manifest_json"`
+	// TransparentColor, such as "#ff00ff", fills transparent pixels of
+	// sprite PNGs, which are then opaque, for engines that key out a color
+	// instead of reading alpha. Empty keeps the alpha channel.
+	TransparentColor string `toml:"transparent_color"`
+	// AudioSubdirs writes sfx to audio/sfx and tracks to audio/music
+	// instead of both to audio, so jump.sfx and jump.track can coexist.
+	AudioSubdirs bool `toml:"audio_subdirs"`
+	// SheetLayout arranges sprite sheets: "rows" (one row per sprite),
+	// "grid" (rows of uniform cells) or "packed" (rows packed onto
+	// shelves).
+	SheetLayout string `toml:"sheet_layout"`
+	// POT rounds sprite sheet dimensions up to powers of two.
+	POT bool `toml:"pot"`
+	// Pack writes all artifacts of a full build into one assets.rfpack
+	// file instead of separate files, for release builds.
+	Pack bool `toml:"pack"`
+	// PackCipher enciphers the pack: "none", "xor" or "aes-ctr". The key
+	// is given at build time, never in this file.
+	PackCipher string `toml:"pack_cipher"`
+}
+
+// IncludeEntry is an [[include]] table: another runefact project, such as
+// a bought asset pack, whose assets this project uses without copying them.
+type IncludeEntry struct {
+	// Path is the included project's root directory, relative to this
+	// project's root. Its assets are read from Path/assets.
+	Path string `toml:"path"`
+}
+
+// AssetsDirs returns the directories assets are searched in, in order:
+// the project's own assets directory, then each include's. A file found in
+// an earlier directory shadows files of the same name in later ones.
+func (c *ProjectConfig) AssetsDirs(projectRoot string) []string {
+	dirs := []string{filepath.Join(projectRoot, "assets")}
+	for _, inc := range c.Include {
+		root := inc.Path
+		if !filepath.IsAbs(root) {
+			root = filepath.Join(projectRoot, root)
+		}
+		dirs = append(dirs, filepath.Join(root, "assets"))
+	}
+	return dirs
+}
+
+// CheckOutput reports an output directory inside one of the assets
+// directories, or containing one. Either way the watcher would see each
+// build's artifacts as changes and rebuild forever. Symlinks are resolved,
+// so a link into assets/ from elsewhere is caught too.
+func (c *ProjectConfig) CheckOutput(projectRoot string) error {
+	out := resolvePath(filepath.Join(projectRoot, c.Project.Output))
+	for _, dir := range c.AssetsDirs(projectRoot) {
+		assets := resolvePath(dir)
+		if within(out, assets) {
+			return fmt.Errorf("project.output %q is inside the assets directory %s; move it out, or watch would rebuild on every build's own output", c.Project.Output, dir)
+		}
+		if within(assets, out) {
+			return fmt.Errorf("project.output %q contains the assets directory %s; move it elsewhere, or watch would rebuild on every build's own output", c.Project.Output, dir)
+		}
+	}
+	return nil
+}
+
+// resolvePath returns path with symlinks resolved in the part of it that
+// exists, since the output directory may not have been created yet.
+func resolvePath(path string) string {
+	path = filepath.Clean(path)
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	var rest []string
+	for {
+		if resolved, err := filepath.EvalSymlinks(path); err == nil {
+			return filepath.Join(append([]string{resolved}, rest...)...)
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return filepath.Join(append([]string{path}, rest...)...)
+		}
+		rest = append([]string{filepath.Base(path)}, rest...)
+		path = parent
+	}
+}
+
+// within reports whether path is dir or inside it.
+func within(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// ColorKey returns the parsed TransparentColor, or nil if it is unset.
+// ParseConfig has already checked that it parses.
+func (p ProjectSection) ColorKey() *palette.Color {
+	if p.TransparentColor == "" {
+		return nil
+	}
+	c, err := palette.ParseHexColor(p.TransparentColor)
+	if err != nil {
+		return nil
+	}
+	return &c
 }
 
 // DefaultsSection contains default asset parameters.
@@ -36,23 +155,159 @@ type PreviewSection struct {
 	Background   string  `toml:"background"`
 	PixelScale   int     `toml:"pixel_scale"`
 	AudioVolume  float64 `toml:"audio_volume"`
+	// RestartOnReload resumes playback with the new render when a playing
+	// .sfx or .track file changes on disk.
+	RestartOnReload bool `toml:"restart_on_reload"`
+	// Keys rebinds previewer actions, e.g. cycle_background = "F2". The
+	// previewer validates action and key names when it starts.
+	Keys map[string]string `toml:"keys"`
+}
+
+// WatchSection contains file watcher settings.
+type WatchSection struct {
+	// Ignore lists glob patterns for paths the watcher should skip.
+	Ignore []string `toml:"ignore"`
+}
+
+// LintSection contains extra checks applied during build and validate.
+// Every size limit in it is off at 0, whether it is on by default or not.
+type LintSection struct {
+	// MaxSheetSize caps sprite sheet width and height in pixels (0 = no limit).
+	MaxSheetSize int `toml:"max_sheet_size"`
+	// Strict turns lint warnings into errors.
+	Strict bool `toml:"strict"`
+	// AllowOversizedTiles accepts map tiles whose sprite sides are exact
+	// multiples of tile_size, such as 32x32 trees on a 16 map.
+	AllowOversizedTiles bool `toml:"allow_oversized_tiles"`
+	// MaxFromDepth caps how many from links a chain of derived sprites may
+	// have, such as walk_up from walk_left from walk_right (default 4).
+	MaxFromDepth int `toml:"max_from_depth"`
+	// MaxFramesPerSprite flags sprites with more animation frames than
+	// this, usually frames pasted in by mistake (default 64).
+	MaxFramesPerSprite int `toml:"max_frames_per_sprite"`
+	// MaxSheetDimension flags sprite sheets wider or taller than this many
+	// pixels, more than many GPUs and engines load (default 4096). Unlike
+	// MaxSheetSize it is on unless turned off.
+	MaxSheetDimension int `toml:"max_sheet_dimension"`
+}
+
+// KeepSection lists assets that are used outside of rune files (e.g. only
+// from game code) and should not be reported as unused. Entries are glob
+// patterns: sprites match "file:sprite", the others match file base names.
+type KeepSection struct {
+	Sprites     []string `toml:"sprites"`
+	Instruments []string `toml:"instruments"`
+	Audio       []string `toml:"audio"`
+}
+
+// BudgetsSection caps the size of build output, checked after every
+// build. Sizes are strings such as "512KB" or "10MB"; an empty budget is
+// no limit. The per-file budgets apply to each artifact of their kind.
+type BudgetsSection struct {
+	SpriteSheet string `toml:"sprite_sheet"` // each sheet, scaled variants included
+	SpriteTotal string `toml:"sprite_total"` // all of sprites/, frames included
+	Map         string `toml:"map"`          // each map JSON
+	AudioFile   string `toml:"audio_file"`   // each WAV
+	AudioTotal  string `toml:"audio_total"`  // all of audio/
+	Total       string `toml:"total"`        // the whole output directory
+}
+
+// Budget is one [budgets] entry with its size parsed.
+type Budget struct {
+	Name  string // config key, such as "audio_total"
+	Limit int64  // bytes
+}
+
+// List returns the budgets that are set, in the order of the section.
+// ParseConfig has already checked that they parse.
+func (b BudgetsSection) List() []Budget {
+	var out []Budget
+	for _, e := range b.entries() {
+		if e.value == "" {
+			continue
+		}
+		if n, err := ParseSize(e.value); err == nil {
+			out = append(out, Budget{Name: e.name, Limit: n})
+		}
+	}
+	return out
 }
 
-// LoadConfig reads and parses a runefact.toml file.
-func LoadConfig(path string) (*ProjectConfig, error) {
+func (b BudgetsSection) entries() []struct{ name, value string } {
+	return []struct{ name, value string }{
+		{"sprite_sheet", b.SpriteSheet},
+		{"sprite_total", b.SpriteTotal},
+		{"map", b.Map},
+		{"audio_file", b.AudioFile},
+		{"audio_total", b.AudioTotal},
+		{"total", b.Total},
+	}
+}
+
+// sizeUnits are the suffixes ParseSize accepts, binary multiples as file
+// managers show them. Longer suffixes come first so "KB" isn't read as "B".
+var sizeUnits = []struct {
+	suffix string
+	n      int64
+}{
+	{"KIB", 1 << 10}, {"MIB", 1 << 20}, {"GIB", 1 << 30},
+	{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30},
+	{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30},
+	{"B", 1},
+}
+
+// ParseSize parses a size such as "10MB", "1.5 MiB" or "4096" (bytes).
+// Units are case-insensitive and binary: 1KB is 1024 bytes.
+func ParseSize(s string) (int64, error) {
+	num := strings.ToUpper(strings.TrimSpace(s))
+	mult := int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(num, u.suffix) {
+			num, mult = strings.TrimSpace(strings.TrimSuffix(num, u.suffix)), u.n
+			break
+		}
+	}
+	v, err := strconv.ParseFloat(num, 64)
+	if err != nil || v <= 0 || math.IsInf(v, 0) || v*float64(mult) > math.MaxInt64/2 {
+		return 0, fmt.Errorf("invalid size %q, want a positive number with an optional unit such as \"10MB\"", s)
+	}
+	return int64(v * float64(mult)), nil
+}
+
+// LoadConfig reads and parses a runefact.toml file, then applies overrides
+// as ParseConfig does, and checks the output directory against the
+// project's root, the file's directory.
+func LoadConfig(path string, overrides ...Override) (*ProjectConfig, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("reading config: %w", err)
 	}
-	return ParseConfig(data)
+	cfg, err := ParseConfig(data, overrides...)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.CheckOutput(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+	return cfg, nil
 }
 
-// ParseConfig parses runefact.toml content and applies defaults.
-func ParseConfig(data []byte) (*ProjectConfig, error) {
-	cfg := &ProjectConfig{}
+// ParseConfig parses runefact.toml content, applies overrides in order and
+// then defaults, and validates the result. Pass environment overrides
+// before flags so that flags win: flags beat the environment, which beats
+// the file, which beats the defaults.
+func ParseConfig(data []byte, overrides ...Override) (*ProjectConfig, error) {
+	data = tomlsrc.Normalize(data)
+	// Limits that are on by default start at their default, so 0 in the
+	// file or an override turns them off; applyDefaults can't tell that 0
+	// from a key left out.
+	cfg := &ProjectConfig{Lint: LintSection{MaxFramesPerSprite: 64, MaxSheetDimension: 4096}}
 	if err := toml.Unmarshal(data, cfg); err != nil {
 		return nil, fmt.Errorf("parsing config: %w", err)
 	}
+	if err := applyOverrides(cfg, overrides); err != nil {
+		return nil, err
+	}
 	applyDefaults(cfg)
 	if err := validate(cfg); err != nil {
 		return nil, err
@@ -67,6 +322,15 @@ func applyDefaults(cfg *ProjectConfig) {
 	if cfg.Project.Package == "" {
 		cfg.Project.Package = "assets"
 	}
+	if cfg.Project.SheetLayout == "" {
+		cfg.Project.SheetLayout = "rows"
+	}
+	if cfg.Project.PackCipher == "" {
+		cfg.Project.PackCipher = "none"
+	}
+	if cfg.Lint.MaxFromDepth == 0 {
+		cfg.Lint.MaxFromDepth = 4
+	}
 	if cfg.Defaults.SpriteSize == 0 {
 		cfg.Defaults.SpriteSize = 16
 	}
@@ -107,5 +371,83 @@ func validate(cfg *ProjectConfig) error {
 	if cfg.Preview.AudioVolume < 0 || cfg.Preview.AudioVolume > 1 {
 		errs = append(errs, fmt.Errorf("preview.audio_volume must be 0.0-1.0, got %f", cfg.Preview.AudioVolume))
 	}
+	if cfg.Lint.MaxFromDepth < 0 {
+		errs = append(errs, fmt.Errorf("lint.max_from_depth must not be negative, got %d", cfg.Lint.MaxFromDepth))
+	}
+	if cfg.Lint.MaxSheetSize < 0 {
+		errs = append(errs, fmt.Errorf("lint.max_sheet_size must not be negative, got %d", cfg.Lint.MaxSheetSize))
+	}
+	if cfg.Lint.MaxFramesPerSprite < 0 {
+		errs = append(errs, fmt.Errorf("lint.max_frames_per_sprite must not be negative, got %d", cfg.Lint.MaxFramesPerSprite))
+	}
+	if cfg.Lint.MaxSheetDimension < 0 {
+		errs = append(errs, fmt.Errorf("lint.max_sheet_dimension must not be negative, got %d", cfg.Lint.MaxSheetDimension))
+	}
+	if tc := cfg.Project.TransparentColor; tc != "" {
+		if c, err := palette.ParseHexColor(tc); err != nil {
+			errs = append(errs, fmt.Errorf("project.transparent_color: %w", err))
+		} else if c.A != 255 {
+			errs = append(errs, fmt.Errorf("project.transparent_color must be opaque, got %q", tc))
+		}
+	}
+	for _, e := range cfg.Budgets.entries() {
+		if e.value == "" {
+			continue
+		}
+		if _, err := ParseSize(e.value); err != nil {
+			errs = append(errs, fmt.Errorf("budgets.%s: %w", e.name, err))
+		}
+	}
+	switch cfg.Project.SheetLayout {
+	case "rows", "grid", "packed":
+	default:
+		errs = append(errs, fmt.Errorf("project.sheet_layout must be rows, grid or packed, got %q", cfg.Project.SheetLayout))
+	}
+	switch cfg.Project.PackCipher {
+	case "none", "xor", "aes-ctr":
+	default:
+		errs = append(errs, fmt.Errorf("project.pack_cipher must be none, xor or aes-ctr, got %q", cfg.Project.PackCipher))
+	}
+	seenScales := map[int]bool{}
+	for _, sc := range cfg.Project.Scales {
+		if sc < 1 || sc > 16 {
+			errs = append(errs, fmt.Errorf("project.scales must be 1-16, got %d", sc))
+		} else if seenScales[sc] {
+			errs = append(errs, fmt.Errorf("project.scales: duplicate scale %d", sc))
+		}
+		seenScales[sc] = true
+	}
+	seenIncludes := map[string]bool{}
+	for i, inc := range cfg.Include {
+		p := filepath.Clean(inc.Path)
+		switch {
+		case inc.Path == "":
+			errs = append(errs, fmt.Errorf("include %d: path is required", i+1))
+		case p == ".":
+			errs = append(errs, fmt.Errorf("include %d: path %q is the project itself", i+1, inc.Path))
+		case seenIncludes[p]:
+			errs = append(errs, fmt.Errorf("include %d: %q is already included", i+1, inc.Path))
+		}
+		seenIncludes[p] = true
+	}
+	for _, pat := range cfg.Watch.Ignore {
+		if _, err := path.Match(pat, ""); err != nil {
+			errs = append(errs, fmt.Errorf("watch.ignore: invalid pattern %q: %w", pat, err))
+		}
+	}
+	for _, list := range []struct {
+		name     string
+		patterns []string
+	}{
+		{"keep.sprites", cfg.Keep.Sprites},
+		{"keep.instruments", cfg.Keep.Instruments},
+		{"keep.audio", cfg.Keep.Audio},
+	} {
+		for _, pat := range list.patterns {
+			if _, err := path.Match(pat, ""); err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid pattern %q: %w", list.name, pat, err))
+			}
+		}
+	}
 	return errors.Join(errs...)
 }
@@ -1,7 +1,13 @@
 package config
 
 import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+
+	"github.com/vgalaktionov/runefact/internal/palette"
 )
 
 func TestParseConfig_Valid(t *testing.T) {
@@ -56,6 +62,9 @@ name = "minimal"
 	if cfg.Project.Package != "assets" {
 		t.Errorf("default package = %q, want %q", cfg.Project.Package, "assets")
 	}
+	if cfg.Project.SheetLayout != "rows" || cfg.Project.POT {
+		t.Errorf("default sheet layout = %q, pot %v; want rows, false", cfg.Project.SheetLayout, cfg.Project.POT)
+	}
 	if cfg.Defaults.SpriteSize != 16 {
 		t.Errorf("default sprite_size = %d, want 16", cfg.Defaults.SpriteSize)
 	}
@@ -113,3 +122,238 @@ func TestLoadConfig_MissingFile(t *testing.T) {
 		t.Fatal("expected error for missing file")
 	}
 }
+
+func TestParseConfig_WatchIgnore(t *testing.T) {
+	input := []byte(`
+[watch]
+ignore = ["*.tmp", "drafts/*"]
+`)
+	cfg, err := ParseConfig(input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.Watch.Ignore) != 2 || cfg.Watch.Ignore[0] != "*.tmp" {
+		t.Errorf("watch.ignore = %v, want [*.tmp drafts/*]", cfg.Watch.Ignore)
+	}
+}
+
+func TestParseConfig_PreviewKeys(t *testing.T) {
+	input := []byte(`
+[preview.keys]
+cycle_background = "F2"
+toggle_grid = "G, Digit1"
+`)
+	cfg, err := ParseConfig(input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Preview.Keys["cycle_background"] != "F2" || cfg.Preview.Keys["toggle_grid"] != "G, Digit1" {
+		t.Errorf("preview.keys = %v", cfg.Preview.Keys)
+	}
+}
+
+func TestParseConfig_InvalidWatchIgnore(t *testing.T) {
+	input := []byte(`
+[watch]
+ignore = ["[unclosed"]
+`)
+	_, err := ParseConfig(input)
+	if err == nil {
+		t.Fatal("expected validation error for malformed ignore pattern")
+	}
+}
+
+func TestParseConfig_InvalidScales(t *testing.T) {
+	for _, scales := range []string{"[0]", "[2, 2]", "[32]"} {
+		input := []byte("[project]\nscales = " + scales + "\n")
+		if _, err := ParseConfig(input); err == nil {
+			t.Errorf("scales = %s: expected validation error", scales)
+		}
+	}
+}
+
+func TestParseConfig_SheetLayout(t *testing.T) {
+	cfg, err := ParseConfig([]byte("[project]\nsheet_layout = \"packed\"\npot = true\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Project.SheetLayout != "packed" || !cfg.Project.POT {
+		t.Errorf("sheet layout = %q, pot %v; want packed, true", cfg.Project.SheetLayout, cfg.Project.POT)
+	}
+	if _, err := ParseConfig([]byte("[project]\nsheet_layout = \"atlas\"\n")); err == nil {
+		t.Error("sheet_layout = atlas: expected validation error")
+	}
+}
+
+func TestParseConfig_MaxFromDepth(t *testing.T) {
+	cfg, err := ParseConfig([]byte("[project]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Lint.MaxFromDepth != 4 {
+		t.Errorf("default max_from_depth = %d, want 4", cfg.Lint.MaxFromDepth)
+	}
+	if _, err := ParseConfig([]byte("[lint]\nmax_from_depth = -1\n")); err == nil {
+		t.Error("max_from_depth = -1: expected validation error")
+	}
+}
+
+func TestParseConfig_SpriteLimits(t *testing.T) {
+	cfg, err := ParseConfig([]byte("[project]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Lint.MaxFramesPerSprite != 64 || cfg.Lint.MaxSheetDimension != 4096 {
+		t.Errorf("defaults: max_frames_per_sprite %d, max_sheet_dimension %d, want 64 and 4096",
+			cfg.Lint.MaxFramesPerSprite, cfg.Lint.MaxSheetDimension)
+	}
+	// 0 turns them off, as it does max_sheet_size, from the file or an
+	// override alike.
+	cfg, err = ParseConfig([]byte("[lint]\nmax_frames_per_sprite = 0\n"), Override{Key: "lint.max_sheet_dimension", Value: "0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Lint.MaxFramesPerSprite != 0 || cfg.Lint.MaxSheetDimension != 0 {
+		t.Errorf("0: max_frames_per_sprite %d, max_sheet_dimension %d, want both kept off",
+			cfg.Lint.MaxFramesPerSprite, cfg.Lint.MaxSheetDimension)
+	}
+	for _, line := range []string{"max_frames_per_sprite = -1", "max_sheet_dimension = -1"} {
+		if _, err := ParseConfig([]byte("[lint]\n" + line + "\n")); err == nil {
+			t.Errorf("%s: expected validation error", line)
+		}
+	}
+}
+
+func TestParseConfig_TransparentColor(t *testing.T) {
+	cfg, err := ParseConfig([]byte("[project]\ntransparent_color = \"#ff00ff\"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key := cfg.Project.ColorKey(); key == nil || *key != (palette.Color{R: 255, B: 255, A: 255}) {
+		t.Errorf("ColorKey() = %v, want magenta", key)
+	}
+
+	cfg, err = ParseConfig([]byte("[project]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key := cfg.Project.ColorKey(); key != nil {
+		t.Errorf("ColorKey() = %v, want nil when unset", key)
+	}
+
+	for _, tc := range []string{"magenta", "#ff00ff80", "#ff00f"} {
+		input := []byte("[project]\ntransparent_color = \"" + tc + "\"\n")
+		if _, err := ParseConfig(input); err == nil {
+			t.Errorf("transparent_color = %q: expected validation error", tc)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want int64
+	}{
+		{"4096", 4096},
+		{"512B", 512},
+		{"10MB", 10 << 20},
+		{"1.5 MiB", 3 << 19},
+		{"2k", 2048},
+		{"1GB", 1 << 30},
+	} {
+		got, err := ParseSize(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, %v; want %d", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{"", "MB", "-1MB", "0", "10TB", "ten"} {
+		if _, err := ParseSize(in); err == nil {
+			t.Errorf("ParseSize(%q): expected error", in)
+		}
+	}
+}
+
+func TestParseConfig_Budgets(t *testing.T) {
+	cfg, err := ParseConfig([]byte("[budgets]\naudio_total = \"10MB\"\nsprite_sheet = \"1MB\"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := cfg.Budgets.List()
+	want := []Budget{{"sprite_sheet", 1 << 20}, {"audio_total", 10 << 20}}
+	if !slices.Equal(got, want) {
+		t.Errorf("List() = %v, want %v", got, want)
+	}
+
+	if _, err := ParseConfig([]byte("[budgets]\ntotal = \"lots\"\n")); err == nil || !strings.Contains(err.Error(), "budgets.total") {
+		t.Errorf("err = %v, want a budgets.total error", err)
+	}
+}
+
+func TestParseConfig_Include(t *testing.T) {
+	cfg, err := ParseConfig([]byte(`
+[[include]]
+path = "../asset-packs/forest"
+
+[[include]]
+path = "/opt/packs/ui"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := cfg.AssetsDirs("/games/hero")
+	want := []string{"/games/hero/assets", "/games/asset-packs/forest/assets", "/opt/packs/ui/assets"}
+	if !slices.Equal(got, want) {
+		t.Errorf("AssetsDirs = %v, want %v", got, want)
+	}
+
+	for _, tt := range []struct{ input, want string }{
+		{"[[include]]\n", "include 1: path is required"},
+		{"[[include]]\npath = \"./\"\n", `include 1: path "./" is the project itself`},
+		{"[[include]]\npath = \"../forest\"\n[[include]]\npath = \"../forest/\"\n", `include 2: "../forest/" is already included`},
+	} {
+		if _, err := ParseConfig([]byte(tt.input)); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: got %v, want %q", tt.input, err, tt.want)
+		}
+	}
+}
+
+func TestLoadConfig_OutputOverlap(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "assets"), 0755)
+	os.MkdirAll(filepath.Join(root, "pack/assets"), 0755)
+	os.MkdirAll(filepath.Join(root, "real"), 0755)
+	if err := os.Symlink(filepath.Join(root, "assets"), filepath.Join(root, "linked")); err != nil {
+		t.Skip("symlinks unsupported:", err)
+	}
+	os.Symlink(filepath.Join(root, "real"), filepath.Join(root, "out"))
+	path := filepath.Join(root, "runefact.toml")
+
+	for _, tt := range []struct{ config, want string }{
+		{`output = "build/assets"`, ""},
+		{`output = "assets-build"`, ""},
+		{`output = "assets/build"`, `project.output "assets/build" is inside the assets directory`},
+		{`output = "assets"`, `project.output "assets" is inside the assets directory`},
+		{`output = "."`, `project.output "." contains the assets directory`},
+		{"output = \"pack/assets/gen\"\n[[include]]\npath = \"pack\"", `project.output "pack/assets/gen" is inside the assets directory`},
+		{`output = "linked/gen"`, `project.output "linked/gen" is inside the assets directory`},
+		{`output = "out/gen"`, ""},
+	} {
+		os.WriteFile(path, []byte("[project]\n"+tt.config), 0644)
+		_, err := LoadConfig(path)
+		if tt.want == "" && err != nil {
+			t.Errorf("%s: unexpected error %v", tt.config, err)
+		}
+		if tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)) {
+			t.Errorf("%s: err = %v, want %q", tt.config, err, tt.want)
+		}
+	}
+
+	// An assets directory that links into the output directory.
+	moved := t.TempDir()
+	os.MkdirAll(filepath.Join(moved, "gen/src"), 0755)
+	os.Symlink(filepath.Join(moved, "gen/src"), filepath.Join(moved, "assets"))
+	os.WriteFile(filepath.Join(moved, "runefact.toml"), []byte("[project]\noutput = \"gen\"\n"), 0644)
+	if _, err := LoadConfig(filepath.Join(moved, "runefact.toml")); err == nil || !strings.Contains(err.Error(), `project.output "gen" contains the assets directory`) {
+		t.Errorf("assets linked into the output: err = %v", err)
+	}
+}
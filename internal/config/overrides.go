@@ -0,0 +1,191 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// envPrefix starts the environment variables that override config values:
+// RUNEFACT_PROJECT_OUTPUT sets project.output.
+const envPrefix = "RUNEFACT_"
+
+// Override sets one config value from outside runefact.toml, such as an
+// environment variable or a --set flag.
+type Override struct {
+	// Key is the dotted path of the value, such as "project.output" or
+	// "preview.keys.cycle_background".
+	Key string
+	// Value is the value as text, parsed by the type of the key: "48000",
+	// "true", "dist/assets". Lists are comma-separated, such as "1,2".
+	Value string
+	// Source names where the override came from, for error messages.
+	Source string
+}
+
+// EnvOverrides returns the overrides set by RUNEFACT_<SECTION>_<KEY>
+// variables in environ, which is in the form os.Environ returns. A variable
+// that names a config section but no key in it is an error, so a typo
+// isn't ignored.
+func EnvOverrides(environ []string) ([]Override, error) {
+	var out []Override
+	for _, kv := range environ {
+		name, value, _ := strings.Cut(kv, "=")
+		rest, ok := strings.CutPrefix(name, envPrefix)
+		if !ok {
+			continue
+		}
+		key, known := envKey(strings.ToLower(rest))
+		if key == "" {
+			continue
+		}
+		if !known {
+			return nil, fmt.Errorf("%s: no config key %s", name, key)
+		}
+		out = append(out, Override{Key: key, Value: value, Source: name})
+	}
+	return out, nil
+}
+
+// envKey turns the lower-cased part of a variable name after RUNEFACT_
+// into a config key. It returns "" if the name starts with no section, and
+// false if the section has no such key.
+func envKey(name string) (string, bool) {
+	for section, sf := range sections() {
+		rest, ok := strings.CutPrefix(name, section+"_")
+		if !ok {
+			continue
+		}
+		for key, field := range fields(reflect.New(sf.Type).Elem()) {
+			if rest == key {
+				return section + "." + key, true
+			}
+			// Map keys follow the field: RUNEFACT_PREVIEW_KEYS_QUIT.
+			if field.Kind() == reflect.Map {
+				if mk, ok := strings.CutPrefix(rest, key+"_"); ok && mk != "" {
+					return section + "." + key + "." + mk, true
+				}
+			}
+		}
+		return section + "." + rest, false
+	}
+	return "", false
+}
+
+// ParseSetFlags parses --set flags of the form section.key=value.
+func ParseSetFlags(flags []string) ([]Override, error) {
+	out := make([]Override, 0, len(flags))
+	for _, f := range flags {
+		key, value, ok := strings.Cut(f, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("--set %s: want section.key=value", f)
+		}
+		out = append(out, Override{Key: strings.TrimSpace(key), Value: value, Source: "--set " + f})
+	}
+	return out, nil
+}
+
+// applyOverrides sets each override on cfg in order, so a later override
+// of the same key wins.
+func applyOverrides(cfg *ProjectConfig, overrides []Override) error {
+	for _, o := range overrides {
+		if err := applyOverride(cfg, o); err != nil {
+			return fmt.Errorf("%s: %w", o.Source, err)
+		}
+	}
+	return nil
+}
+
+func applyOverride(cfg *ProjectConfig, o Override) error {
+	parts := strings.Split(o.Key, ".")
+	if len(parts) < 2 {
+		return fmt.Errorf("key %q must be section.key", o.Key)
+	}
+	sf, ok := sections()[parts[0]]
+	if !ok {
+		return fmt.Errorf("no config section %s", parts[0])
+	}
+	field, ok := fields(reflect.ValueOf(cfg).Elem().FieldByIndex(sf.Index))[parts[1]]
+	if !ok {
+		return fmt.Errorf("no config key %s.%s", parts[0], parts[1])
+	}
+	if field.Kind() == reflect.Map {
+		if len(parts) != 3 || parts[2] == "" {
+			return fmt.Errorf("%s.%s is a table, set one entry as %s.%s.NAME", parts[0], parts[1], parts[0], parts[1])
+		}
+		if field.IsNil() {
+			field.Set(reflect.MakeMap(field.Type()))
+		}
+		field.SetMapIndex(reflect.ValueOf(parts[2]), reflect.ValueOf(o.Value))
+		return nil
+	}
+	if len(parts) != 2 {
+		return fmt.Errorf("no config key %s", o.Key)
+	}
+	return setValue(field, o.Key, o.Value)
+}
+
+// setValue parses s into v according to v's type.
+func setValue(v reflect.Value, key, s string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(s))
+		if err != nil {
+			return fmt.Errorf("%s must be true or false, got %q", key, s)
+		}
+		v.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			return fmt.Errorf("%s must be a whole number, got %q", key, s)
+		}
+		v.SetInt(int64(n))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return fmt.Errorf("%s must be a number, got %q", key, s)
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		list := reflect.MakeSlice(v.Type(), 0, 0)
+		if strings.TrimSpace(s) != "" {
+			for i, item := range strings.Split(s, ",") {
+				elem := reflect.New(v.Type().Elem()).Elem()
+				if err := setValue(elem, fmt.Sprintf("%s[%d]", key, i), strings.TrimSpace(item)); err != nil {
+					return err
+				}
+				list = reflect.Append(list, elem)
+			}
+		}
+		v.Set(list)
+	default:
+		return fmt.Errorf("%s can't be overridden", key)
+	}
+	return nil
+}
+
+// sections returns the table fields of ProjectConfig by their TOML name.
+// Arrays of tables, such as [[include]], can't be overridden.
+func sections() map[string]reflect.StructField {
+	t := reflect.TypeFor[ProjectConfig]()
+	out := make(map[string]reflect.StructField, t.NumField())
+	for i := range t.NumField() {
+		if f := t.Field(i); f.Type.Kind() == reflect.Struct {
+			out[f.Tag.Get("toml")] = f
+		}
+	}
+	return out
+}
+
+// fields returns the fields of a config section by their TOML name.
+func fields(section reflect.Value) map[string]reflect.Value {
+	t := section.Type()
+	out := make(map[string]reflect.Value, t.NumField())
+	for i := range t.NumField() {
+		out[t.Field(i).Tag.Get("toml")] = section.Field(i)
+	}
+	return out
+}
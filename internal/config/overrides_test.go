@@ -0,0 +1,154 @@
+package config
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+const overrideFile = `
+[project]
+output = "out"
+
+[defaults]
+sample_rate = 22050
+`
+
+func TestEnvOverrides(t *testing.T) {
+	overrides, err := EnvOverrides([]string{
+		"HOME=/home/me",
+		"RUNEFACT_PROJECT_OUTPUT=dist/assets",
+		"RUNEFACT_DEFAULTS_SAMPLE_RATE=48000",
+		"RUNEFACT_PREVIEW_KEYS_CYCLE_BACKGROUND=F2",
+		"RUNEFACT_HOME=/opt/runefact", // no such section, not ours
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := ParseConfig([]byte(overrideFile), overrides...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Project.Output != "dist/assets" {
+		t.Errorf("project.output = %q, want dist/assets", cfg.Project.Output)
+	}
+	if cfg.Defaults.SampleRate != 48000 {
+		t.Errorf("defaults.sample_rate = %d, want 48000", cfg.Defaults.SampleRate)
+	}
+	if cfg.Preview.Keys["cycle_background"] != "F2" {
+		t.Errorf("preview.keys = %v, want cycle_background = F2", cfg.Preview.Keys)
+	}
+	if cfg.Project.Package != "assets" {
+		t.Errorf("project.package = %q, want the default", cfg.Project.Package)
+	}
+
+	_, err = EnvOverrides([]string{"RUNEFACT_PROJECT_OUTPT=dist"})
+	if err == nil || !strings.Contains(err.Error(), "RUNEFACT_PROJECT_OUTPT: no config key project.outpt") {
+		t.Errorf("got %v, want an error naming the variable", err)
+	}
+}
+
+func TestParseSetFlags(t *testing.T) {
+	overrides, err := ParseSetFlags([]string{
+		"project.output=dist/assets",
+		"project.scales=2, 4",
+		"project.pot=true",
+		"preview.audio_volume=0.25",
+		"keep.sprites=ui:*,fx:*",
+		"watch.ignore=",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := ParseConfig([]byte(overrideFile+"\n[watch]\nignore = [\"*.tmp\"]\n"), overrides...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Project.Output != "dist/assets" || !cfg.Project.POT || cfg.Preview.AudioVolume != 0.25 {
+		t.Errorf("got output %q, pot %v, audio_volume %v", cfg.Project.Output, cfg.Project.POT, cfg.Preview.AudioVolume)
+	}
+	if !slices.Equal(cfg.Project.Scales, []int{2, 4}) {
+		t.Errorf("project.scales = %v, want [2 4]", cfg.Project.Scales)
+	}
+	if !slices.Equal(cfg.Keep.Sprites, []string{"ui:*", "fx:*"}) {
+		t.Errorf("keep.sprites = %v", cfg.Keep.Sprites)
+	}
+	if len(cfg.Watch.Ignore) != 0 {
+		t.Errorf("watch.ignore = %v, want it emptied", cfg.Watch.Ignore)
+	}
+
+	if _, err := ParseSetFlags([]string{"project.output"}); err == nil {
+		t.Error("expected an error for --set without =")
+	}
+}
+
+// Flags beat the environment, which beats the file, which beats the
+// defaults.
+func TestOverridePrecedence(t *testing.T) {
+	env, err := EnvOverrides([]string{"RUNEFACT_PROJECT_OUTPUT=env", "RUNEFACT_DEFAULTS_BIT_DEPTH=8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sets, err := ParseSetFlags([]string{"project.output=flag"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := ParseConfig([]byte(overrideFile), append(env, sets...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Project.Output != "flag" {
+		t.Errorf("project.output = %q, want the flag's", cfg.Project.Output)
+	}
+	if cfg.Defaults.BitDepth != 8 {
+		t.Errorf("defaults.bit_depth = %d, want the environment's 8", cfg.Defaults.BitDepth)
+	}
+	if cfg.Defaults.SampleRate != 22050 {
+		t.Errorf("defaults.sample_rate = %d, want the file's 22050", cfg.Defaults.SampleRate)
+	}
+	if cfg.Defaults.SpriteSize != 16 {
+		t.Errorf("defaults.sprite_size = %d, want the default 16", cfg.Defaults.SpriteSize)
+	}
+}
+
+func TestOverrideErrors(t *testing.T) {
+	tests := []struct {
+		set  string
+		want string
+	}{
+		// Values that parse are checked like the file's.
+		{"defaults.bit_depth=12", "defaults.bit_depth must be 8, 16, or 24, got 12"},
+		{"defaults.sample_rate=-1", "defaults.sample_rate must be positive, got -1"},
+		{"preview.audio_volume=2", "preview.audio_volume must be 0.0-1.0"},
+		{"project.sheet_layout=spiral", `project.sheet_layout must be rows, grid or packed, got "spiral"`},
+		{"project.scales=2,2", "project.scales: duplicate scale 2"},
+		{"budgets.total=lots", `budgets.total: invalid size "lots"`},
+		// Values that don't.
+		{"defaults.sample_rate=fast", `--set defaults.sample_rate=fast: defaults.sample_rate must be a whole number, got "fast"`},
+		{"project.pot=maybe", `project.pot must be true or false, got "maybe"`},
+		{"project.scales=2,x", `project.scales[1] must be a whole number, got "x"`},
+		{"project.outptu=dist", "no config key project.outptu"},
+		{"sound.volume=1", "no config section sound"},
+		{"output=dist", `key "output" must be section.key`},
+		{"preview.keys=F2", "preview.keys is a table, set one entry as preview.keys.NAME"},
+		{"project.output.dir=dist", "no config key project.output.dir"},
+	}
+	for _, tt := range tests {
+		sets, err := ParseSetFlags([]string{tt.set})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = ParseConfig([]byte(overrideFile), sets...)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("--set %s: got %v, want %q", tt.set, err, tt.want)
+		}
+	}
+
+	env, err := EnvOverrides([]string{"RUNEFACT_DEFAULTS_BIT_DEPTH=12"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseConfig([]byte(overrideFile), env...); err == nil || !strings.Contains(err.Error(), "defaults.bit_depth must be 8, 16, or 24, got 12") {
+		t.Errorf("got %v, want the bit depth error", err)
+	}
+}
@@ -35,8 +35,24 @@ type Diagnostic struct {
 	Severity   Severity
 	Message    string
 	Suggestion string // "did you mean X?"
+
+	// Cells are the map cells, as row and column from 1, that a warning
+	// sums up as regions in its message.
+	Cells [][2]int
+}
+
+// LineError is an error at a known line of a source file. Parsers that find
+// the line themselves, rather than through the TOML decoder, return it so
+// the diagnostic can point there.
+type LineError struct {
+	Line int // 1-indexed
+	Err  error
 }
 
+func (e *LineError) Error() string { return fmt.Sprintf("line %d: %v", e.Line, e.Err) }
+
+func (e *LineError) Unwrap() error { return e.Err }
+
 // Format returns the diagnostic as a human-readable string in file:line:col format.
 func (d Diagnostic) Format() string {
 	var b strings.Builder
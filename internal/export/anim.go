@@ -0,0 +1,41 @@
+package export
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/vgalaktionov/runefact/internal/sprite"
+)
+
+// SpritesAt draws sprites left to right, a pixel apart and top-aligned,
+// each at the frame it shows frame fps-ths of a second into its
+// animation. Frames advance the way the previewer advances them, so a
+// capture matches what it plays.
+func SpritesAt(sprites []sprite.ResolvedSprite, frame, fps int) (*image.RGBA, error) {
+	if len(sprites) == 0 {
+		return nil, fmt.Errorf("no sprites to draw")
+	}
+	if fps < 1 {
+		return nil, fmt.Errorf("fps must be positive, got %d", fps)
+	}
+	w, h := -1, 0
+	for _, s := range sprites {
+		w += s.Grid.W + 1
+		h = max(h, s.Grid.H)
+	}
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	x := 0
+	for _, s := range sprites {
+		n := 0
+		if s.Framerate > 0 {
+			n = sprite.FrameAt(s.Playback, len(s.Frames), frame*s.Framerate/fps)
+		}
+		f, err := sprite.RenderFrame(s, n, 1, nil)
+		if err != nil {
+			return nil, err
+		}
+		sprite.DrawScaled(img, f, f.Bounds().Add(image.Pt(x, 0)))
+		x += s.Grid.W + 1
+	}
+	return img, nil
+}
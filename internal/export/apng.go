@@ -0,0 +1,128 @@
+package export
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"io"
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// WriteAPNG writes frames as an animated PNG that shows each for 1/fps of
+// a second and loops forever. Every frame must be the size of the first.
+// Viewers without APNG support show the first frame.
+func WriteAPNG(w io.Writer, frames []*image.RGBA, fps int) error {
+	if len(frames) == 0 {
+		return fmt.Errorf("no frames to write")
+	}
+	if fps < 1 || fps > 0xffff {
+		return fmt.Errorf("fps must be between 1 and 65535, got %d", fps)
+	}
+	size := frames[0].Bounds().Size()
+	if size.X < 1 || size.Y < 1 {
+		return fmt.Errorf("frame size %dx%d is empty", size.X, size.Y)
+	}
+
+	cw := &chunkWriter{w: w}
+	if _, err := w.Write(pngSignature); err != nil {
+		return err
+	}
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], uint32(size.X))
+	binary.BigEndian.PutUint32(ihdr[4:], uint32(size.Y))
+	ihdr[8] = 8 // bit depth
+	ihdr[9] = 6 // color type: truecolor with alpha
+	cw.chunk("IHDR", ihdr)
+
+	actl := make([]byte, 8)
+	binary.BigEndian.PutUint32(actl[0:], uint32(len(frames)))
+	// actl[4:8] is the number of plays; 0 loops forever.
+	cw.chunk("acTL", actl)
+
+	// Sequence numbers count the fcTL and fdAT chunks together.
+	seq := uint32(0)
+	for i, f := range frames {
+		if f.Bounds().Size() != size {
+			return fmt.Errorf("frame %d is %v, want %v like the first", i, f.Bounds().Size(), size)
+		}
+		fctl := make([]byte, 26)
+		binary.BigEndian.PutUint32(fctl[0:], seq)
+		binary.BigEndian.PutUint32(fctl[4:], uint32(size.X))
+		binary.BigEndian.PutUint32(fctl[8:], uint32(size.Y))
+		// fctl[12:20] is the frame's x, y offset, always 0, 0.
+		binary.BigEndian.PutUint16(fctl[20:], 1)
+		binary.BigEndian.PutUint16(fctl[22:], uint16(fps))
+		// fctl[24], fctl[25]: dispose and blend op 0, replacing the whole
+		// canvas with each frame.
+		cw.chunk("fcTL", fctl)
+		seq++
+
+		data, err := imageData(f)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			cw.chunk("IDAT", data)
+			continue
+		}
+		fdat := make([]byte, 4, 4+len(data))
+		binary.BigEndian.PutUint32(fdat, seq)
+		cw.chunk("fdAT", append(fdat, data...))
+		seq++
+	}
+	cw.chunk("IEND", nil)
+	return cw.err
+}
+
+// imageData returns img's pixels as the zlib stream of an 8-bit RGBA PNG,
+// every row unfiltered.
+func imageData(img *image.RGBA) ([]byte, error) {
+	b := img.Bounds()
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	row := make([]byte, 1+4*b.Dx())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			// PNG stores straight alpha; image.RGBA is premultiplied.
+			c := img.RGBAAt(x, y)
+			p := row[1+4*(x-b.Min.X):]
+			p[3] = c.A
+			if c.A == 0 {
+				p[0], p[1], p[2] = 0, 0, 0
+				continue
+			}
+			p[0] = uint8(uint16(c.R) * 0xff / uint16(c.A))
+			p[1] = uint8(uint16(c.G) * 0xff / uint16(c.A))
+			p[2] = uint8(uint16(c.B) * 0xff / uint16(c.A))
+		}
+		if _, err := zw.Write(row); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// chunkWriter writes PNG chunks, keeping the first error.
+type chunkWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (cw *chunkWriter) chunk(typ string, data []byte) {
+	if cw.err != nil {
+		return
+	}
+	buf := make([]byte, 0, 12+len(data))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(data)))
+	buf = append(buf, typ...)
+	buf = append(buf, data...)
+	buf = binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf[4:]))
+	_, cw.err = cw.w.Write(buf)
+}
@@ -0,0 +1,169 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"slices"
+	"testing"
+
+	"github.com/vgalaktionov/runefact/internal/sprite"
+)
+
+type pngChunk struct {
+	typ  string
+	data []byte
+}
+
+// readChunks splits a PNG into its chunks, checking the signature and
+// every CRC.
+func readChunks(t *testing.T, data []byte) []pngChunk {
+	t.Helper()
+	if !bytes.HasPrefix(data, pngSignature) {
+		t.Fatal("missing PNG signature")
+	}
+	data = data[len(pngSignature):]
+	var chunks []pngChunk
+	for len(data) > 0 {
+		if len(data) < 12 {
+			t.Fatalf("truncated chunk after %d chunks", len(chunks))
+		}
+		n := binary.BigEndian.Uint32(data)
+		body := data[4 : 8+n]
+		if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(data[8+n:]) {
+			t.Fatalf("bad CRC on %s chunk", body[:4])
+		}
+		chunks = append(chunks, pngChunk{typ: string(body[:4]), data: body[4:]})
+		data = data[12+n:]
+	}
+	return chunks
+}
+
+func solidFrames(colors ...color.RGBA) []*image.RGBA {
+	var frames []*image.RGBA
+	for _, c := range colors {
+		img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+		for i := range img.Pix {
+			img.Pix[i] = []uint8{c.R, c.G, c.B, c.A}[i%4]
+		}
+		frames = append(frames, img)
+	}
+	return frames
+}
+
+func TestWriteAPNG(t *testing.T) {
+	red := color.RGBA{R: 0xff, A: 0xff}
+	frames := solidFrames(red, color.RGBA{G: 0xff, A: 0xff}, color.RGBA{})
+
+	var buf bytes.Buffer
+	if err := WriteAPNG(&buf, frames, 30); err != nil {
+		t.Fatal(err)
+	}
+	chunks := readChunks(t, buf.Bytes())
+
+	var types []string
+	for _, c := range chunks {
+		types = append(types, c.typ)
+	}
+	want := []string{"IHDR", "acTL", "fcTL", "IDAT", "fcTL", "fdAT", "fcTL", "fdAT", "IEND"}
+	if !slices.Equal(types, want) {
+		t.Fatalf("chunks = %v, want %v", types, want)
+	}
+
+	actl := chunks[1].data
+	if n := binary.BigEndian.Uint32(actl); n != 3 {
+		t.Errorf("acTL frames = %d, want 3", n)
+	}
+	if plays := binary.BigEndian.Uint32(actl[4:]); plays != 0 {
+		t.Errorf("acTL plays = %d, want 0 (forever)", plays)
+	}
+
+	// fcTL and fdAT share one sequence 0, 1, 2, ...
+	seq := uint32(0)
+	for _, c := range chunks {
+		switch c.typ {
+		case "fcTL":
+			if w, h := binary.BigEndian.Uint32(c.data[4:]), binary.BigEndian.Uint32(c.data[8:]); w != 3 || h != 2 {
+				t.Errorf("fcTL %d size = %dx%d, want 3x2", seq, w, h)
+			}
+			if num, den := binary.BigEndian.Uint16(c.data[20:]), binary.BigEndian.Uint16(c.data[22:]); num != 1 || den != 30 {
+				t.Errorf("fcTL %d delay = %d/%d, want 1/30", seq, num, den)
+			}
+			fallthrough
+		case "fdAT":
+			if got := binary.BigEndian.Uint32(c.data); got != seq {
+				t.Errorf("%s sequence = %d, want %d", c.typ, got, seq)
+			}
+			seq++
+		}
+	}
+
+	// A plain PNG decoder sees the first frame.
+	img, err := png.Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := color.RGBAModel.Convert(img.At(2, 1)); got != red {
+		t.Errorf("first frame pixel = %v, want red", got)
+	}
+
+	if err := WriteAPNG(&buf, append(frames, image.NewRGBA(image.Rect(0, 0, 1, 1))), 30); err == nil {
+		t.Error("frames of different sizes: expected an error")
+	}
+	if err := WriteAPNG(&buf, nil, 30); err == nil {
+		t.Error("no frames: expected an error")
+	}
+}
+
+func TestWriteGIF(t *testing.T) {
+	frames := solidFrames(color.RGBA{R: 0xff, A: 0xff}, color.RGBA{}, color.RGBA{B: 0xff, A: 0xff})
+	var buf bytes.Buffer
+	if err := WriteGIF(&buf, frames, 25); err != nil {
+		t.Fatal(err)
+	}
+	g, err := gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Image) != 3 || g.Delay[0] != 4 {
+		t.Fatalf("got %d frames with delay %d, want 3 with delay 4", len(g.Image), g.Delay[0])
+	}
+	if _, _, _, a := g.Image[1].At(0, 0).RGBA(); a != 0 {
+		t.Error("transparent frame is not transparent")
+	}
+	if got := color.RGBAModel.Convert(g.Image[2].At(0, 0)); got != (color.RGBA{B: 0xff, A: 0xff}) {
+		t.Errorf("third frame = %v, want blue", got)
+	}
+}
+
+func TestSpritesAt(t *testing.T) {
+	idle := testSprite()
+	idle.Framerate = 10
+	still := testSprite()
+	still.Grid.H = 3
+	for range 2 {
+		still.Frames[0].Pixels = append(still.Frames[0].Pixels, still.Frames[0].Pixels[0])
+		still.Frames[1].Pixels = append(still.Frames[1].Pixels, still.Frames[1].Pixels[0])
+	}
+
+	// At 30 fps, a 10 fps sprite shows its second frame from frame 3.
+	for _, tc := range []struct{ frame, redX int }{{0, 0}, {2, 0}, {3, 1}, {6, 0}} {
+		img, err := SpritesAt([]sprite.ResolvedSprite{idle, still}, tc.frame, 30)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b := img.Bounds(); b.Dx() != 5 || b.Dy() != 3 {
+			t.Fatalf("size = %v, want 5x3: two 2-wide sprites a pixel apart", b.Size())
+		}
+		if _, _, _, a := img.At(tc.redX, 0).RGBA(); a == 0 {
+			t.Errorf("frame %d: pixel %d,0 is empty, want the animated sprite's red", tc.frame, tc.redX)
+		}
+		if _, _, _, a := img.At(3, 2).RGBA(); a == 0 {
+			t.Errorf("frame %d: the sprite without a framerate left its first frame", tc.frame)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+// Package export writes sprites in formats other than the default sheet,
+// and captures of animations as APNG or GIF.
+package export
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/vgalaktionov/runefact/internal/palette"
+	"github.com/vgalaktionov/runefact/internal/sprite"
+)
+
+// FrameFileName returns the file name for frame n of a sprite, e.g. "idle_0.png".
+func FrameFileName(spriteName string, n int) string {
+	return fmt.Sprintf("%s_%d.png", spriteName, n)
+}
+
+// WriteFrames writes each frame of a sprite as its own PNG in dir and
+// returns the written paths in frame order. A non-nil key fills
+// transparent pixels, as for sprite sheets.
+func WriteFrames(s sprite.ResolvedSprite, dir string, scale int, key *palette.Color) ([]string, error) {
+	paths := make([]string, 0, len(s.Frames))
+	for i := range s.Frames {
+		img, err := sprite.RenderFrame(s, i, scale, key)
+		if err != nil {
+			return nil, err
+		}
+		path := filepath.Join(dir, FrameFileName(s.Name, i))
+		if err := sprite.WritePNG(img, path); err != nil {
+			return nil, fmt.Errorf("sprite %q frame %d: %w", s.Name, i, err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
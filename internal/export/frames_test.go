@@ -0,0 +1,63 @@
+package export
+
+import (
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vgalaktionov/runefact/internal/palette"
+	"github.com/vgalaktionov/runefact/internal/sprite"
+)
+
+func testSprite() sprite.ResolvedSprite {
+	red := palette.Color{R: 255, A: 255}
+	clear := palette.Color{}
+	return sprite.ResolvedSprite{
+		Name: "idle",
+		Grid: sprite.Grid{W: 2, H: 1},
+		Frames: []sprite.ResolvedFrame{
+			{Pixels: [][]palette.Color{{red, clear}}},
+			{Pixels: [][]palette.Color{{clear, red}}},
+		},
+	}
+}
+
+func TestWriteFrames(t *testing.T) {
+	dir := t.TempDir()
+	paths, err := WriteFrames(testSprite(), dir, 3, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 2 {
+		t.Fatalf("got %d paths, want 2", len(paths))
+	}
+	if filepath.Base(paths[1]) != "idle_1.png" {
+		t.Errorf("path = %s, want idle_1.png", paths[1])
+	}
+
+	f, err := os.Open(paths[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 6 || b.Dy() != 3 {
+		t.Fatalf("size = %dx%d, want 6x3", b.Dx(), b.Dy())
+	}
+	if _, _, _, a := img.At(2, 2).RGBA(); a != 0 {
+		t.Error("left block should be transparent")
+	}
+	if r, _, _, _ := img.At(3, 0).RGBA(); r>>8 != 255 {
+		t.Error("right block should be red")
+	}
+}
+
+func TestWriteFrames_InvalidScale(t *testing.T) {
+	if _, err := WriteFrames(testSprite(), t.TempDir(), 0, nil); err == nil {
+		t.Error("expected error for scale 0")
+	}
+}
@@ -0,0 +1,58 @@
+package export
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"io"
+)
+
+// WriteGIF writes frames as a looping GIF, for viewers that can't play
+// APNG. GIF delays are in hundredths of a second, so the frame rate is
+// rounded to fit. Pixels are either fully transparent or opaque, and all
+// frames together may use at most 255 colors.
+func WriteGIF(w io.Writer, frames []*image.RGBA, fps int) error {
+	if len(frames) == 0 {
+		return fmt.Errorf("no frames to write")
+	}
+	if fps < 1 {
+		return fmt.Errorf("fps must be positive, got %d", fps)
+	}
+
+	pal := color.Palette{color.RGBA{}}
+	index := map[color.RGBA]uint8{{}: 0}
+	anim := &gif.GIF{}
+	delay := max(1, (100+fps/2)/fps)
+	for i, f := range frames {
+		b := f.Bounds()
+		p := image.NewPaletted(image.Rect(0, 0, b.Dx(), b.Dy()), nil)
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				c := f.RGBAAt(x, y)
+				if c.A == 0 {
+					continue
+				}
+				c.A = 0xff
+				n, ok := index[c]
+				if !ok {
+					if len(pal) == 256 {
+						return fmt.Errorf("frame %d has more than 255 colors in all, too many for a GIF; write an APNG instead", i)
+					}
+					n = uint8(len(pal))
+					index[c] = n
+					pal = append(pal, c)
+				}
+				p.SetColorIndex(x-b.Min.X, y-b.Min.Y, n)
+			}
+		}
+		anim.Image = append(anim.Image, p)
+		anim.Delay = append(anim.Delay, delay)
+		anim.Disposal = append(anim.Disposal, gif.DisposalBackground)
+	}
+	// Every frame shares the palette, which is only complete now.
+	for _, p := range anim.Image {
+		p.Palette = pal
+	}
+	return gif.EncodeAll(w, anim)
+}
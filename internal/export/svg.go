@@ -0,0 +1,94 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/vgalaktionov/runefact/internal/palette"
+	"github.com/vgalaktionov/runefact/internal/sprite"
+)
+
+// SVG renders one frame of a sprite as an SVG document. Each horizontal run
+// of identical opaque pixels becomes a single <rect>; transparent pixels are
+// omitted. The document is w*scale by h*scale with a native-pixel viewBox.
+func SVG(s sprite.ResolvedSprite, frame, scale int) ([]byte, error) {
+	if frame < 0 || frame >= len(s.Frames) {
+		return nil, fmt.Errorf("sprite %q has no frame %d", s.Name, frame)
+	}
+	if scale < 1 {
+		return nil, fmt.Errorf("scale must be at least 1, got %d", scale)
+	}
+
+	var buf bytes.Buffer
+	writeHeader(&buf, s.Grid.W, s.Grid.H, scale)
+	writeRects(&buf, s.Frames[frame].Pixels, 0, 0)
+	buf.WriteString("</svg>\n")
+	return buf.Bytes(), nil
+}
+
+// SheetSVG renders every frame of every sprite as one SVG document, with each
+// sprite on its own row, frames laid out horizontally and a 1px gap between
+// cells.
+func SheetSVG(sprites []sprite.ResolvedSprite, scale int) ([]byte, error) {
+	if len(sprites) == 0 {
+		return nil, fmt.Errorf("no sprites to render")
+	}
+	if scale < 1 {
+		return nil, fmt.Errorf("scale must be at least 1, got %d", scale)
+	}
+
+	const gap = 1
+	w, h := 0, 0
+	for _, s := range sprites {
+		if rowW := len(s.Frames)*(s.Grid.W+gap) - gap; rowW > w {
+			w = rowW
+		}
+		h += s.Grid.H + gap
+	}
+	h -= gap
+
+	var buf bytes.Buffer
+	writeHeader(&buf, w, h, scale)
+	y := 0
+	for _, s := range sprites {
+		x := 0
+		for _, f := range s.Frames {
+			writeRects(&buf, f.Pixels, x, y)
+			x += s.Grid.W + gap
+		}
+		y += s.Grid.H + gap
+	}
+	buf.WriteString("</svg>\n")
+	return buf.Bytes(), nil
+}
+
+func writeHeader(buf *bytes.Buffer, w, h, scale int) {
+	fmt.Fprintf(buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+"\n",
+		w*scale, h*scale, w, h)
+}
+
+// writeRects emits one rect per horizontal run of identical opaque colors,
+// offset by (ox, oy).
+func writeRects(buf *bytes.Buffer, pixels [][]palette.Color, ox, oy int) {
+	for y, row := range pixels {
+		for x := 0; x < len(row); {
+			c := row[x]
+			run := 1
+			for x+run < len(row) && row[x+run] == c {
+				run++
+			}
+			if !c.IsTransparent() {
+				fmt.Fprintf(buf, `<rect x="%d" y="%d" width="%d" height="1" fill="%s"`, ox+x, oy+y, run, hexColor(c))
+				if c.A < 255 {
+					fmt.Fprintf(buf, ` fill-opacity="%.3g"`, float64(c.A)/255)
+				}
+				buf.WriteString("/>\n")
+			}
+			x += run
+		}
+	}
+}
+
+func hexColor(c palette.Color) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
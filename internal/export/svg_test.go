@@ -0,0 +1,83 @@
+package export
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/vgalaktionov/runefact/internal/palette"
+	"github.com/vgalaktionov/runefact/internal/sprite"
+)
+
+func heartSprite() sprite.ResolvedSprite {
+	r := palette.Color{R: 0xe4, G: 0x3b, B: 0x44, A: 255}
+	p := palette.Color{R: 0xff, G: 0x77, B: 0xa8, A: 128}
+	o := palette.Color{}
+	return sprite.ResolvedSprite{
+		Name: "heart",
+		Grid: sprite.Grid{W: 5, H: 4},
+		Frames: []sprite.ResolvedFrame{{Pixels: [][]palette.Color{
+			{o, r, o, r, o}, // 2 rects
+			{r, p, r, r, r}, // 3 rects
+			{o, r, r, r, o}, // 1 rect
+			{o, o, r, o, o}, // 1 rect
+		}}},
+	}
+}
+
+func TestSVG_RectCount(t *testing.T) {
+	out, err := SVG(heartSprite(), 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svg := string(out)
+
+	if got := strings.Count(svg, "<rect "); got != 7 {
+		t.Errorf("got %d rects, want 7:\n%s", got, svg)
+	}
+	if !strings.Contains(svg, `shape-rendering="crispEdges"`) {
+		t.Error("missing crispEdges hint")
+	}
+	if !strings.Contains(svg, `<rect x="2" y="1" width="3" height="1" fill="#e43b44"/>`) {
+		t.Errorf("missing merged run:\n%s", svg)
+	}
+	if !strings.Contains(svg, `fill="#ff77a8" fill-opacity="0.502"`) {
+		t.Errorf("missing semi-transparent pixel:\n%s", svg)
+	}
+	if err := xml.Unmarshal(out, new(struct{})); err != nil {
+		t.Errorf("invalid XML: %v", err)
+	}
+}
+
+func TestSVG_Scale(t *testing.T) {
+	out, err := SVG(heartSprite(), 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), `width="50" height="40" viewBox="0 0 5 4"`) {
+		t.Errorf("unexpected header:\n%s", out)
+	}
+}
+
+func TestSVG_BadFrame(t *testing.T) {
+	if _, err := SVG(heartSprite(), 1, 1); err == nil {
+		t.Error("expected error for missing frame")
+	}
+}
+
+func TestSheetSVG(t *testing.T) {
+	anim := testSprite()
+	out, err := SheetSVG([]sprite.ResolvedSprite{heartSprite(), anim}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svg := string(out)
+	// heart: 7 rects; idle: one red pixel per frame.
+	if got := strings.Count(svg, "<rect "); got != 9 {
+		t.Errorf("got %d rects, want 9", got)
+	}
+	// Second frame of idle sits after a 1px gap, on the row below the heart.
+	if !strings.Contains(svg, `<rect x="4" y="5" width="1"`) {
+		t.Errorf("second frame misplaced:\n%s", svg)
+	}
+}
@@ -0,0 +1,465 @@
+// Package format rewrites rune files in a canonical layout. It works on
+// lines instead of re-encoding the TOML, so comments survive, and it
+// checks that the result decodes to the same data as the input.
+package format
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	toml "github.com/pelletier/go-toml/v2"
+
+	"github.com/vgalaktionov/runefact/internal/tomlsrc"
+)
+
+// Dirs maps each rune file extension to its directory under assets/.
+var Dirs = map[string]string{
+	".palette": "palettes",
+	".sprite":  "sprites",
+	".map":     "maps",
+	".inst":    "instruments",
+	".sfx":     "sfx",
+	".track":   "tracks",
+}
+
+// topKeys is the canonical order of each format's top-level keys. Keys
+// not listed keep their order after the listed ones.
+var topKeys = map[string][]string{
+	".palette": {"tags", "format_version", "name"},
+	".sprite":  {"tags", "format_version", "palette", "grid"},
+	".map":     {"tags", "format_version", "tile_size"},
+	".inst":    {"tags", "format_version", "name"},
+	".sfx":     {"tags", "format_version", "duration", "volume"},
+	".track":   {"tags", "format_version", "tempo", "ticks_per_beat", "beats_per_bar", "loop", "loop_start", "master_volume"},
+}
+
+// Source formats the content of a rune file. ext selects the rules for
+// the file's format:
+//
+//   - keys and comments are unindented, with one space around "="
+//   - runs of blank lines collapse to one, and table headers have a blank
+//     line before them (and their comments), except subtables of the table
+//     right above
+//   - top-level keys follow the order of the format reference, and palette
+//     colors are sorted by key
+//   - pixel grids lose common indentation and trailing spaces
+//   - track pattern columns are aligned on "|"
+//
+// Line endings become "\n" and the file ends with a single newline.
+func Source(data []byte, ext string) ([]byte, error) {
+	data = tomlsrc.Normalize(data)
+	var before map[string]any
+	if err := toml.Unmarshal(data, &before); err != nil {
+		return nil, err
+	}
+
+	lines := strings.Split(string(data), "\n")
+	items, err := scan(lines)
+	if err != nil {
+		return nil, err
+	}
+	for i := range items {
+		formatBlock(&items[i], ext)
+	}
+	items = sortKeys(items, ext)
+	out := render(items)
+
+	// The rules above only touch layout. If the data changed anyway, keep
+	// the file as it was rather than risk breaking it.
+	var after map[string]any
+	if err := toml.Unmarshal(out, &after); err != nil || !reflect.DeepEqual(normalize(before), normalize(after)) {
+		return nil, fmt.Errorf("formatting would change the file's contents; leaving it as is")
+	}
+	return out, nil
+}
+
+type itemKind int
+
+const (
+	blankItem itemKind = iota
+	commentItem
+	headerItem
+	keyItem
+)
+
+// item is one logical line of a rune file. Key-value pairs may span
+// several lines.
+type item struct {
+	kind  itemKind
+	key   string // unquoted key, for keyItem
+	lines []string
+}
+
+// scan splits lines into items.
+func scan(lines []string) ([]item, error) {
+	// A trailing newline leaves an empty last element; render adds it back.
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	var items []item
+	for i := 0; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		switch {
+		case trimmed == "":
+			items = append(items, item{kind: blankItem})
+		case strings.HasPrefix(trimmed, "#"):
+			items = append(items, item{kind: commentItem, lines: []string{trimmed}})
+		case strings.HasPrefix(trimmed, "["):
+			items = append(items, item{kind: headerItem, lines: []string{trimmed}})
+		default:
+			key, value, ok := splitKey(trimmed)
+			if !ok {
+				return nil, fmt.Errorf("line %d: expected key = value", i+1)
+			}
+			it := item{kind: keyItem, key: unquote(key), lines: []string{key + " = " + value}}
+			var s scanner
+			s.feed(value)
+			for !s.done() && i+1 < len(lines) {
+				i++
+				it.lines = append(it.lines, lines[i])
+				s.feed(lines[i])
+			}
+			items = append(items, it)
+		}
+	}
+	return items, nil
+}
+
+// splitKey splits a "key = value" line at the first "=" outside quotes.
+func splitKey(line string) (key, value string, ok bool) {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '=':
+			return strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+// unquote strips the quotes of a quoted key. Dotted keys are left alone.
+func unquote(key string) string {
+	if len(key) >= 2 && (key[0] == '"' || key[0] == '\'') && key[len(key)-1] == key[0] {
+		return key[1 : len(key)-1]
+	}
+	return key
+}
+
+// scanner tracks whether a value continues on the next line: an open
+// multi-line string, array or inline table.
+type scanner struct {
+	depth int    // open [ and { outside strings
+	delim string // closing delimiter of an open multi-line string
+}
+
+func (s *scanner) done() bool {
+	return s.depth == 0 && s.delim == ""
+}
+
+func (s *scanner) feed(line string) {
+	for i := 0; i < len(line); i++ {
+		if s.delim != "" {
+			if line[i] == '\\' && s.delim == `"""` {
+				i++
+			} else if strings.HasPrefix(line[i:], s.delim) {
+				i += len(s.delim) - 1
+				// Up to two more quotes belong to the string's content.
+				for n := 0; n < 2 && i+1 < len(line) && line[i+1] == s.delim[0]; n++ {
+					i++
+				}
+				s.delim = ""
+			}
+			continue
+		}
+		switch c := line[i]; c {
+		case '#':
+			return
+		case '"', '\'':
+			if delim := strings.Repeat(string(c), 3); strings.HasPrefix(line[i:], delim) {
+				s.delim = delim
+				i += 2
+				continue
+			}
+			for i++; i < len(line) && line[i] != c; i++ {
+				if line[i] == '\\' && c == '"' {
+					i++
+				}
+			}
+		case '[', '{':
+			s.depth++
+		case ']', '}':
+			s.depth--
+		}
+	}
+}
+
+// formatBlock normalizes the multi-line strings this package understands:
+// pixel grids and track patterns. Blocks written any other way than
+//
+//	key = """
+//	...
+//	"""
+//
+// are left as they are.
+func formatBlock(it *item, ext string) {
+	if it.kind != keyItem || len(it.lines) < 2 {
+		return
+	}
+	var rows func([]string) []string
+	switch {
+	case it.key == "pixels" && (ext == ".sprite" || ext == ".map"):
+		rows = pixelRows
+	case it.key == "data" && ext == ".track":
+		rows = patternRows
+	default:
+		return
+	}
+	first, last := it.lines[0], strings.TrimSpace(it.lines[len(it.lines)-1])
+	delim := last
+	if (delim != `"""` && delim != `'''`) || !strings.HasSuffix(first, " = "+delim) {
+		return
+	}
+
+	body := it.lines[1 : len(it.lines)-1]
+	for len(body) > 0 && strings.TrimSpace(body[0]) == "" {
+		body = body[1:]
+	}
+	for len(body) > 0 && strings.TrimSpace(body[len(body)-1]) == "" {
+		body = body[:len(body)-1]
+	}
+	out := append([]string{first}, rows(body)...)
+	it.lines = append(out, delim)
+}
+
+// pixelRows trims trailing whitespace and removes the indentation shared by
+// all rows.
+func pixelRows(body []string) []string {
+	indent, first := "", true
+	for i, row := range body {
+		row = strings.TrimRight(row, " \t")
+		body[i] = row
+		if row == "" {
+			continue
+		}
+		if first {
+			indent, first = row[:len(row)-len(strings.TrimLeft(row, " \t"))], false
+		}
+		for !strings.HasPrefix(row, indent) {
+			indent = indent[:len(indent)-1]
+		}
+	}
+	rows := make([]string, len(body))
+	for i, row := range body {
+		rows[i] = strings.TrimPrefix(row, indent)
+	}
+	return rows
+}
+
+// patternRows pads the cells of every column to the column's widest cell.
+func patternRows(body []string) []string {
+	cells := make([][]string, len(body))
+	var widths []int
+	for i, row := range body {
+		row = strings.TrimSpace(row)
+		if !strings.Contains(row, "|") {
+			cells[i] = []string{row}
+			continue
+		}
+		cells[i] = strings.Split(row, "|")
+		for j := range cells[i] {
+			cells[i][j] = strings.TrimSpace(cells[i][j])
+			if j == len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[j] = max(widths[j], len(cells[i][j]))
+		}
+	}
+	rows := make([]string, len(body))
+	for i, row := range cells {
+		var b strings.Builder
+		for j, cell := range row {
+			if j > 0 {
+				b.WriteString(" | ")
+			}
+			b.WriteString(cell)
+			if j < len(row)-1 {
+				b.WriteString(strings.Repeat(" ", widths[j]-len(cell)))
+			}
+		}
+		rows[i] = b.String()
+	}
+	return rows
+}
+
+// sortKeys reorders the keys of each run of key lines not broken up by a
+// blank line or header. Comments directly above a key move with it.
+func sortKeys(items []item, ext string) []item {
+	section := ""
+	for start := 0; start < len(items); {
+		if items[start].kind == headerItem {
+			section = headerName(items[start].lines[0])
+			start++
+			continue
+		}
+		if items[start].kind == blankItem {
+			start++
+			continue
+		}
+		end := start
+		for end < len(items) && (items[end].kind == keyItem || items[end].kind == commentItem) {
+			end++
+		}
+		if cmp := keyOrder(section, ext); cmp != nil {
+			sortRun(items[start:end], cmp)
+		}
+		start = end
+	}
+	return items
+}
+
+// headerName returns the table name of a header line.
+func headerName(line string) string {
+	if i := strings.Index(line, "]"); i >= 0 {
+		line = line[:i]
+	}
+	return strings.Trim(line, "[ ")
+}
+
+// keyOrder returns how keys in a section are ordered, or nil to keep them
+// as written.
+func keyOrder(section, ext string) func(a, b string) int {
+	switch {
+	case section == "" && topKeys[ext] != nil:
+		order := topKeys[ext]
+		rank := func(k string) int {
+			if i := slices.Index(order, k); i >= 0 {
+				return i
+			}
+			return len(order)
+		}
+		return func(a, b string) int { return rank(a) - rank(b) }
+	case ext == ".palette" && section == "colors",
+		ext == ".sprite" && (section == "palette_extend" || strings.HasSuffix(section, ".palette_extend")):
+		return strings.Compare
+	}
+	return nil
+}
+
+// sortRun stably sorts a run of keys, each with the comments above it.
+// Comments after the last key stay at the end.
+func sortRun(run []item, cmp func(a, b string) int) {
+	var groups [][]item
+	var pending []item
+	for _, it := range run {
+		pending = append(pending, it)
+		if it.kind == keyItem {
+			groups = append(groups, pending)
+			pending = nil
+		}
+	}
+	slices.SortStableFunc(groups, func(a, b []item) int {
+		return cmp(a[len(a)-1].key, b[len(b)-1].key)
+	})
+	i := 0
+	for _, g := range groups {
+		i += copy(run[i:], g)
+	}
+	copy(run[i:], pending)
+}
+
+// render joins items back into a file, fixing up blank lines.
+func render(items []item) []byte {
+	var out []item
+	table := ""
+	for i, it := range items {
+		if it.kind == blankItem {
+			// Drop leading and doubled blank lines, and those between a
+			// header and its keys.
+			if len(out) == 0 || out[len(out)-1].kind == blankItem {
+				continue
+			}
+			if out[len(out)-1].kind == headerItem && i+1 < len(items) && items[i+1].kind != headerItem {
+				continue
+			}
+		}
+		if it.kind == headerItem {
+			// Give the header, with the comments right above it, a blank
+			// line before it. Subtables of the table above, like an
+			// entity's properties, may stay attached.
+			name := headerName(it.lines[0])
+			k := len(out)
+			for k > 0 && out[k-1].kind == commentItem {
+				k--
+			}
+			if k > 0 && out[k-1].kind != blankItem && !strings.HasPrefix(name, table+".") {
+				out = slices.Insert(out, k, item{kind: blankItem})
+			}
+			table = name
+		}
+		out = append(out, items[i])
+	}
+	for len(out) > 0 && out[len(out)-1].kind == blankItem {
+		out = out[:len(out)-1]
+	}
+
+	var b strings.Builder
+	for _, it := range out {
+		if it.kind == blankItem {
+			b.WriteString("\n")
+			continue
+		}
+		for _, line := range it.lines {
+			b.WriteString(line)
+			b.WriteString("\n")
+		}
+	}
+	return []byte(b.String())
+}
+
+// normalize maps decoded TOML to a form that ignores the whitespace the
+// formatter may change inside multi-line strings: blank lines, indentation
+// and the spacing around "|".
+func normalize(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, e := range v {
+			m[k] = normalize(e)
+		}
+		return m
+	case []any:
+		l := make([]any, len(v))
+		for i, e := range v {
+			l[i] = normalize(e)
+		}
+		return l
+	case string:
+		if !strings.Contains(v, "\n") {
+			return v
+		}
+		var rows []string
+		for _, row := range strings.Split(v, "\n") {
+			cells := strings.Split(row, "|")
+			for i := range cells {
+				cells[i] = strings.TrimSpace(cells[i])
+			}
+			if row := strings.Join(cells, "|"); row != "" {
+				rows = append(rows, row)
+			}
+		}
+		return strings.Join(rows, "\n")
+	}
+	return v
+}
@@ -0,0 +1,92 @@
+package format
+
+import "testing"
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		name, ext, in, want string
+	}{
+		{
+			name: "spacing and blank lines",
+			ext:  ".map",
+			in:   "\n\n  tile_size=8\n\n\n[tileset]\n\ng =   \"tiles:grass\"   \n[layer.bg]\npixels = \"\"\"\ng\n\"\"\"\n\n\n",
+			want: "tile_size = 8\n\n[tileset]\ng = \"tiles:grass\"\n\n[layer.bg]\npixels = \"\"\"\ng\n\"\"\"\n",
+		},
+		{
+			name: "comments stay with their keys and headers",
+			ext:  ".palette",
+			in:   "# Greens first.\nname = \"p\"\n# colors\n[colors]\n# dark\nk = \"#000\"\n# light\nw = \"#fff\"\n# also dark\nd = \"#111\" # trailing\n",
+			want: "# Greens first.\nname = \"p\"\n\n# colors\n[colors]\n# also dark\nd = \"#111\" # trailing\n# dark\nk = \"#000\"\n# light\nw = \"#fff\"\n",
+		},
+		{
+			name: "top-level key order",
+			ext:  ".track",
+			in:   "loop = true\nticks_per_beat = 4\ncustom = 1\ntempo = 120\ntags = [\"music\"]\n",
+			want: "tags = [\"music\"]\ntempo = 120\nticks_per_beat = 4\nloop = true\ncustom = 1\n",
+		},
+		{
+			name: "blank lines split sorting runs",
+			ext:  ".palette",
+			in:   "name = \"p\"\n[colors]\nz = \"#000\"\ny = \"#000\"\n\nb = \"#000\"\na = \"#000\"\n",
+			want: "name = \"p\"\n\n[colors]\ny = \"#000\"\nz = \"#000\"\n\na = \"#000\"\nb = \"#000\"\n",
+		},
+		{
+			name: "pixel indentation",
+			ext:  ".sprite",
+			in:   "palette = \"p\"\n[sprite.a]\npixels = \"\"\"\n\n    ab  \n    [x]a\n\n\"\"\"\n",
+			want: "palette = \"p\"\n\n[sprite.a]\npixels = \"\"\"\nab\n[x]a\n\"\"\"\n",
+		},
+		{
+			name: "pattern columns",
+			ext:  ".track",
+			in:   "tempo = 120\n[pattern.a]\ndata = \"\"\"\nlead|bass  |  drums\nC4 vC|C2|...\n  ---  | ---|x\n\"\"\"\n",
+			want: "tempo = 120\n\n[pattern.a]\ndata = \"\"\"\nlead  | bass | drums\nC4 vC | C2   | ...\n---   | ---  | x\n\"\"\"\n",
+		},
+		{
+			name: "subtables stay attached",
+			ext:  ".map",
+			in:   "tile_size = 8\n[layer.e]\n\n[[layer.e.entity]]\ntype = \"coin\"\n[layer.e.entity.properties]\nvalue = 1\n",
+			want: "tile_size = 8\n\n[layer.e]\n\n[[layer.e.entity]]\ntype = \"coin\"\n[layer.e.entity.properties]\nvalue = 1\n",
+		},
+		{
+			name: "multi-line arrays and CRLF",
+			ext:  ".track",
+			in:   "tempo = 120\r\n[song]\r\nsequence = [\r\n  \"a\", # intro\r\n  \"b\",\r\n]\r\n",
+			want: "tempo = 120\n\n[song]\nsequence = [\n  \"a\", # intro\n  \"b\",\n]\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Source([]byte(tt.in), tt.ext)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+			again, err := Source(got, tt.ext)
+			if err != nil || string(again) != string(got) {
+				t.Errorf("formatting is not idempotent:\n%s", again)
+			}
+		})
+	}
+}
+
+func TestSource_LeavesOtherStringsAlone(t *testing.T) {
+	// Only pixels and pattern data are reformatted; other multi-line
+	// strings, and blocks with text after the delimiter, keep every byte.
+	in := "palette = \"p\"\n[sprite.a]\nnote = \"\"\"\n  keep  \n\"\"\"\npixels = \"\"\"  ab\n  ab  \"\"\"\n"
+	got, err := Source([]byte(in), ".sprite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "palette = \"p\"\n\n" + in[len("palette = \"p\"\n"):]; string(got) != want {
+		t.Errorf("got:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func TestSource_InvalidTOML(t *testing.T) {
+	if _, err := Source([]byte("name = \n"), ".palette"); err == nil {
+		t.Error("expected an error for invalid TOML")
+	}
+}
@@ -0,0 +1,164 @@
+// Package golden compares rendered images against PNG files checked in
+// under testdata/golden, so a rendering change shows up in review as an
+// image rather than a hash. Metadata is compared the same way against
+// indented JSON files.
+//
+// Run the tests with -update to rewrite the goldens from the current
+// output. On a mismatch the actual image and a diff are written next to
+// the golden as NAME.got.png and NAME.diff.png, or the actual metadata as
+// NAME.got.json.
+package golden
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files from the current output")
+
+// Dir is where goldens live, relative to the package under test.
+const Dir = "testdata/golden"
+
+// diffColor marks pixels that differ in a diff image.
+var diffColor = color.NRGBA{R: 255, A: 255}
+
+// AssertImage fails t unless got matches the golden NAME.png pixel for
+// pixel. Colors are compared as stored in a PNG, unpremultiplied.
+func AssertImage(t testing.TB, name string, got image.Image) {
+	t.Helper()
+	path := filepath.Join(Dir, name+".png")
+	gotPath := filepath.Join(Dir, name+".got.png")
+	diffPath := filepath.Join(Dir, name+".diff.png")
+
+	if *update {
+		if err := writePNG(path, got); err != nil {
+			t.Fatal(err)
+		}
+		os.Remove(gotPath)
+		os.Remove(diffPath)
+		t.Logf("updated %s", path)
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	want, err := png.Decode(f)
+	f.Close()
+	if err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+
+	diff, n := Diff(want, got)
+	if n == 0 {
+		os.Remove(gotPath)
+		os.Remove(diffPath)
+		return
+	}
+	if err := writePNG(gotPath, got); err != nil {
+		t.Error(err)
+	}
+	if err := writePNG(diffPath, diff); err != nil {
+		t.Error(err)
+	}
+	if wb, gb := want.Bounds(), got.Bounds(); wb.Size() != gb.Size() {
+		t.Errorf("%s: image is %dx%d, golden is %dx%d; see %s",
+			name, gb.Dx(), gb.Dy(), wb.Dx(), wb.Dy(), gotPath)
+		return
+	}
+	t.Errorf("%s: %d pixel(s) differ from the golden; see %s and %s (run go test -update if the change is intended)",
+		name, n, gotPath, diffPath)
+}
+
+// AssertJSON fails t unless got, encoded as indented JSON, matches the
+// golden NAME.json byte for byte.
+func AssertJSON(t testing.TB, name string, got any) {
+	t.Helper()
+	path := filepath.Join(Dir, name+".json")
+	gotPath := filepath.Join(Dir, name+".got.json")
+
+	data, err := json.MarshalIndent(got, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = append(data, '\n')
+
+	if *update {
+		if err := writeFile(path, data); err != nil {
+			t.Fatal(err)
+		}
+		os.Remove(gotPath)
+		t.Logf("updated %s", path)
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if bytes.Equal(want, data) {
+		os.Remove(gotPath)
+		return
+	}
+	if err := writeFile(gotPath, data); err != nil {
+		t.Error(err)
+	}
+	t.Errorf("%s: differs from the golden; see %s (run go test -update if the change is intended)", name, gotPath)
+}
+
+// Diff returns an image of the union of both bounds, with the pixels that
+// differ in red and the rest a faded gray copy of want, and the number of
+// pixels that differ. A pixel inside only one of the images differs.
+func Diff(want, got image.Image) (*image.NRGBA, int) {
+	wb, gb := want.Bounds(), got.Bounds()
+	w := max(wb.Dx(), gb.Dx())
+	h := max(wb.Dy(), gb.Dy())
+	diff := image.NewNRGBA(image.Rect(0, 0, w, h))
+
+	n := 0
+	for y := range h {
+		for x := range w {
+			wp := image.Pt(wb.Min.X+x, wb.Min.Y+y)
+			gp := image.Pt(gb.Min.X+x, gb.Min.Y+y)
+			if !wp.In(wb) || !gp.In(gb) {
+				diff.SetNRGBA(x, y, diffColor)
+				n++
+				continue
+			}
+			wc := color.NRGBAModel.Convert(want.At(wp.X, wp.Y)).(color.NRGBA)
+			gc := color.NRGBAModel.Convert(got.At(gp.X, gp.Y)).(color.NRGBA)
+			if wc != gc {
+				diff.SetNRGBA(x, y, diffColor)
+				n++
+				continue
+			}
+			g := color.GrayModel.Convert(wc).(color.Gray).Y
+			diff.SetNRGBA(x, y, color.NRGBA{R: g, G: g, B: g, A: wc.A / 4})
+		}
+	}
+	return diff, n
+}
+
+func writePNG(path string, img image.Image) error {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return fmt.Errorf("encoding %s: %w", path, err)
+	}
+	return writeFile(path, buf.Bytes())
+}
+
+func writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
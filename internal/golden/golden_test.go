@@ -0,0 +1,48 @@
+package golden
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	want := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	want.Set(0, 0, color.RGBA{R: 255, A: 255})
+	got := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	got.Set(0, 0, color.RGBA{B: 255, A: 255}) // channels swapped
+
+	diff, n := Diff(want, want)
+	if n != 0 {
+		t.Errorf("identical images: %d pixels differ", n)
+	}
+	if diff.Bounds() != want.Bounds() {
+		t.Errorf("diff bounds = %v, want %v", diff.Bounds(), want.Bounds())
+	}
+
+	diff, n = Diff(want, got)
+	if n != 1 || diff.NRGBAAt(0, 0) != diffColor || diff.NRGBAAt(1, 1) == diffColor {
+		t.Errorf("swapped pixel: %d differ, diff(0,0) = %v", n, diff.NRGBAAt(0, 0))
+	}
+}
+
+func TestDiff_Size(t *testing.T) {
+	want := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	got := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	diff, n := Diff(want, got)
+	if n != 2 || diff.Bounds().Dx() != 3 {
+		t.Errorf("extra column: %d differ in a %v diff, want 2 in 3x2", n, diff.Bounds())
+	}
+}
+
+func TestDiff_Premultiplied(t *testing.T) {
+	// A half-transparent pixel survives the round trip through PNG's
+	// unpremultiplied colors, so it must compare equal across the models.
+	rgba := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	rgba.Set(0, 0, color.NRGBA{R: 200, G: 100, B: 50, A: 128})
+	nrgba := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	nrgba.Set(0, 0, color.NRGBAModel.Convert(rgba.At(0, 0)))
+	if _, n := Diff(nrgba, rgba); n != 0 {
+		t.Errorf("%d pixels differ between the models", n)
+	}
+}
@@ -0,0 +1,380 @@
+// Package inspect summarizes rune files without building them. The MCP
+// inspect tools and `runefact inspect` share these reports, so both show
+// the same data.
+package inspect
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/vgalaktionov/runefact/internal/audio"
+	"github.com/vgalaktionov/runefact/internal/instrument"
+	"github.com/vgalaktionov/runefact/internal/sfx"
+	"github.com/vgalaktionov/runefact/internal/sprite"
+	"github.com/vgalaktionov/runefact/internal/tilemap"
+	"github.com/vgalaktionov/runefact/internal/track"
+)
+
+// Report is the summary of one file. It marshals to the JSON the MCP
+// inspect tools return.
+type Report interface {
+	// WriteText writes a human-readable summary.
+	WriteText(w io.Writer)
+}
+
+// Dirs maps each inspectable extension to its directory under assets/.
+var Dirs = map[string]string{
+	".sprite": "sprites",
+	".map":    "maps",
+	".sfx":    "sfx",
+	".track":  "tracks",
+}
+
+// File inspects the file at path, choosing the report by extension. name
+// is the file as the user wrote it and is echoed in the report.
+func File(path, name string) (Report, error) {
+	switch ext := filepath.Ext(path); ext {
+	case ".sprite":
+		return Sprite(path, name)
+	case ".map":
+		return Map(path, name)
+	case ".sfx":
+		return SFX(path, name)
+	case ".track":
+		return Track(path, name)
+	default:
+		return nil, fmt.Errorf("cannot inspect %q files (supported: .sprite, .map, .sfx, .track)", ext)
+	}
+}
+
+// SpriteReport summarizes a .sprite file.
+type SpriteReport struct {
+	File          string            `json:"file"`
+	Palette       string            `json:"palette"`
+	PaletteExtend map[string]string `json:"palette_extend"`
+	DefaultGrid   string            `json:"default_grid"`
+	Sprites       []SpriteInfo      `json:"sprites"`
+}
+
+// SpriteInfo is one sprite in a SpriteReport.
+type SpriteInfo struct {
+	Name      string `json:"name"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	Frames    int    `json:"frames"`
+	Framerate int    `json:"framerate"`
+
+	// Palette is set when the sprite overrides the file's palette.
+	Palette  string           `json:"palette,omitempty"`
+	Events   map[int][]string `json:"events,omitempty"`
+	Hitboxes []sprite.Hitbox  `json:"hitboxes,omitempty"`
+}
+
+// Sprite inspects a .sprite file.
+func Sprite(path, name string) (*SpriteReport, error) {
+	sf, err := sprite.LoadSpriteFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &SpriteReport{
+		File:          name,
+		Palette:       sf.PaletteRef,
+		PaletteExtend: sf.PaletteExtend,
+		DefaultGrid:   fmt.Sprintf("%dx%d", sf.DefaultGrid.W, sf.DefaultGrid.H),
+		Sprites:       make([]SpriteInfo, len(sf.Sprites)),
+	}
+	if r.PaletteExtend == nil {
+		r.PaletteExtend = map[string]string{}
+	}
+	for i, s := range sf.Sprites {
+		r.Sprites[i] = SpriteInfo{
+			Name:      s.Name,
+			Width:     s.Grid.W,
+			Height:    s.Grid.H,
+			Frames:    len(s.Frames),
+			Framerate: s.Framerate,
+			Palette:   s.Palette,
+			Events:    s.Events,
+			Hitboxes:  s.Hitboxes,
+		}
+	}
+	return r, nil
+}
+
+// WriteText implements Report.
+func (r *SpriteReport) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "%s: sprite file, palette %q, grid %s\n", r.File, r.Palette, r.DefaultGrid)
+	width := 0
+	for _, s := range r.Sprites {
+		width = max(width, len(s.Name))
+	}
+	for _, s := range r.Sprites {
+		fmt.Fprintf(w, "  %-*s  %dx%d", width, s.Name, s.Width, s.Height)
+		if s.Frames > 1 {
+			fmt.Fprintf(w, ", %d frames at %d fps", s.Frames, s.Framerate)
+		}
+		if s.Palette != "" {
+			fmt.Fprintf(w, ", palette %q", s.Palette)
+		}
+		if len(s.Events) > 0 {
+			frames := make([]int, 0, len(s.Events))
+			for f := range s.Events {
+				frames = append(frames, f)
+			}
+			sort.Ints(frames)
+			var events []string
+			for _, f := range frames {
+				events = append(events, fmt.Sprintf("%d %s", f, strings.Join(s.Events[f], "+")))
+			}
+			fmt.Fprintf(w, ", events: %s", strings.Join(events, ", "))
+		}
+		if len(s.Hitboxes) > 0 {
+			fmt.Fprintf(w, ", %d hitbox(es)", len(s.Hitboxes))
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// MapReport summarizes a .map file.
+type MapReport struct {
+	File     string      `json:"file"`
+	TileSize int         `json:"tile_size"`
+	Layers   []LayerInfo `json:"layers"`
+	Warnings []string    `json:"warnings"`
+}
+
+// LayerInfo is one layer in a MapReport. Rows and Cols are set for tile
+// layers, EntityCount for entity layers.
+type LayerInfo struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Rows        int    `json:"rows,omitempty"`
+	Cols        int    `json:"cols,omitempty"`
+	EntityCount int    `json:"entity_count,omitempty"`
+}
+
+// Map inspects a .map file. Parser warnings are part of the report.
+func Map(path, name string) (*MapReport, error) {
+	mf, warnings, err := tilemap.LoadMapFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &MapReport{
+		File:     name,
+		TileSize: mf.TileSize,
+		Layers:   make([]LayerInfo, len(mf.Layers)),
+		Warnings: make([]string, len(warnings)),
+	}
+	for i, l := range mf.Layers {
+		li := LayerInfo{Name: l.Name, Type: l.Type}
+		if l.Type == "tile" && len(l.Data) > 0 {
+			li.Rows = len(l.Data)
+			li.Cols = len(l.Data[0])
+		}
+		if l.Type == "entity" {
+			li.EntityCount = len(l.Entities)
+		}
+		r.Layers[i] = li
+	}
+	for i, w := range warnings {
+		r.Warnings[i] = w.Message
+	}
+	return r, nil
+}
+
+// WriteText implements Report.
+func (r *MapReport) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "%s: map, %d px tiles, %d layer(s)\n", r.File, r.TileSize, len(r.Layers))
+	width := 0
+	for _, l := range r.Layers {
+		width = max(width, len(l.Name))
+	}
+	for _, l := range r.Layers {
+		if l.Type == "entity" {
+			fmt.Fprintf(w, "  %-*s  entities, %d placed\n", width, l.Name, l.EntityCount)
+		} else {
+			fmt.Fprintf(w, "  %-*s  tiles, %dx%d\n", width, l.Name, l.Cols, l.Rows)
+		}
+	}
+	for _, msg := range r.Warnings {
+		fmt.Fprintf(w, "warning: %s\n", msg)
+	}
+}
+
+// SFXReport summarizes a .sfx file.
+type SFXReport struct {
+	File      string   `json:"file"`
+	Type      string   `json:"type"` // always "sfx"
+	Duration  float64  `json:"duration"`
+	Volume    float64  `json:"volume"`
+	Voices    int      `json:"voices"`
+	Waveforms []string `json:"waveforms"` // one per voice
+}
+
+// SFX inspects a .sfx file.
+func SFX(path, name string) (*SFXReport, error) {
+	s, err := sfx.LoadSFX(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &SFXReport{
+		File:      name,
+		Type:      "sfx",
+		Duration:  s.Duration,
+		Volume:    s.Volume,
+		Voices:    len(s.Voices),
+		Waveforms: make([]string, len(s.Voices)),
+	}
+	for i, v := range s.Voices {
+		r.Waveforms[i] = v.Waveform
+	}
+	return r, nil
+}
+
+// WriteText implements Report.
+func (r *SFXReport) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "%s: sound effect, %.2fs, volume %.2f\n", r.File, r.Duration, r.Volume)
+	fmt.Fprintf(w, "  %d voice(s): %s\n", r.Voices, strings.Join(r.Waveforms, ", "))
+}
+
+// TrackReport summarizes a .track file.
+type TrackReport struct {
+	File     string   `json:"file"`
+	Type     string   `json:"type"` // always "track"
+	Tempo    int      `json:"tempo"`
+	Channels int      `json:"channels"`
+	Patterns int      `json:"patterns"`
+	Sequence []string `json:"sequence"`
+	Loop     bool     `json:"loop"`
+	// Duration is the length in seconds, worked out from the sequence
+	// without rendering.
+	Duration float64 `json:"duration"`
+	// Notes is the lowest and highest note of each channel that plays
+	// any, in channel order, so outliers like a typo'd octave stand out.
+	Notes []ChannelNotes `json:"notes"`
+}
+
+// ChannelNotes is the span of notes a track channel plays.
+type ChannelNotes struct {
+	Channel    string `json:"channel"`
+	Instrument string `json:"instrument"`
+	Low        string `json:"low"`
+	High       string `json:"high"`
+}
+
+// Track inspects a .track file.
+func Track(path, name string) (*TrackReport, error) {
+	tr, err := track.LoadTrack(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &TrackReport{
+		File:     name,
+		Type:     "track",
+		Tempo:    tr.Tempo,
+		Channels: len(tr.Channels),
+		Patterns: len(tr.Patterns),
+		Sequence: tr.Sequence,
+		Loop:     tr.Loop,
+		Duration: tr.Duration(),
+		Notes:    []ChannelNotes{},
+	}
+	if r.Sequence == nil {
+		r.Sequence = []string{}
+	}
+	for i, nr := range tr.ChannelRanges() {
+		if nr != nil {
+			ch := tr.Channels[i]
+			r.Notes = append(r.Notes, ChannelNotes{
+				Channel:    ch.Name,
+				Instrument: ch.Instrument,
+				Low:        audio.NoteName(nr.Low),
+				High:       audio.NoteName(nr.High),
+			})
+		}
+	}
+	return r, nil
+}
+
+// WriteText implements Report.
+func (r *TrackReport) WriteText(w io.Writer) {
+	loop := ""
+	if r.Loop {
+		loop = ", loops"
+	}
+	fmt.Fprintf(w, "%s: track, %d bpm, %s%s\n", r.File, r.Tempo, formatDuration(r.Duration), loop)
+	fmt.Fprintf(w, "  %d channel(s), %d pattern(s)\n", r.Channels, r.Patterns)
+	fmt.Fprintf(w, "  sequence: %s\n", strings.Join(r.Sequence, " "))
+	for _, n := range r.Notes {
+		fmt.Fprintf(w, "  %s (%s): %s-%s\n", n.Channel, n.Instrument, n.Low, n.High)
+	}
+}
+
+// PatternReport summarizes one pattern of a .track file, rendered on its
+// own.
+type PatternReport struct {
+	File     string  `json:"file"`
+	Type     string  `json:"type"` // always "pattern"
+	Pattern  string  `json:"pattern"`
+	Ticks    int     `json:"ticks"`
+	Duration float64 `json:"duration"`
+	// Peak is the largest sample magnitude, from 0 (silent) to 1.
+	Peak float64 `json:"peak"`
+	// MissingInstruments lists channel instruments that aren't among the
+	// instruments given; those channels are silent.
+	MissingInstruments []string `json:"missing_instruments,omitempty"`
+}
+
+// Pattern renders one pattern of the .track file at path with the given
+// instruments and reports on it.
+func Pattern(ctx context.Context, path, name, pattern string, instruments map[string]*instrument.Instrument, sampleRate int) (*PatternReport, error) {
+	tr, err := track.LoadTrack(path)
+	if err != nil {
+		return nil, err
+	}
+	samples, err := tr.RenderPattern(ctx, pattern, instruments, sampleRate)
+	if err != nil {
+		return nil, err
+	}
+	r := &PatternReport{
+		File:    name,
+		Type:    "pattern",
+		Pattern: pattern,
+		Ticks:   tr.Patterns[pattern].Len(),
+	}
+	r.Duration = float64(r.Ticks) * 60 / float64(tr.Tempo) / float64(tr.TicksPerBeat)
+	for _, s := range samples {
+		r.Peak = max(r.Peak, math.Abs(s))
+	}
+	for _, ch := range tr.Channels {
+		if instruments[ch.Instrument] == nil && !slices.Contains(r.MissingInstruments, ch.Instrument) {
+			r.MissingInstruments = append(r.MissingInstruments, ch.Instrument)
+		}
+	}
+	return r, nil
+}
+
+// WriteText implements Report.
+func (r *PatternReport) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "%s: pattern %s, %d tick(s), %.2fs\n", r.File, r.Pattern, r.Ticks, r.Duration)
+	if r.Peak == 0 {
+		fmt.Fprintf(w, "  silent\n")
+	} else {
+		fmt.Fprintf(w, "  peak %.2f\n", r.Peak)
+	}
+	if len(r.MissingInstruments) > 0 {
+		fmt.Fprintf(w, "  missing instruments: %s\n", strings.Join(r.MissingInstruments, ", "))
+	}
+}
+
+// formatDuration formats seconds as m:ss.
+func formatDuration(sec float64) string {
+	s := int(sec + 0.5)
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
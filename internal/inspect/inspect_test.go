@@ -0,0 +1,220 @@
+package inspect
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/vgalaktionov/runefact/internal/audio"
+	"github.com/vgalaktionov/runefact/internal/instrument"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFile_Sprite(t *testing.T) {
+	path := writeFile(t, "player.sprite", `palette = "default"
+grid = 2
+
+[sprite.dot]
+pixels = """
+r_
+_r
+"""
+
+[sprite.blink]
+framerate = 4
+events = { 1 = "close" }
+hitbox = [{ x = 0, y = 0, w = 2, h = 1, type = "hurt" }]
+[[sprite.blink.frame]]
+pixels = """
+rr
+rr
+"""
+[[sprite.blink.frame]]
+pixels = """
+__
+__
+"""
+`)
+	r, err := File(path, "player.sprite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sr, ok := r.(*SpriteReport)
+	if !ok {
+		t.Fatalf("report is %T, want *SpriteReport", r)
+	}
+	if sr.Palette != "default" || sr.DefaultGrid != "2x2" || len(sr.Sprites) != 2 {
+		t.Errorf("report = %+v", sr)
+	}
+
+	var text strings.Builder
+	r.WriteText(&text)
+	if !strings.Contains(text.String(), "2 frames at 4 fps, events: 1 close, 1 hitbox(es)") {
+		t.Errorf("text summary missing animation:\n%s", text.String())
+	}
+
+	// The JSON keys are what the MCP tool has always returned.
+	data, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{`"palette_extend"`, `"default_grid"`, `"framerate"`, `"events"`, `"hitboxes"`} {
+		if !strings.Contains(string(data), key) {
+			t.Errorf("JSON missing %s: %s", key, data)
+		}
+	}
+}
+
+func TestFile_Map(t *testing.T) {
+	path := writeFile(t, "level.map", `tile_size = 8
+[tileset]
+g = "tiles:grass"
+_ = ""
+
+[layer.ground]
+pixels = """
+gg_
+gxg
+"""
+
+[layer.things]
+[[layer.things.entity]]
+type = "spawn"
+x = 1
+y = 1
+`)
+	r, err := File(path, "level.map")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mr := r.(*MapReport)
+	if mr.TileSize != 8 || len(mr.Layers) != 2 || len(mr.Warnings) != 1 {
+		t.Errorf("report = %+v", mr)
+	}
+
+	var text strings.Builder
+	r.WriteText(&text)
+	for _, want := range []string{"tiles, 3x2", "entities, 1 placed", `warning: `} {
+		if !strings.Contains(text.String(), want) {
+			t.Errorf("text summary missing %q:\n%s", want, text.String())
+		}
+	}
+}
+
+func TestFile_Track(t *testing.T) {
+	path := writeFile(t, "theme.track", `tempo = 120
+ticks_per_beat = 4
+[[channel]]
+name = "m"
+instrument = "lead"
+[pattern.a]
+ticks = 8
+data = """
+m
+C4
+---
+---
+---
+G5
+---
+---
+---
+"""
+[song]
+sequence = ["a", "a"]
+`)
+	r, err := File(path, "theme.track")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := r.(*TrackReport)
+	// 16 ticks at 8 ticks per second.
+	if tr.Duration != 2 {
+		t.Errorf("duration = %v, want 2", tr.Duration)
+	}
+	var text strings.Builder
+	r.WriteText(&text)
+	if want := []ChannelNotes{{Channel: "m", Instrument: "lead", Low: "C4", High: "G5"}}; !slices.Equal(tr.Notes, want) {
+		t.Errorf("notes = %+v, want %+v", tr.Notes, want)
+	}
+	if !strings.Contains(text.String(), "120 bpm, 0:02") || !strings.Contains(text.String(), "sequence: a a") || !strings.Contains(text.String(), "m (lead): C4-G5") {
+		t.Errorf("text summary:\n%s", text.String())
+	}
+}
+
+func TestPattern(t *testing.T) {
+	path := writeFile(t, "theme.track", `tempo = 120
+ticks_per_beat = 4
+[[channel]]
+name = "m"
+instrument = "lead"
+volume = 1
+[[channel]]
+name = "b"
+instrument = "bass"
+[pattern.intro]
+ticks = 4
+pad = true
+data = """
+m | b
+... | ...
+"""
+[pattern.verse]
+data = """
+m | b
+A4 | C2
+--- | ---
+"""
+[song]
+sequence = ["intro", "verse"]
+`)
+	instruments := map[string]*instrument.Instrument{"lead": {
+		Name:       "lead",
+		Oscillator: instrument.OscillatorDef{Waveform: "square"},
+		Envelope:   audio.ADSR{Sustain: 1, Release: 0.01},
+	}}
+
+	r, err := Pattern(context.Background(), path, "theme.track", "verse", instruments, 8000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Ticks != 2 || r.Duration != 0.25 || r.Peak == 0 {
+		t.Errorf("verse = %+v, want 2 audible ticks over 0.25s", r)
+	}
+	if len(r.MissingInstruments) != 1 || r.MissingInstruments[0] != "bass" {
+		t.Errorf("missing instruments = %v, want [bass]", r.MissingInstruments)
+	}
+
+	r, err = Pattern(context.Background(), path, "theme.track", "intro", instruments, 8000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var text strings.Builder
+	r.WriteText(&text)
+	if r.Ticks != 4 || r.Peak != 0 || !strings.Contains(text.String(), "pattern intro, 4 tick(s), 0.50s\n  silent") {
+		t.Errorf("intro = %+v, text:\n%s", r, text.String())
+	}
+
+	if _, err := Pattern(context.Background(), path, "theme.track", "chorus", instruments, 8000); err == nil {
+		t.Error("expected an error for an unknown pattern")
+	}
+}
+
+func TestFile_UnsupportedExtension(t *testing.T) {
+	path := writeFile(t, "default.palette", `name = "default"`)
+	if _, err := File(path, "default.palette"); err == nil || !strings.Contains(err.Error(), "cannot inspect") {
+		t.Errorf("err = %v, want unsupported extension", err)
+	}
+}
@@ -1,6 +1,7 @@
 package instrument
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -8,6 +9,7 @@ import (
 	toml "github.com/pelletier/go-toml/v2"
 
 	"github.com/vgalaktionov/runefact/internal/audio"
+	"github.com/vgalaktionov/runefact/internal/tomlsrc"
 )
 
 // Instrument represents a parsed .inst file.
@@ -17,12 +19,52 @@ type Instrument struct {
 	Envelope   audio.ADSR
 	Filter     *FilterDef
 	Effects    EffectsDef
+	// Range is the notes the instrument is meant to play; nil if it
+	// doesn't say.
+	Range *NoteRange
+	// Sample, if set, plays a recording instead of the oscillator.
+	Sample *SampleDef
+}
+
+// SampleDef is a recording an instrument plays, pitched to each note by
+// resampling.
+type SampleDef struct {
+	// File is the WAV file, relative to the assets directory.
+	File string
+	// Root is the MIDI note the recording plays at its own speed.
+	Root int
+	// LoopStart and LoopEnd are the frames the recording repeats between
+	// once it reaches LoopEnd; no loop if LoopEnd is 0.
+	LoopStart, LoopEnd int
+	// Data is the recording, read by LoadInstrument; nil after
+	// ParseInstrument alone.
+	Data *audio.Sample
+}
+
+// NoteRange is a span of notes, as MIDI numbers.
+type NoteRange struct {
+	Low, High int
+}
+
+// Contains reports whether the MIDI note is within r.
+func (r NoteRange) Contains(note int) bool {
+	return note >= r.Low && note <= r.High
+}
+
+// String returns r as note names, like C1-C4.
+func (r NoteRange) String() string {
+	return audio.NoteName(r.Low) + "-" + audio.NoteName(r.High)
 }
 
 // OscillatorDef defines oscillator parameters.
 type OscillatorDef struct {
-	Waveform  string  `toml:"waveform"`
-	DutyCycle float64 `toml:"duty_cycle"`
+	Waveform  string
+	DutyCycle float64
+
+	// Tune, Decay and Snap shape a drum waveform; see audio.Drum.
+	Tune  float64
+	Decay float64
+	Snap  float64
 }
 
 // FilterDef defines optional filter parameters.
@@ -43,21 +85,42 @@ type EffectsDef struct {
 // rawInstrument is the TOML-level structure.
 type rawInstrument struct {
 	Name       string        `toml:"name"`
-	Oscillator OscillatorDef `toml:"oscillator"`
+	Oscillator rawOscillator `toml:"oscillator"`
 	Envelope   rawEnvelope   `toml:"envelope"`
 	Filter     *FilterDef    `toml:"filter"`
 	Effects    EffectsDef    `toml:"effects"`
+	Range      *rawRange     `toml:"range"`
+	Sample     string        `toml:"sample"`
+	RootNote   string        `toml:"root_note"`
+	LoopStart  int           `toml:"loop_start"`
+	LoopEnd    int           `toml:"loop_end"`
+}
+
+type rawOscillator struct {
+	Waveform  string   `toml:"waveform"`
+	DutyCycle float64  `toml:"duty_cycle"`
+	Tune      *float64 `toml:"tune"`
+	Decay     *float64 `toml:"decay"`
+	Snap      *float64 `toml:"snap"`
+}
+
+type rawRange struct {
+	Low  string `toml:"low"`
+	High string `toml:"high"`
 }
 
 type rawEnvelope struct {
-	Attack  float64 `toml:"attack"`
-	Decay   float64 `toml:"decay"`
-	Sustain float64 `toml:"sustain"`
-	Release float64 `toml:"release"`
+	Attack       float64 `toml:"attack"`
+	Decay        float64 `toml:"decay"`
+	Sustain      float64 `toml:"sustain"`
+	Release      float64 `toml:"release"`
+	AttackCurve  string  `toml:"attack_curve"`
+	ReleaseCurve string  `toml:"release_curve"`
 }
 
 // ParseInstrument parses .inst file content.
 func ParseInstrument(data []byte, filename string) (*Instrument, error) {
+	data = tomlsrc.Normalize(data)
 	var raw rawInstrument
 	if err := toml.Unmarshal(data, &raw); err != nil {
 		return nil, fmt.Errorf("%s: %w", filename, err)
@@ -66,30 +129,164 @@ func ParseInstrument(data []byte, filename string) (*Instrument, error) {
 	if raw.Oscillator.Waveform == "" {
 		raw.Oscillator.Waveform = "sine"
 	}
+	osc, err := parseOscillator(raw.Oscillator)
+	if err != nil {
+		return nil, fmt.Errorf("%s: oscillator: %w", filename, err)
+	}
 
 	inst := &Instrument{
 		Name:       raw.Name,
-		Oscillator: raw.Oscillator,
+		Oscillator: osc,
 		Envelope: audio.ADSR{
 			Attack:  raw.Envelope.Attack,
 			Decay:   raw.Envelope.Decay,
 			Sustain: raw.Envelope.Sustain,
 			Release: raw.Envelope.Release,
+
+			AttackCurve:  audio.CurveType(raw.Envelope.AttackCurve),
+			ReleaseCurve: audio.CurveType(raw.Envelope.ReleaseCurve),
 		},
 		Filter:  raw.Filter,
 		Effects: raw.Effects,
 	}
+	if err := inst.Envelope.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: envelope: %w", filename, err)
+	}
+	if raw.Range != nil {
+		r, err := parseRange(*raw.Range)
+		if err != nil {
+			return nil, fmt.Errorf("%s: range: %w", filename, err)
+		}
+		inst.Range = &r
+	}
+	if raw.Sample != "" {
+		sd, err := parseSample(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		}
+		inst.Sample = sd
+	} else if raw.RootNote != "" || raw.LoopStart != 0 || raw.LoopEnd != 0 {
+		return nil, fmt.Errorf("%s: root_note, loop_start and loop_end need a sample", filename)
+	}
 
 	return inst, nil
 }
 
+func parseSample(raw rawInstrument) (*SampleDef, error) {
+	if !filepath.IsLocal(raw.Sample) {
+		return nil, fmt.Errorf("sample %q must be a path inside the project, like assets/samples/kick.wav", raw.Sample)
+	}
+	sd := &SampleDef{File: raw.Sample, Root: 60, LoopStart: raw.LoopStart, LoopEnd: raw.LoopEnd}
+	if raw.RootNote != "" {
+		root, err := audio.ParseNote(raw.RootNote)
+		if err != nil {
+			return nil, fmt.Errorf("root_note: %w", err)
+		}
+		sd.Root = root
+	}
+	if sd.LoopStart < 0 || sd.LoopEnd < 0 || (sd.LoopEnd > 0 && sd.LoopStart >= sd.LoopEnd) || (sd.LoopEnd == 0 && sd.LoopStart > 0) {
+		return nil, fmt.Errorf("loop_start = %d and loop_end = %d must be frames with loop_start before loop_end", sd.LoopStart, sd.LoopEnd)
+	}
+	return sd, nil
+}
+
+// SamplePath returns the path of file, a sample named by the instrument at
+// instPath: file is relative to the project root, the directory holding
+// the assets directory the instrument lives in. For an instrument of an
+// included project that is the included project's root.
+func SamplePath(instPath, file string) string {
+	assets := filepath.Dir(filepath.Dir(instPath))
+	return filepath.Join(filepath.Dir(assets), filepath.FromSlash(file))
+}
+
+// parseOscillator checks the drum parameters, which only drum waveforms
+// take, and fills in their defaults.
+func parseOscillator(raw rawOscillator) (OscillatorDef, error) {
+	osc := OscillatorDef{Waveform: raw.Waveform, DutyCycle: raw.DutyCycle}
+	if !audio.IsDrum(raw.Waveform) {
+		if raw.Tune != nil || raw.Decay != nil || raw.Snap != nil {
+			return osc, fmt.Errorf("tune, decay and snap only apply to waveform kick, snare or hat, not %s", raw.Waveform)
+		}
+		return osc, nil
+	}
+	osc.Decay = audio.DefaultDrumDecay(raw.Waveform)
+	osc.Snap = 0.5
+	if raw.Tune != nil {
+		osc.Tune = *raw.Tune
+	}
+	if raw.Decay != nil {
+		if *raw.Decay <= 0 {
+			return osc, fmt.Errorf("decay must be positive, got %g", *raw.Decay)
+		}
+		osc.Decay = *raw.Decay
+	}
+	if raw.Snap != nil {
+		if *raw.Snap < 0 || *raw.Snap > 1 {
+			return osc, fmt.Errorf("snap must be between 0 and 1, got %g", *raw.Snap)
+		}
+		osc.Snap = *raw.Snap
+	}
+	return osc, nil
+}
+
+func parseRange(raw rawRange) (NoteRange, error) {
+	if raw.Low == "" || raw.High == "" {
+		return NoteRange{}, errors.New("needs both low and high")
+	}
+	low, err := audio.ParseNote(raw.Low)
+	if err != nil {
+		return NoteRange{}, fmt.Errorf("low: %w", err)
+	}
+	high, err := audio.ParseNote(raw.High)
+	if err != nil {
+		return NoteRange{}, fmt.Errorf("high: %w", err)
+	}
+	if low > high {
+		return NoteRange{}, fmt.Errorf("low %s is above high %s", raw.Low, raw.High)
+	}
+	return NoteRange{Low: low, High: high}, nil
+}
+
 // LoadInstrument reads and parses an .inst file from disk.
 func LoadInstrument(path string) (*Instrument, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("loading instrument: %w", err)
 	}
-	return ParseInstrument(data, filepath.Base(path))
+	inst, err := ParseInstrument(data, filepath.Base(path))
+	if err != nil || inst.Sample == nil {
+		return inst, err
+	}
+	sd := inst.Sample
+	if sd.Data, err = audio.LoadSample(SamplePath(path, sd.File)); err != nil {
+		return nil, fmt.Errorf("%s: sample: %w", filepath.Base(path), err)
+	}
+	if sd.LoopEnd > len(sd.Data.Frames) {
+		return nil, fmt.Errorf("%s: loop_end = %d is past the end of %s, %d frames long", filepath.Base(path), sd.LoopEnd, sd.File, len(sd.Data.Frames))
+	}
+	return inst, nil
+}
+
+// LoadDir loads every .inst file in dir, keyed by instrument name. Files
+// that don't parse are skipped, since validate reports them; a missing dir
+// gives an empty map.
+func LoadDir(dir string) map[string]*Instrument {
+	instruments := map[string]*Instrument{}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return instruments
+	}
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".inst" {
+			continue
+		}
+		inst, err := LoadInstrument(filepath.Join(dir, e.Name()))
+		if err != nil {
+			continue
+		}
+		instruments[inst.Name] = inst
+	}
+	return instruments
 }
 
 // ResolveInstrument searches for an instrument by name in the given directories.
@@ -111,6 +308,24 @@ func (inst *Instrument) CreateVoice(frequency float64, sampleRate int) *audio.Vo
 		Frequency: frequency,
 	}
 
+	if audio.IsDrum(inst.Oscillator.Waveform) {
+		v.Drum = &audio.Drum{
+			Kind:  inst.Oscillator.Waveform,
+			Tune:  inst.Oscillator.Tune,
+			Decay: inst.Oscillator.Decay,
+			Snap:  inst.Oscillator.Snap,
+		}
+	}
+
+	if sd := inst.Sample; sd != nil && sd.Data != nil {
+		v.Sample = &audio.SamplePlayer{
+			Sample:    sd.Data,
+			Root:      audio.MIDIToFreq(sd.Root),
+			LoopStart: sd.LoopStart,
+			LoopEnd:   sd.LoopEnd,
+		}
+	}
+
 	v.Vibrato.Depth = inst.Effects.VibratoDepth
 	v.Vibrato.Rate = inst.Effects.VibratoRate
 
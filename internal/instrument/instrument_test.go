@@ -1,8 +1,10 @@
 package instrument
 
 import (
+	"math"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/vgalaktionov/runefact/internal/audio"
@@ -95,6 +97,133 @@ sustain = 1
 	}
 }
 
+func TestParseInstrument_EnvelopeCurves(t *testing.T) {
+	inst, err := ParseInstrument([]byte(`
+[envelope]
+sustain = 0.5
+release = 0.3
+attack_curve = "logarithmic"
+release_curve = "exponential"
+`), "pluck.inst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inst.Envelope.AttackCurve != audio.CurveLogarithmic || inst.Envelope.ReleaseCurve != audio.CurveExponential {
+		t.Errorf("curves = %q, %q, want logarithmic, exponential", inst.Envelope.AttackCurve, inst.Envelope.ReleaseCurve)
+	}
+
+	_, err = ParseInstrument([]byte("[envelope]\nattack_curve = \"exp\"\n"), "pluck.inst")
+	if err == nil || !strings.Contains(err.Error(), `pluck.inst: envelope: attack_curve "exp" must be`) {
+		t.Errorf("err = %v, want an attack_curve error", err)
+	}
+}
+
+func TestParseInstrument_Range(t *testing.T) {
+	inst, err := ParseInstrument([]byte(`range = { low = "C1", high = "C4" }`), "bass.inst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inst.Range == nil || *inst.Range != (NoteRange{Low: 24, High: 60}) || inst.Range.String() != "C1-C4" {
+		t.Errorf("range = %+v, want C1-C4", inst.Range)
+	}
+	if !inst.Range.Contains(60) || inst.Range.Contains(61) {
+		t.Error("C1-C4 should contain C4 and not C#4")
+	}
+
+	for src, want := range map[string]string{
+		`range = { low = "C4", high = "C1" }`: "bass.inst: range: low C4 is above high C1",
+		`range = { low = "C1" }`:              "bass.inst: range: needs both low and high",
+		`range = { low = "H1", high = "C4" }`: `bass.inst: range: low: invalid note "H1"`,
+	} {
+		if _, err := ParseInstrument([]byte(src), "bass.inst"); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: err = %v, want %q", src, err, want)
+		}
+	}
+}
+
+func TestParseInstrument_Drum(t *testing.T) {
+	inst, err := ParseInstrument([]byte(`name = "kick"
+[oscillator]
+waveform = "kick"
+tune = -3
+snap = 0.8
+`), "kick.inst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := OscillatorDef{Waveform: "kick", Tune: -3, Decay: 0.35, Snap: 0.8}
+	if inst.Oscillator != want {
+		t.Errorf("oscillator = %+v, want %+v", inst.Oscillator, want)
+	}
+	v := inst.CreateVoice(261.63, 44100)
+	if v.Drum == nil || *v.Drum != (audio.Drum{Kind: "kick", Tune: -3, Decay: 0.35, Snap: 0.8}) {
+		t.Errorf("voice drum = %+v", v.Drum)
+	}
+	if v := (&Instrument{Oscillator: OscillatorDef{Waveform: "sine"}}).CreateVoice(440, 44100); v.Drum != nil {
+		t.Error("a sine voice has no drum")
+	}
+
+	for src, want := range map[string]string{
+		"[oscillator]\nwaveform = \"square\"\ndecay = 0.2": "hat.inst: oscillator: tune, decay and snap only apply to waveform kick, snare or hat, not square",
+		"[oscillator]\nwaveform = \"hat\"\ndecay = 0":      "hat.inst: oscillator: decay must be positive, got 0",
+		"[oscillator]\nwaveform = \"hat\"\nsnap = 2":       "hat.inst: oscillator: snap must be between 0 and 1, got 2",
+	} {
+		if _, err := ParseInstrument([]byte(src), "hat.inst"); err == nil || err.Error() != want {
+			t.Errorf("%q: err = %v, want %q", src, err, want)
+		}
+	}
+}
+
+func TestLoadInstrument_Sample(t *testing.T) {
+	root := t.TempDir()
+	assets := filepath.Join(root, "assets")
+	os.MkdirAll(filepath.Join(assets, "instruments"), 0755)
+	os.MkdirAll(filepath.Join(assets, "samples"), 0755)
+	frames := make([]float64, 1000)
+	for i := range frames {
+		frames[i] = 0.5
+	}
+	if err := audio.WriteWAV(filepath.Join(assets, "samples/pad.wav"), frames, 22050, 16); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(assets, "instruments/pad.inst")
+	os.WriteFile(path, []byte(`name = "pad"
+sample = "assets/samples/pad.wav"
+root_note = "A4"
+loop_start = 100
+loop_end = 900
+[envelope]
+sustain = 1
+`), 0644)
+	inst, err := LoadInstrument(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sd := inst.Sample
+	if sd == nil || sd.File != "assets/samples/pad.wav" || sd.Root != 69 || sd.LoopStart != 100 || sd.LoopEnd != 900 || sd.Data == nil || sd.Data.Rate != 22050 {
+		t.Fatalf("sample = %+v", sd)
+	}
+	v := inst.CreateVoice(440, 44100)
+	if v.Sample == nil || v.Sample.Root != 440 || math.Abs(v.Sample.At(0.001, 440)-0.5) > 0.01 {
+		t.Errorf("voice sample = %+v", v.Sample)
+	}
+
+	os.WriteFile(filepath.Join(assets, "samples/stereo.wav"), []byte("RIFF"), 0644)
+	for src, want := range map[string]string{
+		`sample = "assets/samples/none.wav"`:                   "pad.inst: sample: open",
+		`sample = "assets/samples/stereo.wav"`:                 "pad.inst: sample: " + filepath.Join(assets, "samples/stereo.wav") + ": not a WAV file",
+		`sample = "../pad.wav"`:                                `pad.inst: sample "../pad.wav" must be a path inside the project`,
+		"sample = \"assets/samples/pad.wav\"\nloop_end = 2000": "pad.inst: loop_end = 2000 is past the end of assets/samples/pad.wav, 1000 frames long",
+		"sample = \"assets/samples/pad.wav\"\nloop_start = 10": "pad.inst: loop_start = 10 and loop_end = 0 must be frames with loop_start before loop_end",
+		`root_note = "C4"`:                                     "pad.inst: root_note, loop_start and loop_end need a sample",
+	} {
+		os.WriteFile(path, []byte(src+"\n"), 0644)
+		if _, err := LoadInstrument(path); err == nil || !strings.HasPrefix(err.Error(), want) {
+			t.Errorf("%s: err = %v, want %q", src, err, want)
+		}
+	}
+}
+
 func TestCreateVoice(t *testing.T) {
 	inst := &Instrument{
 		Oscillator: OscillatorDef{Waveform: "square", DutyCycle: 0.25},
@@ -156,3 +285,24 @@ func TestResolveInstrument_NotFound(t *testing.T) {
 		t.Fatal("expected error for missing instrument")
 	}
 }
+
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"lead.inst":   "name = \"lead\"\n[oscillator]\nwaveform = \"square\"\n",
+		"broken.inst": "name = ",
+		"notes.txt":   "name = \"notes\"\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := LoadDir(dir)
+	if len(got) != 1 || got["lead"] == nil {
+		t.Errorf("LoadDir = %v, want just lead", got)
+	}
+	if got := LoadDir(filepath.Join(dir, "missing")); len(got) != 0 {
+		t.Errorf("LoadDir of a missing dir = %v, want empty", got)
+	}
+}
@@ -0,0 +1,152 @@
+// Package logging sets up the slog logger shared by runefact's commands.
+//
+// The default plain format looks like runefact's normal output: info
+// messages as they are, other levels prefixed with "debug:", "warning:" or
+// "error:", and attributes after the message as key=value. The text and
+// json formats are slog's own, with timestamps, for debugging long-running
+// watch, preview and mcp sessions.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Levels are the values of --log-level, most verbose first.
+var Levels = []string{"debug", "info", "warn", "error"}
+
+// Formats are the values of --log-format.
+var Formats = []string{"plain", "text", "json"}
+
+// ParseLevel parses a --log-level value.
+func ParseLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q (want %s)", s, strings.Join(Levels, ", "))
+}
+
+// New returns a logger writing to w in the given format, dropping records
+// below level.
+func New(w io.Writer, level slog.Level, format string) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: level}
+	switch format {
+	case "plain":
+		return slog.New(&plainHandler{w: w, level: level, mu: &sync.Mutex{}}), nil
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q (want %s)", format, strings.Join(Formats, ", "))
+}
+
+// Setup makes a logger from New the default, so slog's top-level functions
+// and the log package write through it.
+func Setup(w io.Writer, level slog.Level, format string) error {
+	l, err := New(w, level, format)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(l)
+	return nil
+}
+
+// plainHandler writes one line per record without a timestamp.
+type plainHandler struct {
+	w      io.Writer
+	level  slog.Level
+	mu     *sync.Mutex
+	attrs  []slog.Attr
+	groups []string
+}
+
+func (h *plainHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *plainHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	switch {
+	case r.Level >= slog.LevelError:
+		b.WriteString("error: ")
+	case r.Level >= slog.LevelWarn:
+		b.WriteString("warning: ")
+	case r.Level < slog.LevelInfo:
+		b.WriteString("debug: ")
+	}
+	b.WriteString(r.Message)
+	for _, a := range h.attrs {
+		writeAttr(&b, a)
+	}
+	prefix := strings.Join(h.groups, ".")
+	r.Attrs(func(a slog.Attr) bool {
+		if prefix != "" {
+			a.Key = prefix + "." + a.Key
+		}
+		writeAttr(&b, a)
+		return true
+	})
+	b.WriteByte('\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, b.String())
+	return err
+}
+
+func (h *plainHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	prefix := strings.Join(h.groups, ".")
+	h2.attrs = slices.Clone(h.attrs)
+	for _, a := range attrs {
+		if prefix != "" {
+			a.Key = prefix + "." + a.Key
+		}
+		h2.attrs = append(h2.attrs, a)
+	}
+	return &h2
+}
+
+func (h *plainHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.groups = append(slices.Clone(h.groups), name)
+	return &h2
+}
+
+// writeAttr appends " key=value", quoting values with spaces.
+func writeAttr(b *strings.Builder, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		for _, ga := range a.Value.Group() {
+			if a.Key != "" {
+				ga.Key = a.Key + "." + ga.Key
+			}
+			writeAttr(b, ga)
+		}
+		return
+	}
+	v := a.Value.String()
+	if v == "" || strings.ContainsAny(v, " \t\n\"=") {
+		v = fmt.Sprintf("%q", v)
+	}
+	fmt.Fprintf(b, " %s=%s", a.Key, v)
+}
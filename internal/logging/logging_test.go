@@ -0,0 +1,81 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		in   string
+		want slog.Level
+	}{
+		{"debug", slog.LevelDebug},
+		{"info", slog.LevelInfo},
+		{"WARN", slog.LevelWarn},
+		{"warning", slog.LevelWarn},
+		{"error", slog.LevelError},
+	}
+	for _, tt := range tests {
+		got, err := ParseLevel(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseLevel(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+	if _, err := ParseLevel("loud"); err == nil || !strings.Contains(err.Error(), "debug, info, warn, error") {
+		t.Errorf("ParseLevel(loud) error = %v, want one listing the levels", err)
+	}
+}
+
+func TestNew_Plain(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := New(&buf, slog.LevelInfo, "plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Debug("hidden")
+	l.Info("Built 3 artifact(s)")
+	l.Warn("sheet too wide", "file", "tiles.sprite")
+	l.With("file", "a b.map").Error("build failed", "err", errors.New("bad tile"))
+	l.WithGroup("watch").Info("rebuilding", "files", 2)
+
+	want := `Built 3 artifact(s)
+warning: sheet too wide file=tiles.sprite
+error: build failed file="a b.map" err="bad tile"
+rebuilding watch.files=2
+`
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestNew_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := New(&buf, slog.LevelWarn, "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Info("hidden")
+	l.Warn("sheet too wide", "file", "tiles.sprite")
+
+	var rec map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatalf("not one JSON record: %v\n%s", err, buf.String())
+	}
+	if rec["level"] != "WARN" || rec["msg"] != "sheet too wide" || rec["file"] != "tiles.sprite" {
+		t.Errorf("record = %v", rec)
+	}
+	if _, ok := rec["time"]; !ok {
+		t.Error("record has no timestamp")
+	}
+}
+
+func TestNew_UnknownFormat(t *testing.T) {
+	if _, err := New(&bytes.Buffer{}, slog.LevelInfo, "xml"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,189 @@
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/vgalaktionov/runefact/internal/atomicfile"
+	"github.com/vgalaktionov/runefact/internal/sprite"
+)
+
+// JSONVersion is the schema version written to manifest.json. It changes
+// only when a field is removed or changes meaning.
+const JSONVersion = 1
+
+// JSONManifest is the manifest.json layout, for engines that can't use the
+// generated Go code. Field names are snake_case and stable; paths are
+// relative to the output directory and always use forward slashes.
+type JSONManifest struct {
+	Version int          `json:"version"`
+	Sheets  []JSONSheet  `json:"sheets"`
+	Sprites []JSONSprite `json:"sprites"`
+	Maps    []JSONMap    `json:"maps"`
+	Audio   []JSONAudio  `json:"audio"`
+
+	// TransparentColor is set when sheets use a color key instead of
+	// alpha, as "#rrggbb".
+	TransparentColor string `json:"transparent_color,omitempty"`
+
+	// Pack is set when the build wrote all assets into one .rfpack file,
+	// which then holds each path above as an entry.
+	Pack string `json:"pack,omitempty"`
+}
+
+// JSONSheet is a sprite sheet and its upscaled variants.
+type JSONSheet struct {
+	Name   string            `json:"name"`
+	Path   string            `json:"path"`
+	Scales []JSONScaledSheet `json:"scales,omitempty"`
+}
+
+// JSONScaledSheet is an upscaled sprite sheet.
+type JSONScaledSheet struct {
+	Path  string `json:"path"`
+	Scale int    `json:"scale"`
+}
+
+// JSONSprite is a sprite's position in its sheet. Frames are laid out left
+// to right starting at x, y.
+type JSONSprite struct {
+	Key        string   `json:"key"`
+	Sheet      string   `json:"sheet"`
+	X          int      `json:"x"`
+	Y          int      `json:"y"`
+	W          int      `json:"w"`
+	H          int      `json:"h"`
+	Frames     int      `json:"frames"`
+	FPS        int      `json:"fps"`
+	PivotX     int      `json:"pivot_x"`
+	PivotY     int      `json:"pivot_y"`
+	Playback   string   `json:"playback"`
+	FramePaths []string `json:"frame_paths,omitempty"`
+
+	// Events is keyed by frame index, written as a string as JSON requires.
+	Events map[int][]string `json:"events,omitempty"`
+
+	// Hitboxes have a frame of -1 when they apply to every frame.
+	Hitboxes []sprite.Hitbox `json:"hitboxes,omitempty"`
+
+	Meta map[string]any `json:"meta,omitempty"`
+}
+
+// JSONMap is a built map and the properties of its tiles.
+type JSONMap struct {
+	Name  string     `json:"name"`
+	Path  string     `json:"path"`
+	Tiles []JSONTile `json:"tiles,omitempty"`
+}
+
+// JSONTile is the properties of one tile index in a map's layer data.
+type JSONTile struct {
+	Index int      `json:"index"`
+	Solid bool     `json:"solid"`
+	Tags  []string `json:"tags,omitempty"`
+}
+
+// JSONAudio is a rendered sound effect or track.
+type JSONAudio struct {
+	Name            string  `json:"name"`
+	Kind            string  `json:"kind"` // "sfx" or "track"
+	Path            string  `json:"path"`
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+// JSON converts the manifest data to the manifest.json layout. Sprites are
+// sorted by key so the output is stable between builds.
+func (md *ManifestData) JSON() *JSONManifest {
+	jm := &JSONManifest{
+		Version:          JSONVersion,
+		Sheets:           []JSONSheet{},
+		Sprites:          []JSONSprite{},
+		Maps:             []JSONMap{},
+		Audio:            []JSONAudio{},
+		TransparentColor: md.TransparentColor,
+		Pack:             md.Pack,
+	}
+
+	sheetNames := map[string]string{}
+	for _, s := range md.SpriteSheets {
+		sheetNames[s.Const] = s.Name
+		js := JSONSheet{Name: s.Name, Path: SlashPath(s.Path)}
+		for _, sc := range md.SheetScales {
+			if sc.Sheet != s.Const {
+				continue
+			}
+			for _, v := range sc.Variants {
+				js.Scales = append(js.Scales, JSONScaledSheet{Path: SlashPath(v.Path), Scale: v.Scale})
+			}
+		}
+		jm.Sheets = append(jm.Sheets, js)
+	}
+
+	framePaths := map[string][]string{}
+	for _, f := range md.SpriteFrames {
+		for _, p := range f.Paths {
+			framePaths[f.Key] = append(framePaths[f.Key], SlashPath(p))
+		}
+	}
+	for _, s := range md.Sprites {
+		jm.Sprites = append(jm.Sprites, JSONSprite{
+			Key:        s.Key,
+			Sheet:      sheetNames[s.Sheet],
+			X:          s.X,
+			Y:          s.Y,
+			W:          s.W,
+			H:          s.H,
+			Frames:     s.Frames,
+			FPS:        s.FPS,
+			PivotX:     s.PivotX,
+			PivotY:     s.PivotY,
+			Playback:   s.PlaybackMode(),
+			FramePaths: framePaths[s.Key],
+			Events:     s.Events,
+			Hitboxes:   s.Hitboxes,
+			Meta:       s.Meta,
+		})
+	}
+	sort.Slice(jm.Sprites, func(i, j int) bool { return jm.Sprites[i].Key < jm.Sprites[j].Key })
+
+	for _, m := range md.Maps {
+		jmap := JSONMap{Name: m.Name, Path: SlashPath(m.Path)}
+		for _, mt := range md.MapTiles {
+			if mt.Map != m.Const {
+				continue
+			}
+			for _, t := range mt.Tiles {
+				jmap.Tiles = append(jmap.Tiles, JSONTile{Index: t.Index, Solid: t.Solid, Tags: t.Tags})
+			}
+		}
+		jm.Maps = append(jm.Maps, jmap)
+	}
+	for _, a := range md.Audio {
+		kind := strings.TrimPrefix(filepath.Ext(a.Source), ".")
+		if a.Pattern != "" {
+			kind = "sfx"
+		}
+		jm.Audio = append(jm.Audio, JSONAudio{
+			Name:            a.Name,
+			Kind:            kind,
+			Path:            SlashPath(a.Path),
+			DurationSeconds: a.DurationSeconds,
+		})
+	}
+	return jm
+}
+
+// GenerateJSON writes manifest.json to the given path.
+func GenerateJSON(data *ManifestData, outputPath string) error {
+	b, err := json.MarshalIndent(data.JSON(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding manifest json: %w", err)
+	}
+	if err := atomicfile.WriteFile(outputPath, append(b, '\n'), 0644); err != nil {
+		return fmt.Errorf("writing manifest json: %w", err)
+	}
+	return nil
+}
@@ -1,13 +1,16 @@
 package manifest
 
 import (
+	"bytes"
 	"fmt"
-	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"text/template"
 	"unicode"
 
+	"github.com/vgalaktionov/runefact/internal/atomicfile"
 	"github.com/vgalaktionov/runefact/internal/sprite"
 )
 
@@ -15,31 +18,97 @@ import (
 type ManifestData struct {
 	Package      string
 	SpriteSheets []SheetEntry
+	SheetScales  []SheetScalesEntry
 	Sprites      []SpriteEntry
+	SpriteFrames []FramesEntry
 	Maps         []AssetEntry
+	MapTiles     []MapTilesEntry
 	Audio        []AssetEntry
+
+	// TransparentColor is the project's color key as "#rrggbb", or empty
+	// if sheets keep their alpha channel.
+	TransparentColor string
+
+	// Pack is the name of the .rfpack file the assets are written into,
+	// or empty if they are separate files. A packed manifest includes the
+	// code to read the pack.
+	Pack string
 }
 
 // SheetEntry is a sprite sheet constant.
 type SheetEntry struct {
 	Const string
+	Name  string // sprite file name without extension
+	Path  string
+}
+
+// SheetScalesEntry lists the upscaled variants of one sprite sheet.
+type SheetScalesEntry struct {
+	Sheet    string // constant name referencing the base sheet
+	Variants []ScaledSheetEntry
+}
+
+// ScaledSheetEntry is an upscaled sprite sheet and its scale factor.
+type ScaledSheetEntry struct {
 	Path  string
+	Scale int
 }
 
 // SpriteEntry is a sprite metadata entry.
 type SpriteEntry struct {
-	Key    string // "file:sprite"
-	Sheet  string // constant name referencing the sheet
-	X, Y   int
-	W, H   int
-	Frames int
-	FPS    int
+	Key      string // "file:sprite"
+	Sheet    string // constant name referencing the sheet
+	X, Y     int
+	W, H     int
+	Frames   int
+	FPS      int
+	PivotX   int
+	PivotY   int
+	Playback string         // "loop", "once" or "pingpong"; empty means loop
+	Meta     map[string]any // the sprite's meta table, if any
+	Events   map[int][]string
+	Hitboxes []sprite.Hitbox
+}
+
+// FramesEntry lists the individual frame PNGs exported for a sprite.
+type FramesEntry struct {
+	Key   string // "file:sprite"
+	Paths []string
 }
 
 // AssetEntry is a map or audio constant.
 type AssetEntry struct {
-	Const string
-	Path  string
+	Const  string
+	Name   string // source file name without extension
+	Source string // source file name
+	Path   string
+
+	// Pattern is the pattern of a .track file a sound was rendered from,
+	// for a sound listed in the track's export_patterns.
+	Pattern string
+
+	// DurationSeconds is the length of a sound; zero for maps.
+	DurationSeconds float64
+}
+
+// MapTilesEntry lists the tile properties of one map.
+type MapTilesEntry struct {
+	Map   string // constant name referencing the map
+	Tiles []TileEntry
+}
+
+// TileEntry is the properties of one tile index in a map's layer data.
+type TileEntry struct {
+	Index int
+	Solid bool
+	Tags  []string
+}
+
+// SlashPath returns p with forward slashes, as games load assets with on
+// every platform. Backslashes count as separators even off Windows, so a
+// manifest is the same whichever OS built it.
+func SlashPath(p string) string {
+	return strings.ReplaceAll(p, `\`, "/")
 }
 
 // AddSpriteSheet adds a sprite sheet and its sprites to the manifest.
@@ -47,40 +116,158 @@ func (md *ManifestData) AddSpriteSheet(fileName string, relPath string, meta spr
 	constName := "SpriteSheet" + ToPascalCase(strings.TrimSuffix(fileName, ".sprite"))
 	md.SpriteSheets = append(md.SpriteSheets, SheetEntry{
 		Const: constName,
-		Path:  relPath,
+		Name:  strings.TrimSuffix(fileName, ".sprite"),
+		Path:  SlashPath(relPath),
 	})
 
 	baseName := strings.TrimSuffix(fileName, ".sprite")
 	for name, info := range meta.Sprites {
 		md.Sprites = append(md.Sprites, SpriteEntry{
-			Key:    baseName + ":" + name,
-			Sheet:  constName,
-			X:      info.X,
-			Y:      info.Y,
-			W:      info.W,
-			H:      info.H,
-			Frames: info.Frames,
-			FPS:    info.FPS,
+			Key:      baseName + ":" + name,
+			Sheet:    constName,
+			X:        info.X,
+			Y:        info.Y,
+			W:        info.W,
+			H:        info.H,
+			Frames:   info.Frames,
+			FPS:      info.FPS,
+			PivotX:   info.PivotX,
+			PivotY:   info.PivotY,
+			Playback: info.Playback,
+			Meta:     info.Meta,
+			Events:   info.Events,
+			Hitboxes: info.Hitboxes,
 		})
 	}
 }
 
+// HasSpriteMeta reports whether any sprite has a meta table.
+func (md *ManifestData) HasSpriteMeta() bool {
+	for _, s := range md.Sprites {
+		if len(s.Meta) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// PlaybackMode returns the sprite's playback mode, "loop" if unset.
+func (s SpriteEntry) PlaybackMode() string {
+	if s.Playback == "" {
+		return sprite.PlaybackLoop
+	}
+	return s.Playback
+}
+
+// HasSpriteHitboxes reports whether any sprite has hitboxes.
+func (md *ManifestData) HasSpriteHitboxes() bool {
+	for _, s := range md.Sprites {
+		if len(s.Hitboxes) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// HasSpriteEvents reports whether any sprite has frame events.
+func (md *ManifestData) HasSpriteEvents() bool {
+	for _, s := range md.Sprites {
+		if len(s.Events) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// AddSheetScale records an upscaled variant of a sprite sheet.
+func (md *ManifestData) AddSheetScale(fileName string, relPath string, scale int) {
+	constName := "SpriteSheet" + ToPascalCase(strings.TrimSuffix(fileName, ".sprite"))
+	v := ScaledSheetEntry{Path: SlashPath(relPath), Scale: scale}
+	for i := range md.SheetScales {
+		if md.SheetScales[i].Sheet == constName {
+			md.SheetScales[i].Variants = append(md.SheetScales[i].Variants, v)
+			return
+		}
+	}
+	md.SheetScales = append(md.SheetScales, SheetScalesEntry{
+		Sheet:    constName,
+		Variants: []ScaledSheetEntry{v},
+	})
+}
+
+// AddSpriteFrames records the exported frame PNGs of a sprite.
+func (md *ManifestData) AddSpriteFrames(fileName, spriteName string, relPaths []string) {
+	paths := make([]string, len(relPaths))
+	for i, p := range relPaths {
+		paths[i] = SlashPath(p)
+	}
+	md.SpriteFrames = append(md.SpriteFrames, FramesEntry{
+		Key:   strings.TrimSuffix(fileName, ".sprite") + ":" + spriteName,
+		Paths: paths,
+	})
+}
+
 // AddMap adds a map asset to the manifest.
 func (md *ManifestData) AddMap(fileName string, relPath string) {
 	constName := "Map" + ToPascalCase(strings.TrimSuffix(fileName, ".map"))
 	md.Maps = append(md.Maps, AssetEntry{
-		Const: constName,
-		Path:  relPath,
+		Const:  constName,
+		Name:   strings.TrimSuffix(fileName, ".map"),
+		Source: fileName,
+		Path:   SlashPath(relPath),
+	})
+}
+
+// AddMapTiles records the properties of a map's tiles. Maps without tile
+// properties are left out.
+func (md *ManifestData) AddMapTiles(fileName string, tiles []TileEntry) {
+	if len(tiles) == 0 {
+		return
+	}
+	md.MapTiles = append(md.MapTiles, MapTilesEntry{
+		Map:   "Map" + ToPascalCase(strings.TrimSuffix(fileName, ".map")),
+		Tiles: tiles,
+	})
+}
+
+// AddAudio adds an audio asset and its length in seconds to the manifest.
+func (md *ManifestData) AddAudio(fileName string, relPath string, duration float64) {
+	md.Audio = append(md.Audio, AssetEntry{
+		Const:           AudioConst(fileName),
+		Name:            strings.TrimSuffix(fileName, filepath.Ext(fileName)),
+		Source:          fileName,
+		Path:            SlashPath(relPath),
+		DurationSeconds: duration,
 	})
 }
 
-// AddAudio adds an audio asset to the manifest.
-func (md *ManifestData) AddAudio(fileName string, relPath string) {
+// AddPatternAudio adds a sound rendered from one pattern of a .track file.
+// It is listed as a sound effect named like PatternAudioName.
+func (md *ManifestData) AddPatternAudio(trackFile, pattern, relPath string, duration float64) {
+	name := PatternAudioName(trackFile, pattern)
+	md.Audio = append(md.Audio, AssetEntry{
+		Const:           AudioConst(name + ".sfx"),
+		Name:            name,
+		Source:          trackFile,
+		Path:            SlashPath(relPath),
+		DurationSeconds: duration,
+		Pattern:         pattern,
+	})
+}
+
+// PatternAudioName returns the name of a sound rendered from one pattern
+// of a .track file: the track's name and the pattern's, like
+// jingles_victory.
+func PatternAudioName(trackFile, pattern string) string {
+	return strings.TrimSuffix(trackFile, filepath.Ext(trackFile)) + "_" + pattern
+}
+
+// AudioConst returns the manifest constant name for an .sfx or .track file.
+func AudioConst(fileName string) string {
 	name := strings.TrimSuffix(fileName, filepath.Ext(fileName))
-	ext := filepath.Ext(fileName)
 
 	var prefix string
-	switch ext {
+	switch filepath.Ext(fileName) {
 	case ".sfx":
 		prefix = "SFX"
 	case ".track":
@@ -88,11 +275,7 @@ func (md *ManifestData) AddAudio(fileName string, relPath string) {
 	default:
 		prefix = "Audio"
 	}
-	constName := prefix + ToPascalCase(name)
-	md.Audio = append(md.Audio, AssetEntry{
-		Const: constName,
-		Path:  relPath,
-	})
+	return prefix + ToPascalCase(name)
 }
 
 // ToPascalCase converts a string to PascalCase.
@@ -115,8 +298,80 @@ func ToPascalCase(s string) string {
 	return result.String()
 }
 
+// eventsLiteral writes frame events as a map[int][]string literal body,
+// in frame order.
+func eventsLiteral(events map[int][]string) string {
+	frames := make([]int, 0, len(events))
+	for f := range events {
+		frames = append(frames, f)
+	}
+	slices.Sort(frames)
+	entries := make([]string, len(frames))
+	for i, f := range frames {
+		names := make([]string, len(events[f]))
+		for j, n := range events[f] {
+			names[j] = strconv.Quote(n)
+		}
+		entries[i] = fmt.Sprintf("%d: {%s}", f, strings.Join(names, ", "))
+	}
+	return "{" + strings.Join(entries, ", ") + "}"
+}
+
+// goLiteral writes a decoded TOML value as a Go expression. Numbers keep
+// their TOML types, int64 and float64; dates and times become strings.
+// The sprite parser has already rejected nan and inf.
+func goLiteral(v any) string {
+	switch v := v.(type) {
+	case string:
+		return strconv.Quote(v)
+	case bool:
+		return strconv.FormatBool(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		s := strconv.FormatFloat(v, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".e") {
+			s += ".0"
+		}
+		return s
+	case []any:
+		elems := make([]string, len(v))
+		for i, e := range v {
+			elems[i] = goLiteral(e)
+		}
+		return "[]any{" + strings.Join(elems, ", ") + "}"
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		fields := make([]string, len(keys))
+		for i, k := range keys {
+			fields[i] = strconv.Quote(k) + ": " + goLiteral(v[k])
+		}
+		return "map[string]any{" + strings.Join(fields, ", ") + "}"
+	default:
+		return strconv.Quote(fmt.Sprint(v))
+	}
+}
+
 const manifestTmpl = `// Code generated by runefact. DO NOT EDIT.
 package {{.Package}}
+{{- if .Pack}}
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+{{- end}}
 
 // Sprite sheets
 const (
@@ -124,22 +379,97 @@ const (
 	{{.Const}} = "{{.Path}}"
 {{- end}}
 )
+{{- if .TransparentColor}}
+
+// TransparentColor is the color that stands for transparency in the sprite
+// sheets and frames. They are drawn fully opaque.
+const TransparentColor = "{{.TransparentColor}}"
+{{- end}}
+{{- if .SheetScales}}
+
+// ScaledSheet is an upscaled variant of a sprite sheet. SpriteInfo
+// coordinates are at base scale; multiply them by Scale.
+type ScaledSheet struct {
+	Path  string
+	Scale int
+}
+
+// SheetScales maps each base sheet to its upscaled variants.
+var SheetScales = map[string][]ScaledSheet{
+{{- range .SheetScales}}
+	{{.Sheet}}: {{"{"}}{{range $i, $v := .Variants}}{{if $i}}, {{end}}{"{{$v.Path}}", {{$v.Scale}}}{{end}}{{"}"}},
+{{- end}}
+}
+{{- end}}
 
-// SpriteInfo holds metadata for a single sprite in a sheet.
+// SpriteInfo holds metadata for a single sprite in a sheet. Frame i is the
+// W x H region at X + i*W, Y. PivotX and PivotY are the sprite's anchor
+// point, 0, 0 if it doesn't set one. Playback is "loop", "once" or
+// "pingpong".
 type SpriteInfo struct {
-	Sheet  string
-	X, Y   int
-	W, H   int
-	Frames int
-	FPS    int
+	Sheet          string
+	X, Y           int
+	W, H           int
+	Frames         int
+	FPS            int
+	PivotX, PivotY int
+	Playback       string
 }
 
 // Sprites maps "file:sprite" keys to their sheet position and animation info.
 var Sprites = map[string]SpriteInfo{
 {{- range .Sprites}}
-	"{{.Key}}": {{"{"}}{{.Sheet}}, {{.X}}, {{.Y}}, {{.W}}, {{.H}}, {{.Frames}}, {{.FPS}}{{"}"}},
+	"{{.Key}}": {{"{"}}{{.Sheet}}, {{.X}}, {{.Y}}, {{.W}}, {{.H}}, {{.Frames}}, {{.FPS}}, {{.PivotX}}, {{.PivotY}}, "{{.PlaybackMode}}"{{"}"}},
+{{- end}}
+}
+{{- if .SpriteFrames}}
+
+// SpriteFrames maps "file:sprite" keys to individually exported frame PNGs.
+var SpriteFrames = map[string][]string{
+{{- range .SpriteFrames}}
+	"{{.Key}}": {{"{"}}{{range $i, $p := .Paths}}{{if $i}}, {{end}}"{{$p}}"{{end}}{{"}"}},
 {{- end}}
 }
+{{- end}}
+{{- if .HasSpriteEvents}}
+
+// SpriteEvents maps "file:sprite" keys to the events fired on each
+// animation frame, by 0-based frame index.
+var SpriteEvents = map[string]map[int][]string{
+{{- range .Sprites}}{{if .Events}}
+	"{{.Key}}": {{eventsLiteral .Events}},
+{{- end}}{{end}}
+}
+{{- end}}
+{{- if .HasSpriteHitboxes}}
+
+// Hitbox is a rectangle of a sprite frame in pixels from its top-left
+// corner. Type is "hurt" for where the sprite can be hit and "hit" for
+// where it hits others; Frame is the 0-based frame it is on, or -1 for
+// every frame.
+type Hitbox struct {
+	X, Y, W, H int
+	Type       string
+	Frame      int
+}
+
+// SpriteHitboxes maps "file:sprite" keys to the sprite's hitboxes.
+var SpriteHitboxes = map[string][]Hitbox{
+{{- range .Sprites}}{{if .Hitboxes}}
+	"{{.Key}}": {{"{"}}{{range $i, $h := .Hitboxes}}{{if $i}}, {{end}}{{"{"}}{{$h.X}}, {{$h.Y}}, {{$h.W}}, {{$h.H}}, "{{$h.Type}}", {{$h.Frame}}{{"}"}}{{end}}{{"}"}},
+{{- end}}{{end}}
+}
+{{- end}}
+{{- if .HasSpriteMeta}}
+
+// SpriteMeta maps "file:sprite" keys to the sprite's meta table. Integers
+// are int64 and other numbers float64, as in TOML.
+var SpriteMeta = map[string]map[string]any{
+{{- range .Sprites}}{{if .Meta}}
+	"{{.Key}}": {{goLiteral .Meta}},
+{{- end}}{{end}}
+}
+{{- end}}
 
 // Maps
 const (
@@ -147,6 +477,22 @@ const (
 	{{.Const}} = "{{.Path}}"
 {{- end}}
 )
+{{- if .MapTiles}}
+
+// TileProps holds the properties of a tileset entry.
+type TileProps struct {
+	Solid bool
+	Tags  []string
+}
+
+// MapTiles maps each map to the properties of its tiles, by the tile index
+// used in the layer data.
+var MapTiles = map[string]map[int]TileProps{
+{{- range .MapTiles}}
+	{{.Map}}: {{"{"}}{{range $i, $t := .Tiles}}{{if $i}}, {{end}}{{$t.Index}}: {{"{"}}{{$t.Solid}}, {{if $t.Tags}}[]string{{"{"}}{{range $j, $g := $t.Tags}}{{if $j}}, {{end}}{{printf "%q" $g}}{{end}}{{"}"}}{{else}}nil{{end}}{{"}"}}{{end}}{{"}"}},
+{{- end}}
+}
+{{- end}}
 
 // Audio
 const (
@@ -154,28 +500,169 @@ const (
 	{{.Const}} = "{{.Path}}"
 {{- end}}
 )
+{{- if .Audio}}
+
+// AudioInfo holds metadata for a rendered sound.
+type AudioInfo struct {
+	DurationSeconds float64
+}
+
+// AudioInfos maps each audio constant to its metadata.
+var AudioInfos = map[string]AudioInfo{
+{{- range .Audio}}
+	{{.Const}}: {{"{"}}{{printf "%.3f" .DurationSeconds}}{{"}"}},
+{{- end}}
+}
+{{- end}}
+{{- if .Pack}}
+` + packLoader + `
+{{- end}}
 `
 
-// Generate writes the manifest.go file to the given path.
-func Generate(data *ManifestData, outputPath string) error {
-	tmpl, err := template.New("manifest").Parse(manifestTmpl)
+// packLoader reads a pack in the game. It mirrors internal/pack, which
+// writes it, and must stay in step with it.
+const packLoader = `
+// PackFile is the pack the build wrote every asset into. Open it with
+// OpenPack, or ReadPack for an embedded pack, and read assets from it by
+// the paths above.
+const PackFile = "{{.Pack}}"
+
+// Pack is an asset pack.
+type Pack struct {
+	r       io.ReaderAt
+	cipher  uint8
+	key     []byte
+	nonce   [16]byte
+	entries map[string]packEntry
+}
+
+type packEntry struct{ Offset, Size uint64 }
+
+// OpenPack opens the pack file at path. key is the key the build used, or
+// nil if the pack has no cipher.
+func OpenPack(path string, key []byte) (*Pack, error) {
+	f, err := os.Open(path)
 	if err != nil {
-		return fmt.Errorf("parsing manifest template: %w", err)
+		return nil, err
+	}
+	p, err := ReadPack(f, key)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
 	}
+	return p, nil
+}
 
-	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
-		return fmt.Errorf("creating output directory: %w", err)
+// ReadPack reads the table of contents of a pack from r, such as a
+// bytes.Reader over an embedded pack. r must have a Size method, as
+// bytes.Reader does, or be an *os.File, so entries can be checked against
+// its length. Assets are read from r when asked for, so r must stay open.
+func ReadPack(r io.ReaderAt, key []byte) (*Pack, error) {
+	var size uint64
+	switch s := r.(type) {
+	case interface{ Size() int64 }:
+		size = uint64(s.Size())
+	case *os.File:
+		fi, err := s.Stat()
+		if err != nil {
+			return nil, err
+		}
+		size = uint64(fi.Size())
+	default:
+		return nil, errors.New("pack reader must have a Size method or be an *os.File")
+	}
+	br := bufio.NewReader(io.NewSectionReader(r, 0, int64(size)))
+	var hdr struct {
+		Magic   [4]byte
+		Version uint8
+		Cipher  uint8
+		Check   [8]byte
+		Nonce   [16]byte
+		Count   uint32
 	}
+	if err := binary.Read(br, binary.LittleEndian, &hdr); err != nil || string(hdr.Magic[:]) != "RFPK" {
+		return nil, errors.New("not a runefact pack")
+	}
+	if hdr.Version != 2 || hdr.Cipher > 2 {
+		return nil, fmt.Errorf("pack version %d with cipher %d is not supported", hdr.Version, hdr.Cipher)
+	}
+	if hdr.Cipher != 0 {
+		sum := sha256.Sum256(append([]byte("rfpack key check:"), key...))
+		if string(sum[:8]) != string(hdr.Check[:]) {
+			return nil, errors.New("wrong pack key")
+		}
+	}
+	p := &Pack{r: r, cipher: hdr.Cipher, key: key, nonce: hdr.Nonce, entries: make(map[string]packEntry, hdr.Count)}
+	for i := uint32(0); i < hdr.Count; i++ {
+		var n uint16
+		if err := binary.Read(br, binary.LittleEndian, &n); err != nil {
+			return nil, fmt.Errorf("reading table of contents: %w", err)
+		}
+		name := make([]byte, n)
+		if _, err := io.ReadFull(br, name); err != nil {
+			return nil, fmt.Errorf("reading table of contents: %w", err)
+		}
+		var e packEntry
+		if err := binary.Read(br, binary.LittleEndian, &e); err != nil {
+			return nil, fmt.Errorf("reading table of contents: %w", err)
+		}
+		if e.Offset > size || e.Size > size-e.Offset {
+			return nil, fmt.Errorf("table of contents: %s runs past the end of the pack", name)
+		}
+		p.entries[string(name)] = e
+	}
+	return p, nil
+}
 
-	f, err := os.Create(outputPath)
+// ReadFile returns the asset at name, one of the paths above.
+func (p *Pack) ReadFile(name string) ([]byte, error) {
+	e, ok := p.entries[name]
+	if !ok {
+		return nil, fmt.Errorf("%s: not in the pack", name)
+	}
+	data := make([]byte, e.Size)
+	if _, err := p.r.ReadAt(data, int64(e.Offset)); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	switch p.cipher {
+	case 1:
+		for i := range data {
+			data[i] ^= p.key[i%len(p.key)]
+		}
+	case 2:
+		k := sha256.Sum256(p.key)
+		block, err := aes.NewCipher(k[:])
+		if err != nil {
+			return nil, err
+		}
+		iv := sha256.Sum256(append(p.nonce[:], name...))
+		cipher.NewCTR(block, iv[:aes.BlockSize]).XORKeyStream(data, data)
+	}
+	return data, nil
+}
+
+// Close closes a pack opened with OpenPack.
+func (p *Pack) Close() error {
+	if c, ok := p.r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}`
+
+// Generate writes the manifest.go file to the given path. The file is
+// replaced atomically, so a failed write leaves the previous manifest.
+func Generate(data *ManifestData, outputPath string) error {
+	tmpl, err := template.New("manifest").Funcs(template.FuncMap{"goLiteral": goLiteral, "eventsLiteral": eventsLiteral}).Parse(manifestTmpl)
 	if err != nil {
-		return fmt.Errorf("creating manifest file: %w", err)
+		return fmt.Errorf("parsing manifest template: %w", err)
 	}
-	defer f.Close()
 
-	if err := tmpl.Execute(f, data); err != nil {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
 		return fmt.Errorf("executing manifest template: %w", err)
 	}
-
+	if err := atomicfile.WriteFile(outputPath, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("writing manifest: %w", err)
+	}
 	return nil
 }
@@ -1,12 +1,15 @@
 package manifest
 
 import (
+	"encoding/json"
+	"go/format"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/vgalaktionov/runefact/internal/pack"
 	"github.com/vgalaktionov/runefact/internal/sprite"
 )
 
@@ -61,8 +64,8 @@ func TestManifestData_AddMap(t *testing.T) {
 
 func TestManifestData_AddAudio(t *testing.T) {
 	md := &ManifestData{}
-	md.AddAudio("jump.sfx", "audio/jump.wav")
-	md.AddAudio("theme.track", "audio/theme.wav")
+	md.AddAudio("jump.sfx", "audio/jump.wav", 0.2)
+	md.AddAudio("theme.track", "audio/theme.wav", 107.25)
 	if md.Audio[0].Const != "SFXJump" {
 		t.Errorf("sfx const = %q, want SFXJump", md.Audio[0].Const)
 	}
@@ -78,13 +81,13 @@ func TestGenerate_ValidGo(t *testing.T) {
 			{Const: "SpriteSheetPlayer", Path: "sprites/player.png"},
 		},
 		Sprites: []SpriteEntry{
-			{Key: "player:idle", Sheet: "SpriteSheetPlayer", X: 0, Y: 0, W: 16, H: 16, Frames: 2, FPS: 8},
+			{Key: "player:idle", Sheet: "SpriteSheetPlayer", X: 0, Y: 0, W: 16, H: 16, Frames: 2, FPS: 8, PivotX: 8, PivotY: 15},
 		},
 		Maps: []AssetEntry{
 			{Const: "MapLevel1", Path: "maps/level1.json"},
 		},
 		Audio: []AssetEntry{
-			{Const: "SFXJump", Path: "audio/jump.wav"},
+			{Const: "SFXJump", Path: "audio/jump.wav", DurationSeconds: 0.25},
 		},
 	}
 
@@ -110,7 +113,7 @@ func TestGenerate_ValidGo(t *testing.T) {
 	if !strings.Contains(content, "SpriteSheetPlayer") {
 		t.Error("missing SpriteSheetPlayer constant")
 	}
-	if !strings.Contains(content, `"player:idle"`) {
+	if !strings.Contains(content, `"player:idle": {SpriteSheetPlayer, 0, 0, 16, 16, 2, 8, 8, 15, "loop"}`) {
 		t.Error("missing sprite entry")
 	}
 	if !strings.Contains(content, "MapLevel1") {
@@ -119,6 +122,9 @@ func TestGenerate_ValidGo(t *testing.T) {
 	if !strings.Contains(content, "SFXJump") {
 		t.Error("missing SFXJump constant")
 	}
+	if !strings.Contains(content, "SFXJump: {0.250}") {
+		t.Error("missing SFXJump duration")
+	}
 
 	// Verify it's valid Go by running go vet.
 	// Write a go.mod so `go vet` can parse the file.
@@ -132,3 +138,467 @@ func TestGenerate_ValidGo(t *testing.T) {
 		t.Errorf("generated Go is invalid: %v\n%s", err, out)
 	}
 }
+
+func TestGenerate_SpriteFrames(t *testing.T) {
+	md := &ManifestData{Package: "assets"}
+	md.AddSpriteFrames("player.sprite", "idle", []string{
+		"sprites/frames/player/idle_0.png",
+		"sprites/frames/player/idle_1.png",
+	})
+
+	outputPath := filepath.Join(t.TempDir(), "manifest.go")
+	if err := Generate(md, outputPath); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `"player:idle": {"sprites/frames/player/idle_0.png", "sprites/frames/player/idle_1.png"},`
+	if !strings.Contains(string(data), want) {
+		t.Errorf("missing frames entry %s in:\n%s", want, data)
+	}
+	if _, err := format.Source(data); err != nil {
+		t.Errorf("generated Go does not parse: %v", err)
+	}
+}
+
+func TestGenerate_NoSpriteFrames(t *testing.T) {
+	outputPath := filepath.Join(t.TempDir(), "manifest.go")
+	if err := Generate(&ManifestData{Package: "assets"}, outputPath); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "SpriteFrames") {
+		t.Error("SpriteFrames should be omitted when no frames are exported")
+	}
+}
+
+func TestGenerate_TransparentColor(t *testing.T) {
+	md := &ManifestData{Package: "assets", TransparentColor: "#ff00ff"}
+	outputPath := filepath.Join(t.TempDir(), "manifest.go")
+	if err := Generate(md, outputPath); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `const TransparentColor = "#ff00ff"`; !strings.Contains(string(data), want) {
+		t.Errorf("missing %s in:\n%s", want, data)
+	}
+	if _, err := format.Source(data); err != nil {
+		t.Errorf("generated Go does not parse: %v", err)
+	}
+
+	if jm := md.JSON(); jm.TransparentColor != "#ff00ff" {
+		t.Errorf("JSON transparent_color = %q, want #ff00ff", jm.TransparentColor)
+	}
+}
+
+// A packed manifest reads the packs internal/pack writes, with each
+// cipher.
+func TestGenerate_Pack(t *testing.T) {
+	dir := t.TempDir()
+	md := &ManifestData{
+		Package: "assets",
+		Maps:    []AssetEntry{{Const: "MapLevel1", Path: "maps/level1.json"}},
+		Pack:    pack.FileName,
+	}
+	if err := Generate(md, filepath.Join(dir, "assets", "manifest.go")); err != nil {
+		t.Fatal(err)
+	}
+	if jm := md.JSON(); jm.Pack != pack.FileName {
+		t.Errorf("JSON pack = %q, want %s", jm.Pack, pack.FileName)
+	}
+	for _, c := range pack.Ciphers {
+		var key []byte
+		if c != pack.CipherNone {
+			key = []byte("key-" + string(c))
+		}
+		entries := []pack.Entry{{Name: "maps/level1.json", Data: []byte(`{"cipher": "` + string(c) + `"}`)}}
+		if err := pack.Write(filepath.Join(dir, string(c)+".rfpack"), entries, c, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A pack cut short must fail when opened, not allocate what its table
+	// of contents claims.
+	whole, _ := os.ReadFile(filepath.Join(dir, "none.rfpack"))
+	os.WriteFile(filepath.Join(dir, "short.rfpack"), whole[:len(whole)-1], 0644)
+	main := `package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"test/assets"
+)
+
+func main() {
+	for _, c := range []string{"none", "xor", "aes-ctr"} {
+		var key []byte
+		if c != "none" {
+			key = []byte("key-" + c)
+		}
+		p, err := assets.OpenPack(c+".rfpack", key)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		data, err := p.ReadFile(assets.MapLevel1)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+		p.Close()
+	}
+	if _, err := assets.OpenPack("xor.rfpack", []byte("nope")); err != nil {
+		fmt.Println(err)
+	}
+	if _, err := assets.OpenPack("short.rfpack", nil); err != nil {
+		fmt.Println(err)
+	}
+	short, _ := os.ReadFile("short.rfpack")
+	if _, err := assets.ReadPack(bytes.NewReader(short), nil); err != nil {
+		fmt.Println(err)
+	}
+}
+`
+	os.WriteFile(filepath.Join(dir, "main.go"), []byte(main), 0644)
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module test\ngo 1.23\n"), 0644)
+	cmd := exec.Command("go", "run", ".")
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("reading the pack: %v\n%s", err, out)
+	}
+	want := `{"cipher": "none"}
+{"cipher": "xor"}
+{"cipher": "aes-ctr"}
+xor.rfpack: wrong pack key
+short.rfpack: table of contents: maps/level1.json runs past the end of the pack
+table of contents: maps/level1.json runs past the end of the pack
+`
+	if string(out) != want {
+		t.Errorf("output:\n%s\nwant:\n%s", out, want)
+	}
+}
+
+func TestGenerate_SheetScales(t *testing.T) {
+	md := &ManifestData{Package: "assets"}
+	md.AddSpriteSheet("player.sprite", "sprites/player.png", sprite.SpriteSheetMeta{})
+	md.AddSheetScale("player.sprite", "sprites/player@2x.png", 2)
+	md.AddSheetScale("player.sprite", "sprites/player@4x.png", 4)
+
+	if len(md.SheetScales) != 1 || len(md.SheetScales[0].Variants) != 2 {
+		t.Fatalf("scales = %+v, want one sheet with two variants", md.SheetScales)
+	}
+
+	outputPath := filepath.Join(t.TempDir(), "manifest.go")
+	if err := Generate(md, outputPath); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := format.Source(data); err != nil {
+		t.Errorf("generated Go does not parse: %v\n%s", err, data)
+	}
+}
+
+func TestGenerate_MapTiles(t *testing.T) {
+	md := &ManifestData{Package: "assets"}
+	md.AddMap("level1.map", "maps/level1.json")
+	md.AddMapTiles("level1.map", []TileEntry{
+		{Index: 1, Solid: true, Tags: []string{"ground", "stone"}},
+		{Index: 3, Solid: false},
+	})
+	md.AddMapTiles("level2.map", nil)
+
+	if len(md.MapTiles) != 1 {
+		t.Fatalf("map tiles = %+v, want only level1", md.MapTiles)
+	}
+
+	outputPath := filepath.Join(t.TempDir(), "manifest.go")
+	if err := Generate(md, outputPath); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `MapLevel1: {1: {true, []string{"ground", "stone"}}, 3: {false, nil}},`
+	if !strings.Contains(string(data), want) {
+		t.Errorf("missing tiles entry %s in:\n%s", want, data)
+	}
+	if _, err := format.Source(data); err != nil {
+		t.Errorf("generated Go does not parse: %v", err)
+	}
+
+	jm := md.JSON()
+	if len(jm.Maps[0].Tiles) != 2 || !jm.Maps[0].Tiles[0].Solid {
+		t.Errorf("json map tiles = %+v", jm.Maps[0].Tiles)
+	}
+}
+
+func TestGenerate_SpriteMeta(t *testing.T) {
+	md := &ManifestData{Package: "assets"}
+	md.AddSpriteSheet("player.sprite", "sprites/player.png", sprite.SpriteSheetMeta{
+		Sprites: map[string]sprite.SpriteInfo{
+			"idle": {W: 16, H: 16, Frames: 1},
+			"run": {W: 16, H: 16, Frames: 4, Meta: map[string]any{
+				"damage": int64(3),
+				"speed":  2.0,
+				"pivot":  []any{int64(8), int64(15)},
+				"hitbox": map[string]any{"x": int64(2), "w": int64(12), "label": "body"},
+			}},
+		},
+	})
+
+	outputPath := filepath.Join(t.TempDir(), "manifest.go")
+	if err := Generate(md, outputPath); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `"player:run": map[string]any{"damage": 3, "hitbox": map[string]any{"label": "body", "w": 12, "x": 2}, "pivot": []any{8, 15}, "speed": 2.0},`
+	if !strings.Contains(string(data), want) {
+		t.Errorf("missing meta entry %s in:\n%s", want, data)
+	}
+	if strings.Contains(string(data), `"player:idle": map`) {
+		t.Error("sprites without meta should be left out of SpriteMeta")
+	}
+	if _, err := format.Source(data); err != nil {
+		t.Errorf("generated Go does not parse: %v", err)
+	}
+
+	for _, s := range md.JSON().Sprites {
+		if (s.Key == "player:run") != (s.Meta != nil) {
+			t.Errorf("json sprite %s meta = %v", s.Key, s.Meta)
+		}
+	}
+
+	// Without any meta the variable is omitted.
+	md = &ManifestData{Package: "assets"}
+	if err := Generate(md, outputPath); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(outputPath); strings.Contains(string(data), "SpriteMeta") {
+		t.Error("SpriteMeta should be omitted when no sprite has meta")
+	}
+}
+
+func TestGenerate_SpriteEvents(t *testing.T) {
+	md := &ManifestData{Package: "assets"}
+	md.AddSpriteSheet("player.sprite", "sprites/player.png", sprite.SpriteSheetMeta{
+		Sprites: map[string]sprite.SpriteInfo{
+			"idle": {W: 16, H: 16, Frames: 1},
+			"run":  {W: 16, H: 16, Frames: 8, Events: map[int][]string{6: {"footstep"}, 2: {"footstep", "dust"}}},
+		},
+	})
+
+	outputPath := filepath.Join(t.TempDir(), "manifest.go")
+	if err := Generate(md, outputPath); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `"player:run": {2: {"footstep", "dust"}, 6: {"footstep"}},`
+	if !strings.Contains(string(data), want) {
+		t.Errorf("missing events entry %s in:\n%s", want, data)
+	}
+	if strings.Contains(string(data), `"player:idle": {2`) {
+		t.Error("sprites without events should be left out of SpriteEvents")
+	}
+	if _, err := format.Source(data); err != nil {
+		t.Errorf("generated Go does not parse: %v", err)
+	}
+
+	js, err := json.Marshal(md.JSON())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(js), `"events":{"2":["footstep","dust"],"6":["footstep"]}`) {
+		t.Errorf("manifest.json events: %s", js)
+	}
+
+	md = &ManifestData{Package: "assets"}
+	if err := Generate(md, outputPath); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(outputPath); strings.Contains(string(data), "SpriteEvents") {
+		t.Error("SpriteEvents should be omitted when no sprite has events")
+	}
+}
+
+func TestGenerate_SpriteHitboxes(t *testing.T) {
+	md := &ManifestData{Package: "assets"}
+	md.AddSpriteSheet("player.sprite", "sprites/player.png", sprite.SpriteSheetMeta{
+		Sprites: map[string]sprite.SpriteInfo{
+			"idle": {W: 16, H: 16, Frames: 1},
+			"slash": {W: 16, H: 16, Frames: 3, Hitboxes: []sprite.Hitbox{
+				{X: 4, Y: 2, W: 8, H: 14, Type: sprite.HitboxHurt, Frame: sprite.AllFrames},
+				{X: 10, Y: 4, W: 6, H: 4, Type: sprite.HitboxHit, Frame: 2},
+			}},
+		},
+	})
+
+	outputPath := filepath.Join(t.TempDir(), "manifest.go")
+	if err := Generate(md, outputPath); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `"player:slash": {{4, 2, 8, 14, "hurt", -1}, {10, 4, 6, 4, "hit", 2}},`
+	if !strings.Contains(string(data), want) {
+		t.Errorf("missing hitbox entry %s in:\n%s", want, data)
+	}
+	if strings.Contains(string(data), `"player:idle": {{`) {
+		t.Error("sprites without hitboxes should be left out of SpriteHitboxes")
+	}
+	if _, err := format.Source(data); err != nil {
+		t.Errorf("generated Go does not parse: %v", err)
+	}
+
+	js, err := json.Marshal(md.JSON())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(js), `"hitboxes":[{"x":4,"y":2,"w":8,"h":14,"type":"hurt","frame":-1},{"x":10,"y":4,"w":6,"h":4,"type":"hit","frame":2}]`) {
+		t.Errorf("manifest.json hitboxes: %s", js)
+	}
+
+	md = &ManifestData{Package: "assets"}
+	if err := Generate(md, outputPath); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(outputPath); strings.Contains(string(data), "SpriteHitboxes") {
+		t.Error("SpriteHitboxes should be omitted when no sprite has hitboxes")
+	}
+}
+
+func TestGenerateJSON(t *testing.T) {
+	md := &ManifestData{Package: "assets"}
+	md.AddSpriteSheet("player.sprite", filepath.Join("sprites", "player.png"), sprite.SpriteSheetMeta{
+		Sprites: map[string]sprite.SpriteInfo{
+			"run":  {X: 0, Y: 16, W: 16, H: 16, Frames: 4, FPS: 12, PivotX: 8, PivotY: 15, Playback: "pingpong"},
+			"idle": {X: 0, Y: 0, W: 16, H: 16, Frames: 2, FPS: 8},
+		},
+	})
+	md.AddSheetScale("player.sprite", "sprites/player@2x.png", 2)
+	md.AddSpriteFrames("player.sprite", "idle", []string{"sprites/frames/player/idle_0.png", "sprites/frames/player/idle_1.png"})
+	md.AddMap("level1.map", "maps/level1.json")
+	md.AddAudio("jump.sfx", "audio/jump.wav", 0.2)
+	md.AddAudio("theme.track", "audio/theme.wav", 107.25)
+
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	if err := GenerateJSON(md, path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got JSONManifest
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+
+	if got.Version != JSONVersion {
+		t.Errorf("version = %d, want %d", got.Version, JSONVersion)
+	}
+	if len(got.Sheets) != 1 || got.Sheets[0].Name != "player" || got.Sheets[0].Path != "sprites/player.png" {
+		t.Errorf("sheets = %+v", got.Sheets)
+	}
+	if sc := got.Sheets[0].Scales; len(sc) != 1 || sc[0].Scale != 2 {
+		t.Errorf("scales = %+v", sc)
+	}
+	if len(got.Sprites) != 2 || got.Sprites[0].Key != "player:idle" || got.Sprites[1].Key != "player:run" {
+		t.Fatalf("sprites should be sorted by key: %+v", got.Sprites)
+	}
+	if s := got.Sprites[1]; s.Sheet != "player" || s.Y != 16 || s.Frames != 4 || s.FPS != 12 || s.PivotX != 8 || s.PivotY != 15 || s.Playback != "pingpong" {
+		t.Errorf("run sprite = %+v", s)
+	}
+	if got.Sprites[0].Playback != "loop" {
+		t.Errorf("idle playback = %q, want loop by default", got.Sprites[0].Playback)
+	}
+	if len(got.Sprites[0].FramePaths) != 2 {
+		t.Errorf("idle frame_paths = %v", got.Sprites[0].FramePaths)
+	}
+	if len(got.Maps) != 1 || got.Maps[0].Name != "level1" {
+		t.Errorf("maps = %+v", got.Maps)
+	}
+	if len(got.Audio) != 2 || got.Audio[0].Kind != "sfx" || got.Audio[1].Kind != "track" || got.Audio[1].Name != "theme" {
+		t.Errorf("audio = %+v", got.Audio)
+	}
+	if got.Audio[1].DurationSeconds != 107.25 {
+		t.Errorf("track duration = %v, want 107.25", got.Audio[1].DurationSeconds)
+	}
+
+	// Field names are part of the format.
+	for _, field := range []string{`"frame_paths"`, `"fps"`, `"kind"`, `"scales"`, `"duration_seconds"`, `"pivot_x"`} {
+		if !strings.Contains(string(data), field) {
+			t.Errorf("manifest.json missing field %s", field)
+		}
+	}
+}
+
+func TestManifestData_SlashPaths(t *testing.T) {
+	md := &ManifestData{Package: "assets"}
+	md.AddSpriteSheet("player.sprite", `sprites\player.png`, sprite.SpriteSheetMeta{})
+	md.AddSheetScale("player.sprite", `sprites\player@2x.png`, 2)
+	md.AddSpriteFrames("player.sprite", "idle", []string{`sprites\frames\player\idle_0.png`})
+	md.AddMap("level1.map", `maps\level1.json`)
+	md.AddAudio("jump.sfx", `audio\sfx\jump.wav`, 0.2)
+
+	outputPath := filepath.Join(t.TempDir(), "manifest.go")
+	if err := Generate(md, outputPath); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), `\`) {
+		t.Errorf("manifest has backslashes:\n%s", data)
+	}
+	for _, want := range []string{
+		`"sprites/player.png"`, `"sprites/player@2x.png"`, `"sprites/frames/player/idle_0.png"`,
+		`"maps/level1.json"`, `"audio/sfx/jump.wav"`,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("missing %s in:\n%s", want, data)
+		}
+	}
+
+	jm := md.JSON()
+	if got := jm.Sheets[0].Scales[0].Path; got != "sprites/player@2x.png" {
+		t.Errorf("json scale path = %q", got)
+	}
+	if got := jm.Audio[0].Path; got != "audio/sfx/jump.wav" {
+		t.Errorf("json audio path = %q", got)
+	}
+}
+
+func TestGenerateJSON_EmptyListsNotNull(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	if err := GenerateJSON(&ManifestData{}, path); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "null") {
+		t.Errorf("empty manifest should use [] not null:\n%s", data)
+	}
+}
@@ -0,0 +1,178 @@
+package mcp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// formatError documents an error a format's parser reports.
+type formatError struct {
+	// Message is an example of the error as printed, without the file name
+	// in front.
+	Message string
+	// Fix says what causes it and how to fix it.
+	Fix string
+}
+
+// formatErrors lists, per format, every error its parser reports. A test
+// checks that each error message in the parsers matches one of these
+// examples, so a new error fails the build until it is documented here.
+var formatErrors = map[string][]formatError{
+	"palette": {
+		{`color must start with #, got "ff0000"`, `Write colors as hex with a leading #: "#ff0000".`},
+		{`invalid hex color length: #ff00f (expected 3, 6, or 8 hex digits)`, `Use #RGB, #RRGGBB or #RRGGBBAA.`},
+		{`invalid hex color #ggg: strconv.ParseUint: parsing "g": invalid syntax`, `Only 0-9 and a-f are hex digits.`},
+		{`palette "retro" not found in search paths: [assets/palettes]`, `The palette name must match a .palette file in assets/palettes, without the extension.`},
+		{`alias "k" is also a color key`, `An alias names a color in [aliases]; pick a name that isn't a key in [colors].`},
+		{`alias "ink": "blk" is not a color key or a hex color (did you mean "bk"?)`, `Point the alias at a key in [colors] or at a hex color like "#1d2b53".`},
+	},
+	"sprite": {
+		{`sprite "coin": unknown palette keys: [y] (did you mean "r" for "y"?)`, `Every pixel key must be in the palette or palette_extend; add the key or fix the typo.`},
+		{`line 3: ragged row, expected width 8, got 7`, `Every row of a frame must have the same number of pixels. Multi-char keys count once: [sk] is one pixel.`},
+		{`unclosed bracket at position 4`, `A multi-char key opened with [ needs a closing ].`},
+		{`empty bracket key at position 4`, `[] is not a key; use _ for a transparent pixel.`},
+		{`invalid UTF-8 at position 2`, `Save the file as UTF-8.`},
+		{`line 4097: grid has more than 4096 rows`, `A frame can be at most 4096x4096 pixels.`},
+		{`row has more than 4096 columns`, `A frame can be at most 4096x4096 pixels.`},
+		{`invalid grid size "16by16" (expected int or WxH)`, `Write grid as one number for squares or as "WxH", e.g. grid = "16x24".`},
+		{`invalid grid type bool`, `grid is a number or a "WxH" string.`},
+		{`sprite "hero": pixel dimensions 12x3 don't match grid 16x16`, `Every frame must be exactly the grid size. Fix the pixels, change grid, or drop grid to size the sprite from its pixels.`},
+		{`sprite "coin": frame 2 dimensions 6x3 differ from frame 1 (6x4)`, `All frames of a sprite must be the same size.`},
+		{`sprite "coin": frame 2 is empty, check the "--" separators`, `A "--" line separates two frames; remove doubled or trailing separators.`},
+		{`sprite "coin": frame_count is 3 but the sprite has 2 frame(s)`, `frame_count is optional; when set it must equal the number of frames.`},
+		{`sprite "coin": more than 4096 frames`, `A sprite can have at most 4096 frames.`},
+		{`sprite "coin": pixels cannot be combined with [[frame]] tables, use one or the other`, `Write frames either in pixels separated by "--" or as [[sprite.NAME.frame]] tables.`},
+		{`sprite "coin": playback "bounce" must be "loop", "once" or "pingpong"`, `Pick one of the listed playback modes, or leave it out to loop.`},
+		{`sprite "hero_left": flip_x, flip_y and rotate need from, the sprite to transform`, `Set from = "hero" to transform another sprite.`},
+		{`sprite "hero_left": from cannot be combined with pixels, frames, region or compose`, `A from sprite takes its pixels from its source; remove its own pixels.`},
+		{`sprite "hero_left": a sprite made with from takes its colors from its source, set palette there instead`, `Remove palette from the from sprite.`},
+		{`sprite "hero_up": rotate must be 0, 90, 180 or 270, got 45`, `Rotate by a multiple of 90 degrees.`},
+		{`sprite "knight": compose cannot be combined with pixels, frames or region`, `A composed sprite is made of its parts only.`},
+		{`sprite "knight": a composed sprite takes its colors from its parts, set palette on them instead`, `Remove palette from the composed sprite.`},
+		{`sprite "tree": region cannot be combined with pixels or frames`, `A region sprite cuts its pixels from the [canvas]; remove its own pixels.`},
+		{`sprite "tree": region needs a [canvas] with pixels in the file`, `Add a [canvas] table with pixels to cut regions from.`},
+		{`region list is empty`, `Give at least one {x, y, w, h} region.`},
+		{`more than 4096 regions`, `A sprite can have at most 4096 regions.`},
+		{`region 2 must be {x, y, w, h}, got string`, `Each entry of a region list is an inline table.`},
+		{`region must be {x, y, w, h} or a list of them, got int64`, `Write region = {x = 0, y = 0, w = 16, h = 16}.`},
+		{`x must be a whole number, got 1.5`, `Region coordinates and sizes are whole pixels.`},
+		{`unknown key "width", want x, y, w and h`, `Regions take x, y, w and h only.`},
+		{`region: missing y`, `Set x and y; w and h can come from the grid.`},
+		{`x and y must not be negative, got -1, 0`, `Regions start inside the canvas.`},
+		{`size 0x16 must be positive; set w and h, or a grid`, `Give the region a size, or set grid so it has a default.`},
+		{`16x16 at 40,0 is outside the 48x16 canvas`, `Move or shrink the region to fit the canvas.`},
+		{`events: "first" is not a frame index`, `Event keys are frame numbers from 0, quoted: events = { "2" = "step" }.`},
+		{`events: frame 2: 5 is not a string`, `Event names are strings.`},
+		{`events: frame 2 must be an event name or a list of them`, `Write "step" or ["step", "dust"].`},
+		{`events: frame 4 is out of range, the sprite has 4 frame(s) numbered from 0`, `Frames are numbered from 0.`},
+		{`pivot "middle" must be "center", "bottom-center" or {x, y}`, `Use a named anchor or a pixel position.`},
+		{`pivot must be "center", "bottom-center" or {x, y}, got int64`, `Use a named anchor or a pixel position.`},
+		{`pivot must be {x = N, y = N}, got z = 1`, `A pivot table takes x and y only.`},
+		{`hitbox 1: type "hurtbox" must be "hurt" or "hit"`, `A hurt box is where the sprite can be hit; a hit box is where it deals damage.`},
+		{`hitbox 2: size 0x8 must be positive`, `Give every hitbox a w and h of at least 1.`},
+		{`hitbox 1: frame -1 is not a frame index`, `Frames are numbered from 0; leave frame out for a box on every frame.`},
+		{`hitbox 1: 8x8 at 12,0 is outside the 16x16 grid`, `Move or shrink the hitbox to fit the sprite's grid.`},
+		{`hitbox 3: frame 4 is out of range, the sprite has 4 frame(s) numbered from 0`, `Frames are numbered from 0.`},
+		{`pivot is missing x`, `Set both x and y.`},
+		{`pivot is missing y`, `Set both x and y.`},
+		{`pivot (16, 8) is outside the 16x16 grid`, `Pivot coordinates go from 0 to the grid size minus one.`},
+		{`meta: speed: nan and inf are not supported`, `meta values are exported as JSON, which has no NaN or infinity.`},
+		{`palette_extend key "o": unknown color "inc": not a hex color, or an alias or key of palette "default" (did you mean "ink"?)`, `A palette_extend value is a hex color, or an alias or key of the sprite's palette.`},
+	},
+	"map": {
+		{`tile_size must be positive`, `Set tile_size to the width of a tile in pixels.`},
+		{`tileset key "[x]" can't be written in a layer: keys must not be empty or contain brackets`, `Name the key x and write it as [x] in layers only when it is longer than one character.`},
+		{`tileset "w": expected a sprite reference or a table, got int64`, `Write w = "terrain:wall" or w = { sprite = "terrain:wall", solid = true }.`},
+		{`tileset "w": sprite must be a string`, `sprite is a "file:name" reference.`},
+		{`tileset "w": solid must be true or false`, `solid is a boolean.`},
+		{`tileset "w": animate must be true or false`, `animate is a boolean.`},
+		{`tileset "w": id must be a positive integer`, `Tile ids start at 1.`},
+		{`tileset "w": tags must be an array of strings`, `Write tags = ["wall", "stone"].`},
+		{`tileset "w": unknown field "solids" (known: sprite, solid, tags, animate, id)`, `Fix the field name.`},
+		{`tileset "_": id is set on an empty tile`, `Empty tiles have no id.`},
+		{`tileset "w": id 3 is already used by "g"`, `Give every tile a different id.`},
+		{`layer "bg": a tile layer can't have entities`, `Move the entities to a layer with type = "entity".`},
+		{`layer "spawns": an entity layer can't have pixels`, `Move the pixels to a tile layer.`},
+		{`layer "bg": type "tiles" must be "tile" or "entity"`, `Use one of the two layer types.`},
+		{`layer "bg": tint: color is required`, `A tint needs color = "#RRGGBB".`},
+		{`layer "bg": tint: color "#00000080" must be opaque`, `Tints use #RGB or #RRGGBB; fade layers another way.`},
+		{`layer "bg": tint: mode "screen" must be "multiply"`, `multiply is the only tint mode.`},
+		{`preset "night": unknown layer "sky"`, `Presets can only override layers the map has.`},
+	},
+	"instrument": {
+		{`instrument "bass" not found in search paths: [assets/instruments]`, `A track channel's instrument must match a .inst file in assets/instruments, without the extension.`},
+		{`envelope: release_curve "steep" must be "linear", "exponential" or "logarithmic"`, `Leave the curve out for linear, or pick one of the three.`},
+		{`oscillator: tune, decay and snap only apply to waveform kick, snare or hat, not square`, `Use a drum waveform, or remove the drum parameters.`},
+		{`oscillator: decay must be positive, got 0`, `decay is how many seconds the drum takes to die away.`},
+		{`oscillator: snap must be between 0 and 1, got 2`, `snap goes from 0 (none) to 1 (all click or noise).`},
+		{`range: needs both low and high`, `Write range = { low = "C1", high = "C4" }, or leave it out.`},
+		{`range: low C4 is above high C1`, `low is the lowest note the instrument plays.`},
+		{`range: low: invalid note "Db1", want a name and octave like C4 or F#2`, `Write flats as sharps, like C#1, with an octave from 0 to 9.`},
+		{`sample "../pad.wav" must be a path inside the project, like assets/samples/kick.wav`, `Put the WAV file inside the project and name it relative to the project root.`},
+		{`root_note: invalid note "H4", want a name and octave like C4 or F#2`, `root_note is the note the recording plays at its own speed, like A4.`},
+		{`loop_start = 10 and loop_end = 0 must be frames with loop_start before loop_end`, `Set both as frame numbers into the WAV file, or leave both out for no loop.`},
+		{`root_note, loop_start and loop_end need a sample`, `Set sample to a WAV file, or remove these keys.`},
+		{`sample: open assets/samples/pad.wav: no such file or directory`, `The sample path is relative to the project root, the directory holding runefact.toml.`},
+		{`sample: assets/samples/pad.wav: WAV has 2 channels, samples must be mono`, `Samples must be mono PCM WAV files with 8, 16 or 24 bits per sample; convert the file.`},
+		{`loop_end = 2000 is past the end of assets/samples/pad.wav, 1000 frames long`, `loop_end counts frames; it can be at most the length of the recording.`},
+	},
+	"sfx": {
+		{`duration must be positive`, `Set duration to the length in seconds.`},
+		{`voice 1: sync_to = 1 is the voice itself`, `A voice syncs to another voice.`},
+		{`voice 1: sync_to = 3, but voices are numbered 0 to 1`, `Voices are numbered from 0 in file order.`},
+		{`voice 0: envelope: attack_curve "steep" must be "linear", "exponential" or "logarithmic"`, `Leave the curve out for linear, or pick one of the three.`},
+	},
+	"track": {
+		{`tempo must be positive`, `Set tempo in beats per minute.`},
+		{`beats_per_bar must be positive`, `Leave beats_per_bar out for 4, or set the bar length in beats.`},
+		{`master_volume must not be negative`, `Volumes go from 0 up; 1 is unchanged.`},
+		{`bus "drums": volume must not be negative`, `Volumes go from 0 up; 1 is unchanged.`},
+		{`channel "kick": undefined bus "drum" (defined: drums, fx)`, `Name a bus defined under [bus.NAME].`},
+		{`channel "bass": duck: amount must be between 0 and 1, got 2`, `amount is how far the channel dips, from 0 (not at all) to 1 (silent).`},
+		{`channel "bass": duck: release must not be negative`, `release is in seconds.`},
+		{`channel "bass": duck: source "kik" is not a channel or a bus with channels`, `Duck under a channel name or a bus that has channels.`},
+		{`channel "bass": duck: source "bass" includes the channel itself`, `A channel can't duck under itself.`},
+		{`unknown pattern "chorus" in sequence`, `Every name in [song] sequence needs a [pattern.NAME] table.`},
+		{`song: unknown pattern "victory" in export_patterns`, `Every name in [song] export_patterns needs a [pattern.NAME] table.`},
+		{`song: pattern "win!" in export_patterns names a file, so it can only have letters, digits, _ and -`, `Rename the pattern; its WAV is named after it.`},
+		{`song: pattern "victory" is in export_patterns twice`, `List each pattern once.`},
+		{`song: export_full = false needs export_patterns, or the track writes nothing`, `List the patterns to export, or remove export_full.`},
+		{`loop_crossfade must not be negative, got -0.05`, `loop_crossfade is in seconds, like 0.05.`},
+		{`loop_crossfade needs loop = true`, `Only a looping track has a seam to crossfade; set loop = true or remove loop_crossfade.`},
+		{`loop_crossfade = 2 is longer than the loop, 1.5s`, `Shorten the crossfade, or move loop_start earlier.`},
+		{`unknown pattern "chorus"`, `Pick a pattern the track defines.`},
+		{`pattern "verse": empty data`, `A pattern needs a header line and at least one row.`},
+		{`pattern "verse": header mismatch: expected "lead | bass", found "C4 | C3" (is the header line missing?)`, `The first data line names the channels, in [[channel]] order.`},
+		{`pattern "verse" row 3: got 1 columns, expected 2`, `Every row has one cell per channel, separated by |.`},
+		{`pattern "verse" row 3: got 65 columns, at most 64 are allowed`, `A track can have at most 64 channels.`},
+		{`pattern "verse" has more than 65536 rows`, `Split long patterns.`},
+		{`pattern "verse": ticks = 70000, at most 65536 are allowed`, `Split long patterns.`},
+		{`pattern "verse" has 18 rows but ticks = 16, remove rows or raise ticks`, `ticks must match the row count.`},
+		{`pattern "verse" has 12 rows but ticks = 16, add rows or set pad = true to fill with silence`, `ticks must match the row count, or pad fills the rest.`},
+		{`pattern "verse" row 2 col 1: invalid note "H4": unknown note name "H"`, `Notes are C, C#, D, D#, E, F, F#, G, G#, A, A# and B.`},
+		{`pattern "verse" row 2 col 1: invalid note "C": missing octave`, `Add the octave: C4.`},
+		{`pattern "verse" row 2 col 1: invalid note "Cx": cannot parse octave`, `The octave is a number: C4.`},
+		{`pattern "verse" row 2 col 1: invalid note "C12": octave 12 is outside 0-9`, `Octaves go from 0 to 9.`},
+		{`pattern "verse" row 2 col 1: invalid effect "vz"`, `Effect values are hex: v8, vF.`},
+	},
+}
+
+// formatDoc returns the documentation of format with its common errors,
+// and false if there is no such format.
+func formatDoc(format string) (string, bool) {
+	doc, ok := formatDocs[format]
+	if !ok {
+		return "", false
+	}
+	errs := formatErrors[format]
+	if len(errs) == 0 {
+		return doc, true
+	}
+	var b strings.Builder
+	b.WriteString(doc)
+	b.WriteString("\n## Common errors\n\nMessages follow the file name, and line and column when known.\n\n")
+	for _, e := range errs {
+		fmt.Fprintf(&b, "- `%s`: %s\n", e.Message, e.Fix)
+	}
+	return b.String(), true
+}
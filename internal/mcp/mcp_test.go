@@ -1,15 +1,37 @@
 package mcp
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
 
 	"github.com/vgalaktionov/runefact/internal/config"
+	"github.com/vgalaktionov/runefact/internal/instrument"
+	"github.com/vgalaktionov/runefact/internal/palette"
+	"github.com/vgalaktionov/runefact/internal/sfx"
+	"github.com/vgalaktionov/runefact/internal/sprite"
+	"github.com/vgalaktionov/runefact/internal/tilemap"
+	"github.com/vgalaktionov/runefact/internal/track"
 )
 
 func setupTestProject(t *testing.T) (*ServerContext, string) {
@@ -60,7 +82,7 @@ br
 	}
 
 	// Map.
-	mapData := `tile_size = 16
+	mapData := `tile_size = 2
 [tileset]
 g = "demo:test"
 _ = ""
@@ -126,6 +148,32 @@ func TestHandleBuild(t *testing.T) {
 	}
 }
 
+func TestHandleBuild_Canceled(t *testing.T) {
+	ctx, dir := setupTestProject(t)
+	sfxData := "duration = 5\n\n[[voice]]\nwaveform = \"sine\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "assets/sfx/hum.sfx"), []byte(sfxData), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	req := mcp.CallToolRequest{}
+	req.Params.Arguments = map[string]any{"scope": "audio"}
+	result, err := ctx.handleBuild(c, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := result.Content[0].(mcp.TextContent).Text
+	var data map[string]any
+	if err := json.Unmarshal([]byte(text), &data); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if data["success"] != false || !strings.Contains(text, "context canceled") {
+		t.Errorf("want a failed build reporting context canceled, got: %s", text)
+	}
+}
+
 func TestHandleValidate(t *testing.T) {
 	ctx, _ := setupTestProject(t)
 
@@ -148,6 +196,127 @@ func TestHandleValidate(t *testing.T) {
 	}
 }
 
+func TestHandleValidate_ChangedOnly(t *testing.T) {
+	ctx, _ := setupTestProject(t)
+
+	req := mcp.CallToolRequest{}
+	req.Params.Arguments = map[string]any{"changed_only": true}
+
+	var cached []float64
+	for range 2 {
+		result, err := ctx.handleValidate(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var data map[string]any
+		if err := json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &data); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		n, _ := data["cached"].(float64)
+		cached = append(cached, n)
+	}
+	if cached[0] != 0 || cached[1] == 0 {
+		t.Errorf("cached = %v, want none on the first run and some on the second", cached)
+	}
+}
+
+func TestHandleValidate_ChangedOnlyReadOnly(t *testing.T) {
+	ctx, dir := setupTestProject(t)
+	ctx.ReadOnly = true
+
+	req := mcp.CallToolRequest{}
+	req.Params.Arguments = map[string]any{"changed_only": true}
+	result, err := ctx.handleValidate(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.IsError {
+		t.Fatalf("validate failed: %v", result.Content)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".runefact/validate_cache.json")); !os.IsNotExist(err) {
+		t.Errorf("read-only validate wrote its cache: %v", err)
+	}
+}
+
+func TestHandleValidate_StructuredDiagnostics(t *testing.T) {
+	ctx, dir := setupTestProject(t)
+
+	// Unknown tileset key "x" produces a warning; a broken sprite an error.
+	mapData := `tile_size = 2
+[tileset]
+g = "demo:test"
+
+[layer.bg]
+pixels = """
+gx
+"""
+`
+	if err := os.WriteFile(filepath.Join(dir, "assets/maps/demo.map"), []byte(mapData), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "assets/sprites/broken.sprite"), []byte("palette = \n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	req := mcp.CallToolRequest{}
+	req.Params.Arguments = map[string]any{}
+
+	result, err := ctx.handleValidate(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var data struct {
+		Valid    bool             `json:"valid"`
+		Errors   []diagnosticJSON `json:"errors"`
+		Warnings []diagnosticJSON `json:"warnings"`
+		Messages []string         `json:"messages"`
+		Summary  []struct {
+			File     string `json:"file"`
+			Total    int    `json:"total"`
+			Warnings []struct {
+				Message string `json:"message"`
+				Count   int    `json:"count"`
+			} `json:"warnings"`
+		} `json:"warning_summary"`
+	}
+	text := result.Content[0].(mcp.TextContent).Text
+	if err := json.Unmarshal([]byte(text), &data); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+
+	if data.Valid {
+		t.Error("expected invalid result")
+	}
+	if len(data.Warnings) != 1 {
+		t.Fatalf("got %d warnings, want 1: %s", len(data.Warnings), text)
+	}
+	w := data.Warnings[0]
+	if w.File != "assets/maps/demo.map" || w.Severity != "warning" {
+		t.Errorf("warning = %+v, want file assets/maps/demo.map severity warning", w)
+	}
+	if len(w.Cells) != 1 || w.Cells[0] != [2]int{1, 2} {
+		t.Errorf("warning cells = %v, want row 1, col 2", w.Cells)
+	}
+	if len(data.Errors) != 1 {
+		t.Fatalf("got %d errors, want 1: %s", len(data.Errors), text)
+	}
+	e := data.Errors[0]
+	if e.File != "assets/sprites/broken.sprite" || e.Severity != "error" {
+		t.Errorf("error = %+v, want file assets/sprites/broken.sprite severity error", e)
+	}
+	if e.Line != 1 {
+		t.Errorf("error line = %d, want 1", e.Line)
+	}
+	if len(data.Messages) != 2 {
+		t.Errorf("got %d messages, want 2 (backward-compatible strings)", len(data.Messages))
+	}
+	if len(data.Summary) != 1 || data.Summary[0].File != w.File || data.Summary[0].Total != 1 ||
+		len(data.Summary[0].Warnings) != 1 || data.Summary[0].Warnings[0].Message != w.Message {
+		t.Errorf("warning_summary = %+v, want the one map warning", data.Summary)
+	}
+}
+
 func TestHandleInspectSprite(t *testing.T) {
 	ctx, _ := setupTestProject(t)
 
@@ -174,6 +343,218 @@ func TestHandleInspectSprite(t *testing.T) {
 	}
 }
 
+func TestHandlePreviewSprite_SVG(t *testing.T) {
+	ctx, _ := setupTestProject(t)
+
+	req := mcp.CallToolRequest{}
+	req.Params.Arguments = map[string]any{"file": "demo.sprite", "format": "svg", "scale": 1}
+
+	result, err := ctx.handlePreviewSprite(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.IsError {
+		t.Fatalf("unexpected error: %v", result.Content)
+	}
+
+	text := result.Content[0].(mcp.TextContent).Text
+	if !strings.HasPrefix(text, "<svg ") {
+		t.Fatalf("expected SVG text, got: %s", text)
+	}
+	// "rg" / "br": no two adjacent pixels share a color.
+	if got := strings.Count(text, "<rect "); got != 4 {
+		t.Errorf("got %d rects, want 4", got)
+	}
+
+	req.Params.Arguments = map[string]any{"file": "demo.sprite", "format": "gif"}
+	result, err = ctx.handlePreviewSprite(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.IsError {
+		t.Error("expected error for unknown format")
+	}
+}
+
+// previewImage decodes the image and info a preview tool returns.
+func previewImage(t *testing.T, result *mcp.CallToolResult) (image.Image, previewInfo) {
+	t.Helper()
+	if result.IsError {
+		t.Fatalf("unexpected error: %v", result.Content)
+	}
+	if len(result.Content) != 2 {
+		t.Fatalf("got %d content blocks, want image and text", len(result.Content))
+	}
+	data, err := base64.StdEncoding.DecodeString(result.Content[0].(mcp.ImageContent).Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var info previewInfo
+	if err := json.Unmarshal([]byte(result.Content[1].(mcp.TextContent).Text), &info); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if info.Width != img.Bounds().Dx() || info.Height != img.Bounds().Dy() {
+		t.Errorf("info says %dx%d, image is %v", info.Width, info.Height, img.Bounds().Size())
+	}
+	return img, info
+}
+
+func TestHandlePreviewMap(t *testing.T) {
+	ctx, _ := setupTestProject(t)
+
+	preview := func(args map[string]any) *mcp.CallToolResult {
+		t.Helper()
+		req := mcp.CallToolRequest{}
+		req.Params.Arguments = args
+		result, err := ctx.handlePreviewMap(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+	red := color.NRGBA{R: 0xff, A: 0xff}
+
+	// 2x2 tiles of 2 pixels at scale 2.
+	img, info := previewImage(t, preview(map[string]any{"file": "demo.map"}))
+	if info.Width != 8 || info.Height != 8 || info.Scale != 2 || info.Warning != "" {
+		t.Errorf("info = %+v, want 8x8 at scale 2 without a warning", info)
+	}
+	if *info.Region != (tileRegion{0, 0, 2, 2}) {
+		t.Errorf("region = %+v, want the whole map", *info.Region)
+	}
+	if got := color.NRGBAModel.Convert(img.At(0, 0)); got != red {
+		t.Errorf("pixel 0,0 = %v, want red", got)
+	}
+	if _, _, _, a := img.At(4, 0).RGBA(); a != 0 {
+		t.Error("pixel 4,0 of an empty tile is not transparent")
+	}
+
+	// The bottom right tile alone; w and h run to the edge of the map.
+	img, info = previewImage(t, preview(map[string]any{"file": "demo.map", "region": map[string]any{"x": 1, "y": 1}}))
+	if info.Width != 4 || info.Height != 4 || *info.Region != (tileRegion{1, 1, 1, 1}) {
+		t.Errorf("info = %+v, want 4x4 of tile 1,1", info)
+	}
+	if got := color.NRGBAModel.Convert(img.At(0, 0)); got != red {
+		t.Errorf("pixel 0,0 = %v, want red", got)
+	}
+
+	// A region past the edge is cropped.
+	_, info = previewImage(t, preview(map[string]any{"file": "demo.map", "region": map[string]any{"x": 1, "y": 0, "w": 5, "h": 1}}))
+	if *info.Region != (tileRegion{1, 0, 1, 1}) {
+		t.Errorf("region = %+v, want 1,0 1x1", *info.Region)
+	}
+
+	// The one layer alone, with the layer named in the info.
+	img, info = previewImage(t, preview(map[string]any{"file": "demo.map", "layer": "bg", "scale": 1}))
+	if info.Layer != "bg" || info.Width != 4 || color.NRGBAModel.Convert(img.At(0, 0)) != red {
+		t.Errorf("layer bg: info = %+v, pixel 0,0 = %v", info, img.At(0, 0))
+	}
+	if result := preview(map[string]any{"file": "demo.map", "layer": "fg"}); !result.IsError ||
+		!strings.Contains(result.Content[0].(mcp.TextContent).Text, "layers are bg") {
+		t.Errorf("unknown layer: %+v, want an error listing the layers", result.Content)
+	}
+
+	for _, args := range []map[string]any{
+		{"region": map[string]any{"x": 2}},
+		{"region": map[string]any{"w": 0}},
+		{"region": map[string]any{"x": 1.5}},
+		{"region": map[string]any{"x": -1}},
+		{"region": map[string]any{"width": 1}},
+		{"region": "all"},
+		{"max_pixels": 0},
+	} {
+		args["file"] = "demo.map"
+		if result := preview(args); !result.IsError {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+}
+
+func TestHandlePreviewMap_MaxPixels(t *testing.T) {
+	ctx, dir := setupTestProject(t)
+
+	// 64x48 tiles of 2 pixels: 256x192 at scale 2.
+	var b strings.Builder
+	b.WriteString("tile_size = 2\n[tileset]\ng = \"demo:test\"\n\n[layer.bg]\npixels = \"\"\"\n")
+	for range 48 {
+		b.WriteString(strings.Repeat("g", 64) + "\n")
+	}
+	b.WriteString("\"\"\"\n")
+	if err := os.WriteFile(filepath.Join(dir, "assets/maps/big.map"), []byte(b.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		maxPixels     int
+		width, height int
+		scale         float64
+	}{
+		{maxPixels: 1 << 20, width: 256, height: 192, scale: 2},
+		{maxPixels: 20000, width: 128, height: 96, scale: 1},
+		{maxPixels: 10000, width: 64, height: 48, scale: 0.5},
+		{maxPixels: 1000, width: 32, height: 24, scale: 0.25},
+	} {
+		req := mcp.CallToolRequest{}
+		req.Params.Arguments = map[string]any{"file": "big.map", "max_pixels": tc.maxPixels}
+		result, err := ctx.handlePreviewMap(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, info := previewImage(t, result)
+		if info.Width != tc.width || info.Height != tc.height || info.Scale != tc.scale {
+			t.Errorf("max_pixels %d: got %dx%d at scale %v, want %dx%d at scale %v",
+				tc.maxPixels, info.Width, info.Height, info.Scale, tc.width, tc.height, tc.scale)
+		}
+		if (info.Warning != "") != (tc.scale < 2) {
+			t.Errorf("max_pixels %d: warning = %q", tc.maxPixels, info.Warning)
+		}
+		// Every row of tiles is drawn, whichever worker drew it.
+		for y := range info.Height {
+			for x := range info.Width {
+				if _, _, _, a := img.At(x, y).RGBA(); a == 0 {
+					t.Fatalf("max_pixels %d: pixel %d,%d is not drawn", tc.maxPixels, x, y)
+				}
+			}
+		}
+	}
+}
+
+func TestHandlePreviewSprite_MaxPixels(t *testing.T) {
+	ctx, _ := setupTestProject(t)
+
+	for _, tc := range []struct {
+		maxPixels int
+		size      int
+		scale     float64
+	}{
+		{maxPixels: 64, size: 8, scale: 4},
+		{maxPixels: 20, size: 4, scale: 2},
+		{maxPixels: 1, size: 1, scale: 0.5},
+	} {
+		req := mcp.CallToolRequest{}
+		req.Params.Arguments = map[string]any{"file": "demo.sprite", "max_pixels": tc.maxPixels}
+		result, err := ctx.handlePreviewSprite(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, info := previewImage(t, result)
+		if info.Width != tc.size || info.Height != tc.size || info.Scale != tc.scale {
+			t.Errorf("max_pixels %d: got %dx%d at scale %v, want %dx%d at scale %v",
+				tc.maxPixels, info.Width, info.Height, info.Scale, tc.size, tc.size, tc.scale)
+		}
+		if (info.Warning != "") != (tc.scale < 4) {
+			t.Errorf("max_pixels %d: warning = %q", tc.maxPixels, info.Warning)
+		}
+		if info.Region != nil {
+			t.Errorf("max_pixels %d: sprite preview has a region", tc.maxPixels)
+		}
+	}
+}
+
 func TestHandleInspectMap(t *testing.T) {
 	ctx, _ := setupTestProject(t)
 
@@ -191,8 +572,8 @@ func TestHandleInspectMap(t *testing.T) {
 		t.Fatalf("invalid JSON: %v", err)
 	}
 
-	if data["tile_size"].(float64) != 16 {
-		t.Errorf("expected tile_size 16, got: %v", data["tile_size"])
+	if data["tile_size"].(float64) != 2 {
+		t.Errorf("expected tile_size 2, got: %v", data["tile_size"])
 	}
 }
 
@@ -221,6 +602,58 @@ func TestHandleInspectAudio(t *testing.T) {
 	}
 }
 
+func TestHandleInspectAudio_Pattern(t *testing.T) {
+	ctx, dir := setupTestProject(t)
+	os.WriteFile(filepath.Join(dir, "assets/instruments/lead.inst"), []byte("name = \"lead\"\n[oscillator]\nwaveform = \"square\"\n[envelope]\nsustain = 1\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "assets/tracks/bgm.track"), []byte(`tempo = 120
+ticks_per_beat = 4
+[[channel]]
+name = "m"
+instrument = "lead"
+volume = 1
+[pattern.intro]
+data = """
+m
+...
+"""
+[pattern.verse]
+data = """
+m
+A4
+---
+"""
+[song]
+sequence = ["intro", "verse"]
+`), 0644)
+
+	call := func(args map[string]any) *mcp.CallToolResult {
+		req := mcp.CallToolRequest{}
+		req.Params.Arguments = args
+		result, err := ctx.handleInspectAudio(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	result := call(map[string]any{"file": "bgm.track", "pattern": "verse"})
+	text := result.Content[0].(mcp.TextContent).Text
+	var data map[string]any
+	if err := json.Unmarshal([]byte(text), &data); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, text)
+	}
+	if data["type"] != "pattern" || data["ticks"].(float64) != 2 || data["peak"].(float64) == 0 {
+		t.Errorf("verse report = %v", data)
+	}
+
+	if result := call(map[string]any{"file": "bgm.track", "pattern": "chorus"}); !result.IsError {
+		t.Error("unknown pattern should be an error result")
+	}
+	if result := call(map[string]any{"file": "test.sfx", "pattern": "verse"}); !result.IsError {
+		t.Error("pattern on an .sfx should be an error result")
+	}
+}
+
 func TestHandleListAssets(t *testing.T) {
 	ctx, _ := setupTestProject(t)
 
@@ -244,6 +677,130 @@ func TestHandleListAssets(t *testing.T) {
 	}
 }
 
+func TestHandleListAssets_Paging(t *testing.T) {
+	ctx, dir := setupTestProject(t)
+	for _, name := range []string{"enemy_bat", "Enemy_slime", "hero", "enemy_boss"} {
+		os.WriteFile(filepath.Join(dir, "assets/sprites", name+".sprite"), []byte("palette = \"default\"\n"), 0644)
+	}
+
+	call := func(args map[string]any) (map[string]any, bool) {
+		t.Helper()
+		req := mcp.CallToolRequest{}
+		req.Params.Arguments = args
+		result, err := ctx.handleListAssets(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var data map[string]any
+		if err := json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &data); err != nil {
+			t.Fatal(err)
+		}
+		return data, result.IsError
+	}
+	paths := func(data map[string]any) []string {
+		var out []string
+		for _, a := range data["assets"].([]any) {
+			e := a.(map[string]any)
+			out = append(out, e["dir"].(string)+"/"+e["file"].(string))
+		}
+		return out
+	}
+
+	all, _ := call(nil)
+	want := []string{
+		"maps/demo.map",
+		"palettes/default.palette",
+		"sfx/test.sfx",
+		"sprites/Enemy_slime.sprite",
+		"sprites/demo.sprite",
+		"sprites/enemy_bat.sprite",
+		"sprites/enemy_boss.sprite",
+		"sprites/hero.sprite",
+	}
+	if got := paths(all); !slices.Equal(got, want) {
+		t.Fatalf("listing = %q, want %q", got, want)
+	}
+	first := all["assets"].([]any)[0].(map[string]any)
+	if first["size"].(float64) == 0 || first["mtime"] == "" {
+		t.Errorf("entry lacks size or mtime: %v", first)
+	}
+
+	enemies, _ := call(map[string]any{"type": "sprite", "name_contains": "ENEMY"})
+	if got := paths(enemies); len(got) != 3 || enemies["total"].(float64) != 3 {
+		t.Errorf("name_contains enemy = %q", got)
+	}
+
+	// Paging two at a time walks the same listing.
+	var paged []string
+	args := map[string]any{"limit": 2}
+	for range len(want) {
+		page, isErr := call(args)
+		if isErr {
+			t.Fatalf("page after %v failed: %v", args["cursor"], page)
+		}
+		if page["total"].(float64) != float64(len(want)) {
+			t.Errorf("total = %v, want %d", page["total"], len(want))
+		}
+		paged = append(paged, paths(page)...)
+		next, ok := page["next_cursor"].(string)
+		if !ok {
+			break
+		}
+		args = map[string]any{"limit": 2, "cursor": next}
+	}
+	if !slices.Equal(paged, want) {
+		t.Errorf("paged listing = %q, want %q", paged, want)
+	}
+
+	for _, args := range []map[string]any{{"limit": -1}, {"cursor": "nonsense"}} {
+		if _, isErr := call(args); !isErr {
+			t.Errorf("%v should be an error result", args)
+		}
+	}
+}
+
+func TestHandleListAssets_Include(t *testing.T) {
+	ctx, _ := setupTestProject(t)
+	pack := filepath.Join(t.TempDir(), "forest")
+	os.MkdirAll(filepath.Join(pack, "assets/sprites"), 0755)
+	os.MkdirAll(filepath.Join(pack, "assets/palettes"), 0755)
+	os.WriteFile(filepath.Join(pack, "assets/sprites/tree.sprite"), []byte("palette = \"forest\"\n"), 0644)
+	os.WriteFile(filepath.Join(pack, "assets/sprites/demo.sprite"), []byte("palette = \"forest\"\n"), 0644)
+	os.WriteFile(filepath.Join(pack, "assets/palettes/forest.palette"), []byte("name = \"forest\"\n[colors]\ng = \"#228822\"\n"), 0644)
+	ctx.Config.Include = []config.IncludeEntry{{Path: pack}}
+
+	req := mcp.CallToolRequest{}
+	req.Params.Arguments = map[string]any{"type": "sprite"}
+	result, err := ctx.handleListAssets(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data struct{ Assets []assetEntry }
+	if err := json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &data); err != nil {
+		t.Fatal(err)
+	}
+	// The project's demo.sprite shadows the pack's.
+	want := []assetEntry{{File: "demo.sprite"}, {File: "tree.sprite", Include: pack}}
+	if len(data.Assets) != len(want) {
+		t.Fatalf("assets = %+v, want %+v", data.Assets, want)
+	}
+	for i, w := range want {
+		if got := data.Assets[i]; got.File != w.File || got.Include != w.Include {
+			t.Errorf("asset %d = %s from %q, want %s from %q", i, got.File, got.Include, w.File, w.Include)
+		}
+	}
+
+	// Reading tools find included files too.
+	req.Params.Arguments = map[string]any{"file": "forest.palette"}
+	result, err = ctx.handlePaletteColors(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.IsError {
+		t.Errorf("palette_colors of an included palette: %v", result.Content)
+	}
+}
+
 func TestHandlePaletteColors(t *testing.T) {
 	ctx, _ := setupTestProject(t)
 
@@ -265,6 +822,21 @@ func TestHandlePaletteColors(t *testing.T) {
 	if colors["r"] != "#ff0000" {
 		t.Errorf("expected red=#ff0000, got: %v", colors["r"])
 	}
+	if aliases := data["aliases"].(map[string]any); len(aliases) != 0 {
+		t.Errorf("aliases = %v, want none", aliases)
+	}
+
+	palPath := filepath.Join(ctx.ProjectRoot, "assets/palettes/default.palette")
+	pal, _ := os.ReadFile(palPath)
+	os.WriteFile(palPath, append(pal, "[aliases]\nblood = \"r\"\n"...), 0644)
+	result, err = ctx.handlePaletteColors(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &data)
+	if alias := data["aliases"].(map[string]any)["blood"]; !reflect.DeepEqual(alias, map[string]any{"target": "r", "color": "#ff0000"}) {
+		t.Errorf("alias blood = %v, want r, #ff0000", alias)
+	}
 }
 
 func TestHandleFormatHelp(t *testing.T) {
@@ -286,6 +858,145 @@ func TestHandleFormatHelp(t *testing.T) {
 	}
 }
 
+// TestFormatDocs_ExamplesParse keeps the example in each format doc valid:
+// agents copy them.
+func TestFormatDocs_ExamplesParse(t *testing.T) {
+	for format, doc := range formatDocs {
+		_, rest, _ := strings.Cut(doc, "```toml\n")
+		example, _, ok := strings.Cut(rest, "```")
+		if !ok {
+			t.Errorf("%s: no TOML example", format)
+			continue
+		}
+		data := []byte(example)
+		var err error
+		switch format {
+		case "palette":
+			_, err = palette.ParsePalette(data, "example.palette")
+		case "sprite":
+			var sf *sprite.SpriteFile
+			if sf, err = sprite.ParseSpriteFile(data, "example.sprite"); err == nil {
+				for _, sp := range sf.Sprites {
+					if sp.Name == "coin" && len(sp.Frames) != 2 {
+						t.Errorf("sprite example: coin has %d frames, want 2", len(sp.Frames))
+					}
+				}
+			}
+		case "map":
+			_, _, err = tilemap.ParseMapFile(data, "example.map")
+		case "instrument":
+			// Fields in the wrong table are ignored, not rejected, so
+			// check that they arrived.
+			var inst *instrument.Instrument
+			if inst, err = instrument.ParseInstrument(data, "example.inst"); err == nil {
+				if inst.Oscillator.Waveform != "square" || inst.Oscillator.DutyCycle != 0.25 || inst.Filter == nil {
+					t.Errorf("instrument example parsed as %+v", inst)
+				}
+			}
+		case "sfx":
+			_, err = sfx.ParseSFX(data, "example.sfx")
+		case "track":
+			_, err = track.ParseTrack(data, "example.track")
+		default:
+			t.Errorf("%s: no parser to check the example with", format)
+		}
+		if err != nil {
+			t.Errorf("%s example: %v", format, err)
+		}
+	}
+}
+
+// parserFiles are the sources of each format's parser, relative to this
+// package.
+var parserFiles = map[string][]string{
+	"palette":    {"../palette/palette.go"},
+	"sprite":     {"../sprite/sprite.go", "../sprite/region.go"},
+	"map":        {"../tilemap/tilemap.go"},
+	"instrument": {"../instrument/instrument.go"},
+	"sfx":        {"../sfx/sfx.go"},
+	"track":      {"../track/track.go", "../track/pattern.go"},
+}
+
+// errorPattern turns an error format string into a regexp matching the
+// messages it prints.
+func errorPattern(format string) *regexp.Regexp {
+	verbs := strings.NewReplacer(
+		"%q", `"(?:[^"\\]|\\.)*"`,
+		"%d", `-?\d+`,
+		"%s", `.+?`,
+		"%v", `.+?`,
+		"%T", `.+?`,
+		"%g", `.+?`,
+		"%w", `.+`,
+		"%%", `%`,
+	)
+	return regexp.MustCompile(verbs.Replace(regexp.QuoteMeta(format)))
+}
+
+// TestFormatErrors_CoverParsers checks that every error a parser writes
+// out in full has an example in formatErrors. Errors that end in %w only
+// add context to another error and are skipped.
+func TestFormatErrors_CoverParsers(t *testing.T) {
+	for format, files := range parserFiles {
+		for _, file := range files {
+			fset := token.NewFileSet()
+			f, err := parser.ParseFile(fset, file, nil, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ast.Inspect(f, func(n ast.Node) bool {
+				call, ok := n.(*ast.CallExpr)
+				if !ok || len(call.Args) == 0 {
+					return true
+				}
+				sel, ok := call.Fun.(*ast.SelectorExpr)
+				if !ok {
+					return true
+				}
+				pkg, ok := sel.X.(*ast.Ident)
+				if !ok || !(pkg.Name == "fmt" && sel.Sel.Name == "Errorf" || pkg.Name == "errors" && sel.Sel.Name == "New") {
+					return true
+				}
+				lit, ok := call.Args[0].(*ast.BasicLit)
+				if !ok {
+					return true
+				}
+				msg, _ := strconv.Unquote(lit.Value)
+				msg = strings.TrimPrefix(msg, "%s: ")
+				if strings.HasSuffix(msg, "%w") || msg == "%s" {
+					return true
+				}
+				re := errorPattern(msg)
+				if !slices.ContainsFunc(formatErrors[format], func(e formatError) bool { return re.MatchString(e.Message) }) {
+					t.Errorf("%s: %q has no example in formatErrors[%q]", fset.Position(lit.Pos()), msg, format)
+				}
+				return true
+			})
+		}
+	}
+}
+
+func TestFormatDocResources(t *testing.T) {
+	ctx, _ := setupTestProject(t)
+	s := server.NewMCPServer("runefact", "test", server.WithResourceCapabilities(false, false))
+	registerResources(s, ctx)
+
+	msg := `{"jsonrpc": "2.0", "id": 1, "method": "resources/read", "params": {"uri": "runefact://docs/sprite"}}`
+	resp, ok := s.HandleMessage(context.Background(), []byte(msg)).(mcp.JSONRPCResponse)
+	if !ok {
+		t.Fatal("resources/read failed")
+	}
+	contents := resp.Result.(mcp.ReadResourceResult).Contents
+	text := contents[0].(mcp.TextResourceContents)
+	want, _ := formatDoc("sprite")
+	if text.MIMEType != "text/markdown" || text.Text != want {
+		t.Errorf("runefact://docs/sprite = %s %q", text.MIMEType, text.Text)
+	}
+	if !strings.Contains(want, "## Common errors") || !strings.Contains(want, "frame 2 is empty") {
+		t.Error("sprite doc lacks its common errors")
+	}
+}
+
 func TestHandleProjectStatus(t *testing.T) {
 	ctx, _ := setupTestProject(t)
 
@@ -307,6 +1018,79 @@ func TestHandleProjectStatus(t *testing.T) {
 	}
 }
 
+func TestHandleProjectStatus_Freshness(t *testing.T) {
+	ctx, _ := setupTestProject(t)
+
+	readStatus := func() map[string]any {
+		t.Helper()
+		contents, err := ctx.handleProjectStatus(context.Background(), mcp.ReadResourceRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var data map[string]any
+		if err := json.Unmarshal([]byte(contents[0].(mcp.TextResourceContents).Text), &data); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		return data
+	}
+
+	before := readStatus()
+	if stale, _ := before["stale"].([]any); len(stale) != 3 {
+		t.Errorf("before build: stale = %v, want 3 entries", before["stale"])
+	}
+	if before["last_build"] != nil {
+		t.Errorf("before build: last_build = %v, want null", before["last_build"])
+	}
+
+	req := mcp.CallToolRequest{}
+	req.Params.Arguments = map[string]any{"scope": "all"}
+	if _, err := ctx.handleBuild(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+
+	after := readStatus()
+	if stale, _ := after["stale"].([]any); len(stale) != 0 {
+		t.Errorf("after build: stale = %v, want none", after["stale"])
+	}
+	lb, ok := after["last_build"].(map[string]any)
+	if !ok {
+		t.Fatalf("after build: last_build missing: %v", after)
+	}
+	if lb["success"] != true || lb["errors"] != float64(0) {
+		t.Errorf("last_build = %v, want success with 0 errors", lb)
+	}
+	if m, _ := after["manifest"].(map[string]any); m["exists"] != true || m["modified"] == nil {
+		t.Errorf("manifest = %v, want exists with modified time", after["manifest"])
+	}
+}
+
+func TestHandleManifest_JSON(t *testing.T) {
+	ctx, _ := setupTestProject(t)
+	ctx.Config.Project.ManifestJSON = true
+
+	req := mcp.CallToolRequest{}
+	req.Params.Arguments = map[string]any{"scope": "all"}
+	if _, err := ctx.handleBuild(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+
+	contents, err := ctx.handleManifest(context.Background(), mcp.ReadResourceRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := contents[0].(mcp.TextResourceContents)
+	if res.MIMEType != "application/json" {
+		t.Errorf("MIME type = %q, want application/json", res.MIMEType)
+	}
+	want, err := os.ReadFile(filepath.Join(ctx.ProjectRoot, "build/assets/manifest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Text != string(want) {
+		t.Error("resource text differs from manifest.json on disk")
+	}
+}
+
 func TestErrorResult(t *testing.T) {
 	result, err := errorResult("something went wrong")
 	if err != nil {
@@ -316,3 +1100,447 @@ func TestErrorResult(t *testing.T) {
 		t.Error("expected IsError=true")
 	}
 }
+
+func TestHandleNewAsset(t *testing.T) {
+	ctx, dir := setupTestProject(t)
+
+	tests := []struct {
+		typ  string
+		args map[string]any
+		path string
+	}{
+		{"palette", nil, "assets/palettes/extra.palette"},
+		{"sprite", map[string]any{"grid": float64(8)}, "assets/sprites/extra.sprite"},
+		{"map", nil, "assets/maps/extra.map"},
+		{"instrument", nil, "assets/instruments/extra.inst"},
+		{"sfx", map[string]any{"duration": 0.5}, "assets/sfx/extra.sfx"},
+		// Not "extra": an sfx and a track of the same name would both write
+		// audio/extra.wav.
+		{"track", map[string]any{"channels": float64(3)}, "assets/tracks/theme.track"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.typ, func(t *testing.T) {
+			req := mcp.CallToolRequest{}
+			name := strings.TrimSuffix(filepath.Base(tt.path), filepath.Ext(tt.path))
+			args := map[string]any{"type": tt.typ, "name": name}
+			for k, v := range tt.args {
+				args[k] = v
+			}
+			req.Params.Arguments = args
+
+			result, err := ctx.handleNewAsset(context.Background(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			text := result.Content[0].(mcp.TextContent).Text
+			if result.IsError {
+				t.Fatalf("unexpected error: %s", text)
+			}
+			var data map[string]any
+			if err := json.Unmarshal([]byte(text), &data); err != nil {
+				t.Fatalf("invalid JSON: %v", err)
+			}
+			if data["path"] != tt.path {
+				t.Errorf("path = %v, want %s", data["path"], tt.path)
+			}
+			if _, err := os.Stat(filepath.Join(dir, tt.path)); err != nil {
+				t.Errorf("file not written: %v", err)
+			}
+			if _, ok := data["summary"].(map[string]any); !ok {
+				t.Errorf("missing summary: %s", text)
+			}
+		})
+	}
+
+	// The project must still validate with all new assets in place.
+	vreq := mcp.CallToolRequest{}
+	vreq.Params.Arguments = map[string]any{}
+	vres, err := ctx.handleValidate(context.Background(), vreq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vdata map[string]any
+	if err := json.Unmarshal([]byte(vres.Content[0].(mcp.TextContent).Text), &vdata); err != nil {
+		t.Fatal(err)
+	}
+	if vdata["valid"] != true {
+		t.Errorf("project invalid after creating assets: %v", vdata)
+	}
+}
+
+func TestHandleNewAsset_RefusesOverwrite(t *testing.T) {
+	ctx, dir := setupTestProject(t)
+	path := filepath.Join(dir, "assets/sprites/demo.sprite")
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := mcp.CallToolRequest{}
+	req.Params.Arguments = map[string]any{"type": "sprite", "name": "demo"}
+	result, err := ctx.handleNewAsset(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.IsError {
+		t.Fatal("expected error when the file already exists")
+	}
+
+	after, _ := os.ReadFile(path)
+	if string(after) != string(before) {
+		t.Error("existing file was modified")
+	}
+}
+
+func TestHandleNewAsset_InvalidName(t *testing.T) {
+	ctx, _ := setupTestProject(t)
+
+	req := mcp.CallToolRequest{}
+	req.Params.Arguments = map[string]any{"type": "sprite", "name": "../escape"}
+	result, err := ctx.handleNewAsset(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.IsError {
+		t.Fatal("expected error for a name containing a path")
+	}
+}
+
+func TestHandleNewAsset_InvalidPalette(t *testing.T) {
+	ctx, dir := setupTestProject(t)
+
+	req := mcp.CallToolRequest{}
+	req.Params.Arguments = map[string]any{"type": "sprite", "name": "hero", "palette": "a\"b\u00e9"}
+	result, err := ctx.handleNewAsset(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.IsError || !strings.Contains(result.Content[0].(mcp.TextContent).Text, "invalid palette") {
+		t.Fatalf("result = %v, want the palette name rejected", result.Content)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "assets/sprites/hero.sprite")); !os.IsNotExist(err) {
+		t.Error("file should not be created for an invalid palette")
+	}
+}
+
+func TestHandleNewAsset_ReadOnly(t *testing.T) {
+	ctx, dir := setupTestProject(t)
+	ctx.ReadOnly = true
+
+	req := mcp.CallToolRequest{}
+	req.Params.Arguments = map[string]any{"type": "sfx", "name": "blip"}
+	result, err := ctx.handleNewAsset(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.IsError {
+		t.Fatal("expected error in read-only mode")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "assets/sfx/blip.sfx")); !os.IsNotExist(err) {
+		t.Error("file should not be created in read-only mode")
+	}
+}
+
+func TestHandleBuild_ReadOnly(t *testing.T) {
+	ctx, dir := setupTestProject(t)
+	ctx.ReadOnly = true
+
+	req := mcp.CallToolRequest{}
+	req.Params.Arguments = map[string]any{"scope": "all"}
+	result, err := ctx.handleBuild(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.IsError {
+		t.Fatal("expected read-only error")
+	}
+
+	var data map[string]any
+	if err := json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &data); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if data["read_only"] != true {
+		t.Errorf("read_only = %v, want true", data["read_only"])
+	}
+	if alt, _ := data["alternative"].(string); !strings.Contains(alt, "runefact_validate") {
+		t.Errorf("alternative should point at runefact_validate, got %q", alt)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "build")); !os.IsNotExist(err) {
+		t.Error("build output must not be written in read-only mode")
+	}
+
+	// Read-only tools keep working.
+	vres, err := ctx.handleValidate(context.Background(), mcp.CallToolRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vres.IsError {
+		t.Error("validate should work in read-only mode")
+	}
+}
+
+func TestPathSandbox(t *testing.T) {
+	ctx, dir := setupTestProject(t)
+
+	outside := t.TempDir()
+	secret := `palette = "default"
+grid = 1
+[sprite.x]
+pixels = "r"
+`
+	if err := os.WriteFile(filepath.Join(outside, "secret.sprite"), []byte(secret), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		file string
+	}{
+		{"dot-dot", "../../../" + filepath.Base(outside) + "/secret.sprite"},
+		{"absolute", filepath.Join(outside, "secret.sprite")},
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "assets/sprites/link")); err == nil {
+		tests = append(tests, struct {
+			name string
+			file string
+		}{"symlink", "link/secret.sprite"})
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := mcp.CallToolRequest{}
+			req.Params.Arguments = map[string]any{"file": tt.file}
+			result, err := ctx.handleInspectSprite(context.Background(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !result.IsError {
+				t.Errorf("expected %q to be rejected", tt.file)
+			}
+		})
+	}
+
+	req := mcp.CallToolRequest{}
+	req.Params.Arguments = map[string]any{"files": []any{"../../etc/passwd"}}
+	result, err := ctx.handleValidate(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.IsError {
+		t.Error("expected validate to reject a files entry outside the project")
+	}
+}
+
+// checkSchema returns where v, decoded JSON, breaks schema. It covers the
+// parts of JSON Schema the output schemas use. An object may only hold
+// the properties its schema lists, so a field added to a response without
+// documenting it is caught.
+func checkSchema(path string, schema map[string]any, v any) []string {
+	if alts, ok := schema["oneOf"].([]any); ok {
+		matches := 0
+		for _, alt := range alts {
+			if len(checkSchema(path, alt.(map[string]any), v)) == 0 {
+				matches++
+			}
+		}
+		if matches != 1 {
+			return []string{fmt.Sprintf("%s: matches %d of oneOf, want 1", path, matches)}
+		}
+		return nil
+	}
+	if c, ok := schema["const"]; ok && v != c {
+		return []string{fmt.Sprintf("%s: %v, want %v", path, v, c)}
+	}
+	if enum, ok := schema["enum"].([]any); ok && !slices.Contains(enum, v) {
+		return []string{fmt.Sprintf("%s: %v not in %v", path, v, enum)}
+	}
+
+	var errs []string
+	switch schema["type"] {
+	case "string":
+		if _, ok := v.(string); !ok {
+			errs = append(errs, fmt.Sprintf("%s: %v is not a string", path, v))
+		}
+	case "integer":
+		if n, ok := v.(float64); !ok || n != math.Trunc(n) {
+			errs = append(errs, fmt.Sprintf("%s: %v is not an integer", path, v))
+		}
+	case "number":
+		if _, ok := v.(float64); !ok {
+			errs = append(errs, fmt.Sprintf("%s: %v is not a number", path, v))
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			errs = append(errs, fmt.Sprintf("%s: %v is not a boolean", path, v))
+		}
+	case "array":
+		a, ok := v.([]any)
+		if !ok {
+			return append(errs, fmt.Sprintf("%s: %v is not an array", path, v))
+		}
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, e := range a {
+				errs = append(errs, checkSchema(fmt.Sprintf("%s[%d]", path, i), items, e)...)
+			}
+		}
+	case "object":
+		o, ok := v.(map[string]any)
+		if !ok {
+			return append(errs, fmt.Sprintf("%s: %v is not an object", path, v))
+		}
+		req, _ := schema["required"].([]any)
+		for _, r := range req {
+			if _, ok := o[r.(string)]; !ok {
+				errs = append(errs, fmt.Sprintf("%s: missing %s", path, r))
+			}
+		}
+		props, hasProps := schema["properties"].(map[string]any)
+		extra, hasExtra := schema["additionalProperties"].(map[string]any)
+		for k, e := range o {
+			switch {
+			case props[k] != nil:
+				errs = append(errs, checkSchema(path+"."+k, props[k].(map[string]any), e)...)
+			case hasExtra:
+				errs = append(errs, checkSchema(path+"."+k, extra, e)...)
+			case hasProps:
+				errs = append(errs, fmt.Sprintf("%s: %s is not in the schema", path, k))
+			}
+		}
+	}
+	return errs
+}
+
+func TestToolOutputSchemas(t *testing.T) {
+	ctx, dir := setupTestProject(t)
+	os.WriteFile(filepath.Join(dir, "assets/instruments/lead.inst"), []byte("name = \"lead\"\n[oscillator]\nwaveform = \"square\"\n[envelope]\nsustain = 1\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "assets/tracks/bgm.track"), []byte(`tempo = 120
+ticks_per_beat = 4
+[[channel]]
+name = "m"
+instrument = "lead"
+volume = 1
+[pattern.verse]
+data = """
+m
+A4
+"""
+[song]
+sequence = ["verse"]
+`), 0644)
+	// An unknown tileset key gives a warning with cells, and a missing
+	// palette an error.
+	os.WriteFile(filepath.Join(dir, "assets/maps/stray.map"), []byte("tile_size = 2\n[tileset]\ng = \"demo:test\"\n[layer.bg]\npixels = \"\"\"\ngx\nxg\n\"\"\"\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "assets/sprites/broken.sprite"), []byte("palette = \"nope\"\n[sprite.a]\npixels = \"\"\"\nr\n\"\"\"\n"), 0644)
+
+	s := server.NewMCPServer("runefact", "test")
+	registerTools(s, ctx)
+
+	calls := []struct {
+		tool string
+		args map[string]any
+	}{
+		{"runefact_validate", nil},
+		{"runefact_build", nil},
+		{"runefact_inspect_sprite", map[string]any{"file": "demo.sprite"}},
+		{"runefact_inspect_map", map[string]any{"file": "stray.map"}},
+		{"runefact_inspect_audio", map[string]any{"file": "test.sfx"}},
+		{"runefact_inspect_audio", map[string]any{"file": "bgm.track"}},
+		{"runefact_inspect_audio", map[string]any{"file": "bgm.track", "pattern": "verse"}},
+		{"runefact_list_assets", nil},
+		{"runefact_list_assets", map[string]any{"type": "palette"}},
+		{"runefact_list_assets", map[string]any{"limit": 1}},
+		{"runefact_palette_colors", map[string]any{"file": "default.palette"}},
+	}
+	for _, typ := range []string{"palette", "sprite", "map", "instrument", "sfx", "track"} {
+		calls = append(calls, struct {
+			tool string
+			args map[string]any
+		}{"runefact_new_asset", map[string]any{"type": typ, "name": "fresh"}})
+	}
+
+	covered := map[string]bool{}
+	for _, c := range calls {
+		st := s.GetTool(c.tool)
+		if st == nil {
+			t.Fatalf("%s is not registered", c.tool)
+		}
+		covered[c.tool] = true
+		var schema map[string]any
+		if err := json.Unmarshal(st.Tool.RawOutputSchema, &schema); err != nil {
+			t.Fatalf("%s: output schema: %v", c.tool, err)
+		}
+
+		req := mcp.CallToolRequest{}
+		req.Params.Arguments = c.args
+		res, err := st.Handler(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		text := res.Content[0].(mcp.TextContent).Text
+		if res.IsError {
+			t.Fatalf("%s %v failed: %s", c.tool, c.args, text)
+		}
+
+		var fromText, structured any
+		if err := json.Unmarshal([]byte(text), &fromText); err != nil {
+			t.Fatalf("%s: invalid JSON: %v", c.tool, err)
+		}
+		b, err := json.Marshal(res.StructuredContent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		json.Unmarshal(b, &structured)
+		if !reflect.DeepEqual(fromText, structured) {
+			t.Errorf("%s: structured content differs from text", c.tool)
+		}
+		for _, e := range checkSchema(c.tool, schema, structured) {
+			t.Errorf("%s %v: %s", c.tool, c.args, e)
+		}
+	}
+
+	// Tools that return markdown or images declare no output schema.
+	for name, st := range s.ListTools() {
+		if st.Tool.RawOutputSchema != nil && !covered[name] {
+			t.Errorf("%s has an output schema but no response is checked against it", name)
+		}
+	}
+}
+
+func TestToolAnnotations(t *testing.T) {
+	ctx, _ := setupTestProject(t)
+	s := server.NewMCPServer("runefact", "test")
+	registerTools(s, ctx)
+
+	writers := map[string]bool{"runefact_build": true, "runefact_new_asset": true, "runefact_validate": true}
+	for name, st := range s.ListTools() {
+		a := st.Tool.Annotations
+		if a.ReadOnlyHint == nil || a.IdempotentHint == nil || a.DestructiveHint == nil || a.OpenWorldHint == nil {
+			t.Errorf("%s: annotations incomplete: %+v", name, a)
+			continue
+		}
+		if *a.ReadOnlyHint == writers[name] {
+			t.Errorf("%s: readOnlyHint = %v", name, *a.ReadOnlyHint)
+		}
+		if *a.OpenWorldHint {
+			t.Errorf("%s: works on the local project only", name)
+		}
+	}
+	build := s.GetTool("runefact_build").Tool.Annotations
+	if *build.IdempotentHint || !*build.DestructiveHint {
+		t.Errorf("runefact_build should be destructive and not idempotent: %+v", build)
+	}
+	if *s.GetTool("runefact_new_asset").Tool.Annotations.DestructiveHint {
+		t.Error("runefact_new_asset refuses to overwrite, so it isn't destructive")
+	}
+	if v := s.GetTool("runefact_validate").Tool.Annotations; *v.DestructiveHint || !*v.IdempotentHint {
+		t.Errorf("runefact_validate only updates its cache: %+v", v)
+	}
+
+	// A read-only server's validate writes nothing.
+	ctx.ReadOnly = true
+	s = server.NewMCPServer("runefact", "test")
+	registerTools(s, ctx)
+	if !*s.GetTool("runefact_validate").Tool.Annotations.ReadOnlyHint {
+		t.Error("runefact_validate on a read-only server should be read-only")
+	}
+}
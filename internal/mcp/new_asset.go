@@ -0,0 +1,120 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/vgalaktionov/runefact/internal/instrument"
+	"github.com/vgalaktionov/runefact/internal/scaffold"
+)
+
+func (ctx *ServerContext) handleNewAsset(c context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	if ctx.ReadOnly {
+		return readOnlyResult("runefact_new_asset")
+	}
+
+	typ, err := req.RequireString("type")
+	if err != nil {
+		return errorResult("type parameter required")
+	}
+	name, err := req.RequireString("name")
+	if err != nil {
+		return errorResult("name parameter required")
+	}
+
+	kind, ok := scaffold.AssetKinds[typ]
+	if !ok {
+		return errorResult(fmt.Sprintf("unknown asset type: %s", typ))
+	}
+	name = strings.TrimSuffix(name, kind.Ext)
+
+	params := scaffold.AssetParams{
+		Grid:     req.GetInt("grid", ctx.Config.Defaults.SpriteSize),
+		Palette:  req.GetString("palette", "default"),
+		Channels: req.GetInt("channels", 1),
+		Duration: req.GetFloat("duration", 0.2),
+	}
+	if err := scaffold.CheckAsset(name, params); err != nil {
+		return errorResult(err.Error())
+	}
+	if typ == "track" {
+		params.Instrument = scaffold.FirstInstrument(filepath.Join(ctx.ProjectRoot, "assets", "instruments"))
+	}
+
+	file := name + kind.Ext
+	path, err := ctx.assetPath(kind.Dir, file)
+	if err != nil {
+		return errorResult(err.Error())
+	}
+	err = scaffold.WriteAsset(path, scaffold.Asset(typ, name, params))
+	if errors.Is(err, os.ErrExist) {
+		return errorResult(fmt.Sprintf("%s already exists; refusing to overwrite", filepath.ToSlash(filepath.Join("assets", kind.Dir, file))))
+	}
+	if err != nil {
+		return errorResult(fmt.Sprintf("writing %s: %v", file, err))
+	}
+
+	summary, err := ctx.summarizeAsset(c, typ, file, path)
+	if err != nil {
+		os.Remove(path)
+		return errorResult(fmt.Sprintf("%s failed to parse and was removed: %v", file, err))
+	}
+
+	return jsonResult(map[string]any{
+		"path":    filepath.ToSlash(filepath.Join("assets", kind.Dir, file)),
+		"type":    typ,
+		"summary": summary,
+	})
+}
+
+// summarizeAsset returns the same JSON shape the matching inspect tool
+// produces for the file.
+func (ctx *ServerContext) summarizeAsset(c context.Context, typ, file, path string) (map[string]any, error) {
+	if typ == "instrument" {
+		inst, err := instrument.LoadInstrument(path)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{
+			"file":     file,
+			"name":     inst.Name,
+			"waveform": inst.Oscillator.Waveform,
+			"envelope": map[string]float64{
+				"attack":  inst.Envelope.Attack,
+				"decay":   inst.Envelope.Decay,
+				"sustain": inst.Envelope.Sustain,
+				"release": inst.Envelope.Release,
+			},
+		}, nil
+	}
+
+	handlers := map[string]func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error){
+		"palette": ctx.handlePaletteColors,
+		"sprite":  ctx.handleInspectSprite,
+		"map":     ctx.handleInspectMap,
+		"sfx":     ctx.handleInspectAudio,
+		"track":   ctx.handleInspectAudio,
+	}
+	req := mcp.CallToolRequest{}
+	req.Params.Arguments = map[string]any{"file": file}
+	res, err := handlers[typ](c, req)
+	if err != nil {
+		return nil, err
+	}
+	text := res.Content[0].(mcp.TextContent).Text
+	var summary map[string]any
+	if err := json.Unmarshal([]byte(text), &summary); err != nil {
+		return nil, err
+	}
+	if res.IsError {
+		return nil, fmt.Errorf("%v", summary["error"])
+	}
+	return summary, nil
+}
@@ -4,15 +4,18 @@ import (
 	"bytes"
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"image"
 	"image/color"
 	"image/png"
+	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/mark3labs/mcp-go/mcp"
 
+	"github.com/vgalaktionov/runefact/internal/export"
 	"github.com/vgalaktionov/runefact/internal/palette"
 	"github.com/vgalaktionov/runefact/internal/sprite"
 	"github.com/vgalaktionov/runefact/internal/tilemap"
@@ -32,81 +35,58 @@ func (ctx *ServerContext) handlePreviewMap(_ context.Context, req mcp.CallToolRe
 	if scale > 8 {
 		scale = 8
 	}
-
-	assetsDir := filepath.Join(ctx.ProjectRoot, "assets")
+	maxPixels, err := previewMaxPixels(req)
+	if err != nil {
+		return errorResult(err.Error())
+	}
 
 	// Load map.
-	mapPath := filepath.Join(assetsDir, "maps", file)
+	mapPath, err := ctx.findAsset("maps", file)
+	if err != nil {
+		return errorResult(err.Error())
+	}
 	mf, _, err := tilemap.LoadMapFile(mapPath)
 	if err != nil {
 		return errorResult(fmt.Sprintf("loading %s: %v", file, err))
 	}
 
-	// Find map dimensions from tile layers.
-	mapW, mapH := 0, 0
-	for _, l := range mf.Layers {
-		if l.Type == "tile" && len(l.Data) > 0 {
-			if len(l.Data) > mapH {
-				mapH = len(l.Data)
-			}
-			if len(l.Data[0]) > mapW {
-				mapW = len(l.Data[0])
-			}
-		}
-	}
-
+	mapW, mapH := mf.Size()
 	if mapW == 0 || mapH == 0 {
 		return errorResult("map has no tile data")
 	}
 
-	ts := mf.TileSize
-
-	// Load tile and entity sprites.
-	spriteLoader := newSpriteLoader(assetsDir)
-	tileImages := spriteLoader.loadTileSprites(mf)
-	entityImages := spriteLoader.loadEntitySprites(mf)
-
-	// Create output image.
-	imgW := mapW * ts * scale
-	imgH := mapH * ts * scale
-	img := image.NewRGBA(image.Rect(0, 0, imgW, imgH))
-
-	// Render tile layers bottom-up.
-	for _, layer := range mf.Layers {
-		if layer.Type != "tile" {
-			continue
-		}
-		for y, row := range layer.Data {
-			for x, tileID := range row {
-				if tileID == 0 {
-					continue
-				}
-				tileImg, ok := tileImages[tileID]
-				if !ok {
-					continue
-				}
-				drawScaled(img, tileImg, x*ts*scale, y*ts*scale, ts, scale)
-			}
-		}
+	region, err := parseRegion(req.GetArguments()["region"], mapW, mapH)
+	if err != nil {
+		return errorResult(err.Error())
 	}
-
-	// Render entity layers.
-	for _, layer := range mf.Layers {
-		if layer.Type != "entity" {
-			continue
-		}
-		for _, e := range layer.Entities {
-			ref, _ := e.Properties["sprite"].(string)
-			if eImg, ok := entityImages[ref]; ok {
-				drawScaled(img, eImg, e.X*ts*scale, e.Y*ts*scale, ts, scale)
-			} else {
-				// Fallback: colored marker.
-				drawEntityMarker(img, e.Type, e.X*ts*scale, e.Y*ts*scale, ts*scale)
-			}
+	layer := req.GetString("layer", "")
+	if layer != "" {
+		if mf, err = mf.OnlyLayer(layer); err != nil {
+			return errorResult(fmt.Sprintf("%s: %v", file, err))
 		}
 	}
 
-	return imageResult(img)
+	ts := mf.TileSize
+	srcW, srcH := region.Dx()*ts, region.Dy()*ts
+	s, _ := fitScale(scale, maxPixels, max(srcW, srcH), func(s previewScale) (int, int) {
+		return s.apply(srcW), s.apply(srcH)
+	})
+
+	spriteLoader := newSpriteLoader(ctx.assetsDirs())
+	img := mf.Render(spriteLoader.findSprite, tilemap.RenderOptions{Region: region, Num: s.num, Den: s.den})
+
+	info := previewInfo{
+		Width:  img.Bounds().Dx(),
+		Height: img.Bounds().Dy(),
+		Scale:  s.float(),
+		Region: &tileRegion{X: region.Min.X, Y: region.Min.Y, W: region.Dx(), H: region.Dy()},
+		Layer:  layer,
+	}
+	if s.less(scale) {
+		info.Warning = fmt.Sprintf("%dx%d tiles at scale %d would be %dx%d pixels, over max_pixels %d; drawn at scale %s instead. Pass region to see part of the map at full scale",
+			region.Dx(), region.Dy(), scale, srcW*scale, srcH*scale, maxPixels, s)
+	}
+	return imageResult(img, info)
 }
 
 // handlePreviewSprite renders a sprite file to a PNG grid and returns it inline.
@@ -123,11 +103,16 @@ func (ctx *ServerContext) handlePreviewSprite(_ context.Context, req mcp.CallToo
 	if scale > 16 {
 		scale = 16
 	}
-
-	assetsDir := filepath.Join(ctx.ProjectRoot, "assets")
+	maxPixels, err := previewMaxPixels(req)
+	if err != nil {
+		return errorResult(err.Error())
+	}
 
 	// Load and resolve sprite file.
-	spritePath := filepath.Join(assetsDir, "sprites", file)
+	spritePath, err := ctx.findAsset("sprites", file)
+	if err != nil {
+		return errorResult(err.Error())
+	}
 	sf, err := sprite.LoadSpriteFile(spritePath)
 	if err != nil {
 		return errorResult(fmt.Sprintf("loading %s: %v", file, err))
@@ -135,14 +120,16 @@ func (ctx *ServerContext) handlePreviewSprite(_ context.Context, req mcp.CallToo
 
 	var pal *palette.Palette
 	if sf.PaletteRef != "" {
-		palPath := filepath.Join(assetsDir, "palettes", sf.PaletteRef+".palette")
-		pal, _ = palette.LoadPalette(palPath)
+		if palPath, err := ctx.findAsset("palettes", sf.PaletteRef+".palette"); err == nil {
+			pal, _ = palette.LoadPalette(palPath)
+		}
 	}
 	if pal == nil {
 		pal = &palette.Palette{Colors: map[string]palette.Color{}}
 	}
 
-	resolved, err := sf.Resolve(pal)
+	assetsDirs := ctx.assetsDirs()
+	resolved, err := sf.ResolveWith(pal, sprite.DirPartLoader(assetsDirs...), sprite.DirPaletteLoader(assetsDirs...))
 	if err != nil {
 		return errorResult(fmt.Sprintf("resolving %s: %v", file, err))
 	}
@@ -151,21 +138,47 @@ func (ctx *ServerContext) handlePreviewSprite(_ context.Context, req mcp.CallToo
 		return errorResult("sprite file has no sprites")
 	}
 
+	switch format := req.GetString("format", "png"); format {
+	case "png":
+	case "svg":
+		data, err := export.SheetSVG(resolved, scale)
+		if err != nil {
+			return errorResult(err.Error())
+		}
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.TextContent{
+					Type: "text",
+					Text: string(data),
+				},
+			},
+		}, nil
+	default:
+		return errorResult(fmt.Sprintf("unknown format %q (expected png or svg)", format))
+	}
+
 	// Layout: each sprite on its own row, frames laid out horizontally.
 	// 1px gap between frames, 1px gap between sprite rows.
 	gap := 1
-	maxWidth := 0
-	totalHeight := 0
-	for _, rs := range resolved {
-		rowW := len(rs.Frames)*(rs.Grid.W*scale+gap) - gap
-		if rowW > maxWidth {
-			maxWidth = rowW
+	size := func(s previewScale) (int, int) {
+		w, h := 0, 0
+		for _, rs := range resolved {
+			w = max(w, len(rs.Frames)*(s.apply(rs.Grid.W)+gap)-gap)
+			h += s.apply(rs.Grid.H) + gap
 		}
-		totalHeight += rs.Grid.H*scale + gap
+		return w, h - gap
+	}
+	largest := 1
+	for _, rs := range resolved {
+		largest = max(largest, rs.Grid.W, rs.Grid.H)
+	}
+	s, ok := fitScale(scale, maxPixels, largest, size)
+	if !ok {
+		return errorResult(fmt.Sprintf("%s has too many frames to fit in max_pixels %d even at one pixel per frame; raise max_pixels or use format svg", file, maxPixels))
 	}
-	totalHeight -= gap
 
 	// Checkerboard background for transparency.
+	maxWidth, totalHeight := size(s)
 	img := image.NewRGBA(image.Rect(0, 0, maxWidth, totalHeight))
 	drawCheckerboard(img)
 
@@ -173,28 +186,53 @@ func (ctx *ServerContext) handlePreviewSprite(_ context.Context, req mcp.CallToo
 	curY := 0
 	for _, rs := range resolved {
 		curX := 0
+		w, h := s.apply(rs.Grid.W), s.apply(rs.Grid.H)
 		for _, frame := range rs.Frames {
 			frameImg := renderFrame(frame.Pixels, rs.Grid.W, rs.Grid.H)
-			drawScaledDirect(img, frameImg, curX, curY, scale)
-			curX += rs.Grid.W*scale + gap
+			sprite.DrawScaled(img, frameImg, image.Rect(curX, curY, curX+w, curY+h))
+			curX += w + gap
 		}
-		curY += rs.Grid.H*scale + gap
+		curY += h + gap
 	}
 
-	return imageResult(img)
+	info := previewInfo{Width: maxWidth, Height: totalHeight, Scale: s.float()}
+	if s.less(scale) {
+		w, h := size(previewScale{scale, 1})
+		info.Warning = fmt.Sprintf("the sheet at scale %d would be %dx%d pixels, over max_pixels %d; drawn at scale %s instead",
+			scale, w, h, maxPixels, s)
+	}
+	return imageResult(img, info)
 }
 
 // spriteLoader caches loaded sprite files for reuse across tile and entity loading.
+// Sprite and palette references found inside map and sprite files are
+// confined to the root of the project they are found in, like tool
+// parameters.
 type spriteLoader struct {
-	assetsDir string
-	cache     map[string][]sprite.ResolvedSprite
+	assetsDirs []string
+	cache      map[string][]sprite.ResolvedSprite
 }
 
-func newSpriteLoader(assetsDir string) *spriteLoader {
+func newSpriteLoader(assetsDirs []string) *spriteLoader {
 	return &spriteLoader{
-		assetsDir: assetsDir,
-		cache:     make(map[string][]sprite.ResolvedSprite),
+		assetsDirs: assetsDirs,
+		cache:      make(map[string][]sprite.ResolvedSprite),
+	}
+}
+
+// find returns the path of name in subdir of the first assets directory
+// that has it, or "" if none does.
+func (sl *spriteLoader) find(subdir, name string) string {
+	for _, dir := range sl.assetsDirs {
+		p := filepath.Join(dir, subdir, name)
+		if insideRoot(filepath.Dir(dir), p) != nil {
+			continue
+		}
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
 	}
+	return ""
 }
 
 func (sl *spriteLoader) resolve(fileName string) []sprite.ResolvedSprite {
@@ -202,7 +240,11 @@ func (sl *spriteLoader) resolve(fileName string) []sprite.ResolvedSprite {
 		return resolved
 	}
 
-	spritePath := filepath.Join(sl.assetsDir, "sprites", fileName+".sprite")
+	spritePath := sl.find("sprites", fileName+".sprite")
+	if spritePath == "" {
+		sl.cache[fileName] = nil
+		return nil
+	}
 	sf, err := sprite.LoadSpriteFile(spritePath)
 	if err != nil {
 		sl.cache[fileName] = nil
@@ -211,14 +253,15 @@ func (sl *spriteLoader) resolve(fileName string) []sprite.ResolvedSprite {
 
 	var pal *palette.Palette
 	if sf.PaletteRef != "" {
-		palPath := filepath.Join(sl.assetsDir, "palettes", sf.PaletteRef+".palette")
-		pal, _ = palette.LoadPalette(palPath)
+		if palPath := sl.find("palettes", sf.PaletteRef+".palette"); palPath != "" {
+			pal, _ = palette.LoadPalette(palPath)
+		}
 	}
 	if pal == nil {
 		pal = &palette.Palette{Colors: map[string]palette.Color{}}
 	}
 
-	resolved, err := sf.Resolve(pal)
+	resolved, err := sf.ResolveWith(pal, sprite.DirPartLoader(sl.assetsDirs...), sprite.DirPaletteLoader(sl.assetsDirs...))
 	if err != nil {
 		sl.cache[fileName] = nil
 		return nil
@@ -227,7 +270,7 @@ func (sl *spriteLoader) resolve(fileName string) []sprite.ResolvedSprite {
 	return resolved
 }
 
-func (sl *spriteLoader) findSprite(ref string) *image.RGBA {
+func (sl *spriteLoader) findSprite(ref string) *sprite.ResolvedSprite {
 	parts := strings.SplitN(ref, ":", 2)
 	if len(parts) != 2 {
 		return nil
@@ -235,66 +278,14 @@ func (sl *spriteLoader) findSprite(ref string) *image.RGBA {
 	fileName, spriteName := parts[0], parts[1]
 
 	resolved := sl.resolve(fileName)
-	for _, rs := range resolved {
-		if rs.Name == spriteName && len(rs.Frames) > 0 {
-			return renderFrame(rs.Frames[0].Pixels, rs.Grid.W, rs.Grid.H)
+	for i, rs := range resolved {
+		if rs.Name == spriteName {
+			return &resolved[i]
 		}
 	}
 	return nil
 }
 
-func (sl *spriteLoader) loadTileSprites(mf *tilemap.MapFile) map[int]*image.RGBA {
-	images := make(map[int]*image.RGBA)
-
-	// Rebuild tile index.
-	tileIndex := make(map[string]int)
-	nextID := 0
-	for key, ref := range mf.Tileset {
-		if ref == "" {
-			tileIndex[key] = 0
-		} else {
-			nextID++
-			tileIndex[key] = nextID
-		}
-	}
-
-	for key, ref := range mf.Tileset {
-		if ref == "" {
-			continue
-		}
-		id := tileIndex[key]
-		if img := sl.findSprite(ref); img != nil {
-			images[id] = img
-		}
-	}
-
-	return images
-}
-
-func (sl *spriteLoader) loadEntitySprites(mf *tilemap.MapFile) map[string]*image.RGBA {
-	images := make(map[string]*image.RGBA)
-
-	for _, layer := range mf.Layers {
-		if layer.Type != "entity" {
-			continue
-		}
-		for _, e := range layer.Entities {
-			ref, ok := e.Properties["sprite"].(string)
-			if !ok || ref == "" {
-				continue
-			}
-			if _, loaded := images[ref]; loaded {
-				continue
-			}
-			if img := sl.findSprite(ref); img != nil {
-				images[ref] = img
-			}
-		}
-	}
-
-	return images
-}
-
 // renderFrame converts resolved pixel data to an image.RGBA.
 func renderFrame(pixels [][]palette.Color, w, h int) *image.RGBA {
 	img := image.NewRGBA(image.Rect(0, 0, w, h))
@@ -306,92 +297,6 @@ func renderFrame(pixels [][]palette.Color, w, h int) *image.RGBA {
 	return img
 }
 
-// drawScaled draws src scaled to fit a tile_size*scale cell at (dx, dy) using nearest-neighbor.
-func drawScaled(dst *image.RGBA, src *image.RGBA, dx, dy, tileSize, scale int) {
-	srcW := src.Bounds().Dx()
-	srcH := src.Bounds().Dy()
-	dstSize := tileSize * scale
-
-	for sy := 0; sy < srcH; sy++ {
-		for sx := 0; sx < srcW; sx++ {
-			c := src.RGBAAt(sx, sy)
-			if c.A == 0 {
-				continue
-			}
-			// Scale pixel position to destination.
-			x0 := dx + sx*dstSize/srcW
-			y0 := dy + sy*dstSize/srcH
-			x1 := dx + (sx+1)*dstSize/srcW
-			y1 := dy + (sy+1)*dstSize/srcH
-			for py := y0; py < y1; py++ {
-				for px := x0; px < x1; px++ {
-					if px >= 0 && px < dst.Bounds().Dx() && py >= 0 && py < dst.Bounds().Dy() {
-						dst.SetRGBA(px, py, c)
-					}
-				}
-			}
-		}
-	}
-}
-
-// drawScaledDirect draws src with a simple integer scale factor at (dx, dy).
-func drawScaledDirect(dst *image.RGBA, src *image.RGBA, dx, dy, scale int) {
-	srcW := src.Bounds().Dx()
-	srcH := src.Bounds().Dy()
-
-	for sy := 0; sy < srcH; sy++ {
-		for sx := 0; sx < srcW; sx++ {
-			c := src.RGBAAt(sx, sy)
-			if c.A == 0 {
-				continue
-			}
-			for py := 0; py < scale; py++ {
-				for px := 0; px < scale; px++ {
-					x := dx + sx*scale + px
-					y := dy + sy*scale + py
-					if x >= 0 && x < dst.Bounds().Dx() && y >= 0 && y < dst.Bounds().Dy() {
-						dst.SetRGBA(x, y, c)
-					}
-				}
-			}
-		}
-	}
-}
-
-// drawEntityMarker draws a small colored diamond for entities without sprites.
-func drawEntityMarker(img *image.RGBA, entityType string, dx, dy, size int) {
-	var c color.RGBA
-	switch entityType {
-	case "spawn":
-		c = color.RGBA{R: 0x00, G: 0xff, B: 0x00, A: 0xcc}
-	case "enemy":
-		c = color.RGBA{R: 0xff, G: 0x00, B: 0x00, A: 0xcc}
-	default:
-		c = color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xcc}
-	}
-
-	// Draw filled diamond.
-	half := size / 2
-	for py := 0; py < size; py++ {
-		for px := 0; px < size; px++ {
-			dist := abs(px-half) + abs(py-half)
-			if dist <= half {
-				x, y := dx+px, dy+py
-				if x >= 0 && x < img.Bounds().Dx() && y >= 0 && y < img.Bounds().Dy() {
-					img.SetRGBA(x, y, c)
-				}
-			}
-		}
-	}
-}
-
-func abs(x int) int {
-	if x < 0 {
-		return -x
-	}
-	return x
-}
-
 // drawCheckerboard fills an image with a transparency checkerboard pattern.
 func drawCheckerboard(img *image.RGBA) {
 	light := color.RGBA{R: 0xcc, G: 0xcc, B: 0xcc, A: 0xff}
@@ -410,14 +315,19 @@ func drawCheckerboard(img *image.RGBA) {
 	}
 }
 
-// imageResult encodes an image as PNG and returns it as MCP ImageContent.
-func imageResult(img image.Image) (*mcp.CallToolResult, error) {
+// imageResult encodes an image as PNG and returns it as MCP ImageContent,
+// followed by info as JSON text.
+func imageResult(img image.Image, info previewInfo) (*mcp.CallToolResult, error) {
 	var buf bytes.Buffer
 	if err := png.Encode(&buf, img); err != nil {
 		return errorResult(fmt.Sprintf("encoding PNG: %v", err))
 	}
 
 	b64 := base64.StdEncoding.EncodeToString(buf.Bytes())
+	text, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return nil, err
+	}
 
 	return &mcp.CallToolResult{
 		Content: []mcp.Content{
@@ -426,6 +336,10 @@ func imageResult(img image.Image) (*mcp.CallToolResult, error) {
 				Data:     b64,
 				MIMEType: "image/png",
 			},
+			mcp.TextContent{
+				Type: "text",
+				Text: string(text),
+			},
 		},
 	}, nil
 }
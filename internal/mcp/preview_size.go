@@ -0,0 +1,143 @@
+package mcp
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Previews are capped in pixels so a large map or sheet can't make a huge
+// image in memory or in the client's context. max_pixels lowers the cap
+// down to one pixel, but can't raise it past maxPreviewPixels.
+const (
+	defaultPreviewPixels = 1 << 20
+	maxPreviewPixels     = 16 << 20
+)
+
+// previewInfo is the text that comes with a preview image.
+type previewInfo struct {
+	Width  int     `json:"width"`
+	Height int     `json:"height"`
+	Scale  float64 `json:"scale"`
+	// Region is the part of a map drawn, in tiles.
+	Region *tileRegion `json:"region,omitempty"`
+	// Layer is the one map layer drawn, if only one was.
+	Layer string `json:"layer,omitempty"`
+	// Warning says why the preview is smaller than the scale asked for.
+	Warning string `json:"warning,omitempty"`
+}
+
+type tileRegion struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+	W int `json:"w"`
+	H int `json:"h"`
+}
+
+func previewMaxPixels(req mcp.CallToolRequest) (int, error) {
+	n := req.GetInt("max_pixels", defaultPreviewPixels)
+	if n < 1 {
+		return 0, fmt.Errorf("max_pixels must be positive, got %d", n)
+	}
+	return min(n, maxPreviewPixels), nil
+}
+
+// previewScale draws num/den output pixels per source pixel.
+type previewScale struct{ num, den int }
+
+// apply returns how many output pixels n source pixels take, rounded up so
+// nothing shrinks to nothing.
+func (s previewScale) apply(n int) int {
+	return (n*s.num + s.den - 1) / s.den
+}
+
+func (s previewScale) float() float64 {
+	return float64(s.num) / float64(s.den)
+}
+
+// less reports whether s is smaller than the whole scale asked for.
+func (s previewScale) less(scale int) bool {
+	return s.num < scale*s.den
+}
+
+func (s previewScale) String() string {
+	if s.den == 1 {
+		return strconv.Itoa(s.num)
+	}
+	return fmt.Sprintf("%d/%d", s.num, s.den)
+}
+
+// fitScale returns the largest scale, starting from scale, at which the
+// image size measures has at most maxPixels pixels. It tries whole scales
+// down to 1, then 1/2, 1/3 and so on to 1/maxDen, and returns false if none
+// fits.
+func fitScale(scale, maxPixels, maxDen int, size func(previewScale) (w, h int)) (previewScale, bool) {
+	fits := func(s previewScale) bool {
+		w, h := size(s)
+		return w*h <= maxPixels
+	}
+	for n := scale; n >= 1; n-- {
+		if s := (previewScale{n, 1}); fits(s) {
+			return s, true
+		}
+	}
+	for d := 2; d <= maxDen; d++ {
+		if s := (previewScale{1, d}); fits(s) {
+			return s, true
+		}
+	}
+	return previewScale{1, max(maxDen, 1)}, false
+}
+
+// parseRegion reads the region parameter of runefact_preview_map, in tiles,
+// and crops it to the map. x and y default to 0, and w and h to the rest of
+// the map; without a region the whole map is drawn.
+func parseRegion(v any, mapW, mapH int) (image.Rectangle, error) {
+	bounds := image.Rect(0, 0, mapW, mapH)
+	if v == nil {
+		return bounds, nil
+	}
+	m, ok := v.(map[string]any)
+	if !ok {
+		return image.Rectangle{}, fmt.Errorf("region must be {x, y, w, h}, got %T", v)
+	}
+	vals := map[string]int{"x": 0, "y": 0, "w": 0, "h": 0}
+	for k, raw := range m {
+		if _, known := vals[k]; !known {
+			return image.Rectangle{}, fmt.Errorf("region: unknown key %q, want x, y, w and h", k)
+		}
+		var n int
+		switch f := raw.(type) {
+		case int:
+			n = f
+		case float64:
+			if f != math.Trunc(f) || math.Abs(f) > math.MaxInt32 {
+				return image.Rectangle{}, fmt.Errorf("region: %s must be a whole number, got %v", k, f)
+			}
+			n = int(f)
+		default:
+			return image.Rectangle{}, fmt.Errorf("region: %s must be a whole number, got %T", k, raw)
+		}
+		vals[k] = n
+	}
+	x, y, w, h := vals["x"], vals["y"], vals["w"], vals["h"]
+	if x < 0 || y < 0 {
+		return image.Rectangle{}, fmt.Errorf("region: x and y must not be negative, got %d, %d", x, y)
+	}
+	if x >= mapW || y >= mapH {
+		return image.Rectangle{}, fmt.Errorf("region at %d,%d is outside the %dx%d map", x, y, mapW, mapH)
+	}
+	if _, ok := m["w"]; !ok {
+		w = mapW - x
+	}
+	if _, ok := m["h"]; !ok {
+		h = mapH - y
+	}
+	if w <= 0 || h <= 0 {
+		return image.Rectangle{}, fmt.Errorf("region: size %dx%d must be positive", w, h)
+	}
+	return image.Rect(x, y, x+w, y+h).Intersect(bounds), nil
+}
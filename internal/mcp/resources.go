@@ -5,8 +5,11 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/vgalaktionov/runefact/internal/build"
 )
 
 func (ctx *ServerContext) handleProjectStatus(_ context.Context, _ mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
@@ -35,6 +38,27 @@ func (ctx *ServerContext) handleProjectStatus(_ context.Context, _ mcp.ReadResou
 		status["built"] = false
 	}
 
+	// Freshness: which sources need a rebuild, and how the last build went.
+	stale := build.StaleAssets(ctx.Config, ctx.ProjectRoot)
+	if stale == nil {
+		stale = []string{}
+	}
+	status["stale"] = stale
+
+	manifestInfo := map[string]any{"exists": false}
+	manifestPath := filepath.Join(outputDir, "manifest.go")
+	if info, err := os.Stat(manifestPath); err == nil {
+		manifestInfo["exists"] = true
+		manifestInfo["modified"] = info.ModTime().UTC().Format(time.RFC3339)
+	}
+	status["manifest"] = manifestInfo
+
+	if rec := build.LoadBuildRecord(ctx.ProjectRoot); rec != nil {
+		status["last_build"] = rec
+	} else {
+		status["last_build"] = nil
+	}
+
 	b, err := json.MarshalIndent(status, "", "  ")
 	if err != nil {
 		return nil, err
@@ -49,8 +73,21 @@ func (ctx *ServerContext) handleProjectStatus(_ context.Context, _ mcp.ReadResou
 	}, nil
 }
 
+// handleManifest serves the manifest.json written by the last build. When
+// [project] manifest_json is off, it falls back to the Go manifest source.
 func (ctx *ServerContext) handleManifest(_ context.Context, _ mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
-	manifestPath := filepath.Join(ctx.ProjectRoot, ctx.Config.Project.Output, "manifest.go")
+	outDir := filepath.Join(ctx.ProjectRoot, ctx.Config.Project.Output)
+	if data, err := os.ReadFile(filepath.Join(outDir, "manifest.json")); err == nil {
+		return []mcp.ResourceContents{
+			mcp.TextResourceContents{
+				URI:      "runefact://manifest",
+				MIMEType: "application/json",
+				Text:     string(data),
+			},
+		}, nil
+	}
+
+	manifestPath := filepath.Join(outDir, "manifest.go")
 	data, err := os.ReadFile(manifestPath)
 	if err != nil {
 		return []mcp.ResourceContents{
@@ -70,3 +107,18 @@ func (ctx *ServerContext) handleManifest(_ context.Context, _ mcp.ReadResourceRe
 		},
 	}, nil
 }
+
+// formatDocHandler serves the documentation of format, as runefact_format_help
+// returns it, at runefact://docs/<format>.
+func formatDocHandler(format string) func(context.Context, mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	return func(_ context.Context, _ mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		doc, _ := formatDoc(format)
+		return []mcp.ResourceContents{
+			mcp.TextResourceContents{
+				URI:      "runefact://docs/" + format,
+				MIMEType: "text/markdown",
+				Text:     doc,
+			},
+		}, nil
+	}
+}
@@ -0,0 +1,126 @@
+package mcp
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// errOutsideProject is returned when a path resolves outside ProjectRoot.
+var errOutsideProject = errors.New("path resolves outside the project root")
+
+// assetPath joins file onto assets/<subdir> and verifies the result stays
+// inside the project root, following symlinks.
+func (ctx *ServerContext) assetPath(subdir, file string) (string, error) {
+	if filepath.IsAbs(file) || filepath.VolumeName(file) != "" {
+		return "", fmt.Errorf("%s: absolute paths are not allowed", file)
+	}
+	p := filepath.Join(ctx.ProjectRoot, "assets", subdir, file)
+	if err := insideRoot(ctx.ProjectRoot, p); err != nil {
+		return "", fmt.Errorf("%s: %w", file, err)
+	}
+	return p, nil
+}
+
+// findAsset is assetPath for reading: when the project has no such file,
+// it looks in the included projects in order, each confined to its own
+// root. A file that is nowhere gets the project's path, so loading it
+// reports it missing there.
+func (ctx *ServerContext) findAsset(subdir, file string) (string, error) {
+	p, err := ctx.assetPath(subdir, file)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(p); err == nil {
+		return p, nil
+	}
+	for _, dir := range ctx.assetsDirs()[1:] {
+		ip := filepath.Join(dir, subdir, file)
+		if insideRoot(filepath.Dir(dir), ip) != nil {
+			continue
+		}
+		if _, err := os.Stat(ip); err == nil {
+			return ip, nil
+		}
+	}
+	return p, nil
+}
+
+// assetsDirs returns the project's assets directory followed by those of
+// its included projects.
+func (ctx *ServerContext) assetsDirs() []string {
+	if ctx.Config == nil {
+		return []string{filepath.Join(ctx.ProjectRoot, "assets")}
+	}
+	return ctx.Config.AssetsDirs(ctx.ProjectRoot)
+}
+
+// checkFileFilters verifies that every entry of a build/validate "files"
+// filter refers to a location inside the project.
+func (ctx *ServerContext) checkFileFilters(files []string) error {
+	for _, f := range files {
+		p := f
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(ctx.ProjectRoot, "assets", f)
+		}
+		if err := insideRoot(ctx.ProjectRoot, p); err != nil {
+			return fmt.Errorf("%s: %w", f, err)
+		}
+	}
+	return nil
+}
+
+// insideRoot reports an error unless path lies within root, both lexically
+// and after resolving symlinks on the longest existing prefix of path.
+func insideRoot(root, path string) error {
+	root = filepath.Clean(root)
+	path = filepath.Clean(path)
+	if !within(root, path) {
+		return errOutsideProject
+	}
+
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		realRoot = root
+	}
+	realPath, err := evalExisting(path)
+	if err != nil {
+		return err
+	}
+	if !within(realRoot, realPath) {
+		return errOutsideProject
+	}
+	return nil
+}
+
+// evalExisting resolves symlinks in the longest existing prefix of path and
+// re-appends the non-existent remainder.
+func evalExisting(path string) (string, error) {
+	var rest []string
+	cur := path
+	for {
+		resolved, err := filepath.EvalSymlinks(cur)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, rest...)...), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		parent := filepath.Dir(cur)
+		if parent == cur {
+			return path, nil
+		}
+		rest = append([]string{filepath.Base(cur)}, rest...)
+		cur = parent
+	}
+}
+
+func within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,247 @@
+package mcp
+
+import (
+	"encoding/json"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Tool annotations tell clients how a tool behaves. Every tool works only
+// on the local project, so none is open-world.
+
+// readOnlyTool annotates a tool that never writes to the project.
+func readOnlyTool(title string) mcp.ToolAnnotation {
+	return mcp.ToolAnnotation{
+		Title:           title,
+		ReadOnlyHint:    mcp.ToBoolPtr(true),
+		DestructiveHint: mcp.ToBoolPtr(false),
+		IdempotentHint:  mcp.ToBoolPtr(true),
+		OpenWorldHint:   mcp.ToBoolPtr(false),
+	}
+}
+
+// cachingTool annotates a tool that reads the project and may update a
+// cache under .runefact, but never touches assets or artifacts.
+func cachingTool(title string) mcp.ToolAnnotation {
+	return mcp.ToolAnnotation{
+		Title:           title,
+		ReadOnlyHint:    mcp.ToBoolPtr(false),
+		DestructiveHint: mcp.ToBoolPtr(false),
+		IdempotentHint:  mcp.ToBoolPtr(true),
+		OpenWorldHint:   mcp.ToBoolPtr(false),
+	}
+}
+
+// writingTool annotates a tool that writes to the project. destructive
+// means it may overwrite existing files.
+func writingTool(title string, destructive bool) mcp.ToolAnnotation {
+	return mcp.ToolAnnotation{
+		Title:           title,
+		ReadOnlyHint:    mcp.ToBoolPtr(false),
+		DestructiveHint: mcp.ToBoolPtr(destructive),
+		IdempotentHint:  mcp.ToBoolPtr(false),
+		OpenWorldHint:   mcp.ToBoolPtr(false),
+	}
+}
+
+// Output schemas describe the JSON a tool returns on success, both as text
+// and as structured content. Tools that return markdown or images have
+// none. The tests check every response against its tool's schema, and
+// treat a field the schema doesn't list as an error.
+
+var (
+	stringSchema  = map[string]any{"type": "string"}
+	integerSchema = map[string]any{"type": "integer"}
+	numberSchema  = map[string]any{"type": "number"}
+	booleanSchema = map[string]any{"type": "boolean"}
+)
+
+// object returns the schema of an object with the given properties, of
+// which required must be present.
+func object(props map[string]any, required ...string) map[string]any {
+	s := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+// mapOf returns the schema of an object whose values all match values.
+func mapOf(values map[string]any) map[string]any {
+	return map[string]any{"type": "object", "additionalProperties": values}
+}
+
+func arrayOf(items map[string]any) map[string]any {
+	return map[string]any{"type": "array", "items": items}
+}
+
+// rawSchema encodes a schema for mcp.Tool.RawOutputSchema.
+func rawSchema(s map[string]any) json.RawMessage {
+	b, err := json.Marshal(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+var diagnosticSchema = object(map[string]any{
+	"file":       stringSchema,
+	"line":       integerSchema,
+	"column":     integerSchema,
+	"severity":   map[string]any{"type": "string", "enum": []string{"error", "warning", "hint"}},
+	"message":    stringSchema,
+	"suggestion": stringSchema,
+	"cells":      arrayOf(arrayOf(integerSchema)),
+}, "severity", "message")
+
+// diagnosticsProps are the properties addDiagnostics sets.
+func diagnosticsProps(props map[string]any) map[string]any {
+	props["errors"] = arrayOf(diagnosticSchema)
+	props["warnings"] = arrayOf(diagnosticSchema)
+	props["hints"] = arrayOf(diagnosticSchema)
+	props["warning_summary"] = arrayOf(object(map[string]any{
+		"file":  stringSchema,
+		"total": integerSchema,
+		"warnings": arrayOf(object(map[string]any{
+			"message": stringSchema,
+			"count":   integerSchema,
+		}, "message", "count")),
+	}, "file", "total", "warnings"))
+	props["messages"] = arrayOf(stringSchema)
+	return props
+}
+
+var diagnosticsRequired = []string{"errors", "warnings", "hints", "warning_summary", "messages"}
+
+var buildOutputSchema = object(diagnosticsProps(map[string]any{
+	"success":   booleanSchema,
+	"artifacts": arrayOf(stringSchema),
+	"output": object(map[string]any{
+		"total_bytes": integerSchema,
+		"budgets": arrayOf(object(map[string]any{
+			"name":        stringSchema,
+			"limit_bytes": integerSchema,
+			"size_bytes":  integerSchema,
+			"ok":          booleanSchema,
+			"files": arrayOf(object(map[string]any{
+				"path":  stringSchema,
+				"bytes": integerSchema,
+			}, "path", "bytes")),
+		}, "name", "limit_bytes", "size_bytes", "ok")),
+	}, "total_bytes"),
+	"manifest_path": stringSchema,
+}), append([]string{"success", "artifacts"}, diagnosticsRequired...)...)
+
+var validateOutputSchema = object(diagnosticsProps(map[string]any{
+	"valid":     booleanSchema,
+	"validated": integerSchema,
+	"cached":    integerSchema,
+}), append([]string{"valid"}, diagnosticsRequired...)...)
+
+var inspectSpriteOutputSchema = object(map[string]any{
+	"file":           stringSchema,
+	"palette":        stringSchema,
+	"palette_extend": mapOf(stringSchema),
+	"default_grid":   stringSchema,
+	"sprites": arrayOf(object(map[string]any{
+		"name":      stringSchema,
+		"width":     integerSchema,
+		"height":    integerSchema,
+		"frames":    integerSchema,
+		"framerate": integerSchema,
+		"palette":   stringSchema,
+		"events":    mapOf(arrayOf(stringSchema)),
+	}, "name", "width", "height", "frames", "framerate")),
+}, "file", "palette", "palette_extend", "default_grid", "sprites")
+
+var inspectMapOutputSchema = object(map[string]any{
+	"file":      stringSchema,
+	"tile_size": integerSchema,
+	"layers": arrayOf(object(map[string]any{
+		"name":         stringSchema,
+		"type":         map[string]any{"type": "string", "enum": []string{"tile", "entity"}},
+		"rows":         integerSchema,
+		"cols":         integerSchema,
+		"entity_count": integerSchema,
+	}, "name", "type")),
+	"warnings": arrayOf(stringSchema),
+}, "file", "tile_size", "layers", "warnings")
+
+// inspectAudioOutputSchema is one of three reports, told apart by "type".
+var inspectAudioOutputSchema = map[string]any{
+	"type": "object",
+	"oneOf": []any{
+		object(map[string]any{
+			"file":      stringSchema,
+			"type":      map[string]any{"const": "sfx"},
+			"duration":  numberSchema,
+			"volume":    numberSchema,
+			"voices":    integerSchema,
+			"waveforms": arrayOf(stringSchema),
+		}, "file", "type", "duration", "volume", "voices", "waveforms"),
+		object(map[string]any{
+			"file":     stringSchema,
+			"type":     map[string]any{"const": "track"},
+			"tempo":    integerSchema,
+			"channels": integerSchema,
+			"patterns": integerSchema,
+			"sequence": arrayOf(stringSchema),
+			"loop":     booleanSchema,
+			"duration": numberSchema,
+			"notes": arrayOf(object(map[string]any{
+				"channel":    stringSchema,
+				"instrument": stringSchema,
+				"low":        stringSchema,
+				"high":       stringSchema,
+			}, "channel", "instrument", "low", "high")),
+		}, "file", "type", "tempo", "channels", "patterns", "sequence", "loop", "duration", "notes"),
+		object(map[string]any{
+			"file":                stringSchema,
+			"type":                map[string]any{"const": "pattern"},
+			"pattern":             stringSchema,
+			"ticks":               integerSchema,
+			"duration":            numberSchema,
+			"peak":                numberSchema,
+			"missing_instruments": arrayOf(stringSchema),
+		}, "file", "type", "pattern", "ticks", "duration", "peak"),
+	},
+}
+
+var assetTypeSchema = map[string]any{
+	"type": "string",
+	"enum": []string{"palette", "sprite", "map", "instrument", "sfx", "track"},
+}
+
+var listAssetsOutputSchema = object(map[string]any{
+	"assets": arrayOf(object(map[string]any{
+		"file":    stringSchema,
+		"type":    assetTypeSchema,
+		"dir":     stringSchema,
+		"mtime":   map[string]any{"type": "string", "format": "date-time"},
+		"size":    integerSchema,
+		"include": stringSchema,
+	}, "file", "type", "dir", "mtime", "size")),
+	"count":       integerSchema,
+	"total":       integerSchema,
+	"next_cursor": stringSchema,
+}, "assets", "count", "total")
+
+var newAssetOutputSchema = object(map[string]any{
+	"path": stringSchema,
+	"type": assetTypeSchema,
+	// summary has the shape of the matching inspect tool's output, or
+	// name, waveform and envelope for an instrument.
+	"summary": map[string]any{"type": "object"},
+}, "path", "type", "summary")
+
+var paletteColorsOutputSchema = object(map[string]any{
+	"file":   stringSchema,
+	"name":   stringSchema,
+	"colors": mapOf(stringSchema),
+	// aliases maps each alias to the key or hex color it names, and the
+	// color that resolves to.
+	"aliases": mapOf(object(map[string]any{
+		"target": stringSchema,
+		"color":  stringSchema,
+	}, "target", "color")),
+}, "file", "name", "colors", "aliases")
@@ -1,6 +1,10 @@
 package mcp
 
 import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
 	"sync"
 
 	"github.com/mark3labs/mcp-go/mcp"
@@ -14,13 +18,19 @@ type ServerContext struct {
 	Config      *config.ProjectConfig
 	ProjectRoot string
 	BuildMu     sync.Mutex
+
+	// ReadOnly makes tools that write to the project (build, new_asset)
+	// fail with a read-only error. Inspect, preview and validate still work.
+	ReadOnly bool
 }
 
-// StartMCPServer creates and starts the MCP server on stdio.
-func StartMCPServer(projectRoot string, cfg *config.ProjectConfig) error {
+// StartMCPServer creates and starts the MCP server on stdio. With readOnly
+// set, tools that write to the project return a read-only error.
+func StartMCPServer(projectRoot string, cfg *config.ProjectConfig, readOnly bool) error {
 	ctx := &ServerContext{
 		Config:      cfg,
 		ProjectRoot: projectRoot,
+		ReadOnly:    readOnly,
 	}
 
 	s := server.NewMCPServer(
@@ -33,10 +43,20 @@ func StartMCPServer(projectRoot string, cfg *config.ProjectConfig) error {
 	registerTools(s, ctx)
 	registerResources(s, ctx)
 
-	return server.ServeStdio(s)
+	// stdout carries the protocol, so the transport's errors go to the
+	// default logger, which writes to stderr.
+	errLog := slog.NewLogLogger(slog.Default().Handler(), slog.LevelError)
+	return server.ServeStdio(s, server.WithErrorLogger(errLog))
 }
 
 func registerTools(s *server.MCPServer, ctx *ServerContext) {
+	// Validation with changed_only updates its cache, except on a
+	// read-only server.
+	validateAnnotations := cachingTool("Validate assets")
+	if ctx.ReadOnly {
+		validateAnnotations = readOnlyTool("Validate assets")
+	}
+
 	s.AddTool(mcp.Tool{
 		Name:        "runefact_build",
 		Description: "Compile rune asset files into game-ready artifacts (PNG, JSON, WAV)",
@@ -55,6 +75,8 @@ func registerTools(s *server.MCPServer, ctx *ServerContext) {
 				},
 			},
 		},
+		Annotations:     writingTool("Build assets", true),
+		RawOutputSchema: rawSchema(buildOutputSchema),
 	}, ctx.handleBuild)
 
 	s.AddTool(mcp.Tool{
@@ -68,8 +90,14 @@ func registerTools(s *server.MCPServer, ctx *ServerContext) {
 					"items":       map[string]any{"type": "string"},
 					"description": "Specific files to validate (empty = all)",
 				},
+				"changed_only": map[string]any{
+					"type":        "boolean",
+					"description": "Skip files that validated cleanly last time and haven't changed since, nor have their dependencies or the config",
+				},
 			},
 		},
+		Annotations:     validateAnnotations,
+		RawOutputSchema: rawSchema(validateOutputSchema),
 	}, ctx.handleValidate)
 
 	s.AddTool(mcp.Tool{
@@ -85,6 +113,8 @@ func registerTools(s *server.MCPServer, ctx *ServerContext) {
 				},
 			},
 		},
+		Annotations:     readOnlyTool("Inspect sprite"),
+		RawOutputSchema: rawSchema(inspectSpriteOutputSchema),
 	}, ctx.handleInspectSprite)
 
 	s.AddTool(mcp.Tool{
@@ -100,11 +130,13 @@ func registerTools(s *server.MCPServer, ctx *ServerContext) {
 				},
 			},
 		},
+		Annotations:     readOnlyTool("Inspect map"),
+		RawOutputSchema: rawSchema(inspectMapOutputSchema),
 	}, ctx.handleInspectMap)
 
 	s.AddTool(mcp.Tool{
 		Name:        "runefact_inspect_audio",
-		Description: "Get audio metadata: duration, voices, instruments",
+		Description: "Get audio metadata: duration, voices, instruments, and the lowest and highest note of each track channel. With pattern, renders that one pattern of a .track on its own and reports its length and peak level",
 		InputSchema: mcp.ToolInputSchema{
 			Type:     "object",
 			Required: []string{"file"},
@@ -113,13 +145,19 @@ func registerTools(s *server.MCPServer, ctx *ServerContext) {
 					"type":        "string",
 					"description": "Audio file name (e.g., laser.sfx or bgm.track)",
 				},
+				"pattern": map[string]any{
+					"type":        "string",
+					"description": "Pattern name in a .track file to render alone (e.g., verse)",
+				},
 			},
 		},
+		Annotations:     readOnlyTool("Inspect audio"),
+		RawOutputSchema: rawSchema(inspectAudioOutputSchema),
 	}, ctx.handleInspectAudio)
 
 	s.AddTool(mcp.Tool{
 		Name:        "runefact_list_assets",
-		Description: "List all rune asset files in the project, optionally filtered by type",
+		Description: "List rune asset files in the project, sorted by directory then name, with size and modification time. Filter by type or name, and page through large projects with limit and cursor",
 		InputSchema: mcp.ToolInputSchema{
 			Type: "object",
 			Properties: map[string]any{
@@ -128,10 +166,64 @@ func registerTools(s *server.MCPServer, ctx *ServerContext) {
 					"enum":        []string{"palette", "sprite", "map", "instrument", "sfx", "track"},
 					"description": "Filter by asset type",
 				},
+				"name_contains": map[string]any{
+					"type":        "string",
+					"description": "Only list files whose name contains this text, ignoring case (e.g., enemy)",
+				},
+				"limit": map[string]any{
+					"type":        "integer",
+					"description": "Most assets to return; the response then has next_cursor if there are more (default: all)",
+				},
+				"cursor": map[string]any{
+					"type":        "string",
+					"description": "next_cursor from a previous call, to continue the listing after it",
+				},
 			},
 		},
+		Annotations:     readOnlyTool("List assets"),
+		RawOutputSchema: rawSchema(listAssetsOutputSchema),
 	}, ctx.handleListAssets)
 
+	if !ctx.ReadOnly {
+		s.AddTool(mcp.Tool{
+			Name:        "runefact_new_asset",
+			Description: "Create a minimal valid asset file from a template. Refuses to overwrite existing files",
+			InputSchema: mcp.ToolInputSchema{
+				Type:     "object",
+				Required: []string{"type", "name"},
+				Properties: map[string]any{
+					"type": map[string]any{
+						"type":        "string",
+						"enum":        []string{"palette", "sprite", "map", "instrument", "sfx", "track"},
+						"description": "Asset type to create",
+					},
+					"name": map[string]any{
+						"type":        "string",
+						"description": "Asset name without extension (e.g., enemy)",
+					},
+					"grid": map[string]any{
+						"type":        "integer",
+						"description": "Sprite grid size or map tile size (default: defaults.sprite_size)",
+					},
+					"palette": map[string]any{
+						"type":        "string",
+						"description": "Palette referenced by a new sprite (default: default)",
+					},
+					"channels": map[string]any{
+						"type":        "integer",
+						"description": "Number of channels in a new track (default: 1)",
+					},
+					"duration": map[string]any{
+						"type":        "number",
+						"description": "Duration of a new sfx in seconds (default: 0.2)",
+					},
+				},
+			},
+			Annotations:     writingTool("New asset", false),
+			RawOutputSchema: rawSchema(newAssetOutputSchema),
+		}, ctx.handleNewAsset)
+	}
+
 	s.AddTool(mcp.Tool{
 		Name:        "runefact_palette_colors",
 		Description: "Get resolved palette colors for a palette file",
@@ -145,6 +237,8 @@ func registerTools(s *server.MCPServer, ctx *ServerContext) {
 				},
 			},
 		},
+		Annotations:     readOnlyTool("Palette colors"),
+		RawOutputSchema: rawSchema(paletteColorsOutputSchema),
 	}, ctx.handlePaletteColors)
 
 	s.AddTool(mcp.Tool{
@@ -161,11 +255,12 @@ func registerTools(s *server.MCPServer, ctx *ServerContext) {
 				},
 			},
 		},
+		Annotations: readOnlyTool("Format help"),
 	}, ctx.handleFormatHelp)
 
 	s.AddTool(mcp.Tool{
 		Name:        "runefact_preview_map",
-		Description: "Render a map file as a PNG image and return it inline. Use this to visually inspect map layouts, tile art, and entity placement.",
+		Description: "Render a map file as a PNG image and return it inline, followed by JSON with the size, scale and region drawn. Use this to visually inspect map layouts, tile art, and entity placement. Large maps are drawn smaller to stay under max_pixels; pass region to see part of one at full scale.",
 		InputSchema: mcp.ToolInputSchema{
 			Type:     "object",
 			Required: []string{"file"},
@@ -178,13 +273,32 @@ func registerTools(s *server.MCPServer, ctx *ServerContext) {
 					"type":        "integer",
 					"description": "Pixel scale factor (default: 2)",
 				},
+				"region": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"x": map[string]any{"type": "integer"},
+						"y": map[string]any{"type": "integer"},
+						"w": map[string]any{"type": "integer"},
+						"h": map[string]any{"type": "integer"},
+					},
+					"description": "Part of the map to draw, in tiles (default: the whole map; w and h default to the rest of the map)",
+				},
+				"layer": map[string]any{
+					"type":        "string",
+					"description": "Draw only this layer, at its place in the map (default: every layer)",
+				},
+				"max_pixels": map[string]any{
+					"type":        "integer",
+					"description": "Most pixels in the image; a larger render is drawn at a smaller scale (default: 1048576, max: 16777216)",
+				},
 			},
 		},
+		Annotations: readOnlyTool("Preview map"),
 	}, ctx.handlePreviewMap)
 
 	s.AddTool(mcp.Tool{
 		Name:        "runefact_preview_sprite",
-		Description: "Render a sprite file as a PNG image and return it inline. Shows all sprites with all animation frames laid out in a grid.",
+		Description: "Render a sprite file as a PNG image and return it inline, followed by JSON with the size and scale drawn. Shows all sprites with all animation frames laid out in a grid.",
 		InputSchema: mcp.ToolInputSchema{
 			Type:     "object",
 			Required: []string{"file"},
@@ -197,8 +311,18 @@ func registerTools(s *server.MCPServer, ctx *ServerContext) {
 					"type":        "integer",
 					"description": "Pixel scale factor (default: 4)",
 				},
+				"format": map[string]any{
+					"type":        "string",
+					"enum":        []string{"png", "svg"},
+					"description": "Output format: png returns an inline image, svg returns the SVG source as text (default: png)",
+				},
+				"max_pixels": map[string]any{
+					"type":        "integer",
+					"description": "Most pixels in a png; a larger sheet is drawn at a smaller scale (default: 1048576, max: 16777216)",
+				},
 			},
 		},
+		Annotations: readOnlyTool("Preview sprite"),
 	}, ctx.handlePreviewSprite)
 }
 
@@ -216,4 +340,13 @@ func registerResources(s *server.MCPServer, ctx *ServerContext) {
 		Description: "Current manifest data as JSON",
 		MIMEType:    "application/json",
 	}, ctx.handleManifest)
+
+	for _, format := range slices.Sorted(maps.Keys(formatDocs)) {
+		s.AddResource(mcp.Resource{
+			URI:         "runefact://docs/" + format,
+			Name:        fmt.Sprintf("%s format", format),
+			Description: fmt.Sprintf("Syntax, an example and the common errors of the %s format, as runefact_format_help returns them", format),
+			MIMEType:    "text/markdown",
+		}, formatDocHandler(format))
+	}
 }
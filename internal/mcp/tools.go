@@ -4,49 +4,56 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/mark3labs/mcp-go/mcp"
 
 	"github.com/vgalaktionov/runefact/internal/build"
+	"github.com/vgalaktionov/runefact/internal/diagnostic"
+	"github.com/vgalaktionov/runefact/internal/inspect"
+	"github.com/vgalaktionov/runefact/internal/instrument"
 	"github.com/vgalaktionov/runefact/internal/palette"
-	"github.com/vgalaktionov/runefact/internal/sfx"
-	"github.com/vgalaktionov/runefact/internal/sprite"
-	"github.com/vgalaktionov/runefact/internal/tilemap"
-	"github.com/vgalaktionov/runefact/internal/track"
+	"github.com/vgalaktionov/runefact/internal/scaffold"
 )
 
-func (ctx *ServerContext) handleBuild(_ context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+func (ctx *ServerContext) handleBuild(c context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	if ctx.ReadOnly {
+		return readOnlyResult("runefact_build")
+	}
+
 	ctx.BuildMu.Lock()
 	defer ctx.BuildMu.Unlock()
 
 	scope := req.GetString("scope", "all")
 	files := req.GetStringSlice("files", nil)
+	if err := ctx.checkFileFilters(files); err != nil {
+		return errorResult(err.Error())
+	}
 
 	opts := build.Options{
 		Scope: build.Scope(scope),
 		Files: files,
 	}
 
-	result := build.Build(opts, ctx.Config, ctx.ProjectRoot)
+	// The request's context stops a long audio render if the client
+	// cancels or disconnects.
+	result := build.BuildContext(c, opts, ctx.Config, ctx.ProjectRoot)
 
 	resp := map[string]any{
 		"success":   len(result.Errors) == 0,
-		"artifacts": result.Artifacts,
-		"warnings":  result.Warnings,
+		"artifacts": slashPaths(result.Artifacts),
 	}
-
-	if len(result.Errors) > 0 {
-		errs := make([]string, len(result.Errors))
-		for i, e := range result.Errors {
-			errs[i] = e.Error()
-		}
-		resp["errors"] = errs
+	addDiagnostics(resp, result)
+	if result.Sizes != nil {
+		resp["output"] = result.Sizes
 	}
 	if result.ManifestPath != "" {
-		resp["manifest_path"] = result.ManifestPath
+		resp["manifest_path"] = filepath.ToSlash(result.ManifestPath)
 	}
 
 	return jsonResult(resp)
@@ -54,26 +61,29 @@ func (ctx *ServerContext) handleBuild(_ context.Context, req mcp.CallToolRequest
 
 func (ctx *ServerContext) handleValidate(_ context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	files := req.GetStringSlice("files", nil)
+	if err := ctx.checkFileFilters(files); err != nil {
+		return errorResult(err.Error())
+	}
 
 	opts := build.Options{
-		Scope: build.ScopeAll,
-		Files: files,
+		Scope:       build.ScopeAll,
+		Files:       files,
+		ChangedOnly: req.GetBool("changed_only", false),
+		// changed_only updates .runefact/validate_cache.json, which a
+		// read-only server must not write.
+		NoRecord: ctx.ReadOnly,
 	}
 
 	result := build.Validate(opts, ctx.Config, ctx.ProjectRoot)
 
 	resp := map[string]any{
-		"valid":    len(result.Errors) == 0,
-		"warnings": result.Warnings,
+		"valid": len(result.Errors) == 0,
 	}
-
-	if len(result.Errors) > 0 {
-		errs := make([]string, len(result.Errors))
-		for i, e := range result.Errors {
-			errs[i] = e.Error()
-		}
-		resp["errors"] = errs
+	if opts.ChangedOnly {
+		resp["validated"] = len(result.Validated)
+		resp["cached"] = len(result.Cached)
 	}
+	addDiagnostics(resp, result)
 
 	return jsonResult(resp)
 }
@@ -84,30 +94,15 @@ func (ctx *ServerContext) handleInspectSprite(_ context.Context, req mcp.CallToo
 		return errorResult("file parameter required")
 	}
 
-	path := filepath.Join(ctx.ProjectRoot, "assets", "sprites", file)
-	sf, err := sprite.LoadSpriteFile(path)
+	path, err := ctx.findAsset("sprites", file)
 	if err != nil {
-		return errorResult(fmt.Sprintf("loading %s: %v", file, err))
+		return errorResult(err.Error())
 	}
-
-	sprites := make([]map[string]any, len(sf.Sprites))
-	for i, s := range sf.Sprites {
-		sprites[i] = map[string]any{
-			"name":      s.Name,
-			"width":     s.Grid.W,
-			"height":    s.Grid.H,
-			"frames":    len(s.Frames),
-			"framerate": s.Framerate,
-		}
+	r, err := inspect.Sprite(path, file)
+	if err != nil {
+		return errorResult(fmt.Sprintf("loading %s: %v", file, err))
 	}
-
-	return jsonResult(map[string]any{
-		"file":           file,
-		"palette":        sf.PaletteRef,
-		"palette_extend": sf.PaletteExtend,
-		"default_grid":   fmt.Sprintf("%dx%d", sf.DefaultGrid.W, sf.DefaultGrid.H),
-		"sprites":        sprites,
-	})
+	return jsonResult(r)
 }
 
 func (ctx *ServerContext) handleInspectMap(_ context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
@@ -116,131 +111,156 @@ func (ctx *ServerContext) handleInspectMap(_ context.Context, req mcp.CallToolRe
 		return errorResult("file parameter required")
 	}
 
-	path := filepath.Join(ctx.ProjectRoot, "assets", "maps", file)
-	mf, warnings, err := tilemap.LoadMapFile(path)
+	path, err := ctx.findAsset("maps", file)
 	if err != nil {
-		return errorResult(fmt.Sprintf("loading %s: %v", file, err))
-	}
-
-	layers := make([]map[string]any, len(mf.Layers))
-	for i, l := range mf.Layers {
-		layer := map[string]any{
-			"name": l.Name,
-			"type": l.Type,
-		}
-		if l.Type == "tile" && len(l.Data) > 0 {
-			layer["rows"] = len(l.Data)
-			layer["cols"] = len(l.Data[0])
-		}
-		if l.Type == "entity" {
-			layer["entity_count"] = len(l.Entities)
-		}
-		layers[i] = layer
+		return errorResult(err.Error())
 	}
-
-	warnStrs := make([]string, len(warnings))
-	for i, w := range warnings {
-		warnStrs[i] = w.Message
+	r, err := inspect.Map(path, file)
+	if err != nil {
+		return errorResult(fmt.Sprintf("loading %s: %v", file, err))
 	}
-
-	return jsonResult(map[string]any{
-		"file":      file,
-		"tile_size": mf.TileSize,
-		"layers":    layers,
-		"warnings":  warnStrs,
-	})
+	return jsonResult(r)
 }
 
-func (ctx *ServerContext) handleInspectAudio(_ context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+func (ctx *ServerContext) handleInspectAudio(c context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	file, err := req.RequireString("file")
 	if err != nil {
 		return errorResult("file parameter required")
 	}
 
 	ext := filepath.Ext(file)
-	switch ext {
-	case ".sfx":
-		path := filepath.Join(ctx.ProjectRoot, "assets", "sfx", file)
-		s, err := sfx.LoadSFX(path)
-		if err != nil {
-			return errorResult(fmt.Sprintf("loading %s: %v", file, err))
+	if ext != ".sfx" && ext != ".track" {
+		return errorResult(fmt.Sprintf("unsupported audio type: %s", ext))
+	}
+	path, err := ctx.findAsset(inspect.Dirs[ext], file)
+	if err != nil {
+		return errorResult(err.Error())
+	}
+	if pattern := req.GetString("pattern", ""); pattern != "" {
+		if ext != ".track" {
+			return errorResult("pattern only applies to .track files")
 		}
-		return jsonResult(map[string]any{
-			"file":     file,
-			"type":     "sfx",
-			"duration": s.Duration,
-			"volume":   s.Volume,
-			"voices":   len(s.Voices),
-		})
-
-	case ".track":
-		path := filepath.Join(ctx.ProjectRoot, "assets", "tracks", file)
-		tr, err := track.LoadTrack(path)
+		instruments := map[string]*instrument.Instrument{}
+		for _, dir := range ctx.assetsDirs() {
+			for name, inst := range instrument.LoadDir(filepath.Join(dir, "instruments")) {
+				if _, ok := instruments[name]; !ok {
+					instruments[name] = inst
+				}
+			}
+		}
+		r, err := inspect.Pattern(c, path, file, pattern, instruments, ctx.Config.Defaults.SampleRate)
 		if err != nil {
-			return errorResult(fmt.Sprintf("loading %s: %v", file, err))
+			return errorResult(fmt.Sprintf("rendering %s pattern %s: %v", file, pattern, err))
 		}
-		return jsonResult(map[string]any{
-			"file":     file,
-			"type":     "track",
-			"tempo":    tr.Tempo,
-			"channels": len(tr.Channels),
-			"patterns": len(tr.Patterns),
-			"sequence": tr.Sequence,
-			"loop":     tr.Loop,
-		})
-
-	default:
-		return errorResult(fmt.Sprintf("unsupported audio type: %s", ext))
+		return jsonResult(r)
+	}
+	r, err := inspect.File(path, file)
+	if err != nil {
+		return errorResult(fmt.Sprintf("loading %s: %v", file, err))
 	}
+	return jsonResult(r)
+}
+
+// assetEntry is one file in a runefact_list_assets response.
+type assetEntry struct {
+	File  string `json:"file"`
+	Type  string `json:"type"`
+	Dir   string `json:"dir"`
+	Mtime string `json:"mtime"` // RFC 3339, UTC
+	Size  int64  `json:"size"`
+	// Include is the [[include]] path of the project the file comes from,
+	// empty for the project's own files.
+	Include string `json:"include,omitempty"`
+}
+
+// cursor returns the position of e in the listing order, which is also the
+// cursor of the page that follows it.
+func (e assetEntry) cursor() string {
+	return e.Dir + "/" + e.File
 }
 
 func (ctx *ServerContext) handleListAssets(_ context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	filterType := req.GetString("type", "")
-	assetsDir := filepath.Join(ctx.ProjectRoot, "assets")
-
-	type assetEntry struct {
-		File string `json:"file"`
-		Type string `json:"type"`
-		Dir  string `json:"dir"`
+	nameContains := strings.ToLower(req.GetString("name_contains", ""))
+	limit := req.GetInt("limit", 0)
+	cursor := req.GetString("cursor", "")
+	if limit < 0 {
+		return errorResult(fmt.Sprintf("limit must not be negative, got %d", limit))
 	}
-
-	dirs := map[string]struct {
-		ext      string
-		typeName string
-	}{
-		"palettes":    {".palette", "palette"},
-		"sprites":     {".sprite", "sprite"},
-		"maps":        {".map", "map"},
-		"instruments": {".inst", "instrument"},
-		"sfx":         {".sfx", "sfx"},
-		"tracks":      {".track", "track"},
+	if cursor != "" && !strings.Contains(cursor, "/") {
+		return errorResult(fmt.Sprintf("invalid cursor %q: pass next_cursor from a previous call", cursor))
 	}
+	assetsDirs := ctx.assetsDirs()
 
-	var assets []assetEntry
-	for dir, info := range dirs {
-		if filterType != "" && filterType != info.typeName {
-			continue
-		}
-		dirPath := filepath.Join(assetsDir, dir)
-		entries, err := os.ReadDir(dirPath)
-		if err != nil {
+	// Assets are listed by directory, then file name, so a cursor stays
+	// valid between calls.
+	types := slices.Collect(maps.Keys(scaffold.AssetKinds))
+	slices.SortFunc(types, func(a, b string) int {
+		return strings.Compare(scaffold.AssetKinds[a].Dir, scaffold.AssetKinds[b].Dir)
+	})
+
+	assets := []assetEntry{}
+	for _, typ := range types {
+		kind := scaffold.AssetKinds[typ]
+		if filterType != "" && filterType != typ {
 			continue
 		}
-		for _, e := range entries {
-			if !e.IsDir() && strings.HasSuffix(e.Name(), info.ext) {
-				assets = append(assets, assetEntry{
-					File: e.Name(),
-					Type: info.typeName,
-					Dir:  dir,
-				})
+		// A file in the project shadows one of the same name in an
+		// included project, as in a build.
+		var found []assetEntry
+		seen := map[string]bool{}
+		for i, assetsDir := range assetsDirs {
+			entries, err := os.ReadDir(filepath.Join(assetsDir, kind.Dir))
+			if err != nil {
+				continue
+			}
+			for _, e := range entries {
+				if e.IsDir() || !strings.HasSuffix(e.Name(), kind.Ext) || seen[e.Name()] {
+					continue
+				}
+				seen[e.Name()] = true
+				if !strings.Contains(strings.ToLower(e.Name()), nameContains) {
+					continue
+				}
+				info, err := e.Info()
+				if err != nil {
+					continue
+				}
+				entry := assetEntry{
+					File:  e.Name(),
+					Type:  typ,
+					Dir:   kind.Dir,
+					Mtime: info.ModTime().UTC().Format(time.RFC3339),
+					Size:  info.Size(),
+				}
+				if i > 0 {
+					entry.Include = ctx.Config.Include[i-1].Path
+				}
+				found = append(found, entry)
 			}
 		}
+		slices.SortFunc(found, func(a, b assetEntry) int { return strings.Compare(a.File, b.File) })
+		assets = append(assets, found...)
 	}
+	total := len(assets)
 
-	return jsonResult(map[string]any{
-		"assets": assets,
-		"count":  len(assets),
-	})
+	if cursor != "" {
+		after := func(e assetEntry) bool {
+			dir, file, _ := strings.Cut(cursor, "/")
+			return e.Dir > dir || e.Dir == dir && e.File > file
+		}
+		assets = slices.DeleteFunc(assets, func(e assetEntry) bool { return !after(e) })
+	}
+	resp := map[string]any{}
+	if limit > 0 && len(assets) > limit {
+		assets = assets[:limit]
+		resp["next_cursor"] = assets[limit-1].cursor()
+	}
+	resp["assets"] = assets
+	resp["count"] = len(assets)
+	resp["total"] = total
+
+	return jsonResult(resp)
 }
 
 func (ctx *ServerContext) handlePaletteColors(_ context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
@@ -249,25 +269,36 @@ func (ctx *ServerContext) handlePaletteColors(_ context.Context, req mcp.CallToo
 		return errorResult("file parameter required")
 	}
 
-	path := filepath.Join(ctx.ProjectRoot, "assets", "palettes", file)
+	path, err := ctx.findAsset("palettes", file)
+	if err != nil {
+		return errorResult(err.Error())
+	}
 	pal, err := palette.LoadPalette(path)
 	if err != nil {
 		return errorResult(fmt.Sprintf("loading %s: %v", file, err))
 	}
 
-	colors := make(map[string]string, len(pal.Colors))
-	for key, c := range pal.Colors {
+	hex := func(c palette.Color) string {
 		if c.A == 255 {
-			colors[key] = fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
-		} else {
-			colors[key] = fmt.Sprintf("#%02x%02x%02x%02x", c.R, c.G, c.B, c.A)
+			return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
 		}
+		return fmt.Sprintf("#%02x%02x%02x%02x", c.R, c.G, c.B, c.A)
+	}
+	colors := make(map[string]string, len(pal.Colors))
+	for key, c := range pal.Colors {
+		colors[key] = hex(c)
+	}
+	aliases := make(map[string]any, len(pal.Aliases))
+	for name, target := range pal.Aliases {
+		c, _ := pal.Lookup(name) // checked when the palette was parsed
+		aliases[name] = map[string]string{"target": target, "color": hex(c)}
 	}
 
 	return jsonResult(map[string]any{
-		"file":   file,
-		"name":   pal.Name,
-		"colors": colors,
+		"file":    file,
+		"name":    pal.Name,
+		"colors":  colors,
+		"aliases": aliases,
 	})
 }
 
@@ -277,7 +308,7 @@ func (ctx *ServerContext) handleFormatHelp(_ context.Context, req mcp.CallToolRe
 		return errorResult("format parameter required")
 	}
 
-	doc, ok := formatDocs[format]
+	doc, ok := formatDoc(format)
 	if !ok {
 		return errorResult(fmt.Sprintf("unknown format: %s", format))
 	}
@@ -307,10 +338,15 @@ g = "#00ff00"
 b = "#0000ff"
 _ = "#00000000"      # transparent
 sk = "#ffcc99"       # multi-char key
+
+[aliases]
+blood = "r"          # a key of [colors], or a hex color
 ` + "```" + `
 
 Colors use hex notation: #RGB, #RRGGBB, or #RRGGBBAA.
 Key "_" is always transparent. Keys can be 1+ characters.
+Aliases name colors for palette_extend values in sprites and for
+[preview] background in runefact.toml; those also take keys and hex colors.
 `,
 
 	"sprite": `# .sprite Format
@@ -319,37 +355,43 @@ TOML file defining one or more sprites with pixel grids.
 
 ` + "```toml" + `
 palette = "default"
-grid = "16x16"
+grid = "6x4"
 
 [palette_extend]
 x = "#ff00ff"
 
 [sprite.player]
 pixels = """
-____rrrr____
-__rrrrrrrr__
-__rr__rr__rr
+__rr__
+_rrrr_
+rxrrxr
+_r__r_
 """
 
 [sprite.coin]
 framerate = 8
-frame_count = 4
 pixels = """
 __yy__
 _yyyy_
 _yyyy_
 __yy__
 --
-_yyyy_
-yyyyyy
-yyyyyy
-_yyyy_
+___y__
+__yy__
+__yy__
+___y__
 """
 ` + "```" + `
 
-palette: references a .palette file by name (without extension).
-grid: "WxH" default dimensions. Sprites auto-detect if omitted.
-Frames separated by "--" on its own line. [xx] bracket syntax for multi-char palette keys.
+palette: references a .palette file by name (without extension). A [sprite.NAME] table can set its own palette to override the file's for that sprite.
+grid: one number for square sprites or "WxH". Every frame must be exactly
+that size; a [sprite.NAME] table can set its own grid. Without a grid, a
+sprite takes its size from its pixels.
+Frames: a line holding only "--" starts the next frame, and all frames must
+be the same size. framerate is in frames per second. frame_count is
+optional; when set it must equal the number of frames.
+Each character is one pixel; write palette keys longer than one character
+in brackets, e.g. [sk].
 `,
 
 	"map": `# .map Format
@@ -357,6 +399,7 @@ Frames separated by "--" on its own line. [xx] bracket syntax for multi-char pal
 TOML file defining a tilemap with tile and entity layers.
 
 ` + "```toml" + `
+format_version = 2
 tile_size = 16
 
 [tileset]
@@ -371,15 +414,24 @@ gggggggg
 """
 
 [layer.entities]
+type = "entity"
 [[layer.entities.entity]]
 type = "spawn"
 x = 2
 y = 3
 ` + "```" + `
 
-tileset maps single chars to "sprite_file:sprite_name" references.
-Layers can be tile (with pixels) or entity (with entity list).
+tileset maps keys to "sprite_file:sprite_name" references. Layers read one
+char per tile; keys longer than one char are written in brackets, e.g.
+gr1 = "terrain:edge" is used as [gr1] in pixels.
+Layers can be tile (with pixels) or entity (with entity list). type = "tile"
+or "entity" sets the kind; without it, a layer with entities is an entity
+layer. An empty entity layer needs type = "entity".
+[layer.x.tint] color = "#RRGGBB" (mode = "multiply") tints a layer; [presets.night]
+maps layer names to { color = "..." } overrides. Both are exported to the map JSON.
 "_" or empty string = empty/transparent tile.
+format_version is the format revision the file is written for; without it
+the file is version 1, and runefact upgrade migrates it.
 `,
 
 	"instrument": `# .inst Format
@@ -388,6 +440,8 @@ TOML file defining a synthesizer instrument for use in .track files.
 
 ` + "```toml" + `
 name = "bass"
+
+[oscillator]
 waveform = "square"
 duty_cycle = 0.25
 
@@ -403,8 +457,24 @@ cutoff = 800
 resonance = 2.0
 ` + "```" + `
 
-Waveforms: sine, square, triangle, sawtooth, noise, pulse.
-Envelope: ADSR in seconds. Filter: lowpass, highpass, bandpass.
+Waveforms: sine (the default), square, triangle, sawtooth, noise, pulse.
+duty_cycle applies to square and pulse.
+Envelope: attack, decay and release in seconds, sustain as a level from 0
+to 1. Filter: lowpass, highpass, bandpass.
+
+Drum waveforms kick, snare and hat are whole drum sounds; [envelope] does
+not apply to them. [oscillator] takes three more keys for them:
+  tune   semitones, default 0; C4 plays the drum at its own pitch
+  decay  seconds to die away by 40 dB; default 0.35 kick, 0.18 snare, 0.06 hat
+  snap   0-1, default 0.5: the kick's click, the snare's noise against its
+         tone, the hat's brightness
+range = { low = "C1", high = "C4" } declares the notes an instrument is
+meant to play; tracks playing outside it get a warning.
+
+sample = "samples/piano.wav" plays a mono PCM WAV file, relative to the
+assets directory, instead of the oscillator, resampled to each note.
+root_note (default "C4") is the note the recording plays at its own
+speed; loop_start and loop_end, in frames, repeat a part of it.
 `,
 
 	"sfx": `# .sfx Format
@@ -432,7 +502,9 @@ curve = "exponential"
 
 duration: total length in seconds. volume: master volume 0.0-1.0.
 Each voice has waveform, envelope (ADSR), pitch (start/end/curve), optional filter and effects.
+sync_to = N hard-syncs a voice to voice N (0 is the first).
 Pitch curves: linear, exponential, logarithmic.
+Envelopes take attack_curve and release_curve with the same curve names.
 `,
 
 	"track": `# .track Format
@@ -440,8 +512,10 @@ Pitch curves: linear, exponential, logarithmic.
 TOML file defining tracker-style music with patterns and channels.
 
 ` + "```toml" + `
+format_version = 2
 tempo = 120
 ticks_per_beat = 4
+loop = true
 
 [[channel]]
 name = "lead"
@@ -454,24 +528,104 @@ instrument = "bass"
 volume = 0.6
 
 [pattern.intro]
-ticks = 16
+ticks = 4
 data = """
-C4  C3
-D4  C3
-E4  E3
-G4  G3
+lead | bass
+C4   | C3
+D4   | C3
+E4   | E3
+G4   | G3
 """
 
 [song]
-sequence = ["intro", "verse", "chorus"]
-loop = true
+sequence = ["intro"]
 ` + "```" + `
 
+The first data line names the channels in order; each later line is a row.
+ticks is optional, but when set it must match the row count unless the
+pattern sets pad = true to fill the remaining ticks with silence.
 Notes: C4, C#5, D3, etc. Special: --- (sustain), ... (silence), ^^^ (note off).
-Effects after note: v80 (velocity), >4 (slide up), <4 (slide down), ~3 (vibrato).
+Effects follow the note after a space. vN sets the velocity as one hex
+digit, from v0 (silent) to vF (full, the default): "C4 v8" plays at about
+half volume. Other effect letters are accepted but not rendered yet.
+loop_crossfade = 0.05 crossfades the last 0.05 seconds of a looping track
+into the audio before its loop start, so the seam doesn't click; validate
+warns about seams that jump.
+[song] export_patterns = ["victory"] also writes each listed pattern,
+rendered alone, as audio/<track>_<pattern>.wav with an SFX constant;
+export_full = false leaves out the whole song.
+format_version is the format revision the file is written for; without it
+the file is version 1, and runefact upgrade migrates it.
 `,
 }
 
+// diagnosticJSON is the wire form of a diagnostic.Diagnostic.
+type diagnosticJSON struct {
+	File       string   `json:"file,omitempty"`
+	Line       int      `json:"line,omitempty"`
+	Column     int      `json:"column,omitempty"`
+	Severity   string   `json:"severity"`
+	Message    string   `json:"message"`
+	Suggestion string   `json:"suggestion,omitempty"`
+	Cells      [][2]int `json:"cells,omitempty"`
+}
+
+// addDiagnostics sets structured "errors" and "warnings" arrays on resp,
+// and "warning_summary": the warnings grouped by file with identical ones
+// counted, which is easier to read than a long list of repeats. The flat "messages" array keeps the pre-diagnostics string form for
+// clients that have not migrated yet; it will be removed in a later release.
+func addDiagnostics(resp map[string]any, result *build.Result) {
+	errs := []diagnosticJSON{}
+	warns := []diagnosticJSON{}
+	hints := []diagnosticJSON{}
+	for _, d := range result.Diagnostics {
+		dj := diagnosticJSON{
+			File:       d.File,
+			Line:       d.Line,
+			Column:     d.Column,
+			Severity:   d.Severity.String(),
+			Message:    d.Message,
+			Suggestion: d.Suggestion,
+			Cells:      d.Cells,
+		}
+		switch d.Severity {
+		case diagnostic.Error:
+			errs = append(errs, dj)
+		case diagnostic.Hint:
+			hints = append(hints, dj)
+		default:
+			warns = append(warns, dj)
+		}
+	}
+	resp["errors"] = errs
+	resp["warnings"] = warns
+	resp["hints"] = hints
+	summary := result.WarningSummary()
+	if summary == nil {
+		summary = []build.WarningGroup{}
+	}
+	resp["warning_summary"] = summary
+
+	messages := make([]string, 0, len(result.Errors)+len(result.Warnings))
+	for _, e := range result.Errors {
+		messages = append(messages, e.Error())
+	}
+	messages = append(messages, result.Warnings...)
+	resp["messages"] = messages
+}
+
+// slashPaths returns filesystem paths with forward slashes, so clients see
+// the same form on every OS.
+func slashPaths(paths []string) []string {
+	out := make([]string, len(paths))
+	for i, p := range paths {
+		out[i] = filepath.ToSlash(p)
+	}
+	return out
+}
+
+// jsonResult returns data as indented JSON text and, for clients that read
+// it against the tool's output schema, as structured content.
 func jsonResult(data any) (*mcp.CallToolResult, error) {
 	b, err := json.MarshalIndent(data, "", "  ")
 	if err != nil {
@@ -484,9 +638,26 @@ func jsonResult(data any) (*mcp.CallToolResult, error) {
 				Text: string(b),
 			},
 		},
+		StructuredContent: data,
 	}, nil
 }
 
+// readOnlyResult is returned by tools that write to the project when the
+// server runs with --read-only.
+func readOnlyResult(tool string) (*mcp.CallToolResult, error) {
+	res, err := jsonResult(map[string]any{
+		"error":       fmt.Sprintf("%s is disabled: the server is running in read-only mode", tool),
+		"read_only":   true,
+		"alternative": "runefact_validate checks files for errors without writing artifacts",
+	})
+	if res != nil {
+		// Output schemas describe successful results only.
+		res.StructuredContent = nil
+		res.IsError = true
+	}
+	return res, err
+}
+
 func errorResult(msg string) (*mcp.CallToolResult, error) {
 	return &mcp.CallToolResult{
 		Content: []mcp.Content{
@@ -0,0 +1,92 @@
+package migrate
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+
+	toml "github.com/pelletier/go-toml/v2"
+	"github.com/pelletier/go-toml/v2/unstable"
+
+	"github.com/vgalaktionov/runefact/internal/tomlsrc"
+)
+
+var bareKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// mapEntityLayerTypes writes type = "entity" on layers that are entity
+// layers only because they list entities. Version 2 maps keep a layer's
+// type when its last entity is removed, rather than turning it into an
+// empty tile layer, so the type has to be written down.
+func mapEntityLayerTypes(data []byte) ([]byte, []string, error) {
+	var raw struct {
+		Layer map[string]struct {
+			Type   string `toml:"type"`
+			Entity []any  `toml:"entity"`
+		} `toml:"layer"`
+	}
+	if err := toml.Unmarshal(data, &raw); err != nil {
+		return nil, nil, err
+	}
+	var names []string
+	for name, l := range raw.Layer {
+		if l.Type == "" && len(l.Entity) > 0 {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return data, nil, nil
+	}
+	slices.Sort(names)
+
+	// Find each layer's table header, or failing that its first entity.
+	header := map[string]int{}
+	firstEntity := map[string]int{}
+	var p unstable.Parser
+	p.Reset(data)
+	for p.NextExpression() {
+		n := p.Expression()
+		path := tomlsrc.KeyPath(n)
+		switch {
+		case n.Kind == unstable.Table && len(path) == 2 && path[0] == "layer":
+			header[path[1]] = keyLine(&p, n)
+		case n.Kind == unstable.ArrayTable && len(path) == 3 && path[0] == "layer" && path[2] == "entity":
+			if _, ok := firstEntity[path[1]]; !ok {
+				firstEntity[path[1]] = keyLine(&p, n)
+			}
+		}
+	}
+	if err := p.Error(); err != nil {
+		return nil, nil, err
+	}
+
+	type edit struct {
+		at   int
+		text []string
+	}
+	var edits []edit
+	var changes []string
+	for _, name := range names {
+		if line, ok := header[name]; ok {
+			edits = append(edits, edit{line + 1, []string{`type = "entity"`}})
+		} else if line, ok := firstEntity[name]; ok {
+			key := name
+			if !bareKey.MatchString(key) {
+				key = strconv.Quote(key)
+			}
+			edits = append(edits, edit{line, []string{"[layer." + key + "]", `type = "entity"`, ""}})
+		} else {
+			changes = append(changes, fmt.Sprintf("layer %q: entities are written inline, set type = \"entity\" by hand", name))
+			continue
+		}
+		changes = append(changes, fmt.Sprintf("layer %q: set type = \"entity\"", name))
+	}
+
+	// Insert from the bottom up so earlier line numbers stay valid.
+	slices.SortFunc(edits, func(a, b edit) int { return b.at - a.at })
+	lines := splitLines(data)
+	for _, e := range edits {
+		lines = insertLines(lines, e.at, e.text...)
+	}
+	return joinLines(lines), changes, nil
+}
@@ -0,0 +1,240 @@
+// Package migrate upgrades rune files written for older versions of their
+// format. A file declares its version with a top-level format_version;
+// files without one are version 1. Each migration rewrites one format from
+// one version to the next, working on lines so comments and layout
+// survive.
+package migrate
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	toml "github.com/pelletier/go-toml/v2"
+	"github.com/pelletier/go-toml/v2/unstable"
+
+	"github.com/vgalaktionov/runefact/internal/format"
+	"github.com/vgalaktionov/runefact/internal/tomlsrc"
+)
+
+// Migration rewrites files of one format from version From to From+1.
+type Migration struct {
+	Ext         string // file extension, e.g. ".map"
+	From        int
+	Description string
+	// Apply returns the migrated data and a line for each change made.
+	Apply func(data []byte) ([]byte, []string, error)
+}
+
+// registry holds every migration, in version order within a format.
+var registry = []Migration{
+	{".map", 1, "explicit entity layer types", mapEntityLayerTypes},
+	{".track", 1, "checked channel headers in pattern data", trackPatternHeaders},
+}
+
+// Migrations returns the registered migrations, in the order they apply.
+func Migrations() []Migration {
+	return registry
+}
+
+// Current returns the format version runefact reads and writes for files
+// with extension ext.
+func Current(ext string) int {
+	v := 1
+	for _, m := range registry {
+		if m.Ext == ext {
+			v = max(v, m.From+1)
+		}
+	}
+	return v
+}
+
+// Version returns the format_version declared in data, or 1 if there is
+// none. A file that isn't valid TOML returns the decode error.
+func Version(data []byte, filename string) (int, error) {
+	var header struct {
+		FormatVersion any `toml:"format_version"`
+	}
+	if err := toml.Unmarshal(tomlsrc.Normalize(data), &header); err != nil {
+		return 0, fmt.Errorf("%s: %w", filename, err)
+	}
+	switch v := header.FormatVersion.(type) {
+	case nil:
+		return 1, nil
+	case int64:
+		if v < 1 {
+			return 0, fmt.Errorf("%s: format_version must be 1 or more, got %d", filename, v)
+		}
+		return int(v), nil
+	default:
+		return 0, fmt.Errorf("%s: format_version must be a whole number, got %v", filename, v)
+	}
+}
+
+// Supported reports an error if version is newer than the current version
+// of the format of filename.
+func Supported(version int, filename string) error {
+	if cur := Current(filepath.Ext(filename)); version > cur {
+		return fmt.Errorf("%s: format_version %d is newer than this runefact supports (%d), update runefact", filename, version, cur)
+	}
+	return nil
+}
+
+// Result is the outcome of upgrading one file.
+type Result struct {
+	From, To int
+	Data     []byte
+	Changes  []string // what each migration did, in order
+}
+
+// Upgrade migrates the content of a rune file to the current version of
+// its format. A file already current is returned unchanged. A file newer
+// than the current version is an error rather than being downgraded. If
+// the file was formatted before, the upgraded file is too.
+func Upgrade(data []byte, filename string) (*Result, error) {
+	ext := filepath.Ext(filename)
+	if _, ok := format.Dirs[ext]; !ok {
+		return nil, fmt.Errorf("%s: not a rune file", filename)
+	}
+	from, err := Version(data, filename)
+	if err != nil {
+		return nil, err
+	}
+	cur := Current(ext)
+	if from > cur {
+		return nil, fmt.Errorf("%s: format_version %d is newer than this runefact supports (%d), refusing to downgrade", filename, from, cur)
+	}
+
+	r := &Result{From: from, To: cur, Data: data}
+	if from == cur {
+		return r, nil
+	}
+	formatted := false
+	if out, err := format.Source(data, ext); err == nil {
+		formatted = bytes.Equal(out, data)
+	}
+
+	for _, m := range registry {
+		if m.Ext != ext || m.From < from {
+			continue
+		}
+		out, changes, err := m.Apply(r.Data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: migrating to format_version %d: %w", filename, m.From+1, err)
+		}
+		r.Data = out
+		for _, c := range changes {
+			r.Changes = append(r.Changes, fmt.Sprintf("v%d -> v%d: %s", m.From, m.From+1, c))
+		}
+	}
+	r.Data = setVersion(r.Data, cur)
+	r.Changes = append(r.Changes, fmt.Sprintf("set format_version = %d", cur))
+
+	if formatted {
+		if out, err := format.Source(r.Data, ext); err == nil {
+			r.Data = out
+		}
+	}
+	return r, nil
+}
+
+var (
+	versionKey = regexp.MustCompile(`^format_version\s*=`)
+	tagsKey    = regexp.MustCompile(`^tags\s*=`)
+)
+
+// setVersion sets the top-level format_version of data, replacing the
+// existing key or adding one after the tags, which come first in a
+// formatted file.
+func setVersion(data []byte, version int) []byte {
+	lines := splitLines(data)
+	line := fmt.Sprintf("format_version = %d", version)
+
+	// Top-level keys all come before the first table header.
+	end := len(lines)
+	for i, l := range lines {
+		if strings.HasPrefix(strings.TrimSpace(l), "[") {
+			end = i
+			break
+		}
+	}
+	at := -1
+	for i := 0; i < end; i++ {
+		t := strings.TrimSpace(lines[i])
+		switch {
+		case versionKey.MatchString(t):
+			lines[i] = line + lineEnd(lines[i])
+			return joinLines(lines)
+		case at < 0 && tagsKey.MatchString(t):
+			at = closingBracket(lines, i) + 1
+		case at < 0 && t != "" && !strings.HasPrefix(t, "#"):
+			at = i
+		}
+	}
+	if at < 0 {
+		// No top-level keys: put it above the first table.
+		if end < len(lines) {
+			return joinLines(insertLines(lines, end, line, ""))
+		}
+		at = 0
+	}
+	return joinLines(insertLines(lines, at, line))
+}
+
+// closingBracket returns the line an array value starting on line i ends
+// on.
+func closingBracket(lines []string, i int) int {
+	depth := 0
+	for j := i; j < len(lines); j++ {
+		depth += strings.Count(lines[j], "[") - strings.Count(lines[j], "]")
+		if depth <= 0 {
+			return j
+		}
+	}
+	return i
+}
+
+// splitLines splits data into lines, each keeping a trailing "\r" if it
+// had one.
+func splitLines(data []byte) []string {
+	return strings.Split(string(data), "\n")
+}
+
+func joinLines(lines []string) []byte {
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// lineEnd returns "\r" for a line of a CRLF file.
+func lineEnd(line string) string {
+	if strings.HasSuffix(line, "\r") {
+		return "\r"
+	}
+	return ""
+}
+
+// insertLines inserts text before lines[at], matching the line endings
+// of the file.
+func insertLines(lines []string, at int, text ...string) []string {
+	eol := ""
+	if len(lines) > 0 {
+		eol = lineEnd(lines[0])
+	}
+	added := make([]string, len(text))
+	for i, t := range text {
+		added[i] = t + eol
+	}
+	out := make([]string, 0, len(lines)+len(text))
+	out = append(out, lines[:at]...)
+	out = append(out, added...)
+	return append(out, lines[at:]...)
+}
+
+// keyLine returns the 0-based line the key of a table header or key-value
+// starts on.
+func keyLine(p *unstable.Parser, n *unstable.Node) int {
+	it := n.Key()
+	it.Next()
+	return p.Shape(it.Node().Raw).Start.Line - 1
+}
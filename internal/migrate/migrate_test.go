@@ -0,0 +1,333 @@
+package migrate
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/vgalaktionov/runefact/internal/tilemap"
+	"github.com/vgalaktionov/runefact/internal/track"
+)
+
+func TestRegistry_Consecutive(t *testing.T) {
+	next := map[string]int{}
+	for _, m := range Migrations() {
+		want := max(next[m.Ext], 1)
+		if m.From != want {
+			t.Errorf("%s migration %q goes from %d, want %d", m.Ext, m.Description, m.From, want)
+		}
+		next[m.Ext] = m.From + 1
+	}
+	for ext, v := range next {
+		if Current(ext) != v {
+			t.Errorf("Current(%s) = %d, want %d", ext, Current(ext), v)
+		}
+	}
+	if Current(".palette") != 1 {
+		t.Errorf("Current(.palette) = %d, want 1", Current(".palette"))
+	}
+}
+
+func TestVersion(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    int
+		wantErr string
+	}{
+		{"tempo = 120\n", 1, ""},
+		{"format_version = 2\ntempo = 120\n", 2, ""},
+		{"format_version = 0\n", 0, "1 or more"},
+		{"format_version = \"2\"\n", 0, "whole number"},
+		{"format_version = \n", 0, "a.track"},
+	}
+	for _, tt := range tests {
+		got, err := Version([]byte(tt.input), "a.track")
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Version(%q) error = %v, want it to mention %q", tt.input, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Version(%q) = %d, %v; want %d", tt.input, got, err, tt.want)
+		}
+	}
+}
+
+func TestUpgrade_Current(t *testing.T) {
+	input := "name = \"lead\"\n\n[oscillator]\nwaveform = \"square\"\n"
+	r, err := Upgrade([]byte(input), "lead.inst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.From != 1 || r.To != 1 || string(r.Data) != input || len(r.Changes) != 0 {
+		t.Errorf("current file changed: %+v", r)
+	}
+}
+
+func TestUpgrade_RefusesDowngrade(t *testing.T) {
+	_, err := Upgrade([]byte("format_version = 99\ntile_size = 16\n"), "level.map")
+	if err == nil || !strings.Contains(err.Error(), "refusing to downgrade") {
+		t.Errorf("error = %v, want a downgrade refusal", err)
+	}
+	if err := Supported(99, "level.map"); err == nil {
+		t.Error("Supported accepted a newer version")
+	}
+	if err := Supported(Current(".map"), "level.map"); err != nil {
+		t.Errorf("Supported rejected the current version: %v", err)
+	}
+}
+
+func TestUpgrade_NotRuneFile(t *testing.T) {
+	if _, err := Upgrade([]byte("a = 1\n"), "notes.toml"); err == nil {
+		t.Error("expected an error for a non-rune file")
+	}
+}
+
+func TestSetVersion(t *testing.T) {
+	tests := []struct {
+		name, input, want string
+	}{
+		{"first key", "tile_size = 16\n", "format_version = 2\ntile_size = 16\n"},
+		{"after tags", "# level\ntags = [\n  \"a\",\n]\ntile_size = 16\n", "# level\ntags = [\n  \"a\",\n]\nformat_version = 2\ntile_size = 16\n"},
+		{"replace", "format_version = 1\ntile_size = 16\n", "format_version = 2\ntile_size = 16\n"},
+		{"only tables", "[tileset]\n_ = \"\"\n", "format_version = 2\n\n[tileset]\n_ = \"\"\n"},
+		{"crlf", "tile_size = 16\r\n", "format_version = 2\r\ntile_size = 16\r\n"},
+	}
+	for _, tt := range tests {
+		if got := string(setVersion([]byte(tt.input), 2)); got != tt.want {
+			t.Errorf("%s: got\n%q\nwant\n%q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMapEntityLayerTypes(t *testing.T) {
+	input := `tile_size = 16
+
+[tileset]
+g = "tiles:grass"
+
+[layer.ground]
+pixels = """
+gg
+"""
+
+# Spawn points.
+[layer.entities]
+
+[[layer.entities.entity]]
+type = "spawn"
+x = 0
+y = 0
+
+[[layer."npc layer".entity]]
+type = "npc"
+x = 1
+y = 0
+
+[layer.markers]
+type = "entity"
+
+[[layer.markers.entity]]
+type = "flag"
+x = 1
+y = 0
+`
+	r, err := Upgrade([]byte(input), "level.map")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `format_version = 2
+tile_size = 16
+
+[tileset]
+g = "tiles:grass"
+
+[layer.ground]
+pixels = """
+gg
+"""
+
+# Spawn points.
+[layer.entities]
+type = "entity"
+
+[[layer.entities.entity]]
+type = "spawn"
+x = 0
+y = 0
+
+[layer."npc layer"]
+type = "entity"
+
+[[layer."npc layer".entity]]
+type = "npc"
+x = 1
+y = 0
+
+[layer.markers]
+type = "entity"
+
+[[layer.markers.entity]]
+type = "flag"
+x = 1
+y = 0
+`
+	if string(r.Data) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", r.Data, want)
+	}
+	wantChanges := []string{
+		`v1 -> v2: layer "entities": set type = "entity"`,
+		`v1 -> v2: layer "npc layer": set type = "entity"`,
+		"set format_version = 2",
+	}
+	if strings.Join(r.Changes, "\n") != strings.Join(wantChanges, "\n") {
+		t.Errorf("changes = %q, want %q", r.Changes, wantChanges)
+	}
+
+	mf, _, err := tilemap.ParseMapFile(r.Data, "level.map")
+	if err != nil {
+		t.Fatalf("upgraded map doesn't parse: %v", err)
+	}
+	for _, l := range mf.Layers {
+		if l.Name != "ground" && l.Type != "entity" {
+			t.Errorf("layer %q type = %q, want entity", l.Name, l.Type)
+		}
+	}
+}
+
+func TestTrackPatternHeaders(t *testing.T) {
+	input := `tempo = 120
+optional_header = true
+
+[[channel]]
+name = "lead"
+instrument = "lead"
+
+[[channel]]
+name = "bass"
+instrument = "bass"
+
+[pattern.headerless]
+data = """
+C4 | C2
+--- | ---
+"""
+
+[pattern.old_labels]
+data = """
+melody | low
+E4 | E2
+"""
+
+[pattern.ok]
+data = """
+# lead | bass
+G4 | G2
+"""
+
+[song]
+sequence = ["headerless", "old_labels", "ok"]
+`
+	r, err := Upgrade([]byte(input), "song.track")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `format_version = 2
+tempo = 120
+
+[[channel]]
+name = "lead"
+instrument = "lead"
+
+[[channel]]
+name = "bass"
+instrument = "bass"
+
+[pattern.headerless]
+data = """
+lead | bass
+C4 | C2
+--- | ---
+"""
+
+[pattern.old_labels]
+data = """
+lead | bass
+E4 | E2
+"""
+
+[pattern.ok]
+data = """
+# lead | bass
+G4 | G2
+"""
+
+[song]
+sequence = ["headerless", "old_labels", "ok"]
+`
+	if string(r.Data) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", r.Data, want)
+	}
+	wantChanges := []string{
+		`v1 -> v2: pattern "headerless": added the channel header`,
+		`v1 -> v2: pattern "old_labels": replaced header "melody | low" with "lead | bass"`,
+		"v1 -> v2: removed optional_header",
+		"set format_version = 2",
+	}
+	if strings.Join(r.Changes, "\n") != strings.Join(wantChanges, "\n") {
+		t.Errorf("changes = %q, want %q", r.Changes, wantChanges)
+	}
+
+	tr, err := track.ParseTrack(r.Data, "song.track")
+	if err != nil {
+		t.Fatalf("upgraded track doesn't parse: %v", err)
+	}
+	for _, name := range []string{"headerless", "old_labels", "ok"} {
+		if rows := len(tr.Patterns[name].Rows); rows == 0 {
+			t.Errorf("pattern %q lost its rows", name)
+		}
+	}
+	if rows := len(tr.Patterns["headerless"].Rows); rows != 2 {
+		t.Errorf("headerless pattern has %d rows, want 2", rows)
+	}
+}
+
+// A formatted file stays formatted, with format_version in its canonical
+// place.
+func TestUpgrade_KeepsFormatting(t *testing.T) {
+	input := `tags = ["demo"]
+tempo = 120
+ticks_per_beat = 4
+
+[[channel]]
+name = "lead"
+instrument = "lead"
+
+[pattern.a]
+data = """
+C4
+"""
+`
+	r, err := Upgrade([]byte(input), "song.track")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `tags = ["demo"]
+format_version = 2
+tempo = 120
+ticks_per_beat = 4
+
+[[channel]]
+name = "lead"
+instrument = "lead"
+
+[pattern.a]
+data = """
+lead
+C4
+"""
+`
+	if string(r.Data) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", r.Data, want)
+	}
+}
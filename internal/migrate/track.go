@@ -0,0 +1,130 @@
+package migrate
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	toml "github.com/pelletier/go-toml/v2"
+	"github.com/pelletier/go-toml/v2/unstable"
+
+	"github.com/vgalaktionov/runefact/internal/tomlsrc"
+	"github.com/vgalaktionov/runefact/internal/track"
+)
+
+var optionalHeaderKey = regexp.MustCompile(`^optional_header\s*=`)
+
+// trackPatternHeaders gives every pattern the channel header version 2
+// tracks require. Version 1 skipped the first line of pattern data without
+// looking at it: a line of notes gets the header added above it, since it
+// was meant as a row, and a header with other labels is replaced. The
+// optional_header escape hatch is then no longer needed and is removed.
+func trackPatternHeaders(data []byte) ([]byte, []string, error) {
+	var raw struct {
+		OptionalHeader *bool `toml:"optional_header"`
+		Channel        []struct {
+			Name string `toml:"name"`
+		} `toml:"channel"`
+	}
+	if err := toml.Unmarshal(data, &raw); err != nil {
+		return nil, nil, err
+	}
+	channels := make([]string, len(raw.Channel))
+	for i, c := range raw.Channel {
+		channels[i] = c.Name
+	}
+	header := strings.Join(channels, " | ")
+
+	// Find where each pattern's data starts.
+	type start struct {
+		name  string
+		line  int // 0-based line the data starts on
+		quote string
+	}
+	var starts []start
+	var changes []string
+	var p unstable.Parser
+	p.Reset(data)
+	var table []string
+	for p.NextExpression() {
+		n := p.Expression()
+		switch n.Kind {
+		case unstable.Table, unstable.ArrayTable:
+			table = tomlsrc.KeyPath(n)
+		case unstable.KeyValue:
+			path := append(slices.Clone(table), tomlsrc.KeyPath(n)...)
+			if len(path) != 3 || path[0] != "pattern" || path[2] != "data" {
+				continue
+			}
+			v := n.Value()
+			value := p.Raw(v.Raw)
+			quote := string(value[:min(3, len(value))])
+			rest := value[len(quote):]
+			if (quote != `"""` && quote != `'''`) || !(bytes.HasPrefix(rest, []byte("\n")) || bytes.HasPrefix(rest, []byte("\r\n"))) {
+				changes = append(changes, fmt.Sprintf("pattern %q: data doesn't start on its own line, check its header by hand", path[1]))
+				continue
+			}
+			starts = append(starts, start{path[1], p.Shape(v.Raw).Start.Line, quote})
+		}
+	}
+	if err := p.Error(); err != nil {
+		return nil, nil, err
+	}
+
+	lines := splitLines(data)
+	if len(channels) > 0 {
+		// Edit from the bottom up so earlier line numbers stay valid.
+		slices.SortFunc(starts, func(a, b start) int { return b.line - a.line })
+		for _, s := range starts {
+			for k := s.line; k < len(lines); k++ {
+				text, closing, found := strings.Cut(strings.TrimSuffix(lines[k], "\r"), s.quote)
+				if strings.TrimSpace(text) == "" {
+					if found {
+						break // the data ends before any row
+					}
+					continue
+				}
+				switch {
+				case slices.Equal(splitLabels(text), channels):
+				case track.IsNoteRow(text):
+					lines = insertLines(lines, k, header)
+					changes = append(changes, fmt.Sprintf("pattern %q: added the channel header", s.name))
+				default:
+					if found {
+						closing = s.quote + closing
+					}
+					lines[k] = header + closing + lineEnd(lines[k])
+					changes = append(changes, fmt.Sprintf("pattern %q: replaced header %q with %q", s.name, strings.TrimSpace(text), header))
+				}
+				break
+			}
+		}
+	}
+
+	if raw.OptionalHeader != nil {
+		for i, l := range lines {
+			t := strings.TrimSpace(l)
+			if strings.HasPrefix(t, "[") {
+				break
+			}
+			if optionalHeaderKey.MatchString(t) {
+				lines = slices.Delete(lines, i, i+1)
+				changes = append(changes, "removed optional_header")
+				break
+			}
+		}
+	}
+	slices.Sort(changes)
+	return joinLines(lines), changes, nil
+}
+
+// splitLabels returns the labels of a header line, which may follow a "#".
+func splitLabels(text string) []string {
+	labels := strings.Split(strings.TrimPrefix(strings.TrimSpace(text), "#"), "|")
+	for i, l := range labels {
+		labels[i] = strings.TrimSpace(l)
+	}
+	return labels
+}
@@ -0,0 +1,258 @@
+// Package pack writes and reads .rfpack files, which hold all of a build's
+// artifacts in one file for release builds.
+//
+// A pack starts with a header and a table of contents, followed by the
+// data of each entry:
+//
+//	magic    "RFPK"
+//	version  uint8, 2
+//	cipher   uint8: 0 none, 1 xor, 2 aes-ctr
+//	check    [8]byte, identifies the key; zero without a cipher
+//	nonce    [16]byte, random for aes-ctr; zero otherwise
+//	count    uint32
+//	count times:
+//	  name   uint16 length, then the slash-separated path
+//	  offset uint64, from the start of the file
+//	  size   uint64
+//
+// Integers are little-endian. Only entry data is enciphered; names are
+// readable. The key is compiled into the game that reads the pack, so a
+// cipher keeps casual rippers out, not a determined reader.
+package pack
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/vgalaktionov/runefact/internal/atomicfile"
+)
+
+// FileName is the name of the pack a build writes to its output directory.
+const FileName = "assets.rfpack"
+
+const (
+	magic   = "RFPK"
+	version = 2
+)
+
+// Cipher is how entry data is enciphered.
+type Cipher string
+
+const (
+	CipherNone   Cipher = "none"
+	CipherXOR    Cipher = "xor"
+	CipherAESCTR Cipher = "aes-ctr"
+)
+
+// Ciphers lists every cipher in the order of their number in the header.
+var Ciphers = []Cipher{CipherNone, CipherXOR, CipherAESCTR}
+
+// Entry is one file in a pack.
+type Entry struct {
+	// Name is the file's path relative to the output directory, with
+	// forward slashes, as in the manifest.
+	Name string
+	Data []byte
+}
+
+// Write writes entries to path as a pack, enciphered with key. key must be
+// empty for CipherNone and non-empty otherwise.
+func Write(path string, entries []Entry, c Cipher, key []byte) error {
+	id := slices.Index(Ciphers, c)
+	if id < 0 {
+		return fmt.Errorf("unknown pack cipher %q", c)
+	}
+	if (c == CipherNone) != (len(key) == 0) {
+		if c == CipherNone {
+			return errors.New("a pack without a cipher takes no key")
+		}
+		return fmt.Errorf("pack cipher %s needs a key", c)
+	}
+
+	var toc bytes.Buffer
+	toc.WriteString(magic)
+	toc.WriteByte(version)
+	toc.WriteByte(byte(id))
+	check := keyCheck(c, key)
+	toc.Write(check[:])
+	// A fresh nonce gives every build its own key streams, so two packs
+	// written with the same key don't share one for an asset.
+	var nonce [16]byte
+	if c == CipherAESCTR {
+		rand.Read(nonce[:])
+	}
+	toc.Write(nonce[:])
+	binary.Write(&toc, binary.LittleEndian, uint32(len(entries)))
+	offset := uint64(toc.Len())
+	for _, e := range entries {
+		if len(e.Name) > 0xffff {
+			return fmt.Errorf("pack entry name too long: %.40s...", e.Name)
+		}
+		offset += 2 + uint64(len(e.Name)) + 16
+	}
+	for _, e := range entries {
+		binary.Write(&toc, binary.LittleEndian, uint16(len(e.Name)))
+		toc.WriteString(e.Name)
+		binary.Write(&toc, binary.LittleEndian, offset)
+		binary.Write(&toc, binary.LittleEndian, uint64(len(e.Data)))
+		offset += uint64(len(e.Data))
+	}
+
+	return atomicfile.Write(path, 0644, func(w io.Writer) error {
+		if _, err := w.Write(toc.Bytes()); err != nil {
+			return err
+		}
+		for _, e := range entries {
+			data := slices.Clone(e.Data)
+			crypt(c, key, nonce, e.Name, data)
+			if _, err := w.Write(data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Pack is an open pack file.
+type Pack struct {
+	f       *os.File
+	cipher  Cipher
+	key     []byte
+	nonce   [16]byte
+	entries map[string]tocEntry
+	names   []string
+}
+
+type tocEntry struct{ Offset, Size uint64 }
+
+// Open opens the pack at path, checking that key is the one it was
+// written with.
+func Open(path string, key []byte) (*Pack, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	p, err := read(f, key)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	p.f = f
+	return p, nil
+}
+
+func read(f *os.File, key []byte) (*Pack, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := uint64(fi.Size())
+	r := bufio.NewReader(f)
+	var hdr struct {
+		Magic   [4]byte
+		Version uint8
+		Cipher  uint8
+		Check   [8]byte
+		Nonce   [16]byte
+		Count   uint32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &hdr); err != nil || string(hdr.Magic[:]) != magic {
+		return nil, errors.New("not a runefact pack")
+	}
+	if hdr.Version != version {
+		return nil, fmt.Errorf("pack version %d is not supported", hdr.Version)
+	}
+	if int(hdr.Cipher) >= len(Ciphers) {
+		return nil, fmt.Errorf("unknown pack cipher %d", hdr.Cipher)
+	}
+	p := &Pack{cipher: Ciphers[hdr.Cipher], key: key, nonce: hdr.Nonce, entries: map[string]tocEntry{}}
+	if keyCheck(p.cipher, key) != hdr.Check {
+		return nil, errors.New("wrong pack key")
+	}
+	for range hdr.Count {
+		var n uint16
+		if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+			return nil, fmt.Errorf("reading table of contents: %w", err)
+		}
+		name := make([]byte, n)
+		var e tocEntry
+		if _, err := io.ReadFull(r, name); err != nil {
+			return nil, fmt.Errorf("reading table of contents: %w", err)
+		}
+		if err := binary.Read(r, binary.LittleEndian, &e); err != nil {
+			return nil, fmt.Errorf("reading table of contents: %w", err)
+		}
+		// Checked without adding, so a corrupt offset can't wrap around.
+		if e.Offset > size || e.Size > size-e.Offset {
+			return nil, fmt.Errorf("table of contents: %s runs past the end of the pack", name)
+		}
+		p.entries[string(name)] = e
+		p.names = append(p.names, string(name))
+	}
+	return p, nil
+}
+
+// Names returns the names of the pack's entries, in the order they were
+// written.
+func (p *Pack) Names() []string {
+	return p.names
+}
+
+// ReadFile returns the deciphered data of the entry called name.
+func (p *Pack) ReadFile(name string) ([]byte, error) {
+	e, ok := p.entries[name]
+	if !ok {
+		return nil, fmt.Errorf("%s: not in the pack", name)
+	}
+	data := make([]byte, e.Size)
+	if _, err := p.f.ReadAt(data, int64(e.Offset)); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	crypt(p.cipher, p.key, p.nonce, name, data)
+	return data, nil
+}
+
+// Close closes the pack file.
+func (p *Pack) Close() error {
+	return p.f.Close()
+}
+
+// crypt enciphers or deciphers data in place; both are the same operation
+// for xor and CTR mode. AES uses the SHA-256 of the key, and a counter
+// that starts from the SHA-256 of the pack's nonce and the entry name, so
+// no two entries of any packs share a key stream.
+func crypt(c Cipher, key []byte, nonce [16]byte, name string, data []byte) {
+	switch c {
+	case CipherXOR:
+		for i := range data {
+			data[i] ^= key[i%len(key)]
+		}
+	case CipherAESCTR:
+		k := sha256.Sum256(key)
+		block, _ := aes.NewCipher(k[:])
+		iv := sha256.Sum256(append(nonce[:], name...))
+		cipher.NewCTR(block, iv[:aes.BlockSize]).XORKeyStream(data, data)
+	}
+}
+
+// keyCheck returns the bytes that identify key in the header, so a wrong
+// key is an error instead of garbage data. They are hashed apart from the
+// AES key, so they give nothing of it away.
+func keyCheck(c Cipher, key []byte) [8]byte {
+	var check [8]byte
+	if c != CipherNone {
+		sum := sha256.Sum256(append([]byte("rfpack key check:"), key...))
+		copy(check[:], sum[:])
+	}
+	return check
+}
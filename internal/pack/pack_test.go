@@ -0,0 +1,125 @@
+package pack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestWriteOpen(t *testing.T) {
+	entries := []Entry{
+		{Name: "sprites/player.png", Data: []byte("\x89PNG player sheet")},
+		{Name: "audio/jump.wav", Data: []byte("RIFF jump")},
+		{Name: "maps/empty.json", Data: nil},
+	}
+	for _, c := range Ciphers {
+		t.Run(string(c), func(t *testing.T) {
+			var key []byte
+			if c != CipherNone {
+				key = []byte("s3cret")
+			}
+			path := filepath.Join(t.TempDir(), FileName)
+			if err := Write(path, entries, c, key); err != nil {
+				t.Fatal(err)
+			}
+			raw, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hidden := !bytes.Contains(raw, []byte("player sheet")); hidden != (c != CipherNone) {
+				t.Errorf("data readable in the file = %v, want %v", !hidden, c == CipherNone)
+			}
+
+			p, err := Open(path, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer p.Close()
+			if got := p.Names(); !slices.Equal(got, []string{"sprites/player.png", "audio/jump.wav", "maps/empty.json"}) {
+				t.Errorf("Names = %v", got)
+			}
+			for _, e := range entries {
+				got, err := p.ReadFile(e.Name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, e.Data) {
+					t.Errorf("%s = %q, want %q", e.Name, got, e.Data)
+				}
+			}
+			if _, err := p.ReadFile("sprites/enemy.png"); err == nil {
+				t.Error("expected an error for a missing entry")
+			}
+		})
+	}
+}
+
+// Two packs written with the same key must not share a key stream, or
+// XORing them gives away the XOR of their plaintexts.
+func TestWrite_FreshNonce(t *testing.T) {
+	dir := t.TempDir()
+	entries := []Entry{{Name: "sprites/player.png", Data: bytes.Repeat([]byte{0}, 64)}}
+	var data [2][]byte
+	for i := range data {
+		path := filepath.Join(dir, fmt.Sprintf("%d.rfpack", i))
+		if err := Write(path, entries, CipherAESCTR, []byte("s3cret")); err != nil {
+			t.Fatal(err)
+		}
+		p, err := Open(path, []byte("s3cret"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		e := p.entries[entries[0].Name]
+		p.Close()
+		raw, _ := os.ReadFile(path)
+		data[i] = raw[e.Offset:]
+	}
+	if bytes.Equal(data[0], data[1]) {
+		t.Error("two builds enciphered an asset with the same key stream")
+	}
+}
+
+func TestOpen_Errors(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, FileName)
+	if err := Write(path, []Entry{{Name: "a", Data: []byte("a")}}, CipherAESCTR, []byte("right")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path, []byte("wrong")); err == nil || !strings.Contains(err.Error(), "wrong pack key") {
+		t.Errorf("got %v, want a wrong key error", err)
+	}
+
+	notPack := filepath.Join(dir, "manifest.go")
+	os.WriteFile(notPack, []byte("package assets\n"), 0644)
+	if _, err := Open(notPack, nil); err == nil || !strings.Contains(err.Error(), "not a runefact pack") {
+		t.Errorf("got %v, want a not a pack error", err)
+	}
+
+	// Entries past the end of the file, whether the pack was cut short or
+	// its table of contents is corrupt, are rejected before any is read.
+	if err := Write(path, []Entry{{Name: "a", Data: []byte("abc")}}, CipherNone, nil); err != nil {
+		t.Fatal(err)
+	}
+	whole, _ := os.ReadFile(path)
+	huge := slices.Clone(whole)
+	binary.LittleEndian.PutUint64(huge[len(huge)-3-16:], 1<<63)
+	binary.LittleEndian.PutUint64(huge[len(huge)-3-8:], 1<<63)
+	for name, data := range map[string][]byte{"short": whole[:len(whole)-1], "huge": huge} {
+		os.WriteFile(path, data, 0644)
+		if _, err := Open(path, nil); err == nil || !strings.Contains(err.Error(), "a runs past the end of the pack") {
+			t.Errorf("%s: got %v, want a past the end error", name, err)
+		}
+	}
+
+	if err := Write(path, nil, CipherXOR, nil); err == nil {
+		t.Error("expected an error for xor without a key")
+	}
+	if err := Write(path, nil, "rot13", []byte("k")); err == nil {
+		t.Error("expected an error for an unknown cipher")
+	}
+}
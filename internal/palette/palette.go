@@ -1,14 +1,19 @@
 package palette
 
 import (
+	"errors"
 	"fmt"
 	"image/color"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 
 	toml "github.com/pelletier/go-toml/v2"
+
+	"github.com/vgalaktionov/runefact/internal/tomlsrc"
 )
 
 // Color represents an RGBA color value.
@@ -30,16 +35,21 @@ func (c Color) IsTransparent() bool {
 type Palette struct {
 	Name   string
 	Colors map[string]Color
+	// Aliases are readable names for colors, from [aliases]: each names a
+	// key of Colors or a hex color, as written.
+	Aliases map[string]string
 }
 
 // rawPalette is the TOML-level structure.
 type rawPalette struct {
-	Name   string            `toml:"name"`
-	Colors map[string]string `toml:"colors"`
+	Name    string            `toml:"name"`
+	Colors  map[string]string `toml:"colors"`
+	Aliases map[string]string `toml:"aliases"`
 }
 
 // ParsePalette parses .palette file content.
 func ParsePalette(data []byte, filename string) (*Palette, error) {
+	data = tomlsrc.Normalize(data)
 	var raw rawPalette
 	if err := toml.Unmarshal(data, &raw); err != nil {
 		return nil, fmt.Errorf("%s: %w", filename, err)
@@ -62,9 +72,77 @@ func ParsePalette(data []byte, filename string) (*Palette, error) {
 		p.Colors[key] = c
 	}
 
+	for name, target := range raw.Aliases {
+		if _, ok := p.Colors[name]; ok {
+			return nil, fmt.Errorf("%s: alias %q is also a color key", filename, name)
+		}
+		if strings.HasPrefix(target, "#") {
+			if _, err := ParseHexColor(target); err != nil {
+				return nil, fmt.Errorf("%s: alias %q: %w", filename, name, err)
+			}
+		} else if _, ok := p.Colors[target]; !ok {
+			msg := fmt.Sprintf("%s: alias %q: %q is not a color key or a hex color", filename, name, target)
+			if suggestion := suggestName(target, slices.Collect(maps.Keys(p.Colors))); suggestion != "" {
+				msg += fmt.Sprintf(" (did you mean %q?)", suggestion)
+			}
+			return nil, errors.New(msg)
+		}
+	}
+	p.Aliases = raw.Aliases
+
 	return p, nil
 }
 
+// Lookup returns the color s names: a hex color, an alias or a color key.
+func (p *Palette) Lookup(s string) (Color, error) {
+	if strings.HasPrefix(s, "#") {
+		return ParseHexColor(s)
+	}
+	if target, ok := p.Aliases[s]; ok {
+		s = target
+		if strings.HasPrefix(s, "#") {
+			return ParseHexColor(s)
+		}
+	}
+	if c, ok := p.Colors[s]; ok {
+		return c, nil
+	}
+	msg := fmt.Sprintf("unknown color %q: not a hex color, or an alias or key of palette %q", s, p.Name)
+	if suggestion := suggestName(s, p.Names()); suggestion != "" {
+		msg += fmt.Sprintf(" (did you mean %q?)", suggestion)
+	}
+	return Color{}, errors.New(msg)
+}
+
+// LookupAny returns the color s names, for a setting with no palette of
+// its own: a hex color, or an alias or key of the first of palettes that
+// has it.
+func LookupAny(s string, palettes []*Palette) (Color, error) {
+	if strings.HasPrefix(s, "#") {
+		return ParseHexColor(s)
+	}
+	var names []string
+	for _, p := range palettes {
+		if c, err := p.Lookup(s); err == nil {
+			return c, nil
+		}
+		names = append(names, p.Names()...)
+	}
+	msg := fmt.Sprintf("unknown color %q: not a hex color, or an alias or key of any palette", s)
+	if suggestion := suggestName(s, names); suggestion != "" {
+		msg += fmt.Sprintf(" (did you mean %q?)", suggestion)
+	}
+	return Color{}, errors.New(msg)
+}
+
+// Names returns the palette's aliases and color keys, sorted.
+func (p *Palette) Names() []string {
+	names := slices.Collect(maps.Keys(p.Aliases))
+	names = append(names, slices.Collect(maps.Keys(p.Colors))...)
+	slices.Sort(names)
+	return names
+}
+
 // LoadPalette reads and parses a .palette file from disk.
 func LoadPalette(path string) (*Palette, error) {
 	data, err := os.ReadFile(path)
@@ -162,6 +240,19 @@ func SuggestSimilarKey(unknown string, available []string) string {
 	return best
 }
 
+// suggestName returns the name closest to unknown, if it is off by at most
+// a third of its length, so a misspelled name isn't matched to a one-letter
+// key.
+func suggestName(unknown string, names []string) string {
+	best, bestDist := "", len(unknown)/3+1
+	for _, name := range names {
+		if d := levenshtein(unknown, name); d < bestDist {
+			best, bestDist = name, d
+		}
+	}
+	return best
+}
+
 func levenshtein(a, b string) int {
 	la, lb := len(a), len(b)
 	if la == 0 {
@@ -3,6 +3,7 @@ package palette
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -45,6 +46,29 @@ func TestParseHexColor_Invalid(t *testing.T) {
 	}
 }
 
+// FuzzParseHexColor checks that no color string panics, and that one that
+// parses has a valid length and full alpha unless it gave one.
+func FuzzParseHexColor(f *testing.F) {
+	for _, seed := range []string{"#f00", "#ff004d", "#ff004d80", "#xyz", "ff0000", "#", "#+ff", "#0x1", "#é", "#\xff\xff\xff"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, hex string) {
+		c, err := ParseHexColor(hex)
+		if err != nil {
+			return
+		}
+		switch len(hex) {
+		case 4, 7:
+			if c.A != 255 {
+				t.Errorf("%q: alpha %d, want 255", hex, c.A)
+			}
+		case 9:
+		default:
+			t.Errorf("%q parsed with length %d", hex, len(hex))
+		}
+	})
+}
+
 func TestParsePalette_Default(t *testing.T) {
 	input := []byte(`name = "default"
 
@@ -95,6 +119,56 @@ rb = "#4400ff"
 	}
 }
 
+func TestParsePalette_Aliases(t *testing.T) {
+	p, err := ParsePalette([]byte(`name = "pico"
+[colors]
+k = "#000000"
+n = "#1d2b53"
+[aliases]
+ink = "k"
+navy = "n"
+paper = "#fff1e8"
+`), "pico.palette")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]Color{
+		"ink":     {A: 255},
+		"navy":    {R: 0x1d, G: 0x2b, B: 0x53, A: 255},
+		"paper":   {R: 0xff, G: 0xf1, B: 0xe8, A: 255},
+		"k":       {A: 255},
+		"#ff0000": {R: 255, A: 255},
+	} {
+		if c, err := p.Lookup(name); err != nil || c != want {
+			t.Errorf("Lookup(%q) = %v, %v; want %v", name, c, err, want)
+		}
+	}
+	if _, err := p.Lookup("nvy"); err == nil || err.Error() != `unknown color "nvy": not a hex color, or an alias or key of palette "pico" (did you mean "navy"?)` {
+		t.Errorf("Lookup(nvy) err = %v", err)
+	}
+	if _, err := p.Lookup("q"); err == nil || strings.Contains(err.Error(), "did you mean") {
+		t.Errorf("Lookup(q) err = %v, want no suggestion", err)
+	}
+
+	other := &Palette{Name: "other", Aliases: map[string]string{"sky": "#29adff"}}
+	if c, err := LookupAny("sky", []*Palette{p, other}); err != nil || c != (Color{R: 0x29, G: 0xad, B: 0xff, A: 255}) {
+		t.Errorf("LookupAny(sky) = %v, %v", c, err)
+	}
+	if _, err := LookupAny("inc", []*Palette{p, other}); err == nil || !strings.Contains(err.Error(), `any palette (did you mean "ink"?)`) {
+		t.Errorf("LookupAny(inc) err = %v", err)
+	}
+
+	for src, want := range map[string]string{
+		"[colors]\nk = \"#000\"\n[aliases]\nk = \"#fff\"":   `pico.palette: alias "k" is also a color key`,
+		"[colors]\nkb = \"#000\"\n[aliases]\nink = \"kbb\"": `pico.palette: alias "ink": "kbb" is not a color key or a hex color (did you mean "kb"?)`,
+		"[aliases]\nink = \"#12\"":                          `pico.palette: alias "ink": invalid hex color length: #12 (expected 3, 6, or 8 hex digits)`,
+	} {
+		if _, err := ParsePalette([]byte(src), "pico.palette"); err == nil || err.Error() != want {
+			t.Errorf("%q: err = %v, want %q", src, err, want)
+		}
+	}
+}
+
 func TestParsePalette_InvalidColor(t *testing.T) {
 	input := []byte(`name = "bad"
 
@@ -189,3 +263,14 @@ func TestColor_ToRGBA(t *testing.T) {
 		t.Errorf("ToRGBA = %+v, want {255,128,64,200}", rgba)
 	}
 }
+
+func TestParsePalette_BOM(t *testing.T) {
+	input := []byte("\ufeffname = \"default\"\r\n\r\n[colors]\r\nk = \"#000000\"\r\n")
+	p, err := ParsePalette(input, "default.palette")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.Colors["k"]; p.Name != "default" || !ok {
+		t.Errorf("got %+v, want palette default with k", p)
+	}
+}
@@ -0,0 +1,133 @@
+package palette
+
+import (
+	"regexp"
+	"strings"
+)
+
+// colorPair matches a `key = "value"` pair with a bare or quoted key, and
+// colorLine such a pair at the start of a line.
+var (
+	colorPair = regexp.MustCompile(`([A-Za-z0-9_-]+|"[^"]*"|'[^']*')(\s*=\s*)"([^"\\]*)"`)
+	colorLine = regexp.MustCompile(`^\s*` + colorPair.String())
+)
+
+// RecolorSource rewrites color values in the [colors] table of a .palette
+// file (ext ".palette") or the palette_extend tables of a .sprite file (ext
+// ".sprite"), including inline palette_extend = { ... } tables. Every value
+// for which replace returns true is set to to; all other bytes are kept.
+// It returns the new source and the number of values replaced.
+func RecolorSource(data []byte, ext string, replace func(key, value string) bool, to string) ([]byte, int) {
+	count := 0
+	out := editPairs(data, colorTables(ext), ext == ".sprite", func(s string, m []int, _ bool) string {
+		return recolorPair(s, m, replace, to, &count)
+	})
+	return out, count
+}
+
+// RemoveColorsSource deletes the keys for which remove returns true from
+// the same tables RecolorSource edits. A table entry loses its whole line,
+// an inline table entry the pair and its comma. It returns the new source
+// and the number of keys removed.
+func RemoveColorsSource(data []byte, ext string, remove func(key string) bool) ([]byte, int) {
+	count := 0
+	out := editPairs(data, colorTables(ext), ext == ".sprite", func(s string, m []int, inline bool) string {
+		if !remove(strings.Trim(s[m[2]:m[3]], `"'`)) {
+			return s
+		}
+		count++
+		if !inline {
+			return ""
+		}
+		before, after := s[:m[0]], s[m[1]:]
+		if rest := strings.TrimLeft(after, " \t"); strings.HasPrefix(rest, ",") {
+			return before + strings.TrimLeft(rest[1:], " \t")
+		}
+		if trimmed := strings.TrimRight(before, " \t"); strings.HasSuffix(trimmed, ",") {
+			return strings.TrimSuffix(trimmed, ",") + after
+		}
+		return before + after
+	})
+	return out, count
+}
+
+// RetargetAliasesSource points each alias in the [aliases] table of a
+// .palette file whose target is a key of renames at the key it maps to.
+// It returns the new source and the number of aliases changed.
+func RetargetAliasesSource(data []byte, renames map[string]string) ([]byte, int) {
+	count := 0
+	out := editPairs(data, func(name string) bool { return name == "aliases" }, false, func(s string, m []int, _ bool) string {
+		to, ok := renames[s[m[6]:m[7]]]
+		if !ok {
+			return s
+		}
+		count++
+		return s[:m[6]] + to + s[m[7]:]
+	})
+	return out, count
+}
+
+// editPairs calls edit for every key = "value" pair in the tables of data
+// for which inTable is true, and with inlineExtend in inline
+// palette_extend tables, and puts what it returns in place of the text it
+// was given. s is the pair's whole line for a table entry, or the rest of
+// the line from the { for an inline table, which is passed back to front
+// so earlier offsets stay valid; m is the colorPair match in s.
+func editPairs(data []byte, inTable func(name string) bool, inlineExtend bool, edit func(s string, m []int, inline bool) string) []byte {
+	lines := strings.SplitAfter(string(data), "\n")
+	editing, inString := false, false
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if inString {
+			inString = strings.Count(line, `"""`)%2 == 0
+			continue
+		}
+		if strings.Count(line, `"""`)%2 == 1 {
+			inString = true
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(trimmed, "["):
+			editing = inTable(strings.Trim(strings.SplitN(trimmed, "]", 2)[0], "[ "))
+		case editing:
+			if m := colorLine.FindStringSubmatchIndex(line); m != nil {
+				lines[i] = edit(line, m, false)
+			}
+		case inlineExtend && strings.HasPrefix(trimmed, "palette_extend") && strings.Contains(trimmed, "{"):
+			start := strings.Index(line, "{")
+			head, tail := line[:start], line[start:]
+			ms := colorPair.FindAllStringSubmatchIndex(tail, -1)
+			for j := len(ms) - 1; j >= 0; j-- {
+				tail = edit(tail, ms[j], true)
+			}
+			lines[i] = head + tail
+		}
+	}
+	return []byte(strings.Join(lines, ""))
+}
+
+// colorTables returns whether a table header of a file with extension ext
+// holds color values.
+func colorTables(ext string) func(name string) bool {
+	return func(name string) bool {
+		switch ext {
+		case ".palette":
+			return name == "colors"
+		case ".sprite":
+			return name == "palette_extend" || strings.HasSuffix(name, ".palette_extend")
+		}
+		return false
+	}
+}
+
+// recolorPair replaces the value of the pair matched at m in s if replace
+// accepts it.
+func recolorPair(s string, m []int, replace func(key, value string) bool, to string, count *int) string {
+	key := strings.Trim(s[m[2]:m[3]], `"'`)
+	if !replace(key, s[m[6]:m[7]]) {
+		return s
+	}
+	*count++
+	return s[:m[6]] + to + s[m[7]:]
+}
@@ -0,0 +1,88 @@
+package palette
+
+import "testing"
+
+func TestRecolorSource(t *testing.T) {
+	byValue := func(key, value string) bool { return value == "#7e2553" }
+	tests := []struct {
+		name, ext, in, want string
+		count               int
+	}{
+		{
+			name:  "palette colors",
+			ext:   ".palette",
+			in:    "name = \"#7e2553\"\n[colors]\np = \"#7e2553\" # shadow\nk = \"#000000\"\n\"q\" = \"#7e2553\"\n",
+			want:  "name = \"#7e2553\"\n[colors]\np = \"#6a1f46\" # shadow\nk = \"#000000\"\n\"q\" = \"#6a1f46\"\n",
+			count: 2,
+		},
+		{
+			name:  "sprite palette_extend tables",
+			ext:   ".sprite",
+			in:    "palette = \"p\"\npalette_extend = { a = \"#7e2553\", b = \"#fff\" }\n[palette_extend]\nc = \"#7e2553\"\n[sprite.x]\nnote = \"#7e2553\"\n[sprite.x.palette_extend]\nd = \"#7e2553\"\n",
+			want:  "palette = \"p\"\npalette_extend = { a = \"#6a1f46\", b = \"#fff\" }\n[palette_extend]\nc = \"#6a1f46\"\n[sprite.x]\nnote = \"#7e2553\"\n[sprite.x.palette_extend]\nd = \"#6a1f46\"\n",
+			count: 3,
+		},
+		{
+			name:  "pixel blocks are skipped",
+			ext:   ".sprite",
+			in:    "[palette_extend]\n[sprite.x]\npixels = \"\"\"\n[colors]\n\"\"\"\n[sprite.x.meta]\ne = \"#7e2553\"\n",
+			want:  "[palette_extend]\n[sprite.x]\npixels = \"\"\"\n[colors]\n\"\"\"\n[sprite.x.meta]\ne = \"#7e2553\"\n",
+			count: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, n := RecolorSource([]byte(tt.in), tt.ext, byValue, "#6a1f46")
+			if string(got) != tt.want || n != tt.count {
+				t.Errorf("got %d replacements:\n%s\nwant %d:\n%s", n, got, tt.count, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemoveColorsSource(t *testing.T) {
+	remove := func(key string) bool { return key == "g" || key == "h" }
+	tests := []struct {
+		name, ext, in, want string
+		count               int
+	}{
+		{
+			name:  "palette colors",
+			ext:   ".palette",
+			in:    "name = \"p\"\n[colors]\ne = \"#5f574f\"\ng = \"#5f574f\" # dup\n\"h\" = \"#5f574f\"\nk = \"#000\"\n",
+			want:  "name = \"p\"\n[colors]\ne = \"#5f574f\"\nk = \"#000\"\n",
+			count: 2,
+		},
+		{
+			name:  "inline palette_extend",
+			ext:   ".sprite",
+			in:    "palette_extend = { g = \"#1\", a = \"#2\", h = \"#3\" }\npalette_extend = { g = \"#1\" }\n",
+			want:  "palette_extend = { a = \"#2\" }\npalette_extend = {  }\n",
+			count: 3,
+		},
+		{
+			name:  "pixel blocks are skipped",
+			ext:   ".sprite",
+			in:    "[palette_extend]\ng = \"#1\"\n[sprite.x]\npixels = \"\"\"\ng = \"#1\"\n\"\"\"\n",
+			want:  "[palette_extend]\n[sprite.x]\npixels = \"\"\"\ng = \"#1\"\n\"\"\"\n",
+			count: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, n := RemoveColorsSource([]byte(tt.in), tt.ext, remove)
+			if string(got) != tt.want || n != tt.count {
+				t.Errorf("got %d removals:\n%s\nwant %d:\n%s", n, got, tt.count, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetargetAliasesSource(t *testing.T) {
+	in := "name = \"p\"\n[colors]\nkk = \"#000\"\n[aliases]\nink = \"kk\"\nshade = \"kk\" # dark\npaper = \"#fff\"\n"
+	want := "name = \"p\"\n[colors]\nkk = \"#000\"\n[aliases]\nink = \"k\"\nshade = \"k\" # dark\npaper = \"#fff\"\n"
+	got, n := RetargetAliasesSource([]byte(in), map[string]string{"kk": "k"})
+	if string(got) != want || n != 2 {
+		t.Errorf("got %d changes:\n%s\nwant 2:\n%s", n, got, want)
+	}
+}
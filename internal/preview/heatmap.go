@@ -0,0 +1,154 @@
+package preview
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"sort"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// heatmapBlinkTicks is how long a legend click blinks the matching pixels.
+const heatmapBlinkTicks = 120
+
+// legendEntry is one palette key in the heatmap legend.
+type legendEntry struct {
+	Key   string
+	Color color.RGBA
+	Count int
+}
+
+// heatmapLegend assigns a false color to every distinct non-transparent
+// palette key used across the given frames. Entries are ordered by pixel
+// count, most used first, so a stray key sits at the bottom of the legend.
+func heatmapLegend(frames [][][]string) []legendEntry {
+	counts := map[string]int{}
+	for _, rows := range frames {
+		for _, row := range rows {
+			for _, k := range row {
+				if k != "_" {
+					counts[k]++
+				}
+			}
+		}
+	}
+
+	legend := make([]legendEntry, 0, len(counts))
+	for k, n := range counts {
+		legend = append(legend, legendEntry{Key: k, Count: n})
+	}
+	sort.Slice(legend, func(i, j int) bool {
+		if legend[i].Count != legend[j].Count {
+			return legend[i].Count > legend[j].Count
+		}
+		return legend[i].Key < legend[j].Key
+	})
+	for i := range legend {
+		legend[i].Color = falseColor(i, len(legend))
+	}
+	return legend
+}
+
+// falseColor returns the i-th of n colors spread evenly around the hue
+// wheel. Beyond eight colors, alternate entries are darkened so that
+// neighbours on the wheel still differ in brightness.
+func falseColor(i, n int) color.RGBA {
+	h := float64(i) / float64(max(n, 1))
+	v := 1.0
+	if n > 8 && i%2 == 1 {
+		v = 0.6
+	}
+	return hsvToRGBA(h, 1, v)
+}
+
+func hsvToRGBA(h, s, v float64) color.RGBA {
+	h6 := math.Mod(h, 1) * 6
+	c := v * s
+	x := c * (1 - math.Abs(math.Mod(h6, 2)-1))
+	var r, g, b float64
+	switch int(h6) {
+	case 0:
+		r, g = c, x
+	case 1:
+		r, g = x, c
+	case 2:
+		g, b = c, x
+	case 3:
+		g, b = x, c
+	case 4:
+		r, b = x, c
+	default:
+		r, b = c, x
+	}
+	m := v - c
+	return color.RGBA{
+		R: uint8((r+m)*255 + 0.5),
+		G: uint8((g+m)*255 + 0.5),
+		B: uint8((b+m)*255 + 0.5),
+		A: 0xff,
+	}
+}
+
+// legendRow returns the screen position of legend row i and its height.
+func (p *Previewer) legendRow(i int) (x, y, h int) {
+	h = lineHeight() + 6
+	x = p.winW - 16*charWidth() - 10
+	y = 10 + 2*(lineHeight()+4) + i*h
+	return x, y, h
+}
+
+// legendHit returns the legend entry under the cursor, or -1.
+func (p *Previewer) legendHit(legend []legendEntry, mx, my int) int {
+	for i := range legend {
+		x, y, h := p.legendRow(i)
+		if mx >= x && mx < p.winW && my >= y && my < y+h {
+			return i
+		}
+	}
+	return -1
+}
+
+// drawHeatmap draws the key grid of the current frame in false colors, with
+// a legend on the right. Pixels of the blinking key flash white.
+func (p *Previewer) drawHeatmap(screen *ebiten.Image, s *RenderedSprite, frame int, z, ox, oy float64) {
+	if frame >= len(s.Keys) {
+		return
+	}
+	if p.pixel == nil {
+		p.pixel = ebiten.NewImage(1, 1)
+		p.pixel.Fill(color.White)
+	}
+
+	colors := map[string]color.RGBA{}
+	for _, e := range s.Legend {
+		colors[e.Key] = e.Color
+	}
+	blinkOn := p.blinkKey != "" && (p.blinkTicks/10)%2 == 0
+
+	for y, row := range s.Keys[frame] {
+		for x, k := range row {
+			c, ok := colors[k]
+			if !ok {
+				continue
+			}
+			op := &ebiten.DrawImageOptions{}
+			op.GeoM.Scale(z, z)
+			op.GeoM.Translate(ox+float64(x)*z, oy+float64(y)*z)
+			if !(blinkOn && k == p.blinkKey) {
+				op.ColorScale.ScaleWithColor(c)
+			}
+			screen.DrawImage(p.pixel, op)
+		}
+	}
+
+	for i, e := range s.Legend {
+		x, y, h := p.legendRow(i)
+		op := &ebiten.DrawImageOptions{}
+		op.GeoM.Scale(float64(h-6), float64(h-6))
+		op.GeoM.Translate(float64(x), float64(y))
+		op.ColorScale.ScaleWithColor(e.Color)
+		screen.DrawImage(p.pixel, op)
+		drawText(screen, fmt.Sprintf("%s %d", e.Key, e.Count), x+h, y)
+	}
+}
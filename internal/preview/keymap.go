@@ -0,0 +1,288 @@
+package preview
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"sort"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+// modeSet is a bitmask of preview modes.
+type modeSet uint8
+
+func modes(ms ...PreviewMode) modeSet {
+	var s modeSet
+	for _, m := range ms {
+		s |= 1 << m
+	}
+	return s
+}
+
+func (s modeSet) has(m PreviewMode) bool { return s&(1<<m) != 0 }
+
+var allModes = modes(ModeSpritePreview, ModeMapPreview, ModeSFXPreview, ModeMusicPreview)
+
+// actionDef describes one rebindable previewer action.
+type actionDef struct {
+	Name  string
+	Keys  []ebiten.Key // default bindings
+	Modes modeSet
+	Help  string
+}
+
+// actions is the single table of previewer key bindings. Update functions
+// look keys up by action name, [preview.keys] overrides are checked against
+// it, and the help overlay is generated from it.
+var actions = []actionDef{
+	{"cycle_background", []ebiten.Key{ebiten.KeyB}, allModes, "cycle background"},
+	{"help", []ebiten.Key{ebiten.KeySlash}, allModes, "show this help"},
+	{"toggle_grid", []ebiten.Key{ebiten.KeyG}, modes(ModeSpritePreview, ModeMapPreview), "toggle grid"},
+	{"zoom_in", []ebiten.Key{ebiten.KeyEqual}, modes(ModeSpritePreview, ModeMapPreview), "zoom in"},
+	{"zoom_out", []ebiten.Key{ebiten.KeyMinus}, modes(ModeSpritePreview, ModeMapPreview), "zoom out"},
+	{"pause", []ebiten.Key{ebiten.KeySpace}, modes(ModeSpritePreview), "pause/resume animation"},
+	{"next_frame", []ebiten.Key{ebiten.KeyArrowRight}, modes(ModeSpritePreview), "next frame (paused)"},
+	{"prev_frame", []ebiten.Key{ebiten.KeyArrowLeft}, modes(ModeSpritePreview), "previous frame (paused)"},
+	{"replay", []ebiten.Key{ebiten.KeyR}, modes(ModeSpritePreview), "replay animations from the first frame"},
+	{"escape", []ebiten.Key{ebiten.KeyEscape}, modes(ModeSpritePreview), "back to the sprite grid"},
+	{"interp_mode", []ebiten.Key{ebiten.KeyI}, modes(ModeSpritePreview), "cycle frame interpolation"},
+	{"interp_mix_down", []ebiten.Key{ebiten.KeyBracketLeft}, modes(ModeSpritePreview), "less interpolation blend"},
+	{"interp_mix_up", []ebiten.Key{ebiten.KeyBracketRight}, modes(ModeSpritePreview), "more interpolation blend"},
+	{"heatmap", []ebiten.Key{ebiten.KeyH}, modes(ModeSpritePreview), "toggle palette key heatmap"},
+	{"color_key", []ebiten.Key{ebiten.KeyK}, modes(ModeSpritePreview), "toggle transparent_color preview"},
+	{"hitboxes", []ebiten.Key{ebiten.KeyX}, modes(ModeSpritePreview), "toggle hitbox outlines"},
+	{"pan_up", []ebiten.Key{ebiten.KeyW, ebiten.KeyArrowUp}, modes(ModeMapPreview), "pan up"},
+	{"pan_down", []ebiten.Key{ebiten.KeyS, ebiten.KeyArrowDown}, modes(ModeMapPreview), "pan down"},
+	{"pan_left", []ebiten.Key{ebiten.KeyA, ebiten.KeyArrowLeft}, modes(ModeMapPreview), "pan left"},
+	{"pan_right", []ebiten.Key{ebiten.KeyD, ebiten.KeyArrowRight}, modes(ModeMapPreview), "pan right"},
+	{"toggle_layer", []ebiten.Key{ebiten.KeyDigit1, ebiten.KeyDigit2, ebiten.KeyDigit3, ebiten.KeyDigit4, ebiten.KeyDigit5, ebiten.KeyDigit6, ebiten.KeyDigit7, ebiten.KeyDigit8, ebiten.KeyDigit9}, modes(ModeMapPreview), "toggle tile layer 1-9"},
+	{"toggle_entities", []ebiten.Key{ebiten.KeyDigit0}, modes(ModeMapPreview), "toggle entity layers"},
+	{"cycle_layer", []ebiten.Key{ebiten.KeyTab}, modes(ModeMapPreview), "cycle solo layer"},
+	{"goto_tile", []ebiten.Key{ebiten.KeySemicolon}, modes(ModeMapPreview), "go to tile x,y"},
+	{"show_solid", []ebiten.Key{ebiten.KeyC}, modes(ModeMapPreview), "tint solid tiles"},
+	{"cycle_preset", []ebiten.Key{ebiten.KeyT}, modes(ModeMapPreview), "cycle tint presets"},
+	{"play", []ebiten.Key{ebiten.KeyEnter}, modes(ModeSFXPreview, ModeMusicPreview), "play/stop"},
+	{"play_pattern", []ebiten.Key{ebiten.KeyP}, modes(ModeMusicPreview), "loop the pattern under the cursor"},
+	{"next_pattern", []ebiten.Key{ebiten.KeyArrowRight}, modes(ModeMusicPreview), "move the cursor to the next pattern"},
+	{"prev_pattern", []ebiten.Key{ebiten.KeyArrowLeft}, modes(ModeMusicPreview), "move the cursor to the previous pattern"},
+	{"metronome", []ebiten.Key{ebiten.KeyT}, modes(ModeMusicPreview), "toggle the metronome click"},
+	{"cycle_view", []ebiten.Key{ebiten.KeyV}, modes(ModeSFXPreview), "cycle waveform view"},
+	{"select_bus", []ebiten.Key{ebiten.KeyTab}, modes(ModeMusicPreview), "select next bus"},
+	{"bus_volume_up", []ebiten.Key{ebiten.KeyEqual, ebiten.KeyNumpadAdd}, modes(ModeMusicPreview), "raise bus volume"},
+	{"bus_volume_down", []ebiten.Key{ebiten.KeyMinus, ebiten.KeyNumpadSubtract}, modes(ModeMusicPreview), "lower bus volume"},
+}
+
+// keyAliases maps punctuation to ebiten key names, so bindings can be
+// written as the character on the key.
+var keyAliases = map[string]string{
+	"+": "Equal", "=": "Equal", "-": "Minus",
+	"[": "BracketLeft", "]": "BracketRight",
+	"?": "Slash", "/": "Slash", ",": "Comma", ".": "Period",
+	";": "Semicolon", "'": "Quote", "`": "Backquote", `\`: "Backslash",
+}
+
+// keyGlyphs is how punctuation keys are shown in hints and the overlay.
+var keyGlyphs = map[ebiten.Key]string{
+	ebiten.KeyEqual: "+", ebiten.KeyMinus: "-",
+	ebiten.KeyBracketLeft: "[", ebiten.KeyBracketRight: "]",
+	ebiten.KeySlash: "?", ebiten.KeySemicolon: ":",
+	ebiten.KeyDigit0: "0", ebiten.KeyDigit1: "1", ebiten.KeyDigit2: "2",
+	ebiten.KeyDigit3: "3", ebiten.KeyDigit4: "4", ebiten.KeyDigit5: "5",
+	ebiten.KeyDigit6: "6", ebiten.KeyDigit7: "7", ebiten.KeyDigit8: "8",
+	ebiten.KeyDigit9: "9",
+}
+
+// Keymap binds action names to keys.
+type Keymap map[string][]ebiten.Key
+
+// DefaultKeymap returns the built-in bindings.
+func DefaultKeymap() Keymap {
+	km := make(Keymap, len(actions))
+	for _, a := range actions {
+		km[a.Name] = a.Keys
+	}
+	return km
+}
+
+// NewKeymap applies overrides, mapping action names to comma-separated key
+// names, on top of the defaults. It reports unknown actions, unknown key
+// names, and keys bound to two actions that are active in the same mode.
+func NewKeymap(overrides map[string]string) (Keymap, error) {
+	km := DefaultKeymap()
+	var errs []error
+
+	names := make([]string, 0, len(overrides))
+	for name := range overrides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, ok := km[name]; !ok {
+			errs = append(errs, fmt.Errorf("preview.keys: unknown action %q (known: %s)", name, strings.Join(actionNames(), ", ")))
+			continue
+		}
+		keys, err := parseKeys(overrides[name])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("preview.keys.%s: %w", name, err))
+			continue
+		}
+		km[name] = keys
+	}
+	if len(errs) == 0 {
+		errs = append(errs, km.conflicts()...)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return km, nil
+}
+
+func actionNames() []string {
+	names := make([]string, len(actions))
+	for i, a := range actions {
+		names[i] = a.Name
+	}
+	return names
+}
+
+func parseKeys(s string) ([]ebiten.Key, error) {
+	var keys []ebiten.Key
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if alias, ok := keyAliases[name]; ok {
+			name = alias
+		}
+		var k ebiten.Key
+		if name == "" || k.UnmarshalText([]byte(name)) != nil {
+			return nil, fmt.Errorf("unknown key name %q", name)
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// conflicts reports every key bound to two actions that share a mode.
+func (km Keymap) conflicts() []error {
+	var errs []error
+	for i, a := range actions {
+		for _, b := range actions[i+1:] {
+			if a.Modes&b.Modes == 0 {
+				continue
+			}
+			for _, k := range km[a.Name] {
+				for _, k2 := range km[b.Name] {
+					if k == k2 {
+						errs = append(errs, fmt.Errorf("preview.keys: %s is bound to both %s and %s", k, a.Name, b.Name))
+					}
+				}
+			}
+		}
+	}
+	return errs
+}
+
+// justPressed reports whether any key bound to action was pressed this tick.
+func (km Keymap) justPressed(action string) bool {
+	for _, k := range km[action] {
+		if inpututil.IsKeyJustPressed(k) {
+			return true
+		}
+	}
+	return false
+}
+
+// justPressedIndex returns the position in action's bindings of a key
+// pressed this tick, or -1 if none was, for actions whose keys each pick
+// something, like the layer toggles.
+func (km Keymap) justPressedIndex(action string) int {
+	for i, k := range km[action] {
+		if inpututil.IsKeyJustPressed(k) {
+			return i
+		}
+	}
+	return -1
+}
+
+// pressed reports whether any key bound to action is held down.
+func (km Keymap) pressed(action string) bool {
+	for _, k := range km[action] {
+		if ebiten.IsKeyPressed(k) {
+			return true
+		}
+	}
+	return false
+}
+
+// keyLabel formats an action's keys for display, e.g. "W/ArrowUp".
+func (km Keymap) keyLabel(action string) string {
+	names := make([]string, len(km[action]))
+	for i, k := range km[action] {
+		names[i] = k.String()
+		if g, ok := keyGlyphs[k]; ok {
+			names[i] = g
+		}
+	}
+	return strings.Join(names, "/")
+}
+
+// helpLines lists the actions available in mode with their current keys,
+// one per line.
+func (km Keymap) helpLines(mode PreviewMode) []string {
+	var active []actionDef
+	width := 0
+	for _, a := range actions {
+		if a.Modes.has(mode) {
+			active = append(active, a)
+			width = max(width, len(km.keyLabel(a.Name)))
+		}
+	}
+	lines := make([]string, len(active))
+	for i, a := range active {
+		lines[i] = fmt.Sprintf("%-*s  %s", width, km.keyLabel(a.Name), a.Help)
+	}
+	return lines
+}
+
+// updateHelp handles the help overlay. While it is open, the first key
+// press closes it and nothing else updates, so animations hold still. It
+// reports whether the overlay consumed this tick.
+func (p *Previewer) updateHelp() bool {
+	if p.showHelp {
+		if len(inpututil.AppendJustPressedKeys(nil)) > 0 {
+			p.showHelp = false
+		}
+		return true
+	}
+	if p.keys.justPressed("help") {
+		p.showHelp = true
+		return true
+	}
+	return false
+}
+
+// drawHelp draws the key bindings of the current mode on a translucent
+// panel.
+func (p *Previewer) drawHelp(screen *ebiten.Image) {
+	lines := append([]string{"Keys (press any key to close)", ""}, p.keys.helpLines(p.mode)...)
+	lineH := lineHeight() + 2
+	w := 0
+	for _, l := range lines {
+		w = max(w, textWidth(l))
+	}
+	x, y := 20, 20
+	if p.pixel == nil {
+		p.pixel = ebiten.NewImage(1, 1)
+		p.pixel.Fill(color.White)
+	}
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Scale(float64(w+20), float64(len(lines)*lineH+20))
+	op.GeoM.Translate(float64(x), float64(y))
+	op.ColorScale.ScaleWithColor(color.RGBA{R: 0x10, G: 0x10, B: 0x18, A: 0xc0})
+	screen.DrawImage(p.pixel, op)
+	for i, l := range lines {
+		drawText(screen, l, x+10, y+10+i*lineH)
+	}
+}
@@ -5,62 +5,140 @@ import (
 	"image"
 	"image/color"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 
 	"github.com/hajimehoshi/ebiten/v2"
-	"github.com/hajimehoshi/ebiten/v2/inpututil"
 
 	"github.com/vgalaktionov/runefact/internal/palette"
 	"github.com/vgalaktionov/runefact/internal/sprite"
 	"github.com/vgalaktionov/runefact/internal/tilemap"
 )
 
-// LayerVisibility tracks which layers are visible.
-type LayerVisibility int
+// LayerMask is a set of map layers: bit i is the i-th tile layer, and
+// EntityLayers is every entity layer together. Tile layers past the 63rd
+// share no bit and are always shown.
+type LayerMask uint64
 
-const (
-	LayerVisAll    LayerVisibility = iota
-	LayerVisEntity                         // entity layers only
-	// Additional values represent individual tile layer indices (starting at 2).
-)
+// EntityLayers is the bit of the entity layers.
+const EntityLayers LayerMask = 1 << 63
+
+// tileLayerBit returns the bit of the i-th tile layer, or 0 if it has none.
+func tileLayerBit(i int) LayerMask {
+	if i < 0 || i >= 63 {
+		return 0
+	}
+	return 1 << i
+}
+
+// soloMask returns the hidden set that shows only the solo-th view of a
+// map with tileLayers tile layers: 0 shows everything, 1 only the entity
+// layers, and 2 and up one tile layer each.
+func soloMask(solo, tileLayers int) LayerMask {
+	switch {
+	case solo <= 0 || solo > tileLayers+1:
+		return 0
+	case solo == 1:
+		return ^EntityLayers
+	default:
+		return ^tileLayerBit(solo - 2)
+	}
+}
 
 // MapPreviewState holds map preview state inside the Previewer.
 type MapPreviewState struct {
 	mapFile    *tilemap.MapFile
 	camX, camY float64
 	mapZoom    float64
-	layerVis   LayerVisibility
 	gridVis    bool
+	solidVis   bool // tint tiles marked solid in the tileset
 	layerCount int
 
+	// hidden is the layers toggled off; zero shows them all.
+	hidden LayerMask
+	// solo is where Tab's cycle through single layers is; see soloMask.
+	solo int
+
+	// preset is the tint preset layers are drawn with; "" uses each
+	// layer's own tint.
+	preset string
+
 	// tileImages maps tile ID (1+) to a rendered ebiten.Image of the tile sprite.
 	tileImages map[int]*ebiten.Image
 
+	// tileAnims holds every frame of tiles with animate = true.
+	tileAnims map[int]tileAnim
+
+	// tileWarnings lists tileset sprites whose size differs from tile_size.
+	tileWarnings []string
+
 	// entityImages maps "file:sprite" ref to a rendered ebiten.Image.
 	entityImages map[string]*ebiten.Image
+	// entityPivots holds the pivot of each entity sprite that has one.
+	entityPivots map[string]sprite.Pivot
+
+	// minimap is rebuilt with the rest of the state on every reload.
+	minimap *minimap
+
+	// Go-to-tile prompt.
+	gotoOpen bool
+	gotoText string
+	gotoErr  string
+}
+
+// tileAnim is the frames of an animated tile.
+type tileAnim struct {
+	frames []*ebiten.Image
+	fps    int
 }
 
 func (p *Previewer) initMapState(mf *tilemap.MapFile) {
+	p.swapMapState(p.newMapState(mf))
+}
+
+// newMapState loads the tile and entity images of mf. It reads no state
+// that Update changes, so reload can build the next map off the game loop.
+func (p *Previewer) newMapState(mf *tilemap.MapFile) *MapPreviewState {
 	tileLayerCount := 0
-	mapW, mapH := 0, 0
 	for _, l := range mf.Layers {
 		if l.Type == "tile" {
 			tileLayerCount++
-			if len(l.Data) > mapH {
-				mapH = len(l.Data)
-			}
-			if len(l.Data) > 0 && len(l.Data[0]) > mapW {
-				mapW = len(l.Data[0])
-			}
 		}
 	}
+	mapW, mapH := mf.Size()
+
+	// Load tile sprite images.
+	tileImages, tileAnims, tileColors, tileWarnings := p.loadTileImages(mf)
+
+	// Load entity sprite images.
+	entityImages, entityPivots := p.loadEntityImages(mf)
+
+	return &MapPreviewState{
+		mapFile:      mf,
+		layerCount:   tileLayerCount,
+		tileImages:   tileImages,
+		tileAnims:    tileAnims,
+		tileWarnings: tileWarnings,
+		entityImages: entityImages,
+		entityPivots: entityPivots,
+		minimap:      newMinimap(mf, mapW, mapH, tileColors),
+	}
+}
+
+// swapMapState makes ms the previewed map, zoomed to fill the window and
+// centered. The tint preset and the hidden layers carry over from the
+// previous map, so tints can be tuned while looking at them.
+func (p *Previewer) swapMapState(ms *MapPreviewState) {
+	mf := ms.mapFile
+	mapW, mapH := mf.Size()
 
 	// Auto-zoom to fill window, leaving room for the label.
 	zoom := 2.0
 	if mapW > 0 && mapH > 0 {
 		pixW := float64(mapW * mf.TileSize)
 		pixH := float64(mapH * mf.TileSize)
-		labelMargin := float64(scaledCharH() + 20)
+		labelMargin := float64(lineHeight() + 20)
 		zx := float64(p.winW) * 0.9 / pixW
 		zy := (float64(p.winH) - labelMargin) * 0.9 / pixH
 		zoom = min(zx, zy)
@@ -68,45 +146,28 @@ func (p *Previewer) initMapState(mf *tilemap.MapFile) {
 	}
 
 	// Center the map by offsetting camera.
-	camX := -(float64(p.winW) - float64(mapW*mf.TileSize)*zoom) / 2
-	camY := -(float64(p.winH) - float64(mapH*mf.TileSize)*zoom) / 2
-	if camY > 0 {
-		camY = 0
-	}
+	ms.mapZoom = zoom
+	ms.camX = -(float64(p.winW) - float64(mapW*mf.TileSize)*zoom) / 2
+	ms.camY = min(0, -(float64(p.winH)-float64(mapH*mf.TileSize)*zoom)/2)
 
-	// Load tile sprite images.
-	tileImages := p.loadTileImages(mf)
-
-	// Load entity sprite images.
-	entityImages := p.loadEntityImages(mf)
-
-	p.mapState = &MapPreviewState{
-		mapFile:      mf,
-		camX:         camX,
-		camY:         camY,
-		mapZoom:      zoom,
-		layerCount:   tileLayerCount,
-		tileImages:   tileImages,
-		entityImages: entityImages,
+	if p.mapState != nil {
+		if _, ok := mf.Presets[p.mapState.preset]; ok {
+			ms.preset = p.mapState.preset
+		}
+		ms.hidden, ms.solo = p.mapState.hidden, p.mapState.solo
 	}
+	p.mapState = ms
 }
 
-// loadTileImages resolves tileset references to actual sprite images.
-// It builds the same tile index as the parser to map tile IDs to sprite refs.
-func (p *Previewer) loadTileImages(mf *tilemap.MapFile) map[int]*ebiten.Image {
+// loadTileImages resolves tileset references to actual sprite images, the
+// frames of animated tiles, and average colors for the minimap, and checks
+// each sprite's size against tile_size. Images are keyed by the parser's
+// tile IDs.
+func (p *Previewer) loadTileImages(mf *tilemap.MapFile) (map[int]*ebiten.Image, map[int]tileAnim, map[int]color.RGBA, []string) {
 	images := make(map[int]*ebiten.Image)
-
-	// Rebuild the tile index (same logic as tilemap.buildTileIndex).
-	tileIndex := make(map[string]int)
-	nextID := 0
-	for key, ref := range mf.Tileset {
-		if ref == "" {
-			tileIndex[key] = 0
-		} else {
-			nextID++
-			tileIndex[key] = nextID
-		}
-	}
+	anims := make(map[int]tileAnim)
+	colors := make(map[int]color.RGBA)
+	var warnings []string
 
 	// Cache loaded sprite files to avoid reloading the same file.
 	type spriteCache struct {
@@ -118,7 +179,7 @@ func (p *Previewer) loadTileImages(mf *tilemap.MapFile) map[int]*ebiten.Image {
 		if ref == "" {
 			continue
 		}
-		id := tileIndex[key]
+		id := mf.TileIDs[key]
 
 		// Parse "file:sprite" reference.
 		parts := strings.SplitN(ref, ":", 2)
@@ -142,7 +203,7 @@ func (p *Previewer) loadTileImages(mf *tilemap.MapFile) map[int]*ebiten.Image {
 				if pal == nil {
 					pal = &palette.Palette{Colors: map[string]palette.Color{}}
 				}
-				rs, err := sf.Resolve(pal)
+				rs, err := sf.ResolveWith(pal, sprite.DirPartLoader(p.assetsDir), sprite.DirPaletteLoader(p.assetsDir))
 				if err == nil {
 					resolved.sprites = rs
 				}
@@ -150,22 +211,40 @@ func (p *Previewer) loadTileImages(mf *tilemap.MapFile) map[int]*ebiten.Image {
 			cache[fileName] = resolved
 		}
 
-		// Find the named sprite and render first frame.
+		// Find the named sprite and render first frame, or every frame
+		// of an animated tile.
 		for _, rs := range resolved.sprites {
 			if rs.Name == spriteName && len(rs.Frames) > 0 {
-				img := image.NewRGBA(image.Rect(0, 0, rs.Grid.W, rs.Grid.H))
-				for y, row := range rs.Frames[0].Pixels {
-					for x, c := range row {
-						img.Set(x, y, c.ToRGBA())
+				images[id] = frameImage(rs, 0)
+				colors[id] = averageColor(rs.Frames[0].Pixels)
+				if msg, bad := mf.CheckTileSize(key, rs.Grid.W, rs.Grid.H, p.allowOversizedTiles); bad {
+					warnings = append(warnings, msg)
+				}
+				if mf.TileProps[key].Animate && len(rs.Frames) > 1 && rs.Framerate > 0 {
+					anim := tileAnim{fps: rs.Framerate}
+					for i := range rs.Frames {
+						anim.frames = append(anim.frames, frameImage(rs, i))
 					}
+					anims[id] = anim
 				}
-				images[id] = ebiten.NewImageFromImage(img)
 				break
 			}
 		}
 	}
 
-	return images
+	sort.Strings(warnings)
+	return images, anims, colors, warnings
+}
+
+// frameImage renders one frame of a resolved sprite.
+func frameImage(rs sprite.ResolvedSprite, frame int) *ebiten.Image {
+	img := image.NewRGBA(image.Rect(0, 0, rs.Grid.W, rs.Grid.H))
+	for y, row := range rs.Frames[frame].Pixels {
+		for x, c := range row {
+			img.Set(x, y, c.ToRGBA())
+		}
+	}
+	return ebiten.NewImageFromImage(img)
 }
 
 func (p *Previewer) updateMap() {
@@ -174,38 +253,67 @@ func (p *Previewer) updateMap() {
 		return
 	}
 
+	// The go-to prompt takes all keys while open.
+	if p.updateGoto() {
+		return
+	}
+
 	speed := 4.0
-	if ebiten.IsKeyPressed(ebiten.KeyW) || ebiten.IsKeyPressed(ebiten.KeyArrowUp) {
+	if p.keys.pressed("pan_up") {
 		ms.camY -= speed
 	}
-	if ebiten.IsKeyPressed(ebiten.KeyS) || ebiten.IsKeyPressed(ebiten.KeyArrowDown) {
+	if p.keys.pressed("pan_down") {
 		ms.camY += speed
 	}
-	if ebiten.IsKeyPressed(ebiten.KeyA) || ebiten.IsKeyPressed(ebiten.KeyArrowLeft) {
+	if p.keys.pressed("pan_left") {
 		ms.camX -= speed
 	}
-	if ebiten.IsKeyPressed(ebiten.KeyD) || ebiten.IsKeyPressed(ebiten.KeyArrowRight) {
+	if p.keys.pressed("pan_right") {
 		ms.camX += speed
 	}
 
 	// Zoom.
 	_, dy := ebiten.Wheel()
-	if dy > 0 && ms.mapZoom < 16 {
+	if (dy > 0 || p.keys.justPressed("zoom_in")) && ms.mapZoom < 16 {
 		ms.mapZoom *= 1.5
-	} else if dy < 0 && ms.mapZoom > 0.25 {
+	} else if (dy < 0 || p.keys.justPressed("zoom_out")) && ms.mapZoom > 0.25 {
 		ms.mapZoom /= 1.5
 	}
 
-	// Tab: cycle layer visibility.
-	if inpututil.IsKeyJustPressed(ebiten.KeyTab) {
-		maxVis := LayerVisibility(2 + ms.layerCount) // all, entity, then each tile layer
-		ms.layerVis = (ms.layerVis + 1) % maxVis
+	// 1-9: toggle a tile layer; 0: toggle the entity layers.
+	if i := p.keys.justPressedIndex("toggle_layer"); i >= 0 && i < ms.layerCount {
+		ms.hidden ^= tileLayerBit(i)
+	}
+	if p.keys.justPressed("toggle_entities") {
+		ms.hidden ^= EntityLayers
+	}
+
+	// Tab: cycle solo, showing one layer at a time, then all again.
+	if p.keys.justPressed("cycle_layer") {
+		ms.solo = (ms.solo + 1) % (ms.layerCount + 2)
+		ms.hidden = soloMask(ms.solo, ms.layerCount)
 	}
 
 	// G: toggle grid.
-	if inpututil.IsKeyJustPressed(ebiten.KeyG) {
+	if p.keys.justPressed("toggle_grid") {
 		ms.gridVis = !ms.gridVis
 	}
+
+	// C: toggle the solid tile tint.
+	if p.keys.justPressed("show_solid") {
+		ms.solidVis = !ms.solidVis
+	}
+
+	// T: cycle tint presets, then back to the layers' own tints.
+	if p.keys.justPressed("cycle_preset") {
+		ms.preset = nextPreset(ms.mapFile.PresetNames(), ms.preset)
+	}
+
+	// Click or drag on the minimap: jump there.
+	p.updateMinimap()
+
+	// Advance tile animations.
+	p.frameTime += 1.0 / float64(ebiten.TPS())
 }
 
 func (p *Previewer) drawMap(screen *ebiten.Image) {
@@ -222,9 +330,7 @@ func (p *Previewer) drawMap(screen *ebiten.Image) {
 	tileLayerIdx := 0
 	for _, layer := range mf.Layers {
 		if layer.Type == "tile" {
-			visible := ms.layerVis == LayerVisAll ||
-				(ms.layerVis >= 2 && int(ms.layerVis)-2 == tileLayerIdx)
-			if visible {
+			if ms.hidden&tileLayerBit(tileLayerIdx) == 0 {
 				p.drawTileLayer(screen, layer, ts, z, ms.camX, ms.camY)
 			}
 			tileLayerIdx++
@@ -234,8 +340,7 @@ func (p *Previewer) drawMap(screen *ebiten.Image) {
 	// Draw entity layers.
 	for _, layer := range mf.Layers {
 		if layer.Type == "entity" {
-			visible := ms.layerVis == LayerVisAll || ms.layerVis == LayerVisEntity
-			if visible {
+			if ms.hidden&EntityLayers == 0 {
 				p.drawEntityLayer(screen, layer, ts, z, ms.camX, ms.camY)
 			}
 		}
@@ -248,19 +353,136 @@ func (p *Previewer) drawMap(screen *ebiten.Image) {
 
 	// Mode label.
 	label := "Map"
-	switch {
-	case ms.layerVis == LayerVisAll:
+	if ms.hidden == 0 {
 		label += " [All layers]"
-	case ms.layerVis == LayerVisEntity:
-		label += " [Entities]"
-	default:
-		label += fmt.Sprintf(" [Layer %d/%d]", int(ms.layerVis)-1, ms.layerCount)
+	} else {
+		label += fmt.Sprintf(" [%d/%d layers]", countVisible(mf, ms.hidden), len(mf.Layers))
+	}
+	if ms.solidVis {
+		label += " [Solid]"
+	}
+	if ms.preset != "" {
+		label += " [" + ms.preset + "]"
 	}
 	drawText(screen, label, 10, 10)
+	p.drawTileWarnings(screen)
+	p.drawLayerLegend(screen)
+
+	p.drawMinimap(screen)
+	p.drawGoto(screen)
+}
+
+// layerLegend lists the map's layers with the key that toggles each and a
+// mark if it is shown: tile layers in order, numbered from 1 (only the
+// first nine have a key), then the entity layers on 0.
+func layerLegend(mf *tilemap.MapFile, hidden LayerMask) []string {
+	mark := func(bit LayerMask) string {
+		if hidden&bit != 0 {
+			return "[ ]"
+		}
+		return "[x]"
+	}
+	var lines, entities []string
+	tile := 0
+	for _, l := range mf.Layers {
+		if l.Type != "tile" {
+			entities = append(entities, l.Name)
+			continue
+		}
+		key := " "
+		if tile < 9 {
+			key = fmt.Sprint(tile + 1)
+		}
+		lines = append(lines, fmt.Sprintf("%s %s %s", mark(tileLayerBit(tile)), key, l.Name))
+		tile++
+	}
+	if len(entities) > 0 {
+		lines = append(lines, fmt.Sprintf("%s 0 %s", mark(EntityLayers), strings.Join(entities, ", ")))
+	}
+	return lines
+}
+
+// countVisible returns how many of the map's layers hidden leaves shown.
+func countVisible(mf *tilemap.MapFile, hidden LayerMask) int {
+	n, tile := 0, 0
+	for _, l := range mf.Layers {
+		bit := EntityLayers
+		if l.Type == "tile" {
+			bit = tileLayerBit(tile)
+			tile++
+		}
+		if hidden&bit == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// drawLayerLegend lists the layers and whether each is shown in the top
+// right corner.
+func (p *Previewer) drawLayerLegend(screen *ebiten.Image) {
+	lines := layerLegend(p.mapState.mapFile, p.mapState.hidden)
+	w := 0
+	for _, l := range lines {
+		w = max(w, textWidth(l))
+	}
+	lineH := lineHeight() + 2
+	for i, l := range lines {
+		drawText(screen, l, p.winW-w-10, 10+i*lineH)
+	}
+}
+
+// maxTileWarnings is how many tile size warnings are listed before the
+// rest are summarized.
+const maxTileWarnings = 4
+
+// drawTileWarnings lists tile size mismatches under the mode label.
+func (p *Previewer) drawTileWarnings(screen *ebiten.Image) {
+	ws := p.mapState.tileWarnings
+	lineH := lineHeight() + 2
+	for i, w := range ws {
+		if i == maxTileWarnings {
+			drawText(screen, fmt.Sprintf("! ...and %d more (see runefact validate)", len(ws)-i), 10, 10+(i+1)*lineH)
+			break
+		}
+		drawText(screen, "! "+w, 10, 10+(i+1)*lineH)
+	}
+}
+
+// nextPreset returns the preset after current in names, or "" after the
+// last one.
+func nextPreset(names []string, current string) string {
+	i := slices.Index(names, current) + 1 // "" is not a preset, so -1 + 1
+	if i >= len(names) {
+		return ""
+	}
+	return names[i]
+}
+
+// applyTint multiplies op's colors by the layer tint, if any.
+func applyTint(op *ebiten.DrawImageOptions, t *tilemap.Tint) {
+	if t != nil {
+		op.ColorScale.ScaleWithColor(t.Color.ToRGBA())
+	}
+}
+
+// tintRGBA multiplies c by the layer tint, if any.
+func tintRGBA(c color.RGBA, t *tilemap.Tint) color.RGBA {
+	if t == nil {
+		return c
+	}
+	tc := t.Color
+	return color.RGBA{
+		R: uint8(uint16(c.R) * uint16(tc.R) / 255),
+		G: uint8(uint16(c.G) * uint16(tc.G) / 255),
+		B: uint8(uint16(c.B) * uint16(tc.B) / 255),
+		A: c.A,
+	}
 }
 
 func (p *Previewer) drawTileLayer(screen *ebiten.Image, layer tilemap.Layer, ts int, z, camX, camY float64) {
 	ms := p.mapState
+	tint := ms.mapFile.LayerTint(layer, ms.preset)
 
 	// Viewport culling.
 	startCol := max(0, int(camX/z)/ts-1)
@@ -284,7 +506,11 @@ func (p *Previewer) drawTileLayer(screen *ebiten.Image, layer tilemap.Layer, ts
 			sy := float64(y*ts)*z - camY
 
 			// Draw actual tile sprite if available.
-			if img, ok := ms.tileImages[tileID]; ok {
+			img, ok := ms.tileImages[tileID]
+			if anim, animated := ms.tileAnims[tileID]; animated {
+				img = anim.frames[int(p.frameTime*float64(anim.fps))%len(anim.frames)]
+			}
+			if ok {
 				op := &ebiten.DrawImageOptions{}
 				// Scale sprite to tile size * zoom.
 				imgW := float64(img.Bounds().Dx())
@@ -292,12 +518,13 @@ func (p *Previewer) drawTileLayer(screen *ebiten.Image, layer tilemap.Layer, ts
 				op.GeoM.Scale(float64(ts)/imgW*z, float64(ts)/imgH*z)
 				op.GeoM.Translate(sx, sy)
 				op.Filter = ebiten.FilterNearest
+				applyTint(op, tint)
 				screen.DrawImage(img, op)
 			} else {
 				// Fallback: colored rectangle.
 				w := float64(ts) * z
 				h := float64(ts) * z
-				c := tileColor(tileID)
+				c := tintRGBA(tileColor(tileID), tint)
 				for dy := 0; dy < int(h) && int(sy)+dy >= 0; dy++ {
 					for dx := 0; dx < int(w) && int(sx)+dx >= 0; dx++ {
 						px, py := int(sx)+dx, int(sy)+dy
@@ -307,10 +534,28 @@ func (p *Previewer) drawTileLayer(screen *ebiten.Image, layer tilemap.Layer, ts
 					}
 				}
 			}
+
+			if ms.solidVis && y < len(layer.Keys) && x < len(layer.Keys[y]) &&
+				ms.mapFile.TileProps[layer.Keys[y][x]].Solid {
+				p.tintTile(screen, sx, sy, float64(ts)*z)
+			}
 		}
 	}
 }
 
+// tintTile draws a translucent red square over a solid tile.
+func (p *Previewer) tintTile(screen *ebiten.Image, sx, sy, size float64) {
+	if p.pixel == nil {
+		p.pixel = ebiten.NewImage(1, 1)
+		p.pixel.Fill(color.White)
+	}
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Scale(size, size)
+	op.GeoM.Translate(sx, sy)
+	op.ColorScale.ScaleWithColor(color.RGBA{R: 0xe0, G: 0x30, B: 0x30, A: 0x80})
+	screen.DrawImage(p.pixel, op)
+}
+
 func tileColor(id int) color.RGBA {
 	colors := []color.RGBA{
 		{R: 0x4a, G: 0x9e, B: 0x4a, A: 0xff}, // green
@@ -324,8 +569,9 @@ func tileColor(id int) color.RGBA {
 }
 
 // loadEntityImages collects unique sprite refs from entity properties and loads them.
-func (p *Previewer) loadEntityImages(mf *tilemap.MapFile) map[string]*ebiten.Image {
+func (p *Previewer) loadEntityImages(mf *tilemap.MapFile) (map[string]*ebiten.Image, map[string]sprite.Pivot) {
 	images := make(map[string]*ebiten.Image)
+	pivots := make(map[string]sprite.Pivot)
 
 	// Collect unique sprite refs.
 	refs := make(map[string]bool)
@@ -369,7 +615,7 @@ func (p *Previewer) loadEntityImages(mf *tilemap.MapFile) map[string]*ebiten.Ima
 				if pal == nil {
 					pal = &palette.Palette{Colors: map[string]palette.Color{}}
 				}
-				rs, err := sf.Resolve(pal)
+				rs, err := sf.ResolveWith(pal, sprite.DirPartLoader(p.assetsDir), sprite.DirPaletteLoader(p.assetsDir))
 				if err == nil {
 					resolved.sprites = rs
 				}
@@ -386,16 +632,20 @@ func (p *Previewer) loadEntityImages(mf *tilemap.MapFile) map[string]*ebiten.Ima
 					}
 				}
 				images[ref] = ebiten.NewImageFromImage(img)
+				if rs.Pivot != nil {
+					pivots[ref] = *rs.Pivot
+				}
 				break
 			}
 		}
 	}
 
-	return images
+	return images, pivots
 }
 
 func (p *Previewer) drawEntityLayer(screen *ebiten.Image, layer tilemap.Layer, ts int, z, camX, camY float64) {
 	ms := p.mapState
+	tint := ms.mapFile.LayerTint(layer, ms.preset)
 
 	entityColors := map[string]color.RGBA{
 		"spawn":   {R: 0x00, G: 0xff, B: 0x00, A: 0xcc},
@@ -414,11 +664,19 @@ func (p *Previewer) drawEntityLayer(screen *ebiten.Image, layer tilemap.Layer, t
 			if s, ok := ref.(string); ok {
 				if img, ok := ms.entityImages[s]; ok {
 					op := &ebiten.DrawImageOptions{}
-					imgW := float64(img.Bounds().Dx())
-					imgH := float64(img.Bounds().Dy())
-					op.GeoM.Scale(float64(ts)/imgW*z, float64(ts)/imgH*z)
-					op.GeoM.Translate(sx, sy)
+					if pv, ok := ms.entityPivots[s]; ok {
+						// Anchored by its pivot at native size, as a game
+						// would draw it.
+						op.GeoM.Scale(z, z)
+						op.GeoM.Translate(sx-float64(pv.X)*z, sy-float64(pv.Y)*z)
+					} else {
+						imgW := float64(img.Bounds().Dx())
+						imgH := float64(img.Bounds().Dy())
+						op.GeoM.Scale(float64(ts)/imgW*z, float64(ts)/imgH*z)
+						op.GeoM.Translate(sx, sy)
+					}
 					op.Filter = ebiten.FilterNearest
+					applyTint(op, tint)
 					screen.DrawImage(img, op)
 					drawn = true
 				}
@@ -445,7 +703,7 @@ func (p *Previewer) drawEntityLayer(screen *ebiten.Image, layer tilemap.Layer, t
 		}
 
 		// Label.
-		drawText(screen, e.Type, int(sx), int(sy)-scaledCharH()-2)
+		drawText(screen, e.Type, int(sx), int(sy)-lineHeight()-2)
 	}
 }
 
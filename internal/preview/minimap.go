@@ -0,0 +1,239 @@
+package preview
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strconv"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+
+	"github.com/vgalaktionov/runefact/internal/palette"
+	"github.com/vgalaktionov/runefact/internal/tilemap"
+)
+
+// minimapMax caps the minimap's resolution in pixels on either side. Larger
+// maps are sampled, one pixel per block of tiles, so building the minimap
+// costs the same for any map size.
+const minimapMax = 160
+
+// minimap is a downscaled composite of a map's tile layers.
+type minimap struct {
+	img        *ebiten.Image
+	step       int // tiles per minimap pixel
+	w, h       int // size in minimap pixels
+	mapW, mapH int // size in tiles
+}
+
+// averageColor returns the mean color of a tile's opaque pixels.
+func averageColor(pixels [][]palette.Color) color.RGBA {
+	var r, g, b, n int
+	for _, row := range pixels {
+		for _, c := range row {
+			if c.A == 0 {
+				continue
+			}
+			r += int(c.R)
+			g += int(c.G)
+			b += int(c.B)
+			n++
+		}
+	}
+	if n == 0 {
+		return color.RGBA{}
+	}
+	return color.RGBA{R: uint8(r / n), G: uint8(g / n), B: uint8(b / n), A: 0xff}
+}
+
+// minimapPixels composites the tile layers into an image with one pixel per
+// step x step block of tiles, sampling the block's top-left tile. The
+// topmost non-empty tile wins. Tiles without a known color fall back to
+// tileColor.
+func minimapPixels(layers []tilemap.Layer, mapW, mapH int, colors map[int]color.RGBA) (*image.RGBA, int) {
+	step := 1
+	for (mapW+step-1)/step > minimapMax || (mapH+step-1)/step > minimapMax {
+		step++
+	}
+	w, h := (mapW+step-1)/step, (mapH+step-1)/step
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for _, layer := range layers {
+		if layer.Type != "tile" {
+			continue
+		}
+		for py := 0; py < h; py++ {
+			y := py * step
+			if y >= len(layer.Data) {
+				break
+			}
+			row := layer.Data[y]
+			for px := 0; px < w; px++ {
+				x := px * step
+				if x >= len(row) || row[x] == 0 {
+					continue
+				}
+				c, ok := colors[row[x]]
+				if !ok || c.A == 0 {
+					c = tileColor(row[x])
+				}
+				img.SetRGBA(px, py, c)
+			}
+		}
+	}
+	return img, step
+}
+
+func newMinimap(mf *tilemap.MapFile, mapW, mapH int, colors map[int]color.RGBA) *minimap {
+	if mapW == 0 || mapH == 0 {
+		return nil
+	}
+	img, step := minimapPixels(mf.Layers, mapW, mapH, colors)
+	return &minimap{
+		img:  ebiten.NewImageFromImage(img),
+		step: step,
+		w:    img.Bounds().Dx(),
+		h:    img.Bounds().Dy(),
+		mapW: mapW,
+		mapH: mapH,
+	}
+}
+
+// minimapRect returns the minimap's screen position and its magnification.
+// Small maps are enlarged so the minimap stays usable.
+func (p *Previewer) minimapRect(mm *minimap) (x, y, k int) {
+	k = max(1, minimapMax/max(mm.w, mm.h))
+	return p.winW - mm.w*k - 10, p.winH - mm.h*k - lineHeight() - 16, k
+}
+
+// centerOnTile moves the camera so that tile (tx, ty) is in the middle of
+// the window.
+func (p *Previewer) centerOnTile(tx, ty float64) {
+	ms := p.mapState
+	size := float64(ms.mapFile.TileSize) * ms.mapZoom
+	ms.camX = (tx+0.5)*size - float64(p.winW)/2
+	ms.camY = (ty+0.5)*size - float64(p.winH)/2
+}
+
+// updateMinimap jumps the camera to the point under the mouse while the
+// minimap is clicked or dragged. It reports whether the mouse was used.
+func (p *Previewer) updateMinimap() bool {
+	mm := p.mapState.minimap
+	if mm == nil || !ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft) {
+		return false
+	}
+	x, y, k := p.minimapRect(mm)
+	mx, my := ebiten.CursorPosition()
+	if mx < x || my < y || mx >= x+mm.w*k || my >= y+mm.h*k {
+		return false
+	}
+	p.centerOnTile(float64((mx-x)*mm.step)/float64(k), float64((my-y)*mm.step)/float64(k))
+	return true
+}
+
+// drawMinimap draws the minimap with the current viewport outlined.
+func (p *Previewer) drawMinimap(screen *ebiten.Image) {
+	ms := p.mapState
+	mm := ms.minimap
+	if mm == nil {
+		return
+	}
+	x, y, k := p.minimapRect(mm)
+
+	frame := color.RGBA{R: 0x60, G: 0x60, B: 0x60, A: 0xff}
+	strokeRect(screen, x-1, y-1, mm.w*k+2, mm.h*k+2, frame)
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Scale(float64(k), float64(k))
+	op.GeoM.Translate(float64(x), float64(y))
+	screen.DrawImage(mm.img, op)
+
+	// Viewport in minimap pixels, clipped to the minimap.
+	tilePx := float64(ms.mapFile.TileSize) * ms.mapZoom
+	scale := float64(k) / float64(mm.step) / tilePx
+	vx0 := max(0, int(ms.camX*scale))
+	vy0 := max(0, int(ms.camY*scale))
+	vx1 := min(mm.w*k, int((ms.camX+float64(p.winW))*scale))
+	vy1 := min(mm.h*k, int((ms.camY+float64(p.winH))*scale))
+	if vx1 > vx0 && vy1 > vy0 {
+		strokeRect(screen, x+vx0, y+vy0, vx1-vx0, vy1-vy0, color.RGBA{R: 0xff, G: 0xff, B: 0x00, A: 0xff})
+	}
+}
+
+func strokeRect(screen *ebiten.Image, x, y, w, h int, c color.Color) {
+	for i := 0; i < w; i++ {
+		screen.Set(x+i, y, c)
+		screen.Set(x+i, y+h-1, c)
+	}
+	for i := 0; i < h; i++ {
+		screen.Set(x, y+i, c)
+		screen.Set(x+w-1, y+i, c)
+	}
+}
+
+// parseTileCoord parses a go-to target such as "12,34" or "12 34".
+func parseTileCoord(s string) (x, y int, err error) {
+	fields := strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' })
+	if len(fields) != 2 {
+		return 0, 0, fmt.Errorf("expected x,y")
+	}
+	if x, err = strconv.Atoi(fields[0]); err != nil {
+		return 0, 0, fmt.Errorf("bad x %q", fields[0])
+	}
+	if y, err = strconv.Atoi(fields[1]); err != nil {
+		return 0, 0, fmt.Errorf("bad y %q", fields[1])
+	}
+	return x, y, nil
+}
+
+// updateGoto handles the go-to-tile prompt. While the prompt is open it
+// takes all keyboard input; Enter centers the camera on the typed tile and
+// Escape cancels. It reports whether the prompt is open.
+func (p *Previewer) updateGoto() bool {
+	ms := p.mapState
+	if !ms.gotoOpen {
+		if p.keys.justPressed("goto_tile") {
+			ms.gotoOpen, ms.gotoText, ms.gotoErr = true, "", ""
+			return true
+		}
+		return false
+	}
+
+	for _, r := range ebiten.AppendInputChars(nil) {
+		if (r >= '0' && r <= '9') || r == ',' || r == ' ' || r == '-' {
+			ms.gotoText += string(r)
+		}
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyBackspace) && ms.gotoText != "" {
+		ms.gotoText = ms.gotoText[:len(ms.gotoText)-1]
+	}
+	switch {
+	case inpututil.IsKeyJustPressed(ebiten.KeyEscape):
+		ms.gotoOpen = false
+	case inpututil.IsKeyJustPressed(ebiten.KeyEnter):
+		x, y, err := parseTileCoord(ms.gotoText)
+		if err != nil {
+			ms.gotoErr = err.Error()
+			break
+		}
+		if ms.minimap != nil && (x < 0 || y < 0 || x >= ms.minimap.mapW || y >= ms.minimap.mapH) {
+			ms.gotoErr = fmt.Sprintf("outside the %dx%d map", ms.minimap.mapW, ms.minimap.mapH)
+			break
+		}
+		p.centerOnTile(float64(x), float64(y))
+		ms.gotoOpen = false
+	}
+	return true
+}
+
+// drawGoto draws the go-to prompt at the bottom of the window.
+func (p *Previewer) drawGoto(screen *ebiten.Image) {
+	ms := p.mapState
+	if !ms.gotoOpen {
+		return
+	}
+	text := "Go to tile x,y: " + ms.gotoText + "_"
+	if ms.gotoErr != "" {
+		text += "  (" + ms.gotoErr + ")"
+	}
+	drawText(screen, text, 10, p.winH-lineHeight()-6)
+}
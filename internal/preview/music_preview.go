@@ -2,12 +2,12 @@ package preview
 
 import (
 	"bytes"
-	"encoding/binary"
+	"context"
 	"fmt"
 	"image/color"
 	"math"
-	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/hajimehoshi/ebiten/v2"
@@ -24,7 +24,7 @@ type MusicPreviewState struct {
 	currentRow int
 	currentPat int
 	playing    bool
-	elapsed    float64
+	elapsed    float64 // playhead position in seconds
 
 	// Audio playback.
 	samples    []float64
@@ -32,60 +32,164 @@ type MusicPreviewState struct {
 	audioCtx   *audio.Context
 	player     *audio.Player
 	audioErr   string
+	startAt    int // first sample of the current player's buffer
 
 	// Playback position tracking.
 	samplesPerTick float64
 	totalTicks     int
+
+	// Bus mixing: instruments are kept so a volume change can re-render.
+	instruments map[string]*instrument.Instrument
+	selectedBus string
+
+	// Pattern loop: loopPattern is the pattern playing on its own, over
+	// and over, and loopSamples its render. loopPattern is "" otherwise.
+	loopPattern string
+	loopSamples []float64
+	loopStart   int // first sample of the pattern's place in the song
+
+	// Metronome: when on, playback has a click on every beat. clicked is
+	// samples with the clicks mixed in, made on first use.
+	metronome bool
+	clicked   []float64
+
+	// loading is set until the first render arrives; the notes show
+	// meanwhile, but there is nothing to play.
+	loading bool
+
+	// cache holds the render's pattern blocks, so a mix change restitches
+	// the song without synthesizing it again.
+	cache *track.BlockCache
 }
 
+// busVolumeStep is how much one +/- press changes the selected bus volume.
+const busVolumeStep = 0.05
+
+// Metronome clicks are short decaying sine blips, higher on the first beat
+// of a bar.
+const (
+	clickLength   = 0.03 // seconds
+	clickLevel    = 0.35
+	clickBeatFreq = 1000.0
+	clickBarFreq  = 1600.0
+)
+
+// initMusicState shows tr's notes at once and renders it in the
+// background, so a long song doesn't hold up the window. The render
+// arrives like a reload.
 func (p *Previewer) initMusicState(tr *track.Track) {
-	sr := p.sampleRate
-	if sr == 0 {
-		sr = 44100
-	}
+	p.musicState = p.musicStateFor(tr, nil)
+	p.musicState.loading = true
+	p.startReload()
+}
 
+// newMusicState renders tr for preview, reusing the previewer's pattern
+// blocks and reporting progress as it goes. It fails only if ctx is
+// canceled.
+func (p *Previewer) newMusicState(ctx context.Context, tr *track.Track) (*MusicPreviewState, error) {
 	// Load instruments from assets dir.
 	instruments := loadInstruments(p.assetsDir)
 
-	// Render to samples.
-	samples, _ := tr.Render(instruments, sr)
+	ms := p.musicStateFor(tr, instruments)
+	samples, err := tr.RenderCached(ctx, instruments, ms.sampleRate, p.trackCache, p.renderProgress(ctx))
+	if err != nil {
+		return nil, err
+	}
+	ms.samples = samples
+	return ms, nil
+}
+
+// musicStateFor returns a state for tr with its playback timing but no
+// samples.
+func (p *Previewer) musicStateFor(tr *track.Track, instruments map[string]*instrument.Instrument) *MusicPreviewState {
+	sr := p.sampleRate
+	if sr == 0 {
+		sr = 44100
+	}
 
 	// Compute timing for playback cursor.
 	samplesPerTick := float64(sr) * 60.0 / float64(tr.Tempo) / float64(tr.TicksPerBeat)
 	totalTicks := 0
 	for _, pname := range tr.Sequence {
 		if pat := tr.Patterns[pname]; pat != nil {
-			totalTicks += len(pat.Rows)
+			totalTicks += pat.Len()
 		}
 	}
 
-	p.musicState = &MusicPreviewState{
+	return &MusicPreviewState{
 		track:          tr,
-		samples:        samples,
 		sampleRate:     sr,
 		samplesPerTick: samplesPerTick,
 		totalTicks:     totalTicks,
+		instruments:    instruments,
+		cache:          p.trackCache,
 	}
 }
 
-func loadInstruments(assetsDir string) map[string]*instrument.Instrument {
-	instruments := map[string]*instrument.Instrument{}
-	instDir := filepath.Join(assetsDir, "instruments")
-	entries, err := os.ReadDir(instDir)
-	if err != nil {
-		return instruments
-	}
-	for _, e := range entries {
-		if e.IsDir() || !strings.HasSuffix(e.Name(), ".inst") {
-			continue
+// renderProgress returns a progress callback for a background render,
+// which records how many patterns are done until ctx is canceled.
+func (p *Previewer) renderProgress(ctx context.Context) func(done, total int) {
+	return func(done, total int) {
+		p.reloadMu.Lock()
+		defer p.reloadMu.Unlock()
+		if ctx.Err() == nil {
+			p.renderDone, p.renderTotal = done, total
 		}
-		inst, err := instrument.LoadInstrument(filepath.Join(instDir, e.Name()))
-		if err != nil {
-			continue
+	}
+}
+
+// renderLabel describes the background render in progress, or returns ""
+// when there is none.
+func (p *Previewer) renderLabel() string {
+	p.reloadMu.Lock()
+	defer p.reloadMu.Unlock()
+	switch {
+	case !p.rendering:
+		return ""
+	case p.renderTotal == 0:
+		return "Rendering..."
+	default:
+		return fmt.Sprintf("Rendering... %d/%d patterns", p.renderDone, p.renderTotal)
+	}
+}
+
+// swapMusicState replaces the current music state after a reload, stopping
+// the stale player and resetting the playback cursor.
+func (p *Previewer) swapMusicState(next *MusicPreviewState) {
+	wasPlaying := false
+	if old := p.musicState; old != nil {
+		wasPlaying = old.playing
+		old.stop()
+		next.audioCtx = old.audioCtx
+		next.audioErr = old.audioErr
+		next.metronome = old.metronome
+		if next.track != nil && next.track.Buses[old.selectedBus] != nil {
+			next.selectedBus = old.selectedBus
 		}
-		instruments[inst.Name] = inst
 	}
-	return instruments
+	p.musicState = next
+	if wasPlaying && p.restartOnReload {
+		next.play()
+	}
+}
+
+// stop halts and releases the current player and rewinds the cursor.
+func (ms *MusicPreviewState) stop() {
+	if ms.player != nil {
+		ms.player.Pause()
+		_ = ms.player.Close()
+		ms.player = nil
+	}
+	ms.playing = false
+	ms.elapsed = 0
+	ms.currentRow = 0
+	ms.currentPat = 0
+	ms.loopPattern = ""
+	ms.loopSamples = nil
+}
+
+func loadInstruments(assetsDir string) map[string]*instrument.Instrument {
+	return instrument.LoadDir(filepath.Join(assetsDir, "instruments"))
 }
 
 func (p *Previewer) updateMusic() {
@@ -93,42 +197,67 @@ func (p *Previewer) updateMusic() {
 		return
 	}
 	ms := p.musicState
+	if ms.loading {
+		return
+	}
 
-	if inpututil.IsKeyJustPressed(ebiten.KeyEnter) {
+	if p.keys.justPressed("play") {
 		if ms.playing {
-			// Stop.
-			if ms.player != nil {
-				ms.player.Pause()
-			}
-			ms.playing = false
-			ms.currentRow = 0
-			ms.currentPat = 0
-			ms.elapsed = 0
+			ms.stop()
 		} else {
 			ms.play()
 		}
 	}
+	if p.keys.justPressed("play_pattern") {
+		if ms.loopPattern != "" {
+			ms.stopLoop()
+		} else {
+			ms.playPattern()
+		}
+	}
+	if p.keys.justPressed("metronome") {
+		ms.toggleMetronome()
+	}
+	step := 0
+	if p.keys.justPressed("next_pattern") {
+		step = 1
+	}
+	if p.keys.justPressed("prev_pattern") {
+		step = -1
+	}
+	if step != 0 {
+		ms.stepPattern(step)
+	}
+
+	if p.keys.justPressed("select_bus") {
+		ms.cycleBus()
+	}
+	delta := 0.0
+	if p.keys.justPressed("bus_volume_up") {
+		delta = busVolumeStep
+	}
+	if p.keys.justPressed("bus_volume_down") {
+		delta = -busVolumeStep
+	}
+	if delta != 0 && ms.adjustBus(delta) {
+		ms.rerender()
+	}
+
+	// Click the waveform to start playing from that point.
+	if !ms.playing && inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+		mx, my := ebiten.CursorPosition()
+		x0, top, w, h := p.musicWaveRect()
+		if mx >= x0 && mx < x0+w && my >= top && my < top+h && len(ms.samples) > 0 {
+			ms.playFrom((mx - x0) * len(ms.samples) / w)
+		}
+	}
 
-	// Advance playback cursor.
+	// Advance playback cursor from the audio clock.
 	if ms.playing && ms.player != nil && ms.player.IsPlaying() {
-		ms.elapsed += 1.0 / float64(ebiten.TPS())
-		tickIdx := int(ms.elapsed * float64(ms.sampleRate) / ms.samplesPerTick)
-
-		// Map tick index to pattern + row.
-		remaining := tickIdx
-		ms.currentPat = 0
-		ms.currentRow = 0
-		for i, pname := range ms.track.Sequence {
-			pat := ms.track.Patterns[pname]
-			if pat == nil {
-				continue
-			}
-			if remaining < len(pat.Rows) {
-				ms.currentPat = i
-				ms.currentRow = remaining
-				break
-			}
-			remaining -= len(pat.Rows)
+		if ms.loopPattern != "" {
+			ms.setLoopCursor(playerSample(ms.player, 0, ms.sampleRate))
+		} else {
+			ms.setCursor(playerSample(ms.player, ms.startAt, ms.sampleRate))
 		}
 	} else if ms.playing {
 		// Playback finished.
@@ -136,6 +265,233 @@ func (p *Previewer) updateMusic() {
 	}
 }
 
+// musicWaveRect returns the left edge, top, width and height of the
+// waveform strip.
+func (p *Previewer) musicWaveRect() (x0, top, w, h int) {
+	x0 = charWidth() * 4
+	return x0, p.winH - 70, p.winW - x0*2, 30
+}
+
+// setCursor moves the playhead to a sample and updates the pattern and row
+// shown.
+func (ms *MusicPreviewState) setCursor(sample int) {
+	ms.elapsed = float64(sample) / float64(ms.sampleRate)
+	ms.currentPat = 0
+	ms.currentRow = 0
+	if ms.samplesPerTick <= 0 {
+		return
+	}
+
+	// Map tick index to pattern + row.
+	remaining := int(float64(sample) / ms.samplesPerTick)
+	for i, pname := range ms.track.Sequence {
+		pat := ms.track.Patterns[pname]
+		if pat == nil {
+			continue
+		}
+		if remaining < pat.Len() {
+			ms.currentPat = i
+			ms.currentRow = remaining
+			break
+		}
+		remaining -= pat.Len()
+	}
+}
+
+// setLoopCursor moves the playhead to a sample of the looping pattern,
+// counted from when the loop started, wrapping at the pattern's end. The
+// row stays within the pattern and the waveform playhead within its place
+// in the song.
+func (ms *MusicPreviewState) setLoopCursor(sample int) {
+	if len(ms.loopSamples) == 0 {
+		return
+	}
+	sample %= len(ms.loopSamples)
+	ms.elapsed = float64(ms.loopStart+sample) / float64(ms.sampleRate)
+	pat := ms.track.Patterns[ms.loopPattern]
+	if tick := int(math.Round(ms.samplesPerTick)); tick > 0 && pat != nil {
+		ms.currentRow = min(sample/tick, pat.Len()-1)
+	}
+}
+
+// stopLoop stops a pattern loop, leaving the cursor on the pattern.
+func (ms *MusicPreviewState) stopLoop() {
+	pat := ms.currentPat
+	ms.stop()
+	ms.currentPat = pat
+}
+
+// stepPattern moves the cursor to the next or previous pattern in the
+// sequence, wrapping around. While a pattern loops, the new one loops in
+// its place; while the song plays, the cursor follows the song instead.
+func (ms *MusicPreviewState) stepPattern(step int) {
+	n := len(ms.track.Sequence)
+	if n == 0 || (ms.playing && ms.loopPattern == "") {
+		return
+	}
+	looping := ms.loopPattern != ""
+	ms.stopLoop()
+	ms.currentPat = ((ms.currentPat+step)%n + n) % n
+	if looping {
+		ms.playPattern()
+	}
+}
+
+// playPattern renders the pattern under the cursor on its own and loops it
+// until stopped.
+func (ms *MusicPreviewState) playPattern() {
+	if len(ms.track.Sequence) == 0 {
+		return
+	}
+	patIdx := ms.currentPat % len(ms.track.Sequence)
+	name := ms.track.Sequence[patIdx]
+	samples, err := ms.track.RenderPattern(context.Background(), name, ms.instruments, ms.sampleRate)
+	if err != nil || len(samples) == 0 {
+		return
+	}
+	ms.ensureAudio()
+	if ms.audioErr != "" || ms.audioCtx == nil {
+		return
+	}
+	ms.stop()
+
+	defer func() {
+		if r := recover(); r != nil {
+			ms.audioErr = fmt.Sprintf("%v", r)
+		}
+	}()
+	loop := samples
+	if ms.metronome {
+		loop = withClicks(samples, ms.track, []string{name}, ms.sampleRate)
+	}
+	pcm := pcmBytes(loop)
+	player, err := ms.audioCtx.NewPlayer(audio.NewInfiniteLoop(bytes.NewReader(pcm), int64(len(pcm))))
+	if err != nil {
+		ms.audioErr = err.Error()
+		return
+	}
+	player.Play()
+	ms.player = player
+	ms.playing = true
+	ms.currentPat = patIdx
+	ms.loopPattern = name
+	ms.loopSamples = samples
+	ms.loopStart = 0
+	for _, pname := range ms.track.Sequence[:patIdx] {
+		if pat := ms.track.Patterns[pname]; pat != nil {
+			ms.loopStart += int(float64(pat.Len()) * ms.samplesPerTick)
+		}
+	}
+	ms.setLoopCursor(0)
+}
+
+// cycleBus selects the next bus in name order, wrapping to no selection
+// after the last one.
+func (ms *MusicPreviewState) cycleBus() {
+	names := ms.track.BusNames()
+	i := slices.Index(names, ms.selectedBus)
+	if i+1 < len(names) {
+		ms.selectedBus = names[i+1]
+	} else {
+		ms.selectedBus = ""
+	}
+}
+
+// adjustBus changes the selected bus volume by delta, clamped to [0, 2].
+// It reports whether the volume changed.
+func (ms *MusicPreviewState) adjustBus(delta float64) bool {
+	b := ms.track.Buses[ms.selectedBus]
+	if b == nil {
+		return false
+	}
+	v := math.Round(math.Max(0, math.Min(2, b.Volume+delta))*100) / 100
+	if v == b.Volume {
+		return false
+	}
+	b.Volume = v
+	return true
+}
+
+// rerender renders the track again after a mix change, from the cached
+// pattern blocks. Playback continues from the same position with the new
+// samples.
+func (ms *MusicPreviewState) rerender() {
+	samples, err := ms.track.RenderCached(context.Background(), ms.instruments, ms.sampleRate, ms.cache, nil)
+	if err != nil {
+		return
+	}
+	ms.samples = samples
+	ms.clicked = nil
+	if ms.loopPattern != "" {
+		// Restart the loop with the new mix.
+		ms.stopLoop()
+		ms.playPattern()
+		return
+	}
+	if !ms.playing {
+		return
+	}
+	ms.playFrom(int(ms.elapsed * float64(ms.sampleRate)))
+}
+
+// toggleMetronome turns the click on or off, restarting playback in place
+// so it is heard at once.
+func (ms *MusicPreviewState) toggleMetronome() {
+	ms.metronome = !ms.metronome
+	switch {
+	case ms.loopPattern != "":
+		ms.stopLoop()
+		ms.playPattern()
+	case ms.playing:
+		ms.playFrom(int(ms.elapsed * float64(ms.sampleRate)))
+	}
+}
+
+// playback returns the samples to play: the render, with clicks when the
+// metronome is on.
+func (ms *MusicPreviewState) playback() []float64 {
+	if !ms.metronome {
+		return ms.samples
+	}
+	if ms.clicked == nil {
+		ms.clicked = withClicks(ms.samples, ms.track, ms.track.Sequence, ms.sampleRate)
+	}
+	return ms.clicked
+}
+
+// withClicks returns a copy of samples, a render of the patterns in seq,
+// with a metronome click on every beat. Clicks are only for preview
+// playback; built WAVs never have them.
+func withClicks(samples []float64, tr *track.Track, seq []string, sampleRate int) []float64 {
+	out := slices.Clone(samples)
+	tick := int(math.Round(float64(sampleRate) * 60 / float64(tr.Tempo) / float64(tr.TicksPerBeat)))
+	n := int(clickLength * float64(sampleRate))
+	offset := 0
+	for _, name := range seq {
+		pat := tr.Patterns[name]
+		if pat == nil {
+			continue
+		}
+		for row := range pat.Len() {
+			beat, bar := tr.Downbeat(pat, row)
+			if !beat {
+				continue
+			}
+			freq := clickBeatFreq
+			if bar > 0 {
+				freq = clickBarFreq
+			}
+			start := offset + row*tick
+			for i := 0; i < n && start+i < len(out); i++ {
+				t := float64(i) / float64(sampleRate)
+				out[start+i] += clickLevel * math.Sin(2*math.Pi*freq*t) * math.Exp(-t*150)
+			}
+		}
+		offset += pat.Len() * tick
+	}
+	return out
+}
+
 func (ms *MusicPreviewState) ensureAudio() {
 	if ms.audioCtx != nil || ms.audioErr != "" {
 		return
@@ -149,36 +505,31 @@ func (ms *MusicPreviewState) ensureAudio() {
 }
 
 func (ms *MusicPreviewState) play() {
+	ms.playFrom(0)
+}
+
+// playFrom starts playback at the given sample. The player gets a buffer
+// that begins there, so its position is relative to startAt.
+func (ms *MusicPreviewState) playFrom(sample int) {
 	ms.ensureAudio()
 	if ms.audioErr != "" || ms.audioCtx == nil {
 		return
 	}
-
-	// Convert float64 samples to 16-bit stereo PCM.
-	buf := &bytes.Buffer{}
-	for _, s := range ms.samples {
-		if s > 1.0 {
-			s = 1.0
-		} else if s < -1.0 {
-			s = -1.0
-		}
-		v := int16(s * 32767)
-		binary.Write(buf, binary.LittleEndian, v) // left
-		binary.Write(buf, binary.LittleEndian, v) // right
-	}
+	ms.stop()
+	buf := ms.playback()
+	sample = max(0, min(sample, len(buf)))
 
 	defer func() {
 		if r := recover(); r != nil {
 			ms.audioErr = fmt.Sprintf("%v", r)
 		}
 	}()
-	player := ms.audioCtx.NewPlayerFromBytes(buf.Bytes())
+	player := ms.audioCtx.NewPlayerFromBytes(pcmBytes(buf[sample:]))
 	player.Play()
 	ms.player = player
 	ms.playing = true
-	ms.elapsed = 0
-	ms.currentRow = 0
-	ms.currentPat = 0
+	ms.startAt = sample
+	ms.setCursor(sample)
 }
 
 func (p *Previewer) drawMusic(screen *ebiten.Image) {
@@ -188,8 +539,8 @@ func (p *Previewer) drawMusic(screen *ebiten.Image) {
 	}
 
 	tr := ms.track
-	lineH := scaledCharH()
-	charW := scaledCharW()
+	lineH := lineHeight()
+	charW := charWidth()
 	colW := charW * 8 // 8 chars per column (e.g. "C#4  ---")
 	rowH := lineH + 4
 	headerH := lineH*2 + 10
@@ -202,6 +553,12 @@ func (p *Previewer) drawMusic(screen *ebiten.Image) {
 	}
 	info := fmt.Sprintf("Track  tempo:%d  channels:%d  patterns:%d  dur:%.1fs",
 		tr.Tempo, len(tr.Channels), len(tr.Patterns), dur)
+	if ms.metronome {
+		info += "  metronome"
+	}
+	if label := p.renderLabel(); label != "" && !ms.loading {
+		info += "  " + label
+	}
 	drawText(screen, info, 10, 10)
 
 	// Channel headers.
@@ -210,6 +567,22 @@ func (p *Previewer) drawMusic(screen *ebiten.Image) {
 		drawText(screen, ch.Name, x, headerH)
 	}
 
+	// Bus list, right-aligned under the header. The selected bus is
+	// bracketed.
+	if names := tr.BusNames(); len(names) > 0 {
+		parts := make([]string, 0, len(names)+1)
+		for _, name := range names {
+			label := fmt.Sprintf("%s %.2f", name, tr.Buses[name].Volume)
+			if name == ms.selectedBus {
+				label = "[" + label + "]"
+			}
+			parts = append(parts, label)
+		}
+		parts = append(parts, fmt.Sprintf("master %.2f", tr.MasterVolume))
+		line := "Buses: " + strings.Join(parts, "  ")
+		drawText(screen, line, p.winW-textWidth(line)-10, lineH+14)
+	}
+
 	// Draw divider.
 	divY := headerH + lineH + 4
 	for x := offsetX; x < offsetX+len(tr.Channels)*colW; x++ {
@@ -232,7 +605,7 @@ func (p *Previewer) drawMusic(screen *ebiten.Image) {
 
 	// Position info.
 	posLabel := fmt.Sprintf("Pattern: %s (%d/%d)  Row: %02d/%02d",
-		patName, patIdx+1, len(tr.Sequence), ms.currentRow, len(pat.Rows))
+		patName, patIdx+1, len(tr.Sequence), ms.currentRow, pat.Len())
 	drawText(screen, posLabel, 10, lineH+14)
 
 	startY := divY + 6
@@ -262,6 +635,19 @@ func (p *Previewer) drawMusic(screen *ebiten.Image) {
 			}
 		}
 
+		// Beat grid: a line above every beat, brighter with a bar number
+		// above every bar.
+		if beat, bar := tr.Downbeat(pat, absRow); beat {
+			lineColor := color.RGBA{R: 0x3a, G: 0x3a, B: 0x4a, A: 0xff}
+			if bar > 0 {
+				lineColor = color.RGBA{R: 0x80, G: 0x80, B: 0xa0, A: 0xff}
+				drawText(screen, fmt.Sprintf("bar %d", bar), offsetX+len(tr.Channels)*colW+charW, y)
+			}
+			for hx := offsetX - 2; hx < offsetX+len(tr.Channels)*colW+2; hx++ {
+				screen.Set(hx, y, lineColor)
+			}
+		}
+
 		// Row number.
 		drawText(screen, fmt.Sprintf("%02X", absRow), 4, y)
 
@@ -274,10 +660,8 @@ func (p *Previewer) drawMusic(screen *ebiten.Image) {
 	}
 
 	// Waveform mini-display at bottom.
-	waveY := p.winH - 70
-	waveH := 30
+	_, waveY, drawW, waveH := p.musicWaveRect()
 	waveColor := color.RGBA{R: 0x00, G: 0xcc, B: 0xcc, A: 0xff}
-	drawW := p.winW - offsetX*2
 	if len(ms.samples) > 0 && drawW > 0 {
 		samplesPerPx := float64(len(ms.samples)) / float64(drawW)
 		for x := 0; x < drawW; x++ {
@@ -314,12 +698,32 @@ func (p *Previewer) drawMusic(screen *ebiten.Image) {
 
 	// Status line.
 	statusY := p.winH - lineH - 6
-	if ms.audioErr != "" {
+	if ms.loading {
+		label := p.renderLabel()
+		if label == "" {
+			label = "Rendering..."
+		}
+		drawText(screen, label, 10, statusY)
+	} else if ms.audioErr != "" {
 		drawText(screen, "No audio device available", 10, statusY)
+	} else if ms.loopPattern != "" {
+		drawText(screen, "Looping pattern "+ms.loopPattern+" - "+p.keys.keyLabel("play_pattern")+" to stop"+p.busHint(ms), 10, statusY)
 	} else if ms.playing {
-		drawText(screen, "Playing - Enter to stop", 10, statusY)
+		drawText(screen, "Playing - "+p.keys.keyLabel("play")+" to stop, "+p.keys.keyLabel("play_pattern")+" to loop this pattern"+p.busHint(ms), 10, statusY)
 	} else {
-		drawText(screen, "Press Enter to play", 10, statusY)
+		drawText(screen, "Press "+p.keys.keyLabel("play")+" to play, "+p.keys.keyLabel("play_pattern")+" to loop a pattern, or click the waveform"+p.busHint(ms), 10, statusY)
+	}
+}
+
+func (p *Previewer) busHint(ms *MusicPreviewState) string {
+	switch {
+	case len(ms.track.Buses) == 0:
+		return ""
+	case ms.selectedBus == "":
+		return "  " + p.keys.keyLabel("select_bus") + ": select bus"
+	default:
+		return fmt.Sprintf("  %s: next bus  %s/%s: %s volume", p.keys.keyLabel("select_bus"),
+			p.keys.keyLabel("bus_volume_up"), p.keys.keyLabel("bus_volume_down"), ms.selectedBus)
 	}
 }
 
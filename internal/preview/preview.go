@@ -1,12 +1,15 @@
 package preview
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"image"
 	"image/color"
+	"log/slog"
+	"math"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -31,6 +34,27 @@ const (
 	BackgroundCheckerboard
 )
 
+// InterpMode selects how the in-between frame is composited when frame
+// interpolation preview is enabled.
+type InterpMode int
+
+const (
+	InterpOff InterpMode = iota
+	InterpAlpha
+	InterpAdditive
+)
+
+func (m InterpMode) String() string {
+	switch m {
+	case InterpAlpha:
+		return "alpha"
+	case InterpAdditive:
+		return "additive"
+	default:
+		return "off"
+	}
+}
+
 // PreviewMode identifies what kind of asset is being previewed.
 type PreviewMode int
 
@@ -45,10 +69,24 @@ const (
 type RenderedSprite struct {
 	Name       string
 	Frames     []*ebiten.Image
+	Keyed      []*ebiten.Image // Frames drawn with the color key, if one is set
 	FrameW     int
 	FrameH     int
 	FPS        int
 	FrameCount int
+	Playback   string // sprite.PlaybackLoop, PlaybackOnce or PlaybackPingPong
+
+	// Keys holds each frame's palette key grid before color resolution,
+	// and Legend the heatmap false color assigned to each key.
+	Keys   [][][]string
+	Legend []legendEntry
+
+	// Pivot is the sprite's anchor point, nil if it has none.
+	Pivot *sprite.Pivot
+	// Events maps 0-based frame indices to the events fired on them.
+	Events map[int][]string
+	// Hitboxes are the sprite's hurt and hit boxes.
+	Hitboxes []sprite.Hitbox
 }
 
 // Previewer implements ebiten.Game for live asset preview.
@@ -61,6 +99,21 @@ type Previewer struct {
 	assetsDir  string
 	sampleRate int
 
+	// darkBackground is BackgroundDark's color; zero for the default.
+	darkBackground palette.Color
+
+	// restartOnReload resumes audio playback with the new render when a
+	// playing .sfx or .track is reloaded.
+	restartOnReload bool
+
+	// allowOversizedTiles mirrors lint.allow_oversized_tiles for the map
+	// preview's tile size warnings.
+	allowOversizedTiles bool
+
+	// Key bindings, and whether the help overlay listing them is shown.
+	keys     Keymap
+	showHelp bool
+
 	// Sprite mode state.
 	sprites   []*RenderedSprite
 	zoom      int
@@ -69,24 +122,83 @@ type Previewer struct {
 	selected  int // -1 = grid view, >= 0 = isolated sprite
 	showGrid  bool
 
+	// Frame interpolation preview (isolated view only).
+	interpMode InterpMode
+	interpMix  float64 // weight of the next frame in the in-between, 0-1
+
+	// Palette key heatmap (isolated view only).
+	heatmap    bool
+	blinkKey   string // legend key whose pixels are blinking
+	blinkTicks int
+	pixel      *ebiten.Image // 1x1 white, tinted per pixel
+
+	// Color key preview: draw sprites as the build writes them, with the
+	// key color in place of transparency.
+	colorKey  *palette.Color
+	showKeyed bool
+
+	// Hitbox outlines (isolated view only).
+	showHitboxes bool
+
+	// Initial isolated sprite and frame, from --sprite/--frame.
+	startSprite string
+	startFrame  int
+
 	// Map mode state.
 	mapState *MapPreviewState
 
 	// SFX mode state.
 	sfxState *SFXPreviewState
 
-	// Music mode state.
+	// Music mode state. trackCache keeps the rendered pattern blocks
+	// across reloads, so an edit re-renders only the patterns it touched.
 	musicState *MusicPreviewState
+	trackCache *track.BlockCache
 
 	// File watching.
-	watcher     *watcher.Watcher
-	reloadMu    sync.Mutex
-	pendingLoad []*RenderedSprite
-	pendingErr  string
+	watcher      *watcher.Watcher
+	reloadMu     sync.Mutex
+	cancelReload context.CancelFunc // stops the reload in progress, if any
+	pendingLoad  []*RenderedSprite
+	pendingSFX   *SFXPreviewState
+	pendingMus   *MusicPreviewState
+	pendingMap   *MapPreviewState
+	pendingErr   string
+	rendering    bool // a music render is running in the background
+	renderDone   int  // patterns rendered so far, of renderTotal
+	renderTotal  int
+	palettePath  string // palette referenced by the sprite file, if any
+	missingPath  string // watched file that was deleted, "" when present
+	waiting      bool   // a waitForFile goroutine is running
+	closed       bool
+	deletedMsg   string
+}
+
+// Zoom limits for sprite previews. Zoom steps by doubling between them.
+const (
+	minZoom     = 1
+	maxZoom     = 32
+	defaultZoom = 4
+)
+
+// Options configures a previewer.
+type Options struct {
+	WindowWidth  int
+	WindowHeight int
+	SampleRate   int
+	// PixelScale is the zoom to open at, from [preview] pixel_scale. A zoom
+	// saved by an earlier session takes precedence.
+	PixelScale int
+	// ColorKey is the project's transparent_color, or nil. When set, the
+	// sprite preview can toggle between alpha and the keyed build output.
+	ColorKey *palette.Color
+	// Background is the dark background's color, from [preview]
+	// background; the zero Color keeps the default.
+	Background palette.Color
 }
 
 // NewPreviewer creates a previewer for the given file.
-func NewPreviewer(filePath, assetsDir string, winW, winH, sampleRate int) *Previewer {
+func NewPreviewer(filePath, assetsDir string, opts Options) *Previewer {
 	ext := filepath.Ext(filePath)
 	mode := ModeSpritePreview
 	switch ext {
@@ -100,33 +212,69 @@ func NewPreviewer(filePath, assetsDir string, winW, winH, sampleRate int) *Previ
 		mode = ModeMusicPreview
 	}
 
+	zoom := defaultZoom
+	if opts.PixelScale > 0 {
+		zoom = clampZoom(opts.PixelScale)
+	}
+
 	return &Previewer{
-		mode:       mode,
-		zoom:       2,
-		selected:   -1,
-		winW:       winW,
-		winH:       winH,
-		filePath:   filePath,
-		assetsDir:  assetsDir,
-		sampleRate: sampleRate,
+		mode:           mode,
+		zoom:           zoom,
+		selected:       -1,
+		interpMix:      0.5,
+		winW:           opts.WindowWidth,
+		winH:           opts.WindowHeight,
+		filePath:       filePath,
+		assetsDir:      assetsDir,
+		sampleRate:     opts.SampleRate,
+		colorKey:       opts.ColorKey,
+		darkBackground: opts.Background,
+		keys:           DefaultKeymap(),
+		trackCache:     track.NewBlockCache(),
 	}
 }
 
+func clampZoom(z int) int {
+	return min(max(z, minZoom), maxZoom)
+}
+
+// SetKeymap replaces the default key bindings.
+func (p *Previewer) SetKeymap(km Keymap) {
+	p.keys = km
+}
+
+// SetAllowOversizedTiles accepts map tiles whose sprite sides are exact
+// multiples of tile_size, as lint.allow_oversized_tiles does for builds.
+func (p *Previewer) SetAllowOversizedTiles(on bool) {
+	p.allowOversizedTiles = on
+}
+
+// SetRestartOnReload controls whether audio that was playing when its file
+// is reloaded restarts with the new render. Off by default.
+func (p *Previewer) SetRestartOnReload(on bool) {
+	p.restartOnReload = on
+}
+
+// SetStartSprite opens the previewer in the isolated view of the named
+// sprite, on the given frame, optionally paused.
+func (p *Previewer) SetStartSprite(name string, frame int, paused bool) {
+	p.startSprite = name
+	p.startFrame = frame
+	p.paused = paused
+}
+
 // Run starts the ebitengine window and event loop.
 func (p *Previewer) Run() error {
 	// Load state.
-	if st := loadState(); st != nil {
-		if st.Zoom > 0 {
-			p.zoom = st.Zoom
-		}
-		p.background = BackgroundType(st.Background)
-		p.showGrid = st.ShowGrid
-	}
+	st := p.loadState()
+	p.applyState(st)
 
 	// Initial load based on mode.
 	if err := p.loadAsset(); err != nil {
 		p.errorMsg = err.Error()
 	}
+	p.applyStartSprite()
+	p.applyMapView(st)
 
 	// Start file watcher.
 	p.startWatcher()
@@ -148,7 +296,7 @@ func (p *Previewer) loadAsset() error {
 		if err != nil {
 			return err
 		}
-		p.sprites = sprites
+		p.setSprites(sprites)
 	case ModeMapPreview:
 		mf, _, err := tilemap.LoadMapFile(p.filePath)
 		if err != nil {
@@ -177,21 +325,49 @@ func (p *Previewer) loadAsset() error {
 
 // Update handles input and animation.
 func (p *Previewer) Update() error {
-	// Check for pending reload (sprite mode).
+	// Check for pending reload.
 	p.reloadMu.Lock()
 	if p.pendingLoad != nil {
-		p.sprites = p.pendingLoad
+		p.setSprites(p.pendingLoad)
 		p.errorMsg = ""
 		p.pendingLoad = nil
 	}
+	if p.pendingMap != nil {
+		p.swapMapState(p.pendingMap)
+		p.errorMsg = ""
+		p.pendingMap = nil
+	}
+	nextSFX, nextMus := p.pendingSFX, p.pendingMus
+	p.pendingSFX, p.pendingMus = nil, nil
 	if p.pendingErr != "" {
 		p.errorMsg = p.pendingErr
 		p.pendingErr = ""
 	}
+	if p.missingPath != "" {
+		p.deletedMsg = fmt.Sprintf("%s deleted - waiting for it to reappear", filepath.Base(p.missingPath))
+	} else {
+		p.deletedMsg = ""
+	}
 	p.reloadMu.Unlock()
 
+	// Audio state swaps happen outside the lock; restarting playback
+	// re-encodes the whole render.
+	if nextSFX != nil {
+		p.swapSFXState(nextSFX)
+		p.errorMsg = ""
+	}
+	if nextMus != nil {
+		p.swapMusicState(nextMus)
+		p.errorMsg = ""
+	}
+
+	// ?: key binding help (all modes). Input is paused while it is open.
+	if p.updateHelp() {
+		return nil
+	}
+
 	// B: cycle background (all modes).
-	if inpututil.IsKeyJustPressed(ebiten.KeyB) {
+	if p.keys.justPressed("cycle_background") {
 		p.background = (p.background + 1) % 3
 	}
 
@@ -210,29 +386,29 @@ func (p *Previewer) Update() error {
 }
 
 func (p *Previewer) updateSprite() {
-	// Zoom: mouse wheel.
+	// Zoom: mouse wheel or keys.
 	_, dy := ebiten.Wheel()
-	if dy > 0 {
-		p.zoom = min(32, p.zoom*2)
-	} else if dy < 0 {
-		p.zoom = max(1, p.zoom/2)
+	if dy > 0 || p.keys.justPressed("zoom_in") {
+		p.zoom = min(maxZoom, p.zoom*2)
+	} else if dy < 0 || p.keys.justPressed("zoom_out") {
+		p.zoom = max(minZoom, p.zoom/2)
 	}
 
 	// Space: pause/resume.
-	if inpututil.IsKeyJustPressed(ebiten.KeySpace) {
+	if p.keys.justPressed("pause") {
 		p.paused = !p.paused
 	}
 
 	// Frame stepping when paused.
 	if p.paused {
-		if inpututil.IsKeyJustPressed(ebiten.KeyArrowRight) {
+		if p.keys.justPressed("next_frame") {
 			for _, s := range p.sprites {
 				if s.FrameCount > 1 && s.FPS > 0 {
 					p.frameTime += 1.0 / float64(s.FPS)
 				}
 			}
 		}
-		if inpututil.IsKeyJustPressed(ebiten.KeyArrowLeft) {
+		if p.keys.justPressed("prev_frame") {
 			for _, s := range p.sprites {
 				if s.FrameCount > 1 && s.FPS > 0 {
 					p.frameTime -= 1.0 / float64(s.FPS)
@@ -245,20 +421,71 @@ func (p *Previewer) updateSprite() {
 	}
 
 	// G: toggle grid.
-	if inpututil.IsKeyJustPressed(ebiten.KeyG) {
+	if p.keys.justPressed("toggle_grid") {
 		p.showGrid = !p.showGrid
 	}
 
+	// I: cycle frame interpolation (off/alpha/additive); [ and ] adjust the mix.
+	// Only meaningful for an isolated animated sprite.
+	if p.selected >= 0 && p.selected < len(p.sprites) && canInterpolate(p.sprites[p.selected]) {
+		if p.keys.justPressed("interp_mode") {
+			p.interpMode = (p.interpMode + 1) % 3
+		}
+		if p.keys.justPressed("interp_mix_down") {
+			p.interpMix = max(0.1, p.interpMix-0.1)
+		}
+		if p.keys.justPressed("interp_mix_up") {
+			p.interpMix = min(0.9, p.interpMix+0.1)
+		}
+	}
+
+	// H: toggle the palette key heatmap of the isolated sprite.
+	// K: show sprites as keyed by transparent_color, if the project sets one.
+	if p.colorKey != nil && p.keys.justPressed("color_key") {
+		p.showKeyed = !p.showKeyed
+	}
+	// X: outline the isolated sprite's hitboxes.
+	if p.selected >= 0 && p.keys.justPressed("hitboxes") {
+		p.showHitboxes = !p.showHitboxes
+	}
+	if p.selected >= 0 && p.keys.justPressed("heatmap") {
+		p.heatmap = !p.heatmap
+		p.blinkKey = ""
+	}
+	if p.blinkTicks > 0 {
+		p.blinkTicks--
+		if p.blinkTicks == 0 {
+			p.blinkKey = ""
+		}
+	}
+
+	// R: replay animations from the first frame, for playback = "once".
+	if p.keys.justPressed("replay") {
+		p.frameTime = 0
+	}
+
 	// Escape: back to grid from isolation.
-	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+	if p.keys.justPressed("escape") {
 		p.selected = -1
 	}
 
+	// Click on a heatmap legend entry: blink the matching pixels.
+	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) && p.heatmap && p.selected >= 0 && p.selected < len(p.sprites) {
+		legend := p.sprites[p.selected].Legend
+		mx, my := ebiten.CursorPosition()
+		if i := p.legendHit(legend, mx, my); i >= 0 {
+			p.blinkKey = legend[i].Key
+			p.blinkTicks = heatmapBlinkTicks
+			return
+		}
+	}
+
 	// Click: isolate/deselect sprite.
 	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) && p.selected == -1 {
 		mx, my := ebiten.CursorPosition()
 		if idx := p.hitTestSprite(mx, my); idx >= 0 {
 			p.selected = idx
+			p.frameTime = 0
 		}
 	} else if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) && p.selected >= 0 {
 		p.selected = -1
@@ -285,10 +512,19 @@ func (p *Previewer) Draw(screen *ebiten.Image) {
 		p.drawMusic(screen)
 	}
 
-	// Error overlay.
-	if p.errorMsg != "" {
+	// Error overlay. A deleted file takes precedence over stale parse errors.
+	if p.deletedMsg != "" {
+		p.drawOverlay(screen, p.deletedMsg, color.RGBA{R: 0xcc, G: 0x88, B: 0x11, A: 0xdd})
+	} else if p.errorMsg != "" {
 		p.drawErrorOverlay(screen)
 	}
+
+	if p.showHelp {
+		p.drawHelp(screen)
+	} else {
+		hint := p.keys.keyLabel("help") + ": keys"
+		drawText(screen, hint, p.winW-textWidth(hint)-10, p.winH-lineHeight()-6)
+	}
 }
 
 func (p *Previewer) drawSpriteMode(screen *ebiten.Image) {
@@ -308,7 +544,7 @@ func (p *Previewer) drawSpriteMode(screen *ebiten.Image) {
 	}
 
 	if p.paused {
-		drawText(screen, "PAUSED", 10, p.winH-scaledCharH()-6)
+		drawText(screen, "PAUSED", 10, p.winH-lineHeight()-6)
 	}
 }
 
@@ -319,6 +555,48 @@ func (p *Previewer) Layout(outsideWidth, outsideHeight int) (int, int) {
 	return outsideWidth, outsideHeight
 }
 
+// setSprites replaces the rendered sprites. Sprite order is not stable
+// across reloads, so an isolated selection is carried over by name and
+// dropped only if that sprite no longer exists.
+func (p *Previewer) setSprites(sprites []*RenderedSprite) {
+	name := ""
+	if p.selected >= 0 && p.selected < len(p.sprites) {
+		name = p.sprites[p.selected].Name
+	}
+	p.sprites = sprites
+	p.selected = -1
+	if name != "" {
+		p.selected = spriteIndex(sprites, name)
+	}
+}
+
+// applyStartSprite isolates the sprite requested with SetStartSprite and
+// positions the animation on the requested frame.
+func (p *Previewer) applyStartSprite() {
+	if p.startSprite == "" {
+		return
+	}
+	idx := spriteIndex(p.sprites, p.startSprite)
+	if idx < 0 {
+		return
+	}
+	p.selected = idx
+	s := p.sprites[idx]
+	if s.FrameCount > 1 && s.FPS > 0 {
+		// Aim for the middle of the frame so float rounding can't land on the previous one.
+		p.frameTime = (float64(p.startFrame%s.FrameCount) + 0.5) / float64(s.FPS)
+	}
+}
+
+func spriteIndex(sprites []*RenderedSprite, name string) int {
+	for i, s := range sprites {
+		if s.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
 // loadSprites parses and resolves sprites from the file path.
 func (p *Previewer) loadSprites() ([]*RenderedSprite, error) {
 	sf, err := sprite.LoadSpriteFile(p.filePath)
@@ -330,6 +608,9 @@ func (p *Previewer) loadSprites() ([]*RenderedSprite, error) {
 	var pal *palette.Palette
 	if sf.PaletteRef != "" {
 		palPath := filepath.Join(p.assetsDir, "palettes", sf.PaletteRef+".palette")
+		p.reloadMu.Lock()
+		p.palettePath = palPath
+		p.reloadMu.Unlock()
 		pal, err = palette.LoadPalette(palPath)
 		if err != nil {
 			return nil, fmt.Errorf("loading palette %q: %w", sf.PaletteRef, err)
@@ -339,44 +620,70 @@ func (p *Previewer) loadSprites() ([]*RenderedSprite, error) {
 		pal = &palette.Palette{Colors: map[string]palette.Color{}}
 	}
 
-	resolved, err := sf.Resolve(pal)
+	resolved, err := sf.ResolveWith(pal, sprite.DirPartLoader(p.assetsDir), sprite.DirPaletteLoader(p.assetsDir))
 	if err != nil {
 		return nil, err
 	}
 
 	var result []*RenderedSprite
 	for _, rs := range resolved {
+		keys := sf.KeyGrids(rs.Name)
 		rendered := &RenderedSprite{
 			Name:       rs.Name,
 			FrameW:     rs.Grid.W,
 			FrameH:     rs.Grid.H,
 			FPS:        rs.Framerate,
 			FrameCount: len(rs.Frames),
+			Playback:   rs.Playback,
+			Keys:       keys,
+			Legend:     heatmapLegend(keys),
+			Pivot:      rs.Pivot,
+			Events:     rs.Events,
+			Hitboxes:   rs.Hitboxes,
 		}
 
 		for _, frame := range rs.Frames {
-			img := ebiten.NewImageFromImage(frameToImage(frame, rs.Grid))
+			img := ebiten.NewImageFromImage(frameToImage(frame, rs.Grid, nil))
 			rendered.Frames = append(rendered.Frames, img)
+			if p.colorKey != nil {
+				keyed := ebiten.NewImageFromImage(frameToImage(frame, rs.Grid, p.colorKey))
+				rendered.Keyed = append(rendered.Keyed, keyed)
+			}
 		}
 		result = append(result, rendered)
 	}
 	return result, nil
 }
 
-func frameToImage(frame sprite.ResolvedFrame, grid sprite.Grid) *image.RGBA {
+// frameToImage draws a frame. With a color key, transparent pixels take the
+// key color and every pixel is opaque, as in the built sheet.
+func frameToImage(frame sprite.ResolvedFrame, grid sprite.Grid, key *palette.Color) *image.RGBA {
 	img := image.NewRGBA(image.Rect(0, 0, grid.W, grid.H))
 	for y, row := range frame.Pixels {
 		for x, c := range row {
-			img.Set(x, y, c.ToRGBA())
+			img.Set(x, y, sprite.KeyColor(c, key).ToRGBA())
 		}
 	}
 	return img
 }
 
+// frames returns the images to draw for s: the keyed ones while the color
+// key preview is on.
+func (p *Previewer) frames(s *RenderedSprite) []*ebiten.Image {
+	if p.showKeyed && len(s.Keyed) == len(s.Frames) {
+		return s.Keyed
+	}
+	return s.Frames
+}
+
 // drawBackground fills the screen with the selected background.
 func (p *Previewer) drawBackground(screen *ebiten.Image) {
 	switch p.background {
 	case BackgroundDark:
+		if p.darkBackground.A != 0 {
+			screen.Fill(p.darkBackground.ToRGBA())
+			break
+		}
 		screen.Fill(color.RGBA{R: 0x1a, G: 0x1a, B: 0x1a, A: 0xff})
 	case BackgroundLight:
 		screen.Fill(color.RGBA{R: 0xe0, G: 0xe0, B: 0xe0, A: 0xff})
@@ -400,7 +707,7 @@ func (p *Previewer) drawBackground(screen *ebiten.Image) {
 
 // spriteGridLayout computes the auto-zoom grid layout for the current sprites/window.
 func (p *Previewer) spriteGridLayout() (z float64, cols, padding, cellW, cellH, offsetX, offsetY int) {
-	labelH := scaledCharH() + 6
+	labelH := lineHeight() + 6
 	padding = 24
 
 	maxW, maxH := 0, 0
@@ -417,7 +724,7 @@ func (p *Previewer) spriteGridLayout() (z float64, cols, padding, cellW, cellH,
 		if s.FrameCount > 1 {
 			lbl += fmt.Sprintf(" f:%d/%d @%dfps", s.FrameCount, s.FrameCount, s.FPS)
 		}
-		if w := len(lbl) * scaledCharW(); w > maxLabelW {
+		if w := textWidth(lbl); w > maxLabelW {
 			maxLabelW = w
 		}
 	}
@@ -425,7 +732,8 @@ func (p *Previewer) spriteGridLayout() (z float64, cols, padding, cellW, cellH,
 	// Auto-calculate zoom. For each column count, find the max zoom
 	// where both the scaled sprites AND labels fit without overlap.
 	n := len(p.sprites)
-	bestZoom := 1.0
+	maxW, maxH = max(maxW, 1), max(maxH, 1)
+	bestZoom := 0.0
 	bestCols := 1
 	for c := 1; c <= n; c++ {
 		rows := (n + c - 1) / c
@@ -437,10 +745,11 @@ func (p *Previewer) spriteGridLayout() (z float64, cols, padding, cellW, cellH,
 		zy := availH / float64(maxH)
 		zFit := min(zx, zy)
 
-		// Cell must also be wide enough for the label text.
+		// Cell must also be wide enough for the label text. Shrinking
+		// sprites below 1x would not make room for a label that long.
 		minCellW := maxLabelW + padding*2
 		maxZoomForLabel := (float64(p.winW)/float64(c) - float64(minCellW-int(float64(maxW)))) / float64(maxW)
-		if maxZoomForLabel < zFit {
+		if maxZoomForLabel >= 1 && maxZoomForLabel < zFit {
 			zFit = maxZoomForLabel
 		}
 
@@ -449,8 +758,18 @@ func (p *Previewer) spriteGridLayout() (z float64, cols, padding, cellW, cellH,
 			bestCols = c
 		}
 	}
-	// Snap to integer zoom for pixel-perfect rendering.
-	z = float64(max(1, int(bestZoom)))
+	// Snap to integer zoom for pixel-perfect rendering. Sprites wider or
+	// taller than the window, such as a long strip of frames, shrink by
+	// halves instead, down to 1/16.
+	switch {
+	case bestZoom >= 1 || bestZoom <= 0:
+		z = float64(max(1, int(bestZoom)))
+	default:
+		z = 1.0 / 16
+		for z*2 <= bestZoom {
+			z *= 2
+		}
+	}
 	cols = bestCols
 
 	spriteW := int(float64(maxW) * z)
@@ -461,11 +780,10 @@ func (p *Previewer) spriteGridLayout() (z float64, cols, padding, cellW, cellH,
 	totalW := usedCols * cellW
 	rows := (n + cols - 1) / cols
 	totalH := rows * cellH
-	offsetX = (p.winW - totalW) / 2
-	offsetY = (p.winH - totalH) / 2
-	if offsetY < padding {
-		offsetY = padding
-	}
+	// A grid larger than the window starts at its top-left corner rather
+	// than off screen.
+	offsetX = max(0, (p.winW-totalW)/2)
+	offsetY = max(padding, (p.winH-totalH)/2)
 	return
 }
 
@@ -505,20 +823,23 @@ func (p *Previewer) drawSpriteGrid(screen *ebiten.Image) {
 			op.GeoM.Scale(z, z)
 			op.GeoM.Translate(float64(sx), float64(sy))
 			op.Filter = ebiten.FilterNearest
-			screen.DrawImage(s.Frames[frame], op)
+			screen.DrawImage(p.frames(s)[frame], op)
 		}
 
 		label := fmt.Sprintf("%s %dx%d", s.Name, s.FrameW, s.FrameH)
 		if s.FrameCount > 1 {
 			label += fmt.Sprintf(" f:%d/%d @%dfps", frame+1, s.FrameCount, s.FPS)
 		}
-		// Center label under sprite.
-		labelW := len(label) * scaledCharW()
-		labelX := cx + (cellW-padding*2-labelW)/2
-		drawText(screen, label, labelX, cy+int(float64(maxH)*z)+4)
+		drawText(screen, label, gridLabelX(cx, cellW, padding, label), cy+int(float64(maxH)*z)+4)
 	}
 }
 
+// gridLabelX returns where a label starts to sit centered under the sprite
+// of the grid cell whose content starts at cx.
+func gridLabelX(cx, cellW, padding int, label string) int {
+	return cx + (cellW-padding*2-textWidth(label))/2
+}
+
 // drawIsolated draws a single sprite centered in the window.
 func (p *Previewer) drawIsolated(screen *ebiten.Image, s *RenderedSprite) {
 	z := float64(p.zoom)
@@ -532,17 +853,148 @@ func (p *Previewer) drawIsolated(screen *ebiten.Image, s *RenderedSprite) {
 	cx := (float64(p.winW) - sw) / 2
 	cy := (float64(p.winH) - sh) / 2
 
+	label := fmt.Sprintf("%s %dx%d", s.Name, s.FrameW, s.FrameH)
+	if s.FrameCount > 1 {
+		label += fmt.Sprintf(" f:%d/%d @%dfps", frame+1, s.FrameCount, s.FPS)
+	}
+
+	// Composed sprites and sprites from other files have no key grid in
+	// this file; they are drawn as usual, with a notice.
+	if p.heatmap && len(s.Keys) > 0 {
+		p.drawHeatmap(screen, s, frame, z, cx, cy)
+		drawText(screen, label, 10, 10)
+		drawText(screen, "heatmap: click a key to blink it", 10, 10+lineHeight()+4)
+		return
+	}
+
 	op := &ebiten.DrawImageOptions{}
 	op.GeoM.Scale(z, z)
 	op.GeoM.Translate(cx, cy)
 	op.Filter = ebiten.FilterNearest
-	screen.DrawImage(s.Frames[frame], op)
-
-	label := fmt.Sprintf("%s %dx%d", s.Name, s.FrameW, s.FrameH)
-	if s.FrameCount > 1 {
-		label += fmt.Sprintf(" f:%d/%d @%dfps", frame+1, s.FrameCount, s.FPS)
+	screen.DrawImage(p.frames(s)[frame], op)
+
+	interp := p.interpMode != InterpOff && canInterpolate(s)
+	if interp {
+		if next, blend := p.interpFrame(s); blend {
+			op.ColorScale.ScaleAlpha(float32(p.interpMix))
+			if p.interpMode == InterpAdditive {
+				op.Blend = ebiten.BlendLighter
+			}
+			screen.DrawImage(p.frames(s)[next], op)
+		}
+	}
+	if s.Pivot != nil {
+		p.drawPivot(screen, s, z, cx, cy)
+	}
+	if p.showHitboxes {
+		drawHitboxes(screen, s.Hitboxes, frame, z, cx, cy)
 	}
+	if s.FrameCount > 1 || len(s.Events) > 0 {
+		p.drawTimeline(screen, s, frame)
+	}
+
 	drawText(screen, label, 10, 10)
+	y := 10 + lineHeight() + 4
+	if interp {
+		readout := fmt.Sprintf("interp %s mix %d%% -> %dfps", p.interpMode, int(p.interpMix*100+0.5), s.FPS*2)
+		drawText(screen, readout, 10, y)
+		y += lineHeight() + 4
+	}
+	if p.heatmap {
+		drawText(screen, "heatmap: no key grid for a composed sprite or one from another file", 10, y)
+	}
+}
+
+// drawPivot draws a crosshair through the center of the sprite's pivot
+// pixel, overhanging the sprite by one pixel so the ground line is visible
+// past its feet.
+func (p *Previewer) drawPivot(screen *ebiten.Image, s *RenderedSprite, z, cx, cy float64) {
+	c := color.RGBA{R: 0xff, G: 0x00, B: 0xff, A: 0xcc}
+	px := int(cx + (float64(s.Pivot.X)+0.5)*z)
+	py := int(cy + (float64(s.Pivot.Y)+0.5)*z)
+	for x := int(cx - z); x < int(cx+float64(s.FrameW+1)*z); x++ {
+		screen.Set(x, py, c)
+	}
+	for y := int(cy - z); y < int(cy+float64(s.FrameH+1)*z); y++ {
+		screen.Set(px, y, c)
+	}
+}
+
+// Hitbox outline colors: hurt boxes green, hit boxes red.
+var (
+	hurtColor = color.RGBA{R: 0x30, G: 0xe0, B: 0x30, A: 0xff}
+	hitColor  = color.RGBA{R: 0xf0, G: 0x30, B: 0x30, A: 0xff}
+)
+
+// drawHitboxes outlines the boxes that apply to frame, for a sprite drawn
+// at cx, cy with zoom z.
+func drawHitboxes(screen *ebiten.Image, boxes []sprite.Hitbox, frame int, z, cx, cy float64) {
+	for _, h := range boxes {
+		if !h.OnFrame(frame) {
+			continue
+		}
+		c := hurtColor
+		if h.Type == sprite.HitboxHit {
+			c = hitColor
+		}
+		x, y := int(cx+float64(h.X)*z), int(cy+float64(h.Y)*z)
+		strokeRect(screen, x, y, int(float64(h.W)*z), int(float64(h.H)*z), c)
+	}
+}
+
+// drawTimeline draws a bar along the bottom of the window with a cell per
+// frame and the current one highlighted. Frames that fire events get a
+// marker, and the current frame's event names are shown above the bar.
+func (p *Previewer) drawTimeline(screen *ebiten.Image, s *RenderedSprite, frame int) {
+	const barH, markH = 8, 4
+	cellW := (p.winW - 20) / s.FrameCount
+	if cellW < 2 {
+		return
+	}
+	x0, y0 := 10, p.winH-barH-10
+	for i := 0; i < s.FrameCount; i++ {
+		c := color.RGBA{R: 0x50, G: 0x50, B: 0x50, A: 0xff}
+		if i == frame {
+			c = color.RGBA{R: 0xcc, G: 0xcc, B: 0xcc, A: 0xff}
+		}
+		x := x0 + i*cellW
+		p.fillRect(screen, x, y0, cellW-1, barH, c)
+		if len(s.Events[i]) > 0 {
+			w := min(cellW-1, 6)
+			p.fillRect(screen, x+(cellW-1-w)/2, y0-markH-2, w, markH, color.RGBA{R: 0xff, G: 0xcc, B: 0x00, A: 0xff})
+		}
+	}
+	if names := s.Events[frame]; len(names) > 0 {
+		drawText(screen, strings.Join(names, " "), x0, y0-markH-4-lineHeight())
+	}
+}
+
+// fillRect fills a rectangle with c.
+func (p *Previewer) fillRect(screen *ebiten.Image, x, y, w, h int, c color.RGBA) {
+	if p.pixel == nil {
+		p.pixel = ebiten.NewImage(1, 1)
+		p.pixel.Fill(color.White)
+	}
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Scale(float64(w), float64(h))
+	op.GeoM.Translate(float64(x), float64(y))
+	op.ColorScale.ScaleWithColor(c)
+	screen.DrawImage(p.pixel, op)
+}
+
+// canInterpolate reports whether a sprite has frames to blend between.
+func canInterpolate(s *RenderedSprite) bool {
+	return s.FrameCount > 1 && s.FPS > 0
+}
+
+// interpFrame returns the frame to blend over the current one. Each source
+// frame is split into two half-steps; the second half shows the in-between
+// (current blended toward next), doubling the effective framerate.
+func (p *Previewer) interpFrame(s *RenderedSprite) (next int, blend bool) {
+	pos := p.frameTime * float64(s.FPS)
+	sub := pos - math.Floor(pos)
+	next = s.frameAt(int(pos) + 1)
+	return next, sub >= 0.5 && next != p.currentFrame(s)
 }
 
 // drawPixelGrid overlays 1px grid lines at pixel boundaries.
@@ -567,17 +1019,26 @@ func (p *Previewer) drawPixelGrid(screen *ebiten.Image) {
 
 // drawErrorOverlay renders a semi-transparent red box with error text.
 func (p *Previewer) drawErrorOverlay(screen *ebiten.Image) {
-	boxH := scaledCharH() + 16
+	p.drawOverlay(screen, "ERROR: "+p.errorMsg, color.RGBA{R: 0xcc, G: 0x22, B: 0x22, A: 0xdd})
+}
+
+// overlayMaxLines caps how many lines of a message the overlay shows.
+const overlayMaxLines = 8
+
+// drawOverlay renders a full-width banner with msg wrapped to the window
+// width.
+func (p *Previewer) drawOverlay(screen *ebiten.Image, msg string, bg color.RGBA) {
+	lines := wrapText(msg, p.winW-20)
+	if len(lines) > overlayMaxLines {
+		lines = append(lines[:overlayMaxLines-1], "...")
+	}
+	boxH := len(lines)*lineHeight() + 16
 	for y := 0; y < boxH; y++ {
 		for x := 0; x < p.winW; x++ {
-			screen.Set(x, y, color.RGBA{R: 0xcc, G: 0x22, B: 0x22, A: 0xdd})
+			screen.Set(x, y, bg)
 		}
 	}
-	msg := p.errorMsg
-	if len(msg) > 100 {
-		msg = msg[:100] + "..."
-	}
-	drawText(screen, "ERROR: "+msg, 10, 8)
+	drawText(screen, strings.Join(lines, "\n"), 10, 8)
 }
 
 // currentFrame computes the current animation frame index.
@@ -585,11 +1046,13 @@ func (p *Previewer) currentFrame(s *RenderedSprite) int {
 	if s.FrameCount <= 1 || s.FPS <= 0 {
 		return 0
 	}
-	frame := int(p.frameTime*float64(s.FPS)) % s.FrameCount
-	if frame < 0 {
-		frame += s.FrameCount
-	}
-	return frame
+	return s.frameAt(int(p.frameTime * float64(s.FPS)))
+}
+
+// frameAt returns the frame shown at step n of the animation; see
+// sprite.FrameAt.
+func (s *RenderedSprite) frameAt(n int) int {
+	return sprite.FrameAt(s.Playback, s.FrameCount, n)
 }
 
 // hitTestSprite returns the sprite index at screen position, or -1.
@@ -622,30 +1085,26 @@ func (p *Previewer) hitTestSprite(mx, my int) int {
 func (p *Previewer) startWatcher() {
 	dir := filepath.Dir(p.filePath)
 	w, err := watcher.New(100*time.Millisecond, func(changed []string) error {
+		watched := p.watchedPaths()
 		for _, f := range changed {
-			if f == p.filePath || strings.HasSuffix(f, ".palette") {
-				if p.mode == ModeSpritePreview {
-					sprites, err := p.loadSprites()
-					p.reloadMu.Lock()
-					if err != nil {
-						p.pendingErr = err.Error()
-					} else {
-						p.pendingLoad = sprites
-						p.pendingErr = ""
-					}
-					p.reloadMu.Unlock()
-				} else {
-					err := p.loadAsset()
-					p.reloadMu.Lock()
-					if err != nil {
-						p.pendingErr = err.Error()
-					} else {
-						p.pendingErr = ""
-					}
-					p.reloadMu.Unlock()
-				}
+			if p.mode == ModeMusicPreview && strings.HasSuffix(f, ".inst") {
+				// Blocks rendered with the old instrument can't be
+				// used again.
+				p.trackCache.Reset()
+				p.startReload()
 				return nil
 			}
+			if !slices.Contains(watched, f) && !strings.HasSuffix(f, ".palette") {
+				continue
+			}
+			if slices.Contains(watched, f) {
+				if _, err := os.Stat(f); os.IsNotExist(err) {
+					p.markMissing(f)
+					return nil
+				}
+			}
+			p.startReload()
+			return nil
 		}
 		return nil
 	})
@@ -660,66 +1119,175 @@ func (p *Previewer) startWatcher() {
 		if info, err := os.Stat(palDir); err == nil && info.IsDir() {
 			_ = w.WatchDir(palDir)
 		}
+		instDir := filepath.Join(p.assetsDir, "instruments")
+		if info, err := os.Stat(instDir); err == nil && info.IsDir() && p.mode == ModeMusicPreview {
+			_ = w.WatchDir(instDir)
+		}
 	}
 
+	// The window may have closed while the watcher was being set up, from
+	// waitForFile; a watcher stored now would never be stopped.
+	p.reloadMu.Lock()
+	if p.closed {
+		p.reloadMu.Unlock()
+		_ = w.Stop()
+		return
+	}
 	p.watcher = w
+	p.reloadMu.Unlock()
 	go w.Start()
 }
 
 func (p *Previewer) stopWatcher() {
-	if p.watcher != nil {
-		_ = p.watcher.Stop()
+	p.reloadMu.Lock()
+	p.closed = true
+	w := p.watcher
+	p.watcher = nil
+	if p.cancelReload != nil {
+		p.cancelReload()
+	}
+	p.reloadMu.Unlock()
+	if w != nil {
+		_ = w.Stop()
 	}
 }
 
-// State persistence.
-
-type previewState struct {
-	Zoom       int    `json:"zoom"`
-	Background int    `json:"background"`
-	ShowGrid   bool   `json:"show_grid"`
-	LastFile   string `json:"last_file"`
+// watchedPaths returns the files whose deletion should be reported: the
+// previewed file and, in sprite mode, the palette it references.
+func (p *Previewer) watchedPaths() []string {
+	p.reloadMu.Lock()
+	defer p.reloadMu.Unlock()
+	paths := []string{p.filePath}
+	if p.mode == ModeSpritePreview && p.palettePath != "" {
+		paths = append(paths, p.palettePath)
+	}
+	return paths
 }
 
-func stateFilePath() string {
-	dir, err := os.UserConfigDir()
-	if err != nil {
-		return ""
+// startReload cancels the reload in progress, if any, and starts another in
+// the background, so the watcher isn't held up by a long audio render and
+// a burst of saves doesn't queue a render for each.
+func (p *Previewer) startReload() {
+	p.reloadMu.Lock()
+	defer p.reloadMu.Unlock()
+	if p.closed {
+		return
 	}
-	return filepath.Join(dir, "runefact", "preview.json")
+	if p.cancelReload != nil {
+		p.cancelReload()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancelReload = cancel
+	if p.mode == ModeMusicPreview {
+		p.rendering = true
+		p.renderDone, p.renderTotal = 0, 0
+	}
+	go p.reload(ctx)
 }
 
-func loadState() *previewState {
-	path := stateFilePath()
-	if path == "" {
-		return nil
+// reload re-parses the asset from disk and queues the result for Update.
+// Nothing is queued once ctx is canceled, so a superseded reload can't
+// replace the result of a newer one.
+func (p *Previewer) reload(ctx context.Context) {
+	var err error
+	var sprites []*RenderedSprite
+	var nextSFX *SFXPreviewState
+	var nextMus *MusicPreviewState
+	var nextMap *MapPreviewState
+	switch p.mode {
+	case ModeSpritePreview:
+		sprites, err = p.loadSprites()
+	case ModeMapPreview:
+		var mf *tilemap.MapFile
+		if mf, _, err = tilemap.LoadMapFile(p.filePath); err == nil {
+			nextMap = p.newMapState(mf)
+		}
+	case ModeSFXPreview:
+		var s *sfx.SFX
+		if s, err = sfx.LoadSFX(p.filePath); err == nil {
+			sr := p.sampleRate
+			if sr == 0 {
+				sr = 44100
+			}
+			nextSFX, err = newSFXState(ctx, s, sr)
+		}
+	case ModeMusicPreview:
+		var tr *track.Track
+		if tr, err = track.LoadTrack(p.filePath); err == nil {
+			nextMus, err = p.newMusicState(ctx, tr)
+		}
 	}
-	data, err := os.ReadFile(path)
+
+	p.reloadMu.Lock()
+	defer p.reloadMu.Unlock()
+	if ctx.Err() != nil {
+		return
+	}
+	p.rendering = false
 	if err != nil {
-		return nil
+		slog.Warn("reload failed", "file", p.filePath, "err", err)
+		p.pendingErr = err.Error()
+		return
 	}
-	var st previewState
-	if json.Unmarshal(data, &st) != nil {
-		return nil
+	slog.Debug("reloaded", "file", p.filePath)
+	p.pendingErr = ""
+	switch {
+	case sprites != nil:
+		p.pendingLoad = sprites
+	case nextSFX != nil:
+		p.pendingSFX = nextSFX
+	case nextMus != nil:
+		p.pendingMus = nextMus
+	case nextMap != nil:
+		p.pendingMap = nextMap
 	}
-	return &st
 }
 
-func (p *Previewer) saveState() {
-	path := stateFilePath()
-	if path == "" {
-		return
+// markMissing records that a watched file was deleted and starts polling
+// for it to reappear. The last good render stays on screen meanwhile.
+func (p *Previewer) markMissing(path string) {
+	p.reloadMu.Lock()
+	p.missingPath = path
+	start := !p.waiting && !p.closed
+	if start {
+		p.waiting = true
 	}
-	st := previewState{
-		Zoom:       p.zoom,
-		Background: int(p.background),
-		ShowGrid:   p.showGrid,
-		LastFile:   p.filePath,
+	p.reloadMu.Unlock()
+	if start {
+		go p.waitForFile()
 	}
-	data, err := json.MarshalIndent(st, "", "  ")
-	if err != nil {
+}
+
+// waitForFile polls until the missing file exists again, then re-creates
+// the watcher (some platforms keep watching the old inode) and reloads.
+func (p *Previewer) waitForFile() {
+	for {
+		time.Sleep(250 * time.Millisecond)
+		p.reloadMu.Lock()
+		path, closed := p.missingPath, p.closed
+		if closed {
+			p.waiting = false
+			p.reloadMu.Unlock()
+			return
+		}
+		p.reloadMu.Unlock()
+
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+
+		p.reloadMu.Lock()
+		p.missingPath = ""
+		p.waiting = false
+		old := p.watcher
+		p.watcher = nil
+		p.reloadMu.Unlock()
+
+		if old != nil {
+			_ = old.Stop()
+		}
+		p.startWatcher()
+		p.startReload()
 		return
 	}
-	_ = os.MkdirAll(filepath.Dir(path), 0755)
-	_ = os.WriteFile(path, data, 0644)
 }
@@ -1,12 +1,20 @@
 package preview
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"image/color"
+	"math"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/vgalaktionov/runefact/internal/sfx"
+	"github.com/vgalaktionov/runefact/internal/sprite"
+	"github.com/vgalaktionov/runefact/internal/tilemap"
 	"github.com/vgalaktionov/runefact/internal/track"
 )
 
@@ -39,6 +47,26 @@ func TestCurrentFrame(t *testing.T) {
 			t.Errorf("currentFrame at t=0.5 = %d, want 0 (wrapped)", got)
 		}
 	})
+
+	t.Run("playback modes", func(t *testing.T) {
+		tests := []struct {
+			playback string
+			want     []int // frames at steps 0..7
+		}{
+			{sprite.PlaybackLoop, []int{0, 1, 2, 3, 0, 1, 2, 3}},
+			{sprite.PlaybackOnce, []int{0, 1, 2, 3, 3, 3, 3, 3}},
+			{sprite.PlaybackPingPong, []int{0, 1, 2, 3, 2, 1, 0, 1}},
+		}
+		for _, tt := range tests {
+			s := &RenderedSprite{FrameCount: 4, FPS: 8, Playback: tt.playback}
+			for step, want := range tt.want {
+				p.frameTime = (float64(step) + 0.5) / 8
+				if got := p.currentFrame(s); got != want {
+					t.Errorf("%s: frame at step %d = %d, want %d", tt.playback, step, got, want)
+				}
+			}
+		}
+	})
 }
 
 func TestStatePersistence(t *testing.T) {
@@ -100,10 +128,13 @@ func TestBackgroundTypeCycling(t *testing.T) {
 	}
 }
 
+// testOptions is a previewer configuration with no pixel_scale set.
+var testOptions = Options{WindowWidth: 800, WindowHeight: 600, SampleRate: 44100}
+
 func TestNewPreviewer(t *testing.T) {
-	p := NewPreviewer("/tmp/test.sprite", "/tmp/assets", 800, 600, 44100)
-	if p.zoom != 2 {
-		t.Errorf("default zoom = %d, want 2", p.zoom)
+	p := NewPreviewer("/tmp/test.sprite", "/tmp/assets", testOptions)
+	if p.zoom != 4 {
+		t.Errorf("default zoom = %d, want 4", p.zoom)
 	}
 	if p.selected != -1 {
 		t.Errorf("selected = %d, want -1", p.selected)
@@ -116,6 +147,30 @@ func TestNewPreviewer(t *testing.T) {
 	}
 }
 
+func TestNewPreviewer_PixelScale(t *testing.T) {
+	for scale, want := range map[int]int{1: 1, 6: 6, 100: 32} {
+		opts := testOptions
+		opts.PixelScale = scale
+		if p := NewPreviewer("/tmp/test.sprite", "/tmp/assets", opts); p.zoom != want {
+			t.Errorf("pixel_scale %d: zoom = %d, want %d", scale, p.zoom, want)
+		}
+	}
+}
+
+func TestApplyState_Zoom(t *testing.T) {
+	opts := testOptions
+	opts.PixelScale = 6
+	// A saved zoom overrides pixel_scale; a missing or corrupt one doesn't
+	// leave the previewer at a zoom it can't lay out.
+	for saved, want := range map[int]int{8: 8, 0: 6, -2: 6, 4096: 32} {
+		p := NewPreviewer("/tmp/test.sprite", "/tmp/assets", opts)
+		p.applyState(previewState{Zoom: saved})
+		if p.zoom != want {
+			t.Errorf("saved zoom %d: zoom = %d, want %d", saved, p.zoom, want)
+		}
+	}
+}
+
 func TestHitTestSprite_Empty(t *testing.T) {
 	p := &Previewer{zoom: 4, winW: 800, winH: 600}
 	if got := p.hitTestSprite(100, 100); got != -1 {
@@ -134,7 +189,7 @@ func TestModeDetection(t *testing.T) {
 		{"bgm.track", ModeMusicPreview},
 	}
 	for _, tt := range tests {
-		p := NewPreviewer("/tmp/"+tt.file, "/tmp/assets", 800, 600, 44100)
+		p := NewPreviewer("/tmp/"+tt.file, "/tmp/assets", testOptions)
 		if p.mode != tt.want {
 			t.Errorf("mode for %q = %d, want %d", tt.file, p.mode, tt.want)
 		}
@@ -200,3 +255,766 @@ func TestFormatNote(t *testing.T) {
 		}
 	}
 }
+
+func TestWatchedPaths(t *testing.T) {
+	p := NewPreviewer("/assets/sprites/hero.sprite", "/assets", testOptions)
+	if got := p.watchedPaths(); len(got) != 1 || got[0] != p.filePath {
+		t.Errorf("watchedPaths() = %v, want only the sprite file", got)
+	}
+
+	p.palettePath = "/assets/palettes/default.palette"
+	got := p.watchedPaths()
+	if len(got) != 2 || got[1] != p.palettePath {
+		t.Errorf("watchedPaths() = %v, want sprite and palette", got)
+	}
+
+	m := NewPreviewer("/assets/maps/world.map", "/assets", testOptions)
+	m.palettePath = "/assets/palettes/default.palette"
+	if got := m.watchedPaths(); len(got) != 1 {
+		t.Errorf("map watchedPaths() = %v, want only the map file", got)
+	}
+}
+
+func TestMarkMissing_AfterStop(t *testing.T) {
+	p := NewPreviewer("/assets/sprites/hero.sprite", "/assets", testOptions)
+	p.stopWatcher()
+	p.markMissing(p.filePath)
+	if p.missingPath != p.filePath {
+		t.Errorf("missingPath = %q, want %q", p.missingPath, p.filePath)
+	}
+	if p.waiting {
+		t.Error("no poller should start after the previewer is closed")
+	}
+}
+
+func TestSwapSFXState(t *testing.T) {
+	p := NewPreviewer("/assets/sfx/jump.sfx", "/assets", testOptions)
+	p.sfxState = &SFXPreviewState{audioErr: "no device"}
+
+	next := &SFXPreviewState{sampleRate: 44100}
+	p.swapSFXState(next)
+
+	if p.sfxState != next {
+		t.Fatal("sfxState was not replaced")
+	}
+	if next.audioErr != "no device" {
+		t.Errorf("audioErr = %q, want carried over", next.audioErr)
+	}
+	if next.player != nil {
+		t.Error("idle state should not start playback on swap")
+	}
+}
+
+func TestSwapMusicState_ResetsCursor(t *testing.T) {
+	p := NewPreviewer("/assets/tracks/demo.track", "/assets", testOptions)
+	p.musicState = &MusicPreviewState{currentRow: 7, currentPat: 1, elapsed: 3.5}
+
+	next := &MusicPreviewState{}
+	p.swapMusicState(next)
+
+	if p.musicState != next {
+		t.Fatal("musicState was not replaced")
+	}
+	if next.playing || next.currentRow != 0 || next.currentPat != 0 || next.elapsed != 0 {
+		t.Errorf("new state should start stopped at row 0, got %+v", next)
+	}
+}
+
+func TestNewMusicState_CachesPatterns(t *testing.T) {
+	assets := t.TempDir()
+	instDir := filepath.Join(assets, "instruments")
+	if err := os.MkdirAll(instDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	inst := "name = \"tone\"\n[oscillator]\nwaveform = \"sine\"\n[envelope]\nsustain = 1\n"
+	if err := os.WriteFile(filepath.Join(instDir, "tone.inst"), []byte(inst), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tr, err := track.ParseTrack([]byte(`tempo = 120
+[[channel]]
+name = "m"
+instrument = "tone"
+volume = 1
+[pattern.a]
+data = """
+m
+C4
+---
+"""
+[song]
+sequence = ["a", "a", "a"]
+`), "demo.track")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewPreviewer(filepath.Join(assets, "tracks", "demo.track"), assets, testOptions)
+	p.rendering = true
+	ms, err := p.newMusicState(context.Background(), tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms.samples) == 0 || ms.loading {
+		t.Errorf("got %d samples, loading %v; want a finished render", len(ms.samples), ms.loading)
+	}
+	if p.renderDone != 3 || p.renderTotal != 3 {
+		t.Errorf("progress = %d/%d, want 3/3", p.renderDone, p.renderTotal)
+	}
+	if got := p.renderLabel(); got != "Rendering... 3/3 patterns" {
+		t.Errorf("renderLabel = %q", got)
+	}
+	if ms.cache != p.trackCache || p.trackCache.Len() != 1 {
+		t.Errorf("cache holds %d blocks, want the one pattern", p.trackCache.Len())
+	}
+}
+
+func TestSetSprites_KeepsSelectionByName(t *testing.T) {
+	p := &Previewer{selected: -1}
+	p.setSprites([]*RenderedSprite{{Name: "idle"}, {Name: "coin"}})
+	p.selected = 1
+
+	// Reload returns sprites in a different order.
+	p.setSprites([]*RenderedSprite{{Name: "coin"}, {Name: "idle"}, {Name: "run"}})
+	if p.selected != 0 {
+		t.Errorf("selected = %d, want 0 (coin)", p.selected)
+	}
+
+	// Selected sprite removed: fall back to the grid.
+	p.setSprites([]*RenderedSprite{{Name: "idle"}})
+	if p.selected != -1 {
+		t.Errorf("selected = %d, want -1", p.selected)
+	}
+}
+
+func TestApplyStartSprite(t *testing.T) {
+	p := NewPreviewer("player.sprite", "", testOptions)
+	p.SetStartSprite("coin", 2, true)
+	p.sprites = []*RenderedSprite{
+		{Name: "idle", FrameCount: 1},
+		{Name: "coin", FrameCount: 4, FPS: 6},
+	}
+	p.applyStartSprite()
+
+	if p.selected != 1 {
+		t.Fatalf("selected = %d, want 1", p.selected)
+	}
+	if !p.paused {
+		t.Error("expected paused")
+	}
+	if got := p.currentFrame(p.sprites[1]); got != 2 {
+		t.Errorf("currentFrame = %d, want 2", got)
+	}
+}
+
+func TestInterpFrame(t *testing.T) {
+	p := &Previewer{}
+	s := &RenderedSprite{FrameCount: 3, FPS: 4}
+
+	tests := []struct {
+		t     float64
+		next  int
+		blend bool
+	}{
+		{0.0, 1, false}, // first half of frame 0
+		{0.15, 1, true}, // second half of frame 0: blend toward 1
+		{0.3, 2, false}, // frame 1
+		{0.65, 0, true}, // second half of frame 2 wraps to 0
+	}
+	for _, tt := range tests {
+		p.frameTime = tt.t
+		next, blend := p.interpFrame(s)
+		if next != tt.next || blend != tt.blend {
+			t.Errorf("t=%.2f: interpFrame = (%d, %v), want (%d, %v)", tt.t, next, blend, tt.next, tt.blend)
+		}
+	}
+}
+
+func TestCanInterpolate(t *testing.T) {
+	if canInterpolate(&RenderedSprite{FrameCount: 1, FPS: 8}) {
+		t.Error("single-frame sprite should not interpolate")
+	}
+	if canInterpolate(&RenderedSprite{FrameCount: 4, FPS: 0}) {
+		t.Error("sprite without framerate should not interpolate")
+	}
+	if !canInterpolate(&RenderedSprite{FrameCount: 2, FPS: 8}) {
+		t.Error("animated sprite should interpolate")
+	}
+}
+
+func TestHeatmapLegend(t *testing.T) {
+	frames := [][][]string{
+		{{"a", "a", "_"}, {"a", "b", "_"}},
+		{{"a", "c", "c"}, {"a", "_", "_"}},
+	}
+	legend := heatmapLegend(frames)
+
+	var keys []string
+	for _, e := range legend {
+		keys = append(keys, e.Key)
+	}
+	if got := strings.Join(keys, ","); got != "a,c,b" {
+		t.Errorf("legend keys = %s, want a,c,b (by count, transparent excluded)", got)
+	}
+	if legend[0].Count != 5 {
+		t.Errorf("count of a = %d, want 5", legend[0].Count)
+	}
+
+	seen := map[color.RGBA]bool{}
+	for _, e := range legend {
+		if seen[e.Color] {
+			t.Errorf("duplicate false color %v", e.Color)
+		}
+		seen[e.Color] = true
+	}
+}
+
+func TestFalseColor_Distinct(t *testing.T) {
+	const n = 16
+	seen := map[color.RGBA]bool{}
+	for i := 0; i < n; i++ {
+		c := falseColor(i, n)
+		if seen[c] {
+			t.Fatalf("color %d (%v) repeats", i, c)
+		}
+		seen[c] = true
+	}
+	if c := falseColor(0, 3); c != (color.RGBA{R: 255, A: 255}) {
+		t.Errorf("first color = %v, want pure red", c)
+	}
+}
+
+func TestMusicBusControls(t *testing.T) {
+	tr := &track.Track{
+		Buses: map[string]*track.Bus{
+			"drums": {Name: "drums", Volume: 0.8},
+			"bass":  {Name: "bass", Volume: 2},
+		},
+		MasterVolume: 1,
+	}
+	ms := &MusicPreviewState{track: tr}
+
+	if ms.adjustBus(busVolumeStep) {
+		t.Error("adjustBus with no selection should do nothing")
+	}
+	var order []string
+	for range 3 {
+		ms.cycleBus()
+		order = append(order, ms.selectedBus)
+	}
+	if strings.Join(order, ",") != "bass,drums," {
+		t.Errorf("Tab order = %q, want bass,drums,(none)", order)
+	}
+
+	ms.selectedBus = "drums"
+	if !ms.adjustBus(-busVolumeStep) || tr.Buses["drums"].Volume != 0.75 {
+		t.Errorf("drums volume = %v, want 0.75", tr.Buses["drums"].Volume)
+	}
+	ms.selectedBus = "bass"
+	if ms.adjustBus(busVolumeStep) {
+		t.Error("bass volume should be clamped at 2")
+	}
+}
+
+func TestSpectrum_SinePeak(t *testing.T) {
+	const sr = 8192
+	block := make([]float64, scopeWindow)
+	for i := range block {
+		block[i] = math.Sin(2 * math.Pi * 1000 * float64(i) / sr)
+	}
+	mags := spectrum(block)
+	if len(mags) != scopeWindow/2+1 {
+		t.Fatalf("got %d bins, want %d", len(mags), scopeWindow/2+1)
+	}
+	peak := 0
+	for i := range mags {
+		if mags[i] > mags[peak] {
+			peak = i
+		}
+	}
+	if f := float64(peak) * sr / scopeWindow; f != 1000 {
+		t.Errorf("peak at %v Hz, want 1000", f)
+	}
+	if db := toDB(mags[peak]); math.Abs(db) > 0.5 {
+		t.Errorf("full-scale sine peak = %.2f dB, want ~0", db)
+	}
+	if db := toDB(mags[peak/2]); db > -60 {
+		t.Errorf("off-peak bin = %.2f dB, want below -60", db)
+	}
+}
+
+func TestFreqAxis(t *testing.T) {
+	decades := freqDecades(20, 22050)
+	labels := make([]string, len(decades))
+	for i, f := range decades {
+		labels[i] = freqLabel(f)
+	}
+	if strings.Join(labels, ",") != "100,1k,10k" {
+		t.Errorf("decade labels = %v", labels)
+	}
+	if x := logFreqX(20, 20, 20000, 300); x != 0 {
+		t.Errorf("lowest frequency at x=%d, want 0", x)
+	}
+	if x := logFreqX(2000, 20, 20000, 300); x != 200 {
+		t.Errorf("2 kHz at x=%d, want 200 (two decades of three)", x)
+	}
+}
+
+func TestWaveViewCycle(t *testing.T) {
+	v := viewEnvelope
+	var names []string
+	for range 3 {
+		v = v.next()
+		names = append(names, v.String())
+	}
+	if strings.Join(names, ",") != "Oscilloscope,Spectrum,Waveform" {
+		t.Errorf("V cycle = %v", names)
+	}
+}
+
+func TestMusicSetCursor(t *testing.T) {
+	tr := &track.Track{
+		Patterns: map[string]*track.Pattern{
+			"a": {Rows: make([][]track.Note, 4)},
+			"b": {Rows: make([][]track.Note, 8)},
+		},
+		Sequence: []string{"a", "b"},
+	}
+	ms := &MusicPreviewState{track: tr, sampleRate: 1000, samplesPerTick: 100}
+
+	ms.setCursor(650) // tick 6: pattern b, row 2
+	if ms.currentPat != 1 || ms.currentRow != 2 || ms.elapsed != 0.65 {
+		t.Errorf("setCursor(650) = pat %d row %d at %vs, want pat 1 row 2 at 0.65s",
+			ms.currentPat, ms.currentRow, ms.elapsed)
+	}
+}
+
+func TestWithClicks(t *testing.T) {
+	tr := &track.Track{
+		Tempo:        60,
+		TicksPerBeat: 2,
+		BeatsPerBar:  2,
+		Patterns: map[string]*track.Pattern{
+			"a": {Ticks: 6},
+		},
+		Sequence: []string{"a", "a"},
+	}
+	// 500 samples a tick at 1 kHz: beats every 1000 samples, bars every 2000.
+	samples := make([]float64, 6000)
+	clicked := withClicks(samples, tr, tr.Sequence, 1000)
+
+	if slices.ContainsFunc(samples, func(s float64) bool { return s != 0 }) {
+		t.Error("withClicks changed its input")
+	}
+	// A click starts one sample in (sin 0 is 0) and is over in 30 samples.
+	for _, at := range []int{0, 1000, 2000, 3000, 4000, 5000} {
+		if clicked[at+1] == 0 {
+			t.Errorf("no click at sample %d", at)
+		}
+		if clicked[at+100] != 0 {
+			t.Errorf("click at sample %d still sounding 100 samples later", at)
+		}
+	}
+	if clicked[500+1] != 0 {
+		t.Error("click between beats")
+	}
+	// Bars (0, 2000, then 3000 where the second pattern starts) click
+	// higher than plain beats.
+	crossings := func(from int) int {
+		n := 0
+		for i := from + 1; i < from+30; i++ {
+			if (clicked[i] > 0) != (clicked[i-1] > 0) {
+				n++
+			}
+		}
+		return n
+	}
+	if crossings(2000) <= crossings(1000) || crossings(3000) <= crossings(4000) {
+		t.Error("bar clicks should be higher pitched than beat clicks")
+	}
+}
+
+func TestPCMBytes(t *testing.T) {
+	pcm := pcmBytes([]float64{0, 2, -1})
+	if len(pcm) != 3*4 {
+		t.Fatalf("got %d bytes, want 12 (3 stereo 16-bit frames)", len(pcm))
+	}
+	// Out-of-range samples are clamped to full scale.
+	if pcm[4] != 0xff || pcm[5] != 0x7f {
+		t.Errorf("clamped sample = %x %x, want ff 7f", pcm[4], pcm[5])
+	}
+}
+
+func TestReadStateFile_MigratesFlatFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "preview.json")
+	os.WriteFile(path, []byte(`{"zoom": 8, "background": 2, "show_grid": true, "last_file": "/p/a.sprite"}`), 0644)
+
+	sf := readStateFile(path, "/p")
+	st := sf.Projects["/p"]
+	if st == nil || st.Zoom != 8 || st.Background != 2 || !st.ShowGrid {
+		t.Fatalf("flat state not migrated into project entry: %+v", st)
+	}
+	if len(st.Recent) != 1 || st.Recent[0] != "/p/a.sprite" {
+		t.Errorf("recent = %v, want the old last_file", st.Recent)
+	}
+
+	// Once written back, the file is per project and other roots start fresh.
+	if err := writeStateFile(path, sf); err != nil {
+		t.Fatal(err)
+	}
+	sf = readStateFile(path, "/q")
+	if sf.Projects["/q"] != nil {
+		t.Error("another project should not inherit the migrated state")
+	}
+	if sf.Projects["/p"] == nil || sf.Projects["/p"].Zoom != 8 {
+		t.Error("migrated project state lost after rewrite")
+	}
+}
+
+func TestStateFile_PerProject(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "preview.json")
+	sf := readStateFile(path, "/small")
+	sf.project("/small").Zoom = 8
+	sf.project("/big").Zoom = 2
+	sf.project("/big").Maps = map[string]mapView{"/big/assets/maps/l1.map": {CamX: 10, CamY: -4, Zoom: 3, Hidden: EntityLayers | 2}}
+	if err := writeStateFile(path, sf); err != nil {
+		t.Fatal(err)
+	}
+
+	sf = readStateFile(path, "/small")
+	if sf.Projects["/small"].Zoom != 8 || sf.Projects["/big"].Zoom != 2 {
+		t.Errorf("zoom per project = %d, %d; want 8, 2", sf.Projects["/small"].Zoom, sf.Projects["/big"].Zoom)
+	}
+	if v := sf.Projects["/big"].Maps["/big/assets/maps/l1.map"]; v.CamX != 10 || v.Zoom != 3 || v.Hidden != EntityLayers|2 {
+		t.Errorf("map view = %+v", v)
+	}
+}
+
+func TestLayerLegend(t *testing.T) {
+	mf := &tilemap.MapFile{Layers: []tilemap.Layer{
+		{Name: "sky", Type: "tile"},
+		{Name: "spawns", Type: "entity"},
+		{Name: "ground", Type: "tile"},
+		{Name: "items", Type: "entity"},
+	}}
+	want := []string{"[x] 1 sky", "[ ] 2 ground", "[x] 0 spawns, items"}
+	if got := layerLegend(mf, tileLayerBit(1)); !slices.Equal(got, want) {
+		t.Errorf("legend = %q, want %q", got, want)
+	}
+	if n := countVisible(mf, tileLayerBit(1)); n != 3 {
+		t.Errorf("visible = %d, want 3", n)
+	}
+
+	// Tab goes from everything to entities alone, each tile layer alone,
+	// and back.
+	for solo, shown := range []int{4, 2, 1, 1, 4} {
+		if n := countVisible(mf, soloMask(solo%4, 2)); n != shown {
+			t.Errorf("solo %d shows %d layers, want %d", solo, n, shown)
+		}
+	}
+	if soloMask(2, 2)&tileLayerBit(0) != 0 || soloMask(3, 2)&tileLayerBit(1) != 0 {
+		t.Error("solo should show its own tile layer")
+	}
+}
+
+func TestAddRecent(t *testing.T) {
+	st := &previewState{}
+	for i := range maxRecentFiles + 2 {
+		st.addRecent(fmt.Sprintf("f%d", i))
+	}
+	st.addRecent("f5")
+	if len(st.Recent) != maxRecentFiles {
+		t.Fatalf("kept %d recent files, want %d", len(st.Recent), maxRecentFiles)
+	}
+	if st.Recent[0] != "f5" || st.Recent[1] != "f11" || slices.Contains(st.Recent[1:], "f5") {
+		t.Errorf("recent = %v, want f5 moved to the front without duplicates", st.Recent)
+	}
+}
+
+func TestNewKeymap(t *testing.T) {
+	if _, err := NewKeymap(nil); err != nil {
+		t.Fatalf("default bindings conflict: %v", err)
+	}
+
+	km, err := NewKeymap(map[string]string{"cycle_background": "F2", "zoom_in": "+, NumpadAdd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := km.keyLabel("cycle_background"); got != "F2" {
+		t.Errorf("cycle_background = %q, want F2", got)
+	}
+	if got := km.keyLabel("zoom_in"); got != "+/NumpadAdd" {
+		t.Errorf("zoom_in = %q, want +/NumpadAdd", got)
+	}
+	if got := km.keyLabel("toggle_grid"); got != "G" {
+		t.Errorf("unset actions keep their defaults, toggle_grid = %q", got)
+	}
+
+	tests := []struct {
+		keys map[string]string
+		want string
+	}{
+		{map[string]string{"go_back": "B"}, `unknown action "go_back"`},
+		{map[string]string{"pause": "Spacebar"}, `unknown key name "Spacebar"`},
+		{map[string]string{"pause": "G"}, "G is bound to both toggle_grid and pause"},
+	}
+	for _, tt := range tests {
+		_, err := NewKeymap(tt.keys)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("NewKeymap(%v) error = %v, want %q", tt.keys, err, tt.want)
+		}
+	}
+
+	// The same key may serve actions that are never active together.
+	if _, err := NewKeymap(map[string]string{"play": "Space"}); err != nil {
+		t.Errorf("pause (sprites) and play (audio) on one key: %v", err)
+	}
+}
+
+func TestHelpLines_PerMode(t *testing.T) {
+	km := DefaultKeymap()
+	has := func(lines []string, help string) bool {
+		for _, l := range lines {
+			if strings.HasSuffix(l, "  "+help) {
+				return true
+			}
+		}
+		return false
+	}
+
+	sprite := km.helpLines(ModeSpritePreview)
+	if !has(sprite, "pause/resume animation") || !has(sprite, "show this help") {
+		t.Errorf("sprite help missing sprite or global actions: %v", sprite)
+	}
+	if has(sprite, "play/stop") || has(sprite, "cycle solo layer") {
+		t.Errorf("sprite help lists actions of other modes: %v", sprite)
+	}
+	if m := km.helpLines(ModeMapPreview); !has(m, "cycle solo layer") || !has(m, "toggle grid") || !slices.Contains(m, "1/2/3/4/5/6/7/8/9  toggle tile layer 1-9") {
+		t.Errorf("map help = %v, want Tab layers, digit toggles and G grid", m)
+	}
+	if m := km.helpLines(ModeMusicPreview); !has(m, "select next bus") {
+		t.Errorf("music help = %v, want bus selection", m)
+	}
+}
+
+func TestMinimapPixels_CapsResolution(t *testing.T) {
+	const n = 1024
+	data := make([][]int, n)
+	for y := range data {
+		data[y] = make([]int, n)
+		for x := range data[y] {
+			data[y][x] = 1
+		}
+	}
+	data[0][0] = 2
+	layers := []tilemap.Layer{
+		{Type: "tile", Data: data},
+		{Type: "entity"},
+	}
+	colors := map[int]color.RGBA{1: {R: 10, A: 255}, 2: {G: 20, A: 255}}
+
+	img, step := minimapPixels(layers, n, n, colors)
+	if w, h := img.Bounds().Dx(), img.Bounds().Dy(); w > minimapMax || h > minimapMax {
+		t.Errorf("minimap is %dx%d, want at most %d", w, h, minimapMax)
+	}
+	if step*img.Bounds().Dx() < n {
+		t.Errorf("step %d doesn't cover %d tiles", step, n)
+	}
+	if got := img.RGBAAt(0, 0); got.G != 20 {
+		t.Errorf("pixel 0,0 = %v, want tile 2's color", got)
+	}
+	if got := img.RGBAAt(1, 1); got.R != 10 {
+		t.Errorf("pixel 1,1 = %v, want tile 1's color", got)
+	}
+
+	// A small map gets one pixel per tile.
+	if _, step := minimapPixels(layers, 40, 30, colors); step != 1 {
+		t.Errorf("40x30 map step = %d, want 1", step)
+	}
+}
+
+func TestParseTileCoord(t *testing.T) {
+	for _, in := range []string{"12,34", "12, 34", " 12 34 "} {
+		x, y, err := parseTileCoord(in)
+		if err != nil || x != 12 || y != 34 {
+			t.Errorf("parseTileCoord(%q) = %d, %d, %v; want 12, 34", in, x, y, err)
+		}
+	}
+	for _, in := range []string{"", "12", "1,2,3", "a,b"} {
+		if _, _, err := parseTileCoord(in); err == nil {
+			t.Errorf("parseTileCoord(%q) should fail", in)
+		}
+	}
+}
+
+func TestNextPreset(t *testing.T) {
+	names := []string{"dusk", "night"}
+	preset := ""
+	var got []string
+	for range 3 {
+		preset = nextPreset(names, preset)
+		got = append(got, preset)
+	}
+	if want := []string{"dusk", "night", ""}; !slices.Equal(got, want) {
+		t.Errorf("presets = %q, want %q", got, want)
+	}
+	if p := nextPreset(nil, ""); p != "" {
+		t.Errorf("no presets: got %q, want none", p)
+	}
+}
+
+// pinDeviceScale fixes the device scale factor for the rest of the test.
+func pinDeviceScale(t *testing.T, s float64) {
+	t.Helper()
+	orig := deviceScale
+	deviceScale = func() float64 { return s }
+	t.Cleanup(func() { deviceScale = orig })
+}
+
+func TestGridLabelX_CentersUnderSprite(t *testing.T) {
+	pinDeviceScale(t, 1)
+	p := &Previewer{winW: 800, winH: 600, sprites: []*RenderedSprite{
+		{Name: "hero", FrameW: 16, FrameH: 16, FrameCount: 4, FPS: 8},
+		{Name: "coin", FrameW: 8, FrameH: 8, FrameCount: 1},
+	}}
+	z, cols, padding, cellW, _, offsetX, _ := p.spriteGridLayout()
+	for i, s := range p.sprites {
+		cx := offsetX + i%cols*cellW + padding
+		spriteW := int(float64(s.FrameW) * z)
+		sx := cx + (cellW-padding*2-spriteW)/2
+
+		label := fmt.Sprintf("%s %dx%d", s.Name, s.FrameW, s.FrameH)
+		if s.FrameCount > 1 {
+			label += fmt.Sprintf(" f:%d/%d @%dfps", s.FrameCount, s.FrameCount, s.FPS)
+		}
+		lx := gridLabelX(cx, cellW, padding, label)
+		lw := textWidth(label)
+		if d := (lx + lw/2) - (sx + spriteW/2); d < -1 || d > 1 {
+			t.Errorf("%s: label center %d, sprite center %d", s.Name, lx+lw/2, sx+spriteW/2)
+		}
+		if lx < cx-padding || lx+lw > cx-padding+cellW {
+			t.Errorf("%s: label [%d, %d] outside cell [%d, %d]", s.Name, lx, lx+lw, cx-padding, cx-padding+cellW)
+		}
+	}
+}
+
+func TestSpriteGridLayout_ExtremeSprites(t *testing.T) {
+	pinDeviceScale(t, 1)
+	// A 200-frame animation, and the same frames pasted side by side into
+	// one 1x200 strip.
+	walk := &RenderedSprite{Name: "walk", FrameW: 32, FrameH: 32, FrameCount: 200, FPS: 12}
+	strip := &RenderedSprite{Name: "walk_strip", FrameW: 32 * 200, FrameH: 32, FrameCount: 1}
+	long := &RenderedSprite{Name: strings.Repeat("very_long_sprite_name_", 10), FrameW: 16, FrameH: 16, FrameCount: 1}
+
+	for _, tc := range []struct {
+		name    string
+		sprites []*RenderedSprite
+	}{
+		{"200 frames", []*RenderedSprite{walk}},
+		{"1x200 strip", []*RenderedSprite{walk, strip}},
+		{"label wider than the window", []*RenderedSprite{long, walk}},
+	} {
+		p := &Previewer{winW: 800, winH: 600, sprites: tc.sprites}
+		z, cols, padding, cellW, _, offsetX, offsetY := p.spriteGridLayout()
+		if z <= 0 || cols < 1 || cellW <= 0 {
+			t.Fatalf("%s: z %v, %d cols, cell width %d", tc.name, z, cols, cellW)
+		}
+		if offsetX < 0 || offsetY < 0 {
+			t.Errorf("%s: offset %d,%d, want the grid on screen", tc.name, offsetX, offsetY)
+		}
+		for _, s := range tc.sprites {
+			if w := int(float64(s.FrameW) * z); s.Name != long.Name && offsetX+padding+w > p.winW {
+				t.Errorf("%s: %s is %dpx wide at zoom %v, past the %dpx window", tc.name, s.Name, w, z, p.winW)
+			}
+		}
+	}
+}
+
+func TestTextMetrics(t *testing.T) {
+	pinDeviceScale(t, 1)
+	// 2.5 rounds up to whole pixels on a standard display.
+	if got, want := textWidth("abc"), 3*glyphAdvance*3; got != want {
+		t.Errorf("textWidth(abc) = %d, want %d", got, want)
+	}
+	if got, want := textWidth("ab\nabcd\n"), textWidth("abcd"); got != want {
+		t.Errorf("multiline width = %d, want widest line %d", got, want)
+	}
+	if textWidth("") != 0 {
+		t.Errorf("empty text has width %d", textWidth(""))
+	}
+
+	// On a 2x display a font pixel is exactly 2.5 logical pixels.
+	pinDeviceScale(t, 2)
+	if got := textScale(); got != 2.5 {
+		t.Errorf("textScale at 2x = %v, want 2.5", got)
+	}
+	if got, want := lineHeight(), int(math.Ceil(lineAdvance*2.5)); got != want {
+		t.Errorf("lineHeight at 2x = %d, want %d", got, want)
+	}
+}
+
+func TestWrapText(t *testing.T) {
+	pinDeviceScale(t, 1)
+	w := 10 * charWidth() // ten characters
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"short", []string{"short"}},
+		{"the quick brown fox", []string{"the quick", "brown fox"}},
+		{"line one\nline two", []string{"line one", "line two"}},
+		{"abcdefghijklmnop", []string{"abcdefghij", "klmnop"}},
+		{"a\n\nb", []string{"a", "", "b"}},
+	}
+	for _, tt := range tests {
+		got := wrapText(tt.in, w)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("wrapText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+		for _, l := range got {
+			if textWidth(l) > w {
+				t.Errorf("wrapText(%q): line %q is wider than %d", tt.in, l, w)
+			}
+		}
+	}
+}
+
+func TestFontAtlasImage(t *testing.T) {
+	for r, rows := range glyphs {
+		if len(rows) > glyphH {
+			t.Errorf("glyph %q has %d rows, max %d", r, len(rows), glyphH)
+		}
+		for _, row := range rows {
+			if len(row) != glyphW {
+				t.Errorf("glyph %q row %q is not %d wide", r, row, glyphW)
+			}
+		}
+	}
+	for r := rune(' '); r <= '~'; r++ {
+		if _, ok := glyphs[r]; !ok {
+			t.Errorf("no glyph for %q", r)
+		}
+	}
+
+	img := fontAtlasImage()
+	lit := func(r rune) int {
+		n := 0
+		b := glyphRect(r)
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				if img.RGBAAt(x, y).A != 0 {
+					n++
+				}
+			}
+		}
+		return n
+	}
+	if lit(' ') != 0 {
+		t.Error("space should be blank")
+	}
+	if lit('A') == 0 || lit('g') == 0 {
+		t.Error("letters should have lit pixels")
+	}
+	if glyphRect('é') != glyphRect(0) || lit('é') == 0 {
+		t.Error("unknown runes should draw the missing glyph")
+	}
+}
@@ -0,0 +1,126 @@
+package preview
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+)
+
+// scopeWindow is the number of samples shown by the oscilloscope and
+// analysed by the spectrum view.
+const scopeWindow = 2048
+
+// spectrumFloorDB is the quietest level drawn by the spectrum view.
+const spectrumFloorDB = -90.0
+
+// waveView selects what the SFX waveform area shows.
+type waveView int
+
+const (
+	viewEnvelope waveView = iota // amplitude envelope of the whole sound
+	viewScope                    // raw samples around the cursor
+	viewSpectrum                 // log-frequency spectrum around the cursor
+)
+
+func (v waveView) next() waveView { return (v + 1) % 3 }
+
+func (v waveView) String() string {
+	switch v {
+	case viewScope:
+		return "Oscilloscope"
+	case viewSpectrum:
+		return "Spectrum"
+	default:
+		return "Waveform"
+	}
+}
+
+// sampleWindow returns n samples starting at start, zero-padded past either
+// end of the buffer.
+func sampleWindow(samples []float64, start, n int) []float64 {
+	w := make([]float64, n)
+	for i := range w {
+		if j := start + i; j >= 0 && j < len(samples) {
+			w[i] = samples[j]
+		}
+	}
+	return w
+}
+
+// spectrum returns the magnitude of each frequency bin, 0 through len/2, of
+// a Hann-windowed block. The block length must be a power of two. Bin i is
+// at i*sampleRate/len Hz. Magnitudes are scaled so a full-scale sine peaks
+// near 1.
+func spectrum(block []float64) []float64 {
+	n := len(block)
+	x := make([]complex128, n)
+	for i, s := range block {
+		hann := 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(n-1))
+		x[i] = complex(s*hann, 0)
+	}
+	fft(x)
+
+	// The Hann window halves the coherent gain; a real sine splits its
+	// energy between the positive and negative bins.
+	mags := make([]float64, n/2+1)
+	for i := range mags {
+		mags[i] = cmplx.Abs(x[i]) * 4 / float64(n)
+	}
+	return mags
+}
+
+// fft is an in-place iterative radix-2 Cooley-Tukey transform.
+func fft(x []complex128) {
+	n := len(x)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				a, b := x[start+k], x[start+k+size/2]*w
+				x[start+k], x[start+k+size/2] = a+b, a-b
+				w *= step
+			}
+		}
+	}
+}
+
+// toDB converts a magnitude to decibels, clamped to the spectrum floor.
+func toDB(mag float64) float64 {
+	if mag <= 0 {
+		return spectrumFloorDB
+	}
+	return math.Max(20*math.Log10(mag), spectrumFloorDB)
+}
+
+// logFreqX maps a frequency onto [0, width) on a log scale from lo to hi.
+func logFreqX(f, lo, hi float64, width int) int {
+	return int(math.Log(f/lo) / math.Log(hi/lo) * float64(width))
+}
+
+// freqDecades returns the powers of ten between lo and hi, inclusive.
+func freqDecades(lo, hi float64) []float64 {
+	var out []float64
+	for f := math.Pow(10, math.Ceil(math.Log10(lo))); f <= hi; f *= 10 {
+		out = append(out, f)
+	}
+	return out
+}
+
+// freqLabel formats a frequency axis label: "100", "1k", "10k".
+func freqLabel(f float64) string {
+	if f >= 1000 {
+		return fmt.Sprintf("%gk", f/1000)
+	}
+	return fmt.Sprintf("%g", f)
+}
@@ -2,6 +2,7 @@ package preview
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"fmt"
 	"image/color"
@@ -23,30 +24,144 @@ type SFXPreviewState struct {
 	audioCtx   *audio.Context
 	player     *audio.Player
 	audioErr   string // non-empty if audio init failed
+	startAt    int    // first sample of the current player's buffer
+
+	// Analysis views. cursor is the sample the oscilloscope and spectrum
+	// windows are centered on; it follows the mouse over the waveform.
+	view     waveView
+	cursor   int
+	hoverCol int // waveform column under the mouse, or -1
+	spec     []float64
+	specAt   int
 }
 
 func (p *Previewer) initSFXState(s *sfx.SFX, sampleRate int) {
-	samples, _ := s.Render(sampleRate)
+	p.sfxState, _ = newSFXState(context.Background(), s, sampleRate)
+}
+
+// newSFXState renders s for preview. It fails only if ctx is canceled.
+func newSFXState(ctx context.Context, s *sfx.SFX, sampleRate int) (*SFXPreviewState, error) {
+	samples, _, err := s.Render(ctx, sampleRate)
+	if err != nil {
+		return nil, err
+	}
 
 	// Downsample for display.
 	displayWidth := 700
 	waveform := downsampleWaveform(samples, displayWidth)
 
-	p.sfxState = &SFXPreviewState{
+	return &SFXPreviewState{
 		sfxDef:     s,
 		waveform:   waveform,
 		samples:    samples,
 		sampleRate: sampleRate,
+		hoverCol:   -1,
+		specAt:     -1,
+	}, nil
+}
+
+// swapSFXState replaces the current SFX state after a reload. The old
+// player is stopped and discarded; the audio context is carried over since
+// ebiten allows only one per process.
+func (p *Previewer) swapSFXState(next *SFXPreviewState) {
+	wasPlaying := false
+	if old := p.sfxState; old != nil {
+		wasPlaying = old.stop()
+		next.audioCtx = old.audioCtx
+		next.audioErr = old.audioErr
+		next.view = old.view
+		next.cursor = min(old.cursor, max(len(next.samples)-1, 0))
+	}
+	p.sfxState = next
+	if wasPlaying && p.restartOnReload {
+		next.play()
 	}
 }
 
+// stop halts and releases the current player, reporting whether it was playing.
+func (ss *SFXPreviewState) stop() bool {
+	if ss.player == nil {
+		return false
+	}
+	playing := ss.player.IsPlaying()
+	ss.player.Pause()
+	_ = ss.player.Close()
+	ss.player = nil
+	return playing
+}
+
 func (p *Previewer) updateSFX() {
 	if p.sfxState == nil {
 		return
 	}
-	if inpututil.IsKeyJustPressed(ebiten.KeyEnter) {
-		p.sfxState.play()
+	ss := p.sfxState
+	if p.keys.justPressed("play") {
+		ss.play()
+	}
+	if p.keys.justPressed("cycle_view") {
+		ss.view = ss.view.next()
+	}
+
+	// Hovering the envelope view moves the analysis cursor, and a click
+	// there plays from that point. Otherwise the cursor follows playback.
+	ss.hoverCol = -1
+	if ss.view == viewEnvelope {
+		mx, my := ebiten.CursorPosition()
+		x0, top, w, bottom := p.sfxWaveRect()
+		if col := mx - x0; col >= 0 && col < min(w, len(ss.waveform)) && my >= top && my < bottom {
+			ss.hoverCol = col
+			ss.cursor = ss.columnSample(col)
+			if !ss.isPlaying() && inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+				ss.playFrom(ss.cursor)
+			}
+		}
+	}
+	if pos, ok := ss.playhead(); ok && ss.hoverCol < 0 {
+		ss.cursor = pos
+	}
+}
+
+func (ss *SFXPreviewState) isPlaying() bool {
+	return ss.player != nil && ss.player.IsPlaying()
+}
+
+// playhead returns the sample being played, read from the player's clock.
+func (ss *SFXPreviewState) playhead() (int, bool) {
+	if !ss.isPlaying() {
+		return 0, false
+	}
+	return playerSample(ss.player, ss.startAt, ss.sampleRate), true
+}
+
+// playerSample converts a player's position to a sample index in the full
+// buffer, given the sample its own buffer starts at.
+func playerSample(p *audio.Player, startAt, sampleRate int) int {
+	return startAt + int(p.Position().Seconds()*float64(sampleRate))
+}
+
+// sfxWaveRect returns the left edge, top, width and bottom of the waveform
+// area.
+func (p *Previewer) sfxWaveRect() (x0, top, w, bottom int) {
+	x0 = 50
+	return x0, lineHeight() + 10, p.winW - x0 - 20, int(float64(p.winH) * 0.6)
+}
+
+// columnSample returns the first sample drawn in a waveform column.
+func (ss *SFXPreviewState) columnSample(col int) int {
+	if len(ss.waveform) == 0 {
+		return 0
 	}
+	return col * len(ss.samples) / len(ss.waveform)
+}
+
+// spectrumAtCursor returns the spectrum of the window centered on the
+// cursor, recomputing it only when the cursor has moved.
+func (ss *SFXPreviewState) spectrumAtCursor() []float64 {
+	if ss.spec == nil || ss.specAt != ss.cursor {
+		ss.spec = spectrum(sampleWindow(ss.samples, ss.cursor-scopeWindow/2, scopeWindow))
+		ss.specAt = ss.cursor
+	}
+	return ss.spec
 }
 
 func (ss *SFXPreviewState) ensureAudio() {
@@ -62,14 +177,35 @@ func (ss *SFXPreviewState) ensureAudio() {
 }
 
 func (ss *SFXPreviewState) play() {
+	ss.playFrom(0)
+}
+
+// playFrom plays the sound starting at the given sample, using a player
+// over the rest of the buffer.
+func (ss *SFXPreviewState) playFrom(sample int) {
 	ss.ensureAudio()
 	if ss.audioErr != "" || ss.audioCtx == nil {
 		return
 	}
+	ss.stop()
+	sample = max(0, min(sample, len(ss.samples)))
 
-	// Convert float64 samples to 16-bit stereo PCM.
+	defer func() {
+		if r := recover(); r != nil {
+			ss.audioErr = fmt.Sprintf("%v", r)
+		}
+	}()
+	player := ss.audioCtx.NewPlayerFromBytes(pcmBytes(ss.samples[sample:]))
+	player.Play()
+	ss.player = player // prevent GC
+	ss.startAt = sample
+}
+
+// pcmBytes converts float64 samples to clamped 16-bit little-endian stereo
+// PCM, the format ebiten audio players expect.
+func pcmBytes(samples []float64) []byte {
 	buf := &bytes.Buffer{}
-	for _, s := range ss.samples {
+	for _, s := range samples {
 		// Clamp.
 		if s > 1.0 {
 			s = 1.0
@@ -80,15 +216,7 @@ func (ss *SFXPreviewState) play() {
 		binary.Write(buf, binary.LittleEndian, v) // left
 		binary.Write(buf, binary.LittleEndian, v) // right
 	}
-
-	defer func() {
-		if r := recover(); r != nil {
-			ss.audioErr = fmt.Sprintf("%v", r)
-		}
-	}()
-	player := ss.audioCtx.NewPlayerFromBytes(buf.Bytes())
-	player.Play()
-	ss.player = player // prevent GC
+	return buf.Bytes()
 }
 
 func downsampleWaveform(samples []float64, width int) []float64 {
@@ -126,36 +254,64 @@ func (p *Previewer) drawSFX(screen *ebiten.Image) {
 		return
 	}
 
-	lineH := scaledCharH()
+	lineH := lineHeight()
 
 	// Waveform area: top 60%.
-	topMargin := lineH + 10
-	waveH := int(float64(p.winH) * 0.6)
+	offsetX, topMargin, drawWidth, waveH := p.sfxWaveRect()
 	midY := topMargin + (waveH-topMargin)/2
-	offsetX := 50
 
-	// Draw zero line.
-	for x := offsetX; x < p.winW-20; x++ {
-		screen.Set(x, midY, color.RGBA{R: 0x40, G: 0x40, B: 0x40, A: 0xff})
-	}
+	switch ss.view {
+	case viewScope:
+		p.drawScope(screen, ss, offsetX, topMargin, drawWidth, waveH)
+	case viewSpectrum:
+		p.drawSpectrum(screen, ss, offsetX, topMargin, drawWidth, waveH)
+	default:
+		// Draw zero line.
+		for x := offsetX; x < p.winW-20; x++ {
+			screen.Set(x, midY, color.RGBA{R: 0x40, G: 0x40, B: 0x40, A: 0xff})
+		}
+
+		// Draw waveform.
+		waveColor := color.RGBA{R: 0x00, G: 0xcc, B: 0xcc, A: 0xff}
+		for i, v := range ss.waveform {
+			if i >= drawWidth {
+				break
+			}
+			x := offsetX + i
+			h := int(v * float64(midY-10))
+			if h > 0 {
+				for dy := 0; dy < h; dy++ {
+					screen.Set(x, midY-dy, waveColor)
+				}
+			} else {
+				for dy := 0; dy > h; dy-- {
+					screen.Set(x, midY-dy, waveColor)
+				}
+			}
+		}
 
-	// Draw waveform.
-	waveColor := color.RGBA{R: 0x00, G: 0xcc, B: 0xcc, A: 0xff}
-	drawWidth := p.winW - offsetX - 20
-	for i, v := range ss.waveform {
-		if i >= drawWidth {
-			break
+		// Playhead.
+		if pos, ok := ss.playhead(); ok && len(ss.samples) > 0 {
+			col := pos * len(ss.waveform) / len(ss.samples)
+			if col >= 0 && col < min(drawWidth, len(ss.waveform)) {
+				for y := topMargin; y < waveH; y++ {
+					screen.Set(offsetX+col, y, color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff})
+				}
+			}
 		}
-		x := offsetX + i
-		h := int(v * float64(midY-10))
-		if h > 0 {
-			for dy := 0; dy < h; dy++ {
-				screen.Set(x, midY-dy, waveColor)
+
+		// Hover readout.
+		if ss.hoverCol >= 0 {
+			for y := topMargin; y < waveH; y++ {
+				screen.Set(offsetX+ss.hoverCol, y, color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0x80})
 			}
-		} else {
-			for dy := 0; dy > h; dy-- {
-				screen.Set(x, midY-dy, waveColor)
+			t := float64(ss.columnSample(ss.hoverCol)) / float64(ss.sampleRate)
+			readout := fmt.Sprintf("%.3fs  amp %.2f", t, math.Abs(ss.waveform[ss.hoverCol]))
+			x := offsetX + ss.hoverCol + 6
+			if x+textWidth(readout) > p.winW {
+				x = offsetX + ss.hoverCol - 6 - textWidth(readout)
 			}
+			drawText(screen, readout, x, topMargin)
 		}
 	}
 
@@ -199,40 +355,102 @@ func (p *Previewer) drawSFX(screen *ebiten.Image) {
 	}
 
 	// Info.
-	info := fmt.Sprintf("SFX  dur:%.2fs  voices:%d  rate:%dHz",
-		ss.sfxDef.Duration, len(ss.sfxDef.Voices), ss.sampleRate)
+	info := fmt.Sprintf("SFX  dur:%.2fs  voices:%d  rate:%dHz  view:%s",
+		ss.sfxDef.Duration, len(ss.sfxDef.Voices), ss.sampleRate, ss.view)
 	drawText(screen, info, 10, 10)
 	statusY := p.winH - lineH - 6
 	if ss.audioErr != "" {
-		drawText(screen, "No audio device available", 10, statusY)
+		drawText(screen, "No audio device available  "+p.keys.keyLabel("cycle_view")+": cycle view", 10, statusY)
 	} else {
-		drawText(screen, "Press Enter to play", 10, statusY)
+		drawText(screen, "Press "+p.keys.keyLabel("play")+" to play, or click the waveform  "+p.keys.keyLabel("cycle_view")+": cycle view", 10, statusY)
 	}
 }
 
-// adsrLevel computes ADSR amplitude at time t.
-func adsrLevel(env sfx.EnvelopeDef, duration, t float64) float64 {
-	a, d, s, r := env.Attack, env.Decay, env.Sustain, env.Release
-	noteOff := duration - r
+// drawScope draws the samples of the window around the cursor as a trace.
+func (p *Previewer) drawScope(screen *ebiten.Image, ss *SFXPreviewState, x0, top, w, bottom int) {
+	midY := top + (bottom-top)/2
+	halfH := float64(bottom-top)/2 - 10
+	for x := x0; x < x0+w; x++ {
+		screen.Set(x, midY, color.RGBA{R: 0x40, G: 0x40, B: 0x40, A: 0xff})
+	}
 
-	if t < a {
-		if a == 0 {
-			return 1.0
+	block := sampleWindow(ss.samples, ss.cursor-scopeWindow/2, scopeWindow)
+	traceColor := color.RGBA{R: 0x00, G: 0xff, B: 0x66, A: 0xff}
+	prevY := midY
+	for x := 0; x < w; x++ {
+		v := math.Max(-1, math.Min(1, block[x*len(block)/w]))
+		y := midY - int(v*halfH)
+		if x == 0 {
+			prevY = y
+		}
+		// Connect to the previous column so steep edges stay visible.
+		lo, hi := min(prevY, y), max(prevY, y)
+		for yy := lo; yy <= hi; yy++ {
+			screen.Set(x0+x, yy, traceColor)
 		}
-		return t / a
+		prevY = y
 	}
-	if t < a+d {
-		return 1.0 - (1.0-s)*((t-a)/d)
+
+	t := float64(ss.cursor) / float64(ss.sampleRate)
+	drawText(screen, fmt.Sprintf("%d samples at %.3fs", scopeWindow, t), x0, top)
+}
+
+// drawSpectrum draws the log-frequency magnitude spectrum of the window
+// around the cursor, from 20 Hz to Nyquist, with a label at each decade.
+func (p *Previewer) drawSpectrum(screen *ebiten.Image, ss *SFXPreviewState, x0, top, w, bottom int) {
+	lineH := lineHeight()
+	axisY := bottom - lineH - 4
+	plotH := axisY - top - lineH - 4
+	lo, hi := 20.0, float64(ss.sampleRate)/2
+	binHz := float64(ss.sampleRate) / scopeWindow
+
+	// Loudest bin per column.
+	levels := make([]float64, w)
+	for i := range levels {
+		levels[i] = spectrumFloorDB
 	}
-	if t < noteOff {
-		return s
+	for bin, mag := range ss.spectrumAtCursor() {
+		f := float64(bin) * binHz
+		if f < lo {
+			continue
+		}
+		x := logFreqX(f, lo, hi, w)
+		if x >= 0 && x < w {
+			levels[x] = math.Max(levels[x], toDB(mag))
+		}
 	}
-	if r == 0 {
-		return 0
+
+	barColor := color.RGBA{R: 0xff, G: 0x99, B: 0x00, A: 0xff}
+	for x, db := range levels {
+		h := int((db - spectrumFloorDB) / -spectrumFloorDB * float64(plotH))
+		for dy := 0; dy < h; dy++ {
+			screen.Set(x0+x, axisY-dy, barColor)
+		}
 	}
-	releaseT := (t - noteOff) / r
-	if releaseT > 1 {
-		return 0
+
+	// Axis with decade ticks.
+	axisColor := color.RGBA{R: 0x60, G: 0x60, B: 0x60, A: 0xff}
+	for x := x0; x < x0+w; x++ {
+		screen.Set(x, axisY, axisColor)
+	}
+	for _, f := range freqDecades(lo, hi) {
+		x := x0 + logFreqX(f, lo, hi, w)
+		for y := axisY - plotH; y <= axisY; y++ {
+			screen.Set(x, y, axisColor)
+		}
+		drawText(screen, freqLabel(f), x+2, axisY+2)
+	}
+
+	t := float64(ss.cursor) / float64(ss.sampleRate)
+	drawText(screen, fmt.Sprintf("%d-sample Hann window at %.3fs, %.0f dB floor", scopeWindow, t, spectrumFloorDB), x0, top)
+}
+
+// adsrLevel computes ADSR amplitude at time t, holding the note until the
+// release has to start to end with the sound, as rendering does.
+func adsrLevel(env sfx.EnvelopeDef, duration, t float64) float64 {
+	noteOn := duration
+	if env.Release > 0 && env.Release < duration {
+		noteOn = duration - env.Release
 	}
-	return s * (1 - releaseT)
+	return env.ADSR().Level(t, noteOn)
 }
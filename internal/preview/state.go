@@ -0,0 +1,176 @@
+package preview
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// State persistence. The state file holds one entry per project, keyed by
+// the absolute project root, so view settings from one project don't leak
+// into another.
+
+// maxRecentFiles is how many recently previewed files are kept per project.
+const maxRecentFiles = 10
+
+// previewState is the persisted state of one project.
+type previewState struct {
+	Zoom       int                `json:"zoom"`
+	Background int                `json:"background"`
+	ShowGrid   bool               `json:"show_grid"`
+	LastFile   string             `json:"last_file"`
+	Recent     []string           `json:"recent,omitempty"` // most recent first
+	Maps       map[string]mapView `json:"maps,omitempty"`   // keyed by absolute map path
+}
+
+// mapView is the last camera position, zoom and hidden layers of a map
+// preview.
+type mapView struct {
+	CamX   float64   `json:"cam_x"`
+	CamY   float64   `json:"cam_y"`
+	Zoom   float64   `json:"zoom"`
+	Hidden LayerMask `json:"hidden_layers,omitempty"`
+}
+
+// stateFile is the on-disk layout of preview.json.
+type stateFile struct {
+	Projects map[string]*previewState `json:"projects"`
+}
+
+func stateFilePath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "runefact", "preview.json")
+}
+
+// readStateFile loads the state file. A missing or unreadable file gives an
+// empty state. A file in the old flat format, from before state was kept
+// per project, is migrated into the entry for root.
+func readStateFile(path, root string) *stateFile {
+	sf := &stateFile{Projects: map[string]*previewState{}}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return sf
+	}
+	var raw struct {
+		Projects map[string]*previewState `json:"projects"`
+		previewState
+	}
+	if json.Unmarshal(data, &raw) != nil {
+		return sf
+	}
+	if raw.Projects != nil {
+		sf.Projects = raw.Projects
+		return sf
+	}
+	legacy := raw.previewState
+	if legacy.LastFile != "" {
+		legacy.Recent = []string{legacy.LastFile}
+	}
+	sf.Projects[root] = &legacy
+	return sf
+}
+
+func writeStateFile(path string, sf *stateFile) error {
+	data, err := json.MarshalIndent(sf, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// project returns the state for root, creating it if needed.
+func (sf *stateFile) project(root string) *previewState {
+	st := sf.Projects[root]
+	if st == nil {
+		st = &previewState{}
+		sf.Projects[root] = st
+	}
+	return st
+}
+
+// addRecent moves file to the front of the recent list.
+func (st *previewState) addRecent(file string) {
+	st.Recent = slices.DeleteFunc(st.Recent, func(f string) bool { return f == file })
+	st.Recent = slices.Insert(st.Recent, 0, file)
+	if len(st.Recent) > maxRecentFiles {
+		st.Recent = st.Recent[:maxRecentFiles]
+	}
+}
+
+// projectRoot returns the absolute project root, the parent of the assets
+// directory.
+func (p *Previewer) projectRoot() string {
+	return absPath(filepath.Dir(p.assetsDir))
+}
+
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// loadState returns the persisted state of this previewer's project.
+func (p *Previewer) loadState() previewState {
+	root := p.projectRoot()
+	if st := readStateFile(stateFilePath(), root).Projects[root]; st != nil {
+		return *st
+	}
+	return previewState{}
+}
+
+// applyState restores the view settings of an earlier session. A zoom of
+// zero means none was saved, so the configured one stays; any other zoom
+// is clamped, since the file may have been edited by hand.
+func (p *Previewer) applyState(st previewState) {
+	if st.Zoom > 0 {
+		p.zoom = clampZoom(st.Zoom)
+	}
+	p.background = BackgroundType(st.Background)
+	p.showGrid = st.ShowGrid
+}
+
+// applyMapView restores the saved camera and hidden layers of the
+// previewed map, if any.
+func (p *Previewer) applyMapView(st previewState) {
+	v, ok := st.Maps[absPath(p.filePath)]
+	if !ok || p.mapState == nil {
+		return
+	}
+	p.mapState.hidden = v.Hidden
+	if v.Zoom > 0 {
+		p.mapState.camX, p.mapState.camY, p.mapState.mapZoom = v.CamX, v.CamY, v.Zoom
+	}
+}
+
+// saveState records this session in the project's entry. The file is read
+// again first so that other projects' entries, possibly saved by another
+// previewer since this one started, are kept.
+func (p *Previewer) saveState() {
+	path := stateFilePath()
+	if path == "" {
+		return
+	}
+	root := p.projectRoot()
+	sf := readStateFile(path, root)
+	st := sf.project(root)
+	st.Zoom = p.zoom
+	st.Background = int(p.background)
+	st.ShowGrid = p.showGrid
+	st.LastFile = p.filePath
+	st.addRecent(absPath(p.filePath))
+	if ms := p.mapState; ms != nil {
+		if st.Maps == nil {
+			st.Maps = map[string]mapView{}
+		}
+		st.Maps[absPath(p.filePath)] = mapView{CamX: ms.camX, CamY: ms.camY, Zoom: ms.mapZoom, Hidden: ms.hidden}
+	}
+	_ = writeStateFile(path, sf)
+}
@@ -1,67 +1,140 @@
 package preview
 
 import (
-	"image"
+	"image/color"
+	"math"
 	"strings"
 
 	"github.com/hajimehoshi/ebiten/v2"
-	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
 )
 
-const (
-	// debugCharW and debugCharH are the dimensions of ebitenutil.DebugPrint's font.
-	debugCharW = 6
-	debugCharH = 16
-	// textScale is the factor to enlarge the debug font by.
-	textScale = 2.5
+// textPixels is the size, in logical pixels, the preview aims to draw one
+// font pixel at. The actual size is rounded so each font pixel covers a
+// whole number of device pixels; see textScale.
+const textPixels = 2.5
+
+// fontAtlas holds the glyphs of fontAtlasImage once uploaded; glyphImages
+// caches the sub-image of each rune drawn so far.
+var (
+	fontAtlas   *ebiten.Image
+	glyphImages = map[rune]*ebiten.Image{}
 )
 
-// textBuf is a reusable offscreen buffer for scaled text rendering.
-var textBuf *ebiten.Image
+// deviceScale returns the monitor's device scale factor, or 1 when it is
+// unknown. It is a variable so tests can pin it.
+var deviceScale = func() float64 {
+	m := ebiten.Monitor()
+	if m == nil {
+		return 1
+	}
+	if s := m.DeviceScaleFactor(); s > 0 {
+		return s
+	}
+	return 1
+}
+
+// textScale returns the logical size of one font pixel: textPixels rounded
+// to a whole number of device pixels, so glyphs stay crisp on any display.
+func textScale() float64 {
+	dsf := deviceScale()
+	return max(1, math.Round(textPixels*dsf)) / dsf
+}
 
-func ensureTextBuf(w, h int) {
-	if textBuf == nil || textBuf.Bounds().Dx() < w || textBuf.Bounds().Dy() < h {
-		newW := max(w, 1024)
-		newH := max(h, debugCharH+4)
-		textBuf = ebiten.NewImage(newW, newH)
+func glyphImage(r rune) *ebiten.Image {
+	if fontAtlas == nil {
+		fontAtlas = ebiten.NewImageFromImage(fontAtlasImage())
 	}
+	if img, ok := glyphImages[r]; ok {
+		return img
+	}
+	img := fontAtlas.SubImage(glyphRect(r)).(*ebiten.Image)
+	glyphImages[r] = img
+	return img
 }
 
-// drawText renders text at (x, y) scaled up for readability.
+// drawText renders text with its top-left corner at (x, y), one line per
+// "\n", with a soft shadow so it reads over sprites and tiles.
 func drawText(screen *ebiten.Image, str string, x, y int) {
 	if str == "" {
 		return
 	}
+	s := textScale()
+	dsf := deviceScale()
+	// snap rounds a logical position to the nearest device pixel.
+	snap := func(v float64) float64 { return math.Round(v*dsf) / dsf }
+
+	for i, line := range strings.Split(str, "\n") {
+		ly := snap(float64(y) + float64(i*lineAdvance)*s)
+		for j, r := range []rune(line) {
+			if r == ' ' {
+				continue
+			}
+			gx := snap(float64(x) + float64(j*glyphAdvance)*s)
+			g := glyphImage(r)
 
-	// Handle multiline.
-	lines := strings.Split(str, "\n")
-	maxLen := 0
-	for _, l := range lines {
-		if len(l) > maxLen {
-			maxLen = len(l)
+			op := &ebiten.DrawImageOptions{}
+			op.GeoM.Scale(s, s)
+			op.GeoM.Translate(gx+s, ly+s)
+			op.ColorScale.ScaleWithColor(color.RGBA{A: 0x80})
+			screen.DrawImage(g, op)
+
+			op = &ebiten.DrawImageOptions{}
+			op.GeoM.Scale(s, s)
+			op.GeoM.Translate(gx, ly)
+			screen.DrawImage(g, op)
 		}
 	}
+}
 
-	w := maxLen*debugCharW + 2
-	h := len(lines)*debugCharH + 2
-	ensureTextBuf(w, h)
-	textBuf.Clear()
-
-	ebitenutil.DebugPrintAt(textBuf, str, 0, 0)
+// textWidth returns the width drawText takes for str: that of its longest
+// line.
+func textWidth(str string) int {
+	n := 0
+	for _, line := range strings.Split(str, "\n") {
+		n = max(n, len([]rune(line)))
+	}
+	return int(math.Ceil(float64(n*glyphAdvance) * textScale()))
+}
 
-	op := &ebiten.DrawImageOptions{}
-	op.GeoM.Scale(textScale, textScale)
-	op.GeoM.Translate(float64(x), float64(y))
-	op.Filter = ebiten.FilterNearest
-	screen.DrawImage(textBuf.SubImage(image.Rect(0, 0, w, h)).(*ebiten.Image), op)
+// charWidth returns the advance of one character, for laying text out in
+// columns.
+func charWidth() int {
+	return int(math.Ceil(float64(glyphAdvance) * textScale()))
 }
 
-// scaledCharW returns the width of a single character at the text scale.
-func scaledCharW() int {
-	return int(float64(debugCharW) * textScale)
+// lineHeight returns the distance between two lines of text.
+func lineHeight() int {
+	return int(math.Ceil(float64(lineAdvance) * textScale()))
 }
 
-// scaledCharH returns the height of a single text line at the text scale.
-func scaledCharH() int {
-	return int(float64(debugCharH) * textScale)
+// wrapText breaks str into lines no wider than maxW: at each "\n", then
+// between words, and inside words too long for a line of their own.
+func wrapText(str string, maxW int) []string {
+	perLine := max(1, int(float64(maxW)/(float64(glyphAdvance)*textScale())))
+	var lines []string
+	for _, para := range strings.Split(str, "\n") {
+		line := ""
+		for _, word := range strings.Fields(para) {
+			for len([]rune(word)) > perLine {
+				if line != "" {
+					lines = append(lines, line)
+					line = ""
+				}
+				rs := []rune(word)
+				lines = append(lines, string(rs[:perLine]))
+				word = string(rs[perLine:])
+			}
+			switch {
+			case line == "":
+				line = word
+			case len([]rune(line))+1+len([]rune(word)) <= perLine:
+				line += " " + word
+			default:
+				lines = append(lines, line)
+				line = word
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
 }
@@ -0,0 +1,199 @@
+package scaffold
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/vgalaktionov/runefact/internal/instrument"
+	"github.com/vgalaktionov/runefact/internal/migrate"
+)
+
+// AssetKind is where new assets of one type live under assets/.
+type AssetKind struct {
+	Dir string
+	Ext string
+}
+
+// AssetKinds maps the asset types runefact new and the runefact_new_asset
+// MCP tool create to their directory and extension.
+var AssetKinds = map[string]AssetKind{
+	"palette":    {"palettes", ".palette"},
+	"sprite":     {"sprites", ".sprite"},
+	"map":        {"maps", ".map"},
+	"instrument": {"instruments", ".inst"},
+	"sfx":        {"sfx", ".sfx"},
+	"track":      {"tracks", ".track"},
+}
+
+// AssetTypes lists the keys of AssetKinds in the order help shows them.
+var AssetTypes = []string{"palette", "sprite", "map", "instrument", "sfx", "track"}
+
+var assetNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// AssetParams holds the template parameters. Each applies to some types
+// only and is ignored by the others.
+type AssetParams struct {
+	Grid       int     // sprite size and map tile size in pixels
+	Palette    string  // the palette a sprite uses
+	Channels   int     // track channels
+	Duration   float64 // sfx length in seconds
+	Instrument string  // the instrument every track channel plays
+}
+
+// CheckAsset reports whether name, without its extension, and p can go
+// into a template. Both end up in TOML strings and file names, so names
+// are kept to letters, digits, '_' and '-'.
+func CheckAsset(name string, p AssetParams) error {
+	if !assetNameRe.MatchString(name) {
+		return fmt.Errorf("invalid name %q: use letters, digits, '_' and '-'", name)
+	}
+	if !assetNameRe.MatchString(p.Palette) {
+		return fmt.Errorf("invalid palette %q: use letters, digits, '_' and '-'", p.Palette)
+	}
+	if p.Grid < 1 || p.Grid > 256 {
+		return fmt.Errorf("grid must be 1-256, got %d", p.Grid)
+	}
+	if p.Channels < 1 || p.Channels > 16 {
+		return fmt.Errorf("channels must be 1-16, got %d", p.Channels)
+	}
+	if p.Duration <= 0 || p.Duration > 30 {
+		return fmt.Errorf("duration must be in (0, 30] seconds, got %g", p.Duration)
+	}
+	return nil
+}
+
+// WriteAsset writes content to path, creating its directory. It refuses
+// to overwrite: an existing file is an error matching os.ErrExist. A file
+// that fails halfway is removed, so a retry isn't refused as an overwrite.
+func WriteAsset(path, content string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	_, werr := f.WriteString(content)
+	if cerr := f.Close(); werr == nil {
+		werr = cerr
+	}
+	if werr != nil {
+		os.Remove(path)
+		return werr
+	}
+	return nil
+}
+
+// FirstInstrument returns the name of an instrument in instDir that
+// loads, for track templates to play, or "lead" if there is none.
+func FirstInstrument(instDir string) string {
+	entries, err := os.ReadDir(instDir)
+	if err != nil {
+		return "lead"
+	}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".inst") {
+			continue
+		}
+		if inst, err := instrument.LoadInstrument(filepath.Join(instDir, e.Name())); err == nil {
+			return inst.Name
+		}
+	}
+	return "lead"
+}
+
+// Asset returns a minimal valid source file for the asset type.
+func Asset(typ, name string, p AssetParams) string {
+	switch typ {
+	case "palette":
+		return fmt.Sprintf(`name = %q
+
+[colors]
+_ = "transparent"
+k = "#000000"
+w = "#ffffff"
+`, name)
+
+	case "sprite":
+		row := strings.Repeat("_", p.Grid)
+		rows := strings.Repeat(row+"\n", p.Grid)
+		return fmt.Sprintf(`palette = %q
+grid = %d
+
+[sprite.%s]
+pixels = """
+%s"""
+`, p.Palette, p.Grid, name, rows)
+
+	case "map":
+		rows := strings.Repeat(strings.Repeat("_", 16)+"\n", 10)
+		return fmt.Sprintf(`format_version = %d
+tile_size = %d
+
+[tileset]
+_ = ""
+
+[layer.main]
+pixels = """
+%s"""
+`, migrate.Current(".map"), p.Grid, rows)
+
+	case "instrument":
+		return fmt.Sprintf(`name = %q
+
+[oscillator]
+waveform = "square"
+duty_cycle = 0.5
+
+[envelope]
+attack = 0.01
+decay = 0.1
+sustain = 0.6
+release = 0.2
+`, name)
+
+	case "sfx":
+		return fmt.Sprintf(`duration = %g
+volume = 0.7
+
+[[voice]]
+waveform = "square"
+duty_cycle = 0.5
+
+[voice.envelope]
+attack = 0.0
+decay = 0.05
+sustain = 0.5
+release = 0.1
+
+[voice.pitch]
+start = 440
+end = 440
+`, p.Duration)
+
+	case "track":
+		var b strings.Builder
+		fmt.Fprintf(&b, "format_version = %d\n", migrate.Current(".track"))
+		b.WriteString("tempo = 120\nticks_per_beat = 4\nloop = true\nloop_start = 0\n")
+		names := make([]string, p.Channels)
+		for i := range names {
+			names[i] = fmt.Sprintf("ch%d", i+1)
+			fmt.Fprintf(&b, "\n[[channel]]\nname = %q\ninstrument = %q\nvolume = 0.7\n", names[i], p.Instrument)
+		}
+		silent := make([]string, p.Channels)
+		for i := range silent {
+			silent[i] = "..."
+		}
+		b.WriteString("\n[pattern.main]\nticks = 4\ndata = \"\"\"\n")
+		b.WriteString(strings.Join(names, " | ") + "\n")
+		for range 4 {
+			b.WriteString(strings.Join(silent, " | ") + "\n")
+		}
+		b.WriteString("\"\"\"\n\n[song]\nsequence = [\"main\"]\n")
+		return b.String()
+	}
+	return ""
+}
@@ -0,0 +1,112 @@
+// Package scaffold holds the project templates runefact init writes out.
+// Each template is a directory under templates/ with a runefact.toml and
+// the asset files a new project starts with. The files are embedded as
+// they are, so tests can build them like any other project.
+//
+// It also writes the single-asset templates of runefact new and the
+// runefact_new_asset MCP tool.
+package scaffold
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+//go:embed templates
+var templates embed.FS
+
+// Template describes a project template.
+type Template struct {
+	Name        string
+	Description string
+}
+
+// Default is the template init uses when none is given.
+const Default = "platformer"
+
+// Templates lists the available templates in the order help shows them.
+var Templates = []Template{
+	{"platformer", "the Rune Knight side-scroller: player and tile sprites, a level, instruments, sfx and a song"},
+	{"minimal", "one palette, an 8x8 sprite and a sound effect to build on"},
+	{"topdown", "an RPG-style overworld: terrain tiles, a walking hero, a 32x20 map and village music"},
+	{"none", "directories and runefact.toml only"},
+}
+
+// Dirs are the asset directories every project gets, whatever the
+// template.
+var Dirs = []string{
+	"assets/palettes",
+	"assets/sprites",
+	"assets/maps",
+	"assets/instruments",
+	"assets/sfx",
+	"assets/tracks",
+}
+
+// File is a file of a project, with a slash-separated path relative to
+// the project root.
+type File struct {
+	Path    string
+	Content string
+}
+
+// Names returns the template names, for help and error messages.
+func Names() []string {
+	names := make([]string, len(Templates))
+	for i, t := range Templates {
+		names[i] = t.Name
+	}
+	return names
+}
+
+// Files returns the files of the named template for a project called
+// name. runefact.toml comes first, filled in with the name, then the
+// assets in the order of Dirs.
+func Files(tmpl, name string) ([]File, error) {
+	if !slices.Contains(Names(), tmpl) {
+		return nil, fmt.Errorf("unknown template %q (available: %s)", tmpl, strings.Join(Names(), ", "))
+	}
+	root := path.Join("templates", tmpl)
+
+	raw, err := templates.ReadFile(path.Join(root, "runefact.toml"))
+	if err != nil {
+		return nil, err
+	}
+	t, err := template.New("runefact.toml").Parse(string(raw))
+	if err != nil {
+		return nil, err
+	}
+	var cfg bytes.Buffer
+	if err := t.Execute(&cfg, struct{ Name string }{name}); err != nil {
+		return nil, err
+	}
+	files := []File{{Path: "runefact.toml", Content: cfg.String()}}
+
+	for _, dir := range Dirs {
+		entries, err := templates.ReadDir(path.Join(root, dir))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if e.IsDir() {
+				continue
+			}
+			data, err := templates.ReadFile(path.Join(root, dir, e.Name()))
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, File{Path: path.Join(dir, e.Name()), Content: string(data)})
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,187 @@
+package scaffold
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vgalaktionov/runefact/internal/config"
+	"github.com/vgalaktionov/runefact/internal/format"
+	"github.com/vgalaktionov/runefact/internal/migrate"
+)
+
+func TestFiles(t *testing.T) {
+	for _, tmpl := range Names() {
+		files, err := Files(tmpl, "test-game")
+		if err != nil {
+			t.Fatalf("%s: %v", tmpl, err)
+		}
+		if files[0].Path != "runefact.toml" {
+			t.Errorf("%s: first file = %q, want runefact.toml", tmpl, files[0].Path)
+		}
+		cfg, err := config.ParseConfig([]byte(files[0].Content))
+		if err != nil {
+			t.Errorf("%s: runefact.toml: %v", tmpl, err)
+		} else if cfg.Project.Name != "test-game" {
+			t.Errorf("%s: project name = %q, want test-game", tmpl, cfg.Project.Name)
+		}
+		for _, f := range files[1:] {
+			if !strings.HasPrefix(f.Path, "assets/") {
+				t.Errorf("%s: %s is outside assets/", tmpl, f.Path)
+			}
+		}
+	}
+}
+
+func TestFiles_Platformer(t *testing.T) {
+	files, err := Files(Default, "test-game")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"runefact.toml",
+		"assets/palettes/default.palette",
+		"assets/sprites/player.sprite",
+		"assets/sprites/tiles.sprite",
+		"assets/maps/level1.map",
+		"assets/instruments/bass.inst",
+		"assets/instruments/lead.inst",
+		"assets/sfx/coin.sfx",
+		"assets/sfx/jump.sfx",
+		"assets/tracks/demo.track",
+	}
+	if len(files) != len(want) {
+		t.Fatalf("got %d files, want %d", len(files), len(want))
+	}
+	for i, f := range files {
+		if f.Path != want[i] {
+			t.Errorf("file %d = %s, want %s", i, f.Path, want[i])
+		}
+	}
+}
+
+func TestFiles_None(t *testing.T) {
+	files, err := Files("none", "test-game")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("got %d files, want runefact.toml only", len(files))
+	}
+}
+
+func TestFiles_UnknownTemplate(t *testing.T) {
+	_, err := Files("shmup", "test-game")
+	if err == nil {
+		t.Fatal("expected an error for an unknown template")
+	}
+	if !strings.Contains(err.Error(), "minimal") {
+		t.Errorf("error should list the templates: %v", err)
+	}
+}
+
+// The example project is the default template as written out. The sprite
+// and map golden tests render it, so it has to stay in step.
+func TestFiles_MatchExample(t *testing.T) {
+	files, err := Files(Default, "test-game")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files[1:] {
+		data, err := os.ReadFile(filepath.Join("..", "..", "example", f.Path))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if string(data) != f.Content {
+			t.Errorf("example/%s differs from the %s template", f.Path, Default)
+		}
+	}
+}
+
+func TestFiles_Formatted(t *testing.T) {
+	for _, tmpl := range Names() {
+		files, err := Files(tmpl, "test-game")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range files {
+			ext := filepath.Ext(f.Path)
+			if _, ok := format.Dirs[ext]; !ok {
+				continue
+			}
+			out, err := format.Source([]byte(f.Content), ext)
+			if err != nil {
+				t.Errorf("%s: %s: %v", tmpl, f.Path, err)
+			} else if string(out) != f.Content {
+				t.Errorf("%s: %s is not formatted; want:\n%s", tmpl, f.Path, out)
+			}
+		}
+	}
+}
+
+// New projects start at the current format version, so upgrade has nothing
+// to do on them.
+func TestFiles_CurrentFormatVersion(t *testing.T) {
+	for _, tmpl := range Names() {
+		files, err := Files(tmpl, "test-game")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range files[1:] {
+			r, err := migrate.Upgrade([]byte(f.Content), f.Path)
+			if err != nil {
+				t.Errorf("%s: %v", tmpl, err)
+			} else if r.From != r.To {
+				t.Errorf("%s: %s is format_version %d, want %d", tmpl, f.Path, r.From, r.To)
+			}
+		}
+	}
+}
+
+func TestWriteAsset(t *testing.T) {
+	dir := t.TempDir()
+	p := AssetParams{Grid: 8, Palette: "default", Channels: 2, Duration: 0.2, Instrument: "lead"}
+	for _, typ := range AssetTypes {
+		kind := AssetKinds[typ]
+		path := filepath.Join(dir, kind.Dir, "fresh"+kind.Ext)
+		if err := WriteAsset(path, Asset(typ, "fresh", p)); err != nil {
+			t.Fatalf("%s: %v", typ, err)
+		}
+		r, err := migrate.Upgrade([]byte(Asset(typ, "fresh", p)), path)
+		if err != nil || r.From != r.To {
+			t.Errorf("%s: template is not at the current format version: %v", typ, err)
+		}
+		if err := WriteAsset(path, ""); !errors.Is(err, os.ErrExist) {
+			t.Errorf("%s: writing over the file: err = %v, want it refused", typ, err)
+		}
+		if data, _ := os.ReadFile(path); len(data) == 0 {
+			t.Errorf("%s: the refused write emptied the file", typ)
+		}
+	}
+}
+
+func TestCheckAsset(t *testing.T) {
+	ok := AssetParams{Grid: 16, Palette: "default", Channels: 1, Duration: 0.2}
+	if err := CheckAsset("hero", ok); err != nil {
+		t.Fatal(err)
+	}
+	bad := map[string]AssetParams{
+		"invalid name":    ok,
+		"invalid palette": {Grid: 16, Palette: `a"b`, Channels: 1, Duration: 0.2},
+		"grid must be":    {Grid: 0, Palette: "default", Channels: 1, Duration: 0.2},
+		"channels must":   {Grid: 16, Palette: "default", Channels: 17, Duration: 0.2},
+		"duration must":   {Grid: 16, Palette: "default", Channels: 1, Duration: 31},
+	}
+	for want, p := range bad {
+		name := "hero"
+		if want == "invalid name" {
+			name = "../hero"
+		}
+		if err := CheckAsset(name, p); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%+v: err = %v, want %q", p, err, want)
+		}
+	}
+}
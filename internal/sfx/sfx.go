@@ -1,6 +1,7 @@
 package sfx
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -8,6 +9,7 @@ import (
 	toml "github.com/pelletier/go-toml/v2"
 
 	"github.com/vgalaktionov/runefact/internal/audio"
+	"github.com/vgalaktionov/runefact/internal/tomlsrc"
 )
 
 // SFX represents a parsed .sfx file.
@@ -25,14 +27,32 @@ type VoiceDef struct {
 	Pitch     PitchDef
 	Filter    *FilterDef
 	Effects   EffectsDef
+
+	// SyncTo is the index of another voice this one hard-syncs to: its
+	// phase restarts whenever that voice starts a cycle. Nil when unsynced.
+	SyncTo *int
 }
 
 // EnvelopeDef is the TOML envelope section.
 type EnvelopeDef struct {
-	Attack  float64 `toml:"attack"`
-	Decay   float64 `toml:"decay"`
-	Sustain float64 `toml:"sustain"`
-	Release float64 `toml:"release"`
+	Attack       float64 `toml:"attack"`
+	Decay        float64 `toml:"decay"`
+	Sustain      float64 `toml:"sustain"`
+	Release      float64 `toml:"release"`
+	AttackCurve  string  `toml:"attack_curve"`
+	ReleaseCurve string  `toml:"release_curve"`
+}
+
+// ADSR returns the envelope as rendered.
+func (e EnvelopeDef) ADSR() audio.ADSR {
+	return audio.ADSR{
+		Attack:       e.Attack,
+		Decay:        e.Decay,
+		Sustain:      e.Sustain,
+		Release:      e.Release,
+		AttackCurve:  audio.CurveType(e.AttackCurve),
+		ReleaseCurve: audio.CurveType(e.ReleaseCurve),
+	}
 }
 
 // PitchDef is the TOML pitch section.
@@ -72,10 +92,12 @@ type rawVoiceDef struct {
 	Pitch     PitchDef    `toml:"pitch"`
 	Filter    *FilterDef  `toml:"filter"`
 	Effects   EffectsDef  `toml:"effects"`
+	SyncTo    *int        `toml:"sync_to"`
 }
 
 // ParseSFX parses .sfx file content.
 func ParseSFX(data []byte, filename string) (*SFX, error) {
+	data = tomlsrc.Normalize(data)
 	var raw rawSFX
 	if err := toml.Unmarshal(data, &raw); err != nil {
 		return nil, fmt.Errorf("%s: %w", filename, err)
@@ -104,9 +126,25 @@ func ParseSFX(data []byte, filename string) (*SFX, error) {
 			Pitch:     rv.Pitch,
 			Filter:    rv.Filter,
 			Effects:   rv.Effects,
+			SyncTo:    rv.SyncTo,
 		})
 	}
 
+	for i, v := range s.Voices {
+		if err := v.Envelope.ADSR().Validate(); err != nil {
+			return nil, fmt.Errorf("%s: voice %d: envelope: %w", filename, i, err)
+		}
+		if v.SyncTo == nil {
+			continue
+		}
+		switch to := *v.SyncTo; {
+		case to == i:
+			return nil, fmt.Errorf("%s: voice %d: sync_to = %d is the voice itself", filename, i, to)
+		case to < 0 || to >= len(s.Voices):
+			return nil, fmt.Errorf("%s: voice %d: sync_to = %d, but voices are numbered 0 to %d", filename, i, to, len(s.Voices)-1)
+		}
+	}
+
 	return s, nil
 }
 
@@ -119,18 +157,31 @@ func LoadSFX(path string) (*SFX, error) {
 	return ParseSFX(data, filepath.Base(path))
 }
 
-// Render generates audio samples for the SFX.
-func (s *SFX) Render(sampleRate int) ([]float64, []audio.Warning) {
+// Render generates audio samples for the SFX. The voices are stepped
+// together a sample at a time, so a voice can sync to another's phase. If
+// ctx is canceled first, it returns no samples and the context's error.
+func (s *SFX) Render(ctx context.Context, sampleRate int) ([]float64, []audio.Warning, error) {
 	numSamples := int(s.Duration * float64(sampleRate))
 	mixed := make([]float64, numSamples)
 	var warnings []audio.Warning
 
-	for _, vd := range s.Voices {
-		voice := buildVoice(vd, sampleRate)
-		voiceSamples := audio.RenderVoice(voice, s.Duration, sampleRate)
-
-		for i := 0; i < len(mixed) && i < len(voiceSamples); i++ {
-			mixed[i] += voiceSamples[i]
+	voices := make([]*audio.VoiceRenderer, len(s.Voices))
+	for i, vd := range s.Voices {
+		voices[i] = audio.NewVoiceRenderer(buildVoice(vd, sampleRate), s.Duration, sampleRate)
+	}
+	for i := range mixed {
+		if i%audio.CheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, nil, err
+			}
+		}
+		for _, v := range voices {
+			mixed[i] += v.Next()
+		}
+		for j, vd := range s.Voices {
+			if vd.SyncTo != nil {
+				voices[j].SyncTo(voices[*vd.SyncTo])
+			}
 		}
 	}
 
@@ -143,18 +194,13 @@ func (s *SFX) Render(sampleRate int) ([]float64, []audio.Warning) {
 	mixed, safetyWarnings := audio.ProcessSafety(mixed, sampleRate)
 	warnings = append(warnings, safetyWarnings...)
 
-	return mixed, warnings
+	return mixed, warnings, nil
 }
 
 func buildVoice(vd VoiceDef, sampleRate int) *audio.Voice {
 	v := &audio.Voice{
-		Osc: audio.NewOscillator(vd.Waveform, vd.DutyCycle),
-		Env: audio.ADSR{
-			Attack:  vd.Envelope.Attack,
-			Decay:   vd.Envelope.Decay,
-			Sustain: vd.Envelope.Sustain,
-			Release: vd.Envelope.Release,
-		},
+		Osc:        audio.NewOscillator(vd.Waveform, vd.DutyCycle),
+		Env:        vd.Envelope.ADSR(),
 		PitchStart: vd.Pitch.Start,
 		PitchEnd:   vd.Pitch.End,
 		PitchCurve: audio.CurveType(vd.Pitch.Curve),
@@ -1,10 +1,15 @@
 package sfx
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"math"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/vgalaktionov/runefact/internal/audio"
 )
@@ -106,6 +111,30 @@ start = 440
 	}
 }
 
+func TestParseSFX_EnvelopeCurves(t *testing.T) {
+	input := `duration = 0.2
+
+[[voice]]
+waveform = "noise"
+[voice.envelope]
+sustain = 1
+release = 0.15
+release_curve = %q
+`
+	s, err := ParseSFX(fmt.Appendf(nil, input, "exponential"), "hit.sfx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Voices[0].Envelope.ADSR().ReleaseCurve; got != audio.CurveExponential {
+		t.Errorf("release curve = %q, want exponential", got)
+	}
+
+	_, err = ParseSFX(fmt.Appendf(nil, input, "steep"), "hit.sfx")
+	if err == nil || !strings.Contains(err.Error(), `voice 0: envelope: release_curve "steep" must be`) {
+		t.Errorf("err = %v, want a release_curve error", err)
+	}
+}
+
 func TestSFX_Render(t *testing.T) {
 	s := &SFX{
 		Duration: 0.1,
@@ -118,7 +147,10 @@ func TestSFX_Render(t *testing.T) {
 			},
 		},
 	}
-	samples, warnings := s.Render(44100)
+	samples, warnings, err := s.Render(context.Background(), 44100)
+	if err != nil {
+		t.Fatal(err)
+	}
 	if len(samples) != 4410 {
 		t.Errorf("got %d samples, want 4410", len(samples))
 	}
@@ -137,6 +169,87 @@ func TestSFX_Render(t *testing.T) {
 	}
 }
 
+func TestParseSFX_SyncTo(t *testing.T) {
+	input := `duration = 0.1
+
+[[voice]]
+waveform = "sine"
+[voice.pitch]
+start = 110
+
+[[voice]]
+waveform = "sawtooth"
+sync_to = %d
+[voice.pitch]
+start = 250
+`
+	s, err := ParseSFX(fmt.Appendf(nil, input, 0), "lead.sfx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Voices[0].SyncTo != nil || s.Voices[1].SyncTo == nil || *s.Voices[1].SyncTo != 0 {
+		t.Errorf("sync_to = %v, %v, want unset and 0", s.Voices[0].SyncTo, s.Voices[1].SyncTo)
+	}
+
+	for to, want := range map[int]string{
+		1:  "voice 1: sync_to = 1 is the voice itself",
+		2:  "voice 1: sync_to = 2, but voices are numbered 0 to 1",
+		-1: "voice 1: sync_to = -1, but voices are numbered 0 to 1",
+	} {
+		_, err := ParseSFX(fmt.Appendf(nil, input, to), "lead.sfx")
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("sync_to = %d: err = %v, want %q", to, err, want)
+		}
+	}
+}
+
+func TestSFX_RenderCanceled(t *testing.T) {
+	s := &SFX{
+		Duration: 30,
+		Volume:   1,
+		Voices:   []VoiceDef{{Waveform: "sine", Envelope: EnvelopeDef{Sustain: 1}, Pitch: PitchDef{Start: 440}}},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+	samples, _, err := s.Render(ctx, 44100)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want context.DeadlineExceeded", err)
+	}
+	if samples != nil {
+		t.Errorf("got %d samples, want none", len(samples))
+	}
+}
+
+func TestSFX_RenderSync(t *testing.T) {
+	voices := func(syncTo *int) []VoiceDef {
+		return []VoiceDef{
+			{Waveform: "sine", Envelope: EnvelopeDef{Sustain: 1}, Pitch: PitchDef{Start: 110}},
+			{Waveform: "sawtooth", Envelope: EnvelopeDef{Sustain: 1}, Pitch: PitchDef{Start: 250}, SyncTo: syncTo},
+		}
+	}
+	free, _, err := (&SFX{Duration: 0.05, Volume: 0.5, Voices: voices(nil)}).Render(context.Background(), 44100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	master := 0
+	synced, _, err := (&SFX{Duration: 0.05, Volume: 0.5, Voices: voices(&master)}).Render(context.Background(), 44100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// One master cycle is 400.9 samples; until it ends the two renders
+	// match, and after it the synced sawtooth has restarted.
+	for i := range 400 {
+		if free[i] != synced[i] {
+			t.Fatalf("sample %d differs before the first sync", i)
+		}
+	}
+	if free[410] == synced[410] {
+		t.Error("sample 410 is unchanged, want the sawtooth restarted by the sync")
+	}
+}
+
 func TestLoadSFX(t *testing.T) {
 	dir := t.TempDir()
 	content := `duration = 0.1
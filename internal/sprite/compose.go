@@ -0,0 +1,338 @@
+package sprite
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/vgalaktionov/runefact/internal/palette"
+)
+
+// PartLoader resolves a compose part that lives in another sprite file.
+type PartLoader func(file, name string) (*ResolvedSprite, error)
+
+// PaletteLoader returns a palette by name, for sprites that override their
+// file's palette.
+type PaletteLoader func(name string) (*palette.Palette, error)
+
+// DirPaletteLoader returns a PaletteLoader that reads palettes from the
+// palettes directory of the first of assetsDirs that has them.
+func DirPaletteLoader(assetsDirs ...string) PaletteLoader {
+	return func(name string) (*palette.Palette, error) {
+		if name == ".." || strings.ContainsAny(name, `/\`) {
+			return nil, fmt.Errorf("invalid palette name %q", name)
+		}
+		return palette.ResolvePalette(name, subdirs(assetsDirs, "palettes"))
+	}
+}
+
+// DirPartLoader returns a PartLoader that reads "file:sprite" parts from
+// the sprites directory of the first of assetsDirs that has the file,
+// resolving each against the palette its file references.
+func DirPartLoader(assetsDirs ...string) PartLoader {
+	var stack []string
+	var load PartLoader
+	load = func(file, name string) (*ResolvedSprite, error) {
+		if file == "" || file == ".." || strings.ContainsAny(file, `/\`) {
+			return nil, fmt.Errorf("invalid sprite file reference %q", file)
+		}
+		ref := file + ":" + name
+		if slices.Contains(stack, ref) {
+			return nil, fmt.Errorf("compose cycle: %s -> %s", strings.Join(stack, " -> "), ref)
+		}
+		stack = append(stack, ref)
+		defer func() { stack = stack[:len(stack)-1] }()
+
+		sf, err := LoadSpriteFile(FindFile(subdirs(assetsDirs, "sprites"), file+".sprite"))
+		if err != nil {
+			return nil, err
+		}
+		pal := &palette.Palette{Colors: map[string]palette.Color{}}
+		if sf.PaletteRef != "" {
+			pal, err = palette.ResolvePalette(sf.PaletteRef, subdirs(assetsDirs, "palettes"))
+			if err != nil {
+				return nil, fmt.Errorf("loading palette %q: %w", sf.PaletteRef, err)
+			}
+		}
+		return sf.ResolvePart(pal, name, load, DirPaletteLoader(assetsDirs...))
+	}
+	return load
+}
+
+// FindFile returns the path of name in the first of dirs that has it, or
+// in the first dir if none does, so that opening it reports the file as
+// missing there.
+func FindFile(dirs []string, name string) string {
+	for _, dir := range dirs {
+		p := filepath.Join(dir, name)
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+	}
+	return filepath.Join(dirs[0], name)
+}
+
+func subdirs(dirs []string, sub string) []string {
+	out := make([]string, len(dirs))
+	for i, d := range dirs {
+		out[i] = filepath.Join(d, sub)
+	}
+	return out
+}
+
+// ComposeParts returns the names of sprites in this file that other sprites
+// in the file use as compose parts.
+func (sf *SpriteFile) ComposeParts() map[string]bool {
+	parts := map[string]bool{}
+	for _, s := range sf.Sprites {
+		for _, ref := range s.Compose {
+			if !strings.Contains(ref, ":") {
+				parts[ref] = true
+			}
+		}
+	}
+	return parts
+}
+
+// resolver resolves sprites of one file by name, composing parts on demand.
+type resolver struct {
+	sf       *SpriteFile
+	colors   map[string]palette.Color
+	load     PartLoader
+	pals     PaletteLoader
+	override map[string]map[string]palette.Color // colors by palette name
+	done     map[string]*ResolvedSprite
+	visiting map[string]bool
+	depth    map[string]int // length of each resolved sprite's from chain
+}
+
+func (sf *SpriteFile) newResolver(pal *palette.Palette, load PartLoader, pals PaletteLoader) (*resolver, error) {
+	colors, err := sf.paletteColors(pal)
+	if err != nil {
+		return nil, err
+	}
+	return &resolver{
+		sf:       sf,
+		colors:   colors,
+		load:     load,
+		pals:     pals,
+		override: map[string]map[string]palette.Color{},
+		done:     map[string]*ResolvedSprite{},
+		visiting: map[string]bool{},
+		depth:    map[string]int{},
+	}, nil
+}
+
+// spriteColors returns the colors s is drawn in: the file's, or those of
+// the palette it names, loaded once per resolver.
+func (r *resolver) spriteColors(s Sprite) (map[string]palette.Color, error) {
+	if s.Palette == "" {
+		return r.colors, nil
+	}
+	if colors, ok := r.override[s.Palette]; ok {
+		return colors, nil
+	}
+	if r.pals == nil {
+		return nil, fmt.Errorf("sprite %q: palette %q: palette overrides are not supported here", s.Name, s.Palette)
+	}
+	pal, err := r.pals(s.Palette)
+	if err != nil {
+		return nil, fmt.Errorf("sprite %q: %w", s.Name, err)
+	}
+	colors, err := r.sf.paletteColors(pal)
+	if err != nil {
+		return nil, err
+	}
+	r.override[s.Palette] = colors
+	return colors, nil
+}
+
+func (r *resolver) resolve(name string) (*ResolvedSprite, error) {
+	if rs, ok := r.done[name]; ok {
+		return rs, nil
+	}
+	idx := slices.IndexFunc(r.sf.Sprites, func(s Sprite) bool { return s.Name == name })
+	if idx < 0 {
+		return nil, fmt.Errorf("unknown sprite %q", name)
+	}
+	s := r.sf.Sprites[idx]
+
+	if s.From != "" {
+		return r.resolveFrom(s)
+	}
+	if len(s.Compose) == 0 {
+		colors, err := r.spriteColors(s)
+		if err != nil {
+			return nil, err
+		}
+		rs, err := resolveSprite(s, colors)
+		if err != nil {
+			return nil, err
+		}
+		r.done[name] = rs
+		return rs, nil
+	}
+
+	if r.visiting[name] {
+		return nil, fmt.Errorf("sprite %q: compose cycle", name)
+	}
+	r.visiting[name] = true
+	defer delete(r.visiting, name)
+
+	parts := make([]*ResolvedSprite, 0, len(s.Compose))
+	for _, ref := range s.Compose {
+		var part *ResolvedSprite
+		var err error
+		if file, partName, ok := strings.Cut(ref, ":"); ok {
+			if r.load == nil {
+				err = fmt.Errorf("parts from other files are not supported here")
+			} else {
+				part, err = r.load(file, partName)
+			}
+		} else {
+			part, err = r.resolve(ref)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("sprite %q: compose part %q: %w", name, ref, err)
+		}
+		parts = append(parts, part)
+	}
+
+	rs, err := composeSprite(s, parts)
+	if err != nil {
+		return nil, err
+	}
+	r.done[name] = rs
+	return rs, nil
+}
+
+// resolveFrom resolves a sprite made with from: its source, then the
+// transformed copy. Chains of from sprites in one file may be at most
+// maxFromDepth links long.
+func (r *resolver) resolveFrom(s Sprite) (*ResolvedSprite, error) {
+	if r.visiting[s.Name] {
+		return nil, fmt.Errorf("sprite %q: from cycle", s.Name)
+	}
+	r.visiting[s.Name] = true
+	defer delete(r.visiting, s.Name)
+
+	var src *ResolvedSprite
+	var err error
+	depth := 1
+	if file, srcName, ok := strings.Cut(s.From, ":"); ok {
+		if r.load == nil {
+			err = fmt.Errorf("sprites from other files are not supported here")
+		} else {
+			src, err = r.load(file, srcName)
+		}
+	} else {
+		src, err = r.resolve(s.From)
+		depth += r.depth[s.From]
+	}
+	if err != nil {
+		return nil, fmt.Errorf("sprite %q: from %q: %w", s.Name, s.From, err)
+	}
+	if limit := r.sf.maxFromDepth(); depth > limit {
+		return nil, fmt.Errorf("sprite %q: chain of from sprites is %d deep, more than the limit of %d", s.Name, depth, limit)
+	}
+
+	rs, err := transformSprite(s, src)
+	if err != nil {
+		return nil, err
+	}
+	r.done[s.Name] = rs
+	r.depth[s.Name] = depth
+	return rs, nil
+}
+
+// composeSprite stacks parts bottom-to-top. All parts must share one grid;
+// the result has as many frames as the longest part, and shorter parts loop.
+func composeSprite(s Sprite, parts []*ResolvedSprite) (*ResolvedSprite, error) {
+	grid := parts[0].Grid
+	for i, p := range parts {
+		if len(p.Frames) == 0 {
+			return nil, fmt.Errorf("sprite %q: compose part %q has no frames", s.Name, s.Compose[i])
+		}
+		if p.Grid != grid {
+			return nil, fmt.Errorf("sprite %q: compose part %q is %dx%d, expected %dx%d like %q",
+				s.Name, s.Compose[i], p.Grid.W, p.Grid.H, grid.W, grid.H, s.Compose[0])
+		}
+	}
+	if (s.Grid.W > 0 || s.Grid.H > 0) && s.Grid != grid {
+		return nil, fmt.Errorf("sprite %q: grid %dx%d doesn't match its parts (%dx%d)",
+			s.Name, s.Grid.W, s.Grid.H, grid.W, grid.H)
+	}
+
+	frames, fps := 0, s.Framerate
+	for _, p := range parts {
+		frames = max(frames, len(p.Frames))
+		if s.Framerate == 0 {
+			fps = max(fps, p.Framerate)
+		}
+	}
+
+	rs := &ResolvedSprite{
+		Name:      s.Name,
+		Grid:      grid,
+		Framerate: fps,
+		Playback:  s.Playback,
+
+		ExportFrames: s.ExportFrames,
+		Meta:         s.Meta,
+		Events:       s.Events,
+		Hitboxes:     s.Hitboxes,
+	}
+	if err := checkEvents(s.Events, frames); err != nil {
+		return nil, fmt.Errorf("sprite %q: %w", s.Name, err)
+	}
+	if err := checkHitboxes(s.Hitboxes, grid, frames); err != nil {
+		return nil, fmt.Errorf("sprite %q: %w", s.Name, err)
+	}
+	if s.Pivot != nil {
+		pivot, err := placePivot(s.Pivot, grid)
+		if err != nil {
+			return nil, fmt.Errorf("sprite %q: %w", s.Name, err)
+		}
+		rs.Pivot = pivot
+	}
+	for i := 0; i < frames; i++ {
+		pixels := make([][]palette.Color, grid.H)
+		for y := range pixels {
+			pixels[y] = make([]palette.Color, grid.W)
+		}
+		for _, p := range parts {
+			src := p.Frames[i%len(p.Frames)].Pixels
+			for y, row := range src {
+				for x, c := range row {
+					pixels[y][x] = over(pixels[y][x], c)
+				}
+			}
+		}
+		rs.Frames = append(rs.Frames, ResolvedFrame{Pixels: pixels})
+	}
+	return rs, nil
+}
+
+// over composites src on top of dst using straight (non-premultiplied) alpha.
+func over(dst, src palette.Color) palette.Color {
+	switch {
+	case src.A == 255 || dst.A == 0:
+		return src
+	case src.A == 0:
+		return dst
+	}
+	sa := float64(src.A) / 255
+	da := float64(dst.A) / 255 * (1 - sa)
+	a := sa + da
+	mix := func(s, d uint8) uint8 {
+		return uint8((float64(s)*sa+float64(d)*da)/a + 0.5)
+	}
+	return palette.Color{
+		R: mix(src.R, dst.R),
+		G: mix(src.G, dst.G),
+		B: mix(src.B, dst.B),
+		A: uint8(a*255 + 0.5),
+	}
+}
@@ -0,0 +1,235 @@
+package sprite
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vgalaktionov/runefact/internal/palette"
+)
+
+var composePalette = &palette.Palette{Colors: map[string]palette.Color{
+	"s": {R: 200, G: 150, B: 100, A: 255},
+	"h": {R: 255, A: 255},
+	"t": {B: 255, A: 255},
+	"g": {G: 255, A: 128},
+}}
+
+func resolveByName(t *testing.T, resolved []ResolvedSprite) map[string]ResolvedSprite {
+	t.Helper()
+	out := map[string]ResolvedSprite{}
+	for _, rs := range resolved {
+		out[rs.Name] = rs
+	}
+	return out
+}
+
+func TestCompose_StacksParts(t *testing.T) {
+	input := []byte(`
+grid = 2
+
+[sprite.body]
+pixels = """
+ss
+ss
+"""
+
+[sprite.hair]
+framerate = 4
+[[sprite.hair.frame]]
+pixels = """
+hh
+__
+"""
+[[sprite.hair.frame]]
+pixels = """
+h_
+__
+"""
+
+[sprite.tunic]
+standalone = true
+pixels = """
+__
+tg
+"""
+
+[sprite.hero]
+compose = ["body", "hair", "tunic"]
+`)
+	sf, err := ParseSpriteFile(input, "test.sprite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolved, err := sf.Resolve(composePalette)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := resolveByName(t, resolved)
+
+	if _, ok := byName["body"]; ok {
+		t.Error("part-only sprite body should not be in the output")
+	}
+	if _, ok := byName["tunic"]; !ok {
+		t.Error("standalone part tunic should be in the output")
+	}
+
+	hero, ok := byName["hero"]
+	if !ok {
+		t.Fatal("composed sprite hero missing")
+	}
+	if hero.Grid != (Grid{W: 2, H: 2}) || len(hero.Frames) != 2 || hero.Framerate != 4 {
+		t.Fatalf("hero = %v, %d frames @%dfps; want 2x2, 2 frames @4fps", hero.Grid, len(hero.Frames), hero.Framerate)
+	}
+
+	skin := composePalette.Colors["s"]
+	red := composePalette.Colors["h"]
+	f0, f1 := hero.Frames[0].Pixels, hero.Frames[1].Pixels
+	if f0[0][0] != red || f0[0][1] != red {
+		t.Errorf("frame 0 top row = %v, want hair over body", f0[0])
+	}
+	if f1[0][1] != skin {
+		t.Errorf("frame 1 (0,1) = %v, want body showing through", f1[0][1])
+	}
+	if f0[1][0] != composePalette.Colors["t"] {
+		t.Errorf("tunic should cover the body: %v", f0[1][0])
+	}
+	// Half-transparent green over opaque skin blends and stays opaque.
+	if c := f0[1][1]; c.A != 255 || c.G <= skin.G || c.R >= skin.R {
+		t.Errorf("blended pixel = %v, want opaque mix of green and skin", c)
+	}
+}
+
+func TestCompose_GridMismatch(t *testing.T) {
+	input := []byte(`
+[sprite.a]
+grid = 2
+pixels = """
+ss
+ss
+"""
+[sprite.b]
+grid = 1
+pixels = "h"
+[sprite.c]
+compose = ["a", "b"]
+`)
+	sf, err := ParseSpriteFile(input, "test.sprite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = sf.Resolve(composePalette)
+	if err == nil || !strings.Contains(err.Error(), `"b" is 1x1, expected 2x2`) {
+		t.Errorf("err = %v, want grid mismatch for b", err)
+	}
+}
+
+func TestCompose_Errors(t *testing.T) {
+	tests := map[string]string{
+		"cycle": `
+[sprite.a]
+compose = ["b"]
+[sprite.b]
+compose = ["a"]
+`,
+		"unknown part": `
+[sprite.a]
+compose = ["nope"]
+`,
+		"cross-file without loader": `
+[sprite.a]
+compose = ["other:b"]
+`,
+	}
+	for name, input := range tests {
+		sf, err := ParseSpriteFile([]byte(input), "test.sprite")
+		if err != nil {
+			t.Fatalf("%s: parse: %v", name, err)
+		}
+		if _, err := sf.Resolve(composePalette); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+
+	_, err := ParseSpriteFile([]byte(`
+[sprite.a]
+compose = ["b"]
+pixels = "s"
+`), "test.sprite")
+	if err == nil {
+		t.Error("compose with pixels should be rejected")
+	}
+}
+
+func TestCompose_Pivot(t *testing.T) {
+	// A named pivot on a composed sprite is placed on its parts' grid.
+	body := `
+[sprite.body]
+grid = "3x4"
+pixels = """
+sss
+sss
+sss
+sss
+"""
+`
+	sf, err := ParseSpriteFile([]byte(body+"[sprite.hero]\ncompose = [\"body\"]\npivot = \"bottom-center\"\n"), "test.sprite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolved, err := sf.Resolve(composePalette)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hero := resolveByName(t, resolved)["hero"]
+	if hero.Pivot == nil || hero.Pivot.X != 1 || hero.Pivot.Y != 3 {
+		t.Errorf("hero pivot = %+v, want (1, 3)", hero.Pivot)
+	}
+
+	sf, err = ParseSpriteFile([]byte(body+"[sprite.bad]\ncompose = [\"body\"]\npivot = { x = 0, y = 4 }\n"), "test.sprite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sf.Resolve(composePalette); err == nil || !strings.Contains(err.Error(), "outside the 3x4 grid") {
+		t.Errorf("err = %v, want pivot outside the grid", err)
+	}
+}
+
+func TestDirPartLoader(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "sprites"), 0755)
+	os.MkdirAll(filepath.Join(dir, "palettes"), 0755)
+	os.WriteFile(filepath.Join(dir, "palettes", "p.palette"), []byte(`name = "p"
+[colors]
+h = "#ff0000"
+`), 0644)
+	os.WriteFile(filepath.Join(dir, "sprites", "hair.sprite"), []byte(`palette = "p"
+grid = 1
+[sprite.red]
+pixels = "h"
+`), 0644)
+
+	sf, err := ParseSpriteFile([]byte(`
+grid = 1
+[sprite.body]
+pixels = "s"
+[sprite.hero]
+compose = ["body", "hair:red"]
+`), "hero.sprite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolved, err := sf.ResolveWith(composePalette, DirPartLoader(dir), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resolved) != 1 || resolved[0].Frames[0].Pixels[0][0] != (palette.Color{R: 255, A: 255}) {
+		t.Errorf("resolved = %+v, want hero with red hair from hair.sprite", resolved)
+	}
+
+	bad := &SpriteFile{Sprites: []Sprite{{Name: "x", Compose: []string{"../etc:passwd"}}}}
+	if _, err := bad.ResolveWith(composePalette, DirPartLoader(dir), nil); err == nil {
+		t.Error("path traversal in part reference should be rejected")
+	}
+}
@@ -0,0 +1,109 @@
+package sprite
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vgalaktionov/runefact/internal/golden"
+	"github.com/vgalaktionov/runefact/internal/palette"
+)
+
+// loadScaffoldSprites resolves every sprite file of the scaffold, by name.
+func loadScaffoldSprites(t *testing.T) map[string][]ResolvedSprite {
+	t.Helper()
+	pal, err := palette.LoadPalette(filepath.Join(scaffoldAssets, "palettes", "default.palette"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := filepath.Glob(filepath.Join(scaffoldAssets, "sprites", "*.sprite"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no scaffold sprites: %v", err)
+	}
+	out := map[string][]ResolvedSprite{}
+	for _, f := range files {
+		sf, err := LoadSpriteFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resolved, err := sf.ResolveWith(pal, DirPartLoader(scaffoldAssets), DirPaletteLoader(scaffoldAssets))
+		if err != nil {
+			t.Fatal(err)
+		}
+		out[strings.TrimSuffix(filepath.Base(f), ".sprite")] = resolved
+	}
+	return out
+}
+
+// scaffoldAssets is the example project, which runefact init writes out
+// file for file.
+const scaffoldAssets = "../../example/assets"
+
+// TestGolden_ScaffoldSheets renders every sprite file of the scaffold into
+// its sheet and compares it with testdata/golden/NAME.png.
+func TestGolden_ScaffoldSheets(t *testing.T) {
+	pal, err := palette.LoadPalette(filepath.Join(scaffoldAssets, "palettes", "default.palette"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := filepath.Glob(filepath.Join(scaffoldAssets, "sprites", "*.sprite"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no scaffold sprites: %v", err)
+	}
+	for _, f := range files {
+		name := strings.TrimSuffix(filepath.Base(f), ".sprite")
+		t.Run(name, func(t *testing.T) {
+			sf, err := LoadSpriteFile(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resolved, err := sf.ResolveWith(pal, DirPartLoader(scaffoldAssets), DirPaletteLoader(scaffoldAssets))
+			if err != nil {
+				t.Fatal(err)
+			}
+			img, _, err := RenderSpriteSheet(resolved, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			golden.AssertImage(t, name, img)
+		})
+	}
+}
+
+// sheetLayouts are the option sets the layout goldens cover.
+var sheetLayouts = []SheetOptions{
+	{Layout: LayoutRows},
+	{Layout: LayoutRows, POT: true},
+	{Layout: LayoutGrid},
+	{Layout: LayoutGrid, POT: true},
+	{Layout: LayoutPacked},
+	{Layout: LayoutPacked, POT: true},
+}
+
+func layoutName(opts SheetOptions) string {
+	if opts.POT {
+		return string(opts.Layout) + "_pot"
+	}
+	return string(opts.Layout)
+}
+
+// TestGolden_SheetLayouts compares the size and sprite coordinates of each
+// scaffold sheet in every layout with testdata/golden/NAME.LAYOUT.json.
+func TestGolden_SheetLayouts(t *testing.T) {
+	for name, resolved := range loadScaffoldSprites(t) {
+		for _, opts := range sheetLayouts {
+			t.Run(fmt.Sprintf("%s/%s", name, layoutName(opts)), func(t *testing.T) {
+				img, meta, err := RenderSheet(resolved, nil, opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				golden.AssertJSON(t, name+"."+layoutName(opts), struct {
+					Width   int                   `json:"width"`
+					Height  int                   `json:"height"`
+					Sprites map[string]SpriteInfo `json:"sprites"`
+				}{img.Bounds().Dx(), img.Bounds().Dy(), meta.Sprites})
+			})
+		}
+	}
+}
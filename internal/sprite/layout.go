@@ -0,0 +1,132 @@
+package sprite
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+)
+
+// Layout is how a sheet arranges its sprites. In every layout a sprite's
+// frames sit left to right W pixels apart, starting at its X, Y.
+type Layout string
+
+const (
+	// LayoutRows gives each sprite a row of its own, stacked in file order.
+	LayoutRows Layout = "rows"
+	// LayoutGrid is LayoutRows with every frame padded on the right and
+	// bottom to the largest sprite's size, so all cells are the same.
+	LayoutGrid Layout = "grid"
+	// LayoutPacked packs the sprites' rows onto shelves, tallest first,
+	// in a sheet about as wide as it is tall.
+	LayoutPacked Layout = "packed"
+)
+
+// Layouts lists the layouts, the default first.
+var Layouts = []Layout{LayoutRows, LayoutGrid, LayoutPacked}
+
+// SheetOptions controls how sprites are laid out in a sheet.
+type SheetOptions struct {
+	Layout Layout // empty means LayoutRows
+	// POT rounds the sheet's width and height up to powers of two,
+	// padding with transparent pixels.
+	POT bool
+}
+
+// slot is where a sprite's first frame sits and the size of each frame.
+type slot struct {
+	x, y, w, h int
+}
+
+// layoutSheet places every sprite and returns the sheet size.
+func layoutSheet(sprites []ResolvedSprite, opts SheetOptions) ([]slot, int, int, error) {
+	slots := make([]slot, len(sprites))
+	w, h := 0, 0
+	switch opts.Layout {
+	case "", LayoutRows:
+		for i, s := range sprites {
+			slots[i] = slot{0, h, s.Grid.W, s.Grid.H}
+			w = max(w, s.Grid.W*len(s.Frames))
+			h += s.Grid.H
+		}
+	case LayoutGrid:
+		cellW, cellH, frames := 0, 0, 0
+		for _, s := range sprites {
+			cellW = max(cellW, s.Grid.W)
+			cellH = max(cellH, s.Grid.H)
+			frames = max(frames, len(s.Frames))
+		}
+		for i := range sprites {
+			slots[i] = slot{0, i * cellH, cellW, cellH}
+		}
+		w, h = frames*cellW, len(sprites)*cellH
+	case LayoutPacked:
+		w, h = packShelves(sprites, slots, opts.POT)
+	default:
+		return nil, 0, 0, fmt.Errorf("unknown sheet layout %q", opts.Layout)
+	}
+	if opts.POT {
+		w, h = nextPowerOfTwo(w), nextPowerOfTwo(h)
+	}
+	return slots, w, h, nil
+}
+
+// packShelves fills slots with a shelf packing of the sprites' rows and
+// returns the space used. Rows go tallest first, widest first among equal
+// heights, then in file order, so the result is the same on every build.
+func packShelves(sprites []ResolvedSprite, slots []slot, pot bool) (int, int) {
+	order := make([]int, len(sprites))
+	area, limit := 0, 0
+	for i, s := range sprites {
+		order[i] = i
+		rowW := s.Grid.W * len(s.Frames)
+		area += rowW * s.Grid.H
+		limit = max(limit, rowW)
+	}
+	limit = max(limit, int(math.Ceil(math.Sqrt(float64(area)))))
+	if pot {
+		// Fill the width the sheet will be padded to anyway.
+		limit = nextPowerOfTwo(limit)
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		sa, sb := sprites[a], sprites[b]
+		if c := cmp.Compare(sb.Grid.H, sa.Grid.H); c != 0 {
+			return c
+		}
+		return cmp.Compare(sb.Grid.W*len(sb.Frames), sa.Grid.W*len(sa.Frames))
+	})
+
+	w, x, y, shelfH := 0, 0, 0, 0
+	for _, i := range order {
+		s := sprites[i]
+		rowW := s.Grid.W * len(s.Frames)
+		if x > 0 && x+rowW > limit {
+			x, y, shelfH = 0, y+shelfH, 0
+		}
+		slots[i] = slot{x, y, s.Grid.W, s.Grid.H}
+		x += rowW
+		w = max(w, x)
+		shelfH = max(shelfH, s.Grid.H)
+	}
+	return w, y + shelfH
+}
+
+// SheetSize returns the width and height of the sheet RenderSheet would
+// produce for sprites.
+func SheetSize(sprites []ResolvedSprite, opts SheetOptions) (int, int, error) {
+	_, w, h, err := layoutSheet(sprites, opts)
+	return w, h, err
+}
+
+// nextPowerOfTwo returns the smallest power of two not less than n, and 0
+// for 0.
+func nextPowerOfTwo(n int) int {
+	if n <= 0 {
+		return 0
+	}
+	p := 1
+	for p < n {
+		p <<= 1
+	}
+	return p
+}
@@ -0,0 +1,105 @@
+package sprite
+
+import (
+	"testing"
+
+	"github.com/vgalaktionov/runefact/internal/palette"
+)
+
+// solidSprite returns a sprite whose frames are filled with distinct
+// opaque colors, so a frame drawn in the wrong place shows up.
+func solidSprite(name string, w, h, frames int) ResolvedSprite {
+	s := ResolvedSprite{Name: name, Grid: Grid{W: w, H: h}}
+	for f := range frames {
+		c := palette.Color{R: uint8(len(name) * 40), G: uint8(w*8 + h), B: uint8(f * 50), A: 255}
+		px := make([][]palette.Color, h)
+		for y := range px {
+			px[y] = make([]palette.Color, w)
+			for x := range px[y] {
+				px[y][x] = c
+			}
+		}
+		s.Frames = append(s.Frames, ResolvedFrame{Pixels: px})
+	}
+	return s
+}
+
+func mixedSprites() []ResolvedSprite {
+	return []ResolvedSprite{
+		solidSprite("hero", 16, 16, 4),
+		solidSprite("boss", 48, 32, 2),
+		solidSprite("dot", 4, 4, 1),
+		solidSprite("bar", 8, 2, 6),
+		solidSprite("tree", 16, 32, 1),
+	}
+}
+
+// Every frame can be found at X + i*W, Y in every layout, and nothing else
+// is drawn over it.
+func TestRenderSheet_Coordinates(t *testing.T) {
+	sprites := mixedSprites()
+	for _, opts := range sheetLayouts {
+		t.Run(layoutName(opts), func(t *testing.T) {
+			img, meta, err := RenderSheet(sprites, nil, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			covered := map[[2]int]bool{}
+			for _, s := range sprites {
+				info := meta.Sprites[s.Name]
+				if info.W < s.Grid.W || info.H < s.Grid.H || info.Frames != len(s.Frames) {
+					t.Fatalf("%s: info %+v too small for %dx%d x%d", s.Name, info, s.Grid.W, s.Grid.H, len(s.Frames))
+				}
+				for f, frame := range s.Frames {
+					for y := range info.H {
+						for x := range info.W {
+							px, py := info.X+f*info.W+x, info.Y+y
+							if covered[[2]int{px, py}] {
+								t.Fatalf("%s frame %d overlaps another frame at %d,%d", s.Name, f, px, py)
+							}
+							covered[[2]int{px, py}] = true
+							want := palette.Color{}
+							if x < s.Grid.W && y < s.Grid.H {
+								want = frame.Pixels[y][x]
+							}
+							if got := img.RGBAAt(px, py); got != want.ToRGBA() {
+								t.Fatalf("%s frame %d pixel %d,%d = %v, want %v", s.Name, f, x, y, got, want)
+							}
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestSheetSize(t *testing.T) {
+	sprites := mixedSprites()
+	tests := []struct {
+		opts SheetOptions
+		w, h int
+	}{
+		{SheetOptions{}, 96, 86},
+		{SheetOptions{Layout: LayoutRows, POT: true}, 128, 128},
+		{SheetOptions{Layout: LayoutGrid}, 288, 160},
+		{SheetOptions{Layout: LayoutPacked}, 96, 66},
+		{SheetOptions{Layout: LayoutPacked, POT: true}, 128, 64},
+	}
+	for _, tt := range tests {
+		w, h, err := SheetSize(sprites, tt.opts)
+		if err != nil || w != tt.w || h != tt.h {
+			t.Errorf("%s: size = %dx%d, %v; want %dx%d", layoutName(tt.opts), w, h, err, tt.w, tt.h)
+		}
+	}
+	if _, _, err := SheetSize(sprites, SheetOptions{Layout: "spiral"}); err == nil {
+		t.Error("expected an error for an unknown layout")
+	}
+}
+
+func TestNextPowerOfTwo(t *testing.T) {
+	for n, want := range map[int]int{0: 0, 1: 1, 2: 2, 3: 4, 16: 16, 17: 32, 1000: 1024} {
+		if got := nextPowerOfTwo(n); got != want {
+			t.Errorf("nextPowerOfTwo(%d) = %d, want %d", n, got, want)
+		}
+	}
+}
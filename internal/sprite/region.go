@@ -0,0 +1,105 @@
+package sprite
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// Region is a rectangle of the file's [canvas] that a sprite frame is cut
+// from, in canvas pixels from the top-left corner.
+type Region struct {
+	X, Y, W, H int
+}
+
+// parseRegions parses a region value: one {x, y, w, h} table for a static
+// sprite, or a list of them, one per frame. w and h default to grid.
+func parseRegions(v any, grid Grid) ([]Region, error) {
+	switch v := v.(type) {
+	case map[string]any:
+		r, err := parseRegion(v, grid)
+		if err != nil {
+			return nil, fmt.Errorf("region: %w", err)
+		}
+		return []Region{r}, nil
+	case []any:
+		if len(v) == 0 {
+			return nil, fmt.Errorf("region list is empty")
+		}
+		if len(v) > maxFrames {
+			return nil, fmt.Errorf("more than %d regions", maxFrames)
+		}
+		regions := make([]Region, 0, len(v))
+		for i, item := range v {
+			t, ok := item.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("region %d must be {x, y, w, h}, got %T", i+1, item)
+			}
+			r, err := parseRegion(t, grid)
+			if err != nil {
+				return nil, fmt.Errorf("region %d: %w", i+1, err)
+			}
+			regions = append(regions, r)
+		}
+		return regions, nil
+	default:
+		return nil, fmt.Errorf("region must be {x, y, w, h} or a list of them, got %T", v)
+	}
+}
+
+func parseRegion(t map[string]any, grid Grid) (Region, error) {
+	r := Region{W: grid.W, H: grid.H}
+	keys := make([]string, 0, len(t))
+	for key := range t {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		n, ok := t[key].(int64)
+		if !ok {
+			return r, fmt.Errorf("%s must be a whole number, got %v", key, t[key])
+		}
+		switch key {
+		case "x":
+			r.X = int(n)
+		case "y":
+			r.Y = int(n)
+		case "w":
+			r.W = int(n)
+		case "h":
+			r.H = int(n)
+		default:
+			return r, fmt.Errorf("unknown key %q, want x, y, w and h", key)
+		}
+	}
+	for _, key := range []string{"x", "y"} {
+		if _, ok := t[key]; !ok {
+			return r, fmt.Errorf("missing %s", key)
+		}
+	}
+	if r.X < 0 || r.Y < 0 {
+		return r, fmt.Errorf("x and y must not be negative, got %d, %d", r.X, r.Y)
+	}
+	if r.W <= 0 || r.H <= 0 {
+		return r, fmt.Errorf("size %dx%d must be positive; set w and h, or a grid", r.W, r.H)
+	}
+	return r, nil
+}
+
+// crop returns the canvas keys inside r, checking that r lies within the
+// canvas.
+func (r Region) crop(canvas [][]string) ([][]string, error) {
+	h := len(canvas)
+	w := 0
+	if h > 0 {
+		w = len(canvas[0])
+	}
+	if r.X+r.W > w || r.Y+r.H > h {
+		return nil, fmt.Errorf("%dx%d at %d,%d is outside the %dx%d canvas", r.W, r.H, r.X, r.Y, w, h)
+	}
+	pixels := make([][]string, r.H)
+	for y := range pixels {
+		pixels[y] = slices.Clone(canvas[r.Y+y][r.X : r.X+r.W])
+	}
+	return pixels, nil
+}
@@ -0,0 +1,103 @@
+package sprite
+
+import (
+	"strings"
+	"testing"
+)
+
+const regionCanvas = `
+[canvas]
+pixels = """
+shgt
+hgts
+gtsh
+tsh_
+"""
+`
+
+func TestRegion_CropsCanvas(t *testing.T) {
+	sf, err := ParseSpriteFile([]byte("grid = 2\n"+regionCanvas+`
+[sprite.corner]
+region = { x = 2, y = 2 }
+
+[sprite.strip]
+grid = "4x1"
+region = { x = 0, y = 1 }
+
+[sprite.spin]
+framerate = 4
+region = [{ x = 0, y = 0 }, { x = 2, y = 0 }, { x = 1, y = 1 }]
+`), "test.sprite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		frames [][]string // rows joined, one string per frame
+	}{
+		{"corner", [][]string{{"sh", "h_"}}},
+		{"strip", [][]string{{"hgts"}}},
+		{"spin", [][]string{{"sh", "hg"}, {"gt", "ts"}, {"gt", "ts"}}},
+	}
+	for i, tt := range tests {
+		s := sf.Sprites[i]
+		if s.Name != tt.name {
+			t.Fatalf("sprite %d is %q, want %q", i, s.Name, tt.name)
+		}
+		if len(s.Frames) != len(tt.frames) || len(s.Regions) != len(tt.frames) {
+			t.Fatalf("%s: %d frames, %d regions; want %d", s.Name, len(s.Frames), len(s.Regions), len(tt.frames))
+		}
+		for f, want := range tt.frames {
+			var rows []string
+			for _, row := range s.Frames[f].Pixels {
+				rows = append(rows, strings.Join(row, ""))
+			}
+			if strings.Join(rows, "/") != strings.Join(want, "/") {
+				t.Errorf("%s frame %d = %v, want %v", s.Name, f, rows, want)
+			}
+		}
+	}
+	if g := sf.Sprites[1].Grid; g.W != 4 || g.H != 1 {
+		t.Errorf("strip grid = %dx%d, want 4x1", g.W, g.H)
+	}
+
+	resolved, err := sf.Resolve(composePalette)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resolved[0].Frames[0].Pixels[1][1]; got.A != 0 {
+		t.Errorf("corner's transparent pixel resolved to %v", got)
+	}
+	if got := resolved[0].Frames[0].Pixels[0][0]; got != composePalette.Colors["s"] {
+		t.Errorf("corner's first pixel = %v, want the s color", got)
+	}
+}
+
+func TestRegion_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"out of bounds", regionCanvas + "[sprite.a]\nregion = { x = 3, y = 0, w = 2, h = 2 }\n", "region 2x2 at 3,0 is outside the 4x4 canvas"},
+		{"frame out of bounds", "grid = 2\n" + regionCanvas + "[sprite.a]\nregion = [{ x = 0, y = 0 }, { x = 0, y = 3 }]\n", "region 2 2x2 at 0,3 is outside"},
+		{"no canvas", "[sprite.a]\nregion = { x = 0, y = 0, w = 1, h = 1 }\n", "needs a [canvas]"},
+		{"no size", regionCanvas + "[sprite.a]\nregion = { x = 0, y = 0 }\n", "set w and h, or a grid"},
+		{"missing y", regionCanvas + "[sprite.a]\nregion = { x = 0, w = 1, h = 1 }\n", "missing y"},
+		{"negative", regionCanvas + "[sprite.a]\nregion = { x = -1, y = 0, w = 1, h = 1 }\n", "must not be negative"},
+		{"unknown key", regionCanvas + "[sprite.a]\nregion = { x = 0, y = 0, w = 1, h = 1, z = 2 }\n", `unknown key "z"`},
+		{"not a table", regionCanvas + "[sprite.a]\nregion = \"0,0\"\n", "region must be {x, y, w, h}"},
+		{"with pixels", regionCanvas + "[sprite.a]\nregion = { x = 0, y = 0, w = 1, h = 1 }\npixels = \"s\"\n", "cannot be combined"},
+		{"grid mismatch", regionCanvas + "[sprite.a]\ngrid = 2\nregion = { x = 0, y = 0, w = 3, h = 2 }\n", "don't match grid 2x2"},
+		{"frame count", regionCanvas + "[sprite.a]\nframe_count = 2\nregion = { x = 0, y = 0, w = 1, h = 1 }\n", "frame_count is 2"},
+		{"ragged canvas", "[canvas]\npixels = \"\"\"\nss\ns\n\"\"\"\n", "canvas: line 2: ragged row"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseSpriteFile([]byte(tt.input), "test.sprite")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package sprite
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// pixelsStart matches the start of a pixels value: the key, and the quote
+// that opens the string.
+var pixelsStart = regexp.MustCompile(`^\s*pixels\s*=\s*("""|'''|"|')`)
+
+// RekeySource rewrites palette keys in the pixel grids of a .sprite file,
+// keeping every other byte. rename is called with the name of the sprite
+// each grid belongs to, "" for the file's [canvas], and returns the keys
+// to replace in it, mapped to their new keys; nil leaves the grid alone.
+// It returns the new source and the number of pixels changed.
+func RekeySource(data []byte, rename func(sprite string) map[string]string) ([]byte, int) {
+	lines := strings.SplitAfter(string(data), "\n")
+	count := 0
+	section := ""
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") {
+			section = headerSprite(trimmed)
+			continue
+		}
+		m := pixelsStart.FindStringSubmatchIndex(line)
+		if m == nil {
+			// Skip other multi-line strings, whose lines may look like
+			// table headers.
+			if strings.Count(line, `"""`)%2 == 1 {
+				for i+1 < len(lines) {
+					i++
+					if strings.Contains(lines[i], `"""`) {
+						break
+					}
+				}
+			}
+			continue
+		}
+		keys := rename(section)
+		quote := line[m[2]:m[3]]
+		rest := line[m[1]:]
+		if end := strings.Index(rest, quote); end >= 0 {
+			lines[i] = line[:m[1]] + rekeyRows(rest[:end], keys, &count) + rest[end:]
+			continue
+		}
+		if len(quote) == 1 {
+			continue // an unterminated string; the parser reports it
+		}
+		lines[i] = line[:m[1]] + rekeyRows(rest, keys, &count)
+		for i++; i < len(lines); i++ {
+			if end := strings.Index(lines[i], quote); end >= 0 {
+				lines[i] = rekeyRows(lines[i][:end], keys, &count) + lines[i][end:]
+				break
+			}
+			lines[i] = rekeyRows(lines[i], keys, &count)
+		}
+	}
+	return []byte(strings.Join(lines, "")), count
+}
+
+// headerSprite returns the sprite a table header belongs to, such as
+// "hero" for [sprite.hero] or [[sprite.hero.frame]], or "" for any other
+// table.
+func headerSprite(header string) string {
+	name, ok := strings.CutPrefix(strings.Trim(strings.SplitN(header, "]", 2)[0], "[ \t"), "sprite.")
+	if !ok {
+		return ""
+	}
+	if name == "" {
+		return ""
+	}
+	if q := name[0]; q == '"' || q == '\'' {
+		if end := strings.IndexByte(name[1:], q); end >= 0 {
+			return name[1 : end+1]
+		}
+	}
+	name, _, _ = strings.Cut(name, ".")
+	return name
+}
+
+// rekeyRows replaces the keys in rows of a pixel grid, leaving frame
+// separators and untouched keys as written.
+func rekeyRows(rows string, keys map[string]string, count *int) string {
+	if len(keys) == 0 {
+		return rows
+	}
+	var b strings.Builder
+	for _, row := range strings.SplitAfter(rows, "\n") {
+		if strings.TrimSpace(row) == "--" {
+			b.WriteString(row)
+			continue
+		}
+		for i := 0; i < len(row); {
+			key, size := row[i:i+1], 1
+			if row[i] == '[' {
+				if end := strings.IndexByte(row[i:], ']'); end > 0 {
+					key, size = row[i+1:i+end], end+1
+				}
+			} else {
+				_, size = utf8.DecodeRuneInString(row[i:])
+				key = row[i : i+size]
+			}
+			if to, ok := keys[key]; ok {
+				*count++
+				if utf8.RuneCountInString(to) == 1 {
+					b.WriteString(to)
+				} else {
+					b.WriteString("[" + to + "]")
+				}
+			} else {
+				b.WriteString(row[i : i+size])
+			}
+			i += size
+		}
+	}
+	return b.String()
+}
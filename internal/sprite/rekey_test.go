@@ -0,0 +1,80 @@
+package sprite
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRekeySource(t *testing.T) {
+	in := `palette = "p"
+[canvas]
+pixels = """
+gg
+"""
+
+[sprite.hero]
+pixels = """
+g[sk]_
+--
+[g]xg
+"""
+
+[sprite.hero.meta]
+note = """
+[sprite.other]
+g
+"""
+
+[sprite."a.b"]
+pixels = "gg"
+
+[[sprite.walk.frame]]
+pixels = '''
+g_
+'''
+`
+	want := `palette = "p"
+[canvas]
+pixels = """
+gg
+"""
+
+[sprite.hero]
+pixels = """
+e[skin]_
+--
+exe
+"""
+
+[sprite.hero.meta]
+note = """
+[sprite.other]
+g
+"""
+
+[sprite."a.b"]
+pixels = "[ee][ee]"
+
+[[sprite.walk.frame]]
+pixels = '''
+e_
+'''
+`
+	var sections []string
+	got, n := RekeySource([]byte(in), func(sprite string) map[string]string {
+		sections = append(sections, sprite)
+		switch sprite {
+		case "":
+			return nil
+		case "a.b":
+			return map[string]string{"g": "ee"}
+		}
+		return map[string]string{"g": "e", "sk": "skin"}
+	})
+	if string(got) != want || n != 7 {
+		t.Errorf("got %d changes:\n%s\nwant 7:\n%s", n, got, want)
+	}
+	if want := []string{"", "hero", "a.b", "walk"}; !slices.Equal(sections, want) {
+		t.Errorf("sections = %q, want %q", sections, want)
+	}
+}
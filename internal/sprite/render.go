@@ -3,12 +3,17 @@ package sprite
 import (
 	"fmt"
 	"image"
+	"image/draw"
 	"image/png"
-	"os"
-	"path/filepath"
+	"io"
+
+	"github.com/vgalaktionov/runefact/internal/atomicfile"
+	"github.com/vgalaktionov/runefact/internal/palette"
 )
 
-// SpriteInfo holds metadata about a sprite's position in the sheet.
+// SpriteInfo holds metadata about a sprite's position in the sheet. Frame
+// i is the W x H region at X + i*W, Y. In the grid layout W and H are the
+// cell size, and a smaller sprite sits in the top-left corner of its cells.
 type SpriteInfo struct {
 	Sheet  string `json:"sheet"`
 	X      int    `json:"x"`
@@ -17,6 +22,23 @@ type SpriteInfo struct {
 	H      int    `json:"h"`
 	Frames int    `json:"frames"`
 	FPS    int    `json:"fps"`
+
+	// Playback is "loop", "once" or "pingpong".
+	Playback string `json:"playback"`
+
+	// PivotX and PivotY are the sprite's anchor point; 0, 0 (the top-left
+	// corner) if it has none.
+	PivotX int `json:"pivot_x"`
+	PivotY int `json:"pivot_y"`
+
+	// Events maps 0-based frame indices to the events fired on them.
+	Events map[int][]string `json:"events,omitempty"`
+
+	// Hitboxes are the sprite's hurt and hit rectangles, relative to each
+	// frame's top-left corner.
+	Hitboxes []Hitbox `json:"hitboxes,omitempty"`
+
+	Meta map[string]any `json:"meta,omitempty"`
 }
 
 // SpriteSheetMeta contains metadata for all sprites in a sheet.
@@ -25,64 +47,166 @@ type SpriteSheetMeta struct {
 	Sprites   map[string]SpriteInfo
 }
 
-// RenderSpriteSheet renders resolved sprites into a sprite sheet image.
-// Layout: frames horizontal per sprite, sprites stacked vertically.
-func RenderSpriteSheet(sprites []ResolvedSprite) (*image.RGBA, SpriteSheetMeta, error) {
+// RenderSpriteSheet renders resolved sprites into a sprite sheet image
+// with the default rows layout: frames horizontal per sprite, sprites
+// stacked vertically. With a color key the sheet is opaque; see KeyColor.
+func RenderSpriteSheet(sprites []ResolvedSprite, key *palette.Color) (*image.RGBA, SpriteSheetMeta, error) {
+	return RenderSheet(sprites, key, SheetOptions{})
+}
+
+// RenderSheet renders resolved sprites into a sprite sheet image laid out
+// as opts asks. Space no frame covers is transparent, or the key color
+// with a color key.
+func RenderSheet(sprites []ResolvedSprite, key *palette.Color, opts SheetOptions) (*image.RGBA, SpriteSheetMeta, error) {
 	if len(sprites) == 0 {
 		return nil, SpriteSheetMeta{}, fmt.Errorf("no sprites to render")
 	}
-
-	// Calculate sheet dimensions.
-	maxWidth := 0
-	totalHeight := 0
-	for _, s := range sprites {
-		frameWidth := s.Grid.W * len(s.Frames)
-		if frameWidth > maxWidth {
-			maxWidth = frameWidth
-		}
-		totalHeight += s.Grid.H
+	slots, w, h, err := layoutSheet(sprites, opts)
+	if err != nil {
+		return nil, SpriteSheetMeta{}, err
 	}
 
-	img := image.NewRGBA(image.Rect(0, 0, maxWidth, totalHeight))
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	if key != nil {
+		draw.Draw(img, img.Bounds(), image.NewUniform(key.ToRGBA()), image.Point{}, draw.Src)
+	}
 	meta := SpriteSheetMeta{Sprites: make(map[string]SpriteInfo)}
 
-	y := 0
-	for _, s := range sprites {
+	for i, s := range sprites {
+		sl := slots[i]
 		for frameIdx, frame := range s.Frames {
-			xOff := frameIdx * s.Grid.W
+			xOff := sl.x + frameIdx*sl.w
 			for py, row := range frame.Pixels {
 				for px, c := range row {
-					img.Set(xOff+px, y+py, c.ToRGBA())
+					img.SetRGBA(xOff+px, sl.y+py, KeyColor(c, key).ToRGBA())
 				}
 			}
 		}
-		meta.Sprites[s.Name] = SpriteInfo{
-			X:      0,
-			Y:      y,
-			W:      s.Grid.W,
-			H:      s.Grid.H,
-			Frames: len(s.Frames),
-			FPS:    s.Framerate,
+		info := SpriteInfo{
+			X:        sl.x,
+			Y:        sl.y,
+			W:        sl.w,
+			H:        sl.h,
+			Frames:   len(s.Frames),
+			FPS:      s.Framerate,
+			Playback: s.Playback,
+			Meta:     s.Meta,
+			Events:   s.Events,
+			Hitboxes: s.Hitboxes,
+		}
+		if s.Pivot != nil {
+			info.PivotX, info.PivotY = s.Pivot.X, s.Pivot.Y
 		}
-		y += s.Grid.H
+		meta.Sprites[s.Name] = info
 	}
 
 	return img, meta, nil
 }
 
-// WritePNG encodes an image as PNG and writes it to path, creating directories as needed.
-func WritePNG(img image.Image, path string) error {
-	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
-		return fmt.Errorf("creating output directory: %w", err)
+// KeyColor returns the color c is drawn in for engines that use a color key
+// instead of alpha: key where c is fully transparent, and c made opaque
+// elsewhere, since a key can't express partial transparency. A nil key
+// returns c unchanged.
+func KeyColor(c palette.Color, key *palette.Color) palette.Color {
+	switch {
+	case key == nil:
+		return c
+	case c.A == 0:
+		return palette.Color{R: key.R, G: key.G, B: key.B, A: 255}
+	default:
+		c.A = 255
+		return c
 	}
-	f, err := os.Create(path)
-	if err != nil {
-		return fmt.Errorf("creating PNG file: %w", err)
+}
+
+// RenderFrame renders a single frame of a sprite at an integer scale,
+// upscaled with ScaleImage. A color key works as in RenderSpriteSheet.
+func RenderFrame(s ResolvedSprite, frame, scale int, key *palette.Color) (*image.RGBA, error) {
+	if frame < 0 || frame >= len(s.Frames) {
+		return nil, fmt.Errorf("sprite %q has no frame %d", s.Name, frame)
+	}
+	if scale < 1 {
+		return nil, fmt.Errorf("scale must be at least 1, got %d", scale)
 	}
-	defer f.Close()
 
-	if err := png.Encode(f, img); err != nil {
-		return fmt.Errorf("encoding PNG: %w", err)
+	img := image.NewRGBA(image.Rect(0, 0, s.Grid.W, s.Grid.H))
+	for py, row := range s.Frames[frame].Pixels {
+		for px, c := range row {
+			img.Set(px, py, KeyColor(c, key).ToRGBA())
+		}
+	}
+	if scale > 1 {
+		img = ScaleImage(img, scale)
+	}
+	return img, nil
+}
+
+// ScaleImage returns img upscaled by an integer factor with nearest-neighbor
+// sampling, so every source pixel becomes a factor x factor block.
+func ScaleImage(img *image.RGBA, factor int) *image.RGBA {
+	b := img.Bounds()
+	out := image.NewRGBA(image.Rect(0, 0, b.Dx()*factor, b.Dy()*factor))
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			c := img.RGBAAt(b.Min.X+x, b.Min.Y+y)
+			for dy := 0; dy < factor; dy++ {
+				for dx := 0; dx < factor; dx++ {
+					out.SetRGBA(x*factor+dx, y*factor+dy, c)
+				}
+			}
+		}
+	}
+	return out
+}
+
+// FrameAt returns the frame of an animation of frames frames shown at
+// step n, following its playback mode: loop wraps, once holds the last
+// frame and pingpong runs back down to the first.
+func FrameAt(playback string, frames, n int) int {
+	if frames <= 1 {
+		return 0
+	}
+	n = max(n, 0)
+	switch playback {
+	case PlaybackOnce:
+		return min(n, frames-1)
+	case PlaybackPingPong:
+		period := 2*frames - 2
+		n %= period
+		if n >= frames {
+			n = period - n
+		}
+		return n
+	default:
+		return n % frames
+	}
+}
+
+// DrawScaled draws src stretched over r in dst using nearest-neighbor,
+// skipping transparent pixels and any part of r outside dst.
+func DrawScaled(dst, src *image.RGBA, r image.Rectangle) {
+	if r.Empty() {
+		return
+	}
+	sb := src.Bounds()
+	clip := r.Intersect(dst.Bounds())
+	for py := clip.Min.Y; py < clip.Max.Y; py++ {
+		sy := sb.Min.Y + (py-r.Min.Y)*sb.Dy()/r.Dy()
+		for px := clip.Min.X; px < clip.Max.X; px++ {
+			c := src.RGBAAt(sb.Min.X+(px-r.Min.X)*sb.Dx()/r.Dx(), sy)
+			if c.A == 0 {
+				continue
+			}
+			dst.SetRGBA(px, py, c)
+		}
+	}
+}
+
+// WritePNG encodes an image as PNG and writes it to path, creating directories as needed.
+// The file is replaced atomically, so a failed write leaves the old file, if any.
+func WritePNG(img image.Image, path string) error {
+	if err := atomicfile.Write(path, 0644, func(w io.Writer) error { return png.Encode(w, img) }); err != nil {
+		return fmt.Errorf("writing PNG: %w", err)
 	}
 	return nil
 }
@@ -26,7 +26,7 @@ func TestRenderSpriteSheet_SingleStatic(t *testing.T) {
 		},
 	}
 
-	img, meta, err := RenderSpriteSheet(sprites)
+	img, meta, err := RenderSpriteSheet(sprites, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -57,6 +57,47 @@ func TestRenderSpriteSheet_SingleStatic(t *testing.T) {
 	}
 }
 
+func TestRenderSpriteSheet_ColorKey(t *testing.T) {
+	red := palette.Color{R: 255, A: 255}
+	faint := palette.Color{G: 255, A: 128}
+	trans := palette.Color{A: 0}
+	key := &palette.Color{R: 255, B: 255, A: 255}
+
+	sprites := []ResolvedSprite{
+		{
+			Name:   "dot",
+			Grid:   Grid{W: 2, H: 2},
+			Frames: []ResolvedFrame{{Pixels: [][]palette.Color{{red, trans}, {faint, red}}}},
+		},
+		{
+			Name:   "wide",
+			Grid:   Grid{W: 3, H: 1},
+			Frames: []ResolvedFrame{{Pixels: [][]palette.Color{{red, red, red}}}},
+		},
+	}
+
+	img, _, err := RenderSpriteSheet(sprites, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		x, y int
+		want palette.Color
+	}{
+		{0, 0, red},
+		{1, 0, *key},                          // transparent pixel
+		{0, 1, palette.Color{G: 255, A: 255}}, // alpha dropped
+		{2, 0, *key},                          // padding right of the narrower sprite
+	} {
+		r, g, b, a := img.At(tt.x, tt.y).RGBA()
+		got := palette.Color{R: uint8(r >> 8), G: uint8(g >> 8), B: uint8(b >> 8), A: uint8(a >> 8)}
+		if got != tt.want {
+			t.Errorf("pixel %d,%d = %+v, want %+v", tt.x, tt.y, got, tt.want)
+		}
+	}
+}
+
 func TestRenderSpriteSheet_Animated(t *testing.T) {
 	red := palette.Color{R: 255, A: 255}
 	blue := palette.Color{B: 255, A: 255}
@@ -73,7 +114,7 @@ func TestRenderSpriteSheet_Animated(t *testing.T) {
 		},
 	}
 
-	img, meta, err := RenderSpriteSheet(sprites)
+	img, meta, err := RenderSpriteSheet(sprites, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -121,7 +162,7 @@ func TestRenderSpriteSheet_MultipleSprites(t *testing.T) {
 		},
 	}
 
-	img, meta, err := RenderSpriteSheet(sprites)
+	img, meta, err := RenderSpriteSheet(sprites, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -142,7 +183,7 @@ func TestRenderSpriteSheet_MultipleSprites(t *testing.T) {
 }
 
 func TestRenderSpriteSheet_Empty(t *testing.T) {
-	_, _, err := RenderSpriteSheet(nil)
+	_, _, err := RenderSpriteSheet(nil, nil)
 	if err == nil {
 		t.Fatal("expected error for empty sprites")
 	}
@@ -160,7 +201,7 @@ func TestWritePNG(t *testing.T) {
 		},
 	}
 
-	img, _, err := RenderSpriteSheet(sprites)
+	img, _, err := RenderSpriteSheet(sprites, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -185,3 +226,38 @@ func TestWritePNG(t *testing.T) {
 		t.Errorf("decoded size = %v", decoded.Bounds())
 	}
 }
+
+func TestRenderFrame_Scale(t *testing.T) {
+	red := palette.Color{R: 255, A: 255}
+	key := palette.Color{R: 255, B: 255, A: 255}
+	s := ResolvedSprite{
+		Name: "dot",
+		Grid: Grid{W: 2, H: 1},
+		Frames: []ResolvedFrame{
+			{Pixels: [][]palette.Color{{red, {}}}},
+		},
+	}
+
+	img, err := RenderFrame(s, 0, 3, &key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 6 || b.Dy() != 3 {
+		t.Fatalf("size = %dx%d, want 6x3", b.Dx(), b.Dy())
+	}
+	for y := range 3 {
+		for x := range 6 {
+			want := red.ToRGBA()
+			if x >= 3 {
+				want = key.ToRGBA()
+			}
+			if got := img.RGBAAt(x, y); got != want {
+				t.Errorf("pixel %d,%d = %v, want %v", x, y, got, want)
+			}
+		}
+	}
+
+	if _, err := RenderFrame(s, 1, 1, nil); err == nil {
+		t.Error("expected an error for a missing frame")
+	}
+}
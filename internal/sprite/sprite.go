@@ -2,12 +2,18 @@ package sprite
 
 import (
 	"fmt"
+	"math"
 	"os"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	toml "github.com/pelletier/go-toml/v2"
 
 	"github.com/vgalaktionov/runefact/internal/palette"
+	"github.com/vgalaktionov/runefact/internal/tomlsrc"
 )
 
 // Grid represents sprite dimensions (width x height).
@@ -26,6 +32,94 @@ type Sprite struct {
 	Grid      Grid
 	Framerate int
 	Frames    []Frame
+
+	// Playback is how the animation runs: PlaybackLoop (the default),
+	// PlaybackOnce or PlaybackPingPong.
+	Playback string
+
+	// Palette names a palette to use instead of the file's, "" for the
+	// file's own. The file's palette_extend still applies.
+	Palette string
+
+	// ExportFrames requests individual frame PNGs alongside the sheet.
+	ExportFrames bool
+
+	// Compose lists parts stacked bottom-to-top to form this sprite, each a
+	// sprite name in the same file or a "file:sprite" reference.
+	Compose []string
+	// Standalone keeps a sprite in the output even when it is used as a
+	// compose part.
+	Standalone bool
+
+	// From names the sprite this one is a transformed copy of, a sprite in
+	// the same file or a "file:sprite" reference. The copy is mirrored as
+	// FlipX and FlipY ask, then turned clockwise by Rotate degrees (0, 90,
+	// 180 or 270).
+	From         string
+	FlipX, FlipY bool
+	Rotate       int
+
+	// Regions are the rectangles of the file's canvas the frames were cut
+	// from, one per frame; nil for sprites drawn with pixels.
+	Regions []Region
+
+	// Meta is the sprite's [sprite.NAME.meta] table as decoded, for game
+	// data like hitboxes. It is passed through to the manifest unchecked.
+	Meta map[string]any
+
+	// Pivot is the point the sprite is anchored by, nil if unset. A named
+	// pivot on a composed sprite is placed once its parts are resolved.
+	Pivot *Pivot
+
+	// Events maps 0-based frame indices to the game events fired when the
+	// frame is shown, such as "footstep".
+	Events map[int][]string
+
+	// Hitboxes are the sprite's hurt and hit rectangles, from its
+	// [[sprite.NAME.hitbox]] tables.
+	Hitboxes []Hitbox
+}
+
+// Animation playback modes.
+const (
+	PlaybackLoop     = "loop"     // restart from the first frame
+	PlaybackOnce     = "once"     // stop on the last frame
+	PlaybackPingPong = "pingpong" // run forward, then back, and repeat
+)
+
+// Pivot is a sprite's anchor point in pixels from its top-left corner.
+// Anchor is the name it was given as ("center", "bottom-center"), if any.
+type Pivot struct {
+	Anchor string
+	X, Y   int
+}
+
+// Hitbox is a rectangle of a sprite in pixels from its top-left corner
+// that takes damage (HitboxHurt) or deals it (HitboxHit), on one frame or
+// on all of them.
+type Hitbox struct {
+	X    int    `json:"x"`
+	Y    int    `json:"y"`
+	W    int    `json:"w"`
+	H    int    `json:"h"`
+	Type string `json:"type"`
+
+	// Frame is the 0-based frame the box is on, or AllFrames.
+	Frame int `json:"frame"`
+}
+
+// Hitbox types.
+const (
+	HitboxHurt = "hurt" // where the sprite can be hit
+	HitboxHit  = "hit"  // where the sprite hits others
+)
+
+// AllFrames is the Frame of a hitbox that applies to every frame.
+const AllFrames = -1
+
+// OnFrame reports whether the box applies to frame.
+func (h Hitbox) OnFrame(frame int) bool {
+	return h.Frame == AllFrames || h.Frame == frame
 }
 
 // SpriteFile represents a parsed .sprite file.
@@ -34,6 +128,10 @@ type SpriteFile struct {
 	PaletteExtend map[string]string
 	DefaultGrid   Grid
 	Sprites       []Sprite
+
+	// MaxFromDepth caps how many from links a chain of derived sprites
+	// may have; 0 means DefaultMaxFromDepth. It isn't part of the file.
+	MaxFromDepth int
 }
 
 // ResolvedSprite has palette keys replaced with actual colors.
@@ -42,6 +140,15 @@ type ResolvedSprite struct {
 	Grid      Grid
 	Framerate int
 	Frames    []ResolvedFrame
+	Playback  string
+
+	// ExportFrames requests individual frame PNGs alongside the sheet.
+	ExportFrames bool
+
+	Meta     map[string]any
+	Pivot    *Pivot
+	Events   map[int][]string
+	Hitboxes []Hitbox
 }
 
 // ResolvedFrame contains color-resolved pixel data.
@@ -49,37 +156,71 @@ type ResolvedFrame struct {
 	Pixels [][]palette.Color
 }
 
+// maxGridSize is the most rows or columns a pixel grid may have, and
+// maxFrames the most frames a pixels block may split into. They keep a
+// runaway pixels string from exhausting memory.
+const (
+	maxGridSize = 4096
+	maxFrames   = 4096
+)
+
 // ParsePixelGrid parses a pixel grid string into a 2D array of palette keys.
+// Each character is a key, and so is each name in brackets like "[sky]".
 func ParsePixelGrid(raw string) ([][]string, error) {
-	lines := strings.Split(strings.TrimSpace(raw), "\n")
 	var grid [][]string
 	var expectedWidth int
 
-	for lineNum, line := range lines {
-		line = strings.TrimRight(line, " \t\r")
+	rest := strings.TrimSpace(raw)
+	for lineNum := 1; rest != ""; lineNum++ {
+		var line string
+		line, rest = tomlsrc.NextLine(rest)
+		line = strings.TrimRight(line, " \t")
 		if line == "" {
 			continue
 		}
+		if len(grid) == maxGridSize {
+			return nil, fmt.Errorf("line %d: grid has more than %d rows", lineNum, maxGridSize)
+		}
 		row, err := parseGridRow(line)
 		if err != nil {
-			return nil, fmt.Errorf("line %d: %w", lineNum+1, err)
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
 		}
 		if len(grid) == 0 {
 			expectedWidth = len(row)
 		} else if len(row) != expectedWidth {
-			return nil, fmt.Errorf("line %d: ragged row, expected width %d, got %d", lineNum+1, expectedWidth, len(row))
+			return nil, fmt.Errorf("line %d: ragged row, expected width %d, got %d", lineNum, expectedWidth, len(row))
 		}
 		grid = append(grid, row)
 	}
 	return grid, nil
 }
 
+// splitFrames splits a pixels block into frames at every line that is just
+// "--". A block without separators is a single frame. It stops after
+// maxFrames+1 frames, so the caller can report a block with too many.
+func splitFrames(raw string) []string {
+	var frames []string
+	start, rest := 0, raw
+	for rest != "" && len(frames) <= maxFrames {
+		line, next := tomlsrc.NextLine(rest)
+		if strings.TrimSpace(line) == "--" {
+			frames = append(frames, raw[start:len(raw)-len(rest)])
+			start = len(raw) - len(next)
+		}
+		rest = next
+	}
+	return append(frames, raw[start:])
+}
+
 func parseGridRow(line string) ([]string, error) {
 	var row []string
 	i := 0
 	for i < len(line) {
+		if len(row) == maxGridSize {
+			return nil, fmt.Errorf("row has more than %d columns", maxGridSize)
+		}
 		if line[i] == '[' {
-			end := strings.Index(line[i:], "]")
+			end := strings.IndexByte(line[i:], ']')
 			if end == -1 {
 				return nil, fmt.Errorf("unclosed bracket at position %d", i)
 			}
@@ -89,10 +230,15 @@ func parseGridRow(line string) ([]string, error) {
 			}
 			row = append(row, key)
 			i += end + 1
-		} else {
-			row = append(row, string(line[i]))
-			i++
+			continue
+		}
+		// A key is a whole character, not a byte of one.
+		r, size := utf8.DecodeRuneInString(line[i:])
+		if r == utf8.RuneError && size == 1 {
+			return nil, fmt.Errorf("invalid UTF-8 at position %d", i)
 		}
+		row = append(row, line[i:i+size])
+		i += size
 	}
 	return row, nil
 }
@@ -102,23 +248,55 @@ type rawSpriteFile struct {
 	Palette       string            `toml:"palette"`
 	Grid          interface{}       `toml:"grid"` // int or string "WxH"
 	PaletteExtend map[string]string `toml:"palette_extend"`
+	Canvas        *rawCanvas        `toml:"canvas"`
 	Sprite        map[string]rawSprite
 }
 
+// rawCanvas is a file's [canvas] table: one drawing that sprites cut their
+// frames from with region.
+type rawCanvas struct {
+	Pixels string `toml:"pixels"`
+}
+
 type rawSprite struct {
 	Grid          interface{}       `toml:"grid"`
 	Framerate     int               `toml:"framerate"`
+	Playback      string            `toml:"playback"`
+	Palette       string            `toml:"palette"`
 	Pixels        string            `toml:"pixels"`
+	FrameCount    int               `toml:"frame_count"`
 	PaletteExtend map[string]string `toml:"palette_extend"`
 	Frame         []rawFrame        `toml:"frame"`
+	ExportFrames  bool              `toml:"frames"`
+	Compose       []string          `toml:"compose"`
+	Standalone    bool              `toml:"standalone"`
+	From          string            `toml:"from"`
+	FlipX         bool              `toml:"flip_x"`
+	FlipY         bool              `toml:"flip_y"`
+	Rotate        int               `toml:"rotate"`
+	Region        any               `toml:"region"` // {x, y, w, h} or a list of them
+	Meta          map[string]any    `toml:"meta"`
+	Pivot         any               `toml:"pivot"` // anchor name or {x, y}
+	Events        map[string]any    `toml:"events"`
+	Hitbox        []rawHitbox       `toml:"hitbox"`
 }
 
 type rawFrame struct {
 	Pixels string `toml:"pixels"`
 }
 
+type rawHitbox struct {
+	X     int    `toml:"x"`
+	Y     int    `toml:"y"`
+	W     int    `toml:"w"`
+	H     int    `toml:"h"`
+	Type  string `toml:"type"`
+	Frame *int   `toml:"frame"`
+}
+
 // ParseSpriteFile parses .sprite file content.
 func ParseSpriteFile(data []byte, filename string) (*SpriteFile, error) {
+	data = tomlsrc.Normalize(data)
 	var raw rawSpriteFile
 	if err := toml.Unmarshal(data, &raw); err != nil {
 		return nil, fmt.Errorf("%s: %w", filename, err)
@@ -135,8 +313,15 @@ func ParseSpriteFile(data []byte, filename string) (*SpriteFile, error) {
 		DefaultGrid:   defaultGrid,
 	}
 
-	for name, rs := range raw.Sprite {
-		sprite, err := parseSprite(name, rs, defaultGrid, filename)
+	var canvas [][]string
+	if raw.Canvas != nil {
+		if canvas, err = ParsePixelGrid(raw.Canvas.Pixels); err != nil {
+			return nil, fmt.Errorf("%s: canvas: %w", filename, err)
+		}
+	}
+
+	for _, name := range tomlsrc.Order(data, "sprite", raw.Sprite) {
+		sprite, err := parseSprite(name, raw.Sprite[name], defaultGrid, canvas, filename)
 		if err != nil {
 			return nil, err
 		}
@@ -146,7 +331,7 @@ func ParseSpriteFile(data []byte, filename string) (*SpriteFile, error) {
 	return sf, nil
 }
 
-func parseSprite(name string, raw rawSprite, defaultGrid Grid, filename string) (*Sprite, error) {
+func parseSprite(name string, raw rawSprite, defaultGrid Grid, canvas [][]string, filename string) (*Sprite, error) {
 	grid, err := parseGrid(raw.Grid)
 	if err != nil {
 		return nil, fmt.Errorf("%s: sprite %q: %w", filename, name, err)
@@ -159,15 +344,122 @@ func parseSprite(name string, raw rawSprite, defaultGrid Grid, filename string)
 		Name:      name,
 		Grid:      grid,
 		Framerate: raw.Framerate,
+		Playback:  raw.Playback,
+		Palette:   raw.Palette,
+
+		ExportFrames: raw.ExportFrames,
+		Compose:      raw.Compose,
+		Standalone:   raw.Standalone,
+		Meta:         raw.Meta,
+
+		From:   raw.From,
+		FlipX:  raw.FlipX,
+		FlipY:  raw.FlipY,
+		Rotate: raw.Rotate,
 	}
 
-	if raw.Pixels != "" {
-		// Static sprite: single frame.
-		pixels, err := ParsePixelGrid(raw.Pixels)
-		if err != nil {
+	if err := checkMeta(raw.Meta); err != nil {
+		return nil, fmt.Errorf("%s: sprite %q: meta: %w", filename, name, err)
+	}
+	switch s.Playback {
+	case "":
+		s.Playback = PlaybackLoop
+	case PlaybackLoop, PlaybackOnce, PlaybackPingPong:
+	default:
+		return nil, fmt.Errorf("%s: sprite %q: playback %q must be \"loop\", \"once\" or \"pingpong\"", filename, name, s.Playback)
+	}
+	if s.Pivot, err = parsePivot(raw.Pivot); err != nil {
+		return nil, fmt.Errorf("%s: sprite %q: %w", filename, name, err)
+	}
+	if s.Events, err = parseEvents(raw.Events); err != nil {
+		return nil, fmt.Errorf("%s: sprite %q: %w", filename, name, err)
+	}
+	if s.Hitboxes, err = parseHitboxes(raw.Hitbox); err != nil {
+		return nil, fmt.Errorf("%s: sprite %q: %w", filename, name, err)
+	}
+
+	if raw.From == "" && (raw.FlipX || raw.FlipY || raw.Rotate != 0) {
+		return nil, fmt.Errorf("%s: sprite %q: flip_x, flip_y and rotate need from, the sprite to transform", filename, name)
+	}
+	if raw.From != "" {
+		// Derived sprite: frames come from the source at resolve time.
+		if raw.Pixels != "" || len(raw.Frame) > 0 || raw.FrameCount > 0 || len(raw.Compose) > 0 || raw.Region != nil {
+			return nil, fmt.Errorf("%s: sprite %q: from cannot be combined with pixels, frames, region or compose", filename, name)
+		}
+		if raw.Palette != "" {
+			return nil, fmt.Errorf("%s: sprite %q: a sprite made with from takes its colors from its source, set palette there instead", filename, name)
+		}
+		switch raw.Rotate {
+		case 0, 90, 180, 270:
+		default:
+			return nil, fmt.Errorf("%s: sprite %q: rotate must be 0, 90, 180 or 270, got %d", filename, name, raw.Rotate)
+		}
+		if raw.Grid == nil {
+			s.Grid = Grid{}
+		}
+		if raw.Playback == "" {
+			s.Playback = "" // inherited from the source
+		}
+		return s, nil
+	}
+
+	if len(raw.Compose) > 0 {
+		// Composed sprite: frames come from its parts at resolve time.
+		if raw.Pixels != "" || len(raw.Frame) > 0 || raw.FrameCount > 0 || raw.Region != nil {
+			return nil, fmt.Errorf("%s: sprite %q: compose cannot be combined with pixels, frames or region", filename, name)
+		}
+		if raw.Palette != "" {
+			return nil, fmt.Errorf("%s: sprite %q: a composed sprite takes its colors from its parts, set palette on them instead", filename, name)
+		}
+		if raw.Grid == nil {
+			s.Grid = Grid{}
+		}
+		return s, nil
+	}
+
+	if raw.Pixels != "" && len(raw.Frame) > 0 {
+		return nil, fmt.Errorf("%s: sprite %q: pixels cannot be combined with [[frame]] tables, use one or the other", filename, name)
+	}
+	if raw.Region != nil {
+		// Region sprite: frames are cut from the file's canvas.
+		if raw.Pixels != "" || len(raw.Frame) > 0 {
+			return nil, fmt.Errorf("%s: sprite %q: region cannot be combined with pixels or frames", filename, name)
+		}
+		if canvas == nil {
+			return nil, fmt.Errorf("%s: sprite %q: region needs a [canvas] with pixels in the file", filename, name)
+		}
+		if s.Regions, err = parseRegions(raw.Region, s.Grid); err != nil {
 			return nil, fmt.Errorf("%s: sprite %q: %w", filename, name, err)
 		}
-		s.Frames = []Frame{{Pixels: pixels}}
+		for i, r := range s.Regions {
+			pixels, err := r.crop(canvas)
+			if err != nil {
+				if len(s.Regions) == 1 {
+					return nil, fmt.Errorf("%s: sprite %q: region %w", filename, name, err)
+				}
+				return nil, fmt.Errorf("%s: sprite %q: region %d %w", filename, name, i+1, err)
+			}
+			s.Frames = append(s.Frames, Frame{Pixels: pixels})
+		}
+	} else if raw.Pixels != "" {
+		// Static sprite, or frames separated by "--" lines.
+		blocks := splitFrames(raw.Pixels)
+		if len(blocks) > maxFrames {
+			return nil, fmt.Errorf("%s: sprite %q: more than %d frames", filename, name, maxFrames)
+		}
+		for i, block := range blocks {
+			pixels, err := ParsePixelGrid(block)
+			if err != nil {
+				if len(blocks) == 1 {
+					return nil, fmt.Errorf("%s: sprite %q: %w", filename, name, err)
+				}
+				return nil, fmt.Errorf("%s: sprite %q frame %d: %w", filename, name, i+1, err)
+			}
+			if len(pixels) == 0 && len(blocks) > 1 {
+				return nil, fmt.Errorf("%s: sprite %q: frame %d is empty, check the \"--\" separators", filename, name, i+1)
+			}
+			s.Frames = append(s.Frames, Frame{Pixels: pixels})
+		}
 	} else if len(raw.Frame) > 0 {
 		// Animated sprite: multiple frames.
 		for i, f := range raw.Frame {
@@ -183,10 +475,182 @@ func parseSprite(name string, raw rawSprite, defaultGrid Grid, filename string)
 	if err := validateFrames(s, filename); err != nil {
 		return nil, err
 	}
+	if raw.FrameCount > 0 && raw.FrameCount != len(s.Frames) {
+		return nil, fmt.Errorf("%s: sprite %q: frame_count is %d but the sprite has %d frame(s)", filename, name, raw.FrameCount, len(s.Frames))
+	}
+
+	if s.Pivot != nil && len(s.Frames) > 0 {
+		if s.Pivot, err = placePivot(s.Pivot, s.Grid); err != nil {
+			return nil, fmt.Errorf("%s: sprite %q: %w", filename, name, err)
+		}
+	}
+	if err := checkEvents(s.Events, len(s.Frames)); err != nil {
+		return nil, fmt.Errorf("%s: sprite %q: %w", filename, name, err)
+	}
+	if err := checkHitboxes(s.Hitboxes, s.Grid, len(s.Frames)); err != nil {
+		return nil, fmt.Errorf("%s: sprite %q: %w", filename, name, err)
+	}
 
 	return s, nil
 }
 
+// parseEvents parses an events table: frame index to an event name or a
+// list of them.
+func parseEvents(raw map[string]any) (map[int][]string, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	events := make(map[int][]string, len(raw))
+	for key, v := range raw {
+		frame, err := strconv.Atoi(key)
+		if err != nil || frame < 0 {
+			return nil, fmt.Errorf("events: %q is not a frame index", key)
+		}
+		switch v := v.(type) {
+		case string:
+			events[frame] = []string{v}
+		case []any:
+			for _, e := range v {
+				name, ok := e.(string)
+				if !ok {
+					return nil, fmt.Errorf("events: frame %d: %v is not a string", frame, e)
+				}
+				events[frame] = append(events[frame], name)
+			}
+		default:
+			return nil, fmt.Errorf("events: frame %d must be an event name or a list of them", frame)
+		}
+	}
+	return events, nil
+}
+
+// checkEvents reports events on frames the sprite doesn't have.
+func checkEvents(events map[int][]string, frames int) error {
+	var bad []int
+	for frame := range events {
+		if frame >= frames {
+			bad = append(bad, frame)
+		}
+	}
+	if len(bad) == 0 {
+		return nil
+	}
+	sort.Ints(bad)
+	return fmt.Errorf("events: frame %d is out of range, the sprite has %d frame(s) numbered from 0", bad[0], frames)
+}
+
+// parseHitboxes parses [[hitbox]] tables, checking what can be checked
+// without the sprite's grid and frames; see checkHitboxes.
+func parseHitboxes(raw []rawHitbox) ([]Hitbox, error) {
+	var boxes []Hitbox
+	for i, r := range raw {
+		h := Hitbox{X: r.X, Y: r.Y, W: r.W, H: r.H, Type: r.Type, Frame: AllFrames}
+		if r.Type != HitboxHurt && r.Type != HitboxHit {
+			return nil, fmt.Errorf("hitbox %d: type %q must be \"hurt\" or \"hit\"", i+1, r.Type)
+		}
+		if r.W < 1 || r.H < 1 {
+			return nil, fmt.Errorf("hitbox %d: size %dx%d must be positive", i+1, r.W, r.H)
+		}
+		if r.Frame != nil {
+			if *r.Frame < 0 {
+				return nil, fmt.Errorf("hitbox %d: frame %d is not a frame index", i+1, *r.Frame)
+			}
+			h.Frame = *r.Frame
+		}
+		boxes = append(boxes, h)
+	}
+	return boxes, nil
+}
+
+// checkHitboxes reports hitboxes that stick out of grid g or are on
+// frames the sprite doesn't have.
+func checkHitboxes(boxes []Hitbox, g Grid, frames int) error {
+	for i, h := range boxes {
+		if h.X < 0 || h.Y < 0 || h.X+h.W > g.W || h.Y+h.H > g.H {
+			return fmt.Errorf("hitbox %d: %dx%d at %d,%d is outside the %dx%d grid", i+1, h.W, h.H, h.X, h.Y, g.W, g.H)
+		}
+		if h.Frame >= frames {
+			return fmt.Errorf("hitbox %d: frame %d is out of range, the sprite has %d frame(s) numbered from 0", i+1, h.Frame, frames)
+		}
+	}
+	return nil
+}
+
+// parsePivot parses a pivot value: an anchor name or an {x, y} table.
+func parsePivot(v any) (*Pivot, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		if v != "center" && v != "bottom-center" {
+			return nil, fmt.Errorf("pivot %q must be \"center\", \"bottom-center\" or {x, y}", v)
+		}
+		return &Pivot{Anchor: v}, nil
+	case map[string]any:
+		p := &Pivot{}
+		for key, val := range v {
+			n, ok := val.(int64)
+			if !ok || (key != "x" && key != "y") {
+				return nil, fmt.Errorf("pivot must be {x = N, y = N}, got %s = %v", key, val)
+			}
+			if key == "x" {
+				p.X = int(n)
+			} else {
+				p.Y = int(n)
+			}
+		}
+		if _, ok := v["x"]; !ok {
+			return nil, fmt.Errorf("pivot is missing x")
+		}
+		if _, ok := v["y"]; !ok {
+			return nil, fmt.Errorf("pivot is missing y")
+		}
+		return p, nil
+	default:
+		return nil, fmt.Errorf("pivot must be \"center\", \"bottom-center\" or {x, y}, got %T", v)
+	}
+}
+
+// placePivot returns p with a named anchor placed on grid g, and checks
+// that it lies within the grid.
+func placePivot(p *Pivot, g Grid) (*Pivot, error) {
+	placed := *p
+	switch p.Anchor {
+	case "center":
+		placed.X, placed.Y = g.W/2, g.H/2
+	case "bottom-center":
+		placed.X, placed.Y = g.W/2, g.H-1
+	}
+	if placed.X < 0 || placed.Y < 0 || placed.X >= g.W || placed.Y >= g.H {
+		return nil, fmt.Errorf("pivot (%d, %d) is outside the %dx%d grid", placed.X, placed.Y, g.W, g.H)
+	}
+	return &placed, nil
+}
+
+// checkMeta rejects the only TOML values that can't be written to the
+// manifest: nan and inf.
+func checkMeta(v any) error {
+	switch v := v.(type) {
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Errorf("nan and inf are not supported")
+		}
+	case []any:
+		for _, e := range v {
+			if err := checkMeta(e); err != nil {
+				return err
+			}
+		}
+	case map[string]any:
+		for k, e := range v {
+			if err := checkMeta(e); err != nil {
+				return fmt.Errorf("%s: %w", k, err)
+			}
+		}
+	}
+	return nil
+}
+
 func parseGrid(v interface{}) (Grid, error) {
 	if v == nil {
 		return Grid{}, nil
@@ -230,12 +694,15 @@ func validateFrames(s *Sprite, filename string) error {
 		}
 	}
 
-	// Validate grid matches actual dimensions if grid is set.
+	// Validate grid matches actual dimensions if grid is set, otherwise
+	// take it from the pixels.
 	if s.Grid.W > 0 && s.Grid.H > 0 {
 		if firstW != s.Grid.W || firstH != s.Grid.H {
 			return fmt.Errorf("%s: sprite %q: pixel dimensions %dx%d don't match grid %dx%d",
 				filename, s.Name, firstW, firstH, s.Grid.W, s.Grid.H)
 		}
+	} else {
+		s.Grid = Grid{W: firstW, H: firstH}
 	}
 
 	return nil
@@ -250,15 +717,73 @@ func LoadSpriteFile(path string) (*SpriteFile, error) {
 	return ParseSpriteFile(data, path)
 }
 
-// Resolve resolves palette keys to actual colors for all sprites.
+// Resolve resolves palette keys to actual colors for all sprites. Compose
+// parts must be in the same file and sprites can't override the palette;
+// use ResolveWith for "file:sprite" parts and palette overrides.
 func (sf *SpriteFile) Resolve(pal *palette.Palette) ([]ResolvedSprite, error) {
+	return sf.ResolveWith(pal, nil, nil)
+}
+
+// ResolveWith resolves all sprites, composing them from their parts,
+// loading "file:sprite" parts through load and the palettes sprites name
+// instead of pal through pals. Sprites used only as compose parts are left
+// out of the result unless marked standalone.
+func (sf *SpriteFile) ResolveWith(pal *palette.Palette, load PartLoader, pals PaletteLoader) ([]ResolvedSprite, error) {
+	r, err := sf.newResolver(pal, load, pals)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := sf.ComposeParts()
+	var resolved []ResolvedSprite
+	for _, s := range sf.Sprites {
+		// Parts are resolved too, so their errors are reported.
+		rs, err := r.resolve(s.Name)
+		if err != nil {
+			return nil, err
+		}
+		if parts[s.Name] && !s.Standalone {
+			continue
+		}
+		resolved = append(resolved, *rs)
+	}
+	return resolved, nil
+}
+
+// ResolvePart resolves the named sprite even if it is only a compose part.
+func (sf *SpriteFile) ResolvePart(pal *palette.Palette, name string, load PartLoader, pals PaletteLoader) (*ResolvedSprite, error) {
+	r, err := sf.newResolver(pal, load, pals)
+	if err != nil {
+		return nil, err
+	}
+	return r.resolve(name)
+}
+
+// PaletteRefs returns the names of the palettes the file uses: its own,
+// then those its sprites override it with, each once.
+func (sf *SpriteFile) PaletteRefs() []string {
+	var refs []string
+	if sf.PaletteRef != "" {
+		refs = append(refs, sf.PaletteRef)
+	}
+	for _, s := range sf.Sprites {
+		if s.Palette != "" && !slices.Contains(refs, s.Palette) {
+			refs = append(refs, s.Palette)
+		}
+	}
+	return refs
+}
+
+// paletteColors merges the palette with palette_extend.
+func (sf *SpriteFile) paletteColors(pal *palette.Palette) (map[string]palette.Color, error) {
 	// Merge palette_extend into a combined color map.
 	colors := make(map[string]palette.Color, len(pal.Colors))
 	for k, v := range pal.Colors {
 		colors[k] = v
 	}
+	// An extend color can also name one of the palette's aliases or keys.
 	for k, hex := range sf.PaletteExtend {
-		c, err := palette.ParseHexColor(hex)
+		c, err := pal.Lookup(hex)
 		if err != nil {
 			return nil, fmt.Errorf("palette_extend key %q: %w", k, err)
 		}
@@ -267,16 +792,7 @@ func (sf *SpriteFile) Resolve(pal *palette.Palette) ([]ResolvedSprite, error) {
 
 	// "_" is always transparent, even if not defined in the palette.
 	colors["_"] = palette.Color{A: 0}
-
-	var resolved []ResolvedSprite
-	for _, s := range sf.Sprites {
-		rs, err := resolveSprite(s, colors)
-		if err != nil {
-			return nil, err
-		}
-		resolved = append(resolved, *rs)
-	}
-	return resolved, nil
+	return colors, nil
 }
 
 func resolveSprite(s Sprite, colors map[string]palette.Color) (*ResolvedSprite, error) {
@@ -284,6 +800,13 @@ func resolveSprite(s Sprite, colors map[string]palette.Color) (*ResolvedSprite,
 		Name:      s.Name,
 		Grid:      s.Grid,
 		Framerate: s.Framerate,
+		Playback:  s.Playback,
+
+		ExportFrames: s.ExportFrames,
+		Meta:         s.Meta,
+		Pivot:        s.Pivot,
+		Events:       s.Events,
+		Hitboxes:     s.Hitboxes,
 	}
 
 	var unknownKeys []string
@@ -1,6 +1,8 @@
 package sprite
 
 import (
+	"fmt"
+	"slices"
 	"strings"
 	"testing"
 
@@ -53,6 +55,104 @@ func TestParsePixelGrid_UnclosedBracket(t *testing.T) {
 	}
 }
 
+func TestParsePixelGrid_CRLF(t *testing.T) {
+	for _, raw := range []string{"ab\r\ncd\r\n", "ab\rcd"} {
+		grid, err := ParsePixelGrid(raw)
+		if err != nil {
+			t.Fatalf("%q: %v", raw, err)
+		}
+		if len(grid) != 2 || grid[0][1] != "b" || grid[1][1] != "d" {
+			t.Errorf("%q: got %q, want [[a b] [c d]]", raw, grid)
+		}
+	}
+}
+
+func TestParsePixelGrid_UTF8(t *testing.T) {
+	grid, err := ParsePixelGrid("é[ü]a\n日本b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"é", "ü", "a"}, {"日", "本", "b"}}
+	if !slices.EqualFunc(grid, want, slices.Equal) {
+		t.Errorf("got %q, want %q", grid, want)
+	}
+	if _, err := ParsePixelGrid("a\xffb"); err == nil || !strings.Contains(err.Error(), "invalid UTF-8 at position 1") {
+		t.Errorf("err = %v, want invalid UTF-8 at position 1", err)
+	}
+}
+
+func TestParsePixelGrid_Limits(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{strings.Repeat("a", maxGridSize+1), "line 1: row has more than 4096 columns"},
+		{strings.Repeat("[k]", maxGridSize+1), "row has more than 4096 columns"},
+		{strings.Repeat("a\n", maxGridSize+1), "line 4097: grid has more than 4096 rows"},
+	}
+	for _, tt := range tests {
+		_, err := ParsePixelGrid(tt.raw)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("err = %v, want %q", err, tt.want)
+		}
+	}
+	// The largest grid allowed still parses.
+	row := strings.Repeat("a", maxGridSize)
+	if _, err := ParsePixelGrid(row + "\n" + row); err != nil {
+		t.Errorf("%d columns: %v", maxGridSize, err)
+	}
+}
+
+func TestParseSpriteFile_TooManyFrames(t *testing.T) {
+	input := []byte("palette = \"default\"\ngrid = 1\n\n[sprite.s]\npixels = \"\"\"\n" +
+		strings.Repeat("r\n--\n", maxFrames) + "r\n\"\"\"\n")
+	_, err := ParseSpriteFile(input, "test.sprite")
+	if err == nil || !strings.Contains(err.Error(), "more than 4096 frames") {
+		t.Errorf("err = %v, want more than 4096 frames", err)
+	}
+}
+
+// FuzzParsePixelGrid checks that no pixels string panics, and that a grid
+// that parses is rectangular, within limits and made of non-empty keys.
+func FuzzParsePixelGrid(f *testing.F) {
+	for _, seed := range []string{
+		"ab\ncd", "a[sk]b\nc[rb]d", "ab\r\ncd\r\n", "ab\rcd", "a[skb", "[]", "é[ü]\n日本",
+		"\xff", "[\xff]", "  \n\t\n", "ab\n--\ncd",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, raw string) {
+		grid, err := ParsePixelGrid(raw)
+		if err != nil {
+			return
+		}
+		if len(grid) > maxGridSize {
+			t.Fatalf("%d rows", len(grid))
+		}
+		for _, row := range grid {
+			if len(row) != len(grid[0]) || len(row) > maxGridSize {
+				t.Fatalf("row width %d, first row %d", len(row), len(grid[0]))
+			}
+			for _, key := range row {
+				if key == "" {
+					t.Fatal("empty key")
+				}
+			}
+		}
+	})
+}
+
+func TestParseSpriteFile_BOM(t *testing.T) {
+	input := []byte("\ufeffpalette = \"default\"\r\ngrid = 2\r\n\r\n[sprite.dot]\r\npixels = \"\"\"\r\nr_\r\n_r\r\n\"\"\"\r\n")
+	sf, err := ParseSpriteFile(input, "test.sprite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if px := sf.Sprites[0].Frames[0].Pixels; px[0][0] != "r" || px[0][1] != "_" {
+		t.Errorf("pixels = %q, want no stray carriage returns", px)
+	}
+}
+
 func TestParseSpriteFile_Static(t *testing.T) {
 	input := []byte(`
 palette = "default"
@@ -88,6 +188,271 @@ mnop
 	}
 }
 
+func TestParseSpriteFile_Meta(t *testing.T) {
+	input := []byte(`
+palette = "default"
+grid = 2
+
+[sprite.hero]
+pixels = """
+ab
+cd
+"""
+
+[sprite.hero.meta]
+damage = 3
+pivot = [1, 2]
+
+[sprite.hero.meta.hitbox]
+x = 0.5
+w = 1.5
+
+[[sprite.hero.meta.events]]
+frame = 0
+name = "step"
+`)
+	sf, err := ParseSpriteFile(input, "hero.sprite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := sf.Sprites[0].Meta
+	if meta["damage"] != int64(3) {
+		t.Errorf("damage = %#v, want int64(3)", meta["damage"])
+	}
+	if hb, ok := meta["hitbox"].(map[string]any); !ok || hb["w"] != 1.5 {
+		t.Errorf("hitbox = %#v", meta["hitbox"])
+	}
+	if ev, ok := meta["events"].([]any); !ok || len(ev) != 1 {
+		t.Errorf("events = %#v", meta["events"])
+	}
+
+	pal := &palette.Palette{Colors: map[string]palette.Color{"a": {}, "b": {}, "c": {}, "d": {}}}
+	resolved, err := sf.Resolve(pal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, sheet, err := RenderSpriteSheet(resolved, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sheet.Sprites["hero"].Meta["damage"] != int64(3) {
+		t.Errorf("sheet meta = %#v", sheet.Sprites["hero"].Meta)
+	}
+
+	_, err = ParseSpriteFile([]byte("grid = 1\n[sprite.a]\npixels = \"a\"\n[sprite.a.meta]\nspeed = nan\n"), "bad.sprite")
+	if err == nil || !strings.Contains(err.Error(), "speed: nan and inf are not supported") {
+		t.Errorf("err = %v, want nan rejected", err)
+	}
+}
+
+func TestParseSpriteFile_Pivot(t *testing.T) {
+	input := []byte(`
+grid = "16x16"
+
+[sprite.tree]
+grid = "5x4"
+pivot = "bottom-center"
+pixels = """
+__a__
+_aaa_
+aaaaa
+__a__
+"""
+
+[sprite.orb]
+grid = 3
+pivot = "center"
+pixels = """
+_a_
+aaa
+_a_
+"""
+
+[sprite.flag]
+grid = 2
+pivot = { x = 1, y = 0 }
+pixels = """
+aa
+a_
+"""
+
+[sprite.plain]
+grid = 1
+pixels = "a"
+`)
+	sf, err := ParseSpriteFile(input, "test.sprite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pal := &palette.Palette{Colors: map[string]palette.Color{"a": {A: 255}}}
+	resolved, err := sf.Resolve(pal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, sheet, err := RenderSpriteSheet(resolved, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][2]int{"tree": {2, 3}, "orb": {1, 1}, "flag": {1, 0}, "plain": {0, 0}}
+	for name, w := range want {
+		info := sheet.Sprites[name]
+		if info.PivotX != w[0] || info.PivotY != w[1] {
+			t.Errorf("%s pivot = (%d, %d), want (%d, %d)", name, info.PivotX, info.PivotY, w[0], w[1])
+		}
+	}
+
+	errs := map[string]string{
+		`pivot = { x = 2, y = 0 }`:   "pivot (2, 0) is outside the 2x2 grid",
+		`pivot = { x = 1 }`:          "pivot is missing y",
+		`pivot = { x = 1.5, y = 0 }`: "pivot must be {x = N, y = N}",
+		`pivot = "feet"`:             `pivot "feet" must be`,
+		`pivot = 3`:                  "pivot must be",
+	}
+	for line, want := range errs {
+		_, err := ParseSpriteFile([]byte("grid = 2\n[sprite.a]\n"+line+"\npixels = \"\"\"\naa\naa\n\"\"\"\n"), "bad.sprite")
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: err = %v, want %q", line, err, want)
+		}
+	}
+}
+
+func TestParseSpriteFile_Events(t *testing.T) {
+	input := []byte(`
+grid = 1
+
+[sprite.walk]
+events = { 0 = "footstep", 2 = ["footstep", "dust"] }
+[[sprite.walk.frame]]
+pixels = "a"
+[[sprite.walk.frame]]
+pixels = "a"
+[[sprite.walk.frame]]
+pixels = "a"
+`)
+	sf, err := ParseSpriteFile(input, "test.sprite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pal := &palette.Palette{Colors: map[string]palette.Color{"a": {A: 255}}}
+	resolved, err := sf.Resolve(pal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, sheet, err := RenderSpriteSheet(resolved, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := sheet.Sprites["walk"].Events
+	if len(events) != 2 || events[0][0] != "footstep" || len(events[2]) != 2 || events[2][1] != "dust" {
+		t.Errorf("events = %v", events)
+	}
+
+	errs := map[string]string{
+		`events = { 3 = "x" }`:      "events: frame 3 is out of range, the sprite has 3 frame(s)",
+		`events = { a = "x" }`:      `events: "a" is not a frame index`,
+		`events = { -1 = "x" }`:     `events: "-1" is not a frame index`,
+		`events = { 0 = 1 }`:        "events: frame 0 must be an event name",
+		`events = { 0 = ["x", 2] }`: "events: frame 0: 2 is not a string",
+	}
+	for line, want := range errs {
+		src := "grid = 1\n[sprite.a]\n" + line + "\n[[sprite.a.frame]]\npixels = \"a\"\n[[sprite.a.frame]]\npixels = \"a\"\n[[sprite.a.frame]]\npixels = \"a\"\n"
+		_, err := ParseSpriteFile([]byte(src), "bad.sprite")
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: err = %v, want %q", line, err, want)
+		}
+	}
+}
+
+func TestParseSpriteFile_Hitboxes(t *testing.T) {
+	input := []byte(`
+grid = 4
+
+[sprite.slash]
+pixels = """
+aaaa
+aaaa
+aaaa
+aaaa
+--
+aaaa
+aaaa
+aaaa
+aaaa
+"""
+[[sprite.slash.hitbox]]
+x = 1
+y = 0
+w = 2
+h = 4
+type = "hurt"
+[[sprite.slash.hitbox]]
+x = 2
+y = 1
+w = 2
+h = 2
+type = "hit"
+frame = 1
+`)
+	sf, err := ParseSpriteFile(input, "test.sprite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pal := &palette.Palette{Colors: map[string]palette.Color{"a": {A: 255}}}
+	resolved, err := sf.Resolve(pal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, sheet, err := RenderSpriteSheet(resolved, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	boxes := sheet.Sprites["slash"].Hitboxes
+	want := []Hitbox{
+		{X: 1, Y: 0, W: 2, H: 4, Type: HitboxHurt, Frame: AllFrames},
+		{X: 2, Y: 1, W: 2, H: 2, Type: HitboxHit, Frame: 1},
+	}
+	if !slices.Equal(boxes, want) {
+		t.Fatalf("hitboxes = %+v, want %+v", boxes, want)
+	}
+	if !boxes[0].OnFrame(0) || boxes[1].OnFrame(0) || !boxes[1].OnFrame(1) {
+		t.Error("OnFrame: want the first box on every frame and the second on frame 1 only")
+	}
+
+	errs := map[string]string{
+		`{ x = 0, y = 0, w = 1, h = 1, type = "hurtbox" }`:         `hitbox 1: type "hurtbox" must be "hurt" or "hit"`,
+		`{ x = 0, y = 0, w = 0, h = 1, type = "hit" }`:             "hitbox 1: size 0x1 must be positive",
+		`{ x = 3, y = 0, w = 2, h = 1, type = "hit" }`:             "hitbox 1: 2x1 at 3,0 is outside the 4x4 grid",
+		`{ x = -1, y = 0, w = 1, h = 1, type = "hit" }`:            "hitbox 1: 1x1 at -1,0 is outside the 4x4 grid",
+		`{ x = 0, y = 0, w = 1, h = 1, type = "hit", frame = 2 }`:  "hitbox 1: frame 2 is out of range, the sprite has 2 frame(s)",
+		`{ x = 0, y = 0, w = 1, h = 1, type = "hit", frame = -1 }`: "hitbox 1: frame -1 is not a frame index",
+	}
+	for box, want := range errs {
+		src := "grid = 4\n[sprite.a]\nhitbox = [" + box + "]\npixels = \"\"\"\naaaa\naaaa\naaaa\naaaa\n--\naaaa\naaaa\naaaa\naaaa\n\"\"\"\n"
+		_, err := ParseSpriteFile([]byte(src), "bad.sprite")
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: err = %v, want %q", box, err, want)
+		}
+	}
+}
+
+func TestParseSpriteFile_Playback(t *testing.T) {
+	sf, err := ParseSpriteFile([]byte("grid = 1\n[sprite.a]\npixels = \"a\"\n[sprite.b]\nplayback = \"pingpong\"\npixels = \"a\"\n"), "test.sprite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range sf.Sprites {
+		want := map[string]string{"a": PlaybackLoop, "b": PlaybackPingPong}[s.Name]
+		if s.Playback != want {
+			t.Errorf("%s playback = %q, want %q", s.Name, s.Playback, want)
+		}
+	}
+
+	_, err = ParseSpriteFile([]byte("grid = 1\n[sprite.a]\nplayback = \"bounce\"\npixels = \"a\"\n"), "bad.sprite")
+	if err == nil || !strings.Contains(err.Error(), `playback "bounce" must be`) {
+		t.Errorf("err = %v, want unknown playback rejected", err)
+	}
+}
+
 func TestParseSpriteFile_Animated(t *testing.T) {
 	input := []byte(`
 palette = "default"
@@ -124,6 +489,53 @@ gh
 	}
 }
 
+func TestParseSpriteFile_FrameSeparator(t *testing.T) {
+	input := []byte(`
+palette = "default"
+
+[sprite.coin]
+framerate = 8
+frame_count = 2
+pixels = """
+_yy_
+yyyy
+--
+yyyy
+_yy_
+"""
+`)
+	sf, err := ParseSpriteFile(input, "test.sprite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := sf.Sprites[0]
+	if len(s.Frames) != 2 {
+		t.Fatalf("got %d frames, want 2", len(s.Frames))
+	}
+	if s.Grid != (Grid{W: 4, H: 2}) {
+		t.Errorf("grid = %v, want 4x2", s.Grid)
+	}
+	if got := s.Frames[1].Pixels[1][0]; got != "_" {
+		t.Errorf("frame 2 pixel (0,1) = %q, want _", got)
+	}
+
+	for _, tt := range []struct {
+		name, sprite, want string
+	}{
+		{"frame count", "frame_count = 3\npixels = \"\"\"\nab\n--\ncd\n\"\"\"", "frame_count is 3 but the sprite has 2 frame(s)"},
+		{"uneven frames", "pixels = \"\"\"\nab\n--\ncde\n\"\"\"", "frame 2 dimensions 3x1 differ"},
+		{"empty frame", "pixels = \"\"\"\nab\n--\n--\ncd\n\"\"\"", "frame 2 is empty"},
+		{"mixed", "pixels = \"\"\"\nab\n\"\"\"\n[[sprite.s.frame]]\npixels = \"ab\"", "cannot be combined with [[frame]] tables"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseSpriteFile([]byte("palette = \"default\"\n[sprite.s]\n"+tt.sprite+"\n"), "test.sprite")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
 func TestParseSpriteFile_GridMismatch(t *testing.T) {
 	input := []byte(`
 palette = "default"
@@ -190,6 +602,45 @@ efgh
 	}
 }
 
+func TestParseSpriteFile_GridFromPixels(t *testing.T) {
+	input := []byte(`
+palette = "default"
+
+[sprite.wide]
+pivot = "bottom-center"
+[[sprite.wide.frame]]
+pixels = """
+r__
+rr_
+"""
+[[sprite.wide.frame]]
+pixels = """
+__r
+_rr
+"""
+`)
+	sf, err := ParseSpriteFile(input, "test.sprite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := sf.Sprites[0]
+	if s.Grid != (Grid{W: 3, H: 2}) {
+		t.Errorf("grid = %v, want 3x2 from the pixels", s.Grid)
+	}
+	if s.Pivot == nil || s.Pivot.X != 1 || s.Pivot.Y != 1 {
+		t.Errorf("pivot = %+v, want (1, 1)", s.Pivot)
+	}
+
+	pal := &palette.Palette{Colors: map[string]palette.Color{"r": {R: 255, A: 255}, "_": {}}}
+	resolved, err := sf.Resolve(pal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g := resolved[0].Grid; g != (Grid{W: 3, H: 2}) {
+		t.Errorf("resolved grid = %v, want 3x2", g)
+	}
+}
+
 func TestSpriteFile_Resolve(t *testing.T) {
 	pal := &palette.Palette{
 		Name: "test",
@@ -313,4 +764,170 @@ func TestSpriteFile_Resolve_PaletteExtend(t *testing.T) {
 	if resolved[0].Frames[0].Pixels[0][1].R != 255 {
 		t.Error("palette_extend key 'x' not resolved to red")
 	}
+
+	// A value can name one of the palette's aliases.
+	pal.Colors["k"] = palette.Color{B: 9, A: 255}
+	pal.Aliases = map[string]string{"ink": "k"}
+	sf.PaletteExtend["x"] = "ink"
+	if resolved, err = sf.Resolve(pal); err != nil || resolved[0].Frames[0].Pixels[0][1] != pal.Colors["k"] {
+		t.Errorf("palette_extend x = \"ink\" resolved to %v, %v", resolved, err)
+	}
+	sf.PaletteExtend["x"] = "inc"
+	if _, err := sf.Resolve(pal); err == nil || !strings.Contains(err.Error(), `palette_extend key "x": unknown color "inc"`) {
+		t.Errorf("err = %v, want an unknown color error", err)
+	}
+}
+
+func TestParseSpriteFile_SpriteOrder(t *testing.T) {
+	input := []byte(`
+palette = "default"
+grid = 1
+
+[sprite.zebra]
+pixels = "r"
+
+[sprite.apple]
+pixels = "g"
+
+[sprite.mango.pivot]
+x = 0
+y = 0
+[sprite.mango]
+pixels = "b"
+
+[sprite."kiwi fruit"]
+pixels = "k"
+`)
+	want := []string{"zebra", "apple", "mango", "kiwi fruit"}
+	for range 10 {
+		sf, err := ParseSpriteFile(input, "test.sprite")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, s := range sf.Sprites {
+			got = append(got, s.Name)
+		}
+		if !slices.Equal(got, want) {
+			t.Fatalf("sprites = %v, want %v in file order", got, want)
+		}
+	}
+}
+
+// The sheet stacks sprites in file order, so the same file always gives
+// the same rows and the same SpriteInfo coordinates.
+func TestRenderSpriteSheet_FileOrder(t *testing.T) {
+	input := []byte(`
+palette = "default"
+
+[sprite.zebra]
+pixels = "r"
+
+[sprite.apple]
+pixels = """
+rr
+rr
+"""
+
+[sprite.mango]
+pixels = "rrr"
+`)
+	pal := &palette.Palette{Colors: map[string]palette.Color{"r": {R: 255, A: 255}}}
+	for range 10 {
+		sf, err := ParseSpriteFile(input, "test.sprite")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resolved, err := sf.Resolve(pal)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, meta, err := RenderSpriteSheet(resolved, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, y := range map[string]int{"zebra": 0, "apple": 1, "mango": 3} {
+			if got := meta.Sprites[name].Y; got != y {
+				t.Fatalf("%s at y = %d, want %d", name, got, y)
+			}
+		}
+	}
+}
+
+func TestResolveWith_PaletteOverride(t *testing.T) {
+	input := []byte(`palette = "default"
+grid = "2x1"
+
+[palette_extend]
+w = "#ffffff"
+
+[sprite.enemy]
+pixels = "rw"
+
+[sprite.boss]
+palette = "boss"
+pixels = "rw"
+
+[sprite.boss2]
+palette = "boss"
+pixels = "r_"
+`)
+	sf, err := ParseSpriteFile(input, "test.sprite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sf.PaletteRefs(); !slices.Equal(got, []string{"default", "boss"}) {
+		t.Errorf("PaletteRefs() = %q, want [default boss]", got)
+	}
+
+	file := &palette.Palette{Colors: map[string]palette.Color{"r": {R: 255, A: 255}}}
+	boss := &palette.Palette{Colors: map[string]palette.Color{"r": {R: 128, B: 128, A: 255}}}
+	loads := 0
+	pals := func(name string) (*palette.Palette, error) {
+		loads++
+		if name != "boss" {
+			return nil, fmt.Errorf("palette %q not found", name)
+		}
+		return boss, nil
+	}
+	resolved, err := sf.ResolveWith(file, nil, pals)
+	if err != nil {
+		t.Fatal(err)
+	}
+	white := palette.Color{R: 255, G: 255, B: 255, A: 255}
+	for i, want := range [][]palette.Color{
+		{file.Colors["r"], white},
+		{boss.Colors["r"], white}, // palette_extend applies on top
+		{boss.Colors["r"], {}},
+	} {
+		if got := resolved[i].Frames[0].Pixels[0]; !slices.Equal(got, want) {
+			t.Errorf("%s = %v, want %v", resolved[i].Name, got, want)
+		}
+	}
+	if loads != 1 {
+		t.Errorf("boss palette loaded %d times, want once", loads)
+	}
+
+	if _, err := sf.Resolve(file); err == nil || !strings.Contains(err.Error(), `sprite "boss": palette "boss"`) {
+		t.Errorf("Resolve without a palette loader: err = %v", err)
+	}
+	sf.Sprites[1].Palette = "bos"
+	_, err = sf.ResolveWith(file, nil, pals)
+	if err == nil || err.Error() != `sprite "boss": palette "bos" not found` {
+		t.Errorf("err = %v, want sprite \"boss\": palette \"bos\" not found", err)
+	}
+}
+
+func TestParseSpriteFile_ComposedPalette(t *testing.T) {
+	input := []byte(`grid = 1
+[sprite.a]
+pixels = "r"
+[sprite.b]
+palette = "boss"
+compose = ["a"]
+`)
+	_, err := ParseSpriteFile(input, "test.sprite")
+	if err == nil || !strings.Contains(err.Error(), "set palette on them instead") {
+		t.Errorf("err = %v, want palette on a composed sprite rejected", err)
+	}
 }
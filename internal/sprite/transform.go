@@ -0,0 +1,180 @@
+package sprite
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/vgalaktionov/runefact/internal/palette"
+)
+
+// DefaultMaxFromDepth is how many from links a chain of derived sprites may
+// have when the SpriteFile doesn't set MaxFromDepth.
+const DefaultMaxFromDepth = 4
+
+// maxFromDepth returns the file's limit on from chains.
+func (sf *SpriteFile) maxFromDepth() int {
+	if sf.MaxFromDepth > 0 {
+		return sf.MaxFromDepth
+	}
+	return DefaultMaxFromDepth
+}
+
+// transformSprite returns s as a transformed copy of src: mirrored as
+// FlipX and FlipY ask, then turned clockwise by Rotate degrees. Grid and
+// framerate come from src unless s sets them, and so do the playback mode,
+// pivot, events and hitboxes; meta is the sprite's own.
+func transformSprite(s Sprite, src *ResolvedSprite) (*ResolvedSprite, error) {
+	if len(src.Frames) == 0 {
+		return nil, fmt.Errorf("sprite %q: from %q has no frames", s.Name, s.From)
+	}
+	grid := src.Grid
+	if s.Rotate == 90 || s.Rotate == 270 {
+		grid = Grid{W: src.Grid.H, H: src.Grid.W}
+	}
+	if (s.Grid.W > 0 || s.Grid.H > 0) && s.Grid != grid {
+		return nil, fmt.Errorf("sprite %q: grid %dx%d doesn't match its source %q turned into %dx%d",
+			s.Name, s.Grid.W, s.Grid.H, s.From, grid.W, grid.H)
+	}
+
+	rs := &ResolvedSprite{
+		Name:      s.Name,
+		Grid:      grid,
+		Framerate: s.Framerate,
+		Playback:  s.Playback,
+		Events:    s.Events,
+
+		ExportFrames: s.ExportFrames,
+		Meta:         s.Meta,
+	}
+	if rs.Framerate == 0 {
+		rs.Framerate = src.Framerate
+	}
+	if rs.Playback == "" {
+		rs.Playback = src.Playback
+	}
+	if rs.Events == nil {
+		rs.Events = src.Events
+	}
+	if err := checkEvents(rs.Events, len(src.Frames)); err != nil {
+		return nil, fmt.Errorf("sprite %q: %w", s.Name, err)
+	}
+
+	if s.Hitboxes != nil {
+		rs.Hitboxes = s.Hitboxes
+	} else {
+		for _, h := range src.Hitboxes {
+			rs.Hitboxes = append(rs.Hitboxes, s.transformRect(h, src.Grid))
+		}
+	}
+	if err := checkHitboxes(rs.Hitboxes, grid, len(src.Frames)); err != nil {
+		return nil, fmt.Errorf("sprite %q: %w", s.Name, err)
+	}
+
+	switch {
+	case s.Pivot != nil:
+		pivot, err := placePivot(s.Pivot, grid)
+		if err != nil {
+			return nil, fmt.Errorf("sprite %q: %w", s.Name, err)
+		}
+		rs.Pivot = pivot
+	case src.Pivot != nil:
+		x, y := s.transformPoint(src.Pivot.X, src.Pivot.Y, src.Grid)
+		rs.Pivot = &Pivot{X: x, Y: y}
+	}
+
+	for _, f := range src.Frames {
+		pixels := make([][]palette.Color, grid.H)
+		for y := range pixels {
+			pixels[y] = make([]palette.Color, grid.W)
+		}
+		for y, row := range f.Pixels {
+			for x, c := range row {
+				tx, ty := s.transformPoint(x, y, src.Grid)
+				pixels[ty][tx] = c
+			}
+		}
+		rs.Frames = append(rs.Frames, ResolvedFrame{Pixels: pixels})
+	}
+	return rs, nil
+}
+
+// KeyGrids returns the palette keys of each frame of the sprite called
+// name, laid out the way Resolve lays out its pixels: a sprite made with
+// from gets its source's keys, mirrored and turned the same way. It
+// returns nil for a composed sprite, a sprite made from another file, and
+// an unknown name, whose keys aren't in this file.
+func (sf *SpriteFile) KeyGrids(name string) [][][]string {
+	return sf.keyGrids(name, sf.maxFromDepth())
+}
+
+func (sf *SpriteFile) keyGrids(name string, depth int) [][][]string {
+	i := slices.IndexFunc(sf.Sprites, func(s Sprite) bool { return s.Name == name })
+	if i < 0 || depth < 0 {
+		return nil
+	}
+	s := sf.Sprites[i]
+	if s.From == "" {
+		var grids [][][]string
+		for _, f := range s.Frames {
+			grids = append(grids, f.Pixels)
+		}
+		return grids
+	}
+	if strings.Contains(s.From, ":") {
+		return nil
+	}
+	var grids [][][]string
+	for _, src := range sf.keyGrids(s.From, depth-1) {
+		g := Grid{H: len(src)}
+		if len(src) > 0 {
+			g.W = len(src[0])
+		}
+		w, h := g.W, g.H
+		if s.Rotate == 90 || s.Rotate == 270 {
+			w, h = h, w
+		}
+		keys := make([][]string, h)
+		for y := range keys {
+			keys[y] = make([]string, w)
+		}
+		for y, row := range src {
+			for x, k := range row {
+				tx, ty := s.transformPoint(x, y, g)
+				keys[ty][tx] = k
+			}
+		}
+		grids = append(grids, keys)
+	}
+	return grids
+}
+
+// transformRect returns hitbox h of a source frame of size g where the
+// sprite's transform puts it.
+func (s Sprite) transformRect(h Hitbox, g Grid) Hitbox {
+	x0, y0 := s.transformPoint(h.X, h.Y, g)
+	x1, y1 := s.transformPoint(h.X+h.W-1, h.Y+h.H-1, g)
+	h.X, h.Y = min(x0, x1), min(y0, y1)
+	h.W, h.H = max(x0, x1)-h.X+1, max(y0, y1)-h.Y+1
+	return h
+}
+
+// transformPoint maps pixel x, y of a source frame of size g to where the
+// sprite's transform puts it.
+func (s Sprite) transformPoint(x, y int, g Grid) (int, int) {
+	if s.FlipX {
+		x = g.W - 1 - x
+	}
+	if s.FlipY {
+		y = g.H - 1 - y
+	}
+	switch s.Rotate {
+	case 90:
+		return g.H - 1 - y, x
+	case 180:
+		return g.W - 1 - x, g.H - 1 - y
+	case 270:
+		return y, g.W - 1 - x
+	}
+	return x, y
+}
@@ -0,0 +1,321 @@
+package sprite
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/vgalaktionov/runefact/internal/palette"
+)
+
+// A 3x2 source with every pixel distinct, so a transform that puts any
+// pixel in the wrong place shows up.
+const fromSource = `
+[sprite.walk_right]
+grid = "3x2"
+framerate = 6
+playback = "pingpong"
+pivot = { x = 0, y = 1 }
+events = { 1 = "step" }
+meta = { speed = 2 }
+[[sprite.walk_right.frame]]
+pixels = """
+shg
+t_s
+"""
+[[sprite.walk_right.frame]]
+pixels = """
+hhs
+gt_
+"""
+[[sprite.walk_right.hitbox]]
+x = 0
+y = 0
+w = 2
+h = 1
+type = "hurt"
+`
+
+func resolveFrom(t *testing.T, extra string) map[string]ResolvedSprite {
+	t.Helper()
+	sf, err := ParseSpriteFile([]byte(fromSource+extra), "test.sprite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolved, err := sf.Resolve(composePalette)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resolveByName(t, resolved)
+}
+
+func TestFrom_Transforms(t *testing.T) {
+	byName := resolveFrom(t, `
+[sprite.flip_x]
+from = "walk_right"
+flip_x = true
+
+[sprite.flip_y]
+from = "walk_right"
+flip_y = true
+
+[sprite.rot90]
+from = "walk_right"
+rotate = 90
+
+[sprite.rot180]
+from = "walk_right"
+rotate = 180
+
+[sprite.rot270]
+from = "walk_right"
+rotate = 270
+
+[sprite.flip_xy]
+from = "walk_right"
+flip_x = true
+flip_y = true
+`)
+	src := byName["walk_right"]
+	w, h := src.Grid.W, src.Grid.H
+
+	tests := []struct {
+		name string
+		grid Grid
+		// at maps a source pixel to where it must land.
+		at func(x, y int) (int, int)
+	}{
+		{"flip_x", Grid{W: w, H: h}, func(x, y int) (int, int) { return w - 1 - x, y }},
+		{"flip_y", Grid{W: w, H: h}, func(x, y int) (int, int) { return x, h - 1 - y }},
+		{"rot90", Grid{W: h, H: w}, func(x, y int) (int, int) { return h - 1 - y, x }},
+		{"rot180", Grid{W: w, H: h}, func(x, y int) (int, int) { return w - 1 - x, h - 1 - y }},
+		{"rot270", Grid{W: h, H: w}, func(x, y int) (int, int) { return y, w - 1 - x }},
+		{"flip_xy", Grid{W: w, H: h}, func(x, y int) (int, int) { return w - 1 - x, h - 1 - y }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := byName[tt.name]
+			if !ok {
+				t.Fatalf("sprite %s missing", tt.name)
+			}
+			if got.Grid != tt.grid {
+				t.Fatalf("grid = %dx%d, want %dx%d", got.Grid.W, got.Grid.H, tt.grid.W, tt.grid.H)
+			}
+			if len(got.Frames) != len(src.Frames) {
+				t.Fatalf("%d frames, want %d", len(got.Frames), len(src.Frames))
+			}
+			for f, frame := range src.Frames {
+				for y, row := range frame.Pixels {
+					for x, c := range row {
+						tx, ty := tt.at(x, y)
+						if got.Frames[f].Pixels[ty][tx] != c {
+							t.Errorf("frame %d: source %d,%d should be at %d,%d", f, x, y, tx, ty)
+						}
+					}
+				}
+			}
+		})
+	}
+
+	// A half turn is the same as flipping both ways.
+	if byName["rot180"].Frames[0].Pixels[0][0] != byName["flip_xy"].Frames[0].Pixels[0][0] {
+		t.Error("rotate = 180 should match flip_x and flip_y together")
+	}
+}
+
+func TestFrom_RoundTrip(t *testing.T) {
+	byName := resolveFrom(t, `
+[sprite.left]
+from = "walk_right"
+flip_x = true
+
+[sprite.right_again]
+from = "left"
+flip_x = true
+
+[sprite.quarter]
+from = "walk_right"
+rotate = 90
+
+[sprite.three_quarters]
+from = "quarter"
+rotate = 270
+`)
+	src := byName["walk_right"]
+	for _, name := range []string{"right_again", "three_quarters"} {
+		got := byName[name]
+		if got.Grid != src.Grid {
+			t.Fatalf("%s: grid = %dx%d, want %dx%d", name, got.Grid.W, got.Grid.H, src.Grid.W, src.Grid.H)
+		}
+		for f := range src.Frames {
+			for y, row := range src.Frames[f].Pixels {
+				for x, c := range row {
+					if got.Frames[f].Pixels[y][x] != c {
+						t.Errorf("%s frame %d: pixel %d,%d differs from the source", name, f, x, y)
+					}
+				}
+			}
+		}
+	}
+}
+
+// The key grids of derived sprites line up with their resolved pixels,
+// through chains of from as well.
+func TestKeyGrids_From(t *testing.T) {
+	sf, err := ParseSpriteFile([]byte(fromSource+`
+[sprite.rot90]
+from = "walk_right"
+rotate = 90
+
+[sprite.rot90_flipped]
+from = "rot90"
+flip_x = true
+
+[sprite.imported]
+from = "other:walk"
+`), "test.sprite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	colors := map[string]palette.Color{"_": {}}
+	for k, c := range composePalette.Colors {
+		colors[k] = c
+	}
+	byName := map[string]ResolvedSprite{}
+	for _, name := range []string{"walk_right", "rot90", "rot90_flipped"} {
+		rs, err := sf.ResolvePart(composePalette, name, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		byName[name] = *rs
+	}
+	for name, rs := range byName {
+		grids := sf.KeyGrids(name)
+		if len(grids) != len(rs.Frames) {
+			t.Fatalf("%s: %d key grids, want %d", name, len(grids), len(rs.Frames))
+		}
+		for f, frame := range rs.Frames {
+			for y, row := range frame.Pixels {
+				for x, c := range row {
+					if k := grids[f][y][x]; colors[k] != c {
+						t.Errorf("%s frame %d: key %q at %d,%d, want the key of %v", name, f, k, x, y, c)
+					}
+				}
+			}
+		}
+	}
+	if grids := sf.KeyGrids("imported"); grids != nil {
+		t.Errorf("sprite from another file: key grids = %v, want none", grids)
+	}
+}
+
+func TestFrom_Inherits(t *testing.T) {
+	byName := resolveFrom(t, `
+[sprite.walk_left]
+from = "walk_right"
+flip_x = true
+
+[sprite.walk_down]
+from = "walk_right"
+rotate = 90
+framerate = 12
+playback = "once"
+pivot = "center"
+events = { 0 = "turn" }
+meta = { speed = 1 }
+`)
+	left := byName["walk_left"]
+	if left.Framerate != 6 || left.Playback != PlaybackPingPong {
+		t.Errorf("walk_left framerate %d playback %q, want 6 pingpong", left.Framerate, left.Playback)
+	}
+	if left.Pivot == nil || left.Pivot.X != 2 || left.Pivot.Y != 1 {
+		t.Errorf("walk_left pivot = %+v, want the mirrored 2,1", left.Pivot)
+	}
+	if len(left.Events[1]) != 1 || left.Events[1][0] != "step" {
+		t.Errorf("walk_left events = %v, want the source's", left.Events)
+	}
+	if len(left.Hitboxes) != 1 || left.Hitboxes[0] != (Hitbox{X: 1, Y: 0, W: 2, H: 1, Type: HitboxHurt, Frame: AllFrames}) {
+		t.Errorf("walk_left hitboxes = %+v, want the mirrored 1,0 2x1", left.Hitboxes)
+	}
+	if left.Meta != nil {
+		t.Errorf("walk_left meta = %v, want none: meta is not inherited", left.Meta)
+	}
+
+	down := byName["walk_down"]
+	if down.Framerate != 12 || down.Playback != PlaybackOnce {
+		t.Errorf("walk_down framerate %d playback %q, want 12 once", down.Framerate, down.Playback)
+	}
+	if down.Pivot == nil || down.Pivot.X != 1 || down.Pivot.Y != 1 {
+		t.Errorf("walk_down pivot = %+v, want the center of its 2x3 grid", down.Pivot)
+	}
+	if len(down.Hitboxes) != 1 || down.Hitboxes[0].X != 1 || down.Hitboxes[0].W != 1 || down.Hitboxes[0].H != 2 {
+		t.Errorf("walk_down hitboxes = %+v, want the rotated 1,0 1x2", down.Hitboxes)
+	}
+	if len(down.Events[0]) != 1 || down.Events[0][0] != "turn" || down.Meta["speed"] != int64(1) {
+		t.Errorf("walk_down events %v meta %v, want its own", down.Events, down.Meta)
+	}
+}
+
+func TestFrom_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		extra string
+		want  string
+	}{
+		{"missing source", "[sprite.b]\nfrom = \"nope\"\n", `from "nope": unknown sprite "nope"`},
+		{"cycle", "[sprite.a]\nfrom = \"b\"\n[sprite.b]\nfrom = \"a\"\n", "from cycle"},
+		{"self", "[sprite.a]\nfrom = \"a\"\nflip_x = true\n", "from cycle"},
+		{"too deep", "[sprite.a]\nfrom = \"walk_right\"\n[sprite.b]\nfrom = \"a\"\n[sprite.c]\nfrom = \"b\"\n[sprite.d]\nfrom = \"c\"\n[sprite.e]\nfrom = \"d\"\n",
+			`sprite "e": chain of from sprites is 5 deep, more than the limit of 4`},
+		{"grid mismatch", "[sprite.a]\nfrom = \"walk_right\"\nrotate = 90\ngrid = \"3x2\"\n", "doesn't match its source"},
+		{"cross file", "[sprite.a]\nfrom = \"other:hero\"\n", "not supported here"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sf, err := ParseSpriteFile([]byte(fromSource+tt.extra), "test.sprite")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = sf.Resolve(composePalette)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFrom_DepthLimit(t *testing.T) {
+	sf, err := ParseSpriteFile([]byte(fromSource+"[sprite.a]\nfrom = \"walk_right\"\n[sprite.b]\nfrom = \"a\"\n"), "test.sprite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sf.MaxFromDepth = 1
+	if _, err := sf.Resolve(composePalette); err == nil || !strings.Contains(err.Error(), "limit of 1") {
+		t.Errorf("error = %v, want the depth limit", err)
+	}
+	sf.MaxFromDepth = 2
+	if _, err := sf.Resolve(composePalette); err != nil {
+		t.Errorf("a chain of 2 within a limit of 2: %v", err)
+	}
+}
+
+func TestFrom_ParseErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"flip without from", "[sprite.a]\nflip_x = true\npixels = \"s\"\n", "need from"},
+		{"bad rotate", "[sprite.a]\nfrom = \"b\"\nrotate = 45\n", "rotate must be 0, 90, 180 or 270"},
+		{"with pixels", "[sprite.a]\nfrom = \"b\"\npixels = \"s\"\n", "cannot be combined"},
+		{"with compose", "[sprite.a]\nfrom = \"b\"\ncompose = [\"b\"]\n", "cannot be combined"},
+		{"with palette", "[sprite.a]\nfrom = \"b\"\npalette = \"night\"\n", "takes its colors from its source"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseSpriteFile([]byte(tt.input), "test.sprite")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package tilemap
+
+import (
+	"image"
+	"image/draw"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vgalaktionov/runefact/internal/golden"
+	"github.com/vgalaktionov/runefact/internal/palette"
+	"github.com/vgalaktionov/runefact/internal/sprite"
+)
+
+// scaffoldAssets is the example project, which runefact init writes out
+// file for file.
+const scaffoldAssets = "../../example/assets"
+
+// TestGolden_ScaffoldMap draws the scaffold's level, tile layers in order
+// and then each entity's sprite on its tile, and compares it with
+// testdata/golden/level1.png.
+func TestGolden_ScaffoldMap(t *testing.T) {
+	mf, _, err := LoadMapFile(filepath.Join(scaffoldAssets, "maps", "level1.map"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames := scaffoldSprites(t)
+
+	w, h := 0, 0
+	for _, l := range mf.Layers {
+		h = max(h, len(l.Keys))
+		for _, row := range l.Keys {
+			w = max(w, len(row))
+		}
+	}
+	ts := mf.TileSize
+	img := image.NewRGBA(image.Rect(0, 0, w*ts, h*ts))
+	place := func(ref string, x, y int) {
+		src, ok := frames[ref]
+		if !ok {
+			t.Fatalf("no sprite %q", ref)
+		}
+		r := src.Bounds().Add(image.Pt(x*ts, y*ts))
+		draw.Draw(img, r, src, image.Point{}, draw.Over)
+	}
+	for _, l := range mf.Layers {
+		for y, row := range l.Keys {
+			for x, key := range row {
+				if ref := mf.Tileset[key]; ref != "" {
+					place(ref, x, y)
+				}
+			}
+		}
+		for _, e := range l.Entities {
+			if ref, ok := e.Properties["sprite"].(string); ok {
+				place(ref, e.X, e.Y)
+			}
+		}
+	}
+	golden.AssertImage(t, "level1", img)
+}
+
+// scaffoldSprites renders the first frame of every scaffold sprite, keyed
+// by its "file:sprite" reference.
+func scaffoldSprites(t *testing.T) map[string]*image.RGBA {
+	t.Helper()
+	pal, err := palette.LoadPalette(filepath.Join(scaffoldAssets, "palettes", "default.palette"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := filepath.Glob(filepath.Join(scaffoldAssets, "sprites", "*.sprite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames := map[string]*image.RGBA{}
+	for _, f := range files {
+		sf, err := sprite.LoadSpriteFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resolved, err := sf.ResolveWith(pal, sprite.DirPartLoader(scaffoldAssets), sprite.DirPaletteLoader(scaffoldAssets))
+		if err != nil {
+			t.Fatal(err)
+		}
+		file := strings.TrimSuffix(filepath.Base(f), ".sprite")
+		for _, s := range resolved {
+			img, err := sprite.RenderFrame(s, 0, 1, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			frames[file+":"+s.Name] = img
+		}
+	}
+	return frames
+}
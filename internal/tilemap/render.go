@@ -0,0 +1,215 @@
+package tilemap
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/vgalaktionov/runefact/internal/sprite"
+)
+
+// RenderOptions says which part of a map Render draws and how large.
+type RenderOptions struct {
+	// Region is the part of the map to draw, in tiles. The zero value
+	// draws the whole map.
+	Region image.Rectangle
+
+	// Num and Den draw Num/Den output pixels per source pixel, rounding
+	// up so no tile shrinks to nothing. Zero values mean 1.
+	Num, Den int
+
+	// Frame and FrameRate draw the map's animations as they are Frame
+	// FrameRate-ths of a second in. A zero FrameRate draws every sprite's
+	// first frame.
+	Frame, FrameRate int
+}
+
+// Size returns the map's size in tiles: the widest and tallest of its tile
+// layers.
+func (mf *MapFile) Size() (w, h int) {
+	for _, l := range mf.Layers {
+		if l.Type == "tile" && len(l.Data) > 0 {
+			h = max(h, len(l.Data))
+			w = max(w, len(l.Data[0]))
+		}
+	}
+	return w, h
+}
+
+// LayerNames returns the names of the map's layers, bottom to top.
+func (mf *MapFile) LayerNames() []string {
+	names := make([]string, len(mf.Layers))
+	for i, l := range mf.Layers {
+		names[i] = l.Name
+	}
+	return names
+}
+
+// OnlyLayer returns a copy of the map with just the named layer. The copy
+// shares everything else, so Size of the original is still the size to
+// render it at.
+func (mf *MapFile) OnlyLayer(name string) (*MapFile, error) {
+	for _, l := range mf.Layers {
+		if l.Name == name {
+			only := *mf
+			only.Layers = []Layer{l}
+			return &only, nil
+		}
+	}
+	return nil, fmt.Errorf("no layer %q; layers are %s", name, strings.Join(mf.LayerNames(), ", "))
+}
+
+// Render draws the map's tile layers bottom-up and then its entities into
+// a new image. sprites resolves a "file:sprite" reference, or returns nil
+// if it can't; tiles without a sprite are left empty and entities without
+// one get a colored marker.
+func (mf *MapFile) Render(sprites func(ref string) *sprite.ResolvedSprite, opts RenderOptions) *image.RGBA {
+	region := opts.Region
+	if region.Empty() {
+		w, h := mf.Size()
+		region = image.Rect(0, 0, w, h)
+	}
+	num, den := max(opts.Num, 1), max(opts.Den, 1)
+	scale := func(n int) int { return (n*num + den - 1) / den }
+
+	// frame returns the frame rs shows at opts.Frame. Animated tiles loop,
+	// as the previewer and the map JSON have them; entity sprites follow
+	// their playback mode.
+	frame := func(rs *sprite.ResolvedSprite, playback string) *image.RGBA {
+		if rs == nil || len(rs.Frames) == 0 {
+			return nil
+		}
+		n := 0
+		if opts.FrameRate > 0 && playback != "" {
+			n = sprite.FrameAt(playback, len(rs.Frames), opts.Frame*rs.Framerate/opts.FrameRate)
+		}
+		img, _ := sprite.RenderFrame(*rs, n, 1, nil)
+		return img
+	}
+
+	tileImages := map[int]*image.RGBA{}
+	for key, ref := range mf.Tileset {
+		if ref == "" {
+			continue
+		}
+		playback := ""
+		if mf.TileProps[key].Animate {
+			playback = sprite.PlaybackLoop
+		}
+		if img := frame(sprites(ref), playback); img != nil {
+			tileImages[mf.TileIDs[key]] = img
+		}
+	}
+	entityImages := map[string]*image.RGBA{}
+	for _, l := range mf.Layers {
+		for _, e := range l.Entities {
+			ref, _ := e.Properties["sprite"].(string)
+			if _, loaded := entityImages[ref]; ref != "" && !loaded {
+				entityImages[ref] = nil
+				if rs := sprites(ref); rs != nil {
+					entityImages[ref] = frame(rs, rs.Playback)
+				}
+			}
+		}
+	}
+
+	ts := mf.TileSize
+	img := image.NewRGBA(image.Rect(0, 0, scale(region.Dx()*ts), scale(region.Dy()*ts)))
+
+	// cell is where the tile at x, y of the map lands in img.
+	cell := func(x, y int) image.Rectangle {
+		x, y = (x-region.Min.X)*ts, (y-region.Min.Y)*ts
+		return image.Rect(scale(x), scale(y), scale(x+ts), scale(y+ts))
+	}
+
+	// Tile layers go a row of tiles at a time. Rows land on separate pixel
+	// rows, so they can be drawn in parallel.
+	forEachRow(region.Min.Y, region.Max.Y, func(y int) {
+		for _, layer := range mf.Layers {
+			if layer.Type != "tile" || y >= len(layer.Data) {
+				continue
+			}
+			row := layer.Data[y]
+			for x := region.Min.X; x < min(region.Max.X, len(row)); x++ {
+				if tileImg := tileImages[row[x]]; row[x] != 0 && tileImg != nil {
+					sprite.DrawScaled(img, tileImg, cell(x, y))
+				}
+			}
+		}
+	})
+
+	for _, layer := range mf.Layers {
+		if layer.Type != "entity" {
+			continue
+		}
+		for _, e := range layer.Entities {
+			if !image.Pt(e.X, e.Y).In(region) {
+				continue
+			}
+			r := cell(e.X, e.Y)
+			ref, _ := e.Properties["sprite"].(string)
+			if eImg := entityImages[ref]; eImg != nil {
+				sprite.DrawScaled(img, eImg, r)
+			} else {
+				drawEntityMarker(img, e.Type, r.Min.X, r.Min.Y, r.Dx())
+			}
+		}
+	}
+	return img
+}
+
+// forEachRow calls draw for each row from y0 up to y1 on a pool of workers,
+// one per CPU. draw must only write pixels that no other row writes.
+func forEachRow(y0, y1 int, draw func(y int)) {
+	rows := make(chan int)
+	var wg sync.WaitGroup
+	for range min(runtime.GOMAXPROCS(0), y1-y0) {
+		wg.Go(func() {
+			for y := range rows {
+				draw(y)
+			}
+		})
+	}
+	for y := y0; y < y1; y++ {
+		rows <- y
+	}
+	close(rows)
+	wg.Wait()
+}
+
+// drawEntityMarker draws a small colored diamond for entities without sprites.
+func drawEntityMarker(img *image.RGBA, entityType string, dx, dy, size int) {
+	var c color.RGBA
+	switch entityType {
+	case "spawn":
+		c = color.RGBA{R: 0x00, G: 0xff, B: 0x00, A: 0xcc}
+	case "enemy":
+		c = color.RGBA{R: 0xff, G: 0x00, B: 0x00, A: 0xcc}
+	default:
+		c = color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xcc}
+	}
+
+	// Draw filled diamond.
+	half := size / 2
+	for py := 0; py < size; py++ {
+		for px := 0; px < size; px++ {
+			dist := abs(px-half) + abs(py-half)
+			if dist <= half {
+				x, y := dx+px, dy+py
+				if x >= 0 && x < img.Bounds().Dx() && y >= 0 && y < img.Bounds().Dy() {
+					img.SetRGBA(x, y, c)
+				}
+			}
+		}
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
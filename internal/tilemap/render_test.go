@@ -0,0 +1,151 @@
+package tilemap
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+
+	"github.com/vgalaktionov/runefact/internal/palette"
+	"github.com/vgalaktionov/runefact/internal/sprite"
+)
+
+// solidSprite returns a 1x1 sprite with one frame of each color, at one
+// frame per second.
+func solidSprite(colors ...color.RGBA) *sprite.ResolvedSprite {
+	rs := &sprite.ResolvedSprite{Grid: sprite.Grid{W: 1, H: 1}, Framerate: 1, Playback: sprite.PlaybackLoop}
+	for _, c := range colors {
+		rs.Frames = append(rs.Frames, sprite.ResolvedFrame{Pixels: [][]palette.Color{{{R: c.R, G: c.G, B: c.B, A: c.A}}}})
+	}
+	return rs
+}
+
+func TestMapFile_RenderOnlyLayer(t *testing.T) {
+	mf, _, err := ParseMapFile([]byte(`
+tile_size = 1
+
+[tileset]
+A = "tiles:a"
+B = "tiles:b"
+
+[layer.back]
+pixels = """
+AA
+AA
+A.
+"""
+
+[layer.main]
+pixels = """
+.B
+"""
+
+[layer.things]
+[[layer.things.entity]]
+type = "spawn"
+x = 0
+y = 1
+`), "test.map")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w, h := mf.Size(); w != 2 || h != 3 {
+		t.Fatalf("size = %dx%d, want 2x3", w, h)
+	}
+
+	red := color.RGBA{R: 0xff, A: 0xff}
+	blue := color.RGBA{B: 0xff, A: 0xff}
+	sprites := func(ref string) *sprite.ResolvedSprite {
+		return solidSprite(map[string]color.RGBA{"tiles:a": red, "tiles:b": blue}[ref])
+	}
+
+	main, err := mf.OnlyLayer("main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, h := mf.Size()
+	img := main.Render(sprites, RenderOptions{Region: image.Rect(0, 0, w, h), Num: 2})
+	if got := img.Bounds().Size(); got != image.Pt(4, 6) {
+		t.Fatalf("image size = %v, want the whole map at scale 2", got)
+	}
+	if got := img.RGBAAt(2, 0); got != blue {
+		t.Errorf("pixel 2,0 = %v, want main's tile", got)
+	}
+	for _, p := range []image.Point{{0, 0}, {0, 2}, {2, 2}} {
+		if got := img.RGBAAt(p.X, p.Y); got.A != 0 {
+			t.Errorf("pixel %v = %v, want other layers left out", p, got)
+		}
+	}
+
+	// A region crops the map before drawing.
+	img = mf.Render(sprites, RenderOptions{Region: image.Rect(0, 1, 2, 3)})
+	if got := img.Bounds().Size(); got != image.Pt(2, 2) {
+		t.Fatalf("region image size = %v, want 2x2", got)
+	}
+	if got := img.RGBAAt(1, 0); got != red {
+		t.Errorf("region pixel 1,0 = %v, want back's tile", got)
+	}
+
+	if _, err := mf.OnlyLayer("front"); err == nil || !strings.Contains(err.Error(), "layers are back, main, things") {
+		t.Errorf("err = %v, want the layer names listed", err)
+	}
+}
+
+func TestMapFile_RenderAnimated(t *testing.T) {
+	mf, _, err := ParseMapFile([]byte(`
+tile_size = 1
+
+[tileset]
+w = { sprite = "tiles:water", animate = true }
+s = "tiles:water"
+
+[layer.main]
+pixels = "ws"
+
+[layer.things]
+[[layer.things.entity]]
+type = "coin"
+x = 1
+y = 0
+properties = { sprite = "items:coin" }
+`), "test.map")
+	if err != nil {
+		t.Fatal(err)
+	}
+	red := color.RGBA{R: 0xff, A: 0xff}
+	blue := color.RGBA{B: 0xff, A: 0xff}
+	green := color.RGBA{G: 0xff, A: 0xff}
+	sprites := func(ref string) *sprite.ResolvedSprite {
+		if ref == "items:coin" {
+			coin := solidSprite(red, green, blue)
+			coin.Playback = sprite.PlaybackOnce
+			return coin
+		}
+		return solidSprite(red, blue)
+	}
+
+	for _, tc := range []struct {
+		frame       int
+		water, coin color.RGBA
+	}{
+		{0, red, red},
+		{2, red, red},
+		{4, blue, green},
+		{8, red, blue},
+		{20, blue, blue},
+	} {
+		img := mf.Render(sprites, RenderOptions{Frame: tc.frame, FrameRate: 4})
+		if got := img.RGBAAt(0, 0); got != tc.water {
+			t.Errorf("frame %d: animated tile = %v, want %v", tc.frame, got, tc.water)
+		}
+		if got := img.RGBAAt(1, 0); got != tc.coin {
+			t.Errorf("frame %d: coin = %v, want %v", tc.frame, got, tc.coin)
+		}
+	}
+
+	// Tiles not marked animate keep their first frame.
+	mf.Layers = mf.Layers[:1]
+	if got := mf.Render(sprites, RenderOptions{Frame: 4, FrameRate: 4}).RGBAAt(1, 0); got != red {
+		t.Errorf("still tile = %v, want its first frame", got)
+	}
+}
@@ -4,19 +4,65 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
-	"path/filepath"
+	"sort"
 	"strings"
 
 	toml "github.com/pelletier/go-toml/v2"
 
+	"github.com/vgalaktionov/runefact/internal/atomicfile"
+	"github.com/vgalaktionov/runefact/internal/palette"
 	"github.com/vgalaktionov/runefact/internal/sprite"
+	"github.com/vgalaktionov/runefact/internal/tomlsrc"
 )
 
 // MapFile represents a parsed .map file.
 type MapFile struct {
-	TileSize int
-	Tileset  map[string]string // char -> "file:sprite" or ""
-	Layers   []Layer
+	TileSize  int
+	Tileset   map[string]string         // char -> "file:sprite" or ""
+	TileProps map[string]TileProperties // char -> properties, for table entries
+	TileIDs   map[string]int            // char -> tile index; 0 for empty tiles
+	Layers    []Layer
+
+	// Presets holds named tint overrides, such as a night version of the
+	// map: preset name -> layer name -> tint. Layers a preset doesn't list
+	// keep their own tint.
+	Presets map[string]map[string]Tint
+
+	// Animations holds the frame count and FPS of tiles with animate = true.
+	// The parser can't see sprite files, so the build fills it in before
+	// calling ToJSON.
+	Animations map[string]TileAnimation
+}
+
+// TileAnimation is the animation of an animated tile's sprite.
+type TileAnimation struct {
+	Frames int
+	FPS    int
+}
+
+// TintMultiply multiplies each pixel by the tint color. It is the only
+// tint mode so far, and the default.
+const TintMultiply = "multiply"
+
+// Tint is a color a layer is drawn through, set with [layer.x.tint].
+type Tint struct {
+	Color palette.Color
+	Mode  string
+}
+
+// TileProperties are the game-logic properties of a tileset entry, set with
+// the table form: s = { sprite = "tiles:stone", solid = true, tags = ["ground"] }.
+type TileProperties struct {
+	Solid bool     `json:"solid"`
+	Tags  []string `json:"tags,omitempty"`
+
+	// Animate plays the sprite's frames in place. It is emitted as the
+	// tile's frames and fps rather than as a property.
+	Animate bool `json:"-"`
+
+	// ID pins the tile's index, so saved games keep working when the
+	// tileset changes. Zero means the index is assigned automatically.
+	ID int `json:"-"`
 }
 
 // Layer is either a tile layer (with grid data) or an entity layer.
@@ -25,8 +71,10 @@ type Layer struct {
 	Type     string // "tile" or "entity"
 	ScrollX  float64
 	ScrollY  float64
-	Data     [][]int  // tile indices for tile layers
-	Entities []Entity // entities for entity layers
+	Data     [][]int    // tile indices for tile layers
+	Keys     [][]string // tileset keys as written, for tile layers
+	Entities []Entity   // entities for entity layers
+	Tint     *Tint      // nil when the layer has no tint
 }
 
 // Entity represents a placed object in an entity layer.
@@ -40,20 +88,35 @@ type Entity struct {
 // Warning represents a non-fatal issue found during parsing.
 type Warning struct {
 	Message string
+
+	// Cells are the layer cells a warning is about, as row and column
+	// from 1, when there are any. The message sums them up as regions.
+	Cells [][2]int
 }
 
+// maxRegions caps how many regions a warning message lists.
+const maxRegions = 4
+
 // rawMap is the TOML-level structure.
 type rawMap struct {
-	TileSize int               `toml:"tile_size"`
-	Tileset  map[string]string `toml:"tileset"`
+	TileSize int            `toml:"tile_size"`
+	Tileset  map[string]any `toml:"tileset"` // string or table
 	Layer    map[string]rawLayer
+	Presets  map[string]map[string]rawTint `toml:"presets"`
 }
 
 type rawLayer struct {
+	Type    string      `toml:"type"` // "tile" or "entity"; inferred when empty
 	ScrollX float64     `toml:"scroll_x"`
 	ScrollY float64     `toml:"scroll_y"`
 	Pixels  string      `toml:"pixels"`
 	Entity  []rawEntity `toml:"entity"`
+	Tint    *rawTint    `toml:"tint"`
+}
+
+type rawTint struct {
+	Color string `toml:"color"`
+	Mode  string `toml:"mode"`
 }
 
 type rawEntity struct {
@@ -65,6 +128,7 @@ type rawEntity struct {
 
 // ParseMapFile parses .map file content.
 func ParseMapFile(data []byte, filename string) (*MapFile, []Warning, error) {
+	data = tomlsrc.Normalize(data)
 	var raw rawMap
 	if err := toml.Unmarshal(data, &raw); err != nil {
 		return nil, nil, fmt.Errorf("%s: %w", filename, err)
@@ -74,47 +138,277 @@ func ParseMapFile(data []byte, filename string) (*MapFile, []Warning, error) {
 		return nil, nil, fmt.Errorf("%s: tile_size must be positive", filename)
 	}
 
+	tileset, props, err := parseTileset(raw.Tileset, filename)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tileIndex, err := buildTileIndex(tileset, props, filename)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	mf := &MapFile{
-		TileSize: raw.TileSize,
-		Tileset:  raw.Tileset,
+		TileSize:  raw.TileSize,
+		Tileset:   tileset,
+		TileProps: props,
+		TileIDs:   tileIndex,
 	}
 
 	var warnings []Warning
 
-	// Build tileset index: assign each tileset key a numeric index.
-	tileIndex := buildTileIndex(raw.Tileset)
-
-	for name, rl := range raw.Layer {
-		layer, layerWarnings, err := parseLayer(name, rl, tileIndex, filename)
+	for _, name := range tomlsrc.Order(data, "layer", raw.Layer) {
+		layer, layerWarnings, err := parseLayer(name, raw.Layer[name], tileIndex, filename)
 		if err != nil {
 			return nil, nil, err
 		}
+		if rt := raw.Layer[name].Tint; rt != nil {
+			tint, err := parseTint(*rt)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: layer %q: tint: %w", filename, name, err)
+			}
+			layer.Tint = &tint
+		}
 		warnings = append(warnings, layerWarnings...)
 		mf.Layers = append(mf.Layers, *layer)
 	}
+	warnings = append(warnings, unbracketedKeyWarnings(mf, filename)...)
+
+	if mf.Presets, err = parsePresets(raw.Presets, raw.Layer, filename); err != nil {
+		return nil, nil, err
+	}
 
 	return mf, warnings, nil
 }
 
-func buildTileIndex(tileset map[string]string) map[string]int {
+// parsePresets parses the [presets.NAME] tables, each mapping layer names
+// to tints.
+func parsePresets(raw map[string]map[string]rawTint, layers map[string]rawLayer, filename string) (map[string]map[string]Tint, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	presets := make(map[string]map[string]Tint, len(raw))
+	for name, rp := range raw {
+		preset := make(map[string]Tint, len(rp))
+		for layer, rt := range rp {
+			if _, ok := layers[layer]; !ok {
+				return nil, fmt.Errorf("%s: preset %q: unknown layer %q", filename, name, layer)
+			}
+			tint, err := parseTint(rt)
+			if err != nil {
+				return nil, fmt.Errorf("%s: preset %q: layer %q: %w", filename, name, layer, err)
+			}
+			preset[layer] = tint
+		}
+		presets[name] = preset
+	}
+	return presets, nil
+}
+
+func parseTint(raw rawTint) (Tint, error) {
+	if raw.Color == "" {
+		return Tint{}, fmt.Errorf("color is required")
+	}
+	c, err := palette.ParseHexColor(raw.Color)
+	if err != nil {
+		return Tint{}, err
+	}
+	if c.A != 255 {
+		return Tint{}, fmt.Errorf("color %q must be opaque", raw.Color)
+	}
+	switch raw.Mode {
+	case "":
+		raw.Mode = TintMultiply
+	case TintMultiply:
+	default:
+		return Tint{}, fmt.Errorf("mode %q must be %q", raw.Mode, TintMultiply)
+	}
+	return Tint{Color: c, Mode: raw.Mode}, nil
+}
+
+// PresetNames returns the tint preset names, sorted.
+func (mf *MapFile) PresetNames() []string {
+	names := make([]string, 0, len(mf.Presets))
+	for name := range mf.Presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LayerTint returns the tint a layer is drawn with under a preset: the
+// preset's override if it has one, otherwise the layer's own tint. An
+// empty preset means the layer's own tint. It returns nil for no tint.
+func (mf *MapFile) LayerTint(l Layer, preset string) *Tint {
+	if t, ok := mf.Presets[preset][l.Name]; ok {
+		return &t
+	}
+	return l.Tint
+}
+
+// unbracketedKeyWarnings warns about tileset keys longer than one character
+// that no tile layer uses. Layers read one character per tile unless a key
+// is bracketed, so "gr" must be written [gr]; an unused long key usually
+// means the brackets were forgotten.
+func unbracketedKeyWarnings(mf *MapFile, filename string) []Warning {
+	used := mf.usedKeys()
+	var keys []string
+	for key, ref := range mf.Tileset {
+		if len(key) > 1 && ref != "" && !used[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	warnings := make([]Warning, len(keys))
+	for i, key := range keys {
+		warnings[i] = Warning{
+			Message: fmt.Sprintf("%s: tileset key %q is longer than one character, but no layer uses it as [%s]", filename, key, key),
+		}
+	}
+	return warnings
+}
+
+// parseTileset splits the raw tileset into sprite references and the
+// properties of entries written in table form.
+func parseTileset(raw map[string]any, filename string) (map[string]string, map[string]TileProperties, error) {
+	tileset := make(map[string]string, len(raw))
+	props := map[string]TileProperties{}
+	for key, v := range raw {
+		if key == "" || strings.ContainsAny(key, "[]") {
+			return nil, nil, fmt.Errorf("%s: tileset key %q can't be written in a layer: keys must not be empty or contain brackets", filename, key)
+		}
+		switch v := v.(type) {
+		case string:
+			tileset[key] = v
+		case map[string]any:
+			ref, tp, err := parseTileEntry(v)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: tileset %q: %w", filename, key, err)
+			}
+			tileset[key] = ref
+			props[key] = tp
+		default:
+			return nil, nil, fmt.Errorf("%s: tileset %q: expected a sprite reference or a table, got %T", filename, key, v)
+		}
+	}
+	return tileset, props, nil
+}
+
+func parseTileEntry(t map[string]any) (string, TileProperties, error) {
+	var tp TileProperties
+	ref, ok := t["sprite"].(string)
+	if !ok {
+		return "", tp, fmt.Errorf("sprite must be a string")
+	}
+	for field, v := range t {
+		switch field {
+		case "sprite":
+		case "solid":
+			b, ok := v.(bool)
+			if !ok {
+				return "", tp, fmt.Errorf("solid must be true or false")
+			}
+			tp.Solid = b
+		case "animate":
+			b, ok := v.(bool)
+			if !ok {
+				return "", tp, fmt.Errorf("animate must be true or false")
+			}
+			tp.Animate = b
+		case "id":
+			n, ok := v.(int64)
+			if !ok || n < 1 {
+				return "", tp, fmt.Errorf("id must be a positive integer")
+			}
+			tp.ID = int(n)
+		case "tags":
+			list, ok := v.([]any)
+			if !ok {
+				return "", tp, fmt.Errorf("tags must be an array of strings")
+			}
+			for _, tag := range list {
+				s, ok := tag.(string)
+				if !ok {
+					return "", tp, fmt.Errorf("tags must be an array of strings")
+				}
+				tp.Tags = append(tp.Tags, s)
+			}
+		default:
+			return "", tp, fmt.Errorf("unknown field %q (known: sprite, solid, tags, animate, id)", field)
+		}
+	}
+	return ref, tp, nil
+}
+
+// buildTileIndex assigns each tileset key a numeric index. Empty tiles are
+// 0. Pinned ids are kept; the other keys take the lowest free ids in key
+// order, so the same tileset always gets the same indices.
+func buildTileIndex(tileset map[string]string, props map[string]TileProperties, filename string) (map[string]int, error) {
+	keys := make([]string, 0, len(tileset))
+	for key := range tileset {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
 	idx := make(map[string]int, len(tileset))
-	nextID := 0
-	for key, ref := range tileset {
-		if ref == "" {
+	owner := map[int]string{}
+	for _, key := range keys {
+		id := props[key].ID
+		if id == 0 {
+			continue
+		}
+		if tileset[key] == "" {
+			return nil, fmt.Errorf("%s: tileset %q: id is set on an empty tile", filename, key)
+		}
+		if other, dup := owner[id]; dup {
+			return nil, fmt.Errorf("%s: tileset %q: id %d is already used by %q", filename, key, id, other)
+		}
+		owner[id] = key
+		idx[key] = id
+	}
+
+	nextID := 1
+	for _, key := range keys {
+		if _, pinned := idx[key]; pinned {
+			continue
+		}
+		if tileset[key] == "" {
 			idx[key] = 0 // empty tile
-		} else {
+			continue
+		}
+		for owner[nextID] != "" {
 			nextID++
-			idx[key] = nextID
 		}
+		owner[nextID] = key
+		idx[key] = nextID
 	}
-	return idx
+	return idx, nil
 }
 
+// parseLayer parses a layer of the given type. Without a type, a layer
+// with entities is an entity layer and any other is a tile layer, so an
+// entity layer that is still empty needs type = "entity".
 func parseLayer(name string, raw rawLayer, tileIndex map[string]int, filename string) (*Layer, []Warning, error) {
-	if len(raw.Entity) > 0 {
+	typ := raw.Type
+	if typ == "" {
+		typ = "tile"
+		if len(raw.Entity) > 0 {
+			typ = "entity"
+		}
+	}
+	switch typ {
+	case "tile":
+		if len(raw.Entity) > 0 {
+			return nil, nil, fmt.Errorf("%s: layer %q: a tile layer can't have entities", filename, name)
+		}
+		return parseTileLayer(name, raw, tileIndex, filename)
+	case "entity":
+		if raw.Pixels != "" {
+			return nil, nil, fmt.Errorf("%s: layer %q: an entity layer can't have pixels", filename, name)
+		}
 		return parseEntityLayer(name, raw)
 	}
-	return parseTileLayer(name, raw, tileIndex, filename)
+	return nil, nil, fmt.Errorf("%s: layer %q: type %q must be \"tile\" or \"entity\"", filename, name, raw.Type)
 }
 
 func parseTileLayer(name string, raw rawLayer, tileIndex map[string]int, filename string) (*Layer, []Warning, error) {
@@ -125,21 +419,33 @@ func parseTileLayer(name string, raw rawLayer, tileIndex map[string]int, filenam
 		return nil, nil, fmt.Errorf("%s: layer %q: %w", filename, name, err)
 	}
 
+	// Unknown keys are gathered per key, so a bad find and replace is one
+	// warning per key rather than one per cell.
+	unknown := make(map[string][][2]int)
+	var unknownKeys []string
 	data := make([][]int, len(grid))
 	for y, row := range grid {
 		data[y] = make([]int, len(row))
 		for x, key := range row {
 			idx, ok := tileIndex[key]
 			if !ok {
-				warnings = append(warnings, Warning{
-					Message: fmt.Sprintf("%s: layer %q: unknown tileset key %q at row %d, col %d", filename, name, key, y+1, x+1),
-				})
+				if unknown[key] == nil {
+					unknownKeys = append(unknownKeys, key)
+				}
+				unknown[key] = append(unknown[key], [2]int{y + 1, x + 1})
 				data[y][x] = 0
 			} else {
 				data[y][x] = idx
 			}
 		}
 	}
+	for _, key := range unknownKeys {
+		cells := unknown[key]
+		warnings = append(warnings, Warning{
+			Message: fmt.Sprintf("%s: layer %q: unknown tileset key %q %s", filename, name, key, describeCells(cells)),
+			Cells:   cells,
+		})
+	}
 
 	return &Layer{
 		Name:    name,
@@ -147,9 +453,77 @@ func parseTileLayer(name string, raw rawLayer, tileIndex map[string]int, filenam
 		ScrollX: raw.ScrollX,
 		ScrollY: raw.ScrollY,
 		Data:    data,
+		Keys:    grid,
 	}, warnings, nil
 }
 
+// describeCells names cells, given in row-major order, for a warning: "at
+// row 3, col 7" for one, otherwise how many there are and the rectangles
+// they make up, such as "in 120 cells: rows 3-9, cols 1-16; row 12, col 4".
+func describeCells(cells [][2]int) string {
+	if len(cells) == 1 {
+		return fmt.Sprintf("at row %d, col %d", cells[0][0], cells[0][1])
+	}
+	regions := cellRegions(cells)
+	parts := make([]string, 0, min(len(regions), maxRegions)+1)
+	for _, r := range regions[:min(len(regions), maxRegions)] {
+		parts = append(parts, r.String())
+	}
+	if n := len(regions) - maxRegions; n > 0 {
+		parts = append(parts, fmt.Sprintf("and %d more regions", n))
+	}
+	return fmt.Sprintf("in %d cells: %s", len(cells), strings.Join(parts, "; "))
+}
+
+// cellRegion is a rectangle of cells, bounds inclusive.
+type cellRegion struct {
+	rows, cols [2]int
+}
+
+func (r cellRegion) String() string {
+	span := func(name string, s [2]int) string {
+		if s[0] == s[1] {
+			return fmt.Sprintf("%s %d", name, s[0])
+		}
+		return fmt.Sprintf("%ss %d-%d", name, s[0], s[1])
+	}
+	return span("row", r.rows) + ", " + span("col", r.cols)
+}
+
+// cellRegions merges cells, given in row-major order, into runs along each
+// row, and runs covering the same columns on consecutive rows into one
+// rectangle. Regions are in the order of their first cell.
+func cellRegions(cells [][2]int) []cellRegion {
+	var regions []cellRegion
+	var above, current map[[2]int]int // column span -> region ending on that row
+	row := 0
+	for i := 0; i < len(cells); {
+		if cells[i][0] != row {
+			if cells[i][0] == row+1 {
+				above = current
+			} else {
+				above = nil
+			}
+			current = make(map[[2]int]int)
+			row = cells[i][0]
+		}
+		j := i
+		for j+1 < len(cells) && cells[j+1][0] == row && cells[j+1][1] == cells[j][1]+1 {
+			j++
+		}
+		cols := [2]int{cells[i][1], cells[j][1]}
+		if k, ok := above[cols]; ok {
+			regions[k].rows[1] = row
+			current[cols] = k
+		} else {
+			current[cols] = len(regions)
+			regions = append(regions, cellRegion{rows: [2]int{row, row}, cols: cols})
+		}
+		i = j + 1
+	}
+	return regions
+}
+
 func parseEntityLayer(name string, raw rawLayer) (*Layer, []Warning, error) {
 	entities := make([]Entity, len(raw.Entity))
 	for i, re := range raw.Entity {
@@ -167,6 +541,89 @@ func parseEntityLayer(name string, raw rawLayer) (*Layer, []Warning, error) {
 	}, nil, nil
 }
 
+// usedKeys returns the set of tileset keys written in any tile layer.
+func (mf *MapFile) usedKeys() map[string]bool {
+	used := map[string]bool{}
+	for _, l := range mf.Layers {
+		for _, row := range l.Keys {
+			for _, k := range row {
+				used[k] = true
+			}
+		}
+	}
+	return used
+}
+
+// UnusedTilesetKeys returns the sorted tileset keys with a sprite reference
+// that never appear in any tile layer. Empty-tile keys are not reported.
+func (mf *MapFile) UnusedTilesetKeys() []string {
+	used := mf.usedKeys()
+	var unused []string
+	for k, ref := range mf.Tileset {
+		if ref != "" && !used[k] {
+			unused = append(unused, k)
+		}
+	}
+	sort.Strings(unused)
+	return unused
+}
+
+// CheckTileSize compares the w x h sprite of tileset key against the map's
+// tile_size. With allowMultiples, sprites whose sides are exact multiples
+// of tile_size pass. For a mismatch it returns a message naming the key
+// and both sizes.
+func (mf *MapFile) CheckTileSize(key string, w, h int, allowMultiples bool) (string, bool) {
+	ts := mf.TileSize
+	if w == ts && h == ts {
+		return "", false
+	}
+	if allowMultiples && w >= ts && h >= ts && w%ts == 0 && h%ts == 0 {
+		return "", false
+	}
+	msg := fmt.Sprintf("tileset %q: sprite %s is %dx%d but tile_size is %d", key, mf.Tileset[key], w, h, ts)
+	if w >= ts && h >= ts {
+		msg += "; the previewer scales it down, while games drawing it at its own size overlap the neighbouring tiles"
+		if w%ts == 0 && h%ts == 0 {
+			msg += " (set lint.allow_oversized_tiles to allow exact multiples)"
+		}
+	} else {
+		msg += "; the previewer scales it up, while games drawing it at its own size leave gaps"
+	}
+	return msg, true
+}
+
+// AnimatedKeys returns the sorted tileset keys with animate = true and a
+// sprite reference.
+func (mf *MapFile) AnimatedKeys() []string {
+	var keys []string
+	for k, tp := range mf.TileProps {
+		if tp.Animate && mf.Tileset[k] != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// SpriteRefs returns every "file:sprite" reference made by the tileset and
+// by entity "sprite" properties.
+func (mf *MapFile) SpriteRefs() []string {
+	var refs []string
+	for _, ref := range mf.Tileset {
+		if ref != "" {
+			refs = append(refs, ref)
+		}
+	}
+	for _, l := range mf.Layers {
+		for _, e := range l.Entities {
+			if ref, ok := e.Properties["sprite"].(string); ok && ref != "" {
+				refs = append(refs, ref)
+			}
+		}
+	}
+	return refs
+}
+
 // LoadMapFile reads and parses a .map file from disk.
 func LoadMapFile(path string) (*MapFile, []Warning, error) {
 	data, err := os.ReadFile(path)
@@ -183,13 +640,23 @@ type JSONTilemap struct {
 	Height   int                    `json:"height"`
 	Tileset  map[string]JSONTileRef `json:"tileset"`
 	Layers   []JSONLayer            `json:"layers"`
+
+	// Presets maps each tint preset to the tint of every tinted layer under
+	// it, overrides and the layers' own tints alike.
+	Presets map[string]map[string]JSONTint `json:"presets,omitempty"`
 }
 
-// JSONTileRef describes a tile's source sprite.
+// JSONTileRef describes a tile's source sprite and properties. Source is a
+// sheet file name with forward slashes, whatever OS built it. Animated
+// tiles also carry their frame count and FPS; the frames are laid out left
+// to right in the sheet, as for any animated sprite.
 type JSONTileRef struct {
-	Source string `json:"source"`
-	Sprite string `json:"sprite"`
-	Index  int    `json:"index"`
+	Source     string         `json:"source"`
+	Sprite     string         `json:"sprite"`
+	Index      int            `json:"index"`
+	Properties TileProperties `json:"properties"`
+	Frames     int            `json:"frames,omitempty"` // animated tiles only
+	FPS        int            `json:"fps,omitempty"`
 }
 
 // JSONLayer is a layer in the output JSON.
@@ -199,7 +666,24 @@ type JSONLayer struct {
 	ScrollX  float64      `json:"scroll_x,omitempty"`
 	ScrollY  float64      `json:"scroll_y,omitempty"`
 	Data     [][]int      `json:"data,omitempty"`
-	Entities []JSONEntity `json:"entities,omitempty"`
+	Entities []JSONEntity `json:"entities,omitzero"` // [] for an empty entity layer
+	Tint     *JSONTint    `json:"tint,omitempty"`
+}
+
+// JSONTint is a layer tint in the map JSON.
+type JSONTint struct {
+	Color string `json:"color"` // "#rrggbb"
+	Mode  string `json:"mode"`
+}
+
+func tintJSON(t *Tint) *JSONTint {
+	if t == nil {
+		return nil
+	}
+	return &JSONTint{
+		Color: fmt.Sprintf("#%02x%02x%02x", t.Color.R, t.Color.G, t.Color.B),
+		Mode:  t.Mode,
+	}
 }
 
 // JSONEntity is an entity in the output JSON.
@@ -226,7 +710,6 @@ func (mf *MapFile) ToJSON() *JSONTilemap {
 	}
 
 	// Build tileset refs.
-	tileIndex := buildTileIndex(mf.Tileset)
 	tilesetJSON := make(map[string]JSONTileRef, len(mf.Tileset))
 	for key, ref := range mf.Tileset {
 		if ref == "" {
@@ -234,9 +717,12 @@ func (mf *MapFile) ToJSON() *JSONTilemap {
 		}
 		source, spriteName := parseSpriteRef(ref)
 		tilesetJSON[key] = JSONTileRef{
-			Source: source + ".png",
-			Sprite: spriteName,
-			Index:  tileIndex[key],
+			Source:     strings.ReplaceAll(source, `\`, "/") + ".png",
+			Sprite:     spriteName,
+			Index:      mf.TileIDs[key],
+			Properties: mf.TileProps[key],
+			Frames:     mf.Animations[key].Frames,
+			FPS:        mf.Animations[key].FPS,
 		}
 	}
 
@@ -248,6 +734,7 @@ func (mf *MapFile) ToJSON() *JSONTilemap {
 			Type:    l.Type,
 			ScrollX: l.ScrollX,
 			ScrollY: l.ScrollY,
+			Tint:    tintJSON(l.Tint),
 		}
 		if l.Type == "tile" {
 			jl.Data = l.Data
@@ -266,12 +753,27 @@ func (mf *MapFile) ToJSON() *JSONTilemap {
 		layers[i] = jl
 	}
 
+	var presets map[string]map[string]JSONTint
+	if len(mf.Presets) > 0 {
+		presets = make(map[string]map[string]JSONTint, len(mf.Presets))
+		for name := range mf.Presets {
+			tints := map[string]JSONTint{}
+			for _, l := range mf.Layers {
+				if t := tintJSON(mf.LayerTint(l, name)); t != nil {
+					tints[l.Name] = *t
+				}
+			}
+			presets[name] = tints
+		}
+	}
+
 	return &JSONTilemap{
 		TileSize: mf.TileSize,
 		Width:    width,
 		Height:   height,
 		Tileset:  tilesetJSON,
 		Layers:   layers,
+		Presets:  presets,
 	}
 }
 
@@ -284,15 +786,58 @@ func parseSpriteRef(ref string) (file, spriteName string) {
 	return ref, ""
 }
 
-// WriteJSON writes the tilemap JSON to a file.
+// WriteJSON writes the tilemap JSON to a file, replacing it atomically.
 func WriteJSON(tm *JSONTilemap, path string) error {
-	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
-		return fmt.Errorf("creating output directory: %w", err)
-	}
 	data, err := json.MarshalIndent(tm, "", "  ")
 	if err != nil {
 		return fmt.Errorf("encoding JSON: %w", err)
 	}
 	data = append(data, '\n')
-	return os.WriteFile(path, data, 0644)
+	return atomicfile.WriteFile(path, data, 0644)
+}
+
+// LoadJSON reads a map JSON file written by WriteJSON.
+func LoadJSON(path string) (*JSONTilemap, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tm JSONTilemap
+	if err := json.Unmarshal(data, &tm); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &tm, nil
+}
+
+// TileIDChanges compares the tile indices with those of a previous build
+// and describes each one that would change: a key that moved to another
+// index, or an index that now belongs to a different key. Removed keys
+// are not reported.
+func (mf *MapFile) TileIDChanges(prev *JSONTilemap) []string {
+	prevKey := make(map[int]string, len(prev.Tileset))
+	for key, ref := range prev.Tileset {
+		prevKey[ref.Index] = key
+	}
+
+	keys := make([]string, 0, len(mf.TileIDs))
+	for key := range mf.TileIDs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var changes []string
+	for _, key := range keys {
+		id := mf.TileIDs[key]
+		if id == 0 {
+			continue
+		}
+		if old, ok := prev.Tileset[key]; ok {
+			if old.Index != id {
+				changes = append(changes, fmt.Sprintf("tileset %q: index changes from %d to %d; add id = %d to keep saved maps valid", key, old.Index, id, old.Index))
+			}
+		} else if other, taken := prevKey[id]; taken {
+			changes = append(changes, fmt.Sprintf("tileset %q: index %d was %q in the previous build; pin ids to keep saved maps valid", key, id, other))
+		}
+	}
+	return changes
 }
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 	"testing"
 )
@@ -112,6 +114,63 @@ GG
 	}
 }
 
+func TestParseMapFile_UnknownKeyRegions(t *testing.T) {
+	input := []byte(`
+tile_size = 8
+
+[tileset]
+G = "tiles:grass"
+
+[layer.main]
+pixels = """
+GXXXG
+GXXXG
+GXXXY
+GGGGG
+XGGGX
+"""
+`)
+	_, warnings, err := ParseMapFile(input, "test.map")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 2 {
+		t.Fatalf("got %d warnings, want one per unknown key: %v", len(warnings), warnings)
+	}
+	want := `test.map: layer "main": unknown tileset key "X" in 11 cells: rows 1-3, cols 2-4; row 5, col 1; row 5, col 5`
+	if warnings[0].Message != want {
+		t.Errorf("X warning = %q\nwant %q", warnings[0].Message, want)
+	}
+	if len(warnings[0].Cells) != 11 || warnings[0].Cells[0] != [2]int{1, 2} {
+		t.Errorf("X cells = %v, want all 11 from row 1, col 2", warnings[0].Cells)
+	}
+	if want := `unknown tileset key "Y" at row 3, col 5`; !strings.HasSuffix(warnings[1].Message, want) {
+		t.Errorf("Y warning = %q, want it to end with %q", warnings[1].Message, want)
+	}
+}
+
+func TestDescribeCells(t *testing.T) {
+	tests := []struct {
+		name  string
+		cells [][2]int
+		want  string
+	}{
+		{"one", [][2]int{{3, 7}}, "at row 3, col 7"},
+		{"run", [][2]int{{2, 1}, {2, 2}, {2, 3}}, "in 3 cells: row 2, cols 1-3"},
+		{"column", [][2]int{{1, 4}, {2, 4}, {3, 4}}, "in 3 cells: rows 1-3, col 4"},
+		{"gap between rows", [][2]int{{1, 1}, {1, 2}, {3, 1}, {3, 2}}, "in 4 cells: row 1, cols 1-2; row 3, cols 1-2"},
+		{"staircase", [][2]int{{1, 1}, {1, 2}, {2, 2}, {2, 3}}, "in 4 cells: row 1, cols 1-2; row 2, cols 2-3"},
+		{"capped", [][2]int{{1, 1}, {1, 3}, {1, 5}, {1, 7}, {1, 9}, {1, 11}}, "in 6 cells: row 1, col 1; row 1, col 3; row 1, col 5; row 1, col 7; and 2 more regions"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := describeCells(tt.cells); got != tt.want {
+				t.Errorf("describeCells = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestParseMapFile_RaggedRows(t *testing.T) {
 	input := []byte(`
 tile_size = 8
@@ -131,6 +190,48 @@ GG
 	}
 }
 
+func TestParseMapFile_BracketKeys(t *testing.T) {
+	input := []byte(`
+tile_size = 8
+
+[tileset]
+G = "tiles:grass"
+gr1 = "tiles:grass_edge"
+wall = "tiles:wall"
+_ = ""
+
+[layer.main]
+pixels = """
+G[gr1]_
+[gr1]G_
+"""
+`)
+	mf, warnings, err := ParseMapFile(input, "test.map")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := mf.Layers[0]
+	if len(l.Data[0]) != 3 {
+		t.Fatalf("row width = %d, want 3", len(l.Data[0]))
+	}
+	if l.Keys[0][1] != "gr1" || l.Data[0][1] != mf.TileIDs["gr1"] || l.Data[1][0] != mf.TileIDs["gr1"] {
+		t.Errorf("keys = %q, data = %v, want gr1 at (1,0) and (0,1)", l.Keys, l.Data)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0].Message, `tileset key "wall" is longer than one character, but no layer uses it as [wall]`) {
+		t.Errorf("warnings = %v, want one about the unbracketed wall", warnings)
+	}
+}
+
+func TestParseMapFile_InvalidTilesetKey(t *testing.T) {
+	for _, key := range []string{`"[g]"`, `"a]"`, `""`} {
+		input := []byte("tile_size = 8\n[tileset]\n" + key + " = \"tiles:grass\"\n")
+		_, _, err := ParseMapFile(input, "test.map")
+		if err == nil || !strings.Contains(err.Error(), "must not be empty or contain brackets") {
+			t.Errorf("key %s: err = %v, want a bracket error", key, err)
+		}
+	}
+}
+
 func TestParseMapFile_InvalidTileSize(t *testing.T) {
 	input := []byte(`
 tile_size = 0
@@ -144,10 +245,211 @@ G = "tiles:grass"
 	}
 }
 
+func TestParseMapFile_TileProperties(t *testing.T) {
+	input := []byte(`
+tile_size = 16
+
+[tileset]
+s = { sprite = "tiles:stone", solid = true, tags = ["ground", "hard"] }
+g = "tiles:grass"
+w = { sprite = "tiles:water", tags = ["liquid"] }
+_ = ""
+
+[layer.main]
+pixels = """
+sgw_
+"""
+`)
+	mf, _, err := ParseMapFile(input, "test.map")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mf.Tileset["s"] != "tiles:stone" || mf.Tileset["g"] != "tiles:grass" || mf.Tileset["_"] != "" {
+		t.Errorf("tileset = %v", mf.Tileset)
+	}
+	if p := mf.TileProps["s"]; !p.Solid || len(p.Tags) != 2 || p.Tags[0] != "ground" {
+		t.Errorf("s props = %+v", p)
+	}
+	if p := mf.TileProps["w"]; p.Solid || len(p.Tags) != 1 {
+		t.Errorf("w props = %+v", p)
+	}
+	if _, ok := mf.TileProps["g"]; ok {
+		t.Error("string shorthand should have no properties entry")
+	}
+
+	j := mf.ToJSON()
+	if !j.Tileset["s"].Properties.Solid {
+		t.Errorf("json s = %+v", j.Tileset["s"])
+	}
+	data, err := json.Marshal(j.Tileset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), `"properties":{`); n != 3 {
+		t.Errorf("want a properties object on all 3 entries, got %d in %s", n, data)
+	}
+}
+
+func TestMapFile_AnimatedTiles(t *testing.T) {
+	input := []byte(`
+tile_size = 16
+
+[tileset]
+w = { sprite = "tiles:water", animate = true }
+l = { sprite = "tiles:lava", animate = true, solid = true }
+s = { sprite = "tiles:stone", animate = false }
+g = "tiles:grass"
+
+[layer.main]
+pixels = """
+wlsg
+"""
+`)
+	mf, _, err := ParseMapFile(input, "test.map")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := mf.AnimatedKeys(); len(keys) != 2 || keys[0] != "l" || keys[1] != "w" {
+		t.Errorf("animated keys = %v, want [l w]", keys)
+	}
+
+	mf.Animations = map[string]TileAnimation{"w": {Frames: 4, FPS: 8}}
+	j := mf.ToJSON()
+	if w := j.Tileset["w"]; w.Frames != 4 || w.FPS != 8 {
+		t.Errorf("w = %+v", w)
+	}
+	data, err := json.Marshal(j.Tileset["g"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "frames") || strings.Contains(string(data), "animate") {
+		t.Errorf("static tile should have no animation fields: %s", data)
+	}
+}
+
+func TestParseMapFile_TilePropertiesErrors(t *testing.T) {
+	tests := map[string]string{
+		`s = { solid = true }`:                            "sprite must be a string",
+		`s = { sprite = "tiles:stone", solid = 1 }`:       "solid must be true or false",
+		`s = { sprite = "tiles:stone", tags = [1] }`:      "tags must be an array of strings",
+		`s = { sprite = "tiles:stone", slippy = 1 }`:      `unknown field "slippy"`,
+		`s = { sprite = "tiles:stone", animate = "yes" }`: "animate must be true or false",
+		`s = 3`: "expected a sprite reference or a table",
+	}
+	for entry, want := range tests {
+		input := "tile_size = 8\n[tileset]\n" + entry + "\n"
+		_, _, err := ParseMapFile([]byte(input), "bad.map")
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: err = %v, want %q", entry, err, want)
+		}
+	}
+}
+
+func TestParseMapFile_TileIDs(t *testing.T) {
+	input := `tile_size = 8
+[tileset]
+_ = ""
+c = "tiles:c"
+a = "tiles:a"
+d = { sprite = "tiles:d", id = 2 }
+b = "tiles:b"
+
+[layer.ground]
+pixels = """
+abcd_
+"""
+`
+	mf, _, err := ParseMapFile([]byte(input), "ids.map")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// d keeps its pinned id; the rest fill the free ids in key order.
+	want := map[string]int{"_": 0, "a": 1, "b": 3, "c": 4, "d": 2}
+	for key, id := range want {
+		if mf.TileIDs[key] != id {
+			t.Errorf("id of %q = %d, want %d", key, mf.TileIDs[key], id)
+		}
+	}
+	if got := mf.Layers[0].Data[0]; !slices.Equal(got, []int{1, 3, 4, 2, 0}) {
+		t.Errorf("layer data = %v", got)
+	}
+	if j := mf.ToJSON(); j.Tileset["d"].Index != 2 {
+		t.Errorf("JSON index of d = %d, want 2", j.Tileset["d"].Index)
+	}
+}
+
+func TestParseMapFile_TileIDErrors(t *testing.T) {
+	tests := map[string]string{
+		"a = { sprite = \"t:a\", id = 1 }\nb = { sprite = \"t:b\", id = 1 }": `"b": id 1 is already used by "a"`,
+		"a = { sprite = \"\", id = 1 }":                                      "id is set on an empty tile",
+		"a = { sprite = \"t:a\", id = 0 }":                                   "id must be a positive integer",
+		"a = { sprite = \"t:a\", id = \"1\" }":                               "id must be a positive integer",
+	}
+	for entry, want := range tests {
+		input := "tile_size = 8\n[tileset]\n" + entry + "\n"
+		_, _, err := ParseMapFile([]byte(input), "bad.map")
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: err = %v, want %q", entry, err, want)
+		}
+	}
+}
+
+func TestMapFile_TileIDChanges(t *testing.T) {
+	prev := &JSONTilemap{Tileset: map[string]JSONTileRef{
+		"a": {Index: 1},
+		"b": {Index: 2},
+		"c": {Index: 3},
+	}}
+	mf := &MapFile{TileIDs: map[string]int{"a": 1, "b": 3, "n": 2, "_": 0}}
+	changes := mf.TileIDChanges(prev)
+	if len(changes) != 2 {
+		t.Fatalf("changes = %q, want 2", changes)
+	}
+	if !strings.Contains(changes[0], `"b": index changes from 2 to 3`) || !strings.Contains(changes[0], "id = 2") {
+		t.Errorf("changes[0] = %q", changes[0])
+	}
+	if !strings.Contains(changes[1], `"n": index 2 was "b"`) {
+		t.Errorf("changes[1] = %q", changes[1])
+	}
+
+	if changes := mf.TileIDChanges(&JSONTilemap{Tileset: map[string]JSONTileRef{"a": {Index: 1}}}); len(changes) != 0 {
+		t.Errorf("unchanged ids reported: %q", changes)
+	}
+}
+
+func TestMapFile_CheckTileSize(t *testing.T) {
+	mf := &MapFile{TileSize: 16, Tileset: map[string]string{"g": "tiles:grass"}}
+	tests := []struct {
+		w, h     int
+		allow    bool
+		bad      bool
+		mentions string
+	}{
+		{16, 16, false, false, ""},
+		{32, 32, false, true, "allow_oversized_tiles"},
+		{32, 32, true, false, ""},
+		{32, 16, true, false, ""},
+		{24, 24, true, true, "overlap"},
+		{8, 8, true, true, "gaps"},
+		{16, 8, false, true, "16x8"},
+	}
+	for _, tt := range tests {
+		msg, bad := mf.CheckTileSize("g", tt.w, tt.h, tt.allow)
+		if bad != tt.bad {
+			t.Errorf("%dx%d allow=%v: bad = %v, want %v", tt.w, tt.h, tt.allow, bad, tt.bad)
+			continue
+		}
+		if bad && (!strings.Contains(msg, `"g"`) || !strings.Contains(msg, "tile_size is 16") || !strings.Contains(msg, tt.mentions)) {
+			t.Errorf("%dx%d: message %q should name the key, both sizes and %q", tt.w, tt.h, msg, tt.mentions)
+		}
+	}
+}
+
 func TestToJSON(t *testing.T) {
 	mf := &MapFile{
 		TileSize: 16,
 		Tileset:  map[string]string{"G": "tiles:grass", "_": ""},
+		TileIDs:  map[string]int{"G": 1, "_": 0},
 		Layers: []Layer{
 			{
 				Name:    "bg",
@@ -179,7 +481,7 @@ func TestToJSON(t *testing.T) {
 	if !ok {
 		t.Fatal("missing tileset entry G")
 	}
-	if ref.Source != "tiles.png" || ref.Sprite != "grass" {
+	if ref.Source != "tiles.png" || ref.Sprite != "grass" || ref.Index != 1 {
 		t.Errorf("tileset G = %+v", ref)
 	}
 	if len(j.Layers) != 2 {
@@ -187,6 +489,193 @@ func TestToJSON(t *testing.T) {
 	}
 }
 
+func TestParseMapFile_LayerOrder(t *testing.T) {
+	input := []byte(`
+tile_size = 8
+
+[tileset]
+G = "tiles:grass"
+
+[layer.sky]
+pixels = "G"
+
+[layer."far hills"]
+scroll_x = 0.5
+pixels = "G"
+
+[layer.objects]
+[[layer.objects.entity]]
+type = "spawn"
+
+[layer.front]
+pixels = "G"
+`)
+	want := []string{"sky", "far hills", "objects", "front"}
+	for range 10 {
+		mf, _, err := ParseMapFile(input, "test.map")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, l := range mf.Layers {
+			got = append(got, l.Name)
+		}
+		if !slices.Equal(got, want) {
+			t.Fatalf("layers = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestParseMapFile_EmptyEntityLayer(t *testing.T) {
+	input := []byte(`
+tile_size = 8
+
+[tileset]
+G = "tiles:grass"
+
+[layer.main]
+pixels = """
+GG
+"""
+
+[layer.spawns]
+type = "entity"
+`)
+	mf, _, err := ParseMapFile(input, "test.map")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(mf.ToJSON())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var raw struct {
+		Layers []map[string]json.RawMessage `json:"layers"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range raw.Layers {
+		_, hasEntities := l["entities"]
+		switch name := string(l["name"]); name {
+		case `"spawns"`:
+			if string(l["type"]) != `"entity"` || string(l["entities"]) != "[]" {
+				t.Errorf("spawns = %s, want an entity layer with entities: []", data)
+			}
+		case `"main"`:
+			if hasEntities {
+				t.Errorf("tile layer has entities: %s", data)
+			}
+		}
+	}
+
+	var j JSONTilemap
+	if err := json.Unmarshal(data, &j); err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range j.Layers {
+		if l.Name == "spawns" && (l.Type != "entity" || l.Entities == nil || len(l.Entities) != 0) {
+			t.Errorf("spawns round-tripped as %+v", l)
+		}
+	}
+}
+
+func TestParseMapFile_LayerTypeErrors(t *testing.T) {
+	for _, tt := range []struct {
+		layer, want string
+	}{
+		{"type = \"sprite\"", `type "sprite" must be "tile" or "entity"`},
+		{"type = \"entity\"\npixels = \"G\"", "an entity layer can't have pixels"},
+		{"type = \"tile\"\n[[layer.l.entity]]\ntype = \"spawn\"", "a tile layer can't have entities"},
+	} {
+		input := []byte("tile_size = 8\n[tileset]\nG = \"tiles:grass\"\n[layer.l]\n" + tt.layer + "\n")
+		_, _, err := ParseMapFile(input, "test.map")
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: err = %v, want %q", tt.layer, err, tt.want)
+		}
+	}
+}
+
+func TestParseMapFile_TintPresets(t *testing.T) {
+	input := []byte(`
+tile_size = 8
+
+[tileset]
+G = "tiles:grass"
+
+[layer.sky]
+pixels = "G"
+[layer.sky.tint]
+color = "#ffeedd"
+
+[layer.ground]
+pixels = "G"
+
+[presets.night]
+sky = { color = "#334466", mode = "multiply" }
+ground = { color = "#556677" }
+
+[presets.dusk]
+ground = { color = "#c08060" }
+`)
+	mf, _, err := ParseMapFile(input, "test.map")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := mf.PresetNames(); !slices.Equal(got, []string{"dusk", "night"}) {
+		t.Errorf("presets = %q, want [dusk night]", got)
+	}
+
+	j := mf.ToJSON()
+	if tint := j.Layers[0].Tint; tint == nil || *tint != (JSONTint{Color: "#ffeedd", Mode: "multiply"}) {
+		t.Errorf("sky tint = %+v, want #ffeedd multiply", tint)
+	}
+	if j.Layers[1].Tint != nil {
+		t.Errorf("ground tint = %+v, want none", j.Layers[1].Tint)
+	}
+	want := map[string]map[string]JSONTint{
+		"night": {"sky": {"#334466", "multiply"}, "ground": {"#556677", "multiply"}},
+		"dusk":  {"sky": {"#ffeedd", "multiply"}, "ground": {"#c08060", "multiply"}},
+	}
+	for name, tints := range want {
+		for layer, tint := range tints {
+			if got := j.Presets[name][layer]; got != tint {
+				t.Errorf("preset %s layer %s = %+v, want %+v", name, layer, got, tint)
+			}
+		}
+	}
+}
+
+func TestParseMapFile_TintErrors(t *testing.T) {
+	for _, tt := range []struct {
+		extra, want string
+	}{
+		{"[layer.l.tint]\nmode = \"multiply\"", "tint: color is required"},
+		{"[layer.l.tint]\ncolor = \"#33446680\"", "must be opaque"},
+		{"[layer.l.tint]\ncolor = \"#334466\"\nmode = \"screen\"", `mode "screen" must be "multiply"`},
+		{"[presets.night]\nsky = { color = \"#334466\" }", `preset "night": unknown layer "sky"`},
+	} {
+		input := []byte("tile_size = 8\n[tileset]\nG = \"tiles:grass\"\n[layer.l]\npixels = \"G\"\n" + tt.extra + "\n")
+		_, _, err := ParseMapFile(input, "test.map")
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: err = %v, want %q", tt.extra, err, tt.want)
+		}
+	}
+}
+
+func TestToJSON_SlashSource(t *testing.T) {
+	mf := &MapFile{
+		TileSize: 16,
+		Tileset:  map[string]string{"G": `world\tiles:grass`},
+		TileIDs:  map[string]int{"G": 1},
+	}
+
+	if got := mf.ToJSON().Tileset["G"].Source; got != "world/tiles.png" {
+		t.Errorf("source = %q, want world/tiles.png", got)
+	}
+}
+
 func TestWriteJSON(t *testing.T) {
 	tm := &JSONTilemap{
 		TileSize: 8,
@@ -226,3 +715,46 @@ func TestParseSpriteRef(t *testing.T) {
 		t.Errorf("got %q, %q, want nocolon, empty", file, spriteName)
 	}
 }
+
+func TestUnusedTilesetKeys(t *testing.T) {
+	input := []byte(`tile_size = 8
+[tileset]
+g = "tiles:grass"
+s = "tiles:stone"
+w = "tiles:water"
+_ = ""
+
+[layer.ground]
+pixels = """
+gg
+_g
+"""
+
+[layer.fg]
+pixels = """
+__
+w_
+"""
+
+[[layer.things.entity]]
+type = "coin"
+x = 1
+y = 1
+[layer.things.entity.properties]
+sprite = "items:coin"
+`)
+	mf, _, err := ParseMapFile(input, "test.map")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := mf.UnusedTilesetKeys(); len(got) != 1 || got[0] != "s" {
+		t.Errorf("UnusedTilesetKeys = %v, want [s]", got)
+	}
+
+	refs := mf.SpriteRefs()
+	sort.Strings(refs)
+	want := "items:coin,tiles:grass,tiles:stone,tiles:water"
+	if got := strings.Join(refs, ","); got != want {
+		t.Errorf("SpriteRefs = %s, want %s", got, want)
+	}
+}
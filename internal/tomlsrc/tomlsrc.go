@@ -0,0 +1,90 @@
+// Package tomlsrc reads what the TOML decoder leaves out: the order keys
+// are written in and where they sit in the source. Asset formats decode
+// their tables into maps, so anything that must follow the file, like the
+// row order of a sprite sheet or the draw order of map layers, comes from
+// a second pass over the parsed expressions.
+package tomlsrc
+
+import (
+	"bytes"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2/unstable"
+)
+
+// Normalize returns data without a UTF-8 byte order mark and with every
+// CRLF or lone CR line ending turned into LF. Parsers call it before
+// decoding, so a file saved by a Windows editor reads the same as any
+// other, down to the line numbers in errors.
+func Normalize(data []byte) []byte {
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+	if bytes.IndexByte(data, '\r') < 0 {
+		return data
+	}
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(data, []byte("\r"), []byte("\n"))
+}
+
+// Order returns the keys of the table named table in the order they first
+// appear in data. A key counts whether it is written as a [table.key]
+// header, a dotted key or an inline table. Keys of m that data doesn't
+// mention go last, sorted, so the result always covers m exactly once.
+func Order[V any](data []byte, table string, m map[string]V) []string {
+	var order []string
+	seen := map[string]bool{}
+	var p unstable.Parser
+	p.Reset(data)
+	var header []string
+	for p.NextExpression() {
+		n := p.Expression()
+		var path []string
+		switch n.Kind {
+		case unstable.Table, unstable.ArrayTable:
+			header = KeyPath(n)
+			path = header
+		case unstable.KeyValue:
+			path = append(slices.Clone(header), KeyPath(n)...)
+		}
+		if len(path) >= 2 && path[0] == table && !seen[path[1]] {
+			if _, ok := m[path[1]]; ok {
+				seen[path[1]] = true
+				order = append(order, path[1])
+			}
+		}
+	}
+	// The data already decoded, so every key should have been seen; any
+	// that weren't still go last, in a stable order.
+	var rest []string
+	for name := range m {
+		if !seen[name] {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	return append(order, rest...)
+}
+
+// KeyPath returns the parts of a table header or key-value key.
+func KeyPath(n *unstable.Node) []string {
+	var path []string
+	for it := n.Key(); it.Next(); {
+		path = append(path, string(it.Node().Data))
+	}
+	return path
+}
+
+// NextLine splits off the first line of s. Lines end at LF, CRLF or a lone
+// CR, the endings Normalize turns into LF, so a string handed straight to
+// a helper like sprite.ParsePixelGrid splits as it would in a parsed file.
+func NextLine(s string) (line, rest string) {
+	i := strings.IndexAny(s, "\r\n")
+	if i < 0 {
+		return s, ""
+	}
+	if s[i] == '\r' && i+1 < len(s) && s[i+1] == '\n' {
+		return s[:i], s[i+2:]
+	}
+	return s[:i], s[i+1:]
+}
@@ -0,0 +1,80 @@
+package tomlsrc
+
+import (
+	"slices"
+	"testing"
+
+	toml "github.com/pelletier/go-toml/v2"
+)
+
+func TestOrder_DottedKeys(t *testing.T) {
+	input := []byte(`
+[layer]
+c = { pixels = "G" }
+a.pixels = "G"
+
+[layer.b]
+pixels = "G"
+`)
+	var raw struct {
+		Layer map[string]any `toml:"layer"`
+	}
+	if err := toml.Unmarshal(input, &raw); err != nil {
+		t.Fatal(err)
+	}
+	if got := Order(input, "layer", raw.Layer); !slices.Equal(got, []string{"c", "a", "b"}) {
+		t.Errorf("order = %q, want [c a b]", got)
+	}
+}
+
+func TestOrder_OtherTablesAndMissingKeys(t *testing.T) {
+	input := []byte(`
+[sprite.b.pivot]
+x = 1
+
+[palette]
+a = "#000000"
+
+[sprite.a]
+grid = 1
+`)
+	m := map[string]int{"a": 0, "b": 0, "z": 0, "y": 0}
+	// Keys only the map knows about go last, sorted; keys of other tables
+	// never show up.
+	if got := Order(input, "sprite", m); !slices.Equal(got, []string{"b", "a", "y", "z"}) {
+		t.Errorf("order = %q, want [b a y z]", got)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"a = 1\n", "a = 1\n"},
+		{"\ufeffa = 1\r\nb = 2\r\n", "a = 1\nb = 2\n"},
+		{"a = 1\rb = 2", "a = 1\nb = 2"},
+		{"a = \"\ufeff\"\r\n", "a = \"\ufeff\"\n"},
+	}
+	for _, tt := range tests {
+		if got := string(Normalize([]byte(tt.in))); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNextLine(t *testing.T) {
+	tests := []struct {
+		in, line, rest string
+	}{
+		{"ab", "ab", ""},
+		{"ab\ncd", "ab", "cd"},
+		{"ab\r\ncd", "ab", "cd"},
+		{"ab\rcd", "ab", "cd"},
+		{"\n\ncd", "", "\ncd"},
+		{"ab\r", "ab", ""},
+	}
+	for _, tt := range tests {
+		line, rest := NextLine(tt.in)
+		if line != tt.line || rest != tt.rest {
+			t.Errorf("NextLine(%q) = %q, %q, want %q, %q", tt.in, line, rest, tt.line, tt.rest)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package track
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sync"
+
+	"github.com/vgalaktionov/runefact/internal/instrument"
+)
+
+// A BlockCache keeps the blocks of a track's last render, so rendering it
+// again after an edit synthesizes only the patterns that changed. A block
+// is one pass through a pattern, keyed by everything that shapes its
+// samples: the pattern's rows, the channels' instruments, the tick length
+// and the notes still sounding when it starts. Gain, ducking and the
+// limiter are applied after the blocks are stitched, so a volume change
+// reuses every block.
+//
+// A cache is meant for one track. Each render keeps only the blocks it
+// used. It is safe for concurrent use.
+type BlockCache struct {
+	mu     sync.Mutex
+	blocks map[string]*block
+
+	// hits and misses count lookups, for tests.
+	hits, misses int
+}
+
+// NewBlockCache returns an empty cache.
+func NewBlockCache() *BlockCache {
+	return &BlockCache{blocks: make(map[string]*block)}
+}
+
+// Len returns how many blocks the cache holds.
+func (c *BlockCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.blocks)
+}
+
+// Reset drops every block, as when an instrument file changes.
+func (c *BlockCache) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.blocks = make(map[string]*block)
+}
+
+func (c *BlockCache) get(key string) *block {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b := c.blocks[key]
+	if b != nil {
+		c.hits++
+	} else {
+		c.misses++
+	}
+	return b
+}
+
+func (c *BlockCache) put(key string, b *block) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.blocks[key] = b
+}
+
+// keep drops the blocks a finished render didn't use.
+func (c *BlockCache) keep(used map[string]bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.blocks {
+		if !used[key] {
+			delete(c.blocks, key)
+		}
+	}
+}
+
+// block is one pass through a pattern: a buffer per channel, before gain,
+// and the channel states it ends in.
+type block struct {
+	channels [][]float64
+	exit     []blockState
+}
+
+// blockState is a channel's note state at a tick boundary: whether a note
+// is sounding, its pitch, and how many ticks ago it started. A silent
+// channel is the zero value, so equal states give equal keys.
+type blockState struct {
+	active bool
+	freq   float64
+	since  int
+}
+
+// blockKey hashes everything renderBlock reads. insts holds each channel's
+// instrumentKey. A channel's entry state is left out when the pattern
+// starts a note or stops it before anything could hear the old one, so a
+// pattern that opens on a new note is one block wherever it plays.
+func blockKey(p *Pattern, entry []blockState, insts []string, sampleRate, samplesPerTick int) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d %d %d\n", sampleRate, samplesPerTick, p.Len())
+	for i, st := range entry {
+		if p.resets(i) {
+			st = blockState{}
+		}
+		fmt.Fprintf(h, "%s %+v\n", insts[i], st)
+	}
+	for _, row := range p.Rows {
+		fmt.Fprintf(h, "%+v\n", row)
+	}
+	return string(h.Sum(nil))
+}
+
+// resets reports whether the first cell of channel ch that isn't silence
+// starts or stops a note, so the note sounding before the pattern is never
+// heard in it and doesn't carry past it.
+func (p *Pattern) resets(ch int) bool {
+	for _, row := range p.Rows {
+		if ch >= len(row) {
+			continue
+		}
+		switch row[ch].Type {
+		case NoteOn, NoteOff:
+			return true
+		case Sustain:
+			return false
+		}
+	}
+	return false
+}
+
+// instrumentKey describes what an instrument sounds like, so that a block
+// rendered with it is found again only while it is unchanged. It ignores
+// the name, which doesn't affect the sound, and is "-" for a missing
+// instrument.
+func instrumentKey(inst *instrument.Instrument) string {
+	if inst == nil {
+		return "-"
+	}
+	filter := "none"
+	if inst.Filter != nil {
+		filter = fmt.Sprintf("%+v", *inst.Filter)
+	}
+	sample := "none"
+	if sd := inst.Sample; sd != nil && sd.Data != nil {
+		sample = fmt.Sprintf("%d %d %d %x", sd.Root, sd.LoopStart, sd.LoopEnd, sd.Data.Sum)
+	}
+	return fmt.Sprintf("%+v %+v %s %+v %s", inst.Oscillator, inst.Envelope, filter, inst.Effects, sample)
+}
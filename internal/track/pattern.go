@@ -0,0 +1,185 @@
+package track
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2/unstable"
+
+	"github.com/vgalaktionov/runefact/internal/diagnostic"
+	"github.com/vgalaktionov/runefact/internal/tomlsrc"
+)
+
+// maxPatternRows is the most rows, and so ticks, a pattern may have, and
+// maxColumns the most columns a row may have. They keep a runaway pattern
+// from exhausting memory.
+const (
+	maxPatternRows = 1 << 16
+	maxColumns     = 64
+)
+
+// parsePattern parses a pattern's data one line at a time. All rows share
+// one backing array of notes and the column buffer is reused, so a pattern
+// costs the same few allocations however long it is. line is the file line
+// the data starts on; when it is 0, errors give only the row number.
+//
+// The first line must be a header naming channels in order. With
+// optionalHeader, it may be left out or name the channels differently, as
+// older files did.
+func parsePattern(name string, raw rawPattern, channels []string, optionalHeader bool, line int, filename string) (*Pattern, error) {
+	errAt := func(k int, err error) error {
+		if line > 0 {
+			err = &diagnostic.LineError{Line: line + k, Err: err}
+		}
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+
+	numChannels := len(channels)
+	data := raw.Data
+	maxRows := min(strings.Count(data, "\n")+1, maxPatternRows)
+	p := &Pattern{Name: name, Rows: make([][]Note, 0, maxRows)}
+	notes := make([]Note, 0, maxRows*max(numChannels, 1))
+	var cols []string
+
+	header := true
+	for k := 0; data != ""; k++ {
+		var text string
+		text, data = tomlsrc.NextLine(data)
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		if header {
+			header = false
+			err := checkHeader(text, channels)
+			if err == nil {
+				continue
+			}
+			if !optionalHeader {
+				return nil, errAt(k, fmt.Errorf("pattern %q: %w", name, err))
+			}
+			if !IsNoteRow(text) {
+				continue
+			}
+			// No header: the line is the first row.
+		}
+
+		row := len(p.Rows) + 1
+		if row > maxPatternRows {
+			return nil, errAt(k, fmt.Errorf("pattern %q has more than %d rows", name, maxPatternRows))
+		}
+		// Count the columns before splitting them, so a line of a million
+		// pipes costs nothing.
+		switch n := strings.Count(text, "|") + 1; {
+		case numChannels > 0 && n != numChannels:
+			return nil, errAt(k, fmt.Errorf("pattern %q row %d: got %d columns, expected %d",
+				name, row, n, numChannels))
+		case n > maxColumns:
+			return nil, errAt(k, fmt.Errorf("pattern %q row %d: got %d columns, at most %d are allowed",
+				name, row, n, maxColumns))
+		}
+		cols = splitColumns(cols[:0], text)
+		start := len(notes)
+		for j, cell := range cols {
+			note, err := parseNote(cell)
+			if err != nil {
+				return nil, errAt(k, fmt.Errorf("pattern %q row %d col %d: %w", name, row, j+1, err))
+			}
+			notes = append(notes, note)
+		}
+		p.Rows = append(p.Rows, notes[start:len(notes):len(notes)])
+	}
+	if header {
+		return nil, fmt.Errorf("%s: pattern %q: empty data", filename, name)
+	}
+
+	p.Ticks = raw.Ticks
+	switch rows := len(p.Rows); {
+	case p.Ticks > maxPatternRows:
+		return nil, fmt.Errorf("%s: pattern %q: ticks = %d, at most %d are allowed",
+			filename, name, p.Ticks, maxPatternRows)
+	case p.Ticks <= 0:
+		p.Ticks = rows
+	case rows > p.Ticks:
+		return nil, fmt.Errorf("%s: pattern %q has %d rows but ticks = %d, remove rows or raise ticks",
+			filename, name, rows, p.Ticks)
+	case rows < p.Ticks && !raw.Pad:
+		return nil, fmt.Errorf("%s: pattern %q has %d rows but ticks = %d, add rows or set pad = true to fill with silence",
+			filename, name, rows, p.Ticks)
+	}
+	return p, nil
+}
+
+// checkHeader checks that a pattern's header line names channels in order.
+// The labels may follow a "#" to mark the line as a comment.
+func checkHeader(text string, channels []string) error {
+	labels := splitColumns(nil, strings.TrimPrefix(strings.TrimSpace(text), "#"))
+	if len(channels) == 0 || slices.Equal(labels, channels) {
+		return nil
+	}
+	err := fmt.Sprintf("header mismatch: expected %q, found %q",
+		strings.Join(channels, " | "), strings.Join(labels, " | "))
+	if IsNoteRow(text) {
+		err += " (is the header line missing?)"
+	}
+	return errors.New(err)
+}
+
+// IsNoteRow reports whether every column of text parses as a note, as the
+// rows of pattern data do and a channel header doesn't.
+func IsNoteRow(text string) bool {
+	for _, cell := range splitColumns(nil, text) {
+		if _, err := parseNote(cell); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// splitColumns appends the trimmed "|"-separated cells of line to dst.
+func splitColumns(dst []string, line string) []string {
+	for {
+		cell, rest, found := strings.Cut(line, "|")
+		dst = append(dst, strings.TrimSpace(cell))
+		if !found {
+			return dst
+		}
+		line = rest
+	}
+}
+
+// patternDataLines returns the file line each pattern's data starts on,
+// from a light pass over the TOML expressions. Patterns whose data isn't a
+// multiline string are left out, since all their rows are on one line.
+func patternDataLines(data []byte) map[string]int {
+	lines := map[string]int{}
+	var p unstable.Parser
+	p.Reset(data)
+	var table []string
+	for p.NextExpression() {
+		n := p.Expression()
+		switch n.Kind {
+		case unstable.Table, unstable.ArrayTable:
+			table = tomlsrc.KeyPath(n)
+		case unstable.KeyValue:
+			path := append(slices.Clone(table), tomlsrc.KeyPath(n)...)
+			if len(path) != 3 || path[0] != "pattern" || path[2] != "data" {
+				continue
+			}
+			v := n.Value()
+			raw := p.Raw(v.Raw)
+			if !bytes.HasPrefix(raw, []byte(`"""`)) && !bytes.HasPrefix(raw, []byte(`'''`)) {
+				continue
+			}
+			line := p.Shape(v.Raw).Start.Line
+			// A newline right after the opening quotes isn't part of the data.
+			if bytes.HasPrefix(raw[3:], []byte("\n")) {
+				line++
+			}
+			lines[path[1]] = line
+		}
+	}
+	return lines
+}
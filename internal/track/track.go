@@ -1,28 +1,60 @@
 package track
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"maps"
 	"math"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	toml "github.com/pelletier/go-toml/v2"
 
 	"github.com/vgalaktionov/runefact/internal/audio"
+	"github.com/vgalaktionov/runefact/internal/diagnostic"
 	"github.com/vgalaktionov/runefact/internal/instrument"
+	"github.com/vgalaktionov/runefact/internal/tomlsrc"
 )
 
 // Track represents a parsed .track file.
 type Track struct {
 	Tempo        int
 	TicksPerBeat int
+	BeatsPerBar  int // for the preview's beat grid; the audio ignores it
 	Loop         bool
 	LoopStart    int
+	// LoopCrossfade is how many seconds at the end of a looping track
+	// fade into the audio just before its loop start, so the loop seam
+	// doesn't click.
+	LoopCrossfade float64
 	Channels     []Channel
 	Patterns     map[string]*Pattern
 	Sequence     []string
+
+	// ExportPatterns are patterns the build also writes as WAVs of their
+	// own; ExportFull is false if it writes only those, not the song.
+	ExportPatterns []string
+	ExportFull     bool
+
+	// Buses group channels under a shared volume; MasterVolume scales
+	// every channel.
+	Buses        map[string]*Bus
+	MasterVolume float64
+
+	// Warnings are non-fatal issues found while parsing.
+	Warnings []string
+}
+
+// Bus is a named volume control shared by the channels routed to it.
+type Bus struct {
+	Name   string
+	Volume float64
 }
 
 // Channel defines a named channel with an instrument reference and volume.
@@ -30,15 +62,34 @@ type Channel struct {
 	Name       string `toml:"name"`
 	Instrument string `toml:"instrument"`
 	Volume     float64 `toml:"volume"`
+	Bus        string  `toml:"bus"`
+	Duck       *Duck   `toml:"duck"`
+}
+
+// Duck lowers a channel's volume while a source channel, or every channel
+// on a source bus, is sounding. Amount is the gain reduction at full source
+// amplitude; Release is how many seconds the gain takes to recover.
+type Duck struct {
+	Source  string  `toml:"source"`
+	Amount  float64 `toml:"amount"`
+	Release float64 `toml:"release"`
 }
 
-// Pattern holds rows of notes, one per tick.
+// Pattern holds rows of notes, one per tick. A pattern plays for Ticks
+// ticks; when it was padded there are fewer Rows, and the ticks past the
+// last row are silent.
 type Pattern struct {
 	Name  string
 	Ticks int
 	Rows  [][]Note // [tick][channel]
 }
 
+// Len returns how many ticks the pattern plays for: Ticks, but never fewer
+// than there are rows.
+func (p *Pattern) Len() int {
+	return max(p.Ticks, len(p.Rows))
+}
+
 // NoteType classifies what a cell in a pattern represents.
 type NoteType int
 
@@ -72,12 +123,35 @@ func (n Note) Freq() float64 {
 	return audio.MIDIToFreq(midi)
 }
 
+// MIDI returns the MIDI note number of a NoteOn.
+func (n Note) MIDI() int {
+	return noteToMIDI(n.Name, n.Octave)
+}
+
+// semitones maps the note names a pattern may use to their offset from C.
+var semitones = map[string]int{
+	"C": 0, "C#": 1, "D": 2, "D#": 3, "E": 4, "F": 5,
+	"F#": 6, "G": 7, "G#": 8, "A": 9, "A#": 10, "B": 11,
+}
+
+// noteNames lists the keys of semitones in pitch order, for suggestions.
+var noteNames = []string{"C", "C#", "D", "D#", "E", "F", "F#", "G", "G#", "A", "A#", "B"}
+
+// noteSpellings maps other ways of writing a note to the name patterns use:
+// flats, sharps that land on a natural, and the German H for B.
+var noteSpellings = map[string]string{
+	"Db": "C#", "Eb": "D#", "Gb": "F#", "Ab": "G#", "Bb": "A#",
+	"Cb": "B", "Fb": "E", "E#": "F", "B#": "C", "H": "B",
+}
+
+// Octaves outside this range are almost certainly typos, like C44 for C4.
+const (
+	minOctave = 0
+	maxOctave = 9
+)
+
 // noteToMIDI converts a note name and octave to MIDI number.
 func noteToMIDI(name string, octave int) int {
-	semitones := map[string]int{
-		"C": 0, "C#": 1, "D": 2, "D#": 3, "E": 4, "F": 5,
-		"F#": 6, "G": 7, "G#": 8, "A": 9, "A#": 10, "B": 11,
-	}
 	s, ok := semitones[name]
 	if !ok {
 		return 60 // default to C4
@@ -89,24 +163,41 @@ func noteToMIDI(name string, octave int) int {
 type rawTrack struct {
 	Tempo        int        `toml:"tempo"`
 	TicksPerBeat int        `toml:"ticks_per_beat"`
+	BeatsPerBar  int        `toml:"beats_per_bar"`
 	Loop         bool       `toml:"loop"`
 	LoopStart    int        `toml:"loop_start"`
+	LoopCrossfade float64   `toml:"loop_crossfade"`
 	Channel      []Channel  `toml:"channel"`
 	Pattern      map[string]rawPattern
 	Song         rawSong    `toml:"song"`
+	Bus          map[string]rawBus `toml:"bus"`
+	MasterVolume *float64   `toml:"master_volume"`
+
+	// OptionalHeader lets pattern data leave out the channel header or
+	// label it differently, for files written before it was checked.
+	OptionalHeader bool `toml:"optional_header"`
+}
+
+type rawBus struct {
+	Volume *float64 `toml:"volume"`
 }
 
 type rawPattern struct {
 	Ticks int    `toml:"ticks"`
 	Data  string `toml:"data"`
+	// Pad lets a pattern have fewer rows than ticks, silent to the end.
+	Pad bool `toml:"pad"`
 }
 
 type rawSong struct {
-	Sequence []string `toml:"sequence"`
+	Sequence       []string `toml:"sequence"`
+	ExportPatterns []string `toml:"export_patterns"`
+	ExportFull     *bool    `toml:"export_full"`
 }
 
 // ParseTrack parses .track file content.
 func ParseTrack(data []byte, filename string) (*Track, error) {
+	data = tomlsrc.Normalize(data)
 	var raw rawTrack
 	if err := toml.Unmarshal(data, &raw); err != nil {
 		return nil, fmt.Errorf("%s: %w", filename, err)
@@ -118,26 +209,76 @@ func ParseTrack(data []byte, filename string) (*Track, error) {
 	if raw.TicksPerBeat <= 0 {
 		raw.TicksPerBeat = 4
 	}
+	if raw.BeatsPerBar < 0 {
+		return nil, fmt.Errorf("%s: beats_per_bar must be positive", filename)
+	}
+	if raw.BeatsPerBar == 0 {
+		raw.BeatsPerBar = 4
+	}
 
 	t := &Track{
 		Tempo:        raw.Tempo,
 		TicksPerBeat: raw.TicksPerBeat,
+		BeatsPerBar:  raw.BeatsPerBar,
 		Loop:         raw.Loop,
 		LoopStart:    raw.LoopStart,
+		LoopCrossfade: raw.LoopCrossfade,
 		Channels:     raw.Channel,
 		Patterns:     make(map[string]*Pattern),
 		Sequence:     raw.Song.Sequence,
+		ExportPatterns: raw.Song.ExportPatterns,
+		ExportFull:     raw.Song.ExportFull == nil || *raw.Song.ExportFull,
+		Buses:        make(map[string]*Bus, len(raw.Bus)),
+		MasterVolume: 1,
+	}
+
+	if raw.MasterVolume != nil {
+		if *raw.MasterVolume < 0 {
+			return nil, fmt.Errorf("%s: master_volume must not be negative", filename)
+		}
+		t.MasterVolume = *raw.MasterVolume
+	}
+	for name, rb := range raw.Bus {
+		b := &Bus{Name: name, Volume: 1}
+		if rb.Volume != nil {
+			if *rb.Volume < 0 {
+				return nil, fmt.Errorf("%s: bus %q: volume must not be negative", filename, name)
+			}
+			b.Volume = *rb.Volume
+		}
+		t.Buses[name] = b
+	}
+	for i, ch := range t.Channels {
+		if ch.Bus != "" {
+			if _, ok := t.Buses[ch.Bus]; !ok {
+				return nil, fmt.Errorf("%s: channel %q: undefined bus %q (defined: %s)", filename, ch.Name, ch.Bus, t.busList())
+			}
+		}
+		if ch.Duck != nil {
+			if err := t.checkDuck(i); err != nil {
+				return nil, fmt.Errorf("%s: channel %q: duck: %w", filename, ch.Name, err)
+			}
+		}
 	}
 
-	numChannels := len(t.Channels)
+	channels := make([]string, len(t.Channels))
+	for i, ch := range t.Channels {
+		channels[i] = ch.Name
+	}
+	dataLines := patternDataLines(data)
 
 	for name, rp := range raw.Pattern {
-		pattern, err := parsePattern(name, rp, numChannels, filename)
+		pattern, err := parsePattern(name, rp, channels, raw.OptionalHeader, dataLines[name], filename)
 		if err != nil {
 			return nil, err
 		}
 		t.Patterns[name] = pattern
+		if len(pattern.Rows) < pattern.Ticks {
+			t.Warnings = append(t.Warnings, fmt.Sprintf("%s: pattern %q has %d rows, padded with silence to ticks = %d",
+				filename, name, len(pattern.Rows), pattern.Ticks))
+		}
 	}
+	slices.Sort(t.Warnings)
 
 	// Validate sequence references.
 	for _, pname := range t.Sequence {
@@ -145,58 +286,14 @@ func ParseTrack(data []byte, filename string) (*Track, error) {
 			return nil, fmt.Errorf("%s: unknown pattern %q in sequence", filename, pname)
 		}
 	}
-
-	return t, nil
-}
-
-func parsePattern(name string, raw rawPattern, numChannels int, filename string) (*Pattern, error) {
-	lines := strings.Split(strings.TrimSpace(raw.Data), "\n")
-	if len(lines) == 0 {
-		return nil, fmt.Errorf("%s: pattern %q: empty data", filename, name)
-	}
-
-	// First line is channel header — skip it.
-	dataLines := lines[1:]
-
-	ticks := raw.Ticks
-	if ticks <= 0 {
-		ticks = len(dataLines)
+	if err := t.checkExports(); err != nil {
+		return nil, fmt.Errorf("%s: song: %w", filename, err)
 	}
-
-	p := &Pattern{
-		Name:  name,
-		Ticks: ticks,
-		Rows:  make([][]Note, len(dataLines)),
-	}
-
-	for i, line := range dataLines {
-		cols := splitColumns(line)
-		if numChannels > 0 && len(cols) != numChannels {
-			return nil, fmt.Errorf("%s: pattern %q row %d: got %d columns, expected %d",
-				filename, name, i+1, len(cols), numChannels)
-		}
-
-		row := make([]Note, len(cols))
-		for j, cell := range cols {
-			note, err := parseNote(strings.TrimSpace(cell))
-			if err != nil {
-				return nil, fmt.Errorf("%s: pattern %q row %d col %d: %w",
-					filename, name, i+1, j+1, err)
-			}
-			row[j] = note
-		}
-		p.Rows[i] = row
+	if err := t.checkCrossfade(); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
 	}
 
-	return p, nil
-}
-
-func splitColumns(line string) []string {
-	parts := strings.Split(line, "|")
-	for i := range parts {
-		parts[i] = strings.TrimSpace(parts[i])
-	}
-	return parts
+	return t, nil
 }
 
 func parseNote(cell string) (Note, error) {
@@ -210,35 +307,50 @@ func parseNote(cell string) (Note, error) {
 		return Note{Type: NoteOff}, nil
 	}
 
-	// Parse note: C4, C#5, D#3, possibly with effects suffix.
-	parts := strings.Fields(cell)
-	if len(parts) == 0 {
+	// Parse note: C4, C#5, D#3, possibly with effects suffix. The name is
+	// sliced from the cell rather than built, so a note costs no allocation
+	// unless it has effects.
+	noteStr, effects := cell, ""
+	if i := strings.IndexAny(cell, " \t"); i >= 0 {
+		noteStr, effects = cell[:i], cell[i:]
+	}
+	if noteStr == "" {
 		return Note{Type: Silence}, nil
 	}
 
-	noteStr := parts[0]
 	n := Note{Type: NoteOn}
 
-	// Parse note name and octave.
-	i := 0
-	if i < len(noteStr) {
-		n.Name = string(noteStr[i])
-		i++
-	}
-	if i < len(noteStr) && noteStr[i] == '#' {
-		n.Name += "#"
+	// Parse note name and octave. A flat is read as part of the name so
+	// that the error can suggest the sharp to write instead.
+	_, i := utf8.DecodeRuneInString(noteStr)
+	if i < len(noteStr) && (noteStr[i] == '#' || noteStr[i] == 'b') {
 		i++
 	}
-	if i < len(noteStr) {
-		octave, err := strconv.Atoi(noteStr[i:])
-		if err != nil {
-			return Note{}, fmt.Errorf("invalid note %q: cannot parse octave", noteStr)
+	n.Name = noteStr[:i]
+	if _, ok := semitones[n.Name]; !ok {
+		msg := fmt.Sprintf("invalid note %q: unknown note name %q", noteStr, n.Name)
+		if suggestion := suggestNoteName(n.Name); suggestion != "" {
+			msg += " (" + suggestion + ")"
 		}
-		n.Octave = octave
+		return Note{}, errors.New(msg)
+	}
+	if i == len(noteStr) {
+		return Note{}, fmt.Errorf("invalid note %q: missing octave", noteStr)
+	}
+	// Only digits and a minus: Atoi would also take a plus, and a number
+	// too large for an int is still just an octave out of range.
+	digits := noteStr[i:]
+	if d := strings.TrimPrefix(digits, "-"); d == "" || strings.TrimLeft(d, "0123456789") != "" {
+		return Note{}, fmt.Errorf("invalid note %q: cannot parse octave", noteStr)
 	}
+	octave, err := strconv.Atoi(digits)
+	if err != nil || octave < minOctave || octave > maxOctave {
+		return Note{}, fmt.Errorf("invalid note %q: octave %s is outside %d-%d", noteStr, digits, minOctave, maxOctave)
+	}
+	n.Octave = octave
 
-	// Parse effects from remaining parts.
-	for _, eff := range parts[1:] {
+	// Parse effects from the rest of the cell.
+	for _, eff := range strings.Fields(effects) {
 		if len(eff) < 2 {
 			continue
 		}
@@ -254,6 +366,141 @@ func parseNote(cell string) (Note, error) {
 	return n, nil
 }
 
+// suggestNoteName suggests the note name meant by an unknown one: the
+// same note in another spelling or case, or else a near miss like "C$".
+func suggestNoteName(name string) string {
+	name = strings.ToUpper(name[:1]) + name[1:]
+	if alt, ok := noteSpellings[name]; ok {
+		name = alt
+	}
+	if _, ok := semitones[name]; ok {
+		return fmt.Sprintf("did you mean %q?", name)
+	}
+	if len(name) > 1 {
+		return diagnostic.SuggestMatch(name, noteNames, 1)
+	}
+	return ""
+}
+
+// BusNames returns the defined bus names in sorted order.
+func (t *Track) BusNames() []string {
+	names := make([]string, 0, len(t.Buses))
+	for name := range t.Buses {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (t *Track) busList() string {
+	if len(t.Buses) == 0 {
+		return "none"
+	}
+	return strings.Join(t.BusNames(), ", ")
+}
+
+// duckSources returns the indices of the channels a duck source names: the
+// channel with that name, or else every channel on the bus with that name.
+func (t *Track) duckSources(source string) []int {
+	var idx []int
+	for i, ch := range t.Channels {
+		if ch.Name == source {
+			return []int{i}
+		}
+		if ch.Bus == source {
+			idx = append(idx, i)
+		}
+	}
+	return idx
+}
+
+func (t *Track) checkDuck(target int) error {
+	d := t.Channels[target].Duck
+	if d.Amount < 0 || d.Amount > 1 {
+		return fmt.Errorf("amount must be between 0 and 1, got %g", d.Amount)
+	}
+	if d.Release < 0 {
+		return fmt.Errorf("release must not be negative")
+	}
+	sources := t.duckSources(d.Source)
+	if len(sources) == 0 {
+		return fmt.Errorf("source %q is not a channel or a bus with channels", d.Source)
+	}
+	if slices.Contains(sources, target) {
+		return fmt.Errorf("source %q includes the channel itself", d.Source)
+	}
+	return nil
+}
+
+// ChannelGain returns the volume applied to a channel: its own volume times
+// its bus volume and the master volume.
+func (t *Track) ChannelGain(ch Channel) float64 {
+	gain := ch.Volume * t.MasterVolume
+	if b, ok := t.Buses[ch.Bus]; ok {
+		gain *= b.Volume
+	}
+	return gain
+}
+
+// ChannelRanges returns the lowest and highest note each channel plays in
+// any pattern, in channel order; nil for a channel that plays none.
+func (t *Track) ChannelRanges() []*instrument.NoteRange {
+	ranges := make([]*instrument.NoteRange, len(t.Channels))
+	for _, p := range t.Patterns {
+		for _, row := range p.Rows {
+			for ch, note := range row {
+				if note.Type != NoteOn || ch >= len(ranges) {
+					continue
+				}
+				m := note.MIDI()
+				if r := ranges[ch]; r != nil {
+					r.Low, r.High = min(r.Low, m), max(r.High, m)
+				} else {
+					ranges[ch] = &instrument.NoteRange{Low: m, High: m}
+				}
+			}
+		}
+	}
+	return ranges
+}
+
+// CheckRanges returns a warning for each pattern and channel that plays
+// notes outside the range its instrument declares, naming the first such
+// row. Instruments missing from instruments or without a range are not
+// checked.
+func (t *Track) CheckRanges(instruments map[string]*instrument.Instrument) []string {
+	var warnings []string
+	for _, name := range slices.Sorted(maps.Keys(t.Patterns)) {
+		p := t.Patterns[name]
+		for ch, c := range t.Channels {
+			inst := instruments[c.Instrument]
+			if inst == nil || inst.Range == nil {
+				continue
+			}
+			first, count := -1, 0
+			for i, row := range p.Rows {
+				if ch < len(row) && row[ch].Type == NoteOn && !inst.Range.Contains(row[ch].MIDI()) {
+					if first < 0 {
+						first = i
+					}
+					count++
+				}
+			}
+			if first < 0 {
+				continue
+			}
+			note := p.Rows[first][ch]
+			msg := fmt.Sprintf("pattern %q row %d: channel %q plays %s%d, outside the range %s of instrument %q",
+				name, first+1, c.Name, note.Name, note.Octave, inst.Range, inst.Name)
+			if count > 1 {
+				msg += fmt.Sprintf(" (and %d more row(s))", count-1)
+			}
+			warnings = append(warnings, msg)
+		}
+	}
+	return warnings
+}
+
 // LoadTrack reads and parses a .track file from disk.
 func LoadTrack(path string) (*Track, error) {
 	data, err := os.ReadFile(path)
@@ -263,115 +510,415 @@ func LoadTrack(path string) (*Track, error) {
 	return ParseTrack(data, filepath.Base(path))
 }
 
-// channelState tracks the current note state for a single channel.
-type channelState struct {
-	active    bool
-	voice     *audio.Voice
-	noteOnTime float64
-	releasing bool
-	releaseTime float64
+// PatternTicksPerBeat returns the ticks per beat in effect for p. Every
+// pattern uses the track's today; beat grids ask here so they follow p
+// once patterns can set their own.
+func (t *Track) PatternTicksPerBeat(p *Pattern) int {
+	return t.TicksPerBeat
 }
 
-// Render generates audio samples for the track.
-func (t *Track) Render(instruments map[string]*instrument.Instrument, sampleRate int) ([]float64, error) {
-	samplesPerTick := float64(sampleRate) * 60.0 / float64(t.Tempo) / float64(t.TicksPerBeat)
-	intSamplesPerTick := int(math.Round(samplesPerTick))
+// Downbeat reports whether row of p starts a beat and, when it also starts
+// a bar, that bar's number within the pattern counting from 1 (0 when it
+// doesn't).
+func (t *Track) Downbeat(p *Pattern, row int) (beat bool, bar int) {
+	tpb := t.PatternTicksPerBeat(p)
+	if tpb <= 0 || row < 0 || row%tpb != 0 {
+		return false, 0
+	}
+	perBar := tpb * max(t.BeatsPerBar, 1)
+	if row%perBar == 0 {
+		return true, row/perBar + 1
+	}
+	return true, 0
+}
 
-	// Calculate total ticks.
-	totalTicks := 0
+// checkExports checks that export_patterns names each pattern once, by a
+// name that can go in a file name, and that the track writes something.
+func (t *Track) checkExports() error {
+	for i, pname := range t.ExportPatterns {
+		if _, ok := t.Patterns[pname]; !ok {
+			return fmt.Errorf("unknown pattern %q in export_patterns", pname)
+		}
+		if strings.TrimFunc(pname, isFileNameRune) != "" {
+			return fmt.Errorf("pattern %q in export_patterns names a file, so it can only have letters, digits, _ and -", pname)
+		}
+		if slices.Contains(t.ExportPatterns[:i], pname) {
+			return fmt.Errorf("pattern %q is in export_patterns twice", pname)
+		}
+	}
+	if !t.ExportFull && len(t.ExportPatterns) == 0 {
+		return errors.New("export_full = false needs export_patterns, or the track writes nothing")
+	}
+	return nil
+}
+
+func isFileNameRune(r rune) bool {
+	return r == '_' || r == '-' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9'
+}
+
+// checkCrossfade checks that loop_crossfade fits in the loop.
+func (t *Track) checkCrossfade() error {
+	switch {
+	case t.LoopCrossfade < 0:
+		return fmt.Errorf("loop_crossfade must not be negative, got %g", t.LoopCrossfade)
+	case t.LoopCrossfade > 0 && !t.Loop:
+		return errors.New("loop_crossfade needs loop = true")
+	}
+	loop := t.Duration() - t.ticksSeconds(t.loopStartTick())
+	if t.LoopCrossfade > loop {
+		return fmt.Errorf("loop_crossfade = %g is longer than the loop, %gs", t.LoopCrossfade, math.Round(loop*1000)/1000)
+	}
+	return nil
+}
+
+// loopStartTick returns the tick the loop goes back to: the start of the
+// pattern at index LoopStart in the sequence.
+func (t *Track) loopStartTick() int {
+	ticks := 0
+	for _, pname := range t.Sequence[:min(max(t.LoopStart, 0), len(t.Sequence))] {
+		ticks += t.Patterns[pname].Len()
+	}
+	return ticks
+}
+
+func (t *Track) ticksSeconds(ticks int) float64 {
+	return float64(ticks) * 60 / float64(t.Tempo) / float64(t.TicksPerBeat)
+}
+
+// samplesPerTick returns the whole number of samples a render gives each
+// tick.
+func (t *Track) samplesPerTick(sampleRate int) int {
+	return int(math.Round(float64(sampleRate) * 60.0 / float64(t.Tempo) / float64(t.TicksPerBeat)))
+}
+
+// SeamThreshold is the LoopSeam jump, as a fraction of full scale, above
+// which a loop is likely to click.
+const SeamThreshold = 0.1
+
+// LoopSeam returns how far the level jumps where samples, the track's
+// render, wraps from its last sample back to the loop start; 0 if the
+// track doesn't loop.
+func (t *Track) LoopSeam(samples []float64, sampleRate int) float64 {
+	start := t.loopStartTick() * t.samplesPerTick(sampleRate)
+	if !t.Loop || start >= len(samples) {
+		return 0
+	}
+	return math.Abs(samples[len(samples)-1] - samples[start])
+}
+
+// CheckLoopSeam returns a warning if the loop seam of samples, the
+// track's render, jumps by more than SeamThreshold, or "" if it doesn't.
+func (t *Track) CheckLoopSeam(samples []float64, sampleRate int) string {
+	seam := t.LoopSeam(samples, sampleRate)
+	if seam <= SeamThreshold {
+		return ""
+	}
+	hint := "set loop_crossfade = 0.05 to smooth it"
+	if t.LoopCrossfade > 0 {
+		hint = "try a longer loop_crossfade"
+	}
+	return fmt.Sprintf("the loop seam jumps by %.2f from the last sample back to loop_start, which clicks; %s", seam, hint)
+}
+
+// crossfadeLoop fades the last LoopCrossfade seconds of mixed out while
+// fading in the audio that leads up to the loop start, with equal power,
+// so the end runs on into the loop start. Before a loop start at the very
+// beginning there is only silence, so the end fades out.
+func (t *Track) crossfadeLoop(mixed []float64, sampleRate int) {
+	n := int(t.LoopCrossfade * float64(sampleRate))
+	start := t.loopStartTick() * t.samplesPerTick(sampleRate)
+	if !t.Loop || n <= 0 || n > len(mixed)-start {
+		return
+	}
+	lead := make([]float64, n)
+	for i := range lead {
+		if j := start - n + i; j >= 0 {
+			lead[i] = mixed[j]
+		}
+	}
+	tail := mixed[len(mixed)-n:]
+	for i := range tail {
+		x := math.Pi / 2 * float64(i+1) / float64(n)
+		tail[i] = tail[i]*math.Cos(x) + lead[i]*math.Sin(x)
+	}
+}
+
+// TotalTicks returns the number of ticks the sequence plays.
+func (t *Track) TotalTicks() int {
+	ticks := 0
 	for _, pname := range t.Sequence {
-		p := t.Patterns[pname]
-		totalTicks += len(p.Rows)
+		ticks += t.Patterns[pname].Len()
+	}
+	return ticks
+}
+
+// Duration returns the length of the rendered track in seconds, without
+// rendering it. Notes are cut at the last tick, so there is no release
+// tail. The WAV can differ by the rounding of samples per tick.
+func (t *Track) Duration() float64 {
+	return t.ticksSeconds(t.TotalTicks())
+}
+
+// PatternDuration returns the length of the named pattern rendered on its
+// own by RenderPattern, in seconds, like Duration.
+func (t *Track) PatternDuration(name string) float64 {
+	return t.ticksSeconds(t.Patterns[name].Len())
+}
+
+// Render generates audio samples for the track. If ctx is canceled first,
+// it returns no samples and the context's error.
+func (t *Track) Render(ctx context.Context, instruments map[string]*instrument.Instrument, sampleRate int) ([]float64, error) {
+	return t.RenderCached(ctx, instruments, sampleRate, nil, nil)
+}
+
+// RenderCached is Render reusing the pattern blocks in cache, which may be
+// nil. progress, if not nil, is called after each pattern in the sequence
+// with how many are done out of the total.
+func (t *Track) RenderCached(ctx context.Context, instruments map[string]*instrument.Instrument, sampleRate int, cache *BlockCache, progress func(done, total int)) ([]float64, error) {
+	channels, totalSamples, err := t.renderChannels(ctx, instruments, sampleRate, cache, progress)
+	if err != nil {
+		return nil, err
 	}
+	t.applyDucking(channels, sampleRate)
 
-	totalSamples := totalTicks * intSamplesPerTick
 	mixed := make([]float64, totalSamples)
+	for _, buf := range channels {
+		for i, s := range buf {
+			mixed[i] += s
+		}
+	}
+	t.crossfadeLoop(mixed, sampleRate)
 
-	states := make([]channelState, len(t.Channels))
-	sampleOffset := 0
-	globalTime := 0.0
+	// Apply safety.
+	mixed, _ = audio.ProcessSafety(mixed, sampleRate)
 
-	for _, pname := range t.Sequence {
+	return mixed, nil
+}
+
+// RenderPattern renders one pattern on its own, as if the sequence held
+// only that pattern: notes start from silence and there is no loop. It is
+// for auditioning a pattern without rendering the whole song.
+func (t *Track) RenderPattern(ctx context.Context, name string, instruments map[string]*instrument.Instrument, sampleRate int) ([]float64, error) {
+	if t.Patterns[name] == nil {
+		return nil, fmt.Errorf("unknown pattern %q", name)
+	}
+	single := *t
+	single.Sequence = []string{name}
+	single.Loop = false
+	single.LoopStart = 0
+	single.LoopCrossfade = 0
+	return single.Render(ctx, instruments, sampleRate)
+}
+
+// renderChannels renders each channel into its own buffer, with channel,
+// bus and master gain applied. All buffers are totalSamples long. Each
+// pattern in the sequence is a block, taken from cache when it holds one
+// with the same key.
+func (t *Track) renderChannels(ctx context.Context, instruments map[string]*instrument.Instrument, sampleRate int, cache *BlockCache, progress func(done, total int)) (channels [][]float64, totalSamples int, err error) {
+	intSamplesPerTick := t.samplesPerTick(sampleRate)
+
+	totalSamples = t.TotalTicks() * intSamplesPerTick
+	channels = make([][]float64, len(t.Channels))
+	for i := range channels {
+		channels[i] = make([]float64, totalSamples)
+	}
+
+	var insts []string
+	var used map[string]bool
+	if cache != nil {
+		insts = make([]string, len(t.Channels))
+		for i, ch := range t.Channels {
+			insts[i] = instrumentKey(instruments[ch.Instrument])
+		}
+		used = make(map[string]bool)
+	}
+
+	states := make([]blockState, len(t.Channels))
+	sampleOffset := 0
+	for i, pname := range t.Sequence {
 		pattern := t.Patterns[pname]
-		for _, row := range pattern.Rows {
-			for chIdx := 0; chIdx < len(row) && chIdx < len(t.Channels); chIdx++ {
-				note := row[chIdx]
-				ch := t.Channels[chIdx]
-				state := &states[chIdx]
-
-				switch note.Type {
-				case NoteOn:
-					inst, ok := instruments[ch.Instrument]
-					if !ok {
-						continue
-					}
-					freq := note.Freq()
-
-					// Apply velocity effect.
-					volume := ch.Volume
-					for _, eff := range note.Effects {
-						if eff.Type == 'v' {
-							volume = ch.Volume * float64(eff.Value) / 15.0
-						}
-					}
+		var b *block
+		var key string
+		if cache != nil {
+			key = blockKey(pattern, states, insts, sampleRate, intSamplesPerTick)
+			b = cache.get(key)
+		}
+		if b == nil {
+			if b, err = t.renderBlock(ctx, pattern, states, instruments, sampleRate, intSamplesPerTick); err != nil {
+				return nil, 0, err
+			}
+			if cache != nil {
+				cache.put(key, b)
+			}
+		}
+		if cache != nil {
+			used[key] = true
+		}
 
-					state.voice = inst.CreateVoice(freq, sampleRate)
-					state.active = true
-					state.noteOnTime = globalTime
-					state.releasing = false
-
-					// Render this tick.
-					for s := 0; s < intSamplesPerTick; s++ {
-						idx := sampleOffset + s
-						if idx >= len(mixed) {
-							break
-						}
-						t := float64(s) / float64(sampleRate)
-						sample := renderVoiceSample(state.voice, t, 10.0) // long noteOn for sustain
-						mixed[idx] += sample * volume
-					}
+		for chIdx, buf := range b.channels {
+			gain := t.ChannelGain(t.Channels[chIdx])
+			out := channels[chIdx][sampleOffset:]
+			for j, s := range buf {
+				out[j] = s * gain
+			}
+		}
+		copy(states, b.exit)
+		sampleOffset += pattern.Len() * intSamplesPerTick
+		if progress != nil {
+			progress(i+1, len(t.Sequence))
+		}
+	}
+	if cache != nil {
+		cache.keep(used)
+	}
+
+	return channels, totalSamples, nil
+}
+
+// renderBlock synthesizes one pass through pattern, a buffer per channel
+// before gain, starting from the channel states in entry. Notes are timed
+// from the tick they started on, so a block sounds the same wherever it
+// falls in the song. ctx is checked once a tick, a few thousand samples at
+// usual tempos.
+func (t *Track) renderBlock(ctx context.Context, pattern *Pattern, entry []blockState, instruments map[string]*instrument.Instrument, sampleRate, samplesPerTick int) (*block, error) {
+	b := &block{
+		channels: make([][]float64, len(t.Channels)),
+		exit:     slices.Clone(entry),
+	}
+	voices := make([]*audio.Voice, len(t.Channels))
+	for i, st := range entry {
+		b.channels[i] = make([]float64, pattern.Len()*samplesPerTick)
+		if inst := instruments[t.Channels[i].Instrument]; st.active && inst != nil {
+			voices[i] = inst.CreateVoice(st.freq, sampleRate)
+		}
+	}
+	states := b.exit
 
-				case Sustain:
-					if state.active && state.voice != nil && !state.releasing {
-						elapsed := globalTime - state.noteOnTime
-						for s := 0; s < intSamplesPerTick; s++ {
-							idx := sampleOffset + s
-							if idx >= len(mixed) {
-								break
-							}
-							t := elapsed + float64(s)/float64(sampleRate)
-							sample := renderVoiceSample(state.voice, t, 10.0)
-							mixed[idx] += sample * ch.Volume
-						}
+	for tick := range pattern.Len() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		var row []Note // silence past the last row
+		if tick < len(pattern.Rows) {
+			row = pattern.Rows[tick]
+		}
+		for chIdx := 0; chIdx < len(row) && chIdx < len(t.Channels); chIdx++ {
+			note := row[chIdx]
+			state := &states[chIdx]
+			out := b.channels[chIdx][tick*samplesPerTick : (tick+1)*samplesPerTick]
+
+			switch note.Type {
+			case NoteOn:
+				inst, ok := instruments[t.Channels[chIdx].Instrument]
+				if !ok {
+					continue
+				}
+				freq := note.Freq()
+
+				// Apply velocity effect.
+				velocity := 1.0
+				for _, eff := range note.Effects {
+					if eff.Type == 'v' {
+						velocity = float64(eff.Value) / 15.0
 					}
+				}
 
-				case NoteOff:
-					state.releasing = true
-					state.active = false
+				voices[chIdx] = inst.CreateVoice(freq, sampleRate)
+				*state = blockState{active: true, freq: freq}
 
-				case Silence:
-					// Do nothing.
+				// Render this tick.
+				for s := range out {
+					at := float64(s) / float64(sampleRate)
+					out[s] = renderVoiceSample(voices[chIdx], at, 10.0, sampleRate) * velocity // long noteOn for sustain
 				}
+
+			case Sustain:
+				if state.active && voices[chIdx] != nil {
+					elapsed := float64(state.since*samplesPerTick) / float64(sampleRate)
+					for s := range out {
+						at := elapsed + float64(s)/float64(sampleRate)
+						out[s] = renderVoiceSample(voices[chIdx], at, 10.0, sampleRate)
+					}
+				}
+
+			case NoteOff:
+				*state = blockState{}
+
+			case Silence:
+				// Do nothing.
 			}
+		}
 
-			sampleOffset += intSamplesPerTick
-			globalTime += float64(intSamplesPerTick) / float64(sampleRate)
+		for i := range states {
+			if states[i].active {
+				states[i].since++
+			}
 		}
 	}
 
-	// Apply safety.
-	mixed, _ = audio.ProcessSafety(mixed, sampleRate)
+	return b, nil
+}
 
-	return mixed, nil
+// applyDucking scales every ducked channel by a gain that follows the
+// amplitude of its source. The follower reads the unducked source buffers,
+// so two channels may duck each other.
+func (t *Track) applyDucking(channels [][]float64, sampleRate int) {
+	gains := make([][]float64, len(channels))
+	for i, ch := range t.Channels {
+		if ch.Duck == nil || ch.Duck.Amount == 0 {
+			continue
+		}
+		env := envelopeFollower(channels, t.duckSources(ch.Duck.Source), ch.Duck.Release, sampleRate)
+		for j, e := range env {
+			env[j] = 1 - ch.Duck.Amount*math.Min(e, 1)
+		}
+		gains[i] = env
+	}
+	for i, g := range gains {
+		for j := range g {
+			channels[i][j] *= g[j]
+		}
+	}
 }
 
-func renderVoiceSample(v *audio.Voice, t, noteOnDur float64) float64 {
+// envelopeFollower tracks the peak amplitude of the summed source channels.
+// It attacks instantly and decays exponentially with the release time.
+func envelopeFollower(channels [][]float64, sources []int, release float64, sampleRate int) []float64 {
+	n := 0
+	if len(channels) > 0 {
+		n = len(channels[0])
+	}
+	coef := 0.0
+	if release > 0 {
+		coef = math.Exp(-1 / (release * float64(sampleRate)))
+	}
+	env := make([]float64, n)
+	level := 0.0
+	for i := range env {
+		sum := 0.0
+		for _, src := range sources {
+			sum += channels[src][i]
+		}
+		level = math.Max(math.Abs(sum), level*coef)
+		env[i] = level
+	}
+	return env
+}
+
+func renderVoiceSample(v *audio.Voice, t, noteOnDur float64, sampleRate int) float64 {
 	if v == nil {
 		return 0
 	}
 	freq := v.Frequency
-	phase := math.Mod(t*freq, 1.0)
-	sample := v.Osc.Sample(phase)
+	if v.Drum != nil {
+		return v.Drum.Sample(t, freq, sampleRate)
+	}
+	var sample float64
+	if v.Sample != nil {
+		sample = v.Sample.At(t, freq)
+	} else {
+		sample = v.Osc.Sample(math.Mod(t*freq, 1.0))
+	}
 	sample *= v.Env.Level(t, noteOnDur)
 	return sample
 }
@@ -1,12 +1,18 @@
 package track
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"math"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/vgalaktionov/runefact/internal/audio"
+	"github.com/vgalaktionov/runefact/internal/diagnostic"
 	"github.com/vgalaktionov/runefact/internal/instrument"
 )
 
@@ -76,6 +82,36 @@ func TestParseNote_MultipleEffects(t *testing.T) {
 	}
 }
 
+func TestParseNote_Invalid(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"H4", `unknown note name "H" (did you mean "B"?)`},
+		{"Bb3", `unknown note name "Bb" (did you mean "A#"?)`},
+		{"E#4", `unknown note name "E#" (did you mean "F"?)`},
+		{"c4", `unknown note name "c" (did you mean "C"?)`},
+		{"X4", `unknown note name "X"`},
+		{"C44", "octave 44 is outside 0-9"},
+		{"C-1", "octave -1 is outside 0-9"},
+		{"C", "missing octave"},
+		{"C#x", "cannot parse octave"},
+		{"C+4", "cannot parse octave"},
+		{"C-", "cannot parse octave"},
+		{"C99999999999999999999", "octave 99999999999999999999 is outside 0-9"},
+		{"é4", `unknown note name "é"`},
+	}
+	for _, tt := range tests {
+		_, err := parseNote(tt.input)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("parseNote(%q) err = %v, want %q", tt.input, err, tt.want)
+		}
+	}
+	if _, err := parseNote("X4"); strings.Contains(err.Error(), "did you mean") {
+		t.Errorf("X4 err = %v, want no suggestion", err)
+	}
+}
+
 func TestNoteFreq(t *testing.T) {
 	n := Note{Type: NoteOn, Name: "A", Octave: 4}
 	f := n.Freq()
@@ -134,6 +170,46 @@ sequence = ["main"]
 	}
 }
 
+func TestCheckRanges(t *testing.T) {
+	tr, err := ParseTrack([]byte(`tempo = 120
+[[channel]]
+name = "bass"
+instrument = "bass"
+[[channel]]
+name = "lead"
+instrument = "lead"
+[pattern.verse]
+data = """
+bass | lead
+C2   | C7
+C7   | ...
+---  | C1
+D7   | ...
+"""
+[pattern.intro]
+data = """
+bass | lead
+C3   | G4
+"""
+`), "song.track")
+	if err != nil {
+		t.Fatal(err)
+	}
+	instruments := map[string]*instrument.Instrument{
+		"bass": {Name: "bass", Range: &instrument.NoteRange{Low: 24, High: 60}},
+		"lead": {Name: "lead"},
+	}
+	want := []string{`pattern "verse" row 2: channel "bass" plays C7, outside the range C1-C4 of instrument "bass" (and 1 more row(s))`}
+	if got := tr.CheckRanges(instruments); !slices.Equal(got, want) {
+		t.Errorf("warnings = %q, want %q", got, want)
+	}
+
+	ranges := tr.ChannelRanges()
+	if len(ranges) != 2 || *ranges[0] != (instrument.NoteRange{Low: 36, High: 98}) || *ranges[1] != (instrument.NoteRange{Low: 24, High: 96}) {
+		t.Errorf("channel ranges = %v, %v", ranges[0], ranges[1])
+	}
+}
+
 func TestParseTrack_MultiChannel(t *testing.T) {
 	input := []byte(`
 tempo = 120
@@ -206,6 +282,261 @@ sequence = ["bad"]
 	}
 }
 
+func TestParseTrack_InvalidNote(t *testing.T) {
+	input := []byte(`
+tempo = 120
+
+[[channel]]
+name = "a"
+instrument = "x"
+
+[[channel]]
+name = "b"
+instrument = "x"
+
+[pattern.verse]
+data = """
+a | b
+C4 | ...
+E4 | H4
+"""
+
+[song]
+sequence = ["verse"]
+`)
+	_, err := ParseTrack(input, "test.track")
+	if err == nil || !strings.Contains(err.Error(), `pattern "verse" row 2 col 2: invalid note "H4"`) {
+		t.Errorf("err = %v, want the pattern, row and column of H4", err)
+	}
+}
+
+func TestParsePattern_Header(t *testing.T) {
+	channels := []string{"lead", "bass"}
+	tests := []struct {
+		data     string
+		optional bool
+		rows     int
+		wantErr  string
+	}{
+		{"lead | bass\nC4 | C2\n", false, 1, ""},
+		{"# lead | bass\nC4 | C2\n", false, 1, ""},
+		{"bass | lead\nC4 | C2\n", false, 0, `header mismatch: expected "lead | bass", found "bass | lead"`},
+		{"lead\nC4 | C2\n", false, 0, `found "lead"`},
+		{"C4 | C2\nE4 | ---\n", false, 0, "(is the header line missing?)"},
+		{"C4 | C2\nE4 | ---\n", true, 2, ""},
+		{"melody | bass\nC4 | C2\n", true, 1, ""},
+		{"lead | bass\nC4 | C2\n", true, 1, ""},
+	}
+	for _, tt := range tests {
+		p, err := parsePattern("p", rawPattern{Data: tt.data}, channels, tt.optional, 0, "test.track")
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%q: err = %v, want %q", tt.data, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.data, err)
+		} else if len(p.Rows) != tt.rows {
+			t.Errorf("%q: got %d rows, want %d", tt.data, len(p.Rows), tt.rows)
+		}
+	}
+}
+
+func TestParseTrack_OptionalHeader(t *testing.T) {
+	input := `tempo = 120
+%s
+[[channel]]
+name = "a"
+instrument = "x"
+
+[pattern.p]
+data = """
+C4
+E4
+"""
+
+[song]
+sequence = ["p"]
+`
+	if _, err := ParseTrack(fmt.Appendf(nil, input, ""), "test.track"); err == nil || !strings.Contains(err.Error(), "header mismatch") {
+		t.Errorf("err = %v, want a header mismatch", err)
+	}
+	tr, err := ParseTrack(fmt.Appendf(nil, input, "optional_header = true"), "test.track")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows := len(tr.Patterns["p"].Rows); rows != 2 {
+		t.Errorf("got %d rows, want 2 with no header", rows)
+	}
+}
+
+func TestParseTrack_PatternErrorLine(t *testing.T) {
+	input := []byte(`tempo = 120
+
+[[channel]]
+name = "a"
+instrument = "demo"
+
+[[channel]]
+name = "b"
+instrument = "demo"
+
+[pattern.intro]
+data = """
+a | b
+C4 | ...
+
+E4
+"""
+`)
+	_, err := ParseTrack(input, "test.track")
+	var le *diagnostic.LineError
+	if !errors.As(err, &le) || le.Line != 16 {
+		t.Fatalf("err = %v, want a line 16 error", err)
+	}
+	if !strings.Contains(err.Error(), `pattern "intro" row 2: got 1 columns`) {
+		t.Errorf("err = %v, want row 2, blank lines not counted", err)
+	}
+}
+
+func TestParseTrack_PatternLineEndings(t *testing.T) {
+	for _, data := range []string{"m\r\nC4\r\n---\r\n", "m\rC4\r---", "\n\nm\nC4\n\n---\n\n"} {
+		p, err := parsePattern("p", rawPattern{Data: data}, []string{"m"}, false, 0, "test.track")
+		if err != nil {
+			t.Fatalf("%q: %v", data, err)
+		}
+		if len(p.Rows) != 2 || p.Ticks != 2 || p.Rows[0][0].Name != "C" || p.Rows[1][0].Type != Sustain {
+			t.Errorf("%q: rows = %+v, want C4 then a sustain", data, p.Rows)
+		}
+	}
+}
+
+// longPattern returns a header and n rows of two-channel pattern data.
+func longPattern(n int) string {
+	var b strings.Builder
+	b.WriteString("a | b\n")
+	for i := range n {
+		if i%2 == 0 {
+			b.WriteString("C#4 | ...\n")
+		} else {
+			b.WriteString("--- | ^^^\n")
+		}
+	}
+	return b.String()
+}
+
+func TestParsePattern_AllocationBudget(t *testing.T) {
+	allocs := func(rows int) float64 {
+		raw := rawPattern{Data: longPattern(rows)}
+		return testing.AllocsPerRun(20, func() {
+			if _, err := parsePattern("p", raw, []string{"a", "b"}, false, 1, "test.track"); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+	// The budget doesn't grow with the pattern: a handful of slices, not
+	// one per row or note.
+	for _, rows := range []int{100, 10000} {
+		if n := allocs(rows); n > 8 {
+			t.Errorf("%d rows took %v allocations, want at most 8", rows, n)
+		}
+	}
+}
+
+func BenchmarkParsePattern(b *testing.B) {
+	raw := rawPattern{Data: longPattern(10000)}
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := parsePattern("p", raw, []string{"a", "b"}, false, 1, "test.track"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestParsePattern_Limits(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  rawPattern
+		want string
+	}{
+		{"rows", rawPattern{Data: longPattern(maxPatternRows + 1)}, "has more than 65536 rows"},
+		{"ticks", rawPattern{Data: longPattern(4), Ticks: maxPatternRows + 1, Pad: true}, "ticks = 65537, at most 65536"},
+		{"columns", rawPattern{Data: "a | b\n" + strings.Repeat("... | ", 1<<20) + "..."}, "got 1048577 columns, expected 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parsePattern("p", tt.raw, []string{"a", "b"}, false, 1, "test.track")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	// Without channels to check against, a row is capped by maxColumns.
+	raw := rawPattern{Data: "header\n" + strings.Repeat("... | ", maxColumns) + "..."}
+	_, err := parsePattern("p", raw, nil, false, 1, "test.track")
+	if err == nil || !strings.Contains(err.Error(), "got 65 columns, at most 64 are allowed") {
+		t.Errorf("err = %v, want at most 64 columns", err)
+	}
+}
+
+// FuzzParseNote checks that no cell panics, and that a cell that parses
+// is a note in range.
+func FuzzParseNote(f *testing.F) {
+	for _, seed := range []string{
+		"C4", "C#5", "D#3 V40", "A4 V30 P80", "---", "...", "^^^", "", "Bb3", "H4",
+		"C-1", "C99999999999999999999", "é4", "\xff4", "C4 \xff",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, cell string) {
+		n, err := parseNote(cell)
+		if err != nil || n.Type != NoteOn {
+			return
+		}
+		if _, ok := semitones[n.Name]; !ok {
+			t.Errorf("%q: note name %q", cell, n.Name)
+		}
+		if n.Octave < minOctave || n.Octave > maxOctave {
+			t.Errorf("%q: octave %d", cell, n.Octave)
+		}
+	})
+}
+
+// FuzzParsePattern checks that no pattern data panics, and that a
+// pattern that parses has a row of notes per tick within the limits.
+func FuzzParsePattern(f *testing.F) {
+	for _, seed := range []string{
+		"a | b\nC4 | ...\n--- | ^^^",
+		"# a | b\r\nC4 V40 | E4\r\n",
+		"C4 | E4\nG4 | C5",
+		"a | b\n|||",
+		"",
+		"\n\n",
+		"a | b\nC4 | E4 | G4",
+	} {
+		f.Add(seed, 0, false, false)
+	}
+	f.Add("a | b\nC4 | E4", 4, true, false)
+	f.Add("C4 | E4", 2, false, true)
+	f.Fuzz(func(t *testing.T, data string, ticks int, pad, optionalHeader bool) {
+		raw := rawPattern{Data: data, Ticks: ticks, Pad: pad}
+		p, err := parsePattern("p", raw, []string{"a", "b"}, optionalHeader, 1, "test.track")
+		if err != nil {
+			return
+		}
+		if p.Len() > maxPatternRows {
+			t.Fatalf("pattern plays for %d ticks", p.Len())
+		}
+		for i, row := range p.Rows {
+			if len(row) != 2 {
+				t.Fatalf("row %d has %d notes", i+1, len(row))
+			}
+		}
+	})
+}
+
 func TestParseTrack_UnknownPatternInSequence(t *testing.T) {
 	input := []byte(`
 tempo = 120
@@ -231,6 +562,45 @@ sequence = ["main", "missing"]
 	}
 }
 
+func TestParseTrack_ExportPatterns(t *testing.T) {
+	const base = `tempo = 120
+[[channel]]
+name = "a"
+instrument = "x"
+[pattern.main]
+data = "a\nC4\n---\n"
+[pattern.win]
+data = "a\nE4\n"
+`
+	tr, err := ParseTrack([]byte(base+"[song]\nexport_patterns = [\"win\"]\nexport_full = false\n"), "jingles.track")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(tr.ExportPatterns, []string{"win"}) || tr.ExportFull {
+		t.Errorf("exports = %v, full %v; want [win], false", tr.ExportPatterns, tr.ExportFull)
+	}
+	if d := tr.PatternDuration("main"); d != 0.25 {
+		t.Errorf("main lasts %gs, want 0.25", d)
+	}
+	if tr, _ := ParseTrack([]byte(base+"[song]\nsequence = [\"main\"]\n"), "jingles.track"); tr == nil || !tr.ExportFull {
+		t.Error("export_full should default to true")
+	}
+
+	for song, want := range map[string]string{
+		`export_patterns = ["lose"]`:       `jingles.track: song: unknown pattern "lose" in export_patterns`,
+		`export_patterns = ["win", "win"]`: `jingles.track: song: pattern "win" is in export_patterns twice`,
+		`export_full = false`:              "jingles.track: song: export_full = false needs export_patterns, or the track writes nothing",
+	} {
+		if _, err := ParseTrack([]byte(base+"[song]\n"+song+"\n"), "jingles.track"); err == nil || err.Error() != want {
+			t.Errorf("%s: err = %v, want %q", song, err, want)
+		}
+	}
+	_, err = ParseTrack([]byte(strings.Replace(base, "[pattern.win]", `[pattern."win!"]`, 1)+"[song]\nexport_patterns = [\"win!\"]\n"), "jingles.track")
+	if err == nil || !strings.Contains(err.Error(), "only have letters, digits, _ and -") {
+		t.Errorf("err = %v, want a file name error", err)
+	}
+}
+
 func TestParseTrack_InvalidTempo(t *testing.T) {
 	input := []byte(`tempo = 0`)
 	_, err := ParseTrack(input, "test.track")
@@ -239,6 +609,101 @@ func TestParseTrack_InvalidTempo(t *testing.T) {
 	}
 }
 
+const busTrack = `
+tempo = 120
+master_volume = 0.5
+
+[bus.drums]
+volume = 0.8
+
+[bus.fx]
+
+[[channel]]
+name = "kick"
+instrument = "x"
+volume = 0.5
+bus = "drums"
+
+[[channel]]
+name = "lead"
+instrument = "x"
+volume = 1
+
+[pattern.main]
+ticks = 1
+data = """
+kick | lead
+C2   | C4
+"""
+
+[song]
+sequence = ["main"]
+`
+
+func TestParseTrack_Buses(t *testing.T) {
+	tr, err := ParseTrack([]byte(busTrack), "test.track")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tr.BusNames(); len(got) != 2 || got[0] != "drums" || got[1] != "fx" {
+		t.Errorf("BusNames() = %v, want [drums fx]", got)
+	}
+	if tr.Buses["fx"].Volume != 1 {
+		t.Errorf("fx volume = %v, want default 1", tr.Buses["fx"].Volume)
+	}
+	if got := tr.ChannelGain(tr.Channels[0]); math.Abs(got-0.2) > 1e-9 {
+		t.Errorf("kick gain = %v, want 0.5*0.8*0.5 = 0.2", got)
+	}
+	if got := tr.ChannelGain(tr.Channels[1]); got != 0.5 {
+		t.Errorf("lead gain = %v, want 0.5 (master only)", got)
+	}
+}
+
+func TestParseTrack_UndefinedBus(t *testing.T) {
+	input := strings.Replace(busTrack, `bus = "drums"`, `bus = "drum"`, 1)
+	_, err := ParseTrack([]byte(input), "test.track")
+	if err == nil {
+		t.Fatal("expected undefined bus error")
+	}
+	if !strings.Contains(err.Error(), `"drum"`) || !strings.Contains(err.Error(), "drums, fx") {
+		t.Errorf("error should name the bus and list defined buses: %v", err)
+	}
+}
+
+func TestTrack_RenderBusVolume(t *testing.T) {
+	tr, err := ParseTrack([]byte(busTrack), "test.track")
+	if err != nil {
+		t.Fatal(err)
+	}
+	instruments := map[string]*instrument.Instrument{"x": {
+		Name:       "x",
+		Oscillator: instrument.OscillatorDef{Waveform: "square"},
+		Envelope:   audio.ADSR{Sustain: 1, Release: 0.01},
+	}}
+	peak := func() float64 {
+		samples, err := tr.Render(context.Background(), instruments, 8000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := 0.0
+		for _, s := range samples {
+			p = max(p, math.Abs(s))
+		}
+		return p
+	}
+
+	full := peak()
+	tr.Buses["drums"].Volume = 0
+	tr.Channels[1].Volume = 0
+	if got := peak(); got != 0 {
+		t.Errorf("muted bus still audible: peak %v", got)
+	}
+	tr.Buses["drums"].Volume = 0.8
+	if got := peak(); got == 0 || got >= full {
+		t.Errorf("drums alone peak %v, want between 0 and %v", got, full)
+	}
+}
+
 func TestTrack_Render(t *testing.T) {
 	inst := &instrument.Instrument{
 		Name:       "demo",
@@ -264,11 +729,12 @@ func TestTrack_Render(t *testing.T) {
 				},
 			},
 		},
-		Sequence: []string{"main"},
+		Sequence:     []string{"main"},
+		MasterVolume: 1,
 	}
 
 	instruments := map[string]*instrument.Instrument{"demo": inst}
-	samples, err := tr.Render(instruments, 44100)
+	samples, err := tr.Render(context.Background(), instruments, 44100)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -284,6 +750,394 @@ func TestTrack_Render(t *testing.T) {
 	}
 }
 
+func TestTrack_LoopSeam(t *testing.T) {
+	inst := &instrument.Instrument{
+		Name:       "demo",
+		Oscillator: instrument.OscillatorDef{Waveform: "square"},
+		Envelope:   audio.ADSR{Attack: 0.01, Sustain: 1},
+	}
+	held := [][]Note{{{Type: NoteOn, Name: "A", Octave: 3}}, {{Type: Sustain}}, {{Type: Sustain}}, {{Type: Sustain}}}
+	// The loop goes back to a note starting from silence, but the track
+	// ends with that note at full level: the seam jumps.
+	tr := &Track{
+		Tempo:        120,
+		TicksPerBeat: 4,
+		Loop:         true,
+		LoopStart:    1,
+		Channels:     []Channel{{Name: "m", Instrument: "demo", Volume: 0.5}},
+		Patterns: map[string]*Pattern{
+			"intro": {Name: "intro", Ticks: 4, Rows: [][]Note{{{Type: Silence}}}},
+			"loud":  {Name: "loud", Ticks: 4, Rows: held},
+		},
+		Sequence:     []string{"intro", "loud"},
+		MasterVolume: 1,
+	}
+	instruments := map[string]*instrument.Instrument{"demo": inst}
+
+	samples, err := tr.Render(context.Background(), instruments, 44100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seam := tr.LoopSeam(samples, 44100); seam <= SeamThreshold {
+		t.Fatalf("seam = %.3f, want a jump above %g", seam, SeamThreshold)
+	}
+	if w := tr.CheckLoopSeam(samples, 44100); !strings.Contains(w, "set loop_crossfade = 0.05") {
+		t.Errorf("warning = %q, want a loop_crossfade hint", w)
+	}
+
+	tr.LoopCrossfade = 0.05
+	faded, err := tr.Render(context.Background(), instruments, 44100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seam := tr.LoopSeam(faded, 44100); seam > SeamThreshold {
+		t.Errorf("seam with loop_crossfade = %.3f, want at most %g", seam, SeamThreshold)
+	}
+	if w := tr.CheckLoopSeam(faded, 44100); w != "" {
+		t.Errorf("warning = %q, want none", w)
+	}
+	// Only the crossfade changes.
+	n := len(samples) - int(0.05*44100)
+	if !slices.Equal(samples[:n], faded[:n]) {
+		t.Error("crossfade changed audio before the end")
+	}
+
+	for src, want := range map[string]string{
+		"loop_crossfade = 0.1":                            "loop.track: loop_crossfade needs loop = true",
+		"loop = true\nloop_crossfade = -1":                "loop.track: loop_crossfade must not be negative, got -1",
+		"loop = true\nloop_start = 1\nloop_crossfade = 1": "loop.track: loop_crossfade = 1 is longer than the loop, 0.5s",
+	} {
+		_, err := ParseTrack([]byte("tempo = 120\n"+src+`
+[[channel]]
+name = "m"
+instrument = "demo"
+[pattern.a]
+data = "m\nC4\nC4\nC4\nC4\n"
+[song]
+sequence = ["a", "a"]
+`), "loop.track")
+		if err == nil || err.Error() != want {
+			t.Errorf("%q: err = %v, want %q", src, err, want)
+		}
+	}
+}
+
+func TestTrack_RenderPattern(t *testing.T) {
+	inst := &instrument.Instrument{
+		Name:       "demo",
+		Oscillator: instrument.OscillatorDef{Waveform: "square"},
+		Envelope:   audio.ADSR{Sustain: 1, Release: 0.01},
+	}
+	silent := [][]Note{{{Type: Silence}}, {{Type: Silence}}}
+	tr := &Track{
+		Tempo:        120,
+		TicksPerBeat: 4,
+		Loop:         true,
+		Channels:     []Channel{{Name: "m", Instrument: "demo", Volume: 1}},
+		Patterns: map[string]*Pattern{
+			"quiet": {Name: "quiet", Ticks: 2, Rows: silent},
+			"tune":  {Name: "tune", Ticks: 3, Rows: [][]Note{{{Type: NoteOn, Name: "A", Octave: 4}}, {{Type: Sustain}}}},
+		},
+		Sequence:     []string{"quiet", "quiet", "tune", "quiet"},
+		MasterVolume: 1,
+	}
+	instruments := map[string]*instrument.Instrument{"demo": inst}
+
+	samples, err := tr.RenderPattern(context.Background(), "tune", instruments, 8000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 1000 samples a tick at 120 bpm, 4 ticks a beat and 8 kHz; the padded
+	// third tick counts.
+	if len(samples) != 3000 {
+		t.Errorf("tune rendered %d samples, want 3000", len(samples))
+	}
+	peak := 0.0
+	for _, s := range samples[:2000] {
+		peak = max(peak, math.Abs(s))
+	}
+	if peak == 0 {
+		t.Error("tune rendered silent")
+	}
+
+	samples, err = tr.RenderPattern(context.Background(), "quiet", instruments, 8000)
+	if err != nil || len(samples) != 2000 {
+		t.Fatalf("quiet: %d samples, %v; want 2000", len(samples), err)
+	}
+	if len(tr.Sequence) != 4 || !tr.Loop {
+		t.Error("RenderPattern changed the track's sequence")
+	}
+
+	if _, err := tr.RenderPattern(context.Background(), "chorus", instruments, 8000); err == nil || !strings.Contains(err.Error(), `unknown pattern "chorus"`) {
+		t.Errorf("err = %v, want unknown pattern", err)
+	}
+}
+
+func TestTrack_Downbeat(t *testing.T) {
+	tr, err := ParseTrack([]byte(`tempo = 120
+ticks_per_beat = 2
+beats_per_bar = 3
+[[channel]]
+name = "m"
+instrument = "x"
+[pattern.a]
+ticks = 14
+pad = true
+data = """
+m
+C4
+"""
+[song]
+sequence = ["a"]
+`), "test.track")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pat := tr.Patterns["a"]
+	var beats, bars []int
+	for row := range pat.Len() {
+		beat, bar := tr.Downbeat(pat, row)
+		if beat {
+			beats = append(beats, row)
+		}
+		if bar > 0 {
+			bars = append(bars, row, bar)
+		}
+	}
+	if !slices.Equal(beats, []int{0, 2, 4, 6, 8, 10, 12}) {
+		t.Errorf("beats at rows %v", beats)
+	}
+	// Bars every 6 rows, numbered from 1.
+	if !slices.Equal(bars, []int{0, 1, 6, 2, 12, 3}) {
+		t.Errorf("bars (row, number) = %v", bars)
+	}
+
+	tr, err = ParseTrack([]byte("tempo = 120\n[song]\nsequence = []\n"), "test.track")
+	if err != nil || tr.BeatsPerBar != 4 {
+		t.Errorf("default beats_per_bar = %v, %v; want 4", tr.BeatsPerBar, err)
+	}
+	if _, err := ParseTrack([]byte("tempo = 120\nbeats_per_bar = -3\n"), "test.track"); err == nil {
+		t.Error("expected an error for a negative beats_per_bar")
+	}
+}
+
+func TestTrack_RenderCanceled(t *testing.T) {
+	rows := make([][]Note, 64)
+	for i := range rows {
+		rows[i] = []Note{{Type: Silence}}
+	}
+	tr := &Track{
+		Tempo:        120,
+		TicksPerBeat: 4,
+		Channels:     []Channel{{Name: "m", Instrument: "demo"}},
+		Patterns:     map[string]*Pattern{"a": {Name: "a", Rows: rows}},
+		Sequence:     []string{"a", "a", "a", "a"},
+		MasterVolume: 1,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	samples, err := tr.Render(ctx, nil, 44100)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if samples != nil {
+		t.Errorf("got %d samples, want none", len(samples))
+	}
+}
+
+func TestTrack_RenderCached(t *testing.T) {
+	tr, err := ParseTrack([]byte(`tempo = 120
+ticks_per_beat = 4
+
+[[channel]]
+name = "lead"
+instrument = "tone"
+volume = 1
+
+[[channel]]
+name = "bass"
+instrument = "tone"
+volume = 0.5
+
+[pattern.a]
+data = """
+lead | bass
+C4   | C2
+---  | ...
+E4 v08 | ---
+---  | ---
+"""
+
+[pattern.b]
+data = """
+lead | bass
+---  | ...
+---  | G2
+^^^  | ---
+...  | ^^^
+"""
+
+[pattern.c]
+data = """
+lead | bass
+G4   | ...
+---  | ...
+"""
+
+[song]
+sequence = ["a", "b", "a", "b", "c"]
+`), "test.track")
+	if err != nil {
+		t.Fatal(err)
+	}
+	instruments := map[string]*instrument.Instrument{"tone": {
+		Name:       "tone",
+		Oscillator: instrument.OscillatorDef{Waveform: "sine"},
+		Envelope:   audio.ADSR{Attack: 0.01, Decay: 0.05, Sustain: 0.6, Release: 0.01},
+	}}
+	cache := NewBlockCache()
+	render := func(wantMisses, wantHits int) {
+		t.Helper()
+		cache.hits, cache.misses = 0, 0
+		var done, total int
+		got, err := tr.RenderCached(context.Background(), instruments, 8000, cache, func(d, n int) { done, total = d, n })
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cache.misses != wantMisses || cache.hits != wantHits {
+			t.Errorf("%d misses and %d hits, want %d and %d", cache.misses, cache.hits, wantMisses, wantHits)
+		}
+		if n := len(tr.Sequence); done != n || total != n {
+			t.Errorf("progress ended at %d/%d, want %d/%d", done, total, n, n)
+		}
+		want, err := tr.Render(context.Background(), instruments, 8000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, want) {
+			t.Error("cached render differs from a full render")
+		}
+	}
+
+	// b starts with the lead still sounding from a, so it is one block
+	// both times; so is a, which starts from silence.
+	render(3, 2)
+	if cache.Len() != 3 {
+		t.Errorf("cache holds %d blocks, want 3", cache.Len())
+	}
+	render(0, 5)
+
+	// Editing c re-renders only c; a volume change re-renders nothing.
+	tr.Patterns["c"].Rows[0][0] = Note{Type: NoteOn, Name: "A", Octave: 4}
+	render(1, 4)
+	tr.Channels[1].Volume = 0.9
+	render(0, 5)
+
+	// A changed instrument invalidates every block that uses it.
+	instruments["tone"] = &instrument.Instrument{
+		Name:       "tone",
+		Oscillator: instrument.OscillatorDef{Waveform: "triangle"},
+		Envelope:   instruments["tone"].Envelope,
+	}
+	render(3, 2)
+	if cache.Len() != 3 {
+		t.Errorf("cache holds %d blocks after the change, want the 3 in use", cache.Len())
+	}
+	cache.Reset()
+	render(3, 2)
+
+	// a ends with notes held, but replaces them on its first row, so a
+	// repeat is the same block.
+	tr.Sequence = []string{"a", "a", "a"}
+	render(0, 3)
+}
+
+func TestTrack_Duration(t *testing.T) {
+	rows := make([][]Note, 6)
+	for i := range rows {
+		rows[i] = []Note{{Type: Silence}}
+	}
+	tr := &Track{
+		Tempo:        150,
+		TicksPerBeat: 4,
+		Channels:     []Channel{{Name: "m", Instrument: "demo"}},
+		Patterns:     map[string]*Pattern{"a": {Name: "a", Rows: rows}},
+		Sequence:     []string{"a", "a", "a"},
+		MasterVolume: 1,
+	}
+	// 18 ticks at 10 ticks per second.
+	if got := tr.Duration(); math.Abs(got-1.8) > 1e-9 {
+		t.Errorf("Duration() = %v, want 1.8", got)
+	}
+	samples, err := tr.Render(context.Background(), nil, 44100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := float64(len(samples)) / 44100; math.Abs(got-tr.Duration()) > 1e-3 {
+		t.Errorf("rendered %vs, Duration() = %vs", got, tr.Duration())
+	}
+}
+
+func TestParseTrack_TicksRowCount(t *testing.T) {
+	input := `tempo = 150
+
+[[channel]]
+name = "m"
+instrument = "demo"
+
+[pattern.p]
+%s
+data = """
+m
+C4
+---
+^^^
+"""
+
+[song]
+sequence = ["p"]
+`
+	parse := func(fields string) (*Track, error) {
+		return ParseTrack(fmt.Appendf(nil, input, fields), "test.track")
+	}
+
+	for fields, want := range map[string]string{
+		"ticks = 2": "has 3 rows but ticks = 2, remove rows or raise ticks",
+		"ticks = 4": "has 3 rows but ticks = 4, add rows or set pad = true",
+	} {
+		if _, err := parse(fields); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: err = %v, want %q", fields, err, want)
+		}
+	}
+	for _, fields := range []string{"", "ticks = 3", "ticks = 3\npad = true"} {
+		tr, err := parse(fields)
+		if err != nil {
+			t.Errorf("%q: %v", fields, err)
+		} else if len(tr.Warnings) != 0 {
+			t.Errorf("%q: warnings = %v, want none", fields, tr.Warnings)
+		}
+	}
+
+	tr, err := parse("ticks = 5\npad = true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tr.Warnings) != 1 || !strings.Contains(tr.Warnings[0], `pattern "p" has 3 rows, padded with silence to ticks = 5`) {
+		t.Errorf("warnings = %v, want the padding warning", tr.Warnings)
+	}
+	// The padded ticks are rendered: 5 ticks at 10 ticks per second.
+	if got := tr.Duration(); math.Abs(got-0.5) > 1e-9 {
+		t.Errorf("Duration() = %v, want 0.5", got)
+	}
+	samples, err := tr.Render(context.Background(), nil, 44100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := 5 * 4410; len(samples) != want {
+		t.Errorf("rendered %d samples, want %d", len(samples), want)
+	}
+}
+
 func TestLoadTrack(t *testing.T) {
 	dir := t.TempDir()
 	content := `tempo = 120
@@ -313,3 +1167,118 @@ sequence = ["p"]
 		t.Errorf("tempo = %d, want 120", tr.Tempo)
 	}
 }
+
+func TestTrack_Ducking(t *testing.T) {
+	input := []byte(`
+tempo = 120
+ticks_per_beat = 4
+
+[[channel]]
+name = "kick"
+instrument = "tone"
+volume = 1
+
+[[channel]]
+name = "pad"
+instrument = "tone"
+volume = 1
+duck = { source = "kick", amount = 0.5, release = 0.1 }
+
+[pattern.main]
+data = """
+kick | pad
+...  | C4
+...  | ---
+C2   | ---
+^^^  | ---
+...  | ---
+...  | ---
+"""
+
+[song]
+sequence = ["main"]
+`)
+	tr, err := ParseTrack(input, "test.track")
+	if err != nil {
+		t.Fatal(err)
+	}
+	instruments := map[string]*instrument.Instrument{"tone": {
+		Name:       "tone",
+		Oscillator: instrument.OscillatorDef{Waveform: "square"},
+		Envelope:   audio.ADSR{Sustain: 1},
+	}}
+	const sr = 8000
+	channels, _, err := tr.renderChannels(context.Background(), instruments, sr, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr.applyDucking(channels, sr)
+
+	pad := channels[1]
+	tick := sr * 60 / 120 / 4 // samples per row
+	peak := func(from, to int) float64 {
+		p := 0.0
+		for _, s := range pad[from:to] {
+			p = max(p, math.Abs(s))
+		}
+		return p
+	}
+
+	before := peak(tick, 2*tick)
+	during := peak(2*tick+tick/4, 3*tick)
+	if before == 0 {
+		t.Fatal("pad is silent before the kick")
+	}
+	if during > before*0.6 {
+		t.Errorf("pad peak during kick = %v, want a dip below 60%% of %v", during, before)
+	}
+	// The kick onset is the first ducked sample.
+	if peak(2*tick-tick/4, 2*tick) < before*0.99 {
+		t.Error("pad ducked before the kick onset")
+	}
+	// After the kick stops, the gain recovers within a few release times.
+	if after := peak(len(pad)-tick/2, len(pad)); after < before*0.9 {
+		t.Errorf("pad peak after release = %v, want close to %v", after, before)
+	}
+}
+
+func TestParseTrack_DuckErrors(t *testing.T) {
+	base := `
+tempo = 120
+[bus.drums]
+[[channel]]
+name = "kick"
+instrument = "x"
+bus = "drums"
+[[channel]]
+name = "bass"
+instrument = "x"
+duck = %s
+[pattern.p]
+data = """
+kick | bass
+C2   | C2
+"""
+[song]
+sequence = ["p"]
+`
+	tests := []struct {
+		duck, want string
+	}{
+		{`{ source = "snare", amount = 0.5 }`, "not a channel or a bus"},
+		{`{ source = "bass", amount = 0.5 }`, "itself"},
+		{`{ source = "kick", amount = 1.5 }`, "between 0 and 1"},
+		{`{ source = "drums", amount = 0.5, release = -1 }`, "release"},
+	}
+	for _, tt := range tests {
+		_, err := ParseTrack([]byte(strings.Replace(base, "%s", tt.duck, 1)), "test.track")
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("duck %s: error = %v, want %q", tt.duck, err, tt.want)
+		}
+	}
+
+	// A bus is a valid source.
+	if _, err := ParseTrack([]byte(strings.Replace(base, "%s", `{ source = "drums", amount = 0.5 }`, 1)), "test.track"); err != nil {
+		t.Errorf("bus source: %v", err)
+	}
+}
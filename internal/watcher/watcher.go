@@ -1,9 +1,11 @@
 package watcher
 
 import (
-	"log"
+	"log/slog"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -25,31 +27,96 @@ func IsRuneFile(path string) bool {
 	return runeExtensions[filepath.Ext(path)]
 }
 
+// DefaultIgnorePatterns match editor swap, backup, and write-test files.
+// They are always applied in addition to any user-supplied patterns.
+var DefaultIgnorePatterns = []string{
+	"*.swp",
+	"*.swx",
+	"*~",
+	"4913",
+	".#*",
+	"#*#",
+}
+
+// IsIgnored reports whether name matches any of the given glob patterns.
+// Patterns without a slash match the base name; patterns with a slash
+// match trailing path segments, so both "*.tmp" and "drafts/*" work.
+func IsIgnored(name string, patterns []string) bool {
+	parts := strings.Split(filepath.ToSlash(name), "/")
+	for _, pat := range patterns {
+		n := strings.Count(pat, "/") + 1
+		if n > len(parts) {
+			continue
+		}
+		tail := strings.Join(parts[len(parts)-n:], "/")
+		if ok, _ := path.Match(pat, tail); ok {
+			return true
+		}
+	}
+	return false
+}
+
 // RebuildFunc is called with a list of changed file paths.
 type RebuildFunc func(changed []string) error
 
+// Option configures optional Watcher behavior.
+type Option func(*Watcher)
+
+// WithIgnorePatterns skips events for paths matching any of the glob patterns.
+func WithIgnorePatterns(patterns []string) Option {
+	return func(w *Watcher) {
+		w.ignore = append(w.ignore, patterns...)
+	}
+}
+
+// WithIgnoreDirs skips the directories and everything in them, such as the
+// build output, whose writes must never trigger a rebuild.
+func WithIgnoreDirs(dirs ...string) Option {
+	return func(w *Watcher) {
+		for _, d := range dirs {
+			w.ignoreDirs = append(w.ignoreDirs, filepath.Clean(d))
+		}
+	}
+}
+
+// WithLogger sends the watcher's messages to l instead of slog.Default().
+func WithLogger(l *slog.Logger) Option {
+	return func(w *Watcher) {
+		w.log = l
+	}
+}
+
 // Watcher watches rune files for changes and triggers rebuilds.
 type Watcher struct {
-	fsw       *fsnotify.Watcher
-	debounce  time.Duration
-	onRebuild RebuildFunc
-	deps      *DependencyTracker
-	done      chan struct{}
+	fsw        *fsnotify.Watcher
+	debounce   time.Duration
+	onRebuild  RebuildFunc
+	deps       *DependencyTracker
+	ignore     []string
+	ignoreDirs []string
+	log        *slog.Logger
+	done       chan struct{}
 }
 
 // New creates a new Watcher.
-func New(debounce time.Duration, onRebuild RebuildFunc) (*Watcher, error) {
+func New(debounce time.Duration, onRebuild RebuildFunc, opts ...Option) (*Watcher, error) {
 	fsw, err := fsnotify.NewWatcher()
 	if err != nil {
 		return nil, err
 	}
-	return &Watcher{
+	w := &Watcher{
 		fsw:       fsw,
 		debounce:  debounce,
 		onRebuild: onRebuild,
 		deps:      NewDependencyTracker(),
+		ignore:    append([]string(nil), DefaultIgnorePatterns...),
+		log:       slog.Default(),
 		done:      make(chan struct{}),
-	}, nil
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w, nil
 }
 
 // WatchDir recursively watches a directory for rune file changes.
@@ -59,16 +126,36 @@ func (w *Watcher) WatchDir(dir string) error {
 			return err
 		}
 		if d.IsDir() {
+			if w.inIgnoredDir(path) {
+				return filepath.SkipDir
+			}
 			return w.fsw.Add(path)
 		}
 		return nil
 	})
 }
 
+// inIgnoredDir reports whether path is one of the ignored directories or
+// inside one.
+func (w *Watcher) inIgnoredDir(path string) bool {
+	path = filepath.Clean(path)
+	for _, d := range w.ignoreDirs {
+		if path == d || strings.HasPrefix(path, d+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
 // Start begins watching for file changes. Blocks until Stop is called.
+//
+// Events are collected per path for the debounce window, so the
+// Rename+Create (and Remove+Create) pairs emitted by atomic-save editors
+// for the same final path coalesce into a single change.
 func (w *Watcher) Start() {
 	var mu sync.Mutex
 	pending := map[string]struct{}{}
+	var order []string
 	var timer *time.Timer
 
 	for {
@@ -77,7 +164,7 @@ func (w *Watcher) Start() {
 			if !ok {
 				return
 			}
-			if !IsRuneFile(event.Name) {
+			if !(IsRuneFile(event.Name) || w.deps.IsSample(event.Name)) || IsIgnored(event.Name, w.ignore) || w.inIgnoredDir(event.Name) {
 				continue
 			}
 			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Remove|fsnotify.Rename) == 0 {
@@ -85,26 +172,30 @@ func (w *Watcher) Start() {
 			}
 
 			mu.Lock()
-			pending[event.Name] = struct{}{}
+			if _, seen := pending[event.Name]; !seen {
+				pending[event.Name] = struct{}{}
+				order = append(order, event.Name)
+			}
 
 			if timer != nil {
 				timer.Stop()
 			}
 			timer = time.AfterFunc(w.debounce, func() {
 				mu.Lock()
-				files := make([]string, 0, len(pending))
-				for f := range pending {
-					files = append(files, f)
-				}
+				files := order
 				pending = map[string]struct{}{}
+				order = nil
 				mu.Unlock()
+				if len(files) == 0 {
+					return
+				}
 
 				// Expand dependencies.
 				expanded := w.deps.ExpandDependencies(files)
 
-				log.Printf("Rebuilding: %v", expanded)
+				w.log.Info("rebuilding", "files", expanded)
 				if err := w.onRebuild(expanded); err != nil {
-					log.Printf("Build error: %v", err)
+					w.log.Error("rebuild failed", "err", err)
 				}
 			})
 			mu.Unlock()
@@ -113,7 +204,7 @@ func (w *Watcher) Start() {
 			if !ok {
 				return
 			}
-			log.Printf("Watcher error: %v", err)
+			w.log.Error("watcher failed", "err", err)
 
 		case <-w.done:
 			return
@@ -121,6 +212,12 @@ func (w *Watcher) Start() {
 	}
 }
 
+// Dependencies returns the tracker the watcher expands changes with.
+// Samples registered on it are watched too.
+func (w *Watcher) Dependencies() *DependencyTracker {
+	return w.deps
+}
+
 // Stop signals the watcher to stop.
 func (w *Watcher) Stop() error {
 	close(w.done)
@@ -128,13 +225,17 @@ func (w *Watcher) Stop() error {
 }
 
 // DependencyTracker tracks cross-file dependencies for incremental rebuilds.
+// It is safe for concurrent use.
 type DependencyTracker struct {
+	mu sync.Mutex
 	// paletteDeps maps palette name -> sprite files that use it
 	paletteDeps map[string][]string
 	// spriteDeps maps sprite file -> map files that use it
 	spriteDeps map[string][]string
 	// instDeps maps instrument name -> sfx/track files that use it
 	instDeps map[string][]string
+	// sampleDeps maps sample path -> instrument files that play it
+	sampleDeps map[string][]string
 }
 
 // NewDependencyTracker creates a new empty tracker.
@@ -143,11 +244,14 @@ func NewDependencyTracker() *DependencyTracker {
 		paletteDeps: make(map[string][]string),
 		spriteDeps:  make(map[string][]string),
 		instDeps:    make(map[string][]string),
+		sampleDeps:  make(map[string][]string),
 	}
 }
 
 // ExpandDependencies takes changed files and returns all files that need rebuilding.
 func (dt *DependencyTracker) ExpandDependencies(changed []string) []string {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
 	seen := map[string]bool{}
 	var result []string
 
@@ -175,6 +279,10 @@ func (dt *DependencyTracker) ExpandDependencies(changed []string) []string {
 			for _, dep := range dt.instDeps[base] {
 				add(dep)
 			}
+		case ".wav":
+			for _, dep := range dt.sampleDeps[filepath.Clean(path)] {
+				add(dep)
+			}
 		}
 	}
 
@@ -186,15 +294,40 @@ func (dt *DependencyTracker) ExpandDependencies(changed []string) []string {
 
 // RegisterPaletteDep records that a sprite file depends on a palette.
 func (dt *DependencyTracker) RegisterPaletteDep(paletteName, spriteFile string) {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
 	dt.paletteDeps[paletteName] = append(dt.paletteDeps[paletteName], spriteFile)
 }
 
 // RegisterSpriteDep records that a map file depends on a sprite file.
 func (dt *DependencyTracker) RegisterSpriteDep(spriteName, mapFile string) {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
 	dt.spriteDeps[spriteName] = append(dt.spriteDeps[spriteName], mapFile)
 }
 
 // RegisterInstrumentDep records that a track/sfx file depends on an instrument.
 func (dt *DependencyTracker) RegisterInstrumentDep(instName, audioFile string) {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
 	dt.instDeps[instName] = append(dt.instDeps[instName], audioFile)
 }
+
+// RegisterSampleDep records that an instrument file plays a sample, a WAV
+// file the watcher then watches too. Registering a pair again is a no-op.
+func (dt *DependencyTracker) RegisterSampleDep(sampleFile, instFile string) {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	sampleFile = filepath.Clean(sampleFile)
+	if !slices.Contains(dt.sampleDeps[sampleFile], instFile) {
+		dt.sampleDeps[sampleFile] = append(dt.sampleDeps[sampleFile], instFile)
+	}
+}
+
+// IsSample reports whether path is a registered sample.
+func (dt *DependencyTracker) IsSample(path string) bool {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	_, ok := dt.sampleDeps[filepath.Clean(path)]
+	return ok
+}
@@ -1,8 +1,13 @@
 package watcher
 
 import (
+	"bytes"
+	"errors"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -79,6 +84,19 @@ func TestDependencyTracker_ExpandDependencies(t *testing.T) {
 		}
 	})
 
+	t.Run("sample change cascades to instrument and track", func(t *testing.T) {
+		dt.RegisterSampleDep("/assets/samples/piano.wav", "/assets/piano.inst")
+		dt.RegisterSampleDep("/assets/samples/piano.wav", "/assets/piano.inst")
+		if !dt.IsSample("/assets/samples/../samples/piano.wav") || dt.IsSample("/assets/samples/other.wav") {
+			t.Error("IsSample should match registered samples only")
+		}
+		result := dt.ExpandDependencies([]string{"/assets/samples/piano.wav"})
+		want := []string{"/assets/samples/piano.wav", "/assets/piano.inst", "/assets/bgm.track"}
+		if !slices.Equal(result, want) {
+			t.Errorf("got %v, want %v", result, want)
+		}
+	})
+
 	t.Run("no duplicates", func(t *testing.T) {
 		result := dt.ExpandDependencies([]string{"/assets/default.palette", "/assets/player.sprite"})
 		seen := map[string]int{}
@@ -203,6 +221,48 @@ func TestWatcher_IgnoresNonRuneFiles(t *testing.T) {
 	}
 }
 
+func TestWatcher_IgnoreDirs(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "build")
+	if err := os.MkdirAll(out, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var rebuilt []string
+	w, err := New(50*time.Millisecond, func(changed []string) error {
+		mu.Lock()
+		rebuilt = append(rebuilt, changed...)
+		mu.Unlock()
+		return nil
+	}, WithIgnoreDirs(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WatchDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	go w.Start()
+	time.Sleep(100 * time.Millisecond)
+
+	// Written into the ignored directory, and a sibling only sharing its
+	// name as a prefix.
+	os.WriteFile(filepath.Join(out, "copy.sprite"), []byte("x"), 0644)
+	os.WriteFile(filepath.Join(dir, "build.sprite"), []byte("x"), 0644)
+	time.Sleep(300 * time.Millisecond)
+
+	mu.Lock()
+	got := slices.Clone(rebuilt)
+	mu.Unlock()
+	if want := []string{filepath.Join(dir, "build.sprite")}; !slices.Equal(got, want) {
+		t.Errorf("rebuilt %v, want %v", got, want)
+	}
+
+	if err := w.Stop(); err != nil {
+		t.Errorf("Stop() error: %v", err)
+	}
+}
+
 func TestWatcher_Debounce(t *testing.T) {
 	dir := t.TempDir()
 
@@ -259,3 +319,132 @@ func TestWatcher_Debounce(t *testing.T) {
 		t.Errorf("Stop() error: %v", err)
 	}
 }
+
+func TestIsIgnored(t *testing.T) {
+	patterns := append([]string{"*.tmp", "drafts/*"}, DefaultIgnorePatterns...)
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/assets/sprites/player.sprite", false},
+		{"/assets/sprites/player.tmp", true},
+		{"/assets/sprites/.player.sprite.swp", true},
+		{"/assets/sprites/player.sprite~", true},
+		{"/assets/sprites/4913", true},
+		{"/assets/drafts/wip.sprite", true},
+		{"/assets/sprites/drafts.sprite", false},
+	}
+	for _, tt := range tests {
+		if got := IsIgnored(tt.path, patterns); got != tt.want {
+			t.Errorf("IsIgnored(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestWatcher_AtomicSave(t *testing.T) {
+	dir := t.TempDir()
+
+	target := filepath.Join(dir, "test.sprite")
+	if err := os.WriteFile(target, []byte("v0"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var rebuilds [][]string
+
+	w, err := New(200*time.Millisecond, func(changed []string) error {
+		mu.Lock()
+		rebuilds = append(rebuilds, changed)
+		mu.Unlock()
+		return nil
+	}, WithIgnorePatterns([]string{".tmp-*"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.WatchDir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	go w.Start()
+	time.Sleep(100 * time.Millisecond)
+
+	// Editor-style atomic save: write a temp file, then rename it over the target.
+	tmp := filepath.Join(dir, ".tmp-test.sprite")
+	if err := os.WriteFile(tmp, []byte("v1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(500 * time.Millisecond)
+
+	mu.Lock()
+	got := rebuilds
+	mu.Unlock()
+
+	if err := w.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 1 {
+		t.Fatalf("expected exactly 1 rebuild, got %d: %v", len(got), got)
+	}
+	if len(got[0]) != 1 || got[0][0] != target {
+		t.Errorf("changed = %v, want [%s]", got[0], target)
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe to write from the debounce goroutine.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestWatcher_Logs(t *testing.T) {
+	dir := t.TempDir()
+	testFile := filepath.Join(dir, "test.sprite")
+	if err := os.WriteFile(testFile, []byte("initial"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out syncBuffer
+	logger := slog.New(slog.NewTextHandler(&out, nil))
+	w, err := New(50*time.Millisecond, func(changed []string) error {
+		return errors.New("bad sprite")
+	}, WithLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WatchDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	go w.Start()
+	defer w.Stop()
+
+	time.Sleep(100 * time.Millisecond)
+	if err := os.WriteFile(testFile, []byte("updated"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(300 * time.Millisecond)
+
+	got := out.String()
+	for _, want := range []string{"level=INFO msg=rebuilding", "test.sprite", `level=ERROR msg="rebuild failed" err="bad sprite"`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("log missing %q:\n%s", want, got)
+		}
+	}
+}